@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// rejectDraining answers 503 to a mutation refused while draining
+func rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server is draining", http.StatusServiceUnavailable)
+}
+
+// handleHealth reports 503 while draining so load balancers stop routing new requests
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if s.trees.Draining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// shutdown drains every group tree, logging each group's final state, and then closes
+// the listener, waiting up to timeout for open requests
+// Once draining starts, reads are refused with 503 like mutations
+func (s *server) shutdown(srv *http.Server, timeout time.Duration) error {
+	drainErr := s.trees.Drain(func(id string, t *tree.Tree) {
+		log.Printf("group %s drained at epoch %d with %d members", id, t.Epoch(), t.MemberCount())
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return errors.Join(drainErr, srv.Shutdown(ctx))
+}
@@ -0,0 +1,453 @@
+// Command chat-server is a minimal MLS delivery service keeping the public ratchet tree
+// of each group
+//
+// The first member to publish a KeyPackage founds the group; later KeyPackages wait
+// until a member commits an Add for them, which the server checks against its copy of
+// the tree before relaying the commit to the group and the Welcome to the new members.
+// Chat messages are PrivateMessages the server only orders and relays: it never holds
+// an epoch secret. Every epoch is acknowledged with a signed receipt.
+//
+// On SIGINT or SIGTERM the server drains: joins, commits, messages and tree reads are
+// refused with 503, the commit in progress finishes, every tree is flushed, and only
+// then does the listener close, so a rolling deploy never cuts a change in half.
+//
+//	go run ./examples/chat-server -addr :8080
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/snowmerak/mls/lib/group"
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/receipt"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/tree/registry"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// ciphersuite is the one ciphersuite groups on this server use
+const ciphersuite = tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+
+// Kinds of group log entries
+const (
+	entryCommit  = "commit"  // a PublicMessage carrying a commit
+	entryMessage = "message" // a PrivateMessage carrying a chat line
+)
+
+// entry is one record of a group's log, which members replay in order
+type entry struct {
+	Kind string `json:"kind"`
+	Data []byte `json:"data"`
+}
+
+// pendingJoin is a validated KeyPackage waiting for a member to add it
+type pendingJoin struct {
+	Name       string `json:"name"`
+	KeyPackage []byte `json:"key_package"`
+}
+
+// welcomeEntry is the Welcome of a new member and the log position it joins at
+type welcomeEntry struct {
+	Welcome []byte `json:"welcome"`
+	Next    int    `json:"next"`
+}
+
+// chatGroup is the server-side state of one chat group besides its tree
+type chatGroup struct {
+	log      []entry
+	pending  []pendingJoin
+	welcomes map[string]welcomeEntry
+}
+
+// server holds all groups and the receipt issuer
+type server struct {
+	trees *registry.Registry // one tree per group, drained on shutdown
+
+	issuer *receipt.Issuer
+
+	mu     sync.Mutex // guards the fields below
+	groups map[string]*chatGroup
+}
+
+var (
+	// errMemberExists rejects a join under a name already in the group or waiting to join it
+	errMemberExists = errors.New("member already exists")
+	// errStaleEpoch rejects commits and messages of an epoch the group has left
+	errStaleEpoch = errors.New("group has moved to another epoch")
+)
+
+type joinRequest struct {
+	KeyPackage []byte `json:"key_package"`
+}
+
+type joinResponse struct {
+	Receipt *receipt.Receipt `json:"receipt,omitempty"` // set when the join founded the group
+	Pending bool             `json:"pending"`           // set when a member has to add the joiner
+}
+
+type commitRequest struct {
+	Commit  []byte `json:"commit"`
+	Welcome []byte `json:"welcome"`
+}
+
+type commitResponse struct {
+	Receipt *receipt.Receipt `json:"receipt"`
+}
+
+type logResponse struct {
+	Next    int     `json:"next"`
+	Entries []entry `json:"entries"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	grace := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for open requests when draining")
+	flag.Parse()
+
+	issuer, err := receipt.GenerateIssuer(rand.Reader)
+	if err != nil {
+		log.Fatalf("failed to create receipt issuer: %v", err)
+	}
+	s := &server{
+		trees: registry.New(func(id string) (*tree.Tree, error) {
+			return tree.NewTreeWithStore(nil, tree.WithCiphersuite(ciphersuite), tree.WithGroupID([]byte(id)))
+		}),
+		groups: make(map[string]*chatGroup),
+		issuer: issuer,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /receipt-key", s.handleReceiptKey)
+	mux.HandleFunc("POST /groups/{group}/members", s.handleJoin)
+	mux.HandleFunc("GET /groups/{group}/pending", s.handlePending)
+	mux.HandleFunc("POST /groups/{group}/commits", s.handleCommit)
+	mux.HandleFunc("GET /groups/{group}/welcomes/{name}", s.handleWelcome)
+	mux.HandleFunc("GET /groups/{group}/tree", s.handleTree)
+	mux.HandleFunc("GET /groups/{group}/receipts/{epoch}", s.handleReceipt)
+	mux.HandleFunc("POST /groups/{group}/messages", s.handlePost)
+	mux.HandleFunc("GET /groups/{group}/messages", s.handleFetch)
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := <-stop
+		log.Printf("received %s, draining", sig)
+		if err := s.shutdown(srv, *grace); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("chat server listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	log.Printf("chat server stopped")
+}
+
+// groupFor returns the group with the given id, creating it on first use
+// Callers must hold s.mu
+func (s *server) groupFor(id string) *chatGroup {
+	g, ok := s.groups[id]
+	if !ok {
+		g = &chatGroup{welcomes: make(map[string]welcomeEntry)}
+		s.groups[id] = g
+	}
+	return g
+}
+
+func (s *server) handleReceiptKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string][]byte{"public_key": s.issuer.PublicKey()})
+}
+
+// handleJoin founds the group with the first KeyPackage and queues the later ones
+// KeyPackages that fail validation are answered with 400; 500 is left for failures
+// to store the founder in the tree
+func (s *server) handleJoin(w http.ResponseWriter, r *http.Request) {
+	var req joinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid join request", http.StatusBadRequest)
+		return
+	}
+	kp, err := keypackage.Unmarshal(req.KeyPackage)
+	if err != nil {
+		http.Error(w, "invalid key package: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := kp.Validate(ciphersuite, time.Now()); err != nil {
+		http.Error(w, "invalid key package: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := kp.Identity()
+
+	id := r.PathValue("group")
+	var resp joinResponse
+	status := http.StatusInternalServerError
+	err = s.trees.Update(id, func(t *tree.Tree) error {
+		if _, exists := t.Find(name); exists {
+			status = http.StatusConflict
+			return errMemberExists
+		}
+		if t.MemberCount() > 0 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			g := s.groupFor(id)
+			for _, p := range g.pending {
+				if p.Name == name {
+					status = http.StatusConflict
+					return errMemberExists
+				}
+			}
+			g.pending = append(g.pending, pendingJoin{Name: name, KeyPackage: req.KeyPackage})
+			resp.Pending = true
+			return nil
+		}
+
+		if err := t.InsertFromKeyPackage(kp); err != nil {
+			status = insertStatus(err)
+			return err
+		}
+		rec, err := s.issuer.Issue(t, "found "+name)
+		resp.Receipt = rec
+		return err
+	})
+	if errors.Is(err, registry.ErrDraining) {
+		rejectDraining(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// insertStatus answers a failed insert with 409 for taken names, 400 when the key
+// package was at fault and 500 when the tree could not store the member
+func insertStatus(err error) int {
+	switch {
+	case errors.Is(err, tree.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, tree.ErrEmptyKey),
+		errors.Is(err, tree.ErrKeyAlgorithmMismatch),
+		errors.Is(err, tree.ErrInvalidSignature),
+		errors.Is(err, tree.ErrCredentialRejected),
+		errors.Is(err, tree.ErrUnsupportedCapability),
+		errors.Is(err, tree.ErrLeafExpired),
+		errors.Is(err, tree.ErrReservedName):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *server) handlePending(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, s.groupFor(r.PathValue("group")).pending)
+}
+
+// handleCommit applies a member's commit to the group's tree and relays it
+// The commit has to be for the current epoch, so of two members committing at once
+// only the first gets through and the other receives 409 and replays the first
+func (s *server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	var req commitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid commit request", http.StatusBadRequest)
+		return
+	}
+	m, err := group.UnmarshalPublicMessage(req.Commit)
+	if err != nil {
+		http.Error(w, "invalid commit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("group")
+	var resp commitResponse
+	status := http.StatusInternalServerError
+	err = s.trees.Update(id, func(t *tree.Tree) error {
+		if m.Content.Epoch != t.Epoch() {
+			status = http.StatusConflict
+			return fmt.Errorf("commit is for epoch %d: %w", m.Content.Epoch, errStaleEpoch)
+		}
+		commit, err := m.Content.Commit(t)
+		if err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+		// The server cannot check the confirmation tag without the epoch secrets, but it
+		// follows the transcript so its receipts match the members' group context
+		suite, err := treekem.NewSuite(ciphersuite)
+		if err != nil {
+			return err
+		}
+		confirmed, err := group.ConfirmedTranscriptHash(suite, t.InterimTranscriptHash(), m)
+		if err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+		interim, err := group.InterimTranscriptHash(suite, confirmed, m.ConfirmationTag)
+		if err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+		// ProcessCommit stages the commit on a copy first, so a commit that does not
+		// apply leaves the tree alone
+		if _, err := group.ProcessCommit(t, commit); err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+		if err := t.SetTranscriptHashes(confirmed, interim); err != nil {
+			return err
+		}
+		if resp.Receipt, err = s.issuer.Issue(t, "commit by "+commit.Committer); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		g := s.groupFor(id)
+		g.log = append(g.log, entry{Kind: entryCommit, Data: req.Commit})
+		next := len(g.log)
+		for _, p := range commit.Proposals {
+			add, ok := p.(*group.Add)
+			if !ok {
+				continue
+			}
+			name := add.KeyPackage.Identity()
+			g.welcomes[name] = welcomeEntry{Welcome: req.Welcome, Next: next}
+			for i := range g.pending {
+				if g.pending[i].Name == name {
+					g.pending = append(g.pending[:i], g.pending[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, registry.ErrDraining) {
+		rejectDraining(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) handleWelcome(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	welcome, ok := s.groupFor(r.PathValue("group")).welcomes[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "welcome not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, welcome)
+}
+
+func (s *server) handleTree(w http.ResponseWriter, r *http.Request) {
+	err := s.trees.View(r.PathValue("group"), func(t *tree.Tree) error {
+		writeJSON(w, t.GetTreeStructure())
+		return nil
+	})
+	if errors.Is(err, registry.ErrDraining) {
+		rejectDraining(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *server) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	epoch, err := strconv.ParseUint(r.PathValue("epoch"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid epoch", http.StatusBadRequest)
+		return
+	}
+
+	rec, ok := s.issuer.Get([]byte(r.PathValue("group")), epoch)
+	if !ok {
+		http.Error(w, "receipt not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, rec)
+}
+
+// handlePost relays a PrivateMessage of the current epoch
+// Messages of an epoch a commit already ended are refused with 409, so members never
+// find a message in the log after the commit that retired its keys
+func (s *server) handlePost(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+	m, err := group.UnmarshalPrivateMessage(body)
+	if err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("group")
+	err = s.trees.View(id, func(t *tree.Tree) error {
+		if m.Epoch != t.Epoch() {
+			return fmt.Errorf("message is for epoch %d: %w", m.Epoch, errStaleEpoch)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		g := s.groupFor(id)
+		g.log = append(g.log, entry{Kind: entryMessage, Data: body})
+		return nil
+	})
+	if errors.Is(err, registry.ErrDraining) {
+		rejectDraining(w)
+		return
+	}
+	if errors.Is(err, errStaleEpoch) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *server) handleFetch(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.groupFor(r.PathValue("group"))
+	if since < 0 || since > len(g.log) {
+		since = len(g.log)
+	}
+	writeJSON(w, logResponse{Next: len(g.log), Entries: g.log[since:]})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
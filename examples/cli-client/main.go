@@ -0,0 +1,459 @@
+// Command cli-client chats end-to-end encrypted in a group on the example chat server
+//
+// The client publishes a KeyPackage and either founds the group or waits for the
+// Welcome a member sends once it has committed the client's Add. From then on it keeps
+// the group's tree and epoch secrets itself: it merges the commits in the group log,
+// commits the Adds of newcomers, and seals and opens chat lines as PrivateMessages.
+// The server sees KeyPackages, commits and ciphertext, never an epoch secret.
+//
+//	go run ./examples/cli-client -server http://localhost:8080 -group demo -name alice
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/snowmerak/mls/lib/group"
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/receipt"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+	"github.com/snowmerak/mls/lib/welcome"
+)
+
+// ciphersuite is the ciphersuite the example server runs its groups with
+const ciphersuite = tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+
+var (
+	// errNotFound is returned by call for 404 responses
+	errNotFound = errors.New("not found")
+	// errConflict is returned by call for 409 responses, which the server answers to
+	// commits and messages of an epoch the group has left
+	errConflict = errors.New("conflict")
+)
+
+// member is the client's view of the group: its replica of the tree and the secrets
+// of the current epoch
+type member struct {
+	server     string // base URL of the group on the server
+	name       string
+	signer     crypto.Signer
+	receiptKey ed25519.PublicKey
+
+	tree      *tree.Tree
+	secrets   *group.EpochSecrets
+	protector *group.Protector
+	next      int          // position in the group log
+	committed *stagedEpoch // the client's own commit, taken by the server but not yet replayed
+}
+
+// stagedEpoch is the state a commit of the client's own leads to
+type stagedEpoch struct {
+	commit  []byte
+	tree    *tree.Tree
+	secrets *group.EpochSecrets
+	receipt *receipt.Receipt
+}
+
+func main() {
+	serverURL := flag.String("server", "http://localhost:8080", "chat server base URL")
+	groupID := flag.String("group", "demo", "group to join")
+	name := flag.String("name", "", "member name")
+	flag.Parse()
+
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+
+	var receiptKey struct {
+		PublicKey []byte `json:"public_key"`
+	}
+	if err := call(http.MethodGet, *serverURL+"/receipt-key", nil, &receiptKey); err != nil {
+		log.Fatalf("failed to fetch receipt key: %v", err)
+	}
+
+	signer, err := keypackage.GenerateSignatureKey(ciphersuite)
+	if err != nil {
+		log.Fatalf("failed to generate signature key: %v", err)
+	}
+	m := &member{
+		server:     *serverURL + "/groups/" + *groupID,
+		name:       *name,
+		signer:     signer,
+		receiptKey: ed25519.PublicKey(receiptKey.PublicKey),
+	}
+	if err := m.join([]byte(*groupID)); err != nil {
+		log.Fatalf("failed to join group: %v", err)
+	}
+	log.Printf("joined %s at epoch %d with %d members", *groupID, m.tree.Epoch(), m.tree.MemberCount())
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			if err := m.send(line); err != nil {
+				log.Printf("failed to send message: %v", err)
+			}
+		case <-ticker.C:
+			if err := m.sync(); err != nil {
+				log.Printf("failed to sync: %v", err)
+			}
+		}
+	}
+}
+
+// join publishes a KeyPackage and enters the group, founding it when the group is empty
+// and otherwise waiting for the Welcome of the commit that adds the client
+func (m *member) join(groupID []byte) error {
+	kp, private, err := keypackage.Generate(ciphersuite, []byte(m.name), m.signer)
+	if err != nil {
+		return err
+	}
+	encoded, err := kp.Marshal()
+	if err != nil {
+		return err
+	}
+	var joined struct {
+		Receipt *receipt.Receipt `json:"receipt"`
+		Pending bool             `json:"pending"`
+	}
+	if err := call(http.MethodPost, m.server+"/members", map[string][]byte{"key_package": encoded}, &joined); err != nil {
+		return err
+	}
+
+	suite, err := treekem.NewSuite(ciphersuite)
+	if err != nil {
+		return err
+	}
+	if !joined.Pending {
+		// The founder builds the same one-member tree as the server and starts the key
+		// schedule from a fresh init secret (RFC 9420 section 11)
+		if m.tree, err = tree.NewTreeWithStore(nil, tree.WithCiphersuite(ciphersuite), tree.WithGroupID(groupID)); err != nil {
+			return err
+		}
+		if err := m.tree.InsertFromKeyPackage(kp); err != nil {
+			return err
+		}
+		initSecret := make([]byte, suite.HashSize())
+		if _, err := rand.Read(initSecret); err != nil {
+			return err
+		}
+		if m.secrets, err = group.DeriveEpochSecrets(suite, initSecret, nil, nil, m.tree.GroupContext()); err != nil {
+			return err
+		}
+		return m.enterEpoch(joined.Receipt)
+	}
+
+	log.Printf("waiting for a member to add %s", m.name)
+	var invite struct {
+		Welcome []byte `json:"welcome"`
+		Next    int    `json:"next"`
+	}
+	for {
+		err := call(http.MethodGet, m.server+"/welcomes/"+m.name, nil, &invite)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errNotFound) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+	w, err := welcome.Unmarshal(invite.Welcome)
+	if err != nil {
+		return err
+	}
+	t, secrets, _, err := w.Join(kp, private.InitKey, nil)
+	if err != nil {
+		return err
+	}
+	m.tree, m.next = t, invite.Next
+	if m.secrets, err = group.DeriveEpochSecretsFromJoiner(suite, secrets.JoinerSecret, nil, t.GroupContext()); err != nil {
+		return err
+	}
+	var rec receipt.Receipt
+	if err := call(http.MethodGet, m.server+"/receipts/"+strconv.FormatUint(t.Epoch(), 10), nil, &rec); err != nil {
+		return fmt.Errorf("failed to fetch receipt: %w", err)
+	}
+	return m.enterEpoch(&rec)
+}
+
+// enterEpoch checks the server's receipt for the epoch the tree is in against the
+// client's own group context and keys the epoch's Protector
+func (m *member) enterEpoch(rec *receipt.Receipt) error {
+	if rec == nil {
+		return errors.New("server sent no receipt")
+	}
+	if err := rec.Verify(m.receiptKey); err != nil {
+		return err
+	}
+	if err := rec.Check(m.tree.GroupContext()); err != nil {
+		return fmt.Errorf("server disagrees on the group state: %w", err)
+	}
+	protector, err := group.NewProtector(m.tree, m.secrets)
+	if err != nil {
+		return err
+	}
+	m.protector = protector
+	return nil
+}
+
+// sendAttempts bounds how often send reseals a line for a newer epoch
+const sendAttempts = 3
+
+// send encrypts line for the current epoch and posts it
+// The client catches up with the log first, so a commit the server has already taken,
+// its own included, does not leave the line sealed for an epoch that has ended. When
+// another member's commit lands in between, the server answers 409 and the line is
+// sealed again for the epoch that commit starts
+func (m *member) send(line string) error {
+	for range sendAttempts {
+		if err := m.sync(); err != nil {
+			return err
+		}
+		leaf, ok := m.tree.Find(m.name)
+		if !ok {
+			return fmt.Errorf("%s is not in the group", m.name)
+		}
+		message, err := m.protector.Encrypt(uint32(leaf.LeafIndex()), m.signer, nil, []byte(line))
+		if err != nil {
+			return err
+		}
+		encoded, err := message.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := call(http.MethodPost, m.server+"/messages", encoded, nil); !errors.Is(err, errConflict) {
+			return err
+		}
+	}
+	return errors.New("the group kept moving to new epochs, send the message again")
+}
+
+// sync replays the group log and then commits the Adds of any pending joiners
+func (m *member) sync() error {
+	var resp struct {
+		Next    int `json:"next"`
+		Entries []struct {
+			Kind string `json:"kind"`
+			Data []byte `json:"data"`
+		} `json:"entries"`
+	}
+	if err := call(http.MethodGet, fmt.Sprintf("%s/messages?since=%d", m.server, m.next), nil, &resp); err != nil {
+		return err
+	}
+	for _, e := range resp.Entries {
+		var err error
+		switch e.Kind {
+		case "commit":
+			err = m.merge(e.Data)
+		case "message":
+			err = m.open(e.Data)
+		}
+		if err != nil {
+			return err
+		}
+		m.next++
+	}
+
+	var pending []struct {
+		Name       string `json:"name"`
+		KeyPackage []byte `json:"key_package"`
+	}
+	if err := call(http.MethodGet, m.server+"/pending", nil, &pending); err != nil {
+		return err
+	}
+	var adds []*keypackage.KeyPackage
+	for _, p := range pending {
+		kp, err := keypackage.Unmarshal(p.KeyPackage)
+		if err != nil {
+			return err
+		}
+		adds = append(adds, kp)
+	}
+	if len(adds) == 0 || m.committed != nil {
+		return nil
+	}
+	return m.commitAdds(adds)
+}
+
+// merge moves the client into the epoch of a commit, adopting the staged state when
+// the commit is the client's own
+func (m *member) merge(data []byte) error {
+	if staged := m.committed; staged != nil && bytes.Equal(data, staged.commit) {
+		m.tree, m.secrets, m.committed = staged.tree, staged.secrets, nil
+		if err := m.enterEpoch(staged.receipt); err != nil {
+			return err
+		}
+		fmt.Printf("* epoch %d, %d members\n", m.tree.Epoch(), m.tree.MemberCount())
+		return nil
+	}
+	m.committed = nil
+	commit, err := group.UnmarshalPublicMessage(data)
+	if err != nil {
+		return err
+	}
+	if err := commit.Verify(m.tree, m.secrets.MembershipKey); err != nil {
+		return fmt.Errorf("rejected commit: %w", err)
+	}
+	secrets, err := group.MergeCommit(m.tree, commit, m.secrets.InitSecret, nil, nil)
+	if err != nil {
+		return err
+	}
+	m.secrets = secrets
+	if m.protector, err = group.NewProtector(m.tree, secrets); err != nil {
+		return err
+	}
+	fmt.Printf("* epoch %d, %d members\n", m.tree.Epoch(), m.tree.MemberCount())
+	return nil
+}
+
+// open decrypts and prints a chat line
+func (m *member) open(data []byte) error {
+	message, err := group.UnmarshalPrivateMessage(data)
+	if err != nil {
+		return err
+	}
+	content, _, err := m.protector.Decrypt(message)
+	if errors.Is(err, tree.ErrReplay) {
+		// The client's own messages: their generations were used when it sent them
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	leaves := m.tree.GetLeaves()
+	if int(content.Sender) >= len(leaves) {
+		return fmt.Errorf("message from unknown leaf %d", content.Sender)
+	}
+	fmt.Printf("%s: %s\n", leaves[content.Sender].Name(), content.Content)
+	return nil
+}
+
+// commitAdds adds the pending joiners in a commit without an UpdatePath and sends them
+// a Welcome. The commit is merged on a clone of the tree, which replaces the client's
+// when the commit comes up in the log, after the messages of the epoch it ends; when
+// another member committed first the server answers 409 and the clone is dropped
+func (m *member) commitAdds(adds []*keypackage.KeyPackage) error {
+	staged, err := m.tree.Clone("")
+	if err != nil {
+		return err
+	}
+	proposals := make([]group.Proposal, len(adds))
+	for i, kp := range adds {
+		proposals[i] = &group.Add{KeyPackage: kp}
+	}
+	commit := &group.Commit{Committer: m.name, Proposals: proposals}
+	content, err := group.FrameCommit(staged, commit, nil)
+	if err != nil {
+		return err
+	}
+	message, err := group.SignPublicMessage(staged, content, m.signer)
+	if err != nil {
+		return err
+	}
+	sent := staged.GroupContext()
+	secrets, err := group.MergeCommit(staged, message, m.secrets.InitSecret, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := message.SetMembershipTag(sent, m.secrets.MembershipKey); err != nil {
+		return err
+	}
+
+	builder, err := welcome.NewBuilder(staged, secrets.JoinerSecret)
+	if err != nil {
+		return err
+	}
+	for _, kp := range adds {
+		if err := builder.AddMember(kp, nil); err != nil {
+			return err
+		}
+	}
+	w, err := builder.WithConfirmationTag(message.ConfirmationTag).Build(m.signer, m.name)
+	if err != nil {
+		return err
+	}
+	encodedCommit, err := message.Marshal()
+	if err != nil {
+		return err
+	}
+	encodedWelcome, err := w.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Receipt *receipt.Receipt `json:"receipt"`
+	}
+	err = call(http.MethodPost, m.server+"/commits", map[string][]byte{"commit": encodedCommit, "welcome": encodedWelcome}, &resp)
+	if errors.Is(err, errConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.committed = &stagedEpoch{commit: encodedCommit, tree: staged, secrets: secrets, receipt: resp.Receipt}
+	for _, kp := range adds {
+		fmt.Printf("* adding %s\n", kp.Identity())
+	}
+	return nil
+}
+
+// call sends an optional JSON body and decodes an optional JSON response
+func call(method, url string, body any, out any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &payload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return errConflict
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,3 +1,10 @@
 module github.com/snowmerak/mls
 
 go 1.25.0
+
+require (
+	github.com/google/flatbuffers v25.2.10+incompatible
+	golang.org/x/crypto v0.50.0
+)
+
+require golang.org/x/sys v0.45.0 // indirect
@@ -0,0 +1,122 @@
+// Package group manages MLS group state layered on top of the TreeKEM tree
+package group
+
+import "fmt"
+
+// RejectionReason classifies why a join request was refused
+type RejectionReason string
+
+const (
+	ReasonPendingLimit RejectionReason = "pending_adds_per_epoch"
+	ReasonTenantQuota  RejectionReason = "tenant_member_quota"
+	ReasonDuplicate    RejectionReason = "duplicate_member"
+)
+
+// Rejection is the structured error returned for refused join requests
+type Rejection struct {
+	Reason  RejectionReason
+	Member  string
+	Tenant  string
+	Limit   int // configured limit that was hit
+	Current int // value at the time of the request
+}
+
+// Error implements error
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("join of %s rejected: %s (current %d, limit %d)", r.Member, r.Reason, r.Current, r.Limit)
+}
+
+// AdmissionPolicy bounds how fast a group may grow
+// Zero values disable the corresponding limit
+type AdmissionPolicy struct {
+	MaxPendingAddsPerEpoch int                     // adds that may queue before the next commit
+	MaxAddsPerCommit       int                     // adds bundled into a single commit
+	TenantQuota            func(tenant string) int // maximum members per tenant, 0 for unlimited
+}
+
+// JoinRequest asks for a member to be added to the group
+type JoinRequest struct {
+	Member    string
+	Tenant    string
+	PublicKey []byte
+}
+
+// Admission queues join requests and releases them in commit-sized batches
+type Admission struct {
+	policy  AdmissionPolicy
+	pending []JoinRequest
+	members map[string]int      // committed members per tenant
+	queued  map[string]struct{} // members waiting in pending
+}
+
+// NewAdmission creates an admission controller enforcing policy
+func NewAdmission(policy AdmissionPolicy) *Admission {
+	return &Admission{
+		policy:  policy,
+		members: make(map[string]int),
+		queued:  make(map[string]struct{}),
+	}
+}
+
+// Request queues a join request or returns a *Rejection
+func (a *Admission) Request(req JoinRequest) error {
+	if _, exists := a.queued[req.Member]; exists {
+		return &Rejection{Reason: ReasonDuplicate, Member: req.Member, Tenant: req.Tenant, Limit: 1, Current: 1}
+	}
+
+	if limit := a.policy.MaxPendingAddsPerEpoch; limit > 0 && len(a.pending) >= limit {
+		return &Rejection{Reason: ReasonPendingLimit, Member: req.Member, Tenant: req.Tenant, Limit: limit, Current: len(a.pending)}
+	}
+
+	if a.policy.TenantQuota != nil {
+		if limit := a.policy.TenantQuota(req.Tenant); limit > 0 {
+			current := a.members[req.Tenant] + a.pendingFor(req.Tenant)
+			if current >= limit {
+				return &Rejection{Reason: ReasonTenantQuota, Member: req.Member, Tenant: req.Tenant, Limit: limit, Current: current}
+			}
+		}
+	}
+
+	a.pending = append(a.pending, req)
+	a.queued[req.Member] = struct{}{}
+	return nil
+}
+
+// Pending returns the number of queued join requests
+func (a *Admission) Pending() int {
+	return len(a.pending)
+}
+
+// NextBatch removes and returns the adds for the next commit, honouring MaxAddsPerCommit
+func (a *Admission) NextBatch() []JoinRequest {
+	n := len(a.pending)
+	if limit := a.policy.MaxAddsPerCommit; limit > 0 && n > limit {
+		n = limit
+	}
+
+	batch := append([]JoinRequest(nil), a.pending[:n]...)
+	a.pending = a.pending[n:]
+	for _, req := range batch {
+		delete(a.queued, req.Member)
+		a.members[req.Tenant]++
+	}
+	return batch
+}
+
+// Removed releases the quota held by a member of tenant that left the group
+func (a *Admission) Removed(tenant string) {
+	if a.members[tenant] > 0 {
+		a.members[tenant]--
+	}
+}
+
+// pendingFor counts queued requests of a tenant
+func (a *Admission) pendingFor(tenant string) int {
+	count := 0
+	for _, req := range a.pending {
+		if req.Tenant == tenant {
+			count++
+		}
+	}
+	return count
+}
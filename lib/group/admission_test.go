@@ -0,0 +1,59 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAdmissionLimits(t *testing.T) {
+	admission := NewAdmission(AdmissionPolicy{
+		MaxPendingAddsPerEpoch: 5,
+		MaxAddsPerCommit:       2,
+		TenantQuota: func(tenant string) int {
+			if tenant == "small" {
+				return 2
+			}
+			return 0
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := admission.Request(JoinRequest{Member: fmt.Sprintf("user_%d", i), Tenant: "big"}); err != nil {
+			t.Fatalf("Failed to queue user_%d: %v", i, err)
+		}
+	}
+
+	var rejection *Rejection
+	err := admission.Request(JoinRequest{Member: "user_5", Tenant: "big"})
+	if !errors.As(err, &rejection) || rejection.Reason != ReasonPendingLimit {
+		t.Fatalf("expected pending limit rejection, got %v", err)
+	}
+
+	batch := admission.NextBatch()
+	if len(batch) != 2 {
+		t.Fatalf("expected commit of 2 adds, got %d", len(batch))
+	}
+	if admission.Pending() != 3 {
+		t.Errorf("expected 3 pending adds, got %d", admission.Pending())
+	}
+
+	admission.Request(JoinRequest{Member: "s1", Tenant: "small"})
+	admission.Request(JoinRequest{Member: "s1", Tenant: "small"})
+	admission.NextBatch()
+	admission.NextBatch()
+
+	if err := admission.Request(JoinRequest{Member: "s2", Tenant: "small"}); err != nil {
+		t.Fatalf("Failed to queue s2: %v", err)
+	}
+	err = admission.Request(JoinRequest{Member: "s3", Tenant: "small"})
+	if !errors.As(err, &rejection) || rejection.Reason != ReasonTenantQuota || rejection.Limit != 2 {
+		t.Fatalf("expected tenant quota rejection, got %v", err)
+	}
+
+	admission.NextBatch()
+	admission.Removed("small")
+	if err := admission.Request(JoinRequest{Member: "s3", Tenant: "small"}); err != nil {
+		t.Errorf("quota should be released after removal: %v", err)
+	}
+}
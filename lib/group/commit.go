@@ -0,0 +1,160 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ErrPathRequired is returned for commits that must carry an UpdatePath but do not
+var ErrPathRequired = errors.New("commit requires an update path")
+
+// Commit applies a set of proposals and optionally refreshes the committer's path
+type Commit struct {
+	Committer string // member sending the commit
+	Proposals []Proposal
+	Path      *tree.UpdatePath
+}
+
+// pathRequired reports whether RFC 9420 section 12.4 demands an UpdatePath
+// Commits made of nothing but Add, PreSharedKey and ReInit proposals may omit it
+func (c *Commit) pathRequired() bool {
+	for _, p := range c.Proposals {
+		switch p.Type() {
+		case ProposalAdd, ProposalPreSharedKey, ProposalReInit:
+		default:
+			return true
+		}
+	}
+	return len(c.Proposals) == 0
+}
+
+// ProcessCommit applies commit to t as one step into the next epoch and returns the delta
+// The proposal list must pass ValidateProposals. Proposals are applied in RFC 9420 order,
+// group context extensions, updates, removes and adds, followed by the UpdatePath.
+// Everything is validated on an in-memory copy of t first, configured with opts on top
+// of the tree's ciphersuite and group ID (pass the tree's authentication hook here), so
+// a commit that fails leaves t untouched. The resulting changes reach t through a single
+// ApplyPatch followed by AdvanceEpoch; replicas follow with the same two calls.
+// A ReInit commit retires t afterwards, see Reinitialize
+func ProcessCommit(t *tree.Tree, commit *Commit, opts ...tree.Option) (*tree.Patch, error) {
+	staged, err := stageCommit(t, commit, opts)
+	if err != nil {
+		return nil, err
+	}
+	return applyStaged(t, staged, commit, nil, nil)
+}
+
+// stageCommit validates commit and applies it to an in-memory copy of t
+func stageCommit(t *tree.Tree, commit *Commit, opts []tree.Option) (*tree.Tree, error) {
+	if _, ok := t.Find(commit.Committer); !ok {
+		return nil, fmt.Errorf("committer %s is not a member", commit.Committer)
+	}
+	if err := ValidateProposals(commit.Committer, commit.Proposals); err != nil {
+		return nil, err
+	}
+	if commit.Path == nil && commit.pathRequired() {
+		return nil, ErrPathRequired
+	}
+
+	var buf bytes.Buffer
+	if _, err := t.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("failed to stage commit: %w", err)
+	}
+	staged, err := tree.ReadFrom(&buf, nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage commit: %w", err)
+	}
+
+	for _, p := range orderProposals(commit.Proposals) {
+		if err := applyProposal(staged, commit.Committer, p); err != nil {
+			return nil, err
+		}
+	}
+	if commit.Path != nil {
+		if err := staged.ApplyUpdatePath(commit.Committer, commit.Path); err != nil {
+			return nil, fmt.Errorf("failed to apply update path: %w", err)
+		}
+	}
+	return staged, nil
+}
+
+// applyStaged moves t onto the staged result of commit, recording the transcript hashes
+// of the new epoch when given
+func applyStaged(t, staged *tree.Tree, commit *Commit, confirmed, interim []byte) (*tree.Patch, error) {
+	patch := t.Diff(staged)
+	if err := t.ApplyPatch(patch); err != nil {
+		return nil, fmt.Errorf("failed to apply commit: %w", err)
+	}
+	if err := t.AdvanceEpoch(); err != nil {
+		return nil, fmt.Errorf("failed to apply commit: %w", err)
+	}
+	for _, p := range commit.Proposals {
+		if gce, ok := p.(*GroupContextExtensions); ok {
+			if err := t.SetGroupExtensions(gce.Extensions); err != nil {
+				return nil, fmt.Errorf("failed to apply group context extensions: %w", err)
+			}
+		}
+	}
+	if confirmed != nil {
+		if err := t.SetTranscriptHashes(confirmed, interim); err != nil {
+			return nil, fmt.Errorf("failed to record transcript hashes: %w", err)
+		}
+	}
+	for _, p := range commit.Proposals {
+		if reinit, ok := p.(*ReInit); ok {
+			if err := t.Retire(reinit.GroupID); err != nil {
+				return nil, fmt.Errorf("failed to retire group: %w", err)
+			}
+		}
+	}
+	return patch, nil
+}
+
+// orderProposals returns proposals in the order RFC 9420 section 12.3 applies them
+func orderProposals(proposals []Proposal) []Proposal {
+	ordered := make([]Proposal, 0, len(proposals))
+	for _, kind := range []ProposalType{ProposalGroupContextExtensions, ProposalUpdate, ProposalRemove, ProposalAdd, ProposalPreSharedKey, ProposalReInit} {
+		for _, p := range proposals {
+			if p.Type() == kind {
+				ordered = append(ordered, p)
+			}
+		}
+	}
+	return ordered
+}
+
+// applyProposal applies one proposal of committer's commit to the staged tree
+func applyProposal(staged *tree.Tree, committer string, p Proposal) error {
+	switch p := p.(type) {
+	case *Add:
+		if err := staged.InsertFromKeyPackage(p.KeyPackage); err != nil {
+			return fmt.Errorf("add proposal: %w", err)
+		}
+	case *GroupContextExtensions:
+		if err := staged.SetGroupExtensions(p.Extensions); err != nil {
+			return fmt.Errorf("group context extensions proposal: %w", err)
+		}
+	case *PreSharedKey, *ReInit:
+		// These feed the key schedule and leave the tree alone
+	case *Update:
+		if p.Leaf == committer {
+			return fmt.Errorf("update proposal: committer %s must update through its path", committer)
+		}
+		if err := staged.UpdateLeafNode(p.Leaf, p.LeafNode); err != nil {
+			return fmt.Errorf("update proposal: %w", err)
+		}
+	case *Remove:
+		if p.Leaf == committer {
+			return fmt.Errorf("remove proposal: committer %s cannot remove itself", committer)
+		}
+		if err := staged.Blank(p.Leaf); err != nil {
+			return fmt.Errorf("remove proposal: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported proposal type %d", p.Type())
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package group
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+const testSuite = tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+
+// testMember is a client with a published KeyPackage
+type testMember struct {
+	signer     crypto.Signer
+	keyPackage *keypackage.KeyPackage
+}
+
+func newTestMember(t *testing.T, name string) *testMember {
+	t.Helper()
+	signer, err := keypackage.GenerateSignatureKey(testSuite)
+	if err != nil {
+		t.Fatalf("Failed to generate signature key: %v", err)
+	}
+	kp, _, err := keypackage.Generate(testSuite, []byte(name), signer)
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	return &testMember{signer: signer, keyPackage: kp}
+}
+
+// newTestGroup returns a group tree with a member per name
+func newTestGroup(t *testing.T, names ...string) (*tree.Tree, map[string]*testMember) {
+	t.Helper()
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(testSuite), tree.WithGroupID([]byte("group")))
+	members := make(map[string]*testMember)
+	for _, name := range names {
+		members[name] = newTestMember(t, name)
+		if err := group.InsertFromKeyPackage(members[name].keyPackage); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	return group, members
+}
+
+// testUpdate returns an Update proposal giving member a fresh leaf node
+func testUpdate(t *testing.T, group *tree.Tree, name string, member *testMember) *Update {
+	t.Helper()
+	fresh := newTestMember(t, name)
+	leaf := *fresh.keyPackage.Leaf()
+	leaf.SignatureKey = member.keyPackage.Leaf().SignatureKey
+	leaf.Source = tree.LeafNodeSourceUpdate
+	leaf.Lifetime = tree.Lifetime{}
+	element, _ := group.Find(name)
+	if err := leaf.Sign(member.signer, group.GroupID(), uint32(element.LeafIndex())); err != nil {
+		t.Fatalf("Failed to sign update: %v", err)
+	}
+	return &Update{Leaf: name, LeafNode: &leaf}
+}
+
+// testCommitPath plays the committer: it applies the proposals to its own copy of the
+// group and generates the UpdatePath against the result
+func testCommitPath(t *testing.T, group *tree.Tree, committer string, signer crypto.Signer, proposals []Proposal) *tree.UpdatePath {
+	t.Helper()
+	var buf bytes.Buffer
+	group.WriteTo(&buf)
+	view, err := tree.ReadFrom(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to copy group: %v", err)
+	}
+	for _, p := range orderProposals(proposals) {
+		if err := applyProposal(view, committer, p); err != nil {
+			t.Fatalf("Failed to apply proposal: %v", err)
+		}
+	}
+	path, _, err := treekem.GenerateUpdatePath(view, committer, signer, []byte("context"))
+	if err != nil {
+		t.Fatalf("Failed to generate update path: %v", err)
+	}
+	return path
+}
+
+func TestProcessCommit(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob", "charlie", "dave")
+	eve := newTestMember(t, "eve")
+	proposals := []Proposal{
+		&Add{KeyPackage: eve.keyPackage},
+		&Remove{Leaf: "bob"},
+		testUpdate(t, group, "charlie", members["charlie"]),
+	}
+	epoch, before := group.Epoch(), group.TreeHash()
+
+	rejects := map[string]*Commit{
+		"stranger":         {Committer: "mallory", Proposals: proposals},
+		"missing path":     {Committer: "alice", Proposals: proposals},
+		"self removal":     {Committer: "alice", Proposals: []Proposal{&Remove{Leaf: "alice"}}, Path: testCommitPath(t, group, "alice", members["alice"].signer, nil)},
+		"stale path":       {Committer: "alice", Proposals: proposals, Path: testCommitPath(t, group, "alice", members["alice"].signer, nil)},
+		"unknown removal":  {Committer: "alice", Proposals: []Proposal{&Remove{Leaf: "mallory"}}, Path: testCommitPath(t, group, "alice", members["alice"].signer, nil)},
+		"duplicate member": {Committer: "alice", Proposals: []Proposal{&Add{KeyPackage: members["bob"].keyPackage}}},
+	}
+	for name, commit := range rejects {
+		if _, err := ProcessCommit(group, commit); err == nil {
+			t.Errorf("%s: commit should be rejected", name)
+		}
+		if group.Epoch() != epoch || !bytes.Equal(group.TreeHash(), before) {
+			t.Fatalf("%s: rejected commit should leave the group untouched", name)
+		}
+	}
+	if _, err := ProcessCommit(group, &Commit{Committer: "alice", Proposals: []Proposal{&Remove{Leaf: "bob"}}}); !errors.Is(err, ErrPathRequired) {
+		t.Errorf("removes without a path should fail with ErrPathRequired, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	group.WriteTo(&buf)
+	replica, err := tree.ReadFrom(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to copy group: %v", err)
+	}
+
+	commit := &Commit{Committer: "alice", Proposals: proposals, Path: testCommitPath(t, group, "alice", members["alice"].signer, proposals)}
+	patch, err := ProcessCommit(group, commit)
+	if err != nil {
+		t.Fatalf("Failed to process commit: %v", err)
+	}
+	if group.Epoch() != epoch+1 {
+		t.Errorf("commit should advance the epoch once, got %d from %d", group.Epoch(), epoch)
+	}
+	if _, ok := group.Find("bob"); ok {
+		t.Errorf("bob should be removed")
+	}
+	if _, ok := group.Find("eve"); !ok {
+		t.Errorf("eve should be added")
+	}
+	charlie, _ := group.Find("charlie")
+	if !bytes.Equal(charlie.Value(), commit.Proposals[2].(*Update).LeafNode.EncryptionKey) {
+		t.Errorf("charlie should hold the updated leaf key")
+	}
+	if err := group.ValidateParentHashes(); err != nil {
+		t.Errorf("committed group should validate: %v", err)
+	}
+
+	// A replica that follows with the emitted patch reaches the same tree
+	if err := replica.ApplyPatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch to replica: %v", err)
+	}
+	if err := replica.AdvanceEpoch(); err != nil {
+		t.Fatalf("Failed to advance replica epoch: %v", err)
+	}
+	if !bytes.Equal(replica.TreeHash(), group.TreeHash()) || replica.Epoch() != group.Epoch() {
+		t.Errorf("replica should reach the committed tree and epoch")
+	}
+
+	// Commits of only adds may skip the path
+	frank := newTestMember(t, "frank")
+	if _, err := ProcessCommit(group, &Commit{Committer: "alice", Proposals: []Proposal{&Add{KeyPackage: frank.keyPackage}}}); err != nil {
+		t.Fatalf("add-only commit without a path should succeed: %v", err)
+	}
+	if group.Epoch() != epoch+2 {
+		t.Errorf("second commit should advance the epoch again")
+	}
+}
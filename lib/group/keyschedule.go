@@ -0,0 +1,93 @@
+package group
+
+import (
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// EpochSecrets are the secrets of one epoch (RFC 9420 section 8)
+type EpochSecrets struct {
+	JoinerSecret       []byte
+	WelcomeSecret      []byte
+	EpochSecret        []byte
+	SenderDataSecret   []byte
+	EncryptionSecret   []byte // seeds the SecretTree
+	ExporterSecret     []byte
+	ExternalSecret     []byte
+	ConfirmationKey    []byte
+	MembershipKey      []byte
+	ResumptionPSK      []byte
+	EpochAuthenticator []byte
+	InitSecret         []byte // init secret of the next epoch
+}
+
+// DeriveEpochSecrets runs the key schedule into the epoch described by groupContext
+// initSecret is the previous epoch's init secret, commitSecret comes from the commit's
+// UpdatePath (all zeros without one) and pskSecret from PSKSecret (nil without PSKs)
+func DeriveEpochSecrets(suite *treekem.Suite, initSecret, commitSecret, pskSecret []byte, groupContext tree.GroupContext) (*EpochSecrets, error) {
+	context, err := groupContext.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	zero := make([]byte, suite.HashSize())
+	if commitSecret == nil {
+		commitSecret = zero
+	}
+	joiner, err := suite.ExpandWithLabel(suite.Extract(initSecret, commitSecret), "joiner", context, suite.HashSize())
+	if err != nil {
+		return nil, err
+	}
+	return DeriveEpochSecretsFromJoiner(suite, joiner, pskSecret, groupContext)
+}
+
+// DeriveEpochSecretsFromJoiner runs the key schedule from the joiner secret, as new members
+// do after opening a Welcome
+func DeriveEpochSecretsFromJoiner(suite *treekem.Suite, joinerSecret, pskSecret []byte, groupContext tree.GroupContext) (*EpochSecrets, error) {
+	context, err := groupContext.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if pskSecret == nil {
+		pskSecret = make([]byte, suite.HashSize())
+	}
+	member := suite.Extract(joinerSecret, pskSecret)
+	s := &EpochSecrets{JoinerSecret: joinerSecret}
+	if s.WelcomeSecret, err = suite.DeriveSecret(member, "welcome"); err != nil {
+		return nil, err
+	}
+	if s.EpochSecret, err = suite.ExpandWithLabel(member, "epoch", context, suite.HashSize()); err != nil {
+		return nil, err
+	}
+	for _, derived := range []struct {
+		label string
+		out   *[]byte
+	}{
+		{"sender data", &s.SenderDataSecret},
+		{"encryption", &s.EncryptionSecret},
+		{"exporter", &s.ExporterSecret},
+		{"external", &s.ExternalSecret},
+		{"confirm", &s.ConfirmationKey},
+		{"membership", &s.MembershipKey},
+		{"resumption", &s.ResumptionPSK},
+		{"authentication", &s.EpochAuthenticator},
+		{"init", &s.InitSecret},
+	} {
+		if *derived.out, err = suite.DeriveSecret(s.EpochSecret, derived.label); err != nil {
+			return nil, fmt.Errorf("failed to derive %s secret: %w", derived.label, err)
+		}
+	}
+	return s, nil
+}
+
+// ExportSecret is the MLS-Exporter of the epoch (RFC 9420 section 8.5), deriving
+// length bytes for an out-of-band use such as SFrame media keys. Distinct labels give
+// independent secrets, and every member of the epoch derives the same ones
+func (s *EpochSecrets) ExportSecret(suite *treekem.Suite, label string, context []byte, length int) ([]byte, error) {
+	derived, err := suite.DeriveSecret(s.ExporterSecret, label)
+	if err != nil {
+		return nil, err
+	}
+	return suite.ExpandWithLabel(derived, "exported", suite.Hash(context), length)
+}
@@ -0,0 +1,39 @@
+package group
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+func TestExportSecret(t *testing.T) {
+	suite, _ := treekem.NewSuite(testSuite)
+	context := tree.GroupContext{Version: tree.ProtocolVersionMLS10, CipherSuite: testSuite, GroupID: []byte("group"), Epoch: 1}
+	secrets, err := DeriveEpochSecrets(suite, bytes.Repeat([]byte{1}, 32), nil, nil, context)
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+	joined, _ := DeriveEpochSecretsFromJoiner(suite, secrets.JoinerSecret, nil, context)
+
+	key, err := secrets.ExportSecret(suite, "SFrame 1.0", []byte("media"), 16)
+	if err != nil || len(key) != 16 {
+		t.Fatalf("Failed to export secret: %v", err)
+	}
+	if same, _ := joined.ExportSecret(suite, "SFrame 1.0", []byte("media"), 16); !bytes.Equal(same, key) {
+		t.Errorf("members of the epoch should export the same secret")
+	}
+	if other, _ := secrets.ExportSecret(suite, "other", []byte("media"), 16); bytes.Equal(other, key) {
+		t.Errorf("labels should separate exported secrets")
+	}
+	if other, _ := secrets.ExportSecret(suite, "SFrame 1.0", []byte("screen"), 16); bytes.Equal(other, key) {
+		t.Errorf("contexts should separate exported secrets")
+	}
+
+	context.Epoch = 2
+	next, _ := DeriveEpochSecrets(suite, secrets.InitSecret, nil, nil, context)
+	if other, _ := next.ExportSecret(suite, "SFrame 1.0", []byte("media"), 16); bytes.Equal(other, key) {
+		t.Errorf("each epoch should export fresh secrets")
+	}
+}
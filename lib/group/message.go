@@ -0,0 +1,203 @@
+package group
+
+import (
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ContentType is the kind of content a message carries (RFC 9420 section 6)
+type ContentType uint8
+
+const (
+	ContentApplication ContentType = 1
+	ContentProposal    ContentType = 2
+	ContentCommit      ContentType = 3
+)
+
+// WireFormat says how a message is protected on the wire
+type WireFormat uint16
+
+const (
+	WireFormatPublicMessage  WireFormat = 1
+	WireFormatPrivateMessage WireFormat = 2
+)
+
+// senderMember is the sender type of messages sent by members of the group
+const senderMember uint8 = 1
+
+// FramedContent is the content of one message and who sent it
+type FramedContent struct {
+	GroupID           []byte
+	Epoch             uint64
+	Sender            uint32 // leaf index of the sending member
+	AuthenticatedData []byte
+	ContentType       ContentType
+	Content           []byte // application data, or the encoded proposal or commit
+}
+
+// encode writes the FramedContent in its RFC 9420 wire format
+func (fc *FramedContent) encode(w *tls.Writer) error {
+	if err := w.Opaque(fc.GroupID); err != nil {
+		return err
+	}
+	w.Uint64(fc.Epoch)
+	w.Uint8(senderMember)
+	w.Uint32(fc.Sender)
+	if err := w.Opaque(fc.AuthenticatedData); err != nil {
+		return err
+	}
+	w.Uint8(uint8(fc.ContentType))
+	if fc.ContentType == ContentApplication {
+		return w.Opaque(fc.Content)
+	}
+	w.Buf = append(w.Buf, fc.Content...)
+	return nil
+}
+
+// decode reads a FramedContent written by encode
+// Proposals and commits are kept encoded, Proposal and Commit resolve them against the tree
+func (fc *FramedContent) decode(r *tls.Reader) error {
+	var err error
+	if fc.GroupID, err = r.Opaque(); err != nil {
+		return err
+	}
+	if fc.Epoch, err = r.Uint64(); err != nil {
+		return err
+	}
+	senderType, err := r.Uint8()
+	if err != nil {
+		return err
+	}
+	if senderType != senderMember {
+		return fmt.Errorf("unsupported sender type %d", senderType)
+	}
+	if fc.Sender, err = r.Uint32(); err != nil {
+		return err
+	}
+	if fc.AuthenticatedData, err = r.Opaque(); err != nil {
+		return err
+	}
+	contentType, err := r.Uint8()
+	if err != nil {
+		return err
+	}
+	fc.ContentType = ContentType(contentType)
+	start := r.Buf
+	switch fc.ContentType {
+	case ContentApplication:
+		fc.Content, err = r.Opaque()
+		return err
+	case ContentProposal:
+		_, err = decodeProposal(r, "", nil)
+	case ContentCommit:
+		_, err = decodeCommit(r, "", nil)
+	default:
+		return fmt.Errorf("unsupported content type %d", contentType)
+	}
+	if err != nil {
+		return err
+	}
+	fc.Content = append([]byte(nil), start[:len(start)-len(r.Buf)]...)
+	return nil
+}
+
+// FrameProposal frames p as the content of a message from sender, a positional leaf index
+func FrameProposal(t *tree.Tree, sender uint32, p Proposal, authenticatedData []byte) (*FramedContent, error) {
+	w := &tls.Writer{}
+	if err := encodeProposal(w, t, p); err != nil {
+		return nil, fmt.Errorf("failed to encode proposal: %w", err)
+	}
+	return frame(t, sender, ContentProposal, w.Buf, authenticatedData), nil
+}
+
+// FrameCommit frames c as the content of a message from its committer
+func FrameCommit(t *tree.Tree, c *Commit, authenticatedData []byte) (*FramedContent, error) {
+	sender, err := leafIndexOf(t, c.Committer)
+	if err != nil {
+		return nil, err
+	}
+	w := &tls.Writer{}
+	if err := c.encode(w, t); err != nil {
+		return nil, fmt.Errorf("failed to encode commit: %w", err)
+	}
+	return frame(t, sender, ContentCommit, w.Buf, authenticatedData), nil
+}
+
+func frame(t *tree.Tree, sender uint32, contentType ContentType, content, authenticatedData []byte) *FramedContent {
+	context := t.GroupContext()
+	return &FramedContent{
+		GroupID:           context.GroupID,
+		Epoch:             context.Epoch,
+		Sender:            sender,
+		AuthenticatedData: authenticatedData,
+		ContentType:       contentType,
+		Content:           content,
+	}
+}
+
+// Proposal decodes the proposal the content carries, resolving members against t
+func (fc *FramedContent) Proposal(t *tree.Tree) (Proposal, error) {
+	if fc.ContentType != ContentProposal {
+		return nil, fmt.Errorf("content type %d is not a proposal", fc.ContentType)
+	}
+	sender, err := leafNameAt(t, fc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	r := &tls.Reader{Buf: fc.Content}
+	p, err := decodeProposal(r, sender, func(index uint32) (string, error) { return leafNameAt(t, index) })
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode proposal: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after proposal", len(r.Buf))
+	}
+	return p, nil
+}
+
+// Commit decodes the commit the content carries, resolving members against t
+func (fc *FramedContent) Commit(t *tree.Tree) (*Commit, error) {
+	if fc.ContentType != ContentCommit {
+		return nil, fmt.Errorf("content type %d is not a commit", fc.ContentType)
+	}
+	committer, err := leafNameAt(t, fc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	r := &tls.Reader{Buf: fc.Content}
+	c, err := decodeCommit(r, committer, func(index uint32) (string, error) { return leafNameAt(t, index) })
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode commit: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after commit", len(r.Buf))
+	}
+	return c, nil
+}
+
+// signatureContent builds the FramedContentTBS a member's signature covers
+func (fc *FramedContent) signatureContent(wireFormat WireFormat, context tree.GroupContext) ([]byte, error) {
+	w := &tls.Writer{}
+	w.Uint16(tree.ProtocolVersionMLS10)
+	w.Uint16(uint16(wireFormat))
+	if err := fc.encode(w); err != nil {
+		return nil, err
+	}
+	encoded, err := context.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	w.Buf = append(w.Buf, encoded...)
+	return w.Buf, nil
+}
+
+// senderKey returns the signature key of the member at leaf, a positional leaf index
+func senderKey(t *tree.Tree, leaf uint32) ([]byte, error) {
+	leaves := t.GetLeaves()
+	if int(leaf) >= len(leaves) || leaves[leaf].LeafNode() == nil {
+		return nil, fmt.Errorf("no member at leaf %d", leaf)
+	}
+	return leaves[leaf].LeafNode().SignatureKey, nil
+}
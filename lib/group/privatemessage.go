@@ -0,0 +1,359 @@
+package group
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// reuseGuardSize is the length of the random value mixed into each content nonce
+const reuseGuardSize = 4
+
+// ErrWrongEpoch is returned for messages of another group or epoch
+var ErrWrongEpoch = errors.New("message is not for this group epoch")
+
+// PrivateMessage is a signed message encrypted under the sender's secret tree keys
+// (RFC 9420 section 6.3). The sender and generation travel in EncryptedSenderData
+type PrivateMessage struct {
+	GroupID             []byte
+	Epoch               uint64
+	ContentType         ContentType
+	AuthenticatedData   []byte
+	EncryptedSenderData []byte
+	Ciphertext          []byte
+}
+
+// Protector encrypts and decrypts the PrivateMessages of one epoch
+// It owns the epoch's SecretTree, so a group keeps a single Protector per epoch
+type Protector struct {
+	suite            *treekem.Suite
+	tree             *tree.Tree
+	context          tree.GroupContext
+	senderDataSecret []byte
+	secrets          *SecretTree
+	padding          int
+}
+
+// NewProtector creates the Protector of the epoch t is in, keyed by its epoch secrets
+func NewProtector(t *tree.Tree, secrets *EpochSecrets) (*Protector, error) {
+	context := t.GroupContext()
+	suite, err := treekem.NewSuite(context.CipherSuite)
+	if err != nil {
+		return nil, err
+	}
+	st, err := NewSecretTree(suite, secrets.EncryptionSecret, len(t.GetLeaves()))
+	if err != nil {
+		return nil, err
+	}
+	return &Protector{suite: suite, tree: t, context: context, senderDataSecret: secrets.SenderDataSecret, secrets: st}, nil
+}
+
+// SetPadding pads message content to a multiple of block bytes, hiding its exact length
+func (p *Protector) SetPadding(block int) {
+	p.padding = block
+}
+
+// SecretTree returns the secret tree the Protector draws message keys from
+func (p *Protector) SecretTree() *SecretTree {
+	return p.secrets
+}
+
+// Encrypt signs data as an application message of sender, a positional leaf index, and
+// encrypts it with the next key of the sender's application ratchet
+func (p *Protector) Encrypt(sender uint32, signer crypto.Signer, authenticatedData, data []byte) (*PrivateMessage, error) {
+	content := &FramedContent{
+		GroupID:           p.context.GroupID,
+		Epoch:             p.context.Epoch,
+		Sender:            sender,
+		AuthenticatedData: authenticatedData,
+		ContentType:       ContentApplication,
+		Content:           data,
+	}
+	tbs, err := content.signatureContent(WireFormatPrivateMessage, p.context)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := tree.SignWithLabel(signer, "FramedContentTBS", tbs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	plaintext := &tls.Writer{}
+	if err := plaintext.Opaque(data); err != nil {
+		return nil, err
+	}
+	if err := plaintext.Opaque(signature); err != nil {
+		return nil, err
+	}
+	if p.padding > 0 && len(plaintext.Buf)%p.padding != 0 {
+		plaintext.Buf = append(plaintext.Buf, make([]byte, p.padding-len(plaintext.Buf)%p.padding)...)
+	}
+
+	key, err := p.nextKey(sender)
+	if err != nil {
+		return nil, err
+	}
+	guard := make([]byte, reuseGuardSize)
+	if _, err := rand.Read(guard); err != nil {
+		return nil, fmt.Errorf("failed to generate reuse guard: %w", err)
+	}
+	m := &PrivateMessage{GroupID: content.GroupID, Epoch: content.Epoch, ContentType: ContentApplication, AuthenticatedData: authenticatedData}
+	aad, err := m.contentAAD()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := p.suite.NewAEAD(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	m.Ciphertext = aead.Seal(nil, guardNonce(key.Nonce, guard), plaintext.Buf, aad)
+
+	senderData := &tls.Writer{}
+	senderData.Uint32(sender)
+	senderData.Uint32(key.Generation)
+	senderData.Buf = append(senderData.Buf, guard...)
+	senderAEAD, senderNonce, err := p.senderDataAEAD(m.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aad, err = m.senderDataAAD()
+	if err != nil {
+		return nil, err
+	}
+	m.EncryptedSenderData = senderAEAD.Seal(nil, senderNonce, senderData.Buf, aad)
+	return m, nil
+}
+
+// Decrypt opens an application message of the epoch and verifies its signature against
+// the sender's leaf. Each message can be decrypted once: its key is deleted afterwards
+// and its generation recorded with the tree, which refuses replays with tree.ErrReplay
+// and messages behind the replay window with tree.ErrTooOld
+func (p *Protector) Decrypt(m *PrivateMessage) (*FramedContent, uint32, error) {
+	if !bytes.Equal(m.GroupID, p.context.GroupID) || m.Epoch != p.context.Epoch {
+		return nil, 0, fmt.Errorf("%w: group %x epoch %d", ErrWrongEpoch, m.GroupID, m.Epoch)
+	}
+	if m.ContentType != ContentApplication {
+		return nil, 0, fmt.Errorf("unsupported private content type %d", m.ContentType)
+	}
+
+	senderAEAD, senderNonce, err := p.senderDataAEAD(m.Ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+	aad, err := m.senderDataAAD()
+	if err != nil {
+		return nil, 0, err
+	}
+	senderData, err := senderAEAD.Open(nil, senderNonce, m.EncryptedSenderData, aad)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decrypt sender data: %w", err)
+	}
+	r := &tls.Reader{Buf: senderData}
+	sender, _ := r.Uint32()
+	generation, _ := r.Uint32()
+	guard, err := r.Take(reuseGuardSize)
+	if err != nil || len(r.Buf) != 0 {
+		return nil, 0, fmt.Errorf("malformed sender data")
+	}
+	signatureKey, err := senderKey(p.tree, sender)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := p.tree.CheckGeneration(sender, uint8(RatchetApplication), generation); err != nil {
+		return nil, 0, fmt.Errorf("message from leaf %d: %w", sender, err)
+	}
+
+	key, err := p.secrets.Key(sender, RatchetApplication, generation)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := p.suite.NewAEAD(key.Key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if aad, err = m.contentAAD(); err != nil {
+		return nil, 0, err
+	}
+	plaintext, err := aead.Open(nil, guardNonce(key.Nonce, guard), m.Ciphertext, aad)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+
+	r = &tls.Reader{Buf: plaintext}
+	data, err := r.Opaque()
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed message content: %w", err)
+	}
+	signature, err := r.Opaque()
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed message content: %w", err)
+	}
+	if len(bytes.Trim(r.Buf, "\x00")) != 0 {
+		return nil, 0, fmt.Errorf("message padding is not zero")
+	}
+
+	content := &FramedContent{
+		GroupID:           m.GroupID,
+		Epoch:             m.Epoch,
+		Sender:            sender,
+		AuthenticatedData: m.AuthenticatedData,
+		ContentType:       m.ContentType,
+		Content:           data,
+	}
+	tbs, err := content.signatureContent(WireFormatPrivateMessage, p.context)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := tree.VerifyWithLabel(p.context.CipherSuite, signatureKey, "FramedContentTBS", tbs, signature); err != nil {
+		return nil, 0, fmt.Errorf("message from leaf %d: %w", sender, err)
+	}
+	if err := p.tree.RecordGeneration(sender, uint8(RatchetApplication), generation); err != nil {
+		return nil, 0, err
+	}
+	return content, generation, nil
+}
+
+// nextKey returns the key of the sender's next application message and records its
+// generation with the tree, so a restarted sender never reuses a generation
+func (p *Protector) nextKey(sender uint32) (MessageKey, error) {
+	current, err := p.secrets.Generation(sender, RatchetApplication)
+	if err != nil {
+		return MessageKey{}, err
+	}
+	var key MessageKey
+	if next := p.tree.NextGeneration(sender, uint8(RatchetApplication)); next > current {
+		key, err = p.secrets.Key(sender, RatchetApplication, next)
+	} else {
+		key, err = p.secrets.Next(sender, RatchetApplication)
+	}
+	if err != nil {
+		return MessageKey{}, err
+	}
+	if err := p.tree.RecordGeneration(sender, uint8(RatchetApplication), key.Generation); err != nil {
+		return MessageKey{}, err
+	}
+	return key, nil
+}
+
+// senderDataAEAD derives the key and nonce of the sender data from a ciphertext sample
+func (p *Protector) senderDataAEAD(ciphertext []byte) (cipher.AEAD, []byte, error) {
+	sample := ciphertext[:min(len(ciphertext), p.suite.HashSize())]
+	key, err := p.suite.ExpandWithLabel(p.senderDataSecret, "key", sample, p.suite.AEADKeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := p.suite.ExpandWithLabel(p.senderDataSecret, "nonce", sample, p.suite.AEADNonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := p.suite.NewAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nonce, nil
+}
+
+// senderDataAAD builds the SenderDataAAD of the message
+func (m *PrivateMessage) senderDataAAD() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := w.Opaque(m.GroupID); err != nil {
+		return nil, err
+	}
+	w.Uint64(m.Epoch)
+	w.Uint8(uint8(m.ContentType))
+	return w.Buf, nil
+}
+
+// contentAAD builds the PrivateContentAAD of the message
+func (m *PrivateMessage) contentAAD() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := w.Opaque(m.GroupID); err != nil {
+		return nil, err
+	}
+	w.Uint64(m.Epoch)
+	w.Uint8(uint8(m.ContentType))
+	if err := w.Opaque(m.AuthenticatedData); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// guardNonce XORs the reuse guard into the first bytes of nonce
+func guardNonce(nonce, guard []byte) []byte {
+	out := bytes.Clone(nonce)
+	for i, b := range guard {
+		out[i] ^= b
+	}
+	return out
+}
+
+// Marshal encodes the PrivateMessage in its RFC 9420 wire format
+func (m *PrivateMessage) Marshal() ([]byte, error) {
+	w := &tls.Writer{}
+	w.Uint16(tree.ProtocolVersionMLS10)
+	w.Uint16(uint16(WireFormatPrivateMessage))
+	if err := w.Opaque(m.GroupID); err != nil {
+		return nil, err
+	}
+	w.Uint64(m.Epoch)
+	w.Uint8(uint8(m.ContentType))
+	for _, field := range [][]byte{m.AuthenticatedData, m.EncryptedSenderData, m.Ciphertext} {
+		if err := w.Opaque(field); err != nil {
+			return nil, fmt.Errorf("failed to encode private message: %w", err)
+		}
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalPrivateMessage decodes a PrivateMessage written by Marshal
+func UnmarshalPrivateMessage(data []byte) (*PrivateMessage, error) {
+	r := &tls.Reader{Buf: data}
+	m := &PrivateMessage{}
+	err := func() error {
+		version, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if version != tree.ProtocolVersionMLS10 {
+			return fmt.Errorf("unsupported protocol version %d", version)
+		}
+		format, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if WireFormat(format) != WireFormatPrivateMessage {
+			return fmt.Errorf("wire format %d is not a private message", format)
+		}
+		if m.GroupID, err = r.Opaque(); err != nil {
+			return err
+		}
+		if m.Epoch, err = r.Uint64(); err != nil {
+			return err
+		}
+		contentType, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		m.ContentType = ContentType(contentType)
+		for _, field := range []*[]byte{&m.AuthenticatedData, &m.EncryptedSenderData, &m.Ciphertext} {
+			if *field, err = r.Opaque(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private message: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after private message", len(r.Buf))
+	}
+	return m, nil
+}
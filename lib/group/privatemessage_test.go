@@ -0,0 +1,134 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// testProtectors returns a Protector for n members of group, each on its own replica
+// of the tree and all in the same epoch
+func testProtectors(t *testing.T, group *tree.Tree, n int) []*Protector {
+	t.Helper()
+	suite, _ := treekem.NewSuite(testSuite)
+	secrets, err := DeriveEpochSecrets(suite, bytes.Repeat([]byte{1}, 32), nil, nil, group.GroupContext())
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+	protectors := make([]*Protector, n)
+	for i := range protectors {
+		if protectors[i], err = NewProtector(testReplica(t, group, nil), secrets); err != nil {
+			t.Fatalf("Failed to create protector: %v", err)
+		}
+	}
+	return protectors
+}
+
+// testReplica copies group into store
+func testReplica(t *testing.T, group *tree.Tree, store tree.Store) *tree.Tree {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := group.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to export group: %v", err)
+	}
+	replica, err := tree.ReadFrom(&buf, store)
+	if err != nil {
+		t.Fatalf("Failed to copy group: %v", err)
+	}
+	return replica
+}
+
+func TestPrivateMessage(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob", "charlie")
+	protectors := testProtectors(t, group, 2)
+	alice, bob := protectors[0], protectors[1]
+	alice.SetPadding(64)
+	sender, _ := leafIndexOf(group, "alice")
+
+	var sent []*PrivateMessage
+	for _, text := range []string{"hello", "again", "third"} {
+		m, err := alice.Encrypt(sender, members["alice"].signer, []byte("aad"), []byte(text))
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		encoded, err := m.Marshal()
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		if m, err = UnmarshalPrivateMessage(encoded); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if len(m.Ciphertext)%64 != 16 {
+			t.Errorf("content should be padded to 64 bytes, ciphertext has %d", len(m.Ciphertext))
+		}
+		sent = append(sent, m)
+	}
+
+	// Messages may arrive out of order, but only once
+	for _, i := range []int{2, 0, 1} {
+		content, generation, err := bob.Decrypt(sent[i])
+		if err != nil {
+			t.Fatalf("Failed to decrypt message %d: %v", i, err)
+		}
+		if content.Sender != sender || generation != uint32(i) || !bytes.Equal(content.AuthenticatedData, []byte("aad")) {
+			t.Errorf("message %d: sender %d generation %d", i, content.Sender, generation)
+		}
+	}
+	if _, _, err := alice.Decrypt(sent[0]); !errors.Is(err, tree.ErrReplay) {
+		t.Errorf("a sender should not take its own messages, got %v", err)
+	}
+	if _, _, err := bob.Decrypt(sent[1]); !errors.Is(err, tree.ErrReplay) {
+		t.Errorf("a replayed message should fail with ErrReplay, got %v", err)
+	}
+
+	forged, _ := alice.Encrypt(sender, members["bob"].signer, nil, []byte("forged"))
+	if _, _, err := bob.Decrypt(forged); !errors.Is(err, tree.ErrInvalidSignature) {
+		t.Errorf("a message signed by another member should fail, got %v", err)
+	}
+	tampered, _ := alice.Encrypt(sender, members["alice"].signer, []byte("aad"), []byte("tampered"))
+	tampered.AuthenticatedData = []byte("other")
+	if _, _, err := bob.Decrypt(tampered); err == nil {
+		t.Errorf("authenticated data should be bound to the ciphertext")
+	}
+	stale, _ := alice.Encrypt(sender, members["alice"].signer, nil, []byte("stale"))
+	stale.Epoch--
+	if _, _, err := bob.Decrypt(stale); !errors.Is(err, ErrWrongEpoch) {
+		t.Errorf("messages of other epochs should fail with ErrWrongEpoch, got %v", err)
+	}
+}
+
+func TestPrivateMessageGenerations(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob")
+	sender, _ := leafIndexOf(group, "alice")
+	suite, _ := treekem.NewSuite(testSuite)
+	secrets, _ := DeriveEpochSecrets(suite, bytes.Repeat([]byte{1}, 32), nil, nil, group.GroupContext())
+	files, _ := tree.NewFileStore(t.TempDir())
+	replica := testReplica(t, group, files)
+	alice, _ := NewProtector(replica, secrets)
+	bob := testProtectors(t, group, 1)[0]
+
+	first, _ := alice.Encrypt(sender, members["alice"].signer, nil, []byte("first"))
+	// A restarted sender continues after the generations it recorded
+	restarted, _ := NewProtector(replica, secrets)
+	second, err := restarted.Encrypt(sender, members["alice"].signer, nil, []byte("second"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt after restart: %v", err)
+	}
+	if _, generation, err := bob.Decrypt(second); err != nil || generation != 1 {
+		t.Fatalf("restarted sender should use generation 1, got %d: %v", generation, err)
+	}
+
+	var last *PrivateMessage
+	for range tree.ReplayWindowSize {
+		last, _ = restarted.Encrypt(sender, members["alice"].signer, nil, []byte("more"))
+	}
+	if _, _, err := bob.Decrypt(last); err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if _, _, err := bob.Decrypt(first); !errors.Is(err, tree.ErrTooOld) {
+		t.Errorf("messages behind the replay window should fail with ErrTooOld, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package group
+
+import (
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ProposalType identifies a proposal (RFC 9420 section 12.1)
+type ProposalType uint16
+
+const (
+	ProposalAdd                    ProposalType = 1
+	ProposalUpdate                 ProposalType = 2
+	ProposalRemove                 ProposalType = 3
+	ProposalPreSharedKey           ProposalType = 4
+	ProposalReInit                 ProposalType = 5
+	ProposalGroupContextExtensions ProposalType = 7
+)
+
+// PSKType says where a pre-shared key comes from
+type PSKType uint8
+
+const (
+	PSKExternal   PSKType = 1
+	PSKResumption PSKType = 2
+)
+
+// ResumptionPSKUsage says why a resumption PSK is injected
+type ResumptionPSKUsage uint8
+
+const (
+	ResumptionApplication ResumptionPSKUsage = 1
+	ResumptionReInit      ResumptionPSKUsage = 2
+	ResumptionBranch      ResumptionPSKUsage = 3
+)
+
+// PreSharedKeyID names a pre-shared key (RFC 9420 section 8.4)
+// External PSKs are named by ID; resumption PSKs by the group and epoch they come from
+type PreSharedKeyID struct {
+	Type    PSKType
+	ID      []byte             // external only
+	Usage   ResumptionPSKUsage // resumption only
+	GroupID []byte             // resumption only
+	Epoch   uint64             // resumption only
+	Nonce   []byte
+}
+
+// Proposal is a change to the group that takes effect when a Commit covers it
+type Proposal interface {
+	Type() ProposalType
+}
+
+// Add proposes adding the member that published KeyPackage
+type Add struct {
+	KeyPackage *keypackage.KeyPackage
+}
+
+// Update proposes replacing the leaf node of the proposing member
+type Update struct {
+	Leaf     string // member sending the proposal
+	LeafNode *tree.LeafNode
+}
+
+// Remove proposes removing a member
+type Remove struct {
+	Leaf string
+}
+
+// PreSharedKey proposes injecting a pre-shared key into the next epoch's key schedule
+type PreSharedKey struct {
+	PSK PreSharedKeyID
+}
+
+// ReInit proposes closing the group and restarting it with new parameters
+type ReInit struct {
+	GroupID     []byte
+	Version     uint16
+	CipherSuite tree.Ciphersuite
+	Extensions  []tree.Extension
+}
+
+// GroupContextExtensions proposes replacing the group context extensions
+type GroupContextExtensions struct {
+	Extensions []tree.Extension
+}
+
+// Type implements Proposal
+func (*Add) Type() ProposalType { return ProposalAdd }
+
+// Type implements Proposal
+func (*Update) Type() ProposalType { return ProposalUpdate }
+
+// Type implements Proposal
+func (*Remove) Type() ProposalType { return ProposalRemove }
+
+// Type implements Proposal
+func (*PreSharedKey) Type() ProposalType { return ProposalPreSharedKey }
+
+// Type implements Proposal
+func (*ReInit) Type() ProposalType { return ProposalReInit }
+
+// Type implements Proposal
+func (*GroupContextExtensions) Type() ProposalType { return ProposalGroupContextExtensions }
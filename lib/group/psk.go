@@ -0,0 +1,125 @@
+package group
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// ErrUnknownPSK is returned when a PSKStore has no key for a PreSharedKeyID
+var ErrUnknownPSK = errors.New("unknown pre-shared key")
+
+// PSKStore looks up pre-shared keys referenced by PreSharedKey proposals
+type PSKStore interface {
+	LookupPSK(id PreSharedKeyID) ([]byte, error)
+}
+
+// MemoryPSKStore keeps external PSKs by ID and resumption PSKs by group and epoch
+type MemoryPSKStore struct {
+	mu         sync.RWMutex
+	external   map[string][]byte
+	resumption map[string][]byte
+}
+
+// NewMemoryPSKStore creates an empty PSK store
+func NewMemoryPSKStore() *MemoryPSKStore {
+	return &MemoryPSKStore{external: make(map[string][]byte), resumption: make(map[string][]byte)}
+}
+
+// AddExternal stores an external PSK under id
+func (s *MemoryPSKStore) AddExternal(id, psk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.external[string(id)] = append([]byte(nil), psk...)
+}
+
+// AddResumption stores the resumption PSK of a group's epoch, see EpochSecrets.ResumptionPSK
+func (s *MemoryPSKStore) AddResumption(groupID []byte, epoch uint64, psk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumption[resumptionKey(groupID, epoch)] = append([]byte(nil), psk...)
+}
+
+// LookupPSK implements PSKStore
+func (s *MemoryPSKStore) LookupPSK(id PreSharedKeyID) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var psk []byte
+	var ok bool
+	switch id.Type {
+	case PSKExternal:
+		psk, ok = s.external[string(id.ID)]
+	case PSKResumption:
+		psk, ok = s.resumption[resumptionKey(id.GroupID, id.Epoch)]
+	default:
+		return nil, fmt.Errorf("unsupported PSK type %d", id.Type)
+	}
+	if !ok {
+		return nil, ErrUnknownPSK
+	}
+	return psk, nil
+}
+
+func resumptionKey(groupID []byte, epoch uint64) string {
+	return string(binary.BigEndian.AppendUint64(append([]byte(nil), groupID...), epoch))
+}
+
+// PreSharedKeys returns the PSKs the commit's PreSharedKey proposals inject, in order
+func (c *Commit) PreSharedKeys() []PreSharedKeyID {
+	var ids []PreSharedKeyID
+	for _, p := range c.Proposals {
+		if psk, ok := p.(*PreSharedKey); ok {
+			ids = append(ids, psk.PSK)
+		}
+	}
+	return ids
+}
+
+// PSKSecret combines the PSKs named by ids into the key schedule's psk_secret
+// (RFC 9420 section 8.4). Without PSKs it is all zeros
+func PSKSecret(suite *treekem.Suite, store PSKStore, ids []PreSharedKeyID) ([]byte, error) {
+	zero := make([]byte, suite.HashSize())
+	secret := zero
+	for i, id := range ids {
+		psk, err := store.LookupPSK(id)
+		if err != nil {
+			return nil, fmt.Errorf("pre-shared key %d: %w", i, err)
+		}
+		label := &tls.Writer{}
+		if err := id.encode(label); err != nil {
+			return nil, err
+		}
+		label.Uint16(uint16(i))
+		label.Uint16(uint16(len(ids)))
+		input, err := suite.ExpandWithLabel(suite.Extract(zero, psk), "derived psk", label.Buf, suite.HashSize())
+		if err != nil {
+			return nil, err
+		}
+		secret = suite.Extract(input, secret)
+	}
+	return secret, nil
+}
+
+// encode writes the PreSharedKeyID in its RFC 9420 wire format
+func (id *PreSharedKeyID) encode(w *tls.Writer) error {
+	w.Uint8(uint8(id.Type))
+	switch id.Type {
+	case PSKExternal:
+		if err := w.Opaque(id.ID); err != nil {
+			return err
+		}
+	case PSKResumption:
+		w.Uint8(uint8(id.Usage))
+		if err := w.Opaque(id.GroupID); err != nil {
+			return err
+		}
+		w.Uint64(id.Epoch)
+	default:
+		return fmt.Errorf("unsupported PSK type %d", id.Type)
+	}
+	return w.Opaque(id.Nonce)
+}
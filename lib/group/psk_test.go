@@ -0,0 +1,70 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+func TestPSKKeySchedule(t *testing.T) {
+	suite, _ := treekem.NewSuite(testSuite)
+	store := NewMemoryPSKStore()
+	store.AddExternal([]byte("ext"), []byte("external secret"))
+
+	none, err := PSKSecret(suite, store, nil)
+	if err != nil || !bytes.Equal(none, make([]byte, suite.HashSize())) {
+		t.Fatalf("psk_secret without PSKs should be all zeros: %x, %v", none, err)
+	}
+	external := PreSharedKeyID{Type: PSKExternal, ID: []byte("ext"), Nonce: bytes.Repeat([]byte{1}, 32)}
+	if _, err := PSKSecret(suite, store, []PreSharedKeyID{{Type: PSKExternal, ID: []byte("missing")}}); !errors.Is(err, ErrUnknownPSK) {
+		t.Errorf("unknown PSKs should fail with ErrUnknownPSK, got %v", err)
+	}
+
+	context := tree.GroupContext{Version: tree.ProtocolVersionMLS10, CipherSuite: testSuite, GroupID: []byte("group"), Epoch: 1}
+	initSecret := bytes.Repeat([]byte{2}, 32)
+	plain, err := DeriveEpochSecrets(suite, initSecret, nil, nil, context)
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+
+	// A resumption PSK of epoch 1 feeds the key schedule of a later epoch
+	store.AddResumption([]byte("group"), 1, plain.ResumptionPSK)
+	resumption := PreSharedKeyID{Type: PSKResumption, Usage: ResumptionApplication, GroupID: []byte("group"), Epoch: 1, Nonce: bytes.Repeat([]byte{3}, 32)}
+	commit := &Commit{Proposals: []Proposal{&Remove{Leaf: "bob"}, &PreSharedKey{PSK: external}, &PreSharedKey{PSK: resumption}}}
+	ids := commit.PreSharedKeys()
+	if len(ids) != 2 {
+		t.Fatalf("commit should inject 2 PSKs, got %d", len(ids))
+	}
+	pskSecret, err := PSKSecret(suite, store, ids)
+	if err != nil {
+		t.Fatalf("Failed to derive psk_secret: %v", err)
+	}
+	if reversed, _ := PSKSecret(suite, store, []PreSharedKeyID{resumption, external}); bytes.Equal(reversed, pskSecret) {
+		t.Errorf("psk_secret should depend on PSK order")
+	}
+
+	context.Epoch = 2
+	withPSK, err := DeriveEpochSecrets(suite, plain.InitSecret, nil, pskSecret, context)
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+	withoutPSK, _ := DeriveEpochSecrets(suite, plain.InitSecret, nil, nil, context)
+	if bytes.Equal(withPSK.EpochSecret, withoutPSK.EpochSecret) || !bytes.Equal(withPSK.JoinerSecret, withoutPSK.JoinerSecret) {
+		t.Errorf("PSKs should change the epoch secret but not the joiner secret")
+	}
+
+	// New members reach the same epoch from the joiner secret and the PSKs
+	joined, err := DeriveEpochSecretsFromJoiner(suite, withPSK.JoinerSecret, pskSecret, context)
+	if err != nil {
+		t.Fatalf("Failed to derive from joiner secret: %v", err)
+	}
+	if !bytes.Equal(joined.EncryptionSecret, withPSK.EncryptionSecret) || !bytes.Equal(joined.WelcomeSecret, withPSK.WelcomeSecret) {
+		t.Errorf("joiners should derive the members' epoch secrets")
+	}
+	if bytes.Equal(withPSK.EncryptionSecret, withPSK.ExporterSecret) {
+		t.Errorf("epoch secrets should be distinct")
+	}
+}
@@ -0,0 +1,171 @@
+package group
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// ErrInvalidMembershipTag is returned for PublicMessages whose membership tag does not
+// verify under the epoch's membership key
+var ErrInvalidMembershipTag = errors.New("invalid membership tag")
+
+// PublicMessage is a signed, unencrypted message, used for proposals and commits that a
+// server has to read (RFC 9420 section 6.2). The membership tag proves the sender knows
+// the epoch's secrets
+type PublicMessage struct {
+	Content         FramedContent
+	Signature       []byte
+	ConfirmationTag []byte // commits only
+	MembershipTag   []byte
+}
+
+// SignPublicMessage signs content as a member of the epoch t is in
+// The message is ready to send once SetMembershipTag has run; commits take their
+// confirmation tag from MergeCommit first
+func SignPublicMessage(t *tree.Tree, content *FramedContent, signer crypto.Signer) (*PublicMessage, error) {
+	tbs, err := content.signatureContent(WireFormatPublicMessage, t.GroupContext())
+	if err != nil {
+		return nil, err
+	}
+	m := &PublicMessage{Content: *content}
+	if m.Signature, err = tree.SignWithLabel(signer, "FramedContentTBS", tbs); err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return m, nil
+}
+
+// SetMembershipTag tags the message with the membership key of the epoch described by
+// context, the one the message was signed in
+func (m *PublicMessage) SetMembershipTag(context tree.GroupContext, membershipKey []byte) error {
+	if m.Content.ContentType == ContentCommit && len(m.ConfirmationTag) == 0 {
+		return errors.New("commit messages need a confirmation tag")
+	}
+	tbs, err := m.Content.signatureContent(WireFormatPublicMessage, context)
+	if err != nil {
+		return err
+	}
+	m.MembershipTag, err = m.membershipTag(context, tbs, membershipKey)
+	return err
+}
+
+// Verify checks the message belongs to the current epoch of t, that its membership tag
+// verifies under membershipKey and that the sender's leaf signed it
+func (m *PublicMessage) Verify(t *tree.Tree, membershipKey []byte) error {
+	context := t.GroupContext()
+	if !bytes.Equal(m.Content.GroupID, context.GroupID) || m.Content.Epoch != context.Epoch {
+		return fmt.Errorf("%w: group %x epoch %d", ErrWrongEpoch, m.Content.GroupID, m.Content.Epoch)
+	}
+	if m.Content.ContentType == ContentCommit && len(m.ConfirmationTag) == 0 {
+		return errors.New("commit message has no confirmation tag")
+	}
+	tbs, err := m.Content.signatureContent(WireFormatPublicMessage, context)
+	if err != nil {
+		return err
+	}
+	tag, err := m.membershipTag(context, tbs, membershipKey)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, m.MembershipTag) {
+		return ErrInvalidMembershipTag
+	}
+	signatureKey, err := senderKey(t, m.Content.Sender)
+	if err != nil {
+		return err
+	}
+	if err := tree.VerifyWithLabel(context.CipherSuite, signatureKey, "FramedContentTBS", tbs, m.Signature); err != nil {
+		return fmt.Errorf("message from leaf %d: %w", m.Content.Sender, err)
+	}
+	return nil
+}
+
+// membershipTag MACs AuthenticatedContentTBM, the signed content and its auth data
+func (m *PublicMessage) membershipTag(context tree.GroupContext, tbs, membershipKey []byte) ([]byte, error) {
+	suite, err := treekem.NewSuite(context.CipherSuite)
+	if err != nil {
+		return nil, err
+	}
+	w := &tls.Writer{Buf: bytes.Clone(tbs)}
+	if err := m.encodeAuth(w); err != nil {
+		return nil, err
+	}
+	return suite.MAC(membershipKey, w.Buf), nil
+}
+
+// encodeAuth writes FramedContentAuthData
+func (m *PublicMessage) encodeAuth(w *tls.Writer) error {
+	if err := w.Opaque(m.Signature); err != nil {
+		return err
+	}
+	if m.Content.ContentType == ContentCommit {
+		return w.Opaque(m.ConfirmationTag)
+	}
+	return nil
+}
+
+// Marshal encodes the PublicMessage in its RFC 9420 wire format
+func (m *PublicMessage) Marshal() ([]byte, error) {
+	w := &tls.Writer{}
+	w.Uint16(tree.ProtocolVersionMLS10)
+	w.Uint16(uint16(WireFormatPublicMessage))
+	if err := m.Content.encode(w); err != nil {
+		return nil, fmt.Errorf("failed to encode public message: %w", err)
+	}
+	if err := m.encodeAuth(w); err != nil {
+		return nil, fmt.Errorf("failed to encode public message: %w", err)
+	}
+	if err := w.Opaque(m.MembershipTag); err != nil {
+		return nil, fmt.Errorf("failed to encode public message: %w", err)
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalPublicMessage decodes a PublicMessage written by Marshal
+// Nothing is verified, call Verify before acting on the content
+func UnmarshalPublicMessage(data []byte) (*PublicMessage, error) {
+	r := &tls.Reader{Buf: data}
+	m := &PublicMessage{}
+	err := func() error {
+		version, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if version != tree.ProtocolVersionMLS10 {
+			return fmt.Errorf("unsupported protocol version %d", version)
+		}
+		format, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if WireFormat(format) != WireFormatPublicMessage {
+			return fmt.Errorf("wire format %d is not a public message", format)
+		}
+		if err := m.Content.decode(r); err != nil {
+			return err
+		}
+		if m.Signature, err = r.Opaque(); err != nil {
+			return err
+		}
+		if m.Content.ContentType == ContentCommit {
+			if m.ConfirmationTag, err = r.Opaque(); err != nil {
+				return err
+			}
+		}
+		m.MembershipTag, err = r.Opaque()
+		return err
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public message: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after public message", len(r.Buf))
+	}
+	return m, nil
+}
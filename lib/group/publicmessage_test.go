@@ -0,0 +1,137 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// testSign signs content and tags it with membershipKey
+func testSign(t *testing.T, group *tree.Tree, content *FramedContent, member *testMember, membershipKey []byte) *PublicMessage {
+	t.Helper()
+	m, err := SignPublicMessage(group, content, member.signer)
+	if err != nil {
+		t.Fatalf("Failed to sign message: %v", err)
+	}
+	if err := m.SetMembershipTag(group.GroupContext(), membershipKey); err != nil {
+		t.Fatalf("Failed to tag message: %v", err)
+	}
+	return m
+}
+
+// roundTrip sends m over the wire
+func roundTrip(t *testing.T, m *PublicMessage) *PublicMessage {
+	t.Helper()
+	encoded, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	decoded, err := UnmarshalPublicMessage(encoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	return decoded
+}
+
+func TestPublicMessageProposal(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob", "charlie")
+	membershipKey := bytes.Repeat([]byte{7}, 32)
+	bob, _ := leafIndexOf(group, "bob")
+
+	for _, p := range []Proposal{
+		&Remove{Leaf: "charlie"},
+		testUpdate(t, group, "bob", members["bob"]),
+		&PreSharedKey{PSK: PreSharedKeyID{Type: PSKResumption, Usage: ResumptionApplication, GroupID: []byte("group"), Epoch: 2, Nonce: []byte("nonce")}},
+		&GroupContextExtensions{Extensions: []tree.Extension{{Type: 0xff00, Data: []byte("room")}}},
+	} {
+		content, err := FrameProposal(group, bob, p, []byte("aad"))
+		if err != nil {
+			t.Fatalf("Failed to frame proposal %d: %v", p.Type(), err)
+		}
+		m := roundTrip(t, testSign(t, group, content, members["bob"], membershipKey))
+		if err := m.Verify(group, membershipKey); err != nil {
+			t.Fatalf("Failed to verify proposal %d: %v", p.Type(), err)
+		}
+		decoded, err := m.Content.Proposal(group)
+		if err != nil {
+			t.Fatalf("Failed to decode proposal %d: %v", p.Type(), err)
+		}
+		if decoded.Type() != p.Type() {
+			t.Errorf("proposal type %d decoded as %d", p.Type(), decoded.Type())
+		}
+		switch decoded := decoded.(type) {
+		case *Remove:
+			if decoded.Leaf != "charlie" {
+				t.Errorf("remove should target charlie, got %s", decoded.Leaf)
+			}
+		case *Update:
+			if decoded.Leaf != "bob" || !bytes.Equal(decoded.LeafNode.EncryptionKey, p.(*Update).LeafNode.EncryptionKey) {
+				t.Errorf("update should carry bob's new leaf node")
+			}
+		case *PreSharedKey:
+			if decoded.PSK.Epoch != 2 || !bytes.Equal(decoded.PSK.Nonce, []byte("nonce")) {
+				t.Errorf("psk proposal decoded as %+v", decoded.PSK)
+			}
+		}
+	}
+
+	content, _ := FrameProposal(group, bob, &Remove{Leaf: "charlie"}, nil)
+	m := testSign(t, group, content, members["bob"], membershipKey)
+	if err := m.Verify(group, bytes.Repeat([]byte{8}, 32)); !errors.Is(err, ErrInvalidMembershipTag) {
+		t.Errorf("outsiders should fail the membership tag, got %v", err)
+	}
+	forged := testSign(t, group, content, members["alice"], membershipKey)
+	if err := forged.Verify(group, membershipKey); !errors.Is(err, tree.ErrInvalidSignature) {
+		t.Errorf("messages signed by another member should fail, got %v", err)
+	}
+	m.Content.AuthenticatedData = []byte("tampered")
+	if err := m.Verify(group, membershipKey); err == nil {
+		t.Errorf("tampered content should fail verification")
+	}
+}
+
+func TestPublicMessageCommit(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob")
+	membershipKey := bytes.Repeat([]byte{7}, 32)
+	eve := newTestMember(t, "eve")
+	proposals := []Proposal{&Add{KeyPackage: eve.keyPackage}}
+	commit := &Commit{Committer: "alice", Proposals: proposals, Path: testCommitPath(t, group, "alice", members["alice"].signer, proposals)}
+
+	content, err := FrameCommit(group, commit, nil)
+	if err != nil {
+		t.Fatalf("Failed to frame commit: %v", err)
+	}
+	m, err := SignPublicMessage(group, content, members["alice"].signer)
+	if err != nil {
+		t.Fatalf("Failed to sign commit: %v", err)
+	}
+	if err := m.SetMembershipTag(group.GroupContext(), membershipKey); err == nil {
+		t.Errorf("commits without a confirmation tag should not be tagged")
+	}
+	m.ConfirmationTag = []byte("confirmation")
+	if err := m.SetMembershipTag(group.GroupContext(), membershipKey); err != nil {
+		t.Fatalf("Failed to tag commit: %v", err)
+	}
+	m = roundTrip(t, m)
+	if err := m.Verify(group, membershipKey); err != nil {
+		t.Fatalf("Failed to verify commit: %v", err)
+	}
+	decoded, err := m.Content.Commit(group)
+	if err != nil {
+		t.Fatalf("Failed to decode commit: %v", err)
+	}
+	if decoded.Committer != "alice" || len(decoded.Proposals) != 1 || decoded.Path == nil {
+		t.Fatalf("commit decoded as %+v", decoded)
+	}
+	if _, err := ProcessCommit(group, decoded); err != nil {
+		t.Fatalf("Failed to process decoded commit: %v", err)
+	}
+	if _, ok := group.Find("eve"); !ok {
+		t.Errorf("decoded commit should add eve")
+	}
+	if err := m.Verify(group, membershipKey); !errors.Is(err, ErrWrongEpoch) {
+		t.Errorf("messages of a past epoch should fail with ErrWrongEpoch, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflictingProposal is returned when proposals cannot be committed together
+var ErrConflictingProposal = errors.New("conflicting proposal")
+
+// ValidateProposals checks a proposal list against RFC 9420 section 12.2
+// A leaf is updated or removed at most once and never both, a member is added at most
+// once, a PSK is injected at most once, group context extensions are replaced at most
+// once and a ReInit stands alone. The committer, when given, cannot propose an Update
+// or remove itself
+func ValidateProposals(committer string, proposals []Proposal) error {
+	touched := make(map[string]ProposalType)
+	added := make(map[string]bool)
+	psks := make(map[string]bool)
+	extensions := false
+	for _, p := range proposals {
+		switch p := p.(type) {
+		case *Update, *Remove:
+			leaf := subjectOf(p)
+			if committer != "" && leaf == committer {
+				return fmt.Errorf("%w: committer %s cannot be the subject of a proposal of type %d", ErrConflictingProposal, committer, p.Type())
+			}
+			if previous, ok := touched[leaf]; ok {
+				return fmt.Errorf("%w: %s has proposals of types %d and %d", ErrConflictingProposal, leaf, previous, p.Type())
+			}
+			touched[leaf] = p.Type()
+		case *Add:
+			identity := p.KeyPackage.Identity()
+			if added[identity] {
+				return fmt.Errorf("%w: %s is added twice", ErrConflictingProposal, identity)
+			}
+			added[identity] = true
+		case *PreSharedKey:
+			id := fmt.Sprintf("%d/%x/%x/%d", p.PSK.Type, p.PSK.ID, p.PSK.GroupID, p.PSK.Epoch)
+			if psks[id] {
+				return fmt.Errorf("%w: pre-shared key is injected twice", ErrConflictingProposal)
+			}
+			psks[id] = true
+		case *GroupContextExtensions:
+			if extensions {
+				return fmt.Errorf("%w: group context extensions are replaced twice", ErrConflictingProposal)
+			}
+			extensions = true
+		case *ReInit:
+			if len(proposals) != 1 {
+				return fmt.Errorf("%w: a ReInit must be the only proposal", ErrConflictingProposal)
+			}
+		}
+	}
+	return nil
+}
+
+// subjectOf returns the leaf an Update or Remove proposal is about
+func subjectOf(p Proposal) string {
+	if u, ok := p.(*Update); ok {
+		return u.Leaf
+	}
+	return p.(*Remove).Leaf
+}
+
+// PendingProposal is a proposal waiting for a commit
+type PendingProposal struct {
+	Sender   string
+	Epoch    uint64 // epoch the proposal was made in, it is void in any other
+	Received time.Time
+	Proposal Proposal
+}
+
+// ProposalQueue holds the proposals of one group until a commit covers them
+type ProposalQueue struct {
+	pending []PendingProposal
+	now     func() time.Time
+}
+
+// NewProposalQueue creates an empty proposal queue
+func NewProposalQueue() *ProposalQueue {
+	return &ProposalQueue{now: time.Now}
+}
+
+// Add queues a proposal sender made in epoch
+// Members can only propose updates of their own leaf, and a proposal that conflicts
+// with one already pending for the epoch is refused with ErrConflictingProposal
+func (q *ProposalQueue) Add(sender string, epoch uint64, p Proposal) error {
+	if u, ok := p.(*Update); ok && u.Leaf != sender {
+		return fmt.Errorf("%s cannot propose an update of %s", sender, u.Leaf)
+	}
+	proposals := append(q.Proposals(epoch), p)
+	if err := ValidateProposals("", proposals); err != nil {
+		return err
+	}
+	q.pending = append(q.pending, PendingProposal{Sender: sender, Epoch: epoch, Received: q.now(), Proposal: p})
+	return nil
+}
+
+// List returns the pending proposals of epoch in arrival order
+func (q *ProposalQueue) List(epoch uint64) []PendingProposal {
+	var list []PendingProposal
+	for _, pending := range q.pending {
+		if pending.Epoch == epoch {
+			list = append(list, pending)
+		}
+	}
+	return list
+}
+
+// Proposals returns the pending proposals of epoch, ready to be put in a Commit
+func (q *ProposalQueue) Proposals(epoch uint64) []Proposal {
+	var proposals []Proposal
+	for _, pending := range q.List(epoch) {
+		proposals = append(proposals, pending.Proposal)
+	}
+	return proposals
+}
+
+// Len returns the number of queued proposals across all epochs
+func (q *ProposalQueue) Len() int {
+	return len(q.pending)
+}
+
+// Expire drops proposals made before epoch, to be called once a commit moves the group
+// on. It returns how many were dropped
+func (q *ProposalQueue) Expire(epoch uint64) int {
+	return q.drop(func(pending PendingProposal) bool { return pending.Epoch < epoch })
+}
+
+// ExpireBefore drops proposals received before cutoff and returns how many were dropped
+func (q *ProposalQueue) ExpireBefore(cutoff time.Time) int {
+	return q.drop(func(pending PendingProposal) bool { return pending.Received.Before(cutoff) })
+}
+
+func (q *ProposalQueue) drop(expired func(PendingProposal) bool) int {
+	kept := q.pending[:0]
+	for _, pending := range q.pending {
+		if !expired(pending) {
+			kept = append(kept, pending)
+		}
+	}
+	dropped := len(q.pending) - len(kept)
+	clear(q.pending[len(kept):])
+	q.pending = kept
+	return dropped
+}
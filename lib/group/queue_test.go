@@ -0,0 +1,76 @@
+package group
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestProposalQueue(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob", "charlie")
+	queue := NewProposalQueue()
+	clock := time.Unix(1000, 0)
+	queue.now = func() time.Time { return clock }
+
+	eve := newTestMember(t, "eve")
+	if err := queue.Add("alice", 3, &Add{KeyPackage: eve.keyPackage}); err != nil {
+		t.Fatalf("Failed to queue add: %v", err)
+	}
+	if err := queue.Add("bob", 3, testUpdate(t, group, "bob", members["bob"])); err != nil {
+		t.Fatalf("Failed to queue update: %v", err)
+	}
+	conflicts := map[string]Proposal{
+		"remove of updated leaf": &Remove{Leaf: "bob"},
+		"second add":             &Add{KeyPackage: eve.keyPackage},
+		"reinit with others":     &ReInit{GroupID: []byte("next"), Version: tree.ProtocolVersionMLS10, CipherSuite: testSuite},
+	}
+	for name, p := range conflicts {
+		if err := queue.Add("alice", 3, p); !errors.Is(err, ErrConflictingProposal) {
+			t.Errorf("%s: expected ErrConflictingProposal, got %v", name, err)
+		}
+	}
+	if err := queue.Add("alice", 3, testUpdate(t, group, "charlie", members["charlie"])); err == nil {
+		t.Errorf("members should not propose updates of other leaves")
+	}
+
+	psk := &PreSharedKey{PSK: PreSharedKeyID{Type: PSKExternal, ID: []byte("psk"), Nonce: []byte("nonce")}}
+	clock = clock.Add(time.Minute)
+	if err := queue.Add("charlie", 3, psk); err != nil {
+		t.Fatalf("Failed to queue psk: %v", err)
+	}
+	if err := queue.Add("charlie", 3, &PreSharedKey{PSK: psk.PSK}); !errors.Is(err, ErrConflictingProposal) {
+		t.Errorf("the same PSK should not be injected twice, got %v", err)
+	}
+	// Proposals of another epoch do not conflict
+	if err := queue.Add("alice", 4, &Remove{Leaf: "bob"}); err != nil {
+		t.Fatalf("Failed to queue remove for the next epoch: %v", err)
+	}
+
+	if list := queue.List(3); len(list) != 3 || list[0].Sender != "alice" || list[2].Proposal != psk {
+		t.Errorf("epoch 3 should list its proposals in arrival order, got %d", len(list))
+	}
+	if dropped := queue.ExpireBefore(time.Unix(1030, 0)); dropped != 2 || queue.Len() != 2 {
+		t.Errorf("proposals older than the cutoff should expire, dropped %d", dropped)
+	}
+	if dropped := queue.Expire(4); dropped != 1 || len(queue.Proposals(4)) != 1 {
+		t.Errorf("proposals of earlier epochs should expire, dropped %d", dropped)
+	}
+}
+
+func TestCommitGroupContextExtensions(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob")
+	extensions := []tree.Extension{{Type: 0xff00, Data: []byte("room")}}
+	proposals := []Proposal{&GroupContextExtensions{Extensions: extensions}}
+	if err := ValidateProposals("alice", append(proposals, &GroupContextExtensions{})); !errors.Is(err, ErrConflictingProposal) {
+		t.Errorf("extensions should be replaced at most once, got %v", err)
+	}
+	commit := &Commit{Committer: "alice", Proposals: proposals, Path: testCommitPath(t, group, "alice", members["alice"].signer, proposals)}
+	if _, err := ProcessCommit(group, commit); err != nil {
+		t.Fatalf("Failed to process commit: %v", err)
+	}
+	if got := group.GroupContext().Extensions; len(got) != 1 || got[0].Type != 0xff00 {
+		t.Errorf("commit should install the proposed extensions, got %v", got)
+	}
+}
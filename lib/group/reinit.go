@@ -0,0 +1,75 @@
+package group
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// Reinitialize bootstraps the successor of old, which a commit of reinit must have
+// retired. The successor is a fresh tree with the ReInit's group ID, ciphersuite and
+// extensions, holding the members of old that published a KeyPackage for it. The
+// returned resumption PSK, of usage reinit, names the last epoch of old; the successor's
+// first commit injects it, so members link the two groups by registering that epoch's
+// ResumptionPSK with their PSKStore
+func Reinitialize(old *tree.Tree, reinit *ReInit, keyPackages []*keypackage.KeyPackage, store tree.Store, opts ...tree.Option) (*tree.Tree, PreSharedKeyID, error) {
+	if old.Successor() == nil || !bytes.Equal(old.Successor(), reinit.GroupID) {
+		return nil, PreSharedKeyID{}, fmt.Errorf("group %x was not retired by a ReInit to %x", old.GroupID(), reinit.GroupID)
+	}
+	if reinit.Version != tree.ProtocolVersionMLS10 {
+		return nil, PreSharedKeyID{}, fmt.Errorf("unsupported protocol version %d", reinit.Version)
+	}
+	successor, psk, err := resume(old, ResumptionReInit, reinit.GroupID, reinit.CipherSuite, keyPackages, store, opts)
+	if err != nil {
+		return nil, PreSharedKeyID{}, err
+	}
+	if reinit.Extensions != nil {
+		if err := successor.SetGroupExtensions(reinit.Extensions); err != nil {
+			return nil, PreSharedKeyID{}, err
+		}
+	}
+	return successor, psk, nil
+}
+
+// Branch spins a subgroup with its own group ID off old, e.g. a breakout room of a large
+// group. The subset of members is named by the KeyPackages they published for the
+// branch, since their leaves in old are bound to its group ID. old is left as it is,
+// and the returned resumption PSK, of usage branch, links the two as in Reinitialize
+func Branch(old *tree.Tree, groupID []byte, memberSubset []*keypackage.KeyPackage, store tree.Store, opts ...tree.Option) (*tree.Tree, PreSharedKeyID, error) {
+	if bytes.Equal(groupID, old.GroupID()) {
+		return nil, PreSharedKeyID{}, fmt.Errorf("branch needs a group ID of its own, %x is the parent's", groupID)
+	}
+	return resume(old, ResumptionBranch, groupID, old.GroupContext().CipherSuite, memberSubset, store, opts)
+}
+
+// resume creates a group carrying members of old over, together with the resumption PSK
+// ID of old's current epoch
+func resume(old *tree.Tree, usage ResumptionPSKUsage, groupID []byte, cs tree.Ciphersuite, keyPackages []*keypackage.KeyPackage, store tree.Store, opts []tree.Option) (*tree.Tree, PreSharedKeyID, error) {
+	suite, err := treekem.NewSuite(cs)
+	if err != nil {
+		return nil, PreSharedKeyID{}, err
+	}
+	opts = append([]tree.Option{tree.WithCiphersuite(cs), tree.WithGroupID(groupID)}, opts...)
+	resumed, err := tree.NewTreeWithStore(store, opts...)
+	if err != nil {
+		return nil, PreSharedKeyID{}, err
+	}
+	for _, kp := range keyPackages {
+		if _, ok := old.Find(kp.Identity()); !ok {
+			return nil, PreSharedKeyID{}, fmt.Errorf("%s is not a member of group %x", kp.Identity(), old.GroupID())
+		}
+		if err := resumed.InsertFromKeyPackage(kp); err != nil {
+			return nil, PreSharedKeyID{}, fmt.Errorf("failed to carry %s over: %w", kp.Identity(), err)
+		}
+	}
+
+	psk := PreSharedKeyID{Type: PSKResumption, Usage: usage, GroupID: old.GroupID(), Epoch: old.Epoch(), Nonce: make([]byte, suite.HashSize())}
+	if _, err := rand.Read(psk.Nonce); err != nil {
+		return nil, PreSharedKeyID{}, fmt.Errorf("failed to generate PSK nonce: %w", err)
+	}
+	return resumed, psk, nil
+}
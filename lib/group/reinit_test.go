@@ -0,0 +1,98 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+func TestReInit(t *testing.T) {
+	group, _ := newTestGroup(t, "alice", "bob", "charlie")
+	next := tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256
+	reinit := &ReInit{GroupID: []byte("next"), Version: tree.ProtocolVersionMLS10, CipherSuite: next}
+	if _, _, err := Reinitialize(group, reinit, nil, nil); err == nil {
+		t.Errorf("a live group should not be reinitialized")
+	}
+	if _, err := ProcessCommit(group, &Commit{Committer: "alice", Proposals: []Proposal{reinit}}); err != nil {
+		t.Fatalf("Failed to process ReInit commit: %v", err)
+	}
+	if !bytes.Equal(group.Successor(), []byte("next")) {
+		t.Errorf("the commit should retire the group, successor %q", group.Successor())
+	}
+	if err := group.Delete("bob"); !errors.Is(err, tree.ErrRetired) {
+		t.Errorf("a retired group should refuse changes, got %v", err)
+	}
+
+	var keyPackages []*keypackage.KeyPackage
+	for _, name := range []string{"alice", "bob", "eve"} {
+		signer, _ := keypackage.GenerateSignatureKey(next)
+		kp, _, err := keypackage.Generate(next, []byte(name), signer)
+		if err != nil {
+			t.Fatalf("Failed to generate key package: %v", err)
+		}
+		keyPackages = append(keyPackages, kp)
+	}
+	if _, _, err := Reinitialize(group, reinit, keyPackages, nil); err == nil {
+		t.Errorf("non-members should not be carried over")
+	}
+	successor, psk, err := Reinitialize(group, reinit, keyPackages[:2], nil)
+	if err != nil {
+		t.Fatalf("Failed to reinitialize: %v", err)
+	}
+	if gc := successor.GroupContext(); !bytes.Equal(gc.GroupID, []byte("next")) || gc.CipherSuite != next || len(successor.GetLeaves()) != 2 {
+		t.Errorf("successor should be a %x group with 2 members, got %x/%x", next, gc.CipherSuite, gc.GroupID)
+	}
+	if psk.Type != PSKResumption || psk.Usage != ResumptionReInit || !bytes.Equal(psk.GroupID, []byte("group")) || psk.Epoch != group.Epoch() {
+		t.Errorf("resumption PSK should name the final epoch of the old group, got %+v", psk)
+	}
+
+	// The final epoch's resumption PSK links the two key schedules
+	oldSuite, _ := treekem.NewSuite(testSuite)
+	final, err := DeriveEpochSecrets(oldSuite, bytes.Repeat([]byte{1}, 32), nil, nil, group.GroupContext())
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+	store := NewMemoryPSKStore()
+	store.AddResumption(group.GroupID(), group.Epoch(), final.ResumptionPSK)
+	suite, _ := treekem.NewSuite(next)
+	pskSecret, err := PSKSecret(suite, store, []PreSharedKeyID{psk})
+	if err != nil {
+		t.Fatalf("Failed to derive psk_secret: %v", err)
+	}
+	if bytes.Equal(pskSecret, make([]byte, suite.HashSize())) {
+		t.Errorf("psk_secret should carry the old group's resumption PSK")
+	}
+}
+
+func TestBranch(t *testing.T) {
+	group, _ := newTestGroup(t, "alice", "bob", "charlie")
+	alice, bob, eve := newTestMember(t, "alice"), newTestMember(t, "bob"), newTestMember(t, "eve")
+	if _, _, err := Branch(group, []byte("breakout"), []*keypackage.KeyPackage{alice.keyPackage, eve.keyPackage}, nil); err == nil {
+		t.Errorf("non-members should not join a branch")
+	}
+	if _, _, err := Branch(group, group.GroupID(), []*keypackage.KeyPackage{alice.keyPackage}, nil); err == nil {
+		t.Errorf("a branch should not reuse the parent's group ID")
+	}
+
+	epoch := group.Epoch()
+	branch, psk, err := Branch(group, []byte("breakout"), []*keypackage.KeyPackage{alice.keyPackage, bob.keyPackage}, nil)
+	if err != nil {
+		t.Fatalf("Failed to branch: %v", err)
+	}
+	if leaves := branch.GetLeaves(); len(leaves) != 2 || leaves[0].Name() != "alice" || leaves[1].Name() != "bob" {
+		t.Errorf("branch should hold alice and bob only, got %d leaves", len(leaves))
+	}
+	if !bytes.Equal(branch.GroupID(), []byte("breakout")) || branch.GroupContext().CipherSuite != testSuite {
+		t.Errorf("branch should keep the ciphersuite under its own group ID")
+	}
+	if psk.Usage != ResumptionBranch || !bytes.Equal(psk.GroupID, group.GroupID()) || psk.Epoch != epoch {
+		t.Errorf("branch PSK should name the parent's current epoch, got %+v", psk)
+	}
+	if len(group.GetLeaves()) != 3 || group.Successor() != nil {
+		t.Errorf("the parent group should be left untouched")
+	}
+}
@@ -0,0 +1,233 @@
+package group
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// DefaultMaxForwardRatchet bounds how far ahead of a sender's ratchet a generation may be
+const DefaultMaxForwardRatchet = 1024
+
+var (
+	// ErrKeyConsumed is returned for generations whose key was already used or deleted
+	ErrKeyConsumed = errors.New("message key was already consumed")
+	// ErrTooFarAhead is returned for generations past the forward ratchet limit
+	ErrTooFarAhead = errors.New("generation is too far ahead of the ratchet")
+)
+
+// RatchetType selects one of the two ratchets every sender has
+type RatchetType int
+
+const (
+	RatchetHandshake RatchetType = iota
+	RatchetApplication
+)
+
+// String returns the label the ratchet is derived with
+func (r RatchetType) String() string {
+	if r == RatchetHandshake {
+		return "handshake"
+	}
+	return "application"
+}
+
+// MessageKey is the AEAD key and nonce for one generation of a sender's ratchet
+type MessageKey struct {
+	Generation uint32
+	Key        []byte
+	Nonce      []byte
+}
+
+// ratchet is one sender's hash ratchet; next is the secret of generation
+type ratchet struct {
+	generation uint32
+	next       []byte
+	skipped    map[uint32]MessageKey // keys of generations passed over, kept for out-of-order delivery
+}
+
+// SecretTree derives per-sender message keys from an epoch's encryption secret (RFC 9420 section 9)
+// Node secrets are deleted as soon as both children are derived and message keys as soon
+// as they are handed out, so a compromise later in the epoch does not expose earlier messages
+type SecretTree struct {
+	suite      *treekem.Suite
+	leaves     uint32            // leaf count padded to a power of two
+	nodes      map[uint32][]byte // secrets of nodes not yet split, by array index
+	ratchets   map[uint32]*[2]*ratchet
+	maxForward uint32
+}
+
+// NewSecretTree seeds a secret tree for a group of leafCount members with encryptionSecret
+func NewSecretTree(suite *treekem.Suite, encryptionSecret []byte, leafCount int) (*SecretTree, error) {
+	if leafCount <= 0 {
+		return nil, fmt.Errorf("secret tree needs at least one leaf, got %d", leafCount)
+	}
+	leaves := uint32(1) << bits.Len32(uint32(leafCount-1))
+	st := &SecretTree{
+		suite:      suite,
+		leaves:     leaves,
+		nodes:      map[uint32][]byte{leaves - 1: append([]byte(nil), encryptionSecret...)},
+		ratchets:   make(map[uint32]*[2]*ratchet),
+		maxForward: DefaultMaxForwardRatchet,
+	}
+	return st, nil
+}
+
+// SetMaxForwardRatchet changes how many generations a receiver may skip ahead
+func (st *SecretTree) SetMaxForwardRatchet(n uint32) {
+	st.maxForward = n
+}
+
+// Next returns the key for the sender's next message and advances its ratchet
+func (st *SecretTree) Next(leaf uint32, kind RatchetType) (MessageKey, error) {
+	r, err := st.ratchet(leaf, kind)
+	if err != nil {
+		return MessageKey{}, err
+	}
+	return st.advance(r)
+}
+
+// Key returns the key a receiver needs for generation of leaf's ratchet
+// Generations ahead of the ratchet are reached by skipping, keeping the skipped keys
+// for messages that arrive late. Every key can be obtained once
+func (st *SecretTree) Key(leaf uint32, kind RatchetType, generation uint32) (MessageKey, error) {
+	r, err := st.ratchet(leaf, kind)
+	if err != nil {
+		return MessageKey{}, err
+	}
+	if generation < r.generation {
+		key, ok := r.skipped[generation]
+		if !ok {
+			return MessageKey{}, fmt.Errorf("generation %d of leaf %d: %w", generation, leaf, ErrKeyConsumed)
+		}
+		delete(r.skipped, generation)
+		return key, nil
+	}
+	if generation-r.generation > st.maxForward {
+		return MessageKey{}, fmt.Errorf("generation %d of leaf %d: %w", generation, leaf, ErrTooFarAhead)
+	}
+	for r.generation < generation {
+		key, err := st.advance(r)
+		if err != nil {
+			return MessageKey{}, err
+		}
+		r.skipped[key.Generation] = key
+	}
+	// Keys of generations behind the replay window can no longer be used
+	for skipped := range r.skipped {
+		if generation-skipped >= tree.ReplayWindowSize {
+			delete(r.skipped, skipped)
+		}
+	}
+	return st.advance(r)
+}
+
+// Generation returns the next generation of leaf's ratchet
+func (st *SecretTree) Generation(leaf uint32, kind RatchetType) (uint32, error) {
+	r, err := st.ratchet(leaf, kind)
+	if err != nil {
+		return 0, err
+	}
+	return r.generation, nil
+}
+
+// advance derives the key of the ratchet's current generation and replaces its secret
+func (st *SecretTree) advance(r *ratchet) (MessageKey, error) {
+	context := binary.BigEndian.AppendUint32(nil, r.generation)
+	key, err := st.suite.ExpandWithLabel(r.next, "key", context, st.suite.AEADKeySize())
+	if err != nil {
+		return MessageKey{}, err
+	}
+	nonce, err := st.suite.ExpandWithLabel(r.next, "nonce", context, st.suite.AEADNonceSize())
+	if err != nil {
+		return MessageKey{}, err
+	}
+	next, err := st.suite.ExpandWithLabel(r.next, "secret", context, st.suite.HashSize())
+	if err != nil {
+		return MessageKey{}, err
+	}
+	clear(r.next)
+	mk := MessageKey{Generation: r.generation, Key: key, Nonce: nonce}
+	r.next = next
+	r.generation++
+	return mk, nil
+}
+
+// ratchet returns leaf's ratchet of kind, deriving the leaf secret on first use
+func (st *SecretTree) ratchet(leaf uint32, kind RatchetType) (*ratchet, error) {
+	if leaf >= st.leaves {
+		return nil, fmt.Errorf("leaf %d is outside a secret tree of %d leaves", leaf, st.leaves)
+	}
+	if pair, ok := st.ratchets[leaf]; ok {
+		return pair[kind], nil
+	}
+
+	secret, err := st.leafSecret(leaf)
+	if err != nil {
+		return nil, err
+	}
+	pair := &[2]*ratchet{}
+	for _, k := range []RatchetType{RatchetHandshake, RatchetApplication} {
+		next, err := st.suite.ExpandWithLabel(secret, k.String(), nil, st.suite.HashSize())
+		if err != nil {
+			return nil, err
+		}
+		pair[k] = &ratchet{next: next, skipped: make(map[uint32]MessageKey)}
+	}
+	clear(secret)
+	st.ratchets[leaf] = pair
+	return pair[kind], nil
+}
+
+// leafSecret walks down from the nearest stored ancestor to leaf, splitting each node
+// on the way and deleting its secret. The leaf secret is removed from the tree too
+func (st *SecretTree) leafSecret(leaf uint32) ([]byte, error) {
+	target := 2 * leaf
+	var path []uint32
+	x := st.leaves - 1
+	for {
+		path = append(path, x)
+		if x == target {
+			break
+		}
+		level := bits.TrailingZeros32(^x)
+		if target < x {
+			x ^= 1 << (level - 1)
+		} else {
+			x ^= 3 << (level - 1)
+		}
+	}
+
+	start := -1
+	for i, node := range path {
+		if _, ok := st.nodes[node]; ok {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("secret of leaf %d: %w", leaf, ErrKeyConsumed)
+	}
+	for _, node := range path[start : len(path)-1] {
+		secret := st.nodes[node]
+		level := bits.TrailingZeros32(^node)
+		left, err := st.suite.ExpandWithLabel(secret, "tree", []byte("left"), st.suite.HashSize())
+		if err != nil {
+			return nil, err
+		}
+		right, err := st.suite.ExpandWithLabel(secret, "tree", []byte("right"), st.suite.HashSize())
+		if err != nil {
+			return nil, err
+		}
+		st.nodes[node^(1<<(level-1))] = left
+		st.nodes[node^(3<<(level-1))] = right
+		clear(secret)
+		delete(st.nodes, node)
+	}
+	secret := st.nodes[target]
+	delete(st.nodes, target)
+	return secret, nil
+}
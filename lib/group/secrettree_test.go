@@ -0,0 +1,92 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+func newTestSecretTree(t *testing.T, secret string, leaves int) *SecretTree {
+	t.Helper()
+	suite, err := treekem.NewSuite(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)
+	if err != nil {
+		t.Fatalf("Failed to create suite: %v", err)
+	}
+	st, err := NewSecretTree(suite, []byte(secret), leaves)
+	if err != nil {
+		t.Fatalf("Failed to create secret tree: %v", err)
+	}
+	return st
+}
+
+func TestSecretTreeKeys(t *testing.T) {
+	sender := newTestSecretTree(t, "encryption secret", 5)
+	receiver := newTestSecretTree(t, "encryption secret", 5)
+
+	var sent []MessageKey
+	for i := 0; i < 4; i++ {
+		key, err := sender.Next(3, RatchetApplication)
+		if err != nil {
+			t.Fatalf("Failed to derive key: %v", err)
+		}
+		if key.Generation != uint32(i) || len(key.Key) != sender.suite.AEADKeySize() || len(key.Nonce) != sender.suite.AEADNonceSize() {
+			t.Fatalf("unexpected key for generation %d: %+v", i, key)
+		}
+		sent = append(sent, key)
+	}
+
+	// Out of order: generation 2 first skips 0 and 1, which stay available once
+	for _, generation := range []uint32{2, 0, 3, 1} {
+		key, err := receiver.Key(3, RatchetApplication, generation)
+		if err != nil {
+			t.Fatalf("Failed to derive generation %d: %v", generation, err)
+		}
+		if !bytes.Equal(key.Key, sent[generation].Key) || !bytes.Equal(key.Nonce, sent[generation].Nonce) {
+			t.Errorf("receiver should derive the sender's key for generation %d", generation)
+		}
+	}
+	for _, generation := range []uint32{0, 3} {
+		if _, err := receiver.Key(3, RatchetApplication, generation); !errors.Is(err, ErrKeyConsumed) {
+			t.Errorf("generation %d should be consumed, got %v", generation, err)
+		}
+	}
+
+	handshake, _ := receiver.Key(3, RatchetHandshake, 0)
+	other, _ := receiver.Key(4, RatchetApplication, 0)
+	if bytes.Equal(handshake.Key, sent[0].Key) || bytes.Equal(other.Key, sent[0].Key) {
+		t.Errorf("ratchets of different kinds and leaves should not share keys")
+	}
+	if foreign, _ := newTestSecretTree(t, "other secret", 5).Key(3, RatchetApplication, 0); bytes.Equal(foreign.Key, sent[0].Key) {
+		t.Errorf("keys should depend on the encryption secret")
+	}
+
+	if _, err := receiver.Key(8, RatchetApplication, 0); err == nil {
+		t.Errorf("leaves outside the tree should be rejected")
+	}
+	receiver.SetMaxForwardRatchet(10)
+	if _, err := receiver.Key(3, RatchetApplication, 20); !errors.Is(err, ErrTooFarAhead) {
+		t.Errorf("generations past the forward limit should be rejected, got %v", err)
+	}
+}
+
+func TestSecretTreeDeletesSecrets(t *testing.T) {
+	st := newTestSecretTree(t, "encryption secret", 4)
+	if _, err := st.Next(0, RatchetHandshake); err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	// Deriving leaf 0 splits the root and node 1, leaving only the unused siblings
+	if len(st.nodes) != 2 || st.nodes[5] == nil || st.nodes[2] == nil {
+		t.Errorf("only the secrets of unvisited subtrees should remain, got %d nodes", len(st.nodes))
+	}
+	for leaf := uint32(1); leaf < 4; leaf++ {
+		if _, err := st.Next(leaf, RatchetApplication); err != nil {
+			t.Fatalf("Failed to derive key for leaf %d: %v", leaf, err)
+		}
+	}
+	if len(st.nodes) != 0 {
+		t.Errorf("all node secrets should be deleted once every leaf is derived, got %d", len(st.nodes))
+	}
+}
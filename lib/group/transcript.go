@@ -0,0 +1,107 @@
+package group
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// ErrInvalidConfirmationTag is returned for commits whose confirmation tag does not match
+// the epoch they lead into
+var ErrInvalidConfirmationTag = errors.New("invalid confirmation tag")
+
+// ConfirmedTranscriptHash folds a signed commit message into the transcript that ended
+// at interim, the interim transcript hash of the epoch the commit was sent in
+// (RFC 9420 section 8.2)
+func ConfirmedTranscriptHash(suite *treekem.Suite, interim []byte, m *PublicMessage) ([]byte, error) {
+	if m.Content.ContentType != ContentCommit {
+		return nil, fmt.Errorf("content type %d is not a commit", m.Content.ContentType)
+	}
+	w := &tls.Writer{Buf: append([]byte(nil), interim...)}
+	w.Uint16(uint16(WireFormatPublicMessage))
+	if err := m.Content.encode(w); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(m.Signature); err != nil {
+		return nil, err
+	}
+	return suite.Hash(w.Buf), nil
+}
+
+// InterimTranscriptHash extends a confirmed transcript hash with the commit's
+// confirmation tag, ready for the next commit
+func InterimTranscriptHash(suite *treekem.Suite, confirmed, confirmationTag []byte) ([]byte, error) {
+	w := &tls.Writer{Buf: append([]byte(nil), confirmed...)}
+	if err := w.Opaque(confirmationTag); err != nil {
+		return nil, err
+	}
+	return suite.Hash(w.Buf), nil
+}
+
+// ConfirmationTag proves knowledge of the new epoch's confirmation key over its
+// confirmed transcript hash
+func ConfirmationTag(suite *treekem.Suite, confirmationKey, confirmed []byte) []byte {
+	return suite.MAC(confirmationKey, confirmed)
+}
+
+// MergeCommit moves t into the epoch the commit carried by m leads to and returns the
+// secrets of that epoch. initSecret is the init secret of the current epoch,
+// commitSecret the one the commit's UpdatePath yields (nil without a path) and psks
+// resolves the PSKs the commit injects. The confirmed transcript hash of the new epoch
+// enters its group context; the confirmation tag derived from it is verified when m
+// carries one, or set on m when the committer merges its own commit. Nothing changes
+// unless the tag checks out, after which the transcript hashes are recorded with t
+func MergeCommit(t *tree.Tree, m *PublicMessage, initSecret, commitSecret []byte, psks PSKStore, opts ...tree.Option) (*EpochSecrets, error) {
+	current := t.GroupContext()
+	suite, err := treekem.NewSuite(current.CipherSuite)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := m.Content.Commit(t)
+	if err != nil {
+		return nil, err
+	}
+	var pskSecret []byte
+	if ids := commit.PreSharedKeys(); len(ids) > 0 {
+		if psks == nil {
+			return nil, fmt.Errorf("commit injects %d PSKs: %w", len(ids), ErrUnknownPSK)
+		}
+		if pskSecret, err = PSKSecret(suite, psks, ids); err != nil {
+			return nil, err
+		}
+	}
+	confirmed, err := ConfirmedTranscriptHash(suite, t.InterimTranscriptHash(), m)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, err := stageCommit(t, commit, opts)
+	if err != nil {
+		return nil, err
+	}
+	next := staged.GroupContext()
+	next.Epoch = current.Epoch + 1
+	next.ConfirmedTranscriptHash = confirmed
+	secrets, err := DeriveEpochSecrets(suite, initSecret, commitSecret, pskSecret, next)
+	if err != nil {
+		return nil, err
+	}
+	tag := ConfirmationTag(suite, secrets.ConfirmationKey, confirmed)
+	if len(m.ConfirmationTag) == 0 {
+		m.ConfirmationTag = tag
+	} else if !hmac.Equal(tag, m.ConfirmationTag) {
+		return nil, ErrInvalidConfirmationTag
+	}
+	interim, err := InterimTranscriptHash(suite, confirmed, tag)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := applyStaged(t, staged, commit, confirmed, interim); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
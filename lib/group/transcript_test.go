@@ -0,0 +1,79 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+func TestMergeCommitTranscript(t *testing.T) {
+	group, members := newTestGroup(t, "alice", "bob")
+	bob, carol := testReplica(t, group, nil), testReplica(t, group, nil)
+	suite, _ := treekem.NewSuite(testSuite)
+	initSecret := bytes.Repeat([]byte{1}, 32)
+	current, err := DeriveEpochSecrets(suite, initSecret, nil, nil, group.GroupContext())
+	if err != nil {
+		t.Fatalf("Failed to derive epoch secrets: %v", err)
+	}
+
+	eve := newTestMember(t, "eve")
+	proposals := []Proposal{&Add{KeyPackage: eve.keyPackage}}
+	commit := &Commit{Committer: "alice", Proposals: proposals, Path: testCommitPath(t, group, "alice", members["alice"].signer, proposals)}
+	content, err := FrameCommit(group, commit, nil)
+	if err != nil {
+		t.Fatalf("Failed to frame commit: %v", err)
+	}
+	m, err := SignPublicMessage(group, content, members["alice"].signer)
+	if err != nil {
+		t.Fatalf("Failed to sign commit: %v", err)
+	}
+
+	// The committer merges first, which sets the confirmation tag the others check
+	sent := group.GroupContext()
+	committed, err := MergeCommit(group, m, initSecret, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to merge own commit: %v", err)
+	}
+	if err := m.SetMembershipTag(sent, current.MembershipKey); err != nil {
+		t.Fatalf("Failed to tag commit: %v", err)
+	}
+	if len(m.ConfirmationTag) == 0 || group.Epoch() != sent.Epoch+1 {
+		t.Fatalf("merging should set the confirmation tag and advance the epoch")
+	}
+
+	received := roundTrip(t, m)
+	if err := received.Verify(bob, current.MembershipKey); err != nil {
+		t.Fatalf("Failed to verify commit: %v", err)
+	}
+	merged, err := MergeCommit(bob, received, initSecret, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to merge commit: %v", err)
+	}
+	if !bytes.Equal(merged.EpochSecret, committed.EpochSecret) {
+		t.Errorf("members should reach the same epoch secret")
+	}
+	gc := bob.GroupContext()
+	if !bytes.Equal(gc.ConfirmedTranscriptHash, group.GroupContext().ConfirmedTranscriptHash) || len(gc.ConfirmedTranscriptHash) == 0 {
+		t.Errorf("members should agree on the confirmed transcript hash")
+	}
+	if !bytes.Equal(bob.InterimTranscriptHash(), group.InterimTranscriptHash()) || bytes.Equal(bob.InterimTranscriptHash(), gc.ConfirmedTranscriptHash) {
+		t.Errorf("members should agree on an interim transcript hash past the confirmed one")
+	}
+	if !bytes.Equal(gc.TreeHash, group.TreeHash()) {
+		t.Errorf("the group context should carry the merged tree")
+	}
+
+	forged := roundTrip(t, m)
+	forged.ConfirmationTag = bytes.Repeat([]byte{9}, len(m.ConfirmationTag))
+	if _, err := MergeCommit(carol, forged, initSecret, nil, nil); !errors.Is(err, ErrInvalidConfirmationTag) {
+		t.Errorf("a wrong confirmation tag should fail with ErrInvalidConfirmationTag, got %v", err)
+	}
+	if _, err := MergeCommit(carol, roundTrip(t, m), bytes.Repeat([]byte{2}, 32), nil, nil); !errors.Is(err, ErrInvalidConfirmationTag) {
+		t.Errorf("members with other epoch secrets should fail the confirmation tag, got %v", err)
+	}
+	if carol.Epoch() != sent.Epoch || len(carol.InterimTranscriptHash()) != 0 {
+		t.Errorf("failed merges should leave the tree alone")
+	}
+}
@@ -0,0 +1,269 @@
+package group
+
+import (
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// proposalOrRefProposal marks a proposal carried by value in a Commit
+const proposalOrRefProposal uint8 = 1
+
+// leafIndexOf returns the positional leaf index of the member name, as carried on the wire
+func leafIndexOf(t *tree.Tree, name string) (uint32, error) {
+	for i, leaf := range t.GetLeaves() {
+		if leaf.Name() == name {
+			return uint32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no member %s", name)
+}
+
+// leafNameAt returns the member at a positional leaf index
+func leafNameAt(t *tree.Tree, index uint32) (string, error) {
+	leaves := t.GetLeaves()
+	if int(index) >= len(leaves) {
+		return "", fmt.Errorf("no member at leaf %d", index)
+	}
+	return leaves[index].Name(), nil
+}
+
+// encodeProposal writes p in its RFC 9420 wire format, with members as leaf indices of t
+func encodeProposal(w *tls.Writer, t *tree.Tree, p Proposal) error {
+	w.Uint16(uint16(p.Type()))
+	switch p := p.(type) {
+	case *Add:
+		encoded, err := p.KeyPackage.Marshal()
+		if err != nil {
+			return err
+		}
+		w.Buf = append(w.Buf, encoded...)
+	case *Update:
+		encoded, err := p.LeafNode.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		w.Buf = append(w.Buf, encoded...)
+	case *Remove:
+		index, err := leafIndexOf(t, p.Leaf)
+		if err != nil {
+			return err
+		}
+		w.Uint32(index)
+	case *PreSharedKey:
+		return p.PSK.encode(w)
+	case *ReInit:
+		if err := w.Opaque(p.GroupID); err != nil {
+			return err
+		}
+		w.Uint16(p.Version)
+		w.Uint16(uint16(p.CipherSuite))
+		return encodeExtensions(w, p.Extensions)
+	case *GroupContextExtensions:
+		return encodeExtensions(w, p.Extensions)
+	default:
+		return fmt.Errorf("unsupported proposal type %d", p.Type())
+	}
+	return nil
+}
+
+// decodeProposal reads a proposal sent by sender; leafName resolves Remove targets and
+// is nil when only the extent of the proposal is of interest
+func decodeProposal(r *tls.Reader, sender string, leafName func(uint32) (string, error)) (Proposal, error) {
+	kind, err := r.Uint16()
+	if err != nil {
+		return nil, err
+	}
+	switch ProposalType(kind) {
+	case ProposalAdd:
+		kp, rest, err := keypackage.Read(r.Buf)
+		if err != nil {
+			return nil, err
+		}
+		r.Buf = rest
+		return &Add{KeyPackage: kp}, nil
+	case ProposalUpdate:
+		leaf, rest, err := tree.ReadLeafNode(r.Buf)
+		if err != nil {
+			return nil, err
+		}
+		r.Buf = rest
+		return &Update{Leaf: sender, LeafNode: leaf}, nil
+	case ProposalRemove:
+		index, err := r.Uint32()
+		if err != nil {
+			return nil, err
+		}
+		remove := &Remove{}
+		if leafName != nil {
+			if remove.Leaf, err = leafName(index); err != nil {
+				return nil, err
+			}
+		}
+		return remove, nil
+	case ProposalPreSharedKey:
+		id, err := decodePreSharedKeyID(r)
+		if err != nil {
+			return nil, err
+		}
+		return &PreSharedKey{PSK: id}, nil
+	case ProposalReInit:
+		reinit := &ReInit{}
+		if reinit.GroupID, err = r.Opaque(); err != nil {
+			return nil, err
+		}
+		if reinit.Version, err = r.Uint16(); err != nil {
+			return nil, err
+		}
+		cs, err := r.Uint16()
+		if err != nil {
+			return nil, err
+		}
+		reinit.CipherSuite = tree.Ciphersuite(cs)
+		if reinit.Extensions, err = decodeExtensions(r); err != nil {
+			return nil, err
+		}
+		return reinit, nil
+	case ProposalGroupContextExtensions:
+		extensions, err := decodeExtensions(r)
+		if err != nil {
+			return nil, err
+		}
+		return &GroupContextExtensions{Extensions: extensions}, nil
+	}
+	return nil, fmt.Errorf("unsupported proposal type %d", kind)
+}
+
+// decodePreSharedKeyID reads a PreSharedKeyID written by encode
+func decodePreSharedKeyID(r *tls.Reader) (PreSharedKeyID, error) {
+	var id PreSharedKeyID
+	kind, err := r.Uint8()
+	if err != nil {
+		return id, err
+	}
+	id.Type = PSKType(kind)
+	switch id.Type {
+	case PSKExternal:
+		if id.ID, err = r.Opaque(); err != nil {
+			return id, err
+		}
+	case PSKResumption:
+		usage, err := r.Uint8()
+		if err != nil {
+			return id, err
+		}
+		id.Usage = ResumptionPSKUsage(usage)
+		if id.GroupID, err = r.Opaque(); err != nil {
+			return id, err
+		}
+		if id.Epoch, err = r.Uint64(); err != nil {
+			return id, err
+		}
+	default:
+		return id, fmt.Errorf("unsupported PSK type %d", kind)
+	}
+	id.Nonce, err = r.Opaque()
+	return id, err
+}
+
+// encode writes the Commit in its RFC 9420 wire format, with proposals by value
+func (c *Commit) encode(w *tls.Writer, t *tree.Tree) error {
+	err := w.Vector(func(w *tls.Writer) error {
+		for _, p := range c.Proposals {
+			w.Uint8(proposalOrRefProposal)
+			if err := encodeProposal(w, t, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if c.Path == nil {
+		w.Uint8(0)
+		return nil
+	}
+	w.Uint8(1)
+	encoded, err := c.Path.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	w.Buf = append(w.Buf, encoded...)
+	return nil
+}
+
+// decodeCommit reads a Commit sent by committer, see decodeProposal
+func decodeCommit(r *tls.Reader, committer string, leafName func(uint32) (string, error)) (*Commit, error) {
+	c := &Commit{Committer: committer}
+	err := r.Vector(func(r *tls.Reader) error {
+		kind, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		if kind != proposalOrRefProposal {
+			return fmt.Errorf("proposal references are not supported")
+		}
+		p, err := decodeProposal(r, committer, leafName)
+		if err != nil {
+			return err
+		}
+		c.Proposals = append(c.Proposals, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	present, err := r.Uint8()
+	if err != nil {
+		return nil, err
+	}
+	switch present {
+	case 0:
+	case 1:
+		path, rest, err := tree.ReadUpdatePath(r.Buf)
+		if err != nil {
+			return nil, err
+		}
+		c.Path, r.Buf = path, rest
+	default:
+		return nil, fmt.Errorf("invalid optional marker %d", present)
+	}
+	return c, nil
+}
+
+func encodeExtensions(w *tls.Writer, extensions []tree.Extension) error {
+	return w.Vector(func(w *tls.Writer) error {
+		for _, ext := range extensions {
+			w.Uint16(ext.Type)
+			if err := w.Opaque(ext.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodeExtensions(r *tls.Reader) ([]tree.Extension, error) {
+	var extensions []tree.Extension
+	seen := make(map[uint16]bool)
+	err := r.Vector(func(r *tls.Reader) error {
+		kind, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if seen[kind] {
+			return fmt.Errorf("duplicate extension type 0x%04x", kind)
+		}
+		seen[kind] = true
+		data, err := r.Opaque()
+		if err != nil {
+			return err
+		}
+		extensions = append(extensions, tree.Extension{Type: kind, Data: data})
+		return nil
+	})
+	return extensions, err
+}
@@ -0,0 +1,205 @@
+// Package tls encodes and decodes values in the TLS presentation language used by
+// RFC 9420, with the MLS variable-length integers of section 2.1.2 for vector lengths.
+// Every package writing MLS structures shares it, so they agree on one encoding
+package tls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned when the data ends before the value being read
+var ErrTruncated = errors.New("truncated TLS-encoded data")
+
+// Writer encodes values in the TLS presentation language
+// Buf holds the encoding so far; callers may append raw bytes to it
+type Writer struct {
+	Buf []byte
+}
+
+// Uint8 writes an 8-bit unsigned integer
+func (w *Writer) Uint8(v uint8) {
+	w.Buf = append(w.Buf, v)
+}
+
+// Uint16 writes a 16-bit unsigned integer
+func (w *Writer) Uint16(v uint16) {
+	w.Buf = binary.BigEndian.AppendUint16(w.Buf, v)
+}
+
+// Uint32 writes a 32-bit unsigned integer
+func (w *Writer) Uint32(v uint32) {
+	w.Buf = binary.BigEndian.AppendUint32(w.Buf, v)
+}
+
+// Uint64 writes a 64-bit unsigned integer
+func (w *Writer) Uint64(v uint64) {
+	w.Buf = binary.BigEndian.AppendUint64(w.Buf, v)
+}
+
+// Varint writes an MLS variable-length integer, failing for values of 2^30 and above
+func (w *Writer) Varint(v uint64) error {
+	switch {
+	case v < 1<<6:
+		w.Buf = append(w.Buf, byte(v))
+	case v < 1<<14:
+		w.Buf = binary.BigEndian.AppendUint16(w.Buf, 0x4000|uint16(v))
+	case v < 1<<30:
+		w.Buf = binary.BigEndian.AppendUint32(w.Buf, 0x80000000|uint32(v))
+	default:
+		return fmt.Errorf("length %d exceeds the MLS varint range", v)
+	}
+	return nil
+}
+
+// Opaque writes a variable-length byte vector
+func (w *Writer) Opaque(b []byte) error {
+	if err := w.Varint(uint64(len(b))); err != nil {
+		return err
+	}
+	w.Buf = append(w.Buf, b...)
+	return nil
+}
+
+// Vector writes the elements produced by body behind a varint byte length
+func (w *Writer) Vector(body func(w *Writer) error) error {
+	inner := &Writer{}
+	if err := body(inner); err != nil {
+		return err
+	}
+	return w.Opaque(inner.Buf)
+}
+
+// Uint16s writes a vector of uint16 values
+func (w *Writer) Uint16s(values []uint16) error {
+	return w.Vector(func(w *Writer) error {
+		for _, v := range values {
+			w.Uint16(v)
+		}
+		return nil
+	})
+}
+
+// Reader decodes values written by Writer
+// Buf holds the data not read yet
+type Reader struct {
+	Buf []byte
+}
+
+// Take returns the next n bytes, which share memory with Buf
+func (r *Reader) Take(n int) ([]byte, error) {
+	if n < 0 || len(r.Buf) < n {
+		return nil, ErrTruncated
+	}
+	b := r.Buf[:n]
+	r.Buf = r.Buf[n:]
+	return b, nil
+}
+
+// Uint8 reads an 8-bit unsigned integer
+func (r *Reader) Uint8() (uint8, error) {
+	b, err := r.Take(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Uint16 reads a 16-bit unsigned integer
+func (r *Reader) Uint16() (uint16, error) {
+	b, err := r.Take(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// Uint32 reads a 32-bit unsigned integer
+func (r *Reader) Uint32() (uint32, error) {
+	b, err := r.Take(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// Uint64 reads a 64-bit unsigned integer
+func (r *Reader) Uint64() (uint64, error) {
+	b, err := r.Take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Varint reads an MLS variable-length integer, rejecting non-minimal encodings
+func (r *Reader) Varint() (uint64, error) {
+	if len(r.Buf) == 0 {
+		return 0, ErrTruncated
+	}
+	var v uint64
+	var min uint64
+	switch r.Buf[0] >> 6 {
+	case 0:
+		b, _ := r.Take(1)
+		return uint64(b[0]), nil
+	case 1:
+		b, err := r.Take(2)
+		if err != nil {
+			return 0, err
+		}
+		v, min = uint64(binary.BigEndian.Uint16(b)&0x3fff), 1<<6
+	case 2:
+		b, err := r.Take(4)
+		if err != nil {
+			return 0, err
+		}
+		v, min = uint64(binary.BigEndian.Uint32(b)&0x3fffffff), 1<<14
+	default:
+		return 0, errors.New("invalid MLS varint prefix")
+	}
+	if v < min {
+		return 0, errors.New("non-minimal MLS varint encoding")
+	}
+	return v, nil
+}
+
+// Opaque reads a variable-length byte vector into a copy
+func (r *Reader) Opaque() ([]byte, error) {
+	n, err := r.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.Buf)) {
+		return nil, ErrTruncated
+	}
+	b, _ := r.Take(int(n))
+	return append([]byte(nil), b...), nil
+}
+
+// Vector reads a varint-length vector and decodes its elements with item until it is consumed
+func (r *Reader) Vector(item func(r *Reader) error) error {
+	body, err := r.Opaque()
+	if err != nil {
+		return err
+	}
+	inner := &Reader{Buf: body}
+	for len(inner.Buf) > 0 {
+		if err := item(inner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Uint16s reads a vector of uint16 values
+func (r *Reader) Uint16s() ([]uint16, error) {
+	var values []uint16
+	err := r.Vector(func(r *Reader) error {
+		v, err := r.Uint16()
+		values = append(values, v)
+		return err
+	})
+	return values, err
+}
@@ -0,0 +1,54 @@
+package tls
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1} {
+		w := &Writer{}
+		if err := w.Varint(v); err != nil {
+			t.Fatalf("failed to write %d: %v", v, err)
+		}
+		got, err := (&Reader{Buf: w.Buf}).Varint()
+		if err != nil || got != v {
+			t.Errorf("varint %d decoded as %d (%v)", v, got, err)
+		}
+	}
+	if err := (&Writer{}).Varint(1 << 30); err == nil {
+		t.Errorf("expected an error for a value beyond the varint range")
+	}
+	if _, err := (&Reader{Buf: []byte{0x40, 0x25}}).Varint(); err == nil {
+		t.Errorf("expected an error for a non-minimal varint")
+	}
+	if _, err := (&Reader{Buf: []byte{0xc0}}).Varint(); err == nil {
+		t.Errorf("expected an error for the reserved prefix")
+	}
+}
+
+func TestVectors(t *testing.T) {
+	w := &Writer{}
+	w.Opaque([]byte("payload"))
+	w.Uint16s([]uint16{1, 2, 0xffff})
+	w.Uint64(42)
+
+	r := &Reader{Buf: w.Buf}
+	payload, err := r.Opaque()
+	if err != nil || !bytes.Equal(payload, []byte("payload")) {
+		t.Fatalf("opaque decoded as %q (%v)", payload, err)
+	}
+	values, err := r.Uint16s()
+	if err != nil || len(values) != 3 || values[2] != 0xffff {
+		t.Fatalf("uint16s decoded as %v (%v)", values, err)
+	}
+	if v, err := r.Uint64(); err != nil || v != 42 || len(r.Buf) != 0 {
+		t.Fatalf("uint64 decoded as %d (%v), %d bytes left", v, err, len(r.Buf))
+	}
+
+	// A length running past the data is truncated, not a short read
+	if _, err := (&Reader{Buf: []byte{0x05, 'a'}}).Opaque(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+}
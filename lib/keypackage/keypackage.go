@@ -0,0 +1,287 @@
+// Package keypackage builds and validates MLS KeyPackages (RFC 9420 section 10)
+//
+// A KeyPackage is what a client publishes so others can add it to a group: an HPKE
+// init key, the leaf node it will occupy and a signature over both made with the
+// credential's signature key. Trees admit members from a validated KeyPackage
+// through tree.InsertFromKeyPackage, which only sees the narrow tree.KeyPackage
+// interface implemented here.
+package keypackage
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// defaultLifetime is how long a generated KeyPackage stays valid without WithLifetime
+const defaultLifetime = 90 * 24 * time.Hour
+
+var (
+	// ErrInvalidSignature is returned when a leaf node or KeyPackage signature does not verify
+	ErrInvalidSignature = tree.ErrInvalidSignature
+	// ErrOutsideLifetime is returned when a KeyPackage is used before or after its lifetime
+	ErrOutsideLifetime = errors.New("key package is outside its lifetime")
+)
+
+// KeyPackage is a signed offer to join a group
+type KeyPackage struct {
+	Version     uint16
+	CipherSuite tree.Ciphersuite
+	InitKey     []byte
+	LeafNode    tree.LeafNode
+	Extensions  []tree.Extension
+	Signature   []byte
+}
+
+// PrivateKeys are the secrets a client keeps for a KeyPackage it published
+type PrivateKeys struct {
+	InitKey       *ecdh.PrivateKey // decrypts the Welcome
+	EncryptionKey *ecdh.PrivateKey // private key of the leaf node
+}
+
+type config struct {
+	lifetime       time.Duration
+	extensions     []tree.Extension
+	leafExtensions []tree.Extension
+	credential     *tree.Credential
+}
+
+// Option configures Generate
+type Option func(*config)
+
+// WithLifetime sets how long the KeyPackage is valid from now
+func WithLifetime(d time.Duration) Option {
+	return func(c *config) {
+		c.lifetime = d
+	}
+}
+
+// WithExtensions adds KeyPackage extensions
+func WithExtensions(extensions ...tree.Extension) Option {
+	return func(c *config) {
+		c.extensions = append(c.extensions, extensions...)
+	}
+}
+
+// WithLeafExtensions adds leaf node extensions
+func WithLeafExtensions(extensions ...tree.Extension) Option {
+	return func(c *config) {
+		c.leafExtensions = append(c.leafExtensions, extensions...)
+	}
+}
+
+// WithCredential replaces the basic credential built from the identity, typically with
+// an X.509 chain whose leaf certificate holds the signer's public key
+func WithCredential(cred tree.Credential) Option {
+	return func(c *config) {
+		c.credential = &cred
+	}
+}
+
+// kemCurve returns the DHKEM curve of the ciphersuite
+func kemCurve(cs tree.Ciphersuite) (ecdh.Curve, error) {
+	switch cs.KeyAlgorithm() {
+	case tree.KeyAlgorithmX25519:
+		return ecdh.X25519(), nil
+	case tree.KeyAlgorithmP256:
+		return ecdh.P256(), nil
+	}
+	return nil, fmt.Errorf("unsupported ciphersuite 0x%04x", uint16(cs))
+}
+
+// GenerateSignatureKey creates a signature key of the ciphersuite's signature scheme
+func GenerateSignatureKey(cs tree.Ciphersuite) (crypto.Signer, error) {
+	switch cs.SignatureAlgorithm() {
+	case tree.KeyAlgorithmEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case tree.KeyAlgorithmP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported ciphersuite 0x%04x", uint16(cs))
+}
+
+// Generate creates a signed KeyPackage for identity with fresh init and encryption keys
+// signer must be a key of the ciphersuite's signature scheme, see GenerateSignatureKey.
+// The leaf carries a basic credential naming identity unless WithCredential is given
+func Generate(cs tree.Ciphersuite, identity []byte, signer crypto.Signer, opts ...Option) (*KeyPackage, *PrivateKeys, error) {
+	cfg := config{lifetime: defaultLifetime}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	curve, err := kemCurve(cs)
+	if err != nil {
+		return nil, nil, err
+	}
+	signatureKey, err := signaturePublicKey(cs, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	initKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate init key: %w", err)
+	}
+	encryptionKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+
+	credential := tree.Credential{Type: tree.CredentialBasic, Identity: identity}
+	if cfg.credential != nil {
+		credential = *cfg.credential
+	}
+
+	now := time.Now()
+	kp := &KeyPackage{
+		Version:     tree.ProtocolVersionMLS10,
+		CipherSuite: cs,
+		InitKey:     initKey.PublicKey().Bytes(),
+		LeafNode: tree.LeafNode{
+			EncryptionKey: encryptionKey.PublicKey().Bytes(),
+			SignatureKey:  signatureKey,
+			Credential:    credential,
+			Capabilities: tree.Capabilities{
+				Versions:     []uint16{tree.ProtocolVersionMLS10},
+				CipherSuites: []uint16{uint16(cs)},
+				Credentials:  []uint16{uint16(tree.CredentialBasic), uint16(tree.CredentialX509)},
+			},
+			Source:     tree.LeafNodeSourceKeyPackage,
+			Lifetime:   tree.Lifetime{NotBefore: uint64(now.Unix()), NotAfter: uint64(now.Add(cfg.lifetime).Unix())},
+			Extensions: cfg.leafExtensions,
+		},
+		Extensions: cfg.extensions,
+	}
+	if err := kp.Sign(signer); err != nil {
+		return nil, nil, err
+	}
+	return kp, &PrivateKeys{InitKey: initKey, EncryptionKey: encryptionKey}, nil
+}
+
+// Sign signs the leaf node and then the KeyPackage with signer
+// It must be called again after any field changes
+func (kp *KeyPackage) Sign(signer crypto.Signer) error {
+	if err := kp.LeafNode.Sign(signer, nil, 0); err != nil {
+		return err
+	}
+	tbs, err := kp.marshalTBS()
+	if err != nil {
+		return err
+	}
+	if kp.Signature, err = tree.SignWithLabel(signer, "KeyPackageTBS", tbs); err != nil {
+		return fmt.Errorf("failed to sign key package: %w", err)
+	}
+	return nil
+}
+
+// Validate performs the checks of RFC 9420 section 10.1 at time now
+// cs is the group ciphersuite; zero accepts the KeyPackage's own ciphersuite
+func (kp *KeyPackage) Validate(cs tree.Ciphersuite, now time.Time) error {
+	if kp.Version != tree.ProtocolVersionMLS10 {
+		return fmt.Errorf("unsupported protocol version %d", kp.Version)
+	}
+	if cs != 0 && kp.CipherSuite != cs {
+		return fmt.Errorf("key package ciphersuite 0x%04x in a 0x%04x group: %w", uint16(kp.CipherSuite), uint16(cs), tree.ErrKeyAlgorithmMismatch)
+	}
+	alg := kp.CipherSuite.KeyAlgorithm()
+	if alg == tree.KeyAlgorithmUnknown {
+		return fmt.Errorf("unsupported ciphersuite 0x%04x", uint16(kp.CipherSuite))
+	}
+	if err := checkRawKey(alg, kp.InitKey); err != nil {
+		return fmt.Errorf("init key: %w", err)
+	}
+
+	leaf := &kp.LeafNode
+	if leaf.Source != tree.LeafNodeSourceKeyPackage {
+		return fmt.Errorf("leaf node source %d in a key package", leaf.Source)
+	}
+	if err := leaf.Validate(kp.CipherSuite); err != nil {
+		return fmt.Errorf("leaf node: %w", err)
+	}
+	if !leaf.Lifetime.Contains(now) {
+		return ErrOutsideLifetime
+	}
+	if string(kp.InitKey) == string(leaf.EncryptionKey) {
+		return errors.New("init key equals the leaf encryption key")
+	}
+
+	if err := leaf.VerifySignature(kp.CipherSuite, nil, 0); err != nil {
+		return fmt.Errorf("leaf node: %w", err)
+	}
+	tbs, err := kp.marshalTBS()
+	if err != nil {
+		return err
+	}
+	if err := tree.VerifyWithLabel(kp.CipherSuite, leaf.SignatureKey, "KeyPackageTBS", tbs, kp.Signature); err != nil {
+		return fmt.Errorf("key package: %w", err)
+	}
+	return nil
+}
+
+// Identity returns the credential identity, used as the leaf name by the tree
+func (kp *KeyPackage) Identity() string {
+	return kp.LeafNode.Identity()
+}
+
+// Leaf returns the leaf node the member will occupy
+func (kp *KeyPackage) Leaf() *tree.LeafNode {
+	return &kp.LeafNode
+}
+
+// EncryptionKey returns the leaf's HPKE key tagged with the ciphersuite's KEM
+func (kp *KeyPackage) EncryptionKey() tree.PublicKey {
+	return tree.PublicKey{Algorithm: kp.CipherSuite.KeyAlgorithm(), Encoding: tree.KeyEncodingRaw, Data: kp.LeafNode.EncryptionKey}
+}
+
+// Ref returns the KeyPackageRef identifying the KeyPackage (RFC 9420 section 5.2)
+func (kp *KeyPackage) Ref() ([]byte, error) {
+	encoded, err := kp.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	w := &tls.Writer{}
+	w.Opaque([]byte("MLS 1.0 KeyPackage Reference"))
+	if err := w.Opaque(encoded); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(w.Buf)
+	return sum[:], nil
+}
+
+// checkRawKey validates a KEM public key in its raw wire encoding
+func checkRawKey(alg tree.KeyAlgorithm, data []byte) error {
+	key, err := tree.ParsePublicKey(alg, data)
+	if err != nil {
+		return err
+	}
+	if key.Encoding != tree.KeyEncodingRaw {
+		return fmt.Errorf("%s key is %s encoded, want raw", alg, key.Encoding)
+	}
+	return nil
+}
+
+// signaturePublicKey returns the wire encoding of signer's public key
+// and checks it belongs to the ciphersuite's signature scheme
+func signaturePublicKey(cs tree.Ciphersuite, signer crypto.Signer) ([]byte, error) {
+	ok := false
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		ok = cs.SignatureAlgorithm() == tree.KeyAlgorithmEd25519
+	case *ecdsa.PublicKey:
+		ok = cs.SignatureAlgorithm() == tree.KeyAlgorithmP256 && pub.Curve == elliptic.P256()
+	}
+	if !ok {
+		return nil, fmt.Errorf("%T signer for ciphersuite 0x%04x: %w", signer.Public(), uint16(cs), tree.ErrKeyAlgorithmMismatch)
+	}
+	return tree.SignaturePublicKey(signer)
+}
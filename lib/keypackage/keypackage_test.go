@@ -0,0 +1,202 @@
+package keypackage
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func generate(t *testing.T, cs tree.Ciphersuite, identity string, opts ...Option) *KeyPackage {
+	t.Helper()
+	signer, err := GenerateSignatureKey(cs)
+	if err != nil {
+		t.Fatalf("Failed to generate signature key: %v", err)
+	}
+	kp, _, err := Generate(cs, []byte(identity), signer, opts...)
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	return kp
+}
+
+func TestGenerateValidateRoundTrip(t *testing.T) {
+	for _, cs := range []tree.Ciphersuite{
+		tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519,
+		tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256,
+	} {
+		kp := generate(t, cs, "alice", WithExtensions(tree.Extension{Type: 0xff00, Data: []byte("x")}))
+		if err := kp.Validate(cs, time.Now()); err != nil {
+			t.Fatalf("0x%04x: fresh key package should validate: %v", uint16(cs), err)
+		}
+
+		encoded, err := kp.Marshal()
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		decoded, err := Unmarshal(encoded)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if err := decoded.Validate(0, time.Now()); err != nil {
+			t.Errorf("0x%04x: decoded key package should validate: %v", uint16(cs), err)
+		}
+		reencoded, _ := decoded.Marshal()
+		if !bytes.Equal(encoded, reencoded) {
+			t.Errorf("0x%04x: re-encoding changed the key package", uint16(cs))
+		}
+		if _, err := Unmarshal(append(encoded, 0)); err == nil {
+			t.Errorf("trailing bytes should be rejected")
+		}
+
+		ref, _ := kp.Ref()
+		otherRef, _ := generate(t, cs, "alice").Ref()
+		if len(ref) != 32 || bytes.Equal(ref, otherRef) {
+			t.Errorf("refs should be 32 byte hashes unique per key package")
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	cases := []struct {
+		name   string
+		mutate func(kp *KeyPackage)
+		now    time.Time
+		want   error
+	}{
+		{name: "tampered identity", mutate: func(kp *KeyPackage) { kp.LeafNode.Credential.Identity = []byte("mallory") }, want: ErrInvalidSignature},
+		{name: "tampered extensions", mutate: func(kp *KeyPackage) { kp.Extensions = []tree.Extension{{Type: 1}} }, want: ErrInvalidSignature},
+		{name: "expired", now: time.Now().Add(91 * 24 * time.Hour), want: ErrOutsideLifetime},
+		{name: "not yet valid", now: time.Now().Add(-time.Hour), want: ErrOutsideLifetime},
+		{name: "init key reuse", mutate: func(kp *KeyPackage) { kp.InitKey = kp.LeafNode.EncryptionKey }},
+		{name: "bad init key", mutate: func(kp *KeyPackage) { kp.InitKey = []byte("short") }},
+		{name: "wrong version", mutate: func(kp *KeyPackage) { kp.Version = 2 }},
+	}
+	for _, c := range cases {
+		kp := generate(t, cs, "alice")
+		if c.mutate != nil {
+			c.mutate(kp)
+		}
+		now := c.now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		err := kp.Validate(cs, now)
+		if err == nil {
+			t.Errorf("%s: should be rejected", c.name)
+			continue
+		}
+		if c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	kp := generate(t, cs, "alice")
+	if err := kp.Validate(tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256, time.Now()); !errors.Is(err, tree.ErrKeyAlgorithmMismatch) {
+		t.Errorf("ciphersuite mismatch should be rejected, got %v", err)
+	}
+
+	signer, _ := GenerateSignatureKey(tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256)
+	if _, _, err := Generate(cs, []byte("alice"), signer); !errors.Is(err, tree.ErrKeyAlgorithmMismatch) {
+		t.Errorf("P-256 signer in an Ed25519 suite should be rejected, got %v", err)
+	}
+}
+
+func TestInsertFromKeyPackage(t *testing.T) {
+	cs := tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs))
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := group.InsertFromKeyPackage(generate(t, cs, user)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	bob, ok := group.Find("bob")
+	if !ok || bob.PublicKey().Algorithm != tree.KeyAlgorithmP256 || bob.PublicKey().Encoding != tree.KeyEncodingRaw {
+		t.Fatalf("bob should hold a raw P-256 key, got %+v", bob)
+	}
+
+	forged := generate(t, cs, "david")
+	forged.LeafNode.Credential.Identity = []byte("eve")
+	if err := group.InsertFromKeyPackage(forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged key package should be rejected, got %v", err)
+	}
+	other := generate(t, tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, "frank")
+	if err := group.InsertFromKeyPackage(other); err == nil {
+		t.Errorf("key package of another ciphersuite should be rejected")
+	}
+	if got := len(group.GetLeaves()); got != 3 {
+		t.Errorf("rejected key packages should not add leaves, have %d", got)
+	}
+}
+
+func TestX509Credential(t *testing.T) {
+	cs := tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "members ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	signer, _ := GenerateSignatureKey(cs)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "carol"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, signer.Public(), caKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	credential := tree.Credential{Type: tree.CredentialX509, Certificates: [][]byte{leafDER, caDER}}
+
+	kp, _, err := Generate(cs, nil, signer, WithCredential(credential))
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	encoded, _ := kp.Marshal()
+	decoded, err := Unmarshal(encoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithAuthenticationHook(tree.VerifyX509Chain(roots)))
+	if err := group.InsertFromKeyPackage(decoded); err != nil {
+		t.Fatalf("key package with a trusted chain should be admitted: %v", err)
+	}
+	if _, ok := group.Find("carol"); !ok {
+		t.Errorf("leaf should be named after the certificate common name")
+	}
+	if err := group.InsertFromKeyPackage(generate(t, cs, "dave")); !errors.Is(err, tree.ErrCredentialRejected) {
+		t.Errorf("basic credential should be rejected by the x509 hook, got %v", err)
+	}
+
+	// A chain for another key cannot be attached to this signer
+	other, _ := GenerateSignatureKey(cs)
+	mismatched, _, err := Generate(cs, nil, other, WithCredential(credential))
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	if err := mismatched.Validate(cs, time.Now()); err == nil {
+		t.Errorf("certificate for another key should not validate")
+	}
+}
@@ -0,0 +1,199 @@
+package keypackage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ExtensionTypeLastResort marks a KeyPackage that may be handed out more than once, used
+// when a client's regular packages run out (last_resort of the MLS extensions draft)
+const ExtensionTypeLastResort uint16 = 0x000a
+
+var (
+	// ErrPoolEmpty is returned when a client has no KeyPackage left, not even a last resort one
+	ErrPoolEmpty = errors.New("no key package available")
+	// ErrDuplicateKeyPackage is returned when a KeyPackage is published twice
+	ErrDuplicateKeyPackage = errors.New("key package already published")
+)
+
+// WithLastResort marks the generated KeyPackage as the client's last resort package
+func WithLastResort() Option {
+	return WithExtensions(tree.Extension{Type: ExtensionTypeLastResort})
+}
+
+// IsLastResort reports whether the KeyPackage carries the last_resort extension
+func (kp *KeyPackage) IsLastResort() bool {
+	for _, ext := range kp.Extensions {
+		if ext.Type == ExtensionTypeLastResort {
+			return true
+		}
+	}
+	return false
+}
+
+// PoolStats counts what happened to the packages of a Pool
+type PoolStats struct {
+	Published  uint64 // packages accepted by Publish
+	Consumed   uint64 // one-time packages handed out
+	LastResort uint64 // times a last resort package was handed out instead
+	Expired    uint64 // packages dropped because their lifetime ended
+	Depleted   uint64 // Consume calls that found nothing, see ErrPoolEmpty
+}
+
+// PoolOption configures NewPool
+type PoolOption func(*Pool)
+
+// WithLowWatermark calls notify whenever a Consume leaves a client with fewer than n
+// one-time packages, so the client can be asked to publish more. notify runs with the
+// pool locked and must not call back into it
+func WithLowWatermark(n int, notify func(identity string, remaining int)) PoolOption {
+	return func(p *Pool) {
+		p.lowWatermark = n
+		p.notify = notify
+	}
+}
+
+// WithPoolClock replaces time.Now for lifetime checks
+func WithPoolClock(now func() time.Time) PoolOption {
+	return func(p *Pool) {
+		p.now = now
+	}
+}
+
+// Pool is the server side store clients pre-publish KeyPackages to, keyed by identity
+// Each one-time package is handed out once, oldest first; when none is left the client's
+// last resort package is returned and kept. A Pool is safe for concurrent use
+type Pool struct {
+	cs           tree.Ciphersuite
+	now          func() time.Time
+	lowWatermark int
+	notify       func(identity string, remaining int)
+
+	mu         sync.Mutex
+	packages   map[string][]*KeyPackage // one-time packages per identity, in publication order
+	lastResort map[string]*KeyPackage
+	refs       map[string]bool // refs of every package held
+	stats      PoolStats
+}
+
+// NewPool creates a pool accepting KeyPackages of ciphersuite cs, zero accepts any
+func NewPool(cs tree.Ciphersuite, opts ...PoolOption) *Pool {
+	p := &Pool{
+		cs:         cs,
+		now:        time.Now,
+		packages:   make(map[string][]*KeyPackage),
+		lastResort: make(map[string]*KeyPackage),
+		refs:       make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Publish validates kp and adds it to its client's packages
+// A last resort package replaces the client's previous one
+func (p *Pool) Publish(kp *KeyPackage) error {
+	if err := kp.Validate(p.cs, p.now()); err != nil {
+		return fmt.Errorf("failed to publish key package: %w", err)
+	}
+	ref, err := kp.Ref()
+	if err != nil {
+		return fmt.Errorf("failed to publish key package: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs[string(ref)] {
+		return ErrDuplicateKeyPackage
+	}
+	identity := kp.Identity()
+	if kp.IsLastResort() {
+		if previous := p.lastResort[identity]; previous != nil {
+			p.forget(previous)
+		}
+		p.lastResort[identity] = kp
+	} else {
+		p.packages[identity] = append(p.packages[identity], kp)
+	}
+	p.refs[string(ref)] = true
+	p.stats.Published++
+	return nil
+}
+
+// Consume atomically takes a KeyPackage of identity for an Add
+// Expired packages are dropped on the way; ErrPoolEmpty is returned when neither a
+// one-time nor a last resort package is valid
+func (p *Pool) Consume(identity string) (*KeyPackage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	queue := p.packages[identity]
+	for len(queue) > 0 {
+		kp := queue[0]
+		queue = queue[1:]
+		p.forget(kp)
+		if !kp.LeafNode.Lifetime.Contains(now) {
+			p.stats.Expired++
+			continue
+		}
+		p.store(identity, queue)
+		p.stats.Consumed++
+		if len(queue) < p.lowWatermark && p.notify != nil {
+			p.notify(identity, len(queue))
+		}
+		return kp, nil
+	}
+	p.store(identity, nil)
+
+	if kp := p.lastResort[identity]; kp != nil {
+		if kp.LeafNode.Lifetime.Contains(now) {
+			p.stats.LastResort++
+			if p.lowWatermark > 0 && p.notify != nil {
+				p.notify(identity, 0)
+			}
+			return kp, nil
+		}
+		p.forget(kp)
+		delete(p.lastResort, identity)
+		p.stats.Expired++
+	}
+	p.stats.Depleted++
+	return nil, fmt.Errorf("%w for %s", ErrPoolEmpty, identity)
+}
+
+// Available returns how many one-time packages identity has left and whether it has a
+// last resort package. Expired packages are counted until Consume drops them
+func (p *Pool) Available(identity string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.packages[identity]), p.lastResort[identity] != nil
+}
+
+// Stats returns the pool counters
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// store keeps the remaining queue of identity, dropping empty queues
+func (p *Pool) store(identity string, queue []*KeyPackage) {
+	if len(queue) == 0 {
+		delete(p.packages, identity)
+		return
+	}
+	p.packages[identity] = queue
+}
+
+// forget releases the ref of a package leaving the pool
+func (p *Pool) forget(kp *KeyPackage) {
+	if ref, err := kp.Ref(); err == nil {
+		delete(p.refs, string(ref))
+	}
+}
@@ -0,0 +1,108 @@
+package keypackage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestPool(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	now := time.Now()
+	var low []int
+	pool := NewPool(cs, WithPoolClock(func() time.Time { return now }), WithLowWatermark(2, func(identity string, remaining int) {
+		low = append(low, remaining)
+	}))
+
+	short := generate(t, cs, "alice", WithLifetime(time.Minute))
+	first := generate(t, cs, "alice")
+	second := generate(t, cs, "alice")
+	fallback := generate(t, cs, "alice", WithLastResort())
+	// Lifetimes have second precision; start the clock after the packages begin
+	now = time.Now().Add(time.Second)
+	for _, kp := range []*KeyPackage{short, first, second, fallback} {
+		if err := pool.Publish(kp); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	if !fallback.IsLastResort() || first.IsLastResort() {
+		t.Errorf("only packages generated WithLastResort are last resort")
+	}
+	if err := pool.Publish(first); !errors.Is(err, ErrDuplicateKeyPackage) {
+		t.Errorf("republishing should fail with ErrDuplicateKeyPackage, got %v", err)
+	}
+	if err := pool.Publish(generate(t, tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256, "alice")); err == nil {
+		t.Errorf("packages of another ciphersuite should be rejected")
+	}
+	if n, lastResort := pool.Available("alice"); n != 3 || !lastResort {
+		t.Errorf("alice should have 3 one-time packages and a last resort, got %d %v", n, lastResort)
+	}
+
+	// The short lived package has expired by the time it is consumed
+	now = now.Add(time.Hour)
+	for _, want := range []*KeyPackage{first, second, fallback, fallback} {
+		got, err := pool.Consume("alice")
+		if err != nil {
+			t.Fatalf("Failed to consume: %v", err)
+		}
+		if got != want {
+			t.Errorf("packages should be handed out oldest first, then the last resort")
+		}
+	}
+	if _, err := pool.Consume("bob"); !errors.Is(err, ErrPoolEmpty) {
+		t.Errorf("bob published nothing, expected ErrPoolEmpty, got %v", err)
+	}
+	want := PoolStats{Published: 4, Consumed: 2, LastResort: 2, Expired: 1, Depleted: 1}
+	if stats := pool.Stats(); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if len(low) != 4 || low[0] != 1 || low[1] != 0 {
+		t.Errorf("low watermark should fire below 2 packages, got %v", low)
+	}
+
+	// A newer last resort package replaces the old one, which may be published again later
+	replacement := generate(t, cs, "alice", WithLastResort())
+	if err := pool.Publish(replacement); err != nil {
+		t.Fatalf("Failed to publish replacement: %v", err)
+	}
+	if got, _ := pool.Consume("alice"); got != replacement {
+		t.Errorf("the newest last resort package should be handed out")
+	}
+}
+
+func TestPoolConcurrentConsume(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	pool := NewPool(cs)
+	for i := 0; i < 8; i++ {
+		if err := pool.Publish(generate(t, cs, "alice")); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	seen := make(map[*KeyPackage]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kp, err := pool.Consume("alice")
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[kp] {
+				t.Errorf("a one-time package was handed out twice")
+			}
+			seen[kp] = true
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 8 || pool.Stats().Depleted != 8 {
+		t.Errorf("8 packages for 16 adds should leave 8 depleted, got %d handed out, %+v", len(seen), pool.Stats())
+	}
+}
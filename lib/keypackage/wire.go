@@ -0,0 +1,127 @@
+package keypackage
+
+import (
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Marshal encodes the KeyPackage in its RFC 9420 wire format
+func (kp *KeyPackage) Marshal() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := kp.encodeTBS(w); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(kp.Signature); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// Unmarshal decodes a KeyPackage written by Marshal
+// The result is not validated, call Validate before trusting it
+func Unmarshal(data []byte) (*KeyPackage, error) {
+	r := &tls.Reader{Buf: data}
+	kp := &KeyPackage{}
+	if err := kp.decode(r); err != nil {
+		return nil, fmt.Errorf("failed to decode key package: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after key package", len(r.Buf))
+	}
+	return kp, nil
+}
+
+// Read decodes the KeyPackage at the start of data and returns the bytes after it
+// Structures embedding a KeyPackage, such as Add proposals, decode it this way
+func Read(data []byte) (*KeyPackage, []byte, error) {
+	r := &tls.Reader{Buf: data}
+	kp := &KeyPackage{}
+	if err := kp.decode(r); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode key package: %w", err)
+	}
+	return kp, r.Buf, nil
+}
+
+// marshalTBS encodes KeyPackageTBS, the signed part of the KeyPackage
+func (kp *KeyPackage) marshalTBS() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := kp.encodeTBS(w); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+func (kp *KeyPackage) encodeTBS(w *tls.Writer) error {
+	w.Uint16(kp.Version)
+	w.Uint16(uint16(kp.CipherSuite))
+	if err := w.Opaque(kp.InitKey); err != nil {
+		return err
+	}
+	leaf, err := kp.LeafNode.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	w.Buf = append(w.Buf, leaf...)
+	return encodeExtensions(w, kp.Extensions)
+}
+
+func (kp *KeyPackage) decode(r *tls.Reader) error {
+	var err error
+	if kp.Version, err = r.Uint16(); err != nil {
+		return err
+	}
+	suite, err := r.Uint16()
+	if err != nil {
+		return err
+	}
+	kp.CipherSuite = tree.Ciphersuite(suite)
+	if kp.InitKey, err = r.Opaque(); err != nil {
+		return err
+	}
+	leaf, rest, err := tree.ReadLeafNode(r.Buf)
+	if err != nil {
+		return err
+	}
+	kp.LeafNode, r.Buf = *leaf, rest
+	if kp.Extensions, err = decodeExtensions(r); err != nil {
+		return err
+	}
+	kp.Signature, err = r.Opaque()
+	return err
+}
+
+func encodeExtensions(w *tls.Writer, extensions []tree.Extension) error {
+	return w.Vector(func(w *tls.Writer) error {
+		for _, ext := range extensions {
+			w.Uint16(ext.Type)
+			if err := w.Opaque(ext.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodeExtensions(r *tls.Reader) ([]tree.Extension, error) {
+	var extensions []tree.Extension
+	seen := make(map[uint16]bool)
+	err := r.Vector(func(r *tls.Reader) error {
+		kind, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if seen[kind] {
+			return fmt.Errorf("duplicate extension type 0x%04x", kind)
+		}
+		seen[kind] = true
+		data, err := r.Opaque()
+		if err != nil {
+			return err
+		}
+		extensions = append(extensions, tree.Extension{Type: kind, Data: data})
+		return nil
+	})
+	return extensions, err
+}
@@ -0,0 +1,193 @@
+// Package receipt issues signed statements of the membership changes applied to a tree
+package receipt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Receipt records what change the server claims to have applied to a group, and the
+// epoch that change started
+// The epoch is identified by the fields of its GroupContext: group ID, epoch number, tree
+// hash and the confirmed transcript hash of the commit that started it, so a member can
+// check a receipt against its own view of the group with Check
+type Receipt struct {
+	GroupID        []byte    `json:"group_id,omitempty"`
+	Epoch          uint64    `json:"epoch"`
+	TreeHash       []byte    `json:"tree_hash"`                           // GroupContext tree_hash after the change, as computed by tree.Tree.TreeHash
+	TranscriptHash []byte    `json:"confirmed_transcript_hash,omitempty"` // of the commit, when the group tracks one
+	Op             string    `json:"op"`                                  // operation summary, e.g. "add alice"
+	IssuedAt       time.Time `json:"issued_at"`
+	Signature      []byte    `json:"signature"`
+}
+
+// signedContent returns the bytes covered by the receipt signature
+func (r *Receipt) signedContent() []byte {
+	buf := []byte("TreeKEM-change-receipt-v1")
+	appendBytes := func(b []byte) {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+		buf = append(buf, b...)
+	}
+	appendBytes(r.GroupID)
+	buf = binary.BigEndian.AppendUint64(buf, r.Epoch)
+	appendBytes(r.TreeHash)
+	appendBytes(r.TranscriptHash)
+	appendBytes([]byte(r.Op))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(r.IssuedAt.UnixNano()))
+	return buf
+}
+
+// Verify checks the receipt signature against the issuer's public key
+func (r *Receipt) Verify(publicKey ed25519.PublicKey) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid issuer public key size: %d", len(publicKey))
+	}
+	if !ed25519.Verify(publicKey, r.signedContent(), r.Signature) {
+		return fmt.Errorf("invalid receipt signature for epoch %d", r.Epoch)
+	}
+	return nil
+}
+
+// Check reports whether the receipt describes the epoch of gc, e.g. the group context a
+// member computed after processing the commit
+func (r *Receipt) Check(gc tree.GroupContext) error {
+	switch {
+	case !bytes.Equal(r.GroupID, gc.GroupID):
+		return fmt.Errorf("receipt is for group %x, not %x", r.GroupID, gc.GroupID)
+	case r.Epoch != gc.Epoch:
+		return fmt.Errorf("receipt is for epoch %d, not %d", r.Epoch, gc.Epoch)
+	case !bytes.Equal(r.TreeHash, gc.TreeHash):
+		return fmt.Errorf("receipt tree hash does not match epoch %d", gc.Epoch)
+	case !bytes.Equal(r.TranscriptHash, gc.ConfirmedTranscriptHash):
+		return fmt.Errorf("receipt transcript hash does not match epoch %d", gc.Epoch)
+	}
+	return nil
+}
+
+// receiptKey identifies the epoch of a group
+type receiptKey struct {
+	group string
+	epoch uint64
+}
+
+// DefaultRetention is the number of receipts an Issuer keeps per group by default
+const DefaultRetention = 1024
+
+// Issuer signs receipts and keeps them retrievable by group and epoch
+// It is safe for concurrent use. Only the receipts of the most recent epochs of each
+// group are kept, see WithRetention; members fetch theirs soon after the change
+type Issuer struct {
+	privateKey ed25519.PrivateKey
+	retention  int
+
+	mu       sync.Mutex
+	receipts map[receiptKey]*Receipt
+	epochs   map[string][]uint64 // receipted epochs of each group, oldest first
+}
+
+// IssuerOption configures an Issuer
+type IssuerOption func(*Issuer)
+
+// WithRetention keeps the receipts of the last n epochs of each group, dropping the
+// oldest as new ones are issued; n below 1 keeps DefaultRetention
+func WithRetention(n int) IssuerOption {
+	return func(i *Issuer) {
+		if n > 0 {
+			i.retention = n
+		}
+	}
+}
+
+// NewIssuer creates an issuer signing with privateKey
+func NewIssuer(privateKey ed25519.PrivateKey, opts ...IssuerOption) (*Issuer, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid issuer private key size: %d", len(privateKey))
+	}
+	i := &Issuer{
+		privateKey: privateKey,
+		retention:  DefaultRetention,
+		receipts:   make(map[receiptKey]*Receipt),
+		epochs:     make(map[string][]uint64),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+// GenerateIssuer creates an issuer with a fresh Ed25519 key read from rand
+func GenerateIssuer(rand io.Reader, opts ...IssuerOption) (*Issuer, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate issuer key: %w", err)
+	}
+	return NewIssuer(privateKey, opts...)
+}
+
+// PublicKey returns the key members use to verify receipts
+func (i *Issuer) PublicKey() ed25519.PublicKey {
+	return i.privateKey.Public().(ed25519.PublicKey)
+}
+
+// Issue signs a receipt for the epoch a change just started in t
+// The group, epoch and hashes are taken from the tree's GroupContext, so call it right
+// after the change; each epoch of a group gets one receipt
+func (i *Issuer) Issue(t *tree.Tree, op string) (*Receipt, error) {
+	gc := t.GroupContext()
+	key := receiptKey{group: string(gc.GroupID), epoch: gc.Epoch}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, exists := i.receipts[key]; exists {
+		return nil, fmt.Errorf("receipt already issued for epoch %d of group %x", gc.Epoch, gc.GroupID)
+	}
+
+	r := &Receipt{
+		GroupID:        gc.GroupID,
+		Epoch:          gc.Epoch,
+		TreeHash:       gc.TreeHash,
+		TranscriptHash: gc.ConfirmedTranscriptHash,
+		Op:             op,
+		IssuedAt:       time.Now(),
+	}
+	r.Signature = ed25519.Sign(i.privateKey, r.signedContent())
+
+	i.receipts[key] = r
+	epochs := append(i.epochs[key.group], key.epoch)
+	if len(epochs) > i.retention {
+		delete(i.receipts, receiptKey{group: key.group, epoch: epochs[0]})
+		epochs = epochs[1:]
+	}
+	i.epochs[key.group] = epochs
+	return r, nil
+}
+
+// Get returns the receipt issued for an epoch of a group
+func (i *Issuer) Get(groupID []byte, epoch uint64) (*Receipt, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	r, ok := i.receipts[receiptKey{group: string(groupID), epoch: epoch}]
+	return r, ok
+}
+
+// List returns the receipts issued for a group ordered by epoch
+func (i *Issuer) List(groupID []byte) []*Receipt {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var receipts []*Receipt
+	for _, epoch := range i.epochs[string(groupID)] {
+		receipts = append(receipts, i.receipts[receiptKey{group: string(groupID), epoch: epoch}])
+	}
+	sort.Slice(receipts, func(a, b int) bool {
+		return receipts[a].Epoch < receipts[b].Epoch
+	})
+	return receipts
+}
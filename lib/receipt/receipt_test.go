@@ -0,0 +1,95 @@
+package receipt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestReceiptIssueAndVerify(t *testing.T) {
+	issuer, err := GenerateIssuer(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+
+	groupID := []byte("group-1")
+	tr, _ := tree.NewTreeWithStore(nil, tree.WithGroupID(groupID))
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+		if err := tr.AdvanceEpoch(); err != nil {
+			t.Fatalf("Failed to advance epoch: %v", err)
+		}
+		if err := tr.SetConfirmedTranscriptHash([]byte("commit adding " + user)); err != nil {
+			t.Fatalf("Failed to set transcript hash: %v", err)
+		}
+		if _, err := issuer.Issue(tr, "add "+user); err != nil {
+			t.Fatalf("Failed to issue receipt: %v", err)
+		}
+	}
+
+	r, ok := issuer.Get(groupID, tr.Epoch())
+	if !ok {
+		t.Fatalf("receipt for epoch %d not found", tr.Epoch())
+	}
+	if !bytes.Equal(r.TreeHash, tr.TreeHash()) || string(r.TranscriptHash) != "commit adding charlie" {
+		t.Errorf("receipt does not identify the epoch of the last change")
+	}
+	if err := r.Verify(issuer.PublicKey()); err != nil {
+		t.Errorf("valid receipt failed verification: %v", err)
+	}
+	if err := r.Check(tr.GroupContext()); err != nil {
+		t.Errorf("receipt should match the group context: %v", err)
+	}
+
+	r.Op = "add mallory"
+	if err := r.Verify(issuer.PublicKey()); err == nil {
+		t.Errorf("tampered receipt passed verification")
+	}
+
+	if _, err := issuer.Issue(tr, "add dave"); err == nil {
+		t.Errorf("expected error when reissuing an epoch")
+	}
+	if got := len(issuer.List(groupID)); got != 3 {
+		t.Errorf("expected 3 receipts, got %d", got)
+	}
+
+	// A member that moved on, or follows another group, does not match the receipt
+	tr.Insert("dave", []byte("dave_key"))
+	if err := r.Check(tr.GroupContext()); err == nil {
+		t.Errorf("receipt of an earlier epoch should not match")
+	}
+	other, _ := tree.NewTreeWithStore(nil, tree.WithGroupID([]byte("group-2")))
+	other.Insert("alice", []byte("alice_key"))
+	first, _ := issuer.Get(groupID, 1)
+	if err := first.Check(other.GroupContext()); err == nil {
+		t.Errorf("receipt of another group should not match")
+	}
+	if _, err := issuer.Issue(other, "add alice"); err != nil {
+		t.Errorf("epochs of different groups are receipted separately: %v", err)
+	}
+}
+
+func TestIssuerRetention(t *testing.T) {
+	issuer, _ := GenerateIssuer(rand.Reader, WithRetention(2))
+	groupID := []byte("group-1")
+	tr, _ := tree.NewTreeWithStore(nil, tree.WithGroupID(groupID))
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tr.Insert(user, []byte(user+"_key"))
+		tr.AdvanceEpoch()
+		if _, err := issuer.Issue(tr, "add "+user); err != nil {
+			t.Fatalf("Failed to issue receipt: %v", err)
+		}
+	}
+
+	if _, ok := issuer.Get(groupID, 1); ok {
+		t.Errorf("the receipt of epoch 1 should have been dropped")
+	}
+	receipts := issuer.List(groupID)
+	if len(receipts) != 2 || receipts[0].Epoch != 2 || receipts[1].Epoch != 3 {
+		t.Errorf("expected the receipts of epochs 2 and 3, got %d", len(receipts))
+	}
+}
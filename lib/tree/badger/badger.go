@@ -0,0 +1,163 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// keyPrefix namespaces element entries inside the database
+const keyPrefix = "node/"
+
+// Store keeps tree elements in a BadgerDB instance
+// Badger's LSM design turns the constant stream of SetIntermediateNodeKey and
+// MarkAsModified rewrites into sequential appends instead of whole-file rewrites.
+// It is a tree.BatchStore: the writes of each tree operation, such as the O(depth)
+// nodes of a path update, share one badger transaction and commit together
+type Store struct {
+	db *badgerdb.DB
+
+	mu      sync.Mutex
+	txn     *badgerdb.Txn // transaction of the running operation
+	written bool          // whether the running operation wrote anything
+}
+
+var _ tree.BatchStore = (*Store)(nil)
+
+// Open opens or creates a Badger database in dir
+func Open(dir string) (*Store, error) {
+	opts := badgerdb.DefaultOptions(dir).WithLogger(nil)
+	db, err := badgerdb.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open badger database: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// NewTree opens the database in dir and returns an empty tree stored in it
+func NewTree(dir string) (*tree.Tree, *Store, error) {
+	store, err := Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.NewTreeWithStore(store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// LoadTree opens the database in dir and loads the tree rooted at headName
+func LoadTree(dir string, headName string) (*tree.Tree, *Store, error) {
+	store, err := Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.LoadTreeFromStore(store, headName)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Key prefixes the element name
+func (s *Store) Key(name string) string {
+	return keyPrefix + name
+}
+
+// Begin starts the transaction holding the writes of one tree operation
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txn = s.db.NewTransaction(true)
+	s.written = false
+}
+
+// Commit commits the transaction of the operation, or discards it when opErr is set
+// An operation larger than one badger transaction fails with badger.ErrTxnTooBig
+// rather than committing in parts
+func (s *Store) Commit(opErr error) error {
+	s.mu.Lock()
+	txn, written := s.txn, s.written
+	s.txn, s.written = nil, false
+	s.mu.Unlock()
+
+	if txn == nil {
+		return opErr
+	}
+	defer txn.Discard()
+	if opErr != nil || !written {
+		return opErr
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// update runs fn in the running transaction, or outside an operation in one of its own
+func (s *Store) update(fn func(txn *badgerdb.Txn) error) error {
+	s.mu.Lock()
+	txn := s.txn
+	s.written = s.written || txn != nil
+	s.mu.Unlock()
+	if txn != nil {
+		return fn(txn)
+	}
+	return s.db.Update(fn)
+}
+
+// Write stores an element
+func (s *Store) Write(key string, data []byte) error {
+	// Badger keeps the value until the transaction commits, past the caller's use of it
+	data = append([]byte(nil), data...)
+	return s.update(func(txn *badgerdb.Txn) error {
+		return txn.Set([]byte(key), data)
+	})
+}
+
+// Read returns a copy of the stored element, including writes of the running transaction
+func (s *Store) Read(key string) ([]byte, error) {
+	read := func(txn *badgerdb.Txn) ([]byte, error) {
+		item, err := txn.Get([]byte(key))
+		if errors.Is(err, badgerdb.ErrKeyNotFound) {
+			return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return item.ValueCopy(nil)
+	}
+
+	s.mu.Lock()
+	txn := s.txn
+	s.mu.Unlock()
+	if txn != nil {
+		return read(txn)
+	}
+	var data []byte
+	err := s.db.View(func(txn *badgerdb.Txn) error {
+		var err error
+		data, err = read(txn)
+		return err
+	})
+	return data, err
+}
+
+// Remove deletes an element
+func (s *Store) Remove(key string) error {
+	return s.update(func(txn *badgerdb.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+// Close flushes and closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
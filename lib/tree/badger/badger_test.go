@@ -0,0 +1,90 @@
+package badger
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestBadgerTreeKeyRotation(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "badger_tree_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tr, store, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	headName := tr.Head().Name()
+	for i := 0; i < 100; i++ {
+		if err := tr.SetIntermediateNodeKey(headName, []byte{byte(i)}); err != nil {
+			t.Fatalf("Failed to rotate root key: %v", err)
+		}
+	}
+	store.Close()
+
+	loaded, store, err := LoadTree(tempDir, headName)
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	defer store.Close()
+
+	if got := loaded.GetGroupPublicKey(); len(got) != 1 || got[0] != 99 {
+		t.Errorf("expected last rotated root key, got %v", got)
+	}
+	if got := len(loaded.GetLeaves()); got != 4 {
+		t.Errorf("expected 4 leaves after reload, got %d", got)
+	}
+}
+
+func TestBadgerOperationsAreTransactional(t *testing.T) {
+	tempDir := t.TempDir()
+	tr, store, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	headName := tr.Head().Name()
+	headKey := store.Key(headName)
+
+	store.Begin()
+	if err := store.Write(store.Key("charlie"), []byte("partial")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if err := store.Write(headKey, []byte("torn")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if data, err := store.Read(headKey); err != nil || string(data) != "torn" {
+		t.Errorf("the transaction should read its own writes, got %q, %v", data, err)
+	}
+	if err := store.Commit(errors.New("operation failed")); err == nil {
+		t.Fatalf("Commit should return the operation's error")
+	}
+	if _, err := store.Read(store.Key("charlie")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a discarded write should not be stored, got %v", err)
+	}
+	store.Close()
+
+	loaded, store, err := LoadTree(tempDir, headName)
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	defer store.Close()
+	if got := len(loaded.GetLeaves()); got != 2 {
+		t.Errorf("expected the 2 committed leaves, got %d", got)
+	}
+}
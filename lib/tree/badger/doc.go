@@ -0,0 +1,2 @@
+// Package badger stores TreeKEM trees in BadgerDB for write-heavy key rotation workloads
+package badger
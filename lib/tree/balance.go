@@ -0,0 +1,198 @@
+package tree
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// Skew is a parent whose leaves are not split the way a left-balanced tree splits them
+type Skew struct {
+	Node        string
+	NodeIndex   int
+	LeftLeaves  int
+	RightLeaves int
+	WantLeft    int // leaves the left subtree holds in the left-balanced shape
+}
+
+// BalanceReport describes how far the tree is from the left-balanced shape
+type BalanceReport struct {
+	Leaves    int    // leaves in the tree
+	Depth     int    // edges on the longest path from the root to a leaf
+	WantDepth int    // depth of the left-balanced tree over the same leaves
+	Skews     []Skew // skewed parents in level order
+}
+
+// Balanced reports whether every parent splits its leaves the left-balanced way
+func (r *BalanceReport) Balanced() bool {
+	return len(r.Skews) == 0
+}
+
+// CheckBalance measures the tree against the left-balanced shape of RFC 9420 section 4.1,
+// the shape Insert builds and Rebalance restores
+func (t *Tree) CheckBalance() *BalanceReport {
+	report := &BalanceReport{}
+	if t.head == nil {
+		return report
+	}
+	leaves := make(map[*Element]int)
+	depths := make(map[*Element]int)
+	t.Walk(PostOrder, func(node *Element) bool {
+		if node.IsLeaf() {
+			leaves[node] = 1
+			return true
+		}
+		left, right := leaves[node.leftChild], leaves[node.rightChild]
+		leaves[node] = left + right
+		depths[node] = 1 + max(depths[node.leftChild], depths[node.rightChild])
+		return true
+	})
+	t.Walk(LevelOrder, func(node *Element) bool {
+		if node.IsLeaf() {
+			return true
+		}
+		left, right := leaves[node.leftChild], leaves[node.rightChild]
+		if want := leftBalancedSplit(left + right); left != want || right == 0 {
+			report.Skews = append(report.Skews, Skew{Node: node.name, NodeIndex: node.nodeIndex, LeftLeaves: left, RightLeaves: right, WantLeft: want})
+		}
+		return true
+	})
+	report.Leaves = leaves[t.head]
+	report.Depth = depths[t.head]
+	report.WantDepth = bits.Len(uint(report.Leaves - 1))
+	return report
+}
+
+// leftBalancedSplit returns the leaves the left child of a parent over n leaves holds:
+// the largest power of two below n
+func leftBalancedSplit(n int) int {
+	if n < 2 {
+		return n
+	}
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// Rebalance restructures the tree into the left-balanced shape over its leaves, keeping
+// their order and so every leaf index. An intermediate covering exactly the same leaves
+// in the new shape is kept with its key, as every member below it still knows the
+// secret; the others are replaced by blank intermediates. Parents left with a single
+// child disappear. It returns how many keyed intermediates lost their key
+// Parent hashes no longer chain once the shape changes, so the next commit should carry
+// an UpdatePath
+func (t *Tree) Rebalance() (invalidated int, err error) {
+	if err := t.checkWritable("rebalance"); err != nil {
+		return 0, err
+	}
+	if t.CheckBalance().Balanced() {
+		return 0, nil
+	}
+	end := t.startOp("rebalance", "")
+	defer func() { end(err) }()
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	// Parent hashes survive where a node keeps its parent and sibling
+	type links struct{ parent, left, right *Element }
+	before := make(map[*Element]links, len(t.nodes))
+	for _, node := range t.nodes {
+		before[node] = links{node.parent, node.leftChild, node.rightChild}
+	}
+
+	// Intermediates by the run of leaves they cover; leaves are contiguous in order
+	type span struct{ first, count int }
+	var leaves []*Element
+	existing := make(map[span]*Element)
+	var stale []*Element
+	var cover func(node *Element) (int, int)
+	cover = func(node *Element) (int, int) {
+		if node.nodeType == "leaf" {
+			leaves = append(leaves, node)
+			return len(leaves) - 1, 1
+		}
+		first, count := len(leaves), 0
+		for _, child := range []*Element{node.leftChild, node.rightChild} {
+			if child != nil {
+				_, n := cover(child)
+				count += n
+			}
+		}
+		if _, dup := existing[span{first, count}]; dup || count < 2 {
+			stale = append(stale, node) // a single-child chain or a childless intermediate
+		} else {
+			existing[span{first, count}] = node
+		}
+		return first, count
+	}
+	cover(t.head)
+
+	var build func(first, count int) *Element
+	build = func(first, count int) *Element {
+		if count == 1 {
+			return leaves[first]
+		}
+		split := leftBalancedSplit(count)
+		left := build(first, split)
+		right := build(first+split, count-split)
+
+		node, kept := existing[span{first, count}]
+		if kept {
+			delete(existing, span{first, count})
+		} else {
+			name := newIntermediateName()
+			node = &Element{
+				name:         name,
+				publicKey:    []byte{},
+				filePath:     t.generateFilePath(name),
+				store:        t.store,
+				format:       t.format,
+				nodeType:     "intermediate",
+				lastModified: time.Now(),
+			}
+		}
+		node.leftChild, node.rightChild = left, right
+		node.leftCount, node.rightCount = split, count-split
+		return node
+	}
+	if len(leaves) == 0 {
+		return 0, nil
+	}
+	t.head = build(0, len(leaves))
+	t.reassignNodeIndices()
+
+	for _, node := range existing {
+		stale = append(stale, node)
+	}
+	for _, node := range stale {
+		if len(node.key()) > 0 {
+			invalidated++
+		}
+		t.removeFromStore(node.filePath)
+	}
+
+	// A parent hash covers the parent and the sibling, so it is dropped when either
+	// changed. Children are saved before parents so stored references always resolve
+	moved := func(node *Element) bool {
+		was, ok := before[node]
+		return !ok || was.left != node.leftChild || was.right != node.rightChild
+	}
+	t.Walk(PostOrder, func(node *Element) bool {
+		if node.IsLeaf() {
+			return true
+		}
+		changed := moved(node)
+		if parent := node.parent; parent != nil && (before[node].parent != parent || moved(parent)) && node.ParentHash() != nil {
+			node.parentHash = nil
+			changed = true
+		}
+		if changed {
+			node.MarkAsModified()
+			err = node.saveToDisk()
+		}
+		return err == nil
+	})
+	if err != nil {
+		return invalidated, fmt.Errorf("failed to save rebalanced tree: %w", err)
+	}
+	return invalidated, t.syncManifestHead()
+}
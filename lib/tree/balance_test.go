@@ -0,0 +1,120 @@
+package tree
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestRebalance(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve", "frank", "grace", "heidi"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if report := tr.CheckBalance(); !report.Balanced() || report.Depth != 3 || report.WantDepth != 3 {
+		t.Fatalf("inserted tree should be balanced, got %+v", report)
+	}
+	if _, err := tr.SetPathKeys("alice", testPathKeys(t, 3)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	rootKey := slices.Clone(tr.Head().key())
+
+	// Taking bob and grace out of the structure, rather than blanking their slots as
+	// Delete does, leaves their parents with a single child
+	for _, name := range []string{"bob", "grace"} {
+		spliceOut(t, tr, name)
+	}
+	report := tr.CheckBalance()
+	if report.Balanced() || report.Leaves != 6 {
+		t.Fatalf("tree with single-child parents should be skewed, got %+v", report)
+	}
+	for _, skew := range report.Skews {
+		if skew.LeftLeaves == skew.WantLeft && skew.RightLeaves != 0 {
+			t.Errorf("%s is reported skewed but splits %d|%d", skew.Node, skew.LeftLeaves, skew.RightLeaves)
+		}
+	}
+
+	leaves := leafNames(tr)
+	indices := make(map[string]int)
+	for _, leaf := range tr.GetLeaves() {
+		indices[leaf.Name()] = leaf.LeafIndex()
+	}
+	invalidated, err := tr.Rebalance()
+	if err != nil {
+		t.Fatalf("Failed to rebalance: %v", err)
+	}
+	// alice's parent and grandparent no longer cover the same leaves, the root still does
+	if invalidated != 2 {
+		t.Errorf("invalidated = %d, want 2", invalidated)
+	}
+	if !bytes.Equal(tr.Head().key(), rootKey) {
+		t.Errorf("root covers the same leaves and should keep its key")
+	}
+	if report := tr.CheckBalance(); !report.Balanced() || report.Depth != report.WantDepth {
+		t.Errorf("rebalanced tree should be balanced, got %+v", report)
+	}
+	if got := leafNames(tr); !slices.Equal(got, leaves) {
+		t.Errorf("leaves = %v, want %v", got, leaves)
+	}
+	for _, leaf := range tr.GetLeaves() {
+		if leaf.LeafIndex() != indices[leaf.Name()] {
+			t.Errorf("%s moved from leaf index %d to %d", leaf.Name(), indices[leaf.Name()], leaf.LeafIndex())
+		}
+	}
+	checkNodeLinks(t, tr)
+
+	version := tr.Version()
+	if invalidated, err := tr.Rebalance(); err != nil || invalidated != 0 || tr.Version() != version {
+		t.Errorf("rebalancing a balanced tree should do nothing, got %d, %v", invalidated, err)
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got := leafNames(reloaded); !slices.Equal(got, leaves) {
+		t.Errorf("reloaded leaves = %v, want %v", got, leaves)
+	}
+	if !reloaded.CheckBalance().Balanced() {
+		t.Errorf("reloaded tree should be balanced")
+	}
+}
+
+// spliceOut takes the leaf name out of the tree structure instead of blanking its slot,
+// leaving its parent with a single child. Delete never does this; stores and imports
+// can still hold such trees, which Rebalance restores
+func spliceOut(t *testing.T, tr *Tree, name string) {
+	t.Helper()
+	leaf, ok := tr.Find(name)
+	if !ok || !leaf.IsLeaf() || leaf.parent == nil {
+		t.Fatalf("cannot splice %s out of the tree", name)
+	}
+	parent := leaf.parent
+	for child, node := leaf, parent; node != nil; child, node = node, node.parent {
+		if node.leftChild == child {
+			node.leftCount--
+		} else {
+			node.rightCount--
+		}
+		node.dropUnmerged(leaf.leafIndex)
+	}
+	if parent.leftChild == leaf {
+		parent.leftChild = nil
+	} else {
+		parent.rightChild = nil
+	}
+	for node := parent; node != nil; node = node.parent {
+		node.saveToDisk()
+	}
+	tr.removeFromStore(leaf.filePath)
+	tr.reassignNodeIndices()
+	if err := tr.syncManifestHead(); err != nil {
+		t.Fatalf("Failed to splice %s out: %v", name, err)
+	}
+}
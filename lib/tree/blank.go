@@ -0,0 +1,257 @@
+package tree
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyKey is returned when a member would be given an empty public key, which would
+// make its leaf indistinguishable from a blank slot
+var ErrEmptyKey = errors.New("empty public key")
+
+// IsBlank reports whether the node holds no key
+// Blank intermediates resolve to their children and blank leaves are unoccupied slots.
+// A shelved node whose payload cannot be loaded is not blank: its key is unknown, not
+// absent, see Element.Key
+func (e *Element) IsBlank() bool {
+	key, err := e.Key()
+	return err == nil && len(key) == 0
+}
+
+// Blank removes the member at leaf name the way TreeKEM does (RFC 9420 section 12.1.3)
+// The leaf and its direct path lose their keys but keep their place, so every other
+// member keeps its leaf index and path. The leaf gives up its name, which becomes free
+// for a later insert, and its slot is the first the next insert fills. Blank leaves
+// left at the right edge are truncated
+func (t *Tree) Blank(name string) (err error) {
+	if err := t.checkWritable("blank"); err != nil {
+		return err
+	}
+	end := t.startOp("blank", name)
+	defer func() { end(err) }()
+	return t.blank(name, 1)
+}
+
+// blank implements Blank and the leaf case of Delete, truncating to no fewer than floor
+// leaves
+func (t *Tree) blank(name string, floor int) (err error) {
+	path, err := t.GetPath(name)
+	if err != nil {
+		return err
+	}
+	leaf := path[len(path)-1]
+	if !leaf.IsLeaf() {
+		return fmt.Errorf("%s is not a leaf", name)
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	for _, node := range path {
+		if err := t.setNodeKey(node, PublicKey{}); err != nil {
+			return err
+		}
+	}
+	previous := leaf.filePath
+	t.renameElement(leaf, blankLeafName(leaf.leafIndex))
+	leaf.filePath = t.generateFilePath(leaf.name)
+	t.removeFromStore(previous)
+
+	// Parents are written after the leaf so their child references follow the rename
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].MarkAsModified()
+		if err := path[i].saveToDisk(); err != nil {
+			return fmt.Errorf("failed to save %s: %w", path[i].name, err)
+		}
+	}
+
+	if err := t.truncate(floor); err != nil {
+		return err
+	}
+	return t.syncManifestHead()
+}
+
+// truncate drops the blank leaves at the right edge, keeping at least floor leaves
+// The parent of a dropped leaf goes with it and the leaf's sibling takes the parent's
+// place, as RFC 9420 section 7.8 shrinks the tree, so the tree stays left-balanced and
+// every remaining leaf keeps its leaf index. The dropped nodes are the last two in the
+// array, so no other node is renumbered unless the tree was out of left-balanced shape
+func (t *Tree) truncate(floor int) error {
+	renumber := false
+	leaves := t.GetLeaves()
+	for ; len(leaves) > floor && leaves[len(leaves)-1].IsBlank(); leaves = leaves[:len(leaves)-1] {
+		removed, err := t.dropLeaf(leaves[len(leaves)-1])
+		if err != nil {
+			return fmt.Errorf("failed to truncate blank leaf: %w", err)
+		}
+		if !t.unindexTail(removed) {
+			renumber = true
+		}
+	}
+	if renumber {
+		t.reassignNodeIndices()
+	}
+	return nil
+}
+
+// unindexTail drops removed from the end of the node array, where the rightmost leaf
+// and its parent sit, so every other node keeps its index. It reports false when they
+// were elsewhere and the tree needs renumbering
+func (t *Tree) unindexTail(removed []*Element) bool {
+	tail := len(t.nodes) - len(removed)
+	if tail < 0 {
+		return false
+	}
+	for _, e := range removed {
+		if e.nodeIndex < tail || e.nodeIndex >= len(t.nodes) || t.nodes[e.nodeIndex] != e {
+			return false
+		}
+	}
+	for _, e := range removed {
+		if t.byName[e.name] == e {
+			delete(t.byName, e.name)
+		}
+		delete(t.snapshotNodes, e)
+	}
+	t.snapshotNames = nil
+	clear(t.nodes[tail:])
+	t.nodes = t.nodes[:tail]
+	return true
+}
+
+// dropLeaf takes leaf out of the tree with its parent, splicing in the leaf's sibling
+// Parents left without children are dropped as well; it returns every element dropped
+func (t *Tree) dropLeaf(leaf *Element) ([]*Element, error) {
+	t.removeFromStore(leaf.filePath)
+	removed := []*Element{leaf}
+	for node := leaf; ; {
+		parent := node.parent
+		if parent == nil {
+			t.head = nil
+			return removed, nil
+		}
+		sibling := node.Sibling()
+		t.removeFromStore(parent.filePath)
+		removed = append(removed, parent)
+		if sibling == nil {
+			node = parent
+			continue
+		}
+
+		above := parent.parent
+		switch {
+		case above == nil:
+			t.head = sibling
+		case above.leftChild == parent:
+			above.leftChild = sibling
+		default:
+			above.rightChild = sibling
+		}
+		sibling.parent = above
+		sibling.touch() // its parent index changed
+		for ancestor := above; ancestor != nil; ancestor = ancestor.parent {
+			ancestor.leftCount = countLeaves(ancestor.leftChild)
+			ancestor.rightCount = countLeaves(ancestor.rightChild)
+			ancestor.dropUnmerged(leaf.leafIndex)
+			ancestor.MarkAsModified()
+			if err := ancestor.saveToDisk(); err != nil {
+				return removed, fmt.Errorf("failed to save %s: %w", ancestor.name, err)
+			}
+		}
+		return removed, nil
+	}
+}
+
+// BlankPath clears the keys of the intermediate nodes on leaf's direct path, as MLS
+// requires when a commit adds or removes members without an UpdatePath
+// It returns the node indices of the nodes that lost a key, nearest the leaf first:
+// the intermediates clients must derive fresh keys for. The leaf keeps its key
+func (t *Tree) BlankPath(leafName string) (blanked []int, err error) {
+	if err := t.checkWritable("blank path"); err != nil {
+		return nil, err
+	}
+	end := t.startOp("blank_path", leafName)
+	defer func() { end(err) }()
+
+	leaf, found := t.Find(leafName)
+	if !found {
+		return nil, fmt.Errorf("element not found: %s", leafName)
+	}
+	if leaf.nodeType != "leaf" {
+		return nil, fmt.Errorf("%s is not a leaf", leafName)
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	for node := leaf.parent; node != nil; node = node.parent {
+		if node.IsBlank() {
+			continue
+		}
+		if err := t.setNodeKey(node, PublicKey{}); err != nil {
+			return blanked, err
+		}
+		node.MarkAsModified()
+		if err := node.saveToDisk(); err != nil {
+			return blanked, fmt.Errorf("failed to save %s: %w", node.name, err)
+		}
+		blanked = append(blanked, node.nodeIndex)
+	}
+	return blanked, nil
+}
+
+// leftmostBlankLeaf returns the first blank leaf in leaf order, nil when every slot is taken
+func (t *Tree) leftmostBlankLeaf() *Element {
+	for _, leaf := range t.GetLeaves() {
+		if leaf.IsBlank() && leaf.nodeType == "leaf" {
+			return leaf
+		}
+	}
+	return nil
+}
+
+// fillBlank places a new member holding key in the blank leaf slot, see insert
+// The slot keeps its leaf index and node index, so no other member moves, and the
+// member is unmerged at every keyed ancestor as if it had been appended
+func (t *Tree) fillBlank(slot *Element, name string, key PublicKey, leaf *LeafNode) error {
+	if t.tracePlacement {
+		t.lastPlacement = &PlacementTrace{Leaf: name, Result: fmt.Sprintf("reused blank leaf slot %d", slot.leafIndex)}
+	}
+
+	previous := slot.filePath
+	if err := slot.unshelve(); err != nil {
+		return err
+	}
+	t.renameElement(slot, name)
+	slot.filePath = t.generateFilePath(name)
+	slot.publicKey = key.Data
+	slot.keyAlgorithm = key.Algorithm
+	slot.keyEncoding = key.Encoding
+	slot.leafNode = leaf
+	slot.parentHash = nil
+	slot.history = nil // the previous member's keys
+	t.removeFromStore(previous)
+
+	// Parents are written after the leaf so their child references follow the rename
+	for node := slot; node != nil; node = node.parent {
+		if node != slot {
+			node.addUnmerged(slot.leafIndex)
+		}
+		node.MarkAsModified()
+		if err := node.saveToDisk(); err != nil {
+			return fmt.Errorf("failed to save %s: %w", node.name, err)
+		}
+	}
+	return t.syncManifestHead()
+}
+
+// blankLeafName names the blank leaf left at leafIndex
+// It depends on the index alone, so replicas blanking the same member agree on it
+func blankLeafName(leafIndex int) string {
+	hasher := sha256.New()
+	hasher.Write([]byte("TreeKEM-blank-leaf"))
+	hasher.Write(binary.BigEndian.AppendUint32(nil, uint32(leafIndex)))
+	return fmt.Sprintf("blank_%x", hasher.Sum(nil)[:16])
+}
@@ -0,0 +1,320 @@
+package tree
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestBlank(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	path, _ := tr.GetPath("bob")
+	if _, err := tr.SetPathKeys("bob", testPathKeys(t, len(path)-1)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	before := leafNames(tr)
+	nodes := len(tr.GetAllElements())
+
+	if err := tr.Blank("bob"); err != nil {
+		t.Fatalf("Failed to blank bob: %v", err)
+	}
+	if _, ok := tr.Find("bob"); ok {
+		t.Errorf("blanked leaf should give up its name")
+	}
+	after := leafNames(tr)
+	if len(after) != len(before) || len(tr.GetAllElements()) != nodes {
+		t.Fatalf("blanking should keep the tree shape, leaves %v became %v", before, after)
+	}
+	for i, name := range before {
+		if name != "bob" && after[i] != name {
+			t.Errorf("leaf %d moved from %s to %s", i, name, after[i])
+		}
+	}
+	for _, node := range path {
+		if !node.IsBlank() || len(node.ParentHash()) != 0 {
+			t.Errorf("%s on bob's direct path should be blank", node.Name())
+		}
+	}
+	if got := resolutionNames(t, tr, tr.Head().NodeIndex()); len(got) != 3 || slices.Contains(got, path[len(path)-1].Name()) {
+		t.Errorf("root should resolve to the three remaining members, got %v", got)
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got := leafNames(reloaded); !slices.Equal(got, after) {
+		t.Errorf("blank leaf should survive a reload, got %v want %v", got, after)
+	}
+
+	// The freed name can join again, into the blank slot rather than a new one
+	slot := path[len(path)-1]
+	if err := tr.InsertLeafNode("bob", testLeafNode(t, "bob")); err != nil {
+		t.Fatalf("Failed to insert bob again: %v", err)
+	}
+	if got := leafNames(tr); !slices.Equal(got, before) {
+		t.Errorf("bob should fill the blank slot, leaves %v, want %v", got, before)
+	}
+	if bob, _ := tr.Find("bob"); bob != slot || bob.LeafIndex() != slot.LeafIndex() || len(tr.GetAllElements()) != nodes {
+		t.Errorf("reusing the slot should keep bob's leaf index and the tree shape")
+	}
+	for _, node := range path[:len(path)-1] {
+		if len(node.UnmergedLeaves()) != 0 {
+			t.Errorf("blank ancestors should not list bob as unmerged")
+		}
+	}
+	if reloaded, err := LoadTree(dir, ""); err != nil || !slices.Equal(leafNames(reloaded), before) {
+		t.Errorf("refilled slot should survive a reload: %v", err)
+	}
+
+	// Blank leaves at the right edge are truncated, along with any blank run before them
+	last := tr.GetLeaves()[len(tr.GetLeaves())-1].Name()
+	count := len(tr.GetLeaves())
+	if err := tr.Blank(last); err != nil {
+		t.Fatalf("Failed to blank %s: %v", last, err)
+	}
+	if leaves := tr.GetLeaves(); len(leaves) >= count || leaves[len(leaves)-1].IsBlank() {
+		t.Errorf("trailing blank leaf should be truncated, got %v", leafNames(tr))
+	}
+	if err := tr.Blank("mallory"); err == nil {
+		t.Errorf("blanking an unknown leaf should fail")
+	}
+}
+
+// leafNames returns the names of the leaves in leaf index order
+func leafNames(tr *Tree) []string {
+	var names []string
+	for _, leaf := range tr.GetLeaves() {
+		names = append(names, leaf.Name())
+	}
+	return names
+}
+
+func TestInsertFillsBlankSlot(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")), WithPlacementTrace())
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	bob, _ := tr.Find("bob")
+	index := bob.LeafIndex()
+	if err := tr.Blank("bob"); err != nil {
+		t.Fatalf("Failed to blank bob: %v", err)
+	}
+	path, _ := tr.GetPath("alice")
+	if _, err := tr.SetPathKeys("alice", testPathKeys(t, len(path)-1)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+
+	if err := tr.InsertLeafNode("eve", testLeafNode(t, "eve")); err != nil {
+		t.Fatalf("Failed to insert eve: %v", err)
+	}
+	eve, _ := tr.Find("eve")
+	if eve.LeafIndex() != index || len(tr.GetLeaves()) != 4 {
+		t.Errorf("eve should take bob's leaf index %d without growing the tree, got %d", index, eve.LeafIndex())
+	}
+	if trace := tr.LastPlacementTrace(); trace == nil || trace.Leaf != "eve" || len(trace.Steps) != 0 {
+		t.Errorf("trace should record the reused slot, got %v", trace)
+	}
+	for _, node := range path[:len(path)-1] {
+		if !slices.Contains(node.UnmergedLeaves(), index) {
+			t.Errorf("keyed ancestor %s should list eve as unmerged", node.Name())
+		}
+	}
+	if got := resolutionNames(t, tr, tr.Head().NodeIndex()); !slices.Equal(got, []string{tr.Head().Name(), "eve"}) {
+		t.Errorf("root should resolve to itself and eve, got %v", got)
+	}
+	if report := tr.Validate(); len(report.Of(InvariantUnmergedLeaves)) != 0 {
+		t.Errorf("filled slot should keep unmerged leaves valid: %v", report.Err())
+	}
+
+	// With no blank slot left the tree grows again
+	if err := tr.InsertLeafNode("frank", testLeafNode(t, "frank")); err != nil {
+		t.Fatalf("Failed to insert frank: %v", err)
+	}
+	if len(tr.GetLeaves()) != 5 || !tr.LastPlacementTrace().Extended {
+		t.Errorf("frank should extend the full tree")
+	}
+}
+
+func TestBlankPath(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	alice, _ := tr.Find("alice")
+	charlie, _ := tr.Find("charlie")
+
+	blanked, err := tr.BlankPath("alice")
+	if err != nil {
+		t.Fatalf("Failed to blank path: %v", err)
+	}
+	if want := tr.DirectPath(alice.LeafIndex()); !slices.Equal(blanked, want) {
+		t.Errorf("blanked = %v, want the direct path %v", blanked, want)
+	}
+	for _, index := range blanked {
+		if !tr.GetNodeByIndex(index).IsBlank() {
+			t.Errorf("node %d should be blank", index)
+		}
+	}
+	if alice.IsBlank() || charlie.Parent().IsBlank() {
+		t.Errorf("the leaf and nodes off its path should keep their keys")
+	}
+
+	// bob shares alice's path, which holds no keys anymore
+	if blanked, err := tr.BlankPath("bob"); err != nil || len(blanked) != 0 {
+		t.Errorf("blanking a blank path should report nothing, got %v, %v", blanked, err)
+	}
+	if _, err := tr.BlankPath("mallory"); err == nil {
+		t.Errorf("unknown leaves should be rejected")
+	}
+	if _, err := tr.BlankPath(tr.Head().Name()); err == nil {
+		t.Errorf("intermediate nodes should be rejected")
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if !reloaded.Equal(tr) || !reloaded.Head().IsBlank() {
+		t.Errorf("blanked path should be persisted: %v", reloaded.StructuralDiff(tr))
+	}
+}
+
+func TestDeleteKeepsLeafIndices(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	indices := make(map[string]int)
+	for _, leaf := range tr.GetLeaves() {
+		indices[leaf.Name()] = leaf.LeafIndex()
+	}
+
+	if err := tr.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+	for i, leaf := range tr.GetLeaves() {
+		if want, ok := indices[leaf.Name()]; (ok && leaf.LeafIndex() != want) || leaf.LeafIndex() != i {
+			t.Errorf("%s at position %d has leaf index %d", leaf.Name(), i, leaf.LeafIndex())
+		}
+	}
+	if got, want := leafNames(tr), []string{"alice", blankLeafName(1), "charlie", "dave", "eve"}; !slices.Equal(got, want) {
+		t.Errorf("leaves = %v, want %v", got, want)
+	}
+
+	// Deleting the rightmost member truncates the tree back to four leaves under the old root
+	if err := tr.Delete("eve"); err != nil {
+		t.Fatalf("Failed to delete eve: %v", err)
+	}
+	if got, want := leafNames(tr), []string{"alice", blankLeafName(1), "charlie", "dave"}; !slices.Equal(got, want) {
+		t.Errorf("leaves = %v, want %v", got, want)
+	}
+	if !tr.CheckBalance().Balanced() {
+		t.Errorf("truncation should keep the tree left-balanced")
+	}
+	checkNodeLinks(t, tr)
+
+	// Only an insert reuses the blank slot
+	if err := tr.Insert("frank", []byte("frank_key")); err != nil {
+		t.Fatalf("Failed to insert frank: %v", err)
+	}
+	if frank, _ := tr.Find("frank"); frank.LeafIndex() != 1 {
+		t.Errorf("frank should take bob's slot, got leaf index %d", frank.LeafIndex())
+	}
+
+	for _, name := range []string{"alice", "charlie", "dave", "frank"} {
+		if err := tr.Delete(name); err != nil {
+			t.Fatalf("Failed to delete %s: %v", name, err)
+		}
+	}
+	if tr.Head() != nil {
+		t.Errorf("deleting the last member should empty the tree, leaves %v", leafNames(tr))
+	}
+}
+
+func TestDeleteRejectsIntermediates(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, name := range names {
+		tr.Insert(name, []byte(name+"_key"))
+	}
+	nodes := len(tr.GetAllElements())
+
+	if err := tr.Delete(tr.Head().Name()); err == nil {
+		t.Errorf("deleting the root should fail")
+	}
+	a, _ := tr.Find("a")
+	if err := tr.Delete(a.Parent().Name()); err == nil {
+		t.Errorf("deleting an intermediate should fail")
+	}
+	if err := tr.Delete("nobody"); err == nil {
+		t.Errorf("deleting an unknown name should fail")
+	}
+
+	if got := leafNames(tr); !slices.Equal(got, names) {
+		t.Errorf("leaves = %v, want %v", got, names)
+	}
+	if len(tr.GetAllElements()) != nodes {
+		t.Errorf("the tree should keep its %d nodes, got %d", nodes, len(tr.GetAllElements()))
+	}
+	if report := tr.Validate(); !report.OK() {
+		t.Errorf("tree should stay valid: %v", report.Err())
+	}
+}
+
+func TestInsertRejectsEmptyKey(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, key := range [][]byte{nil, {}} {
+		if err := tr.Insert("alice", key); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("inserting an empty key should fail with ErrEmptyKey, got %v", err)
+		}
+	}
+	if tr.Head() != nil {
+		t.Fatalf("a rejected insert must not change the tree")
+	}
+
+	// A member with a key is never taken for a blank slot
+	if err := tr.Insert("alice", []byte("alice_key")); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+	if err := tr.Insert("bob", []byte("bob_key")); err != nil {
+		t.Fatalf("Failed to insert bob: %v", err)
+	}
+	alice, found := tr.Find("alice")
+	if !found || alice.LeafIndex() != 0 {
+		t.Fatalf("alice should keep leaf 0")
+	}
+	if bob, _ := tr.Find("bob"); bob.LeafIndex() != 1 {
+		t.Errorf("bob should be appended at leaf 1, got %d", bob.LeafIndex())
+	}
+	if _, err := os.Stat(alice.filePath); err != nil {
+		t.Errorf("alice's stored element should remain: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package bolt
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+
+	"github.com/snowmerak/mls/lib/tree"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// nodesBucket holds one entry per element keyed by element name
+var nodesBucket = []byte("nodes")
+
+// Store keeps every element of a tree in one bbolt file
+// It is a tree.BatchStore: the writes of each tree operation share one bbolt
+// transaction, so an operation costs a single fsync and a crash never leaves it half
+// applied
+type Store struct {
+	db *bbolt.DB
+
+	mu      sync.Mutex
+	tx      *bbolt.Tx // write transaction of the running operation
+	txErr   error     // why the transaction of the running operation could not be started
+	written bool      // whether the running operation wrote anything
+}
+
+var _ tree.BatchStore = (*Store)(nil)
+
+// Open opens or creates the bbolt file at path
+func Open(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(nodesBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create nodes bucket: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// NewTree opens the bbolt file at path and returns an empty tree stored in it
+func NewTree(path string) (*tree.Tree, *Store, error) {
+	store, err := Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.NewTreeWithStore(store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// LoadTree opens the bbolt file at path and loads the tree rooted at headName
+func LoadTree(path string, headName string) (*tree.Tree, *Store, error) {
+	store, err := Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.LoadTreeFromStore(store, headName)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Key uses the element name as the bucket key
+func (s *Store) Key(name string) string {
+	return name
+}
+
+// Begin starts the write transaction holding the writes of one tree operation
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tx, s.txErr = s.db.Begin(true)
+	s.written = false
+	if s.txErr != nil {
+		s.txErr = fmt.Errorf("failed to begin transaction: %w", s.txErr)
+	}
+}
+
+// Commit commits the transaction of the operation, or rolls it back when opErr is set
+// Operations that wrote nothing are rolled back too, sparing the fsync
+func (s *Store) Commit(opErr error) error {
+	s.mu.Lock()
+	tx, txErr, written := s.tx, s.txErr, s.written
+	s.tx, s.txErr, s.written = nil, nil, false
+	s.mu.Unlock()
+
+	if tx == nil {
+		if opErr != nil {
+			return opErr
+		}
+		return txErr
+	}
+	if opErr != nil || !written {
+		tx.Rollback()
+		return opErr
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// update runs fn on the nodes bucket in the running transaction, or outside an
+// operation in a transaction of its own
+func (s *Store) update(fn func(b *bbolt.Bucket) error) error {
+	s.mu.Lock()
+	tx, txErr := s.tx, s.txErr
+	s.written = s.written || tx != nil
+	s.mu.Unlock()
+	if txErr != nil {
+		return txErr
+	}
+	if tx != nil {
+		return fn(tx.Bucket(nodesBucket))
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(tx.Bucket(nodesBucket))
+	})
+}
+
+// Write stores an element
+func (s *Store) Write(key string, data []byte) error {
+	// bbolt keeps the value until the transaction commits, past the caller's use of it
+	data = append([]byte(nil), data...)
+	return s.update(func(b *bbolt.Bucket) error {
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Read returns a copy of the stored element, including writes of the running transaction
+func (s *Store) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	tx, txErr := s.tx, s.txErr
+	s.mu.Unlock()
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	read := func(tx *bbolt.Tx) ([]byte, error) {
+		value := tx.Bucket(nodesBucket).Get([]byte(key))
+		if value == nil {
+			return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+		}
+		// bbolt values are only valid inside the transaction
+		return append([]byte(nil), value...), nil
+	}
+	if tx != nil {
+		return read(tx)
+	}
+	var data []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		data, err = read(tx)
+		return err
+	})
+	return data, err
+}
+
+// Remove deletes an element
+func (s *Store) Remove(key string) error {
+	return s.update(func(b *bbolt.Bucket) error {
+		return b.Delete([]byte(key))
+	})
+}
+
+// Close closes the underlying database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,99 @@
+package bolt
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltTreeRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "bolt_tree_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "tree.db")
+	tr, store, err := NewTree(path)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	headName := tr.Head().Name()
+	store.Close()
+
+	loaded, store, err := LoadTree(path, headName)
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	defer store.Close()
+
+	if got := len(loaded.GetLeaves()); got != 3 {
+		t.Errorf("expected 3 leaves after reload, got %d", got)
+	}
+	if _, ok := loaded.Find("bob"); !ok {
+		t.Errorf("bob not found after reload")
+	}
+}
+
+func TestBoltOperationsAreTransactional(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "tree.db")
+	tr, store, err := NewTree(path)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	headName := tr.Head().Name()
+	headKey := store.Key(headName)
+
+	// An operation that writes a new element and clobbers the head, then dies
+	store.Begin()
+	if err := store.Write(store.Key("charlie"), []byte("partial")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if err := store.Write(headKey, []byte("torn")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if data, err := store.Read(headKey); err != nil || string(data) != "torn" {
+		t.Errorf("the transaction should read its own writes, got %q, %v", data, err)
+	}
+	// A crash at this point leaves the file as the last commit wrote it
+	crashed := filepath.Join(tempDir, "crashed.db")
+	image, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	if err := os.WriteFile(crashed, image, 0600); err != nil {
+		t.Fatalf("Failed to write crash image: %v", err)
+	}
+	if err := store.Commit(errors.New("operation failed")); err == nil {
+		t.Fatalf("Commit should return the operation's error")
+	}
+	if _, err := store.Read(store.Key("charlie")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a rolled back write should not be stored, got %v", err)
+	}
+	store.Close()
+
+	for _, file := range []string{path, crashed} {
+		loaded, store, err := LoadTree(file, headName)
+		if err != nil {
+			t.Fatalf("%s: failed to load tree: %v", filepath.Base(file), err)
+		}
+		if got := len(loaded.GetLeaves()); got != 2 {
+			t.Errorf("%s: expected the 2 committed leaves, got %d", filepath.Base(file), got)
+		}
+		store.Close()
+	}
+}
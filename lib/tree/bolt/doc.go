@@ -0,0 +1,2 @@
+// Package bolt stores TreeKEM trees in a single bbolt database file
+package bolt
@@ -0,0 +1,15 @@
+module github.com/snowmerak/mls/lib/tree/bolt
+
+go 1.25.0
+
+require (
+	github.com/snowmerak/mls v0.0.0
+	go.etcd.io/bbolt v1.5.0
+)
+
+require (
+	github.com/google/flatbuffers v25.2.10+incompatible // indirect
+	golang.org/x/sys v0.45.0 // indirect
+)
+
+replace github.com/snowmerak/mls => ../../..
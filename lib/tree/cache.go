@@ -0,0 +1,84 @@
+package tree
+
+import "sync"
+
+// cacheStore keeps every encoded element in memory and writes through to the wrapped store
+// Reads are served from memory once a key was written or read; nothing is ever evicted
+type cacheStore struct {
+	inner Store
+
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// WithWriteThroughCache serves store reads from memory while every write still reaches the backend
+// Find, GetPath and GetNodesNeedingUpdate already work on resident elements; the cache
+// extends this to loads, reloads of unchanged nodes and slow backends
+// DetectExternalChanges and the Reload methods drop the cache so they observe the backend
+func WithWriteThroughCache() Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store := &cacheStore{inner: t.store, data: make(map[string][]byte)}
+		t.store = store
+		t.cache = store
+	}
+}
+
+// Key delegates to the wrapped store
+func (s *cacheStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write persists data and caches it once the backend accepted it
+func (s *cacheStore) Write(key string, data []byte) error {
+	if err := s.inner.Write(key, data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.data[key] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return nil
+}
+
+// Read serves cached data, filling the cache from the backend on a miss
+func (s *cacheStore) Read(key string) ([]byte, error) {
+	s.mu.RLock()
+	data, ok := s.data[key]
+	s.mu.RUnlock()
+	if ok {
+		return append([]byte(nil), data...), nil
+	}
+
+	data, err := s.inner.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.data[key] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Remove deletes the element from the backend and the cache
+func (s *cacheStore) Remove(key string) error {
+	s.mu.Lock()
+	delete(s.data, key)
+	s.mu.Unlock()
+	return s.inner.Remove(key)
+}
+
+// purge drops every cached element
+func (s *cacheStore) purge() {
+	s.mu.Lock()
+	s.data = make(map[string][]byte)
+	s.mu.Unlock()
+}
+
+// purgeCache drops cached elements before reading the backend directly
+func (t *Tree) purgeCache() {
+	if t.cache != nil {
+		t.cache.purge()
+	}
+}
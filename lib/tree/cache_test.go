@@ -0,0 +1,68 @@
+package tree
+
+import (
+	"os"
+	"testing"
+)
+
+// countingStore counts reads reaching the backend
+type countingStore struct {
+	Store
+	reads int
+}
+
+func (s *countingStore) Read(key string) ([]byte, error) {
+	s.reads++
+	return s.Store.Read(key)
+}
+
+func TestWriteThroughCacheServesReadsFromMemory(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	backend := &countingStore{Store: files}
+	tree, err := LoadTreeFromStore(backend, "", WithWriteThroughCache())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	backend.reads = 0
+	if _, found := tree.Find("charlie"); !found {
+		t.Fatalf("charlie not found")
+	}
+	if _, err := tree.GetPath("charlie"); err != nil {
+		t.Fatalf("GetPath failed: %v", err)
+	}
+	tree.GetNodesNeedingUpdate()
+	if changed, err := tree.DetectExternalChanges(); err != nil || len(changed) != 0 {
+		t.Fatalf("unexpected changes %v, %v", changed, err)
+	}
+	reads := backend.reads
+
+	// Writes are durable: a fresh tree over the backend sees every element
+	fresh, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := len(fresh.GetLeaves()); got != 4 {
+		t.Errorf("expected 4 durable leaves, got %d", got)
+	}
+
+	// Only DetectExternalChanges went to the backend, once per element
+	if want := len(tree.GetAllElements()); reads != want {
+		t.Errorf("expected %d backend reads, got %d", want, reads)
+	}
+
+	// External edits are still observed because reload paths bypass the cache
+	alice, _ := tree.Find("alice")
+	os.WriteFile(files.Key("alice"), []byte(`{"name":"alice","public_key":"ZWRpdGVk","node_type":"leaf"}`), 0644)
+	if err := tree.ReloadNode("alice"); err != nil {
+		t.Fatalf("ReloadNode failed: %v", err)
+	}
+	if string(alice.Value()) != "edited" {
+		t.Errorf("expected reloaded key, got %q", alice.Value())
+	}
+}
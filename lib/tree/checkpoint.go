@@ -0,0 +1,94 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// ErrCheckpointExists is returned when a checkpoint for the epoch was already written
+var ErrCheckpointExists = errors.New("checkpoint already exists")
+
+// CheckpointInfo is the metadata stored with a checkpoint
+type CheckpointInfo struct {
+	Epoch         uint64      `json:"epoch"`
+	Version       uint64      `json:"version"`    // tree version when the checkpoint was taken
+	CreatedAt     time.Time   `json:"created_at"` // when the checkpoint was taken
+	Leaves        int         `json:"leaves"`     // number of members
+	Ciphersuite   Ciphersuite `json:"ciphersuite,omitempty"`
+	StructureHash []byte      `json:"structure_hash"` // verified when the checkpoint is loaded
+}
+
+// checkpointFile is a checkpoint as stored
+type checkpointFile struct {
+	CheckpointInfo
+	Tree json.RawMessage `json:"tree"` // the tree in the Export format
+}
+
+// checkpointName returns the storage name of the checkpoint for epoch
+func checkpointName(epoch uint64) string {
+	return fmt.Sprintf("__checkpoint_%d__", epoch)
+}
+
+// Checkpoint writes an immutable snapshot of the tree tagged with epoch to the tree's store
+// A checkpoint is never overwritten; writing the same epoch twice fails with ErrCheckpointExists.
+// Use LoadCheckpoint to roll back or to serve the tree of a past epoch
+func (t *Tree) Checkpoint(epoch uint64) error {
+	if t.store == nil {
+		return errors.New("checkpoints need a store")
+	}
+	key := t.store.Key(checkpointName(epoch))
+	if _, err := t.store.Read(key); err == nil {
+		return fmt.Errorf("epoch %d: %w", epoch, ErrCheckpointExists)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check checkpoint for epoch %d: %w", epoch, err)
+	}
+
+	snapshot, err := t.marshalExport()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpointFile{
+		CheckpointInfo: CheckpointInfo{
+			Epoch:         epoch,
+			Version:       t.version,
+			CreatedAt:     time.Now(),
+			Leaves:        t.MemberCount(),
+			Ciphersuite:   t.ciphersuite,
+			StructureHash: t.StructureHash(),
+		},
+		Tree: snapshot,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if err := t.store.Write(key, data); err != nil {
+		return fmt.Errorf("failed to write checkpoint for epoch %d: %w", epoch, err)
+	}
+	return nil
+}
+
+// LoadCheckpoint restores the checkpoint for epoch from store into a tree persisted to target
+// A nil target keeps the restored tree in memory, which suits serving past epochs
+func LoadCheckpoint(store Store, epoch uint64, target Store, opts ...Option) (*Tree, CheckpointInfo, error) {
+	data, err := store.Read(store.Key(checkpointName(epoch)))
+	if err != nil {
+		return nil, CheckpointInfo{}, fmt.Errorf("failed to read checkpoint for epoch %d: %w", epoch, err)
+	}
+
+	var checkpoint checkpointFile
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, CheckpointInfo{}, fmt.Errorf("failed to unmarshal checkpoint for epoch %d: %w", epoch, err)
+	}
+	t, err := unmarshalExport(checkpoint.Tree, target, opts)
+	if err != nil {
+		return nil, CheckpointInfo{}, fmt.Errorf("failed to restore checkpoint for epoch %d: %w", epoch, err)
+	}
+	if !bytes.Equal(t.StructureHash(), checkpoint.StructureHash) {
+		return nil, CheckpointInfo{}, fmt.Errorf("checkpoint for epoch %d does not match its structure hash", epoch)
+	}
+	return t, checkpoint.CheckpointInfo, nil
+}
@@ -0,0 +1,71 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCheckpointRollback(t *testing.T) {
+	dir := t.TempDir()
+	tree, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		tree.Insert(name, []byte(name+"_key"))
+	}
+	if err := tree.Checkpoint(1); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+	epoch1 := tree.StructureHash()
+
+	tree.Insert("user_4", []byte("user_4_key"))
+	tree.Delete("user_0")
+	if err := tree.Checkpoint(1); !errors.Is(err, ErrCheckpointExists) {
+		t.Errorf("expected ErrCheckpointExists, got %v", err)
+	}
+	if err := tree.Checkpoint(2); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+
+	store, _ := NewFileStore(dir)
+	past, info, err := LoadCheckpoint(store, 1, nil)
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if !bytes.Equal(past.StructureHash(), epoch1) {
+		t.Errorf("checkpoint differs from the tree at epoch 1")
+	}
+	if info.Epoch != 1 || info.Leaves != 4 || info.CreatedAt.IsZero() {
+		t.Errorf("unexpected checkpoint metadata: %+v", info)
+	}
+
+	// Leaves counts members; the leaf user_0 left behind is blank, not a member
+	removed, info, err := LoadCheckpoint(store, 2, nil)
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if info.Leaves != 4 || info.Leaves != removed.MemberCount() {
+		t.Errorf("expected 4 members after a removal, got %d (tree has %d)", info.Leaves, removed.MemberCount())
+	}
+
+	// The live tree still loads; checkpoints sit beside its elements
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if !bytes.Equal(reloaded.StructureHash(), tree.StructureHash()) {
+		t.Errorf("checkpoints should not disturb the live tree")
+	}
+
+	if _, _, err := LoadCheckpoint(store, 3, nil); err == nil {
+		t.Errorf("expected an error for a missing checkpoint")
+	}
+	memoryOnly, _ := NewTreeWithStore(nil)
+	if err := memoryOnly.Checkpoint(1); err == nil {
+		t.Errorf("expected an error for a tree without a store")
+	}
+}
@@ -0,0 +1,133 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ChunkMarker identifies where a chunked transfer stopped so it can be resumed
+type ChunkMarker struct {
+	TreeHash []byte `json:"tree_hash"` // structure hash of the tree being transferred
+	NextNode int    `json:"next_node"` // node index the next chunk starts at
+}
+
+// TreeChunk is one piece of a chunked ratchet tree transfer
+type TreeChunk struct {
+	Sequence int         `json:"sequence"` // position of this chunk in the transfer
+	Nodes    []NodeInfo  `json:"nodes"`    // nodes in node index order
+	Next     ChunkMarker `json:"next"`     // marker to resume after this chunk
+	Final    bool        `json:"final"`    // true for the last chunk
+}
+
+// ExportRatchetTreeChunks splits the tree structure into chunks whose encoded nodes fit maxChunkBytes
+func (t *Tree) ExportRatchetTreeChunks(maxChunkBytes int) ([]TreeChunk, error) {
+	return t.ExportRatchetTreeChunksFrom(ChunkMarker{TreeHash: t.StructureHash()}, maxChunkBytes)
+}
+
+// ExportRatchetTreeChunksFrom resumes a chunked export at marker
+// The marker is rejected if the tree changed since the transfer started
+func (t *Tree) ExportRatchetTreeChunksFrom(marker ChunkMarker, maxChunkBytes int) ([]TreeChunk, error) {
+	if maxChunkBytes <= 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", maxChunkBytes)
+	}
+
+	treeHash := t.StructureHash()
+	if !bytes.Equal(marker.TreeHash, treeHash) {
+		return nil, fmt.Errorf("tree changed since transfer started")
+	}
+
+	nodes := t.nodeInfoByIndex()
+	if marker.NextNode < 0 || marker.NextNode > len(nodes) {
+		return nil, fmt.Errorf("invalid resume position: %d", marker.NextNode)
+	}
+
+	var chunks []TreeChunk
+	sequence := 0
+	current := TreeChunk{}
+	size := 0
+
+	flush := func(next int) {
+		current.Sequence = sequence
+		current.Next = ChunkMarker{TreeHash: treeHash, NextNode: next}
+		chunks = append(chunks, current)
+		sequence++
+		current = TreeChunk{}
+		size = 0
+	}
+
+	for i := marker.NextNode; i < len(nodes); i++ {
+		encoded, err := json.Marshal(nodes[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal node %d: %w", i, err)
+		}
+		if len(encoded) > maxChunkBytes {
+			return nil, fmt.Errorf("node %d needs %d bytes, exceeding chunk size %d", i, len(encoded), maxChunkBytes)
+		}
+		if size+len(encoded) > maxChunkBytes {
+			flush(i)
+		}
+		current.Nodes = append(current.Nodes, nodes[i])
+		size += len(encoded)
+	}
+
+	flush(len(nodes))
+	chunks[len(chunks)-1].Final = true
+	return chunks, nil
+}
+
+// nodeInfoByIndex returns node information ordered by node index
+func (t *Tree) nodeInfoByIndex() []NodeInfo {
+	nodes := make([]NodeInfo, 0, len(t.nodes))
+	for _, current := range t.nodes {
+		nodes = append(nodes, current.Info())
+	}
+	return nodes
+}
+
+// ChunkAssembler collects chunks received by a joining client
+type ChunkAssembler struct {
+	nodes    []NodeInfo
+	next     ChunkMarker
+	started  bool
+	complete bool
+}
+
+// Add appends a chunk, which must continue exactly where the previous one ended
+func (a *ChunkAssembler) Add(chunk TreeChunk) error {
+	if a.complete {
+		return fmt.Errorf("transfer already complete")
+	}
+	if a.started {
+		if !bytes.Equal(a.next.TreeHash, chunk.Next.TreeHash) {
+			return fmt.Errorf("chunk %d belongs to a different tree", chunk.Sequence)
+		}
+		if len(chunk.Nodes) > 0 && chunk.Nodes[0].NodeIndex != a.next.NextNode {
+			return fmt.Errorf("chunk %d starts at node %d, expected %d", chunk.Sequence, chunk.Nodes[0].NodeIndex, a.next.NextNode)
+		}
+	}
+
+	a.nodes = append(a.nodes, chunk.Nodes...)
+	a.next = chunk.Next
+	a.started = true
+	a.complete = chunk.Final
+	return nil
+}
+
+// Marker returns the position to resume from after an interrupted transfer
+func (a *ChunkAssembler) Marker() ChunkMarker {
+	return a.next
+}
+
+// Complete reports whether the final chunk has been received
+func (a *ChunkAssembler) Complete() bool {
+	return a.complete
+}
+
+// Nodes returns the assembled nodes in node index order
+func (a *ChunkAssembler) Nodes() ([]NodeInfo, error) {
+	if !a.complete {
+		return nil, fmt.Errorf("transfer incomplete, resume from node %d", a.next.NextNode)
+	}
+	return a.nodes, nil
+}
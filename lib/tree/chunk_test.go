@@ -0,0 +1,100 @@
+package tree
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestExportRatchetTreeChunks(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil)
+	for i := 0; i < 32; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_public_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	chunks, err := tree.ExportRatchetTreeChunks(1024)
+	if err != nil {
+		t.Fatalf("Failed to export chunks: %v", err)
+	}
+	t.Logf("청크 수: %d", len(chunks))
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(chunks))
+	}
+
+	// Simulate an interrupted transfer resumed from the assembler marker
+	var assembler ChunkAssembler
+	for _, chunk := range chunks[:2] {
+		if err := assembler.Add(chunk); err != nil {
+			t.Fatalf("Failed to add chunk: %v", err)
+		}
+	}
+	if _, err := assembler.Nodes(); err == nil {
+		t.Fatalf("expected incomplete transfer error")
+	}
+
+	resumed, err := tree.ExportRatchetTreeChunksFrom(assembler.Marker(), 1024)
+	if err != nil {
+		t.Fatalf("Failed to resume export: %v", err)
+	}
+	for _, chunk := range resumed {
+		if err := assembler.Add(chunk); err != nil {
+			t.Fatalf("Failed to add resumed chunk: %v", err)
+		}
+	}
+
+	nodes, err := assembler.Nodes()
+	if err != nil {
+		t.Fatalf("Failed to assemble nodes: %v", err)
+	}
+	if len(nodes) != len(tree.GetAllElements()) {
+		t.Errorf("expected %d nodes, got %d", len(tree.GetAllElements()), len(nodes))
+	}
+	for i, node := range nodes {
+		if node.NodeIndex != i {
+			t.Fatalf("node %d has index %d", i, node.NodeIndex)
+		}
+	}
+
+	// A marker from before a change must be rejected
+	tree.Insert("late_joiner", []byte("late_key"))
+	if _, err := tree.ExportRatchetTreeChunksFrom(assembler.Marker(), 1024); err == nil {
+		t.Errorf("expected stale marker to be rejected")
+	}
+}
+
+func TestChunksCarryLeafNodes(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tree.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	chunks, err := tree.ExportRatchetTreeChunks(4096)
+	if err != nil {
+		t.Fatalf("Failed to export chunks: %v", err)
+	}
+	var assembler ChunkAssembler
+	for _, chunk := range chunks {
+		if err := assembler.Add(chunk); err != nil {
+			t.Fatalf("Failed to add chunk: %v", err)
+		}
+	}
+	nodes, err := assembler.Nodes()
+	if err != nil {
+		t.Fatalf("Failed to assemble nodes: %v", err)
+	}
+
+	// Chunks carry the same node information as Element.Info
+	for i, node := range nodes {
+		if want := tree.GetNodeByIndex(i).Info(); !reflect.DeepEqual(node, want) {
+			t.Errorf("node %d: got %+v, want %+v", i, node, want)
+		}
+	}
+	if len(nodes[0].LeafNode) == 0 {
+		t.Errorf("leaf nodes should be carried in chunks")
+	}
+}
@@ -0,0 +1,53 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Clone returns an independent copy of the tree persisted under targetPath, or kept in
+// memory when targetPath is empty. The copy holds the same nodes, names, keys, leaf
+// nodes, key history and group state, and the same ciphersuite, group ID, credential
+// validation, history depth and element encoding; opts add to or override them.
+// Notifiers, tracers and store wrappers such as WithEncryption are not carried over.
+// Servers stage speculative changes, such as a trial commit, on a clone and discard it
+// or apply the outcome to the live tree; nothing done to one affects the other
+func (t *Tree) Clone(targetPath string, opts ...Option) (*Tree, error) {
+	if targetPath == "" {
+		return t.CloneToStore(nil, opts...)
+	}
+	if t.rootPath != "" && filepath.Clean(targetPath) == filepath.Clean(t.rootPath) {
+		return nil, errors.New("cannot clone a tree into its own directory")
+	}
+	store, err := NewFileStore(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clone store: %w", err)
+	}
+	clone, err := t.CloneToStore(store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	clone.rootPath = targetPath
+	return clone, nil
+}
+
+// CloneToStore is Clone persisting the copy to store, any backend; a nil store keeps it
+// in memory. The store should not hold another tree
+func (t *Tree) CloneToStore(store Store, opts ...Option) (*Tree, error) {
+	data, err := t.marshalExport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone tree: %w", err)
+	}
+	inherited := []Option{func(clone *Tree) {
+		clone.authService = t.authService
+		clone.historyDepth = t.historyDepth
+		clone.format = t.format
+		clone.readTxnTimeout = t.readTxnTimeout
+	}}
+	clone, err := unmarshalExport(data, store, append(inherited, opts...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone tree: %w", err)
+	}
+	return clone, nil
+}
@@ -0,0 +1,81 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir, WithKeyHistory(2))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	root := tr.Head().Name()
+	for _, key := range []string{"root_key_1", "root_key_2"} {
+		if err := tr.SetIntermediateNodeKey(root, []byte(key)); err != nil {
+			t.Fatalf("Failed to set root key: %v", err)
+		}
+	}
+	leaves := leafNames(tr)
+
+	if _, err := tr.Clone(dir); err == nil {
+		t.Errorf("cloning into the tree's own directory should fail")
+	}
+
+	target := t.TempDir()
+	clone, err := tr.Clone(target)
+	if err != nil {
+		t.Fatalf("Failed to clone tree: %v", err)
+	}
+	if !clone.Equal(tr) {
+		t.Fatalf("clone should equal its source, got %v", clone.StructuralDiff(tr))
+	}
+	if history := clone.Head().KeyHistory(0); len(history) != 1 || string(history[0].Key) != "root_key_1" {
+		t.Errorf("clone should keep key history, got %v", history)
+	}
+
+	// A trial commit on the clone leaves the live tree alone
+	if err := clone.SetIntermediateNodeKey(root, []byte("root_key_3")); err != nil {
+		t.Fatalf("Failed to set clone root key: %v", err)
+	}
+	if err := clone.Delete("alice"); err != nil {
+		t.Fatalf("Failed to delete from clone: %v", err)
+	}
+	if err := clone.Insert("eve", []byte("eve_key")); err != nil {
+		t.Fatalf("Failed to insert into clone: %v", err)
+	}
+	if got := leafNames(tr); !slices.Equal(got, leaves) {
+		t.Errorf("source leaves = %v, want %v", got, leaves)
+	}
+	if key := tr.Head().Value(); string(key) != "root_key_2" {
+		t.Errorf("source root key changed to %q", key)
+	}
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload source: %v", err)
+	}
+	if !reloaded.Equal(tr) {
+		t.Errorf("source store changed by the clone: %v", reloaded.StructuralDiff(tr))
+	}
+	reloadedClone, err := LoadTree(target, "")
+	if err != nil {
+		t.Fatalf("Failed to reload clone: %v", err)
+	}
+	if got, want := leafNames(reloadedClone), leafNames(clone); !slices.Equal(got, want) {
+		t.Errorf("reloaded clone leaves = %v, want %v", got, want)
+	}
+
+	memory, err := tr.Clone("")
+	if err != nil {
+		t.Fatalf("Failed to clone into memory: %v", err)
+	}
+	if !memory.Equal(tr) || memory.store != nil {
+		t.Errorf("in-memory clone should equal its source without a store")
+	}
+}
@@ -0,0 +1,214 @@
+package tree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// binaryMagic starts every binary encoded element; JSON elements always start with '{'
+// It is followed by the layout version, after which every field is always present
+var binaryMagic = []byte{0x00, 'T', 'K', 'B'}
+
+// binaryVersion is the layout written after binaryMagic
+const binaryVersion byte = 1
+
+// elementFormat selects how elements are encoded when written
+// Every format is recognized when reading, so a tree can switch formats at any time
+type elementFormat uint8
+
+const (
+	formatJSON elementFormat = iota
+	formatBinary
+	formatFlatBuffers
+)
+
+// WithBinaryEncoding writes elements with a compact length-prefixed binary codec instead of JSON
+// Existing JSON elements stay readable and are converted as they are rewritten
+func WithBinaryEncoding() Option {
+	return func(t *Tree) {
+		t.format = formatBinary
+	}
+}
+
+// encodeElementData encodes an element in the given format
+func encodeElementData(data elementData, format elementFormat) ([]byte, error) {
+	switch format {
+	case formatJSON:
+		return json.Marshal(data)
+	case formatFlatBuffers:
+		return encodeFlatBuffer(data), nil
+	}
+
+	out := append([]byte(nil), binaryMagic...)
+	out = append(out, binaryVersion)
+	out = appendBytes(out, []byte(data.Name))
+	out = appendBytes(out, data.PublicKey)
+	out = append(out, byte(data.KeyAlgorithm), byte(data.KeyEncoding))
+	out = binary.AppendVarint(out, int64(data.LeftCount))
+	out = binary.AppendVarint(out, int64(data.RightCount))
+	out = appendBytes(out, []byte(data.LeftChild))
+	out = appendBytes(out, []byte(data.RightChild))
+	out = appendBytes(out, []byte(data.NodeType))
+	out = binary.AppendVarint(out, int64(data.LeafIndex))
+	out = appendTime(out, data.LastModified)
+	out = appendTime(out, data.LastChecked)
+	out = binary.AppendUvarint(out, uint64(len(data.History)))
+	for _, record := range data.History {
+		out = appendBytes(out, record.Key)
+		out = append(out, byte(record.Algorithm), byte(record.Encoding))
+		out = binary.AppendUvarint(out, record.Epoch)
+		out = appendTime(out, record.ReplacedAt)
+	}
+	out = appendBytes(out, data.LeafNode)
+	out = appendBytes(out, data.ParentHash)
+	out = binary.AppendUvarint(out, uint64(len(data.Unmerged)))
+	for _, index := range data.Unmerged {
+		out = binary.AppendVarint(out, int64(index))
+	}
+	out = binary.AppendUvarint(out, data.Version)
+	return out, nil
+}
+
+// decodeElementData decodes an element written in any format
+func decodeElementData(encoded []byte) (elementData, error) {
+	if isFlatBuffer(encoded) {
+		node, err := openFlatBuffer(encoded)
+		if err != nil {
+			return elementData{}, err
+		}
+		data := flatSkeleton(&node)
+		flatPayload(&node, &data)
+		return data, nil
+	}
+
+	var data elementData
+	if len(encoded) < len(binaryMagic) || string(encoded[:len(binaryMagic)]) != string(binaryMagic) {
+		err := json.Unmarshal(encoded, &data)
+		return data, err
+	}
+
+	r := &byteReader{buf: encoded[len(binaryMagic):]}
+	if version := r.byte(); r.err == nil && version != binaryVersion {
+		return data, fmt.Errorf("unsupported binary element version %d", version)
+	}
+	data.Name = string(r.bytes())
+	data.PublicKey = r.bytes()
+	data.KeyAlgorithm = KeyAlgorithm(r.byte())
+	data.KeyEncoding = KeyEncoding(r.byte())
+	data.LeftCount = int(r.varint())
+	data.RightCount = int(r.varint())
+	data.LeftChild = string(r.bytes())
+	data.RightChild = string(r.bytes())
+	data.NodeType = string(r.bytes())
+	data.LeafIndex = int(r.varint())
+	data.LastModified = r.time()
+	data.LastChecked = r.time()
+	count := r.uvarint()
+	if count > uint64(len(r.buf)) {
+		return data, errors.New("corrupt binary element: history length out of range")
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		record := KeyRecord{Key: r.bytes()}
+		record.Algorithm = KeyAlgorithm(r.byte())
+		record.Encoding = KeyEncoding(r.byte())
+		record.Epoch = r.uvarint()
+		record.ReplacedAt = r.time()
+		data.History = append(data.History, record)
+	}
+	data.LeafNode = r.bytes()
+	data.ParentHash = r.bytes()
+	count = r.uvarint()
+	if count > uint64(len(r.buf)) {
+		return data, errors.New("corrupt binary element: unmerged leaf count out of range")
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		data.Unmerged = append(data.Unmerged, int(r.varint()))
+	}
+	data.Version = r.uvarint()
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.buf))
+	}
+	if r.err != nil {
+		return data, fmt.Errorf("corrupt binary element: %w", r.err)
+	}
+	return data, nil
+}
+
+// appendBytes appends a uvarint length followed by b
+func appendBytes(out, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// appendTime appends t as Unix nanoseconds, with 0 standing for the zero time
+func appendTime(out []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return binary.AppendVarint(out, 0)
+	}
+	return binary.AppendVarint(out, t.UnixNano())
+}
+
+// byteReader decodes binary fields and remembers the first error
+type byteReader struct {
+	buf []byte
+	err error
+}
+
+func (r *byteReader) fail(what string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("truncated %s", what)
+	}
+	r.buf = nil
+}
+
+func (r *byteReader) byte() byte {
+	if len(r.buf) < 1 {
+		r.fail("byte")
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *byteReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail("uvarint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *byteReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail("varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *byteReader) bytes() []byte {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail("field")
+		return nil
+	}
+	b := append([]byte(nil), r.buf[:n]...)
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *byteReader) time() time.Time {
+	nanos := r.varint()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,97 @@
+package tree
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBinaryEncodingRoundTrip(t *testing.T) {
+	data := elementData{
+		Name:         "alice",
+		PublicKey:    bytes.Repeat([]byte{0xab}, 32),
+		KeyAlgorithm: KeyAlgorithmX25519,
+		KeyEncoding:  KeyEncodingRaw,
+		LeftCount:    3,
+		RightCount:   2,
+		LeftChild:    "left.json",
+		RightChild:   "right.json",
+		NodeType:     "intermediate",
+		LeafIndex:    7,
+		LastModified: time.Unix(1700000000, 123),
+		History:      []KeyRecord{{Key: []byte("old"), Epoch: 4, ReplacedAt: time.Unix(1600000000, 0)}},
+	}
+
+	encoded, err := encodeElementData(data, formatBinary)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	jsonEncoded, _ := encodeElementData(data, formatJSON)
+	t.Logf("바이너리 %d바이트, JSON %d바이트", len(encoded), len(jsonEncoded))
+	if len(encoded) >= len(jsonEncoded)/2 {
+		t.Errorf("binary encoding should be much smaller than JSON: %d vs %d", len(encoded), len(jsonEncoded))
+	}
+
+	decoded, err := decodeElementData(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if decoded.Name != data.Name || !bytes.Equal(decoded.PublicKey, data.PublicKey) ||
+		decoded.KeyAlgorithm != data.KeyAlgorithm || decoded.LeftCount != 3 || decoded.RightChild != "right.json" ||
+		decoded.LeafIndex != 7 || !decoded.LastModified.Equal(data.LastModified) || !decoded.LastChecked.IsZero() ||
+		len(decoded.History) != 1 || decoded.History[0].Epoch != 4 {
+		t.Errorf("round trip mismatch: %+v", decoded)
+	}
+
+	for cut := len(binaryMagic); cut < len(encoded); cut++ {
+		if _, err := decodeElementData(encoded[:cut]); err == nil {
+			t.Fatalf("truncated element at %d bytes should fail to decode", cut)
+		}
+	}
+
+	future := append([]byte(nil), encoded...)
+	future[len(binaryMagic)] = binaryVersion + 1
+	if _, err := decodeElementData(future); err == nil {
+		t.Errorf("expected an unknown layout version to be rejected")
+	}
+}
+
+func TestBinaryEncodingReadsExistingJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	jsonTree, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		jsonTree.Insert(user, []byte(user+"_key"))
+	}
+
+	// Reopening with the binary codec reads the JSON files and writes new elements in binary
+	files, _ := NewFileStore(tempDir)
+	binaryTree, err := LoadTreeFromStore(files, "", WithBinaryEncoding())
+	if err != nil {
+		t.Fatalf("Failed to load JSON tree with binary encoding: %v", err)
+	}
+	if err := binaryTree.Insert("david", []byte("david_key")); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	raw, _ := os.ReadFile(files.Key("david"))
+	if !bytes.HasPrefix(raw, binaryMagic) {
+		t.Errorf("new element should be binary encoded")
+	}
+	raw, _ = os.ReadFile(files.Key("alice"))
+	if raw[0] != '{' {
+		t.Errorf("untouched element should still be JSON")
+	}
+
+	// A tree without the option reads the mixed directory
+	mixed, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load mixed tree: %v", err)
+	}
+	if string(mixed.StructureHash()) != string(binaryTree.StructureHash()) {
+		t.Errorf("mixed encodings should load to the same tree")
+	}
+}
@@ -0,0 +1,100 @@
+package tree
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compressedMagic starts every compressed element and is followed by the algorithm byte
+// Like binaryMagic it begins with a NUL, which no JSON element starts with, and it
+// differs from binaryMagic and the FlatBuffers root offset in its fourth byte
+var compressedMagic = []byte{0x00, 'T', 'K', 'Z'}
+
+// Compression algorithms recorded after compressedMagic
+const compressionGzip byte = 1
+
+// compressedStore gzips elements before handing them to the wrapped store
+// Elements written without compression remain readable. The store compresses each
+// element on its own; to keep a large tree in one file instead of thousands of small
+// ones, wrap a logstore.Store, which appends every element to a single log
+type compressedStore struct {
+	inner Store
+	level int
+}
+
+// WithCompression transparently gzips persisted elements
+// Apply it after WithEncryption so elements are compressed before they are encrypted
+func WithCompression(level int) Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		t.store = NewCompressedStore(t.store, level)
+	}
+}
+
+// NewCompressedStore wraps inner with gzip compression at the given level
+func NewCompressedStore(inner Store, level int) Store {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	return &compressedStore{inner: inner, level: level}
+}
+
+// Key delegates to the wrapped store
+func (s *compressedStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write compresses data behind the compression header
+func (s *compressedStore) Write(key string, data []byte) error {
+	var buf bytes.Buffer
+	buf.Write(compressedMagic)
+	buf.WriteByte(compressionGzip)
+
+	zw, err := gzip.NewWriterLevel(&buf, s.level)
+	if err != nil {
+		return fmt.Errorf("failed to create compressor: %w", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("failed to compress element: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress element: %w", err)
+	}
+	return s.inner.Write(key, buf.Bytes())
+}
+
+// Read decompresses elements carrying a compression header and passes plain ones through
+func (s *compressedStore) Read(key string) ([]byte, error) {
+	data, err := s.inner.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, compressedMagic) {
+		return data, nil
+	}
+	if len(data) == len(compressedMagic) || data[len(compressedMagic)] != compressionGzip {
+		return nil, fmt.Errorf("element %s uses an unknown compression algorithm", key)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data[len(compressedMagic)+1:]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compressed element: %w", err)
+	}
+	defer zr.Close()
+
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress element: %w", err)
+	}
+	return plain, nil
+}
+
+// Remove delegates to the wrapped store
+func (s *compressedStore) Remove(key string) error {
+	return s.inner.Remove(key)
+}
@@ -0,0 +1,69 @@
+package tree
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCompressedStorage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "compression_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Start uncompressed so the compressed tree has to read legacy files
+	plain, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	plain.Insert("alice", bytes.Repeat([]byte("a"), 256))
+	plain.Insert("bob", bytes.Repeat([]byte("b"), 256))
+
+	tree, err := LoadTree(tempDir, "", WithCompression(gzip.BestCompression))
+	if err != nil {
+		t.Fatalf("Failed to load legacy tree with compression: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		tree.Insert(name, bytes.Repeat([]byte{byte(i)}, 256))
+	}
+
+	user, _ := tree.Find("user_3")
+	raw, _ := os.ReadFile(user.filePath)
+	if !bytes.HasPrefix(raw, append(compressedMagic, compressionGzip)) {
+		t.Errorf("new elements should be stored compressed")
+	}
+	if len(raw) >= 256 {
+		t.Errorf("compressed element is not smaller: %d bytes", len(raw))
+	}
+
+	reloaded, err := LoadTree(tempDir, "", WithCompression(gzip.BestCompression))
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got := len(reloaded.GetLeaves()); got != 10 {
+		t.Errorf("expected 10 leaves after reload, got %d", got)
+	}
+}
+
+func TestCompressionHeader(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+	compressed := NewCompressedStore(store, gzip.DefaultCompression)
+
+	// Plain elements are passed through whatever their first byte
+	for _, plain := range [][]byte{[]byte(`{"name":"alice"}`), append([]byte(nil), binaryMagic...), {0x1f, 'x'}} {
+		store.Write(store.Key("plain"), plain)
+		if got, err := compressed.Read(store.Key("plain")); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("plain element %x read as %x, %v", plain, got, err)
+		}
+	}
+
+	store.Write(store.Key("future"), append(append([]byte(nil), compressedMagic...), 9, 1, 2, 3))
+	if _, err := compressed.Read(store.Key("future")); err == nil {
+		t.Errorf("expected an unknown algorithm to be rejected")
+	}
+}
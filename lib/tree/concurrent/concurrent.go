@@ -0,0 +1,179 @@
+// Package concurrent guards a tree with a read-write lock for servers handling
+// simultaneous joins, removals and key updates
+package concurrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Tree serializes mutations of a tree.Tree and lets reads run in parallel
+// Reads return copies, NodeInfo rather than *tree.Element, so nothing handed out is
+// written by a later mutation. Operations without a method here go through Read or
+// Write, Tree.Shelve included. The wrapped tree must not be used directly while it is
+// wrapped; payloads shelved with Tree.Shelve are reloaded by readers under the read lock,
+// which the tree serializes on its own
+type Tree struct {
+	mu   sync.RWMutex
+	tree *tree.Tree
+}
+
+// New wraps t
+func New(t *tree.Tree) *Tree {
+	return &Tree{tree: t}
+}
+
+// Read calls fn with the tree held for reading; fn must not mutate it or keep elements
+func (c *Tree) Read(fn func(t *tree.Tree)) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fn(c.tree)
+}
+
+// Write calls fn with the tree held exclusively and returns its error
+func (c *Tree) Write(fn func(t *tree.Tree) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fn(c.tree)
+}
+
+// Insert adds a member holding value, see tree.Tree.Insert
+func (c *Tree) Insert(name string, value []byte) error {
+	return c.Write(func(t *tree.Tree) error { return t.Insert(name, value) })
+}
+
+// InsertLeafNode adds a member from its key package leaf, see tree.Tree.InsertLeafNode
+func (c *Tree) InsertLeafNode(name string, leaf *tree.LeafNode) error {
+	return c.Write(func(t *tree.Tree) error { return t.InsertLeafNode(name, leaf) })
+}
+
+// UpdateLeafNode replaces a member's leaf node, see tree.Tree.UpdateLeafNode
+func (c *Tree) UpdateLeafNode(name string, leaf *tree.LeafNode) error {
+	return c.Write(func(t *tree.Tree) error { return t.UpdateLeafNode(name, leaf) })
+}
+
+// Delete removes the element name, see tree.Tree.Delete
+func (c *Tree) Delete(name string) error {
+	return c.Write(func(t *tree.Tree) error { return t.Delete(name) })
+}
+
+// DeleteBatch removes several members as one operation, see tree.Tree.DeleteBatch
+func (c *Tree) DeleteBatch(names []string) error {
+	return c.Write(func(t *tree.Tree) error { return t.DeleteBatch(names) })
+}
+
+// SetIntermediateNodeKey sets the key of an intermediate node, see
+// tree.Tree.SetIntermediateNodeKey
+func (c *Tree) SetIntermediateNodeKey(nodeName string, publicKey []byte) error {
+	return c.Write(func(t *tree.Tree) error { return t.SetIntermediateNodeKey(nodeName, publicKey) })
+}
+
+// SetIntermediateNodeKeyIfVersion sets the key of an intermediate node still at version
+// expected, see tree.Tree.SetIntermediateNodeKeyIfVersion
+func (c *Tree) SetIntermediateNodeKeyIfVersion(nodeName string, publicKey []byte, expected uint64) error {
+	return c.Write(func(t *tree.Tree) error { return t.SetIntermediateNodeKeyIfVersion(nodeName, publicKey, expected) })
+}
+
+// Snapshot returns an immutable view of the tree that readers may traverse without
+// holding the lock, see tree.Tree.Snapshot
+func (c *Tree) Snapshot() *tree.Snapshot {
+	// Snapshot records the copies it took on the tree, so it excludes other readers
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.Snapshot()
+}
+
+// AtRevision returns the tree as committed at revision, see tree.Tree.AtRevision
+func (c *Tree) AtRevision(revision uint64) (*tree.Snapshot, error) {
+	// The current revision may be snapshotted on demand, which records its copies
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.AtRevision(revision)
+}
+
+// Find returns the node named name
+func (c *Tree) Find(name string) (tree.NodeInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	element, found := c.tree.Find(name)
+	if !found {
+		return tree.NodeInfo{}, false
+	}
+	return element.Info(), true
+}
+
+// GetPathNodes returns the node indices and keys from the root down to leaf name
+func (c *Tree) GetPathNodes(leafName string) ([]tree.PathNode, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.GetPathNodes(leafName)
+}
+
+// GetGroupPublicKey returns the root's public key
+func (c *Tree) GetGroupPublicKey() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.GetGroupPublicKey()
+}
+
+// GetTreeStructure returns every node by name, see tree.Tree.GetTreeStructure
+func (c *Tree) GetTreeStructure() map[string]*tree.NodeInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.GetTreeStructure()
+}
+
+// Version returns the number of successful mutations
+func (c *Tree) Version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.Version()
+}
+
+// ReadTxn pins the current version for a sequence of reads that need no lock
+func (c *Tree) ReadTxn() (*tree.ReadTxn, error) {
+	// The transaction is a snapshot, which records its copies on the tree
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.ReadTxn()
+}
+
+// GetModifiedNodes returns the nodes modified since since, see tree.Tree.GetModifiedNodes
+func (c *Tree) GetModifiedNodes(since time.Time) []tree.NodeInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return infos(c.tree.GetModifiedNodes(since))
+}
+
+// GetNodeChangesSince is GetModifiedNodes
+func (c *Tree) GetNodeChangesSince(since time.Time) []tree.NodeInfo {
+	return c.GetModifiedNodes(since)
+}
+
+// GetNodesNeedingUpdate returns the nodes modified after their last check
+func (c *Tree) GetNodesNeedingUpdate() []tree.NodeInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return infos(c.tree.GetNodesNeedingUpdate())
+}
+
+// MarkAllAsChecked marks every node checked, which writes each of them
+func (c *Tree) MarkAllAsChecked() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tree.MarkAllAsChecked()
+}
+
+// infos copies elements out as NodeInfo; the caller holds the lock
+func infos(elements []*tree.Element) []tree.NodeInfo {
+	if len(elements) == 0 {
+		return nil
+	}
+	nodes := make([]tree.NodeInfo, len(elements))
+	for i, element := range elements {
+		nodes[i] = element.Info()
+	}
+	return nodes
+}
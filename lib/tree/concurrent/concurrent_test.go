@@ -0,0 +1,165 @@
+package concurrent
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestConcurrentMutations(t *testing.T) {
+	files, _ := tree.NewFileStore(t.TempDir())
+	tr, _ := tree.NewTreeWithStore(files)
+	c := New(tr)
+	start := time.Now()
+
+	const writers, perWriter = 8, 16
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				name := fmt.Sprintf("user_%d_%d", w, i)
+				if err := c.Insert(name, []byte(name+"_key")); err != nil {
+					t.Errorf("Failed to insert %s: %v", name, err)
+				}
+				if i%4 == 3 {
+					if err := c.Delete(fmt.Sprintf("user_%d_%d", w, i-1)); err != nil {
+						t.Errorf("Failed to delete: %v", err)
+					}
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				name := fmt.Sprintf("user_%d_%d", w, i)
+				if info, found := c.Find(name); found && info.Name != name {
+					t.Errorf("found %s looking for %s", info.Name, name)
+				}
+				c.GetPathNodes(name)
+				c.GetModifiedNodes(start)
+				c.GetGroupPublicKey()
+			}
+		}()
+	}
+	wg.Wait()
+
+	members, leaves := 0, 0
+	leafIndices := make(map[int]bool)
+	c.Read(func(t *tree.Tree) {
+		for _, leaf := range t.GetLeaves() {
+			leaves++
+			leafIndices[leaf.LeafIndex()] = true
+			if !leaf.IsBlank() {
+				members++
+			}
+		}
+	})
+	if len(leafIndices) != leaves {
+		t.Errorf("%d leaves share %d leaf indices", leaves, len(leafIndices))
+	}
+	if want := writers * (perWriter - perWriter/4); members != want {
+		t.Errorf("members = %d, want %d", members, want)
+	}
+	for w := range writers {
+		if _, found := c.Find(fmt.Sprintf("user_%d_0", w)); !found {
+			t.Errorf("user_%d_0 should be a member", w)
+		}
+		if _, found := c.Find(fmt.Sprintf("user_%d_2", w)); found {
+			t.Errorf("user_%d_2 should have been deleted", w)
+		}
+	}
+	if got := len(c.GetModifiedNodes(start)); got != len(c.GetTreeStructure()) {
+		t.Errorf("every node was written after start, got %d modified", got)
+	}
+
+	c.MarkAllAsChecked()
+	if pending := c.GetNodesNeedingUpdate(); len(pending) != 0 {
+		t.Errorf("%d nodes still need an update after MarkAllAsChecked", len(pending))
+	}
+	if err := c.Write(func(t *tree.Tree) error { return t.Blank("user_0_0") }); err != nil {
+		t.Fatalf("Failed to blank through Write: %v", err)
+	}
+	if len(c.GetNodesNeedingUpdate()) == 0 {
+		t.Errorf("blanking should leave nodes needing an update")
+	}
+}
+
+func TestSnapshotReadsDuringWrites(t *testing.T) {
+	tr, _ := tree.NewTreeWithStore(nil)
+	c := New(tr)
+	for i := 0; i < 4; i++ {
+		if err := c.Insert(fmt.Sprintf("seed_%d", i), []byte("key")); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := c.Insert(fmt.Sprintf("member_%d", i), []byte("key")); err != nil {
+				t.Errorf("Failed to insert: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		snap := c.Snapshot()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			want := len(snap.GetLeaves())
+			for j := 0; j < 5; j++ {
+				if got := len(snap.GetLeaves()); got != want {
+					t.Errorf("snapshot changed from %d to %d leaves", want, got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentReadsOfShelvedNodes(t *testing.T) {
+	files, _ := tree.NewFileStore(t.TempDir())
+	tr, _ := tree.NewTreeWithStore(files)
+	c := New(tr)
+	names := []string{"alice", "bob", "charlie", "david"}
+	for _, name := range names {
+		if err := c.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := c.Write(func(t *tree.Tree) error { _, err := t.Shelve(0); return err }); err != nil {
+		t.Fatalf("Failed to shelve: %v", err)
+	}
+
+	// Every reader loads the same shelved payloads under the read lock
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range names {
+				info, found := c.Find(name)
+				if !found || string(info.PublicKey) != name+"_key" {
+					t.Errorf("unexpected key %q for %s", info.PublicKey, name)
+				}
+				c.GetPathNodes(name)
+			}
+			c.GetTreeStructure()
+		}()
+	}
+	wg.Wait()
+
+	c.Read(func(tr *tree.Tree) {
+		if shelved := tr.ShelvedCount(); shelved != 0 {
+			t.Errorf("%d nodes still shelved after reading all of them", shelved)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package tree
+
+import "fmt"
+
+// CopathKey is one encryption target of an UpdatePath: a node in the resolution of a
+// copath node and the public key a path secret is encrypted to
+type CopathKey struct {
+	Copath    int    // RFC 9420 node index of the copath node whose resolution holds the target
+	NodeIndex int    // RFC 9420 node index of the target
+	PublicKey []byte // the target's encryption key
+}
+
+// GetCopathPublicKeys returns the encryption targets of an UpdatePath sent by the leaf
+// with the given leaf index: the resolution of each copath node, nearest the leaf first
+// and in resolution order within a copath node. Copath nodes with an empty resolution
+// contribute nothing, which is why their parents drop out of FilteredDirectPath
+func (t *Tree) GetCopathPublicKeys(leafIndex int) ([]CopathKey, error) {
+	leaf := t.leafByIndex(leafIndex)
+	if leaf == nil {
+		return nil, fmt.Errorf("leaf %d not found", leafIndex)
+	}
+	var keys []CopathKey
+	for node := leaf; node.parent != nil; node = node.parent {
+		copath := node.Sibling()
+		for _, target := range t.resolution(copath) {
+			keys = append(keys, CopathKey{Copath: copath.nodeIndex, NodeIndex: target.nodeIndex, PublicKey: target.key()})
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,65 @@
+package tree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetCopathPublicKeys(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	find := func(name string) *Element {
+		element, found := tr.Find(name)
+		if !found {
+			t.Fatalf("%s not found", name)
+		}
+		return element
+	}
+	check := func(leafIndex int, want []*Element, copaths []*Element) {
+		t.Helper()
+		keys, err := tr.GetCopathPublicKeys(leafIndex)
+		if err != nil {
+			t.Fatalf("Failed to get copath keys: %v", err)
+		}
+		if len(keys) != len(want) {
+			t.Fatalf("got %d copath keys, want %d: %+v", len(keys), len(want), keys)
+		}
+		for i, key := range keys {
+			if key.NodeIndex != want[i].NodeIndex() || !bytes.Equal(key.PublicKey, want[i].key()) || key.Copath != copaths[i].NodeIndex() {
+				t.Errorf("copath key %d = %+v, want %s below node %d", i, key, want[i].Name(), copaths[i].NodeIndex())
+			}
+		}
+	}
+	alice, bob, charlie, dave := find("alice"), find("bob"), find("charlie"), find("dave")
+	right := charlie.Parent()
+
+	// The blank parent of charlie and dave resolves to both of them
+	check(alice.LeafIndex(), []*Element{bob, charlie, dave}, []*Element{bob, right, right})
+	// In RFC 9420 node indices: bob is node 2, charlie and dave are nodes 4 and 6 below 5
+	keys, _ := tr.GetCopathPublicKeys(0)
+	for i, want := range [][2]int{{2, 2}, {5, 4}, {5, 6}} {
+		if keys[i].Copath != want[0] || keys[i].NodeIndex != want[1] {
+			t.Errorf("copath key %d at node %d below %d, want %d below %d", i, keys[i].NodeIndex, keys[i].Copath, want[1], want[0])
+		}
+	}
+
+	if _, err := tr.SetPathKeys("charlie", testPathKeys(t, 2)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	check(alice.LeafIndex(), []*Element{bob, right}, []*Element{bob, right})
+
+	// A blank copath leaf is no target
+	if err := tr.Blank("bob"); err != nil {
+		t.Fatalf("Failed to blank bob: %v", err)
+	}
+	check(alice.LeafIndex(), []*Element{right}, []*Element{right})
+	check(dave.LeafIndex(), []*Element{charlie, alice}, []*Element{charlie, alice.Parent()})
+
+	if _, err := tr.GetCopathPublicKeys(99); err == nil {
+		t.Errorf("unknown leaf indices should be rejected")
+	}
+}
@@ -0,0 +1,216 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCredentialRejected is returned when the authentication hook refuses a member's credential
+var ErrCredentialRejected = errors.New("credential rejected by authentication service")
+
+// AuthService is the deployment's Authentication Service (RFC 9420 section 5.3)
+// The tree consults it whenever a leaf node enters the tree: on InsertLeafNode,
+// InsertFromKeyPackage, UpdateLeafNode and ApplyUpdatePath. Leaves inserted as bare
+// keys are not checked
+type AuthService interface {
+	// ValidateCredential vets cred presented with signatureKey for the leaf name
+	// It runs after the credential passed the package's ValidateCredential, so X.509
+	// chains are already parsed and bound to signatureKey
+	ValidateCredential(name string, cred Credential, signatureKey []byte) error
+	// Identity maps a credential to the member identity it names. InsertFromKeyPackage
+	// names new leaves after it, and updates must keep the member's identity
+	Identity(cred Credential) (string, error)
+}
+
+// WithAuthService installs the Authentication Service consulted on insert and update
+func WithAuthService(service AuthService) Option {
+	return func(t *Tree) {
+		t.authService = service
+	}
+}
+
+// AuthenticationHook is an AuthService that only validates credentials and maps them
+// to their Subject
+type AuthenticationHook func(name string, cred Credential, signatureKey []byte) error
+
+// ValidateCredential implements AuthService
+func (h AuthenticationHook) ValidateCredential(name string, cred Credential, signatureKey []byte) error {
+	return h(name, cred, signatureKey)
+}
+
+// Identity implements AuthService
+func (h AuthenticationHook) Identity(cred Credential) (string, error) {
+	if subject := cred.Subject(); subject != "" {
+		return subject, nil
+	}
+	return "", errors.New("credential names no subject")
+}
+
+// WithAuthenticationHook installs hook as the tree's AuthService, see WithAuthService
+func WithAuthenticationHook(hook AuthenticationHook) Option {
+	return func(t *Tree) {
+		if hook != nil {
+			t.authService = hook
+		}
+	}
+}
+
+// Subject returns the identity the credential names
+// Basic credentials name their identity bytes; X.509 credentials the leaf certificate's
+// common name, falling back to its first email, DNS or URI subject alternative name
+func (c Credential) Subject() string {
+	switch c.Type {
+	case CredentialBasic:
+		return string(c.Identity)
+	case CredentialX509:
+		if len(c.Certificates) == 0 {
+			return ""
+		}
+		cert, err := x509.ParseCertificate(c.Certificates[0])
+		if err != nil {
+			return ""
+		}
+		switch {
+		case cert.Subject.CommonName != "":
+			return cert.Subject.CommonName
+		case len(cert.EmailAddresses) > 0:
+			return cert.EmailAddresses[0]
+		case len(cert.DNSNames) > 0:
+			return cert.DNSNames[0]
+		case len(cert.URIs) > 0:
+			return cert.URIs[0].String()
+		}
+	}
+	return ""
+}
+
+// Chain parses an X.509 credential's certificates, leaf first
+func (c Credential) Chain() ([]*x509.Certificate, error) {
+	if c.Type != CredentialX509 {
+		return nil, fmt.Errorf("credential type %d has no certificate chain", c.Type)
+	}
+	if len(c.Certificates) == 0 {
+		return nil, errors.New("x509 credential has no certificates")
+	}
+	chain := make([]*x509.Certificate, len(c.Certificates))
+	for i, der := range c.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %d: %w", i, err)
+		}
+		chain[i] = cert
+	}
+	return chain, nil
+}
+
+// ValidateCredential checks cred is well formed and belongs to signatureKey
+// An X.509 chain must parse, every certificate must be signed by the next one and the
+// leaf certificate must hold signatureKey. Whether the chain's root is trusted is the
+// Authentication Service's call, see VerifyX509Chain
+func ValidateCredential(cred Credential, signatureKey []byte) error {
+	switch cred.Type {
+	case CredentialBasic:
+		if len(cred.Identity) == 0 {
+			return errors.New("basic credential has an empty identity")
+		}
+		return nil
+	case CredentialX509:
+	default:
+		return fmt.Errorf("unsupported credential type %d", cred.Type)
+	}
+
+	chain, err := cred.Chain()
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("certificate %d is not signed by certificate %d: %w", i, i+1, err)
+		}
+	}
+	certKey, err := signatureKeyBytes(chain[0].PublicKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(certKey, signatureKey) {
+		return errors.New("leaf certificate does not hold the leaf's signature key")
+	}
+	return nil
+}
+
+// signatureKeyBytes returns the MLS wire encoding of a certificate public key
+func signatureKeyBytes(pub any) ([]byte, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		return pub.Bytes()
+	}
+	return nil, fmt.Errorf("unsupported certificate key type %T", pub)
+}
+
+// VerifyX509Chain returns an AuthenticationHook accepting X.509 credentials that chain to
+// roots at the current time; basic credentials are refused
+func VerifyX509Chain(roots *x509.CertPool) AuthenticationHook {
+	return func(name string, cred Credential, _ []byte) error {
+		chain, err := cred.Chain()
+		if err != nil {
+			return err
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err = chain[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   time.Now(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+}
+
+// authenticate runs the Authentication Service on a validated leaf node
+// A leaf replacing name's current leaf node must map to the same identity
+func (t *Tree) authenticate(name string, leaf *LeafNode) error {
+	if t.authService == nil {
+		return nil
+	}
+	if err := t.authService.ValidateCredential(name, leaf.Credential, leaf.SignatureKey); err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialRejected, err)
+	}
+	current, found := t.Find(name)
+	if !found || !current.IsLeaf() || current.LeafNode() == nil {
+		return nil
+	}
+	before, err := t.authService.Identity(current.LeafNode().Credential)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialRejected, err)
+	}
+	after, err := t.authService.Identity(leaf.Credential)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialRejected, err)
+	}
+	if before != after {
+		return fmt.Errorf("%w: identity changes from %s to %s", ErrCredentialRejected, before, after)
+	}
+	return nil
+}
+
+// memberIdentity returns the identity a new member's leaf node is named after
+func (t *Tree) memberIdentity(kp KeyPackage) (string, error) {
+	if t.authService == nil {
+		return kp.Identity(), nil
+	}
+	identity, err := t.authService.Identity(kp.Leaf().Credential)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCredentialRejected, err)
+	}
+	return identity, nil
+}
@@ -0,0 +1,173 @@
+package tree
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testX509LeafNode returns a leaf node whose credential is a leaf certificate for
+// commonName issued by a fresh CA, and the CA certificate
+func testX509LeafNode(t *testing.T, commonName string) (*LeafNode, *x509.Certificate) {
+	t.Helper()
+	caPub, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPub, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	leaf, signer := newTestLeafNode(t, "")
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, ed25519.PublicKey(leaf.SignatureKey), caKey)
+	if err != nil {
+		t.Fatalf("Failed to create leaf certificate: %v", err)
+	}
+	leaf.Credential = Credential{Type: CredentialX509, Certificates: [][]byte{leafDER, caDER}}
+	if err := leaf.Sign(signer, nil, 0); err != nil {
+		t.Fatalf("Failed to sign leaf node: %v", err)
+	}
+	return leaf, ca
+}
+
+func TestValidateCredential(t *testing.T) {
+	leaf, _ := testX509LeafNode(t, "alice@example.com")
+	if err := ValidateCredential(leaf.Credential, leaf.SignatureKey); err != nil {
+		t.Fatalf("valid chain should be accepted: %v", err)
+	}
+	if got := leaf.Identity(); got != "alice@example.com" {
+		t.Errorf("x509 identity should be the leaf common name, got %q", got)
+	}
+
+	other := testLeafNode(t, "bob")
+	if err := ValidateCredential(leaf.Credential, other.SignatureKey); err == nil {
+		t.Errorf("certificate for another signature key should be rejected")
+	}
+	_, otherCA := testX509LeafNode(t, "mallory")
+	forged := leaf.Credential
+	forged.Certificates = [][]byte{forged.Certificates[0], otherCA.Raw}
+	if err := ValidateCredential(forged, leaf.SignatureKey); err == nil {
+		t.Errorf("chain with a foreign issuer should be rejected")
+	}
+	garbage := Credential{Type: CredentialX509, Certificates: [][]byte{[]byte("not a certificate")}}
+	if err := ValidateCredential(garbage, leaf.SignatureKey); err == nil {
+		t.Errorf("unparsable certificate should be rejected")
+	}
+	if err := ValidateCredential(Credential{Type: 7}, nil); err == nil {
+		t.Errorf("unknown credential type should be rejected")
+	}
+}
+
+func TestAuthenticationHook(t *testing.T) {
+	alice, ca := testX509LeafNode(t, "alice")
+	mallory, _ := testX509LeafNode(t, "mallory")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	tr, _ := NewTreeWithStore(nil, WithAuthenticationHook(VerifyX509Chain(roots)))
+	if err := tr.InsertLeafNode("alice", alice); err != nil {
+		t.Fatalf("member with a trusted chain should be admitted: %v", err)
+	}
+	if err := tr.InsertLeafNode("mallory", mallory); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("untrusted chain should be rejected by the hook, got %v", err)
+	}
+	if err := tr.InsertLeafNode("bob", testLeafNode(t, "bob")); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("basic credential should be rejected by the x509 hook, got %v", err)
+	}
+
+	// Custom hooks see the leaf name, e.g. to require it to match the credential
+	var checked []string
+	named, _ := NewTreeWithStore(nil, WithAuthenticationHook(func(name string, cred Credential, _ []byte) error {
+		checked = append(checked, name)
+		if cred.Subject() != name {
+			return errors.New("leaf name does not match the credential")
+		}
+		return nil
+	}))
+	if err := named.InsertLeafNode("bob", testLeafNode(t, "bob")); err != nil {
+		t.Errorf("matching name should be admitted: %v", err)
+	}
+	if err := named.UpdateLeafNode("bob", testUpdateLeafNode(t, named, "bob", "eve")); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("update to another identity should be rejected, got %v", err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("hook should run on insert and update, ran %d times", len(checked))
+	}
+}
+
+// directory is an AuthService backed by a user directory keyed by basic identity
+type directory map[string]string
+
+func (d directory) ValidateCredential(_ string, cred Credential, _ []byte) error {
+	if _, ok := d[string(cred.Identity)]; !ok {
+		return errors.New("unknown user")
+	}
+	return nil
+}
+
+func (d directory) Identity(cred Credential) (string, error) {
+	user, ok := d[string(cred.Identity)]
+	if !ok {
+		return "", errors.New("unknown user")
+	}
+	return user, nil
+}
+
+// leafKeyPackage admits a bare key package leaf node through InsertFromKeyPackage
+type leafKeyPackage struct{ leaf *LeafNode }
+
+func (kp leafKeyPackage) Validate(Ciphersuite, time.Time) error { return nil }
+func (kp leafKeyPackage) Identity() string                      { return kp.leaf.Identity() }
+func (kp leafKeyPackage) Leaf() *LeafNode                       { return kp.leaf }
+func (kp leafKeyPackage) EncryptionKey() PublicKey {
+	return PublicKey{Algorithm: KeyAlgorithmX25519, Encoding: KeyEncodingRaw, Data: kp.leaf.EncryptionKey}
+}
+
+func TestAuthService(t *testing.T) {
+	users := directory{"alice-device-1": "alice", "alice-device-2": "alice", "bob-phone": "bob"}
+	tr, _ := NewTreeWithStore(nil, WithAuthService(users))
+
+	if err := tr.InsertFromKeyPackage(leafKeyPackage{testLeafNode(t, "alice-device-1")}); err != nil {
+		t.Fatalf("known user should be admitted: %v", err)
+	}
+	if _, found := tr.Find("alice"); !found {
+		t.Errorf("leaves should be named after the identity the service maps the credential to")
+	}
+	if err := tr.InsertFromKeyPackage(leafKeyPackage{testLeafNode(t, "mallory")}); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("unknown users should be rejected, got %v", err)
+	}
+	if err := tr.InsertLeafNode("bob", testLeafNode(t, "bob-phone")); err != nil {
+		t.Fatalf("Failed to insert bob: %v", err)
+	}
+
+	// Updates may change the credential but not the identity it maps to
+	if err := tr.UpdateLeafNode("alice", testUpdateLeafNode(t, tr, "alice", "alice-device-2")); err != nil {
+		t.Errorf("alice should be able to move to another of their credentials: %v", err)
+	}
+	if err := tr.UpdateLeafNode("alice", testUpdateLeafNode(t, tr, "alice", "bob-phone")); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("alice should not take over bob's identity, got %v", err)
+	}
+	if err := tr.UpdateLeafNode("bob", testUpdateLeafNode(t, tr, "bob", "mallory")); !errors.Is(err, ErrCredentialRejected) {
+		t.Errorf("unknown credentials should be rejected on update, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package tree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// debounceStore writes elements once the tree has not changed for the quiet interval
+// A commit saves the nodes on a path several times in quick succession; only the last
+// of those writes reaches the backend
+type debounceStore struct {
+	inner Store
+	quiet time.Duration
+	group func() func(err error) error // groups one flush in the layers below, see batchLayers
+
+	wrapsJournal     bool // the atomic-writes journal sits below
+	wrapsWriteBehind bool // write-behind sits below
+
+	flushMu sync.Mutex // serializes flushes, held during backend I/O
+	mu      sync.Mutex // guards the fields below, never held during backend I/O
+	seq     uint64
+	pending map[string]pendingOp // newest unwritten op per key, serves reads
+	timer   *time.Timer
+	err     error
+	onError func(error) // notified of every failed flush, see WithWriteBehindErrorHandler
+	closed  bool
+}
+
+// WithDebouncedWrites holds writes until the tree has been left alone for quiet, then
+// writes the newest state of every changed element at once in the background
+// Elements are written in the order they last changed, so children still precede the
+// parents that reference them, and one flush is one batch of the atomic-writes journal
+// or batching backend below. Barrier and Close write everything pending at once; a
+// crash loses the changes of the last quiet interval
+func WithDebouncedWrites(quiet time.Duration) Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store := &debounceStore{
+			inner:            t.store,
+			quiet:            quiet,
+			pending:          make(map[string]pendingOp),
+			onError:          t.onWriteError,
+			wrapsJournal:     t.journal != nil,
+			wrapsWriteBehind: t.writeBehind != nil,
+		}
+		store.group = func() func(err error) error {
+			return t.groupWrites(t.batchLayers(true))
+		}
+		t.store = store
+		t.debounce = store
+	}
+}
+
+// Key delegates to the wrapped store
+func (s *debounceStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write schedules data for key, replacing any write still waiting
+func (s *debounceStore) Write(key string, data []byte) error {
+	return s.schedule(pendingOp{key: key, data: append([]byte(nil), data...)})
+}
+
+// Remove schedules the removal of key
+func (s *debounceStore) Remove(key string) error {
+	return s.schedule(pendingOp{key: key, remove: true})
+}
+
+// Read serves waiting operations before falling back to the wrapped store
+// An operation keeps serving reads until its flush has committed
+func (s *debounceStore) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	op, ok := s.pending[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return s.inner.Read(key)
+	}
+	if op.remove {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return append([]byte(nil), op.data...), nil
+}
+
+// schedule records op and restarts the quiet interval
+func (s *debounceStore) schedule(op pendingOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("debounced store is closed")
+	}
+	s.seq++
+	op.seq = s.seq
+	s.pending[op.key] = op
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.quiet, s.fire)
+	} else {
+		s.timer.Reset(s.quiet)
+	}
+	return s.err
+}
+
+// fire flushes once the quiet interval passed without a newer write
+// Failures reach the error handler and the next mutation, see flush
+func (s *debounceStore) fire() {
+	s.flush()
+}
+
+// flush writes every waiting operation now, oldest first, as one batch
+// A failed flush keeps its operations waiting, so reads still see them and the next
+// flush retries them
+func (s *debounceStore) flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	ops := slices.SortedFunc(maps.Values(s.pending), func(a, b pendingOp) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	s.mu.Unlock()
+	if len(ops) == 0 {
+		return s.stickyErr()
+	}
+
+	err := s.write(ops)
+
+	s.mu.Lock()
+	if err == nil {
+		for _, op := range ops {
+			if current, ok := s.pending[op.key]; ok && current.seq == op.seq {
+				delete(s.pending, op.key)
+			}
+		}
+	} else if s.err == nil {
+		s.err = err
+	}
+	onError := s.onError
+	sticky := s.err
+	s.mu.Unlock()
+
+	if err != nil && onError != nil {
+		onError(err)
+	}
+	return sticky
+}
+
+// write applies ops to the wrapped store inside one batch of the layers below
+func (s *debounceStore) write(ops []pendingOp) error {
+	commit := s.group()
+	var err error
+	for _, op := range ops {
+		if op.remove {
+			if err = s.inner.Remove(op.key); errors.Is(err, fs.ErrNotExist) {
+				err = nil // never written before the removal
+			}
+		} else {
+			err = s.inner.Write(op.key, op.data)
+		}
+		if err != nil {
+			err = fmt.Errorf("debounced write of %s failed: %w", op.key, err)
+			break
+		}
+	}
+	if commitErr := commit(err); commitErr != nil && err == nil {
+		return fmt.Errorf("debounced flush failed: %w", commitErr)
+	}
+	return err
+}
+
+// stickyErr returns the first flush failure
+func (s *debounceStore) stickyErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// close stops the quiet timer and writes everything pending; later writes fail
+func (s *debounceStore) close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+	return s.flush()
+}
@@ -0,0 +1,109 @@
+package tree
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDebouncedWritesCoalesce(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := NewFileStore(dir)
+	inner := &slowStore{Store: files}
+	tree, _ := NewTreeWithStore(inner, WithDebouncedWrites(time.Hour))
+	for i := 0; i < 16; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		if err := tree.Head().SaveToDisk(); err != nil {
+			t.Fatalf("Failed to save root: %v", err)
+		}
+	}
+	inner.mu.Lock()
+	early := inner.writes
+	inner.mu.Unlock()
+	if early != 0 {
+		t.Fatalf("%d writes reached the backend before the quiet interval", early)
+	}
+
+	if err := tree.Barrier(); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	// One write per element plus the manifest
+	if want := len(tree.GetAllElements()) + 1; inner.writes != want {
+		t.Errorf("backend saw %d writes, want %d", inner.writes, want)
+	}
+	loaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := len(loaded.GetLeaves()); got != 16 {
+		t.Errorf("loaded %d leaves, want 16", got)
+	}
+	if err := tree.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestDebouncedWritesAfterQuietInterval(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := NewFileStore(dir)
+	inner := &slowStore{Store: files}
+	tree, _ := NewTreeWithStore(inner, WithDebouncedWrites(10*time.Millisecond))
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		loaded, err := LoadTree(dir, "")
+		if err == nil && len(loaded.GetLeaves()) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("debounced writes never reached the backend: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDebouncedWritesWithAtomicWrites(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"journal":              {WithAtomicWrites(), WithDebouncedWrites(time.Millisecond)},
+		"journal-write-behind": {WithAtomicWrites(), WithWriteBehind(4), WithDebouncedWrites(time.Millisecond)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			tree, err := NewTree(dir, opts...)
+			if err != nil {
+				t.Fatalf("Failed to create tree: %v", err)
+			}
+			for i := 0; i < 40; i++ {
+				user := fmt.Sprintf("user_%d", i)
+				if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+					t.Fatalf("Failed to insert %s: %v", user, err)
+				}
+				if i%4 == 3 {
+					time.Sleep(2 * time.Millisecond) // let a flush overlap the next insert
+				}
+			}
+			if err := tree.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if err := tree.Insert("late", []byte("late_key")); err == nil {
+				t.Errorf("insert after Close should fail")
+			}
+
+			loaded, err := LoadTree(dir, "")
+			if err != nil {
+				t.Fatalf("Failed to load tree: %v", err)
+			}
+			if got := len(loaded.GetLeaves()); got != 40 {
+				t.Errorf("loaded %d leaves, want 40", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package tree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+)
+
+// deferredStore holds writes in memory until Flush, keeping only the newest per key
+// A bulk operation rewrites the nodes near the root once per member; deferring them
+// turns those O(depth) writes per operation into a single write per touched node
+type deferredStore struct {
+	inner   Store
+	seq     uint64
+	pending map[string]pendingOp // newest unflushed op per key, serves reads
+}
+
+// WithDeferredWrites keeps changed elements in memory until Flush writes them in one batch
+// Nothing reaches the backend before Flush or Close, so a crash loses every change since
+// the last flush. Apply it after the other store options so it wraps them
+func WithDeferredWrites() Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store := &deferredStore{inner: t.store, pending: make(map[string]pendingOp)}
+		t.store = store
+		t.deferred = store
+	}
+}
+
+// Key delegates to the wrapped store
+func (s *deferredStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write marks key dirty with data
+func (s *deferredStore) Write(key string, data []byte) error {
+	s.seq++
+	s.pending[key] = pendingOp{seq: s.seq, key: key, data: append([]byte(nil), data...)}
+	return nil
+}
+
+// Remove marks key for removal
+func (s *deferredStore) Remove(key string) error {
+	s.seq++
+	s.pending[key] = pendingOp{seq: s.seq, key: key, remove: true}
+	return nil
+}
+
+// Read serves pending operations before falling back to the wrapped store
+func (s *deferredStore) Read(key string) ([]byte, error) {
+	op, ok := s.pending[key]
+	if !ok {
+		return s.inner.Read(key)
+	}
+	if op.remove {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return append([]byte(nil), op.data...), nil
+}
+
+// savepoint captures the pending operations so a failed tree operation can drop its writes
+func (s *deferredStore) savepoint() map[string]pendingOp {
+	return maps.Clone(s.pending)
+}
+
+// rollback restores the pending operations captured by savepoint
+func (s *deferredStore) rollback(saved map[string]pendingOp) {
+	s.pending = saved
+}
+
+// flush writes the pending operations in the order of their last change, so children
+// still reach the backend before the parents referencing them. The operations stay
+// pending until the caller calls clear, so a failed batch is retried by the next flush
+func (s *deferredStore) flush() ([]pendingOp, error) {
+	ops := slices.SortedFunc(maps.Values(s.pending), func(a, b pendingOp) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	for _, op := range ops {
+		if !op.remove {
+			if err := s.inner.Write(op.key, op.data); err != nil {
+				return nil, fmt.Errorf("failed to flush %s: %w", op.key, err)
+			}
+			continue
+		}
+		// The element may never have reached the backend before it was removed
+		if err := s.inner.Remove(op.key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to flush removal of %s: %w", op.key, err)
+		}
+	}
+	return ops, nil
+}
+
+// clear drops flushed operations that were not superseded since
+func (s *deferredStore) clear(ops []pendingOp) {
+	for _, op := range ops {
+		if current, ok := s.pending[op.key]; ok && current.seq == op.seq {
+			delete(s.pending, op.key)
+		}
+	}
+}
+
+// Flush writes every element changed since the last flush to the backend in one batch
+// With WithAtomicWrites or a BatchStore the batch is applied all-or-nothing; otherwise
+// a failed flush may have written part of it and the next flush writes it all again.
+// It returns how many writes and removals reached the backend; without
+// WithDeferredWrites it returns immediately
+func (t *Tree) Flush() (int, error) {
+	if t.deferred == nil || len(t.deferred.pending) == 0 {
+		return 0, nil
+	}
+	finish := t.beginBatch()
+	ops, err := t.deferred.flush()
+	if err := finish(err); err != nil {
+		return 0, err
+	}
+	t.deferred.clear(ops)
+	return len(ops), nil
+}
+
+// Dirty returns how many elements changed since the last Flush
+func (t *Tree) Dirty() int {
+	if t.deferred == nil {
+		return 0
+	}
+	return len(t.deferred.pending)
+}
@@ -0,0 +1,102 @@
+package tree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeferredWritesFlush(t *testing.T) {
+	insertAll := func(tree *Tree) {
+		for i := 0; i < 64; i++ {
+			name := fmt.Sprintf("user_%d", i)
+			if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+				t.Fatalf("Failed to insert %s: %v", name, err)
+			}
+		}
+		if err := tree.Delete("user_3"); err != nil {
+			t.Fatalf("Failed to delete user_3: %v", err)
+		}
+	}
+
+	immediateFiles, _ := NewFileStore(t.TempDir())
+	immediate := &slowStore{Store: immediateFiles}
+	immediateTree, _ := NewTreeWithStore(immediate)
+	insertAll(immediateTree)
+
+	dir := t.TempDir()
+	files, _ := NewFileStore(dir)
+	inner := &slowStore{Store: files}
+	tree, _ := NewTreeWithStore(inner, WithDeferredWrites())
+	insertAll(tree)
+
+	if inner.writes != 0 {
+		t.Fatalf("deferred tree wrote %d elements before Flush", inner.writes)
+	}
+	dirty := tree.Dirty()
+	if dirty == 0 {
+		t.Fatalf("changes should be pending")
+	}
+	if early, err := LoadTree(dir, ""); err == nil && len(early.GetLeaves()) != 0 {
+		t.Errorf("nothing should be durable before Flush")
+	}
+
+	n, err := tree.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if n != dirty || tree.Dirty() != 0 {
+		t.Errorf("Flush wrote %d of %d pending, %d left", n, dirty, tree.Dirty())
+	}
+	if inner.writes >= immediate.writes {
+		t.Errorf("deferred writes = %d, want fewer than the %d immediate writes", inner.writes, immediate.writes)
+	}
+
+	loaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load flushed tree: %v", err)
+	}
+	if got, want := leafNames(loaded), leafNames(tree); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("flushed leaves = %v, want %v", got, want)
+	}
+	if n, err := tree.Flush(); n != 0 || err != nil {
+		t.Errorf("second Flush = %d, %v, want nothing to write", n, err)
+	}
+}
+
+func TestDeferredWritesAtomicClose(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := NewFileStore(dir)
+	tree, err := LoadTreeFromStore(files, "", WithAtomicWrites(), WithDeferredWrites())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	bob, _ := tree.Find("bob")
+	if err := tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if tree.Dirty() != 0 {
+		t.Errorf("Close should flush deferred writes")
+	}
+	loaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := leafNames(loaded); fmt.Sprint(got) != "[alice bob charlie]" {
+		t.Errorf("leaves = %v", got)
+	}
+	if string(loaded.Head().Value()) != "root_key" {
+		t.Errorf("root key = %q, want root_key", loaded.Head().Value())
+	}
+	if found, _ := loaded.Find("bob"); string(found.Value()) != string(bob.Value()) {
+		t.Errorf("bob key = %q, want %q", found.Value(), bob.Value())
+	}
+}
@@ -0,0 +1,78 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeleteBatch removes the member leaves names in a single pass
+// Each leaf is blanked as by Delete, so the remaining members keep their leaf indices,
+// and the blanked paths are persisted once for the whole batch instead of once per
+// member. The batch is one atomic operation and one version; notifiers see a single
+// delete_batch event naming the members separated by commas.
+// Nothing is removed unless every name is a distinct leaf of the tree
+func (t *Tree) DeleteBatch(names []string) (err error) {
+	if err := t.checkWritable("delete"); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	end := t.startOp("delete_batch", strings.Join(names, ","))
+	defer func() { end(err) }()
+
+	targets := make(map[string]bool, len(names))
+	var leaves []*Element
+	for _, name := range names {
+		element, found := t.Find(name)
+		if !found {
+			return fmt.Errorf("element not found: %s", name)
+		}
+		if element.nodeType != "leaf" {
+			return fmt.Errorf("%s is not a leaf", name)
+		}
+		if targets[name] {
+			return fmt.Errorf("%s listed twice", name)
+		}
+		targets[name] = true
+		leaves = append(leaves, element)
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+	return t.blankLeaves(leaves)
+}
+
+// blankLeaves blanks leaves and their direct paths, saving each touched node once, and
+// truncates the blank leaves left at the right edge
+func (t *Tree) blankLeaves(leaves []*Element) (err error) {
+	touched := make(map[*Element]bool)
+	for _, leaf := range leaves {
+		for node := leaf; node != nil && !touched[node]; node = node.parent {
+			if err := t.setNodeKey(node, PublicKey{}); err != nil {
+				return err
+			}
+			touched[node] = true
+		}
+		previous := leaf.filePath
+		t.renameElement(leaf, blankLeafName(leaf.leafIndex))
+		leaf.filePath = t.generateFilePath(leaf.name)
+		t.removeFromStore(previous)
+	}
+
+	// Children are saved before parents so their references follow the renames
+	t.Walk(PostOrder, func(node *Element) bool {
+		if touched[node] {
+			node.MarkAsModified()
+			err = node.saveToDisk()
+		}
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save blanked paths: %w", err)
+	}
+	if err := t.truncate(0); err != nil {
+		return err
+	}
+	return t.syncManifestHead()
+}
@@ -0,0 +1,81 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDeleteBatch(t *testing.T) {
+	dir := t.TempDir()
+	notifier := &recordingNotifier{}
+	tr, err := NewTree(dir, WithNotifier(notifier))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	names := []string{"alice", "bob", "charlie", "dave", "eve", "frank", "grace", "heidi"}
+	for _, name := range names {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	before := leafNames(tr)
+	version := tr.Version()
+	for _, batch := range [][]string{{"bob", "mallory"}, {"bob", "bob"}, {"bob", tr.Head().Name()}} {
+		if err := tr.DeleteBatch(batch); err == nil {
+			t.Errorf("batch %v should be rejected", batch)
+		}
+	}
+	if !slices.Equal(leafNames(tr), before) || tr.Version() != version {
+		t.Fatalf("rejected batches should leave the tree untouched")
+	}
+
+	// bob's slot stays blank, grace and heidi are truncated along with their parent
+	indices := make(map[string]int)
+	for _, leaf := range tr.GetLeaves() {
+		indices[leaf.Name()] = leaf.LeafIndex()
+	}
+	events := len(notifier.events)
+	if err := tr.DeleteBatch([]string{"bob", "grace", "heidi"}); err != nil {
+		t.Fatalf("Failed to delete batch: %v", err)
+	}
+	want := []string{"alice", blankLeafName(1), "charlie", "dave", "eve", "frank"}
+	if got := leafNames(tr); !slices.Equal(got, want) {
+		t.Errorf("leaves = %v, want %v", got, want)
+	}
+	for _, leaf := range tr.GetLeaves() {
+		if index, ok := indices[leaf.Name()]; ok && leaf.LeafIndex() != index {
+			t.Errorf("%s moved from leaf index %d to %d", leaf.Name(), index, leaf.LeafIndex())
+		}
+	}
+	if tr.Version() != version+1 || len(notifier.events) != events+1 || notifier.events[events].Op != "delete_batch" {
+		t.Errorf("a batch should be one operation, got version %d and events %v", tr.Version(), notifier.events[events:])
+	}
+	for _, element := range tr.GetAllElements() {
+		if !element.IsLeaf() && element.LeftCount()+element.RightCount() != countLeaves(element) {
+			t.Errorf("%s counts %d+%d leaves, has %d", element.Name(), element.LeftCount(), element.RightCount(), countLeaves(element))
+		}
+		if element.nodeType == "intermediate" && element.IsLeaf() {
+			t.Errorf("intermediate %s lost all its children but was kept", element.Name())
+		}
+	}
+	checkNodeLinks(t, tr)
+	if _, found := tr.Find("grace"); found {
+		t.Errorf("deleted members should not be found")
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got := leafNames(reloaded); !slices.Equal(got, want) {
+		t.Errorf("reloaded leaves = %v, want %v", got, want)
+	}
+
+	if err := tr.DeleteBatch([]string{"alice", "charlie", "dave", "eve", "frank"}); err != nil {
+		t.Fatalf("Failed to delete everyone: %v", err)
+	}
+	if tr.Head() != nil {
+		t.Errorf("deleting every member should empty the tree")
+	}
+}
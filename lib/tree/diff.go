@@ -0,0 +1,250 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Patch is the structured difference between two trees, matched by node name
+// Clients holding an older copy of a tree apply it to catch up without a full download
+type Patch struct {
+	Head     string     `json:"head,omitempty"`     // root of the target tree
+	Added    []NodeInfo `json:"added,omitempty"`    // nodes only in the target
+	Removed  []string   `json:"removed,omitempty"`  // nodes only in the source
+	Rekeyed  []NodeInfo `json:"rekeyed,omitempty"`  // nodes whose public key or leaf node changed
+	Relinked []NodeInfo `json:"relinked,omitempty"` // nodes whose children, type or leaf index changed
+}
+
+// Empty reports whether the patch changes nothing
+func (p *Patch) Empty() bool {
+	return len(p.Added) == 0 && len(p.Removed) == 0 && len(p.Rekeyed) == 0 && len(p.Relinked) == 0
+}
+
+// Diff returns the patch that turns t into other
+// Node indices are not part of the patch since they follow from the topology
+func (t *Tree) Diff(other *Tree) *Patch {
+	from := t.GetTreeStructure()
+	to := other.GetTreeStructure()
+
+	patch := &Patch{}
+	if other.head != nil {
+		patch.Head = other.head.name
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			patch.Removed = append(patch.Removed, name)
+		}
+	}
+	for name, target := range to {
+		source, ok := from[name]
+		if !ok {
+			patch.Added = append(patch.Added, *target)
+			continue
+		}
+		if !bytes.Equal(source.PublicKey, target.PublicKey) || source.KeyAlgorithm != target.KeyAlgorithm ||
+			source.KeyEncoding != target.KeyEncoding || !bytes.Equal(source.LeafNode, target.LeafNode) ||
+			!bytes.Equal(source.ParentHash, target.ParentHash) || !slices.Equal(source.Unmerged, target.Unmerged) {
+			patch.Rekeyed = append(patch.Rekeyed, *target)
+		}
+		if source.LeftChild != target.LeftChild || source.RightChild != target.RightChild ||
+			source.NodeType != target.NodeType || source.LeafIndex != target.LeafIndex {
+			patch.Relinked = append(patch.Relinked, *target)
+		}
+	}
+
+	sort.Strings(patch.Removed)
+	for _, nodes := range [][]NodeInfo{patch.Added, patch.Rekeyed, patch.Relinked} {
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeIndex < nodes[j].NodeIndex })
+	}
+	return patch
+}
+
+// ApplyPatch applies a patch produced by Diff
+// The resulting topology is checked before anything changes, so a patch that does not
+// fit this tree leaves it untouched
+func (t *Tree) ApplyPatch(patch *Patch) (err error) {
+	if err := t.checkWritable("apply patch"); err != nil {
+		return err
+	}
+	end := t.startOp("apply_patch", patch.Head)
+	defer func() { end(err) }()
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	target, err := patchedStructure(t.GetTreeStructure(), patch)
+	if err != nil {
+		return err
+	}
+	leaves := make(map[string]*LeafNode)
+	for _, info := range append(patch.Added, patch.Rekeyed...) {
+		if leaves[info.Name], err = leafNodeOf(info.LeafNode); err != nil {
+			return fmt.Errorf("patch carries an invalid leaf node for %s: %w", info.Name, err)
+		}
+	}
+
+	elements := make(map[string]*Element, len(target))
+	for _, element := range t.GetAllElements() {
+		elements[element.name] = element
+	}
+	for _, name := range patch.Removed {
+		t.removeFromStore(elements[name].filePath)
+		delete(elements, name)
+	}
+
+	now := time.Now()
+	touched := make(map[*Element]bool)
+	for _, info := range patch.Added {
+		element := &Element{
+			name:      info.Name,
+			filePath:  t.generateFilePath(info.Name),
+			store:     t.store,
+			format:    t.format,
+			loadedAt:  now,
+			nodeIndex: info.NodeIndex,
+		}
+		element.publicKey, element.keyAlgorithm, element.keyEncoding = info.PublicKey, info.KeyAlgorithm, info.KeyEncoding
+		element.leafNode = leaves[info.Name]
+		element.parentHash = info.ParentHash
+		element.unmerged = info.Unmerged
+		elements[info.Name] = element
+		touched[element] = true
+	}
+	for _, info := range patch.Rekeyed {
+		element := elements[info.Name]
+		if err := t.setNodeKey(element, PublicKey{Algorithm: info.KeyAlgorithm, Encoding: info.KeyEncoding, Data: info.PublicKey}); err != nil {
+			return err
+		}
+		element.leafNode = leaves[info.Name]
+		element.parentHash = info.ParentHash
+		element.unmerged = info.Unmerged
+		touched[element] = true
+	}
+	for _, info := range patch.Relinked {
+		touched[elements[info.Name]] = true
+	}
+
+	for element := range touched {
+		info := target[element.name]
+		element.nodeType = info.NodeType
+		element.leafIndex = info.LeafIndex
+		element.leftChild = elements[info.LeftChild]
+		element.rightChild = elements[info.RightChild]
+	}
+	for _, element := range elements {
+		leftCount, rightCount := countLeaves(element.leftChild), countLeaves(element.rightChild)
+		if leftCount != element.leftCount || rightCount != element.rightCount {
+			element.leftCount, element.rightCount = leftCount, rightCount
+			touched[element] = true
+		}
+	}
+
+	t.head = elements[patch.Head]
+	t.reassignNodeIndices()
+
+	// Save children before parents so stored references always resolve
+	var save func(*Element) error
+	save = func(element *Element) error {
+		if element == nil {
+			return nil
+		}
+		if err := save(element.leftChild); err != nil {
+			return err
+		}
+		if err := save(element.rightChild); err != nil {
+			return err
+		}
+		if !touched[element] {
+			return nil
+		}
+		element.lastModified = now
+		return element.saveToDisk()
+	}
+	if err := save(t.head); err != nil {
+		return fmt.Errorf("failed to persist patched tree: %w", err)
+	}
+	return t.syncManifestHead()
+}
+
+// patchedStructure applies a patch to a structure map and checks the result forms one tree
+func patchedStructure(structure map[string]*NodeInfo, patch *Patch) (map[string]*NodeInfo, error) {
+	target := make(map[string]*NodeInfo, len(structure))
+	for name, info := range structure {
+		copied := *info
+		target[name] = &copied
+	}
+
+	for _, name := range patch.Removed {
+		if _, ok := target[name]; !ok {
+			return nil, fmt.Errorf("patch removes unknown node %s", name)
+		}
+		delete(target, name)
+	}
+	for _, info := range patch.Added {
+		if _, ok := target[info.Name]; ok || info.Name == "" {
+			return nil, fmt.Errorf("patch adds existing node %q", info.Name)
+		}
+		added := info
+		target[info.Name] = &added
+	}
+	for _, info := range patch.Rekeyed {
+		node, ok := target[info.Name]
+		if !ok {
+			return nil, fmt.Errorf("patch rekeys unknown node %s", info.Name)
+		}
+		node.PublicKey, node.KeyAlgorithm, node.KeyEncoding = info.PublicKey, info.KeyAlgorithm, info.KeyEncoding
+		node.LeafNode = info.LeafNode
+		node.ParentHash = info.ParentHash
+		node.Unmerged = info.Unmerged
+	}
+	for _, info := range patch.Relinked {
+		node, ok := target[info.Name]
+		if !ok {
+			return nil, fmt.Errorf("patch relinks unknown node %s", info.Name)
+		}
+		node.LeftChild, node.RightChild = info.LeftChild, info.RightChild
+		node.NodeType, node.LeafIndex = info.NodeType, info.LeafIndex
+	}
+
+	if patch.Head == "" {
+		if len(target) > 0 {
+			return nil, fmt.Errorf("patch leaves %d nodes without a root", len(target))
+		}
+		return target, nil
+	}
+
+	visited := make(map[string]bool, len(target))
+	stack := []string{patch.Head}
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node, ok := target[name]
+		if !ok {
+			return nil, fmt.Errorf("patched tree references missing node %s", name)
+		}
+		if visited[name] {
+			return nil, fmt.Errorf("patched tree reaches node %s twice", name)
+		}
+		visited[name] = true
+
+		switch {
+		case node.NodeType == "leaf" && (node.LeftChild != "" || node.RightChild != ""):
+			return nil, fmt.Errorf("patched leaf %s has children", name)
+		case node.NodeType == "intermediate" && node.LeftChild == "" && node.RightChild == "":
+			return nil, fmt.Errorf("patched intermediate node %s has no children", name)
+		case node.NodeType != "leaf" && node.NodeType != "intermediate":
+			return nil, fmt.Errorf("patched node %s has unknown type %q", name, node.NodeType)
+		}
+		for _, child := range []string{node.LeftChild, node.RightChild} {
+			if child != "" {
+				stack = append(stack, child)
+			}
+		}
+	}
+	if len(visited) != len(target) {
+		return nil, fmt.Errorf("patched tree has %d nodes unreachable from %s", len(target)-len(visited), patch.Head)
+	}
+	return target, nil
+}
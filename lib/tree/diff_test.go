@@ -0,0 +1,84 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestDiffApplyPatch(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, []byte(name+"_key"))
+	}
+	source.UpdateIntermediateKeys()
+
+	// The client copy keeps the node names of the source
+	var buf bytes.Buffer
+	if _, err := source.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write tree: %v", err)
+	}
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	client, err := ReadFrom(&buf, store)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+
+	source.Delete("user_2")
+	source.Insert("user_6", []byte("user_6_key"))
+	source.Insert("user_7", []byte("user_7_key"))
+	source.UpdateIntermediateKeys()
+
+	patch := client.Diff(source)
+	if patch.Empty() {
+		t.Fatalf("expected a non-empty patch")
+	}
+	encoded, _ := json.Marshal(patch)
+	full, _ := json.Marshal(source.GetTreeStructure())
+	t.Logf("패치 %d바이트 (전체 %d바이트): 추가 %d, 삭제 %d, 키 변경 %d, 연결 변경 %d",
+		len(encoded), len(full), len(patch.Added), len(patch.Removed), len(patch.Rekeyed), len(patch.Relinked))
+
+	if err := client.ApplyPatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if !bytes.Equal(client.StructureHash(), source.StructureHash()) {
+		t.Errorf("patched tree differs from the source")
+	}
+	if again := client.Diff(source); !again.Empty() {
+		t.Errorf("expected no differences after applying the patch, got %+v", again)
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload patched tree: %v", err)
+	}
+	if !bytes.Equal(reloaded.StructureHash(), source.StructureHash()) {
+		t.Errorf("persisted tree differs from the source")
+	}
+}
+
+func TestApplyPatchRejectsMismatchedPatch(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil)
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+	before := tree.StructureHash()
+
+	patches := []*Patch{
+		{Head: tree.Head().Name(), Removed: []string{"bob"}},
+		{Head: tree.Head().Name(), Removed: []string{"nobody"}},
+		{Head: tree.Head().Name(), Added: []NodeInfo{{Name: "dave", NodeType: "leaf"}}},
+		{Head: "missing"},
+	}
+	for i, patch := range patches {
+		if err := tree.ApplyPatch(patch); err == nil {
+			t.Errorf("patch %d: expected an error", i)
+		}
+	}
+	if !bytes.Equal(tree.StructureHash(), before) {
+		t.Errorf("rejected patches must leave the tree untouched")
+	}
+}
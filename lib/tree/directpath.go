@@ -0,0 +1,92 @@
+package tree
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DirectPath returns the RFC 9420 node indices of the leaf's ancestors, from its parent
+// up to the root (RFC 9420 section 4.1.2). leafIndex is the leaf's Element.LeafIndex; nil
+// is returned when no leaf has it
+func (t *Tree) DirectPath(leafIndex int) []int {
+	leaf := t.leafByIndex(leafIndex)
+	if leaf == nil {
+		return nil
+	}
+	var path []int
+	for node := leaf.parent; node != nil; node = node.parent {
+		path = append(path, node.nodeIndex)
+	}
+	return path
+}
+
+// FilteredDirectPath is DirectPath without the ancestors whose copath child has an empty
+// resolution (RFC 9420 section 4.1.2). Their path secrets would be encrypted to nobody,
+// so they are exactly the nodes a commit need not give new keys
+func (t *Tree) FilteredDirectPath(leafIndex int) []int {
+	leaf := t.leafByIndex(leafIndex)
+	if leaf == nil {
+		return nil
+	}
+	var path []int
+	for node := leaf; node.parent != nil; node = node.parent {
+		if len(t.resolution(node.Sibling())) > 0 {
+			path = append(path, node.parent.nodeIndex)
+		}
+	}
+	return path
+}
+
+// PathNode is one node of a path as MLS clients address it
+type PathNode struct {
+	NodeIndex int    // RFC 9420 node index
+	PublicKey []byte // empty for blank nodes
+}
+
+// GetPathByIndex is GetPath for the leaf with the given leaf index, returning each
+// node's index and key from the root down to the leaf
+func (t *Tree) GetPathByIndex(leafIndex int) ([]PathNode, error) {
+	leaf := t.leafByIndex(leafIndex)
+	if leaf == nil {
+		return nil, fmt.Errorf("leaf %d not found", leafIndex)
+	}
+	var path []PathNode
+	for node := leaf; node != nil; node = node.parent {
+		path = append(path, PathNode{NodeIndex: node.nodeIndex, PublicKey: node.key()})
+	}
+	slices.Reverse(path)
+	return path, nil
+}
+
+// GetPathNodes is GetPath returning each node's index and key
+func (t *Tree) GetPathNodes(leafName string) ([]PathNode, error) {
+	path, err := t.GetPath(leafName)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]PathNode, len(path))
+	for i, node := range path {
+		nodes[i] = PathNode{NodeIndex: node.nodeIndex, PublicKey: node.key()}
+	}
+	return nodes, nil
+}
+
+// leafByIndex returns the leaf with the given leaf index, nil when there is none
+// Leaf i is node 2i; only a tree restructured out of the left-balanced shape is searched
+func (t *Tree) leafByIndex(leafIndex int) *Element {
+	if leafIndex < 0 {
+		return nil
+	}
+	if !t.unevenLeaves {
+		if node := t.GetNodeByIndex(2 * leafIndex); node != nil && node.nodeType == "leaf" {
+			return node
+		}
+		return nil
+	}
+	for _, node := range t.nodes {
+		if node.nodeType == "leaf" && node.leafIndex == leafIndex {
+			return node
+		}
+	}
+	return nil
+}
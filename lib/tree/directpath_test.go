@@ -0,0 +1,119 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDirectPath(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	alice, _ := tr.Find("alice")
+	path, _ := tr.GetPath("alice")
+	var want []int
+	for i := len(path) - 2; i >= 0; i-- {
+		want = append(want, path[i].NodeIndex())
+	}
+	if got := tr.DirectPath(alice.LeafIndex()); !slices.Equal(got, want) {
+		t.Errorf("direct path = %v, want %v", got, want)
+	}
+	if got := tr.FilteredDirectPath(alice.LeafIndex()); !slices.Equal(got, want) {
+		t.Errorf("with every leaf keyed nothing should be filtered, got %v, want %v", got, want)
+	}
+	if !slices.Equal(want, []int{1, 3}) {
+		t.Errorf("alice's ancestors should be RFC 9420 nodes 1 and 3, got %v", want)
+	}
+	if tr.DirectPath(99) != nil || tr.FilteredDirectPath(99) != nil {
+		t.Errorf("unknown leaf indices should have no direct path")
+	}
+
+	// Blanking alice's sibling empties the resolution of alice's copath at the lowest level
+	sibling := alice.Sibling()
+	if err := tr.Blank(sibling.Name()); err != nil {
+		t.Fatalf("Failed to blank %s: %v", sibling.Name(), err)
+	}
+	if got := tr.FilteredDirectPath(alice.LeafIndex()); !slices.Equal(got, want[1:]) {
+		t.Errorf("filtered direct path = %v, want %v", got, want[1:])
+	}
+	if got := tr.DirectPath(alice.LeafIndex()); !slices.Equal(got, want) {
+		t.Errorf("blanking should not change the direct path, got %v", got)
+	}
+
+	single, _ := NewTreeWithStore(nil)
+	if err := single.Insert("solo", []byte("solo_key")); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if got := single.DirectPath(0); len(got) != 0 {
+		t.Errorf("the root leaf has an empty direct path, got %v", got)
+	}
+}
+
+func TestDirectPathFollowsArrayArithmetic(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	for leaf := 0; leaf < 5; leaf++ {
+		var want []int
+		for x := rfcParent(2*leaf, 5); x != -1; x = rfcParent(x, 5) {
+			want = append(want, x)
+		}
+		if got := tr.DirectPath(leaf); !slices.Equal(got, want) {
+			t.Errorf("direct path of leaf %d = %v, want %v", leaf, got, want)
+		}
+	}
+}
+
+func TestGetPathByIndex(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	for _, leaf := range tr.GetLeaves() {
+		elements, _ := tr.GetPath(leaf.Name())
+		byIndex, err := tr.GetPathByIndex(leaf.LeafIndex())
+		if err != nil {
+			t.Fatalf("Failed to get path of leaf %d: %v", leaf.LeafIndex(), err)
+		}
+		byName, _ := tr.GetPathNodes(leaf.Name())
+		if !slices.EqualFunc(byIndex, byName, func(a, b PathNode) bool {
+			return a.NodeIndex == b.NodeIndex && string(a.PublicKey) == string(b.PublicKey)
+		}) {
+			t.Errorf("paths of %s differ by index and by name: %v, %v", leaf.Name(), byIndex, byName)
+		}
+		if len(byIndex) != len(elements) {
+			t.Fatalf("path of %s has %d nodes, want %d", leaf.Name(), len(byIndex), len(elements))
+		}
+		for i, node := range byIndex {
+			if node.NodeIndex != elements[i].NodeIndex() || string(node.PublicKey) != string(elements[i].Value()) {
+				t.Errorf("path node %d of %s = %v, want %s", i, leaf.Name(), node, elements[i].Name())
+			}
+		}
+	}
+	// charlie is node 4 below 5, 3 and the root 7 of the five-leaf array
+	path, _ := tr.GetPathByIndex(2)
+	var indices []int
+	for _, node := range path {
+		indices = append(indices, node.NodeIndex)
+	}
+	if !slices.Equal(indices, []int{7, 3, 5, 4}) {
+		t.Errorf("path of leaf 2 = %v, want RFC 9420 nodes [7 3 5 4]", indices)
+	}
+	if _, err := tr.GetPathByIndex(99); err == nil {
+		t.Errorf("unknown leaf indices should be rejected")
+	}
+	if _, err := tr.GetPathNodes("mallory"); err == nil {
+		t.Errorf("unknown names should be rejected")
+	}
+}
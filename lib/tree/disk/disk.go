@@ -0,0 +1,47 @@
+// Package disk opens and restores TreeKEM trees persisted as one JSON file per element
+package disk
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// OpenReadOnly loads the tree under rootPath and rejects every mutation with tree.ErrReadOnly
+// Follower processes that only serve GetTreeStructure or GetPath use it so they can never
+// rewrite node files; call Reload or ReloadNode to pick up the writer's changes
+func OpenReadOnly(rootPath string, opts ...tree.Option) (*tree.Tree, error) {
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tree directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", rootPath)
+	}
+
+	store, err := tree.NewFileStore(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts[:len(opts):len(opts)], tree.WithReadOnly())
+	return tree.LoadTreeFromStore(store, "", opts...)
+}
+
+// Import restores a file written by Tree.Export into the tree directory rootPath
+// rootPath is created when missing and must not already hold a tree
+func Import(path, rootPath string, opts ...tree.Option) (*tree.Tree, error) {
+	entries, err := os.ReadDir(rootPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open tree directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", rootPath)
+	}
+
+	store, err := tree.NewFileStore(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	return tree.ImportFile(path, store, opts...)
+}
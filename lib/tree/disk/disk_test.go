@@ -0,0 +1,120 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestOpenReadOnlyRejectsMutations(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := tree.NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := writer.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	before := snapshotDir(t, dir)
+	follower, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("Failed to open read-only tree: %v", err)
+	}
+	if got := len(follower.GetTreeStructure()); got != 5 {
+		t.Errorf("expected 5 nodes, got %d", got)
+	}
+	if _, err := follower.GetPath("bob"); err != nil {
+		t.Errorf("GetPath failed: %v", err)
+	}
+
+	if err := follower.Insert("david", []byte("david_key")); !errors.Is(err, tree.ErrReadOnly) {
+		t.Errorf("Insert: expected ErrReadOnly, got %v", err)
+	}
+	if err := follower.Delete("alice"); !errors.Is(err, tree.ErrReadOnly) {
+		t.Errorf("Delete: expected ErrReadOnly, got %v", err)
+	}
+	if err := follower.SetIntermediateNodeKey(follower.Head().Name(), []byte("k")); !errors.Is(err, tree.ErrReadOnly) {
+		t.Errorf("SetIntermediateNodeKey: expected ErrReadOnly, got %v", err)
+	}
+	if err := follower.UpdateIntermediateKeys(); !errors.Is(err, tree.ErrReadOnly) {
+		t.Errorf("UpdateIntermediateKeys: expected ErrReadOnly, got %v", err)
+	}
+	if err := follower.Pin(follower.Head().Name()); !errors.Is(err, tree.ErrReadOnly) {
+		t.Errorf("Pin: expected ErrReadOnly, got %v", err)
+	}
+	follower.MarkAllAsChecked()
+
+	after := snapshotDir(t, dir)
+	for name, data := range before {
+		if after[name] != data {
+			t.Errorf("%s was modified by the read-only tree", name)
+		}
+	}
+	if len(after) != len(before) {
+		t.Errorf("read-only tree changed the number of files: %d -> %d", len(before), len(after))
+	}
+
+	// The follower picks up the writer's changes on reload
+	writer.Insert("david", []byte("david_key"))
+	if err := follower.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, ok := follower.Find("david"); !ok {
+		t.Errorf("follower should see david after reload")
+	}
+}
+
+func TestOpenReadOnlyMissingDirectory(t *testing.T) {
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected an error for a missing directory")
+	}
+}
+
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, entry.Name()))
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestImportRestoresExport(t *testing.T) {
+	source, err := tree.NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		source.Insert(user, []byte(user+"_key"))
+	}
+	exportPath := filepath.Join(t.TempDir(), "tree.json")
+	if err := source.Export(exportPath); err != nil {
+		t.Fatalf("Failed to export tree: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "restored")
+	if _, err := Import(exportPath, dir); err != nil {
+		t.Fatalf("Failed to import tree: %v", err)
+	}
+	reopened, err := tree.LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load restored tree: %v", err)
+	}
+	if string(reopened.StructureHash()) != string(source.StructureHash()) {
+		t.Errorf("restored tree differs from the source")
+	}
+
+	if _, err := Import(exportPath, dir); err == nil {
+		t.Errorf("expected an error when importing into a non-empty directory")
+	}
+}
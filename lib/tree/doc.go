@@ -0,0 +1,22 @@
+// Package tree implements the TreeKEM ratchet tree bookkeeping used by the MLS server
+//
+// A Tree persists its elements through a Store. NewTree writes one JSON file per
+// element, NewTreeWithStore accepts any other backend and a nil Store keeps the tree in memory.
+//
+// Storage backends live in nested modules with their own go.mod, so requiring the core
+// module never adds their dependency graphs to a consumer's build:
+//
+//	lib/tree/bolt         go.etcd.io/bbolt
+//	lib/tree/badger       github.com/dgraph-io/badger/v4
+//	lib/tree/lmdb         github.com/PowerDNS/lmdb-go, a cgo binding
+//	lib/tree/postgres     database/sql, the driver is the application's choice
+//	lib/tree/etcd         a narrow Client interface the application backs with clientv3
+//	lib/tree/redis        a narrow Client interface, likewise
+//	lib/tree/objectstore  a narrow Bucket interface for S3-compatible storage
+//
+// Within this repository each of them replaces the core module with the working tree.
+//
+// Those packages talk to the core exclusively through narrow interfaces such as
+// Store, Notifier and Tracer, which adapters for NATS, OpenTelemetry and similar
+// systems implement without the core importing them.
+package tree
@@ -0,0 +1,110 @@
+package tree
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// encryptedStore seals every element with AES-GCM before handing it to the wrapped store
+// Element names are replaced by keyed hashes so file names do not reveal members either
+type encryptedStore struct {
+	inner   Store
+	aead    cipher.AEAD
+	nameKey []byte
+}
+
+// minEncryptionSecretSize is the shortest secret NewEncryptedStore accepts
+const minEncryptionSecretSize = 32
+
+// WithEncryption encrypts persisted elements at rest under a tree-level secret
+// The secret must be at least 32 bytes of high-entropy key material; a shorter one makes
+// the tree constructor fail
+func WithEncryption(secret []byte) Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store, err := NewEncryptedStore(t.store, secret)
+		if err != nil {
+			t.optionErr = err
+			return
+		}
+		t.store = store
+	}
+}
+
+// NewEncryptedStore wraps inner so elements are encrypted with keys derived from secret
+// It rejects secrets shorter than 32 bytes
+func NewEncryptedStore(inner Store, secret []byte) (Store, error) {
+	if len(secret) < minEncryptionSecretSize {
+		return nil, fmt.Errorf("encryption secret has %d bytes, need at least %d", len(secret), minEncryptionSecretSize)
+	}
+	encKey, err := hkdf.Key(sha256.New, secret, nil, "TreeKEM-at-rest-encryption", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	nameKey, err := hkdf.Key(sha256.New, secret, nil, "TreeKEM-at-rest-names", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive name key: %w", err)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES-GCM: %w", err)
+	}
+
+	return &encryptedStore{
+		inner:   inner,
+		aead:    aead,
+		nameKey: nameKey,
+	}, nil
+}
+
+// Key hides the element name behind an HMAC before asking the wrapped store
+func (s *encryptedStore) Key(name string) string {
+	mac := hmac.New(sha256.New, s.nameKey)
+	mac.Write([]byte(name))
+	return s.inner.Key(hex.EncodeToString(mac.Sum(nil)[:16]))
+}
+
+// Write seals data as nonce || ciphertext, bound to its storage key
+func (s *encryptedStore) Write(key string, data []byte) error {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return s.inner.Write(key, s.aead.Seal(nonce, nonce, data, []byte(key)))
+}
+
+// Read opens a sealed element
+func (s *encryptedStore) Read(key string) ([]byte, error) {
+	sealed, err := s.inner.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted element too short")
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt element: %w", err)
+	}
+	return data, nil
+}
+
+// Remove removes the sealed element
+func (s *encryptedStore) Remove(key string) error {
+	return s.inner.Remove(key)
+}
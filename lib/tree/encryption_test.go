@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedAtRestStorage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "encryption_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	tree, err := NewTree(tempDir, WithEncryption(secret))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for _, user := range []string{"alice@example.com", "bob@example.com", "charlie@example.com"} {
+		if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(tempDir, "*"))
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if bytes.Contains([]byte(file), []byte("example.com")) || bytes.Contains(data, []byte("example.com")) {
+			t.Errorf("member metadata leaked in %s", file)
+		}
+	}
+
+	loaded, err := LoadTree(tempDir, "", WithEncryption(secret))
+	if err != nil {
+		t.Fatalf("Failed to load encrypted tree: %v", err)
+	}
+	if _, ok := loaded.Find("bob@example.com"); !ok {
+		t.Errorf("bob not found after reload")
+	}
+
+	// A wrong secret derives different storage keys, so nothing is readable
+	wrong, err := LoadTree(tempDir, "", WithEncryption(bytes.Repeat([]byte{0x01}, 32)))
+	if err != nil {
+		t.Fatalf("Failed to open tree with another secret: %v", err)
+	}
+	if wrong.Head() != nil {
+		t.Errorf("tree must not be readable with the wrong secret")
+	}
+
+	// Tampering with a sealed element is detected on load
+	headKey := loaded.Head().filePath
+	sealed, _ := os.ReadFile(headKey)
+	sealed[len(sealed)-1] ^= 0xff
+	os.WriteFile(headKey, sealed, 0644)
+	if _, err := LoadTree(tempDir, "", WithEncryption(secret)); err == nil {
+		t.Errorf("expected tampered element to fail decryption")
+	}
+}
+
+func TestEncryptionRejectsShortSecret(t *testing.T) {
+	short := bytes.Repeat([]byte{0x42}, 16)
+	if _, err := NewEncryptedStore(nil, short); err == nil {
+		t.Errorf("expected a 16-byte secret to be rejected")
+	}
+
+	// The option reports the failure instead of silently storing plaintext
+	tempDir := t.TempDir()
+	if _, err := NewTree(tempDir, WithEncryption(short)); err == nil {
+		t.Errorf("expected NewTree to fail with a short secret")
+	}
+	if _, err := LoadTree(tempDir, "", WithEncryption(short)); err == nil {
+		t.Errorf("expected LoadTree to fail with a short secret")
+	}
+	files, _ := NewFileStore(tempDir)
+	if _, err := NewTreeWithStore(files, WithEncryption(short)); err == nil {
+		t.Errorf("expected NewTreeWithStore to fail with a short secret")
+	}
+	written, _ := filepath.Glob(filepath.Join(tempDir, "*"))
+	if len(written) != 0 {
+		t.Errorf("nothing should be written without encryption, found %v", written)
+	}
+}
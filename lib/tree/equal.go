@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// DifferenceKind names what differs at a node index between two trees
+type DifferenceKind string
+
+const (
+	DifferenceMissing    DifferenceKind = "missing"     // the index exists in only one tree
+	DifferenceType       DifferenceKind = "type"        // a leaf in one tree, an intermediate in the other
+	DifferenceTopology   DifferenceKind = "topology"    // parent or children sit at other indices
+	DifferenceLeafIndex  DifferenceKind = "leaf_index"  // leaves with different stable leaf indices
+	DifferenceName       DifferenceKind = "name"        // leaves of different members
+	DifferenceKey        DifferenceKind = "key"         // different public keys
+	DifferenceParentHash DifferenceKind = "parent_hash" // different parent hashes
+	DifferenceUnmerged   DifferenceKind = "unmerged"    // different unmerged leaves
+)
+
+// Difference is one disagreement found by StructuralDiff
+type Difference struct {
+	NodeIndex int
+	Kind      DifferenceKind
+	Detail    string
+}
+
+// String formats the difference for logs and test failures
+func (d Difference) String() string {
+	return fmt.Sprintf("node %d: %s: %s", d.NodeIndex, d.Kind, d.Detail)
+}
+
+// Equal reports whether t and other have the same topology, indices and keys, see
+// StructuralDiff
+func (t *Tree) Equal(other *Tree) bool {
+	return len(t.StructuralDiff(other)) == 0
+}
+
+// StructuralDiff compares t with other node index by node index and returns every
+// disagreement in index order, nil when the trees agree. Compared are the node types,
+// the parent and child indices, the leaf indices and member names of leaves, the public
+// keys, parent hashes and unmerged leaves. Intermediate names are local to each replica
+// and ignored, so replicas that applied the same operations compare equal.
+// Unlike Diff, which matches nodes by name to build a patch, it tells whether replicas
+// converged
+func (t *Tree) StructuralDiff(other *Tree) []Difference {
+	var diffs []Difference
+	add := func(index int, kind DifferenceKind, format string, args ...any) {
+		diffs = append(diffs, Difference{NodeIndex: index, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+	for index := 0; index < max(len(t.nodes), len(other.nodes)); index++ {
+		if index >= len(t.nodes) || index >= len(other.nodes) {
+			add(index, DifferenceMissing, "%d nodes against %d", len(t.nodes), len(other.nodes))
+			continue
+		}
+		a, b := t.nodes[index], other.nodes[index]
+		if a.nodeType != b.nodeType {
+			add(index, DifferenceType, "%s against %s", a.nodeType, b.nodeType)
+			continue
+		}
+		if a.ParentIndex() != b.ParentIndex() || a.LeftChildIndex() != b.LeftChildIndex() || a.RightChildIndex() != b.RightChildIndex() {
+			add(index, DifferenceTopology, "parent %d children %d,%d against parent %d children %d,%d",
+				a.ParentIndex(), a.LeftChildIndex(), a.RightChildIndex(), b.ParentIndex(), b.LeftChildIndex(), b.RightChildIndex())
+		}
+		if a.nodeType == "leaf" {
+			if a.leafIndex != b.leafIndex {
+				add(index, DifferenceLeafIndex, "%d against %d", a.leafIndex, b.leafIndex)
+			}
+			if a.name != b.name {
+				add(index, DifferenceName, "%s against %s", a.name, b.name)
+			}
+		}
+		if !bytes.Equal(a.key(), b.key()) {
+			add(index, DifferenceKey, "%x against %x", a.key(), b.key())
+		}
+		if !bytes.Equal(a.ParentHash(), b.ParentHash()) {
+			add(index, DifferenceParentHash, "%x against %x", a.ParentHash(), b.ParentHash())
+		}
+		if ua, ub := a.UnmergedLeaves(), b.UnmergedLeaves(); !slices.Equal(ua, ub) {
+			add(index, DifferenceUnmerged, "%v against %v", ua, ub)
+		}
+	}
+	return diffs
+}
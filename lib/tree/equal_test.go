@@ -0,0 +1,70 @@
+package tree
+
+import "testing"
+
+func TestStructuralDiff(t *testing.T) {
+	build := func() *Tree {
+		tr, _ := NewTreeWithStore(nil)
+		for _, name := range []string{"alice", "bob", "charlie"} {
+			if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+				t.Fatalf("Failed to insert %s: %v", name, err)
+			}
+		}
+		return tr
+	}
+	a, b := build(), build()
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Fatalf("replicas applying the same operations should be equal, got %v", a.StructuralDiff(b))
+	}
+	if !a.Equal(a) {
+		t.Errorf("a tree should equal itself")
+	}
+
+	keys := testPathKeys(t, 2)
+	if _, err := b.SetPathKeys("alice", keys); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if a.Equal(b) {
+		t.Fatalf("rekeyed replica should differ")
+	}
+	alice, _ := b.Find("alice")
+	parent := alice.ParentIndex()
+	kinds := make(map[DifferenceKind][]int)
+	for _, diff := range a.StructuralDiff(b) {
+		kinds[diff.Kind] = append(kinds[diff.Kind], diff.NodeIndex)
+	}
+	if got := kinds[DifferenceKey]; len(got) != 2 || got[0] != parent || got[1] != b.Head().NodeIndex() {
+		t.Errorf("key differences at %v, want node %d and the root", got, parent)
+	}
+	if len(kinds[DifferenceTopology]) != 0 || len(kinds[DifferenceMissing]) != 0 {
+		t.Errorf("rekeying should not change the topology, got %v", kinds)
+	}
+
+	if _, err := a.SetPathKeys("alice", keys); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if !a.Equal(b) {
+		t.Fatalf("replicas given the same keys should converge, got %v", a.StructuralDiff(b))
+	}
+
+	if err := b.Insert("dave", []byte("dave_key")); err != nil {
+		t.Fatalf("Failed to insert dave: %v", err)
+	}
+	diffs := a.StructuralDiff(b)
+	kinds = make(map[DifferenceKind][]int)
+	for _, diff := range diffs {
+		kinds[diff.Kind] = append(kinds[diff.Kind], diff.NodeIndex)
+	}
+	// dave appends a parent and a leaf; the existing nodes keep their indices
+	if len(kinds[DifferenceMissing]) != 2 || len(kinds[DifferenceType]) != 0 || len(kinds[DifferenceUnmerged]) != 1 {
+		t.Errorf("a longer replica should report its extra nodes and the unmerged leaf, got %v", diffs)
+	}
+	if got := kinds[DifferenceTopology]; len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("the root and charlie should change topology, got %v", got)
+	}
+	for i := 1; i < len(diffs); i++ {
+		if diffs[i].NodeIndex < diffs[i-1].NodeIndex {
+			t.Fatalf("differences should be in index order, got %v", diffs)
+		}
+	}
+}
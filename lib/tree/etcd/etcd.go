@@ -0,0 +1,297 @@
+// Package etcd shares TreeKEM trees between server instances through etcd
+//
+// Each Insert and Delete is committed as a single etcd transaction guarded by the
+// tree's revision key, so concurrent writers on other instances are detected instead
+// of interleaving their node updates. The package does not import the etcd client;
+// adapt clientv3 to the Client interface.
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ErrConflict is returned when another instance changed the tree since it was last loaded
+// The failed operation is rolled back and the tree reloaded at the latest revision; retry it
+var ErrConflict = errors.New("tree was modified by another instance")
+
+// Op is a put or delete inside a transaction
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// WatchEvent is a change observed on a watched key
+type WatchEvent struct {
+	Key      string
+	Value    []byte
+	Delete   bool
+	Revision int64 // mod revision of the change
+}
+
+// Client is the subset of etcd the store needs
+type Client interface {
+	// Get reads key at revision, or the latest value when revision is 0
+	Get(ctx context.Context, key string, revision int64) (value []byte, modRevision int64, found bool, err error)
+	// Txn applies ops only if guard's mod revision equals guardRevision (0: guard must not exist)
+	// and reports whether they were applied together with the transaction revision
+	Txn(ctx context.Context, guard string, guardRevision int64, ops []Op) (applied bool, revision int64, err error)
+	// Watch streams changes of keys with the given prefix until ctx is done
+	Watch(ctx context.Context, prefix string) <-chan WatchEvent
+}
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithTimeout bounds every etcd round trip
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// Store keeps the elements of one tree below a key prefix
+type Store struct {
+	client  Client
+	prefix  string
+	guard   string
+	timeout time.Duration
+
+	mu       sync.Mutex
+	revision int64 // guard revision this instance last wrote or loaded
+	readRev  int64 // revision reads are pinned to while loading, 0 for latest
+	batching bool
+	ops      []Op
+	overlay  map[string]int // key -> index of newest op in ops
+}
+
+var _ tree.BatchStore = (*Store)(nil)
+
+// NewStore creates a store for the tree identified by treeID
+func NewStore(client Client, treeID string, opts ...Option) *Store {
+	prefix := path.Join("mls", "tree", treeID)
+	s := &Store{
+		client:  client,
+		prefix:  prefix,
+		guard:   path.Join(prefix, "revision"),
+		timeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewTree returns an empty tree; the first commit fails with ErrConflict if the tree already exists
+func NewTree(client Client, treeID string, opts ...Option) (*tree.Tree, *Store) {
+	store := NewStore(client, treeID, opts...)
+	t, _ := tree.NewTreeWithStore(store) // without options nothing can fail
+	return t, store
+}
+
+// LoadTree loads the tree stored under treeID from a single consistent revision
+func LoadTree(client Client, treeID string, opts ...Option) (*tree.Tree, *Store, error) {
+	store := NewStore(client, treeID, opts...)
+	var t *tree.Tree
+	err := store.pinned(func() error {
+		var err error
+		t, err = tree.LoadTreeFromStore(store, "")
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Refresh reloads t from the latest stored revision, typically after ErrConflict or a remote change
+func Refresh(t *tree.Tree, s *Store) error {
+	return s.pinned(t.Reload)
+}
+
+// pinned runs load with every read pinned to the current guard revision
+func (s *Store) pinned(load func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	_, revision, _, err := s.client.Get(ctx, s.guard, 0)
+	if err != nil {
+		return fmt.Errorf("failed to read tree revision: %w", err)
+	}
+
+	s.mu.Lock()
+	s.readRev = revision
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.readRev = 0
+		s.mu.Unlock()
+	}()
+
+	if err := load(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
+
+// loadRevision records the latest guard revision, so the tree reloaded after a conflict
+// commits on top of it
+func (s *Store) loadRevision(ctx context.Context) error {
+	_, revision, _, err := s.client.Get(ctx, s.guard, 0)
+	if err != nil {
+		return fmt.Errorf("failed to read tree revision: %w", err)
+	}
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
+
+// Revision returns the tree revision this instance last wrote or loaded
+func (s *Store) Revision() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revision
+}
+
+// RemoteChanges delivers the revision of every commit made by another instance until ctx is done
+// Call Refresh when a revision arrives to bring the local tree up to date
+func (s *Store) RemoteChanges(ctx context.Context) <-chan int64 {
+	out := make(chan int64)
+	events := s.client.Watch(ctx, s.guard)
+	go func() {
+		defer close(out)
+		for event := range events {
+			if event.Key != s.guard || event.Revision <= s.Revision() {
+				continue
+			}
+			select {
+			case out <- event.Revision:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Key maps an element name to its etcd key
+func (s *Store) Key(name string) string {
+	return path.Join(s.prefix, "nodes", name)
+}
+
+// Begin starts buffering the writes of one tree operation
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batching = true
+	s.ops = nil
+	s.overlay = make(map[string]int)
+}
+
+// Commit applies the buffered writes in one guarded transaction
+func (s *Store) Commit(opErr error) error {
+	s.mu.Lock()
+	ops := s.ops
+	s.batching = false
+	s.ops = nil
+	s.overlay = nil
+	s.mu.Unlock()
+
+	if opErr != nil || len(ops) == 0 {
+		return opErr
+	}
+	return s.commit(ops)
+}
+
+// commit runs ops in a transaction that also advances the guard
+// On a conflict the latest guard revision is read, so the tree can be reloaded and the
+// operation retried
+func (s *Store) commit(ops []Op) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	s.mu.Lock()
+	expected := s.revision
+	s.mu.Unlock()
+
+	guarded := append(ops[:len(ops):len(ops)], Op{Key: s.guard})
+	applied, revision, err := s.client.Txn(ctx, s.guard, expected, guarded)
+	if err != nil {
+		return fmt.Errorf("failed to commit tree transaction: %w", err)
+	}
+	if !applied {
+		if err := s.loadRevision(ctx); err != nil {
+			return errors.Join(ErrConflict, err)
+		}
+		return ErrConflict
+	}
+
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
+
+// Write buffers the write during an operation and commits it on its own otherwise
+func (s *Store) Write(key string, data []byte) error {
+	return s.enqueue(Op{Key: key, Value: append([]byte(nil), data...)})
+}
+
+// Remove buffers the removal during an operation and commits it on its own otherwise
+func (s *Store) Remove(key string) error {
+	return s.enqueue(Op{Key: key, Delete: true})
+}
+
+// enqueue adds op to the running batch or commits it directly
+func (s *Store) enqueue(op Op) error {
+	s.mu.Lock()
+	if s.batching {
+		s.overlay[op.Key] = len(s.ops)
+		s.ops = append(s.ops, op)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+	return s.commit([]Op{op})
+}
+
+// Read serves buffered writes first, then etcd at the pinned or latest revision
+func (s *Store) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	if s.batching {
+		if i, ok := s.overlay[key]; ok {
+			op := s.ops[i]
+			s.mu.Unlock()
+			if op.Delete {
+				return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+			}
+			return append([]byte(nil), op.Value...), nil
+		}
+	}
+	readRev := s.readRev
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	data, _, found, err := s.client.Get(ctx, key, readRev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read element %s: %w", key, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return data, nil
+}
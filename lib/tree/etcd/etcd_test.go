@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// fakeEtcd is an in-memory multi-version key-value store with etcd transaction semantics
+type fakeEtcd struct {
+	mu       sync.Mutex
+	revision int64
+	history  map[string][]version
+	txns     int
+	watchers []fakeWatcher
+}
+
+type version struct {
+	revision int64
+	value    []byte
+	deleted  bool
+}
+
+type fakeWatcher struct {
+	prefix string
+	ch     chan WatchEvent
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{history: make(map[string][]version)}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, revision int64) ([]byte, int64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	versions := f.history[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if revision != 0 && v.revision > revision {
+			continue
+		}
+		if v.deleted {
+			return nil, 0, false, nil
+		}
+		return v.value, v.revision, true, nil
+	}
+	return nil, 0, false, nil
+}
+
+func (f *fakeEtcd) modRevision(key string) int64 {
+	versions := f.history[key]
+	if len(versions) == 0 || versions[len(versions)-1].deleted {
+		return 0
+	}
+	return versions[len(versions)-1].revision
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context, guard string, guardRevision int64, ops []Op) (bool, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txns++
+	if f.modRevision(guard) != guardRevision {
+		return false, f.revision, nil
+	}
+	f.revision++
+	for _, op := range ops {
+		f.history[op.Key] = append(f.history[op.Key], version{revision: f.revision, value: op.Value, deleted: op.Delete})
+		for _, w := range f.watchers {
+			if strings.HasPrefix(op.Key, w.prefix) {
+				w.ch <- WatchEvent{Key: op.Key, Value: op.Value, Delete: op.Delete, Revision: f.revision}
+			}
+		}
+	}
+	return true, f.revision, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, prefix string) <-chan WatchEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan WatchEvent, 64)
+	f.watchers = append(f.watchers, fakeWatcher{prefix: prefix, ch: ch})
+	return ch
+}
+
+func TestEtcdTreeSharedBetweenInstances(t *testing.T) {
+	client := newFakeEtcd()
+	first, firstStore := NewTree(client, "group-1")
+
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		before := client.txns
+		if err := first.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+		if got := client.txns - before; got != 1 {
+			t.Errorf("insert of %s used %d transactions, want 1", user, got)
+		}
+	}
+
+	second, secondStore, err := LoadTree(client, "group-1")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := len(second.GetLeaves()); got != 3 {
+		t.Fatalf("second instance sees %d leaves, want 3", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := firstStore.RemoteChanges(ctx)
+
+	if err := second.Delete("alice"); err != nil {
+		t.Fatalf("Failed to delete alice: %v", err)
+	}
+	revision := <-changes
+	if revision != secondStore.Revision() {
+		t.Errorf("watch reported revision %d, want %d", revision, secondStore.Revision())
+	}
+
+	// The first instance is behind, so its next commit must not overwrite the delete
+	if err := first.Insert("david", []byte("david_key")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, ok := first.Find("alice"); ok {
+		t.Errorf("the conflicting instance should have been reloaded without alice")
+	}
+	if err := first.Insert("david", []byte("david_key")); err != nil {
+		t.Fatalf("retrying after the conflict should succeed: %v", err)
+	}
+
+	if err := Refresh(second, secondStore); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if string(second.StructureHash()) != string(first.StructureHash()) {
+		t.Errorf("instances disagree after refresh")
+	}
+}
+
+func TestEtcdNewTreeRefusesExistingTree(t *testing.T) {
+	client := newFakeEtcd()
+	tr, _ := NewTree(client, "group-1")
+	tr.Insert("alice", []byte("alice_key"))
+
+	again, _ := NewTree(client, "group-1")
+	if err := again.Insert("bob", []byte("bob_key")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a second NewTree, got %v", err)
+	}
+	var _ tree.BatchStore = (*Store)(nil)
+}
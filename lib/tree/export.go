@@ -0,0 +1,180 @@
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// exportFormat identifies single-file tree exports
+const exportFormat = "treekem-tree/v1"
+
+// exportFile is the self-contained representation of a whole tree
+type exportFile struct {
+	Format      string      `json:"format"`
+	Version     uint64      `json:"version"`
+	Ciphersuite Ciphersuite `json:"ciphersuite,omitempty"`
+	Pinned      []string    `json:"pinned_names,omitempty"`
+
+	GroupID        []byte      `json:"group_id,omitempty"`
+	Epoch          uint64      `json:"epoch,omitempty"`
+	TranscriptHash []byte      `json:"transcript_hash,omitempty"`
+	InterimHash    []byte      `json:"interim_transcript_hash,omitempty"`
+	Extensions     []Extension `json:"extensions,omitempty"`
+	Successor      []byte      `json:"successor,omitempty"`
+
+	Nodes []exportedNode `json:"nodes"`
+}
+
+// exportedNode is a NodeInfo together with the state NodeInfo leaves out
+type exportedNode struct {
+	NodeInfo
+	LastModified time.Time   `json:"last_modified,omitempty"`
+	LastChecked  time.Time   `json:"last_checked,omitempty"`
+	History      []KeyRecord `json:"history,omitempty"`
+}
+
+// WriteTo streams the tree in the Export format, so it can be sent over a connection
+// or piped through compression or encryption without an intermediate file
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	data, err := t.marshalExport()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	if err != nil {
+		return int64(n), fmt.Errorf("failed to write export: %w", err)
+	}
+	return int64(n), nil
+}
+
+// ReadFrom rebuilds a tree streamed by WriteTo or stored by Export and persists it to store
+// It reads one export document; r may be buffered past its end
+func ReadFrom(r io.Reader, store Store, opts ...Option) (*Tree, error) {
+	var export exportFile
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("failed to decode export: %w", err)
+	}
+	return buildExport(&export, store, opts)
+}
+
+// Export writes the entire tree - topology, keys, indices, timestamps and key history - to one file
+// The file is replaced atomically, so readers never observe a partial export
+func (t *Tree) Export(path string) error {
+	data, err := t.marshalExport()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// marshalExport encodes the tree in the single-file export format
+func (t *Tree) marshalExport() ([]byte, error) {
+	export := exportFile{
+		Format:      exportFormat,
+		Version:     t.version,
+		Ciphersuite: t.ciphersuite,
+		Pinned:      t.PinnedNames(),
+
+		GroupID:        t.groupID,
+		Epoch:          t.epoch,
+		TranscriptHash: t.transcriptHash,
+		InterimHash:    t.interimHash,
+		Extensions:     t.groupExtensions,
+		Successor:      t.successor,
+
+		Nodes: []exportedNode{},
+	}
+	structure := t.GetTreeStructure()
+	for _, element := range t.GetAllElements() {
+		if err := element.unshelve(); err != nil {
+			return nil, err
+		}
+		export.Nodes = append(export.Nodes, exportedNode{
+			NodeInfo:     *structure[element.name],
+			LastModified: element.lastModified,
+			LastChecked:  element.lastChecked,
+			History:      element.history,
+		})
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export: %w", err)
+	}
+	return data, nil
+}
+
+// ImportFile rebuilds a tree written by Export and persists it to store
+func ImportFile(path string, store Store, opts ...Option) (*Tree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	return unmarshalExport(data, store, opts)
+}
+
+// unmarshalExport decodes a single-file export into a tree persisted to store
+func unmarshalExport(data []byte, store Store, opts []Option) (*Tree, error) {
+	var export exportFile
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal export: %w", err)
+	}
+	return buildExport(&export, store, opts)
+}
+
+// buildExport rebuilds the tree described by a decoded export
+func buildExport(export *exportFile, store Store, opts []Option) (*Tree, error) {
+	if export.Format != exportFormat {
+		return nil, fmt.Errorf("unsupported export format %q", export.Format)
+	}
+
+	nodes := make([]NodeInfo, len(export.Nodes))
+	byName := make(map[string]*exportedNode, len(export.Nodes))
+	for i := range export.Nodes {
+		nodes[i] = export.Nodes[i].NodeInfo
+		byName[nodes[i].Name] = &export.Nodes[i]
+	}
+
+	if export.Ciphersuite != 0 {
+		opts = append([]Option{WithCiphersuite(export.Ciphersuite)}, opts...)
+	}
+	if export.GroupID != nil {
+		opts = append([]Option{WithGroupID(export.GroupID)}, opts...)
+	}
+	t, err := importNodes(nodes, store, opts, func(t *Tree, element *Element) {
+		node := byName[element.name]
+		element.lastModified = node.LastModified
+		element.lastChecked = node.LastChecked
+		element.history = node.History
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.version = export.Version
+	t.epoch, t.transcriptHash, t.groupExtensions = export.Epoch, export.TranscriptHash, export.Extensions
+	t.interimHash = export.InterimHash
+	t.successor = export.Successor
+	if len(export.Pinned) > 0 {
+		t.pinned = make(map[string]struct{}, len(export.Pinned))
+		for _, name := range export.Pinned {
+			t.pinned[name] = struct{}{}
+		}
+	}
+	if err := t.saveManifest(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
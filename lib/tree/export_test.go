@@ -0,0 +1,110 @@
+package tree
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportFile(t *testing.T) {
+	source, err := NewTree(t.TempDir(), WithKeyHistory(4))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := source.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	source.Delete("user_3")
+	source.UpdateIntermediateKeys()
+	source.Insert("user_6", []byte("user_6_key"))
+	source.UpdateIntermediateKeys()
+	source.Pin("user_0")
+
+	path := filepath.Join(t.TempDir(), "tree.json")
+	if err := source.Export(path); err != nil {
+		t.Fatalf("Failed to export tree: %v", err)
+	}
+
+	imported, err := ImportFile(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to import tree: %v", err)
+	}
+	if !bytes.Equal(imported.StructureHash(), source.StructureHash()) {
+		t.Errorf("imported tree differs from the source")
+	}
+	if imported.Version() != source.Version() {
+		t.Errorf("expected version %d, got %d", source.Version(), imported.Version())
+	}
+	if !imported.IsPinned("user_0") {
+		t.Errorf("pins should survive the export")
+	}
+
+	head, _ := source.Find(source.Head().Name())
+	restored, ok := imported.Find(head.Name())
+	if !ok {
+		t.Fatalf("intermediate node %s missing after import", head.Name())
+	}
+	if !restored.LastModified().Equal(head.LastModified()) {
+		t.Errorf("expected last modified %v, got %v", head.LastModified(), restored.LastModified())
+	}
+	if len(head.KeyHistory(0)) == 0 {
+		t.Fatalf("expected the root to have key history")
+	}
+	if len(restored.KeyHistory(0)) != len(head.KeyHistory(0)) {
+		t.Errorf("expected %d history records, got %d", len(head.KeyHistory(0)), len(restored.KeyHistory(0)))
+	}
+}
+
+func TestImportFileRejectsUnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.json")
+	if err := os.WriteFile(path, []byte(`{"format":"treekem-tree/v9","nodes":[]}`), 0644); err != nil {
+		t.Fatalf("Failed to write export: %v", err)
+	}
+	if _, err := ImportFile(path, nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+	if _, err := ImportFile(filepath.Join(t.TempDir(), "missing.json"), nil); err == nil {
+		t.Errorf("expected an error for a missing export")
+	}
+}
+
+func TestWriteToReadFromThroughGzip(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, []byte(name+"_key"))
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		compressed := gzip.NewWriter(writer)
+		_, err := source.WriteTo(compressed)
+		if err == nil {
+			err = compressed.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	decompressed, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	imported, err := ReadFrom(decompressed, nil)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	if !bytes.Equal(imported.StructureHash(), source.StructureHash()) {
+		t.Errorf("streamed tree differs from the source")
+	}
+
+	if _, err := ReadFrom(bytes.NewReader([]byte(`{"format":`)), nil); err == nil {
+		t.Errorf("expected an error for a truncated stream")
+	}
+}
@@ -0,0 +1,193 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// Group context extension types of RFC 9420 section 17.3
+// Types outside these are application defined and kept as opaque data
+const (
+	ExtensionTypeApplicationID        uint16 = 0x0001
+	ExtensionTypeRequiredCapabilities uint16 = 0x0003
+	ExtensionTypeExternalSenders      uint16 = 0x0005
+)
+
+// ErrUnsupportedCapability is returned when a leaf lacks a capability the group requires
+var ErrUnsupportedCapability = errors.New("leaf does not support a required capability")
+
+// RequiredCapabilities is the required_capabilities extension (RFC 9420 section 11.1)
+// Every member's leaf node must list each of these in its Capabilities
+type RequiredCapabilities struct {
+	Extensions  []uint16
+	Proposals   []uint16
+	Credentials []uint16
+}
+
+// MarshalBinary encodes the extension data in its TLS presentation format
+func (rc *RequiredCapabilities) MarshalBinary() ([]byte, error) {
+	w := &tls.Writer{}
+	for _, values := range [][]uint16{rc.Extensions, rc.Proposals, rc.Credentials} {
+		if err := w.Uint16s(values); err != nil {
+			return nil, err
+		}
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalBinary decodes extension data written by MarshalBinary
+func (rc *RequiredCapabilities) UnmarshalBinary(data []byte) error {
+	r := &tls.Reader{Buf: data}
+	for _, values := range []*[]uint16{&rc.Extensions, &rc.Proposals, &rc.Credentials} {
+		decoded, err := r.Uint16s()
+		if err != nil {
+			return fmt.Errorf("invalid required capabilities: %w", err)
+		}
+		*values = decoded
+	}
+	if len(r.Buf) != 0 {
+		return fmt.Errorf("invalid required capabilities: %d trailing bytes", len(r.Buf))
+	}
+	return nil
+}
+
+// Check returns ErrUnsupportedCapability when caps misses a required capability
+func (rc *RequiredCapabilities) Check(caps Capabilities) error {
+	for _, required := range []struct {
+		kind      string
+		values    []uint16
+		supported []uint16
+	}{
+		{"extension", rc.Extensions, caps.Extensions},
+		{"proposal", rc.Proposals, caps.Proposals},
+		{"credential", rc.Credentials, caps.Credentials},
+	} {
+		for _, v := range required.values {
+			if !slices.Contains(required.supported, v) {
+				return fmt.Errorf("%w: %s type 0x%04x", ErrUnsupportedCapability, required.kind, v)
+			}
+		}
+	}
+	return nil
+}
+
+// ExternalSender is a party outside the group allowed to send proposals (RFC 9420 section 12.1.8.1)
+type ExternalSender struct {
+	SignatureKey []byte
+	Credential   Credential
+}
+
+// MarshalExternalSenders encodes the data of the external_senders extension
+func MarshalExternalSenders(senders []ExternalSender) ([]byte, error) {
+	w := &tls.Writer{}
+	err := w.Vector(func(w *tls.Writer) error {
+		for _, sender := range senders {
+			if err := w.Opaque(sender.SignatureKey); err != nil {
+				return err
+			}
+			if err := sender.Credential.encode(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode external senders: %w", err)
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalExternalSenders decodes the data of the external_senders extension
+func UnmarshalExternalSenders(data []byte) ([]ExternalSender, error) {
+	r := &tls.Reader{Buf: data}
+	var senders []ExternalSender
+	err := r.Vector(func(r *tls.Reader) error {
+		var sender ExternalSender
+		var err error
+		if sender.SignatureKey, err = r.Opaque(); err != nil {
+			return err
+		}
+		if err := sender.Credential.decode(r); err != nil {
+			return err
+		}
+		senders = append(senders, sender)
+		return nil
+	})
+	if err == nil && len(r.Buf) != 0 {
+		err = fmt.Errorf("%d trailing bytes", len(r.Buf))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid external senders: %w", err)
+	}
+	return senders, nil
+}
+
+// GroupExtension returns the data of the group context extension of type kind
+func (t *Tree) GroupExtension(kind uint16) ([]byte, bool) {
+	for _, ext := range t.groupExtensions {
+		if ext.Type == kind {
+			return slices.Clone(ext.Data), true
+		}
+	}
+	return nil, false
+}
+
+// RequiredCapabilities returns the group's required_capabilities, nil when it has none
+func (t *Tree) RequiredCapabilities() (*RequiredCapabilities, error) {
+	return requiredCapabilitiesOf(t.groupExtensions)
+}
+
+// ExternalSenders returns the group's external_senders, nil when it has none
+func (t *Tree) ExternalSenders() ([]ExternalSender, error) {
+	data, ok := t.GroupExtension(ExtensionTypeExternalSenders)
+	if !ok {
+		return nil, nil
+	}
+	return UnmarshalExternalSenders(data)
+}
+
+// requiredCapabilitiesOf decodes the required_capabilities among extensions
+func requiredCapabilitiesOf(extensions []Extension) (*RequiredCapabilities, error) {
+	for _, ext := range extensions {
+		if ext.Type == ExtensionTypeRequiredCapabilities {
+			rc := &RequiredCapabilities{}
+			if err := rc.UnmarshalBinary(ext.Data); err != nil {
+				return nil, err
+			}
+			return rc, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkGroupExtensions validates extensions before they replace the group's, see SetGroupExtensions
+// Each type appears once, the known ones decode and every member meets the required capabilities
+func (t *Tree) checkGroupExtensions(extensions []Extension) error {
+	seen := make(map[uint16]bool, len(extensions))
+	for _, ext := range extensions {
+		if seen[ext.Type] {
+			return fmt.Errorf("duplicate group context extension 0x%04x", ext.Type)
+		}
+		seen[ext.Type] = true
+		if ext.Type == ExtensionTypeExternalSenders {
+			if _, err := UnmarshalExternalSenders(ext.Data); err != nil {
+				return err
+			}
+		}
+	}
+	required, err := requiredCapabilitiesOf(extensions)
+	if err != nil || required == nil {
+		return err
+	}
+	for _, leaf := range t.GetLeaves() {
+		if node := leaf.LeafNode(); node != nil {
+			if err := required.Check(node.Capabilities); err != nil {
+				return fmt.Errorf("member %s: %w", leaf.name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testCapableLeafNode returns a key package leaf node for identity that also supports proposals
+func testCapableLeafNode(t *testing.T, identity string, proposals ...uint16) *LeafNode {
+	t.Helper()
+	leaf, signer := newTestLeafNode(t, identity)
+	leaf.Capabilities.Proposals = proposals
+	if err := leaf.Sign(signer, nil, 0); err != nil {
+		t.Fatalf("Failed to sign leaf node: %v", err)
+	}
+	return leaf
+}
+
+func TestGroupExtensions(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	if err := tr.InsertLeafNode("alice", testCapableLeafNode(t, "alice", 0xff02)); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+	if err := tr.InsertLeafNode("bob", testLeafNode(t, "bob")); err != nil {
+		t.Fatalf("Failed to insert bob: %v", err)
+	}
+
+	required := &RequiredCapabilities{Proposals: []uint16{0xff02}, Credentials: []uint16{uint16(CredentialBasic)}}
+	data, _ := required.MarshalBinary()
+	var decoded RequiredCapabilities
+	if err := decoded.UnmarshalBinary(data); err != nil || len(decoded.Proposals) != 1 || decoded.Credentials[0] != uint16(CredentialBasic) {
+		t.Fatalf("required capabilities should round trip: %+v, %v", decoded, err)
+	}
+	extensions := []Extension{{Type: ExtensionTypeRequiredCapabilities, Data: data}}
+	if err := tr.SetGroupExtensions(extensions); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Fatalf("bob lacks proposal 0xff02, expected ErrUnsupportedCapability, got %v", err)
+	}
+	if len(tr.GroupContext().Extensions) != 0 {
+		t.Errorf("rejected extensions should not be installed")
+	}
+	if err := tr.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+
+	senders := []ExternalSender{{SignatureKey: []byte("delivery service key"), Credential: Credential{Type: CredentialBasic, Identity: []byte("ds")}}}
+	encoded, err := MarshalExternalSenders(senders)
+	if err != nil {
+		t.Fatalf("Failed to encode external senders: %v", err)
+	}
+	extensions = append(extensions, Extension{Type: ExtensionTypeExternalSenders, Data: encoded}, Extension{Type: 0xff00, Data: []byte("room")})
+	if err := tr.SetGroupExtensions(extensions); err != nil {
+		t.Fatalf("Failed to set group extensions: %v", err)
+	}
+	if err := tr.SetGroupExtensions(append(extensions, Extension{Type: 0xff00})); err == nil {
+		t.Errorf("duplicate extension types should be rejected")
+	}
+	if err := tr.SetGroupExtensions([]Extension{{Type: ExtensionTypeExternalSenders, Data: []byte{1}}}); err == nil {
+		t.Errorf("malformed external senders should be rejected")
+	}
+
+	got, err := tr.ExternalSenders()
+	if err != nil || len(got) != 1 || !bytes.Equal(got[0].SignatureKey, senders[0].SignatureKey) || got[0].Credential.Subject() != "ds" {
+		t.Errorf("external senders should be readable back: %+v, %v", got, err)
+	}
+	if app, ok := tr.GroupExtension(0xff00); !ok || string(app) != "room" {
+		t.Errorf("application extensions should be kept as given, got %q", app)
+	}
+
+	// New members must meet the required capabilities
+	if err := tr.InsertLeafNode("charlie", testLeafNode(t, "charlie")); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("charlie lacks proposal 0xff02, expected ErrUnsupportedCapability, got %v", err)
+	}
+	if err := tr.InsertLeafNode("dave", testCapableLeafNode(t, "dave", 0xff02)); err != nil {
+		t.Errorf("dave meets the required capabilities: %v", err)
+	}
+}
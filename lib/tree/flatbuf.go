@@ -0,0 +1,384 @@
+package tree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+
+	"github.com/snowmerak/mls/lib/tree/internal/nodefb"
+)
+
+//go:generate flatc --go --go-namespace nodefb -o internal node.fbs
+
+// Elements written with WithFlatBufferEncoding follow the FlatBuffers layout of node.fbs,
+// built and read through the flatc output in internal/nodefb. Readers verify the buffer
+// once and then read fields in place through the generated accessors. Loading a tree
+// reads only the skeleton of each node, its name, links and counts; the record is kept
+// and the payload, keys, history and leaf node, is read from it the first time it is
+// used. Decoded byte fields are copies and never share memory with the record buffer.
+
+// WithFlatBufferEncoding writes elements in the FlatBuffers format described by node.fbs
+// Loading such a node reads its skeleton fields by offset instead of parsing a document
+// and leaves the payload in the record until it is read, so loading a large tree costs
+// a fixed handful of allocations per node however many fields the nodes carry.
+// Elements in other formats stay readable and are converted as they are rewritten
+func WithFlatBufferEncoding() Option {
+	return func(t *Tree) {
+		t.format = formatFlatBuffers
+	}
+}
+
+// Field slots of the Node table, in node.fbs order
+const (
+	fbNodeName = iota
+	fbNodePublicKey
+	fbNodeKeyAlgorithm
+	fbNodeKeyEncoding
+	fbNodeLeftCount
+	fbNodeRightCount
+	fbNodeLeftChild
+	fbNodeRightChild
+	fbNodeType
+	fbNodeLeafIndex
+	fbNodeLastModified
+	fbNodeLastChecked
+	fbNodeHistory
+	fbNodeLeafNode
+	fbNodeParentHash
+	fbNodeUnmerged
+	fbNodeVersion
+)
+
+// Field slots of the KeyRecord table
+const (
+	fbRecordKey = iota
+	fbRecordAlgorithm
+	fbRecordEncoding
+	fbRecordEpoch
+	fbRecordReplacedAt
+)
+
+// fbKind is the wire type of a table field
+type fbKind uint8
+
+const (
+	fbUint8 fbKind = iota + 1
+	fbInt32
+	fbInt64
+	fbString
+	fbBytes
+	fbTables
+	fbUint32s
+)
+
+// size returns the inline size of a field of this kind
+func (k fbKind) size() int {
+	switch k {
+	case fbUint8:
+		return 1
+	case fbInt64:
+		return 8
+	default:
+		return 4
+	}
+}
+
+var (
+	fbNodeSchema   = []fbKind{fbString, fbBytes, fbUint8, fbUint8, fbInt32, fbInt32, fbString, fbString, fbString, fbInt32, fbInt64, fbInt64, fbTables, fbBytes, fbBytes, fbUint32s, fbInt64}
+	fbRecordSchema = []fbKind{fbBytes, fbUint8, fbUint8, fbInt64, fbInt64}
+)
+
+// isFlatBuffer reports whether encoded carries the node.fbs file identifier
+func isFlatBuffer(encoded []byte) bool {
+	return len(encoded) >= 8 && string(encoded[4:8]) == nodefb.NodeIdentifier
+}
+
+func fbTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fbTimeOf(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// fbCreateBytes writes a byte vector, 0 when empty so the field is left absent
+func fbCreateBytes(b *flatbuffers.Builder, data []byte) flatbuffers.UOffsetT {
+	if len(data) == 0 {
+		return 0
+	}
+	return b.CreateByteVector(data)
+}
+
+// fbCreateString writes a string, 0 when empty so the field is left absent
+func fbCreateString(b *flatbuffers.Builder, s string) flatbuffers.UOffsetT {
+	if s == "" {
+		return 0
+	}
+	return b.CreateString(s)
+}
+
+// encodeFlatBuffer encodes an element as a node.fbs Node
+func encodeFlatBuffer(data elementData) []byte {
+	b := flatbuffers.NewBuilder(256)
+
+	// Referenced objects are written before the tables holding them
+	var history flatbuffers.UOffsetT
+	if len(data.History) > 0 {
+		records := make([]flatbuffers.UOffsetT, len(data.History))
+		for i, record := range data.History {
+			key := fbCreateBytes(b, record.Key)
+			nodefb.KeyRecordStart(b)
+			if key != 0 {
+				nodefb.KeyRecordAddKey(b, key)
+			}
+			nodefb.KeyRecordAddAlgorithm(b, byte(record.Algorithm))
+			nodefb.KeyRecordAddEncoding(b, byte(record.Encoding))
+			nodefb.KeyRecordAddEpoch(b, record.Epoch)
+			nodefb.KeyRecordAddReplacedAt(b, fbTime(record.ReplacedAt))
+			records[i] = nodefb.KeyRecordEnd(b)
+		}
+		history = b.CreateVectorOfTables(records)
+	}
+	var unmerged flatbuffers.UOffsetT
+	if len(data.Unmerged) > 0 {
+		nodefb.NodeStartUnmergedLeavesVector(b, len(data.Unmerged))
+		for i := len(data.Unmerged) - 1; i >= 0; i-- {
+			b.PrependUint32(uint32(data.Unmerged[i]))
+		}
+		unmerged = b.EndVector(len(data.Unmerged))
+	}
+	name := fbCreateString(b, data.Name)
+	publicKey := fbCreateBytes(b, data.PublicKey)
+	leftChild := fbCreateString(b, data.LeftChild)
+	rightChild := fbCreateString(b, data.RightChild)
+	nodeType := fbCreateString(b, data.NodeType)
+	leafNode := fbCreateBytes(b, data.LeafNode)
+	parentHash := fbCreateBytes(b, data.ParentHash)
+
+	// Absent offsets are skipped like the scalar defaults the Add functions skip
+	nodefb.NodeStart(b)
+	for _, field := range []struct {
+		offset flatbuffers.UOffsetT
+		add    func(*flatbuffers.Builder, flatbuffers.UOffsetT)
+	}{
+		{name, nodefb.NodeAddName},
+		{publicKey, nodefb.NodeAddPublicKey},
+		{leftChild, nodefb.NodeAddLeftChild},
+		{rightChild, nodefb.NodeAddRightChild},
+		{nodeType, nodefb.NodeAddNodeType},
+		{history, nodefb.NodeAddHistory},
+		{leafNode, nodefb.NodeAddLeafNode},
+		{parentHash, nodefb.NodeAddParentHash},
+		{unmerged, nodefb.NodeAddUnmergedLeaves},
+	} {
+		if field.offset != 0 {
+			field.add(b, field.offset)
+		}
+	}
+	nodefb.NodeAddKeyAlgorithm(b, byte(data.KeyAlgorithm))
+	nodefb.NodeAddKeyEncoding(b, byte(data.KeyEncoding))
+	nodefb.NodeAddLeftCount(b, int32(data.LeftCount))
+	nodefb.NodeAddRightCount(b, int32(data.RightCount))
+	nodefb.NodeAddLeafIndex(b, int32(data.LeafIndex))
+	nodefb.NodeAddLastModified(b, fbTime(data.LastModified))
+	nodefb.NodeAddLastChecked(b, fbTime(data.LastChecked))
+	nodefb.NodeAddVersion(b, data.Version)
+	nodefb.FinishNodeBuffer(b, nodefb.NodeEnd(b))
+	return b.FinishedBytes()
+}
+
+// fbTable is a verified table inside a buffer
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+var errFlatBufferBounds = errors.New("offset out of bounds")
+
+// openFlatBuffer verifies a Node buffer so the generated accessors can read it
+// without further checks; they would panic on a corrupt buffer
+func openFlatBuffer(encoded []byte) (nodefb.Node, error) {
+	var node nodefb.Node
+	if !isFlatBuffer(encoded) {
+		return node, errors.New("missing FlatBuffers identifier")
+	}
+	root := fbTable{buf: encoded, pos: int(binary.LittleEndian.Uint32(encoded))}
+	if err := root.verify(fbNodeSchema, 0); err != nil {
+		return node, fmt.Errorf("corrupt FlatBuffers element: %w", err)
+	}
+	node.Init(encoded, flatbuffers.UOffsetT(root.pos))
+	return node, nil
+}
+
+// verify checks the vtable, every field and every referenced object of the table
+func (t fbTable) verify(schema []fbKind, depth int) error {
+	if depth > 1 || t.pos < 0 || t.pos%4 != 0 || t.pos+4 > len(t.buf) {
+		return errFlatBufferBounds
+	}
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if vtable < 0 || vtable%2 != 0 || vtable+4 > len(t.buf) {
+		return errFlatBufferBounds
+	}
+	vtableSize := int(binary.LittleEndian.Uint16(t.buf[vtable:]))
+	tableSize := int(binary.LittleEndian.Uint16(t.buf[vtable+2:]))
+	if vtableSize < 4 || vtableSize%2 != 0 || vtable+vtableSize > len(t.buf) || t.pos+tableSize > len(t.buf) {
+		return errFlatBufferBounds
+	}
+
+	for slot, kind := range schema {
+		at := t.field(slot)
+		if at == 0 {
+			continue
+		}
+		if at+kind.size() > t.pos+tableSize {
+			return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+		}
+		if kind.size() != 4 || kind == fbInt32 {
+			continue
+		}
+
+		target := at + int(binary.LittleEndian.Uint32(t.buf[at:]))
+		if target%4 != 0 || target+4 > len(t.buf) || target < at {
+			return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+		}
+		n := int(binary.LittleEndian.Uint32(t.buf[target:]))
+		switch kind {
+		case fbString:
+			if n+1 > len(t.buf)-target-4 || t.buf[target+4+n] != 0 {
+				return fmt.Errorf("field %d: unterminated string", slot)
+			}
+		case fbBytes:
+			if n > len(t.buf)-target-4 {
+				return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+			}
+		case fbUint32s:
+			if n > (len(t.buf)-target-4)/4 {
+				return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+			}
+		case fbTables:
+			if n > (len(t.buf)-target-4)/4 {
+				return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+			}
+			for i := 0; i < n; i++ {
+				at := target + 4 + 4*i
+				item := fbTable{buf: t.buf, pos: at + int(binary.LittleEndian.Uint32(t.buf[at:]))}
+				if item.pos < at {
+					return fmt.Errorf("field %d: %w", slot, errFlatBufferBounds)
+				}
+				if err := item.verify(fbRecordSchema, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// field returns the position of a field, 0 when it is absent
+func (t fbTable) field(slot int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	entry := 4 + 2*slot
+	if entry+2 > int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(t.buf[vtable+entry:]))
+	if offset == 0 {
+		return 0
+	}
+	return t.pos + offset
+}
+
+// flatSkeleton reads the fields a tree needs to link a node in place: name, children,
+// counts, type, leaf index, timestamps and version. The four strings share one allocation
+func flatSkeleton(node *nodefb.Node) elementData {
+	fields := [...][]byte{node.Name(), node.LeftChild(), node.RightChild(), node.NodeType()}
+	size := 0
+	for _, field := range fields {
+		size += len(field)
+	}
+	var b strings.Builder
+	b.Grow(size)
+	for _, field := range fields {
+		b.Write(field)
+	}
+	all := b.String()
+	var decoded [len(fields)]string
+	for i, field := range fields {
+		decoded[i], all = all[:len(field)], all[len(field):]
+	}
+
+	return elementData{
+		Name:         decoded[0],
+		LeftCount:    int(node.LeftCount()),
+		RightCount:   int(node.RightCount()),
+		LeftChild:    decoded[1],
+		RightChild:   decoded[2],
+		NodeType:     decoded[3],
+		LeafIndex:    int(node.LeafIndex()),
+		LastModified: fbTimeOf(node.LastModified()),
+		LastChecked:  fbTimeOf(node.LastChecked()),
+		Version:      node.Version(),
+	}
+}
+
+// fbCopy hands out copies of byte fields from one allocation sized up front
+type fbCopy struct {
+	buf []byte
+}
+
+// take copies field into the shared allocation, nil when the field is absent
+func (c *fbCopy) take(field []byte) []byte {
+	if field == nil {
+		return nil
+	}
+	start := len(c.buf)
+	c.buf = append(c.buf, field...)
+	return c.buf[start:len(c.buf):len(c.buf)]
+}
+
+// flatPayload copies the key material of node into data: public key, key tags, key
+// history, leaf node, parent hash and unmerged leaves. All byte fields share one allocation
+func flatPayload(node *nodefb.Node, data *elementData) {
+	var record nodefb.KeyRecord
+	size := len(node.PublicKeyBytes()) + len(node.LeafNodeBytes()) + len(node.ParentHashBytes())
+	for i := range node.HistoryLength() {
+		node.History(&record, i)
+		size += len(record.KeyBytes())
+	}
+	c := &fbCopy{buf: make([]byte, 0, size)}
+
+	if n := node.HistoryLength(); n > 0 {
+		data.History = make([]KeyRecord, n)
+		for i := range data.History {
+			node.History(&record, i)
+			data.History[i] = KeyRecord{
+				Key:        c.take(record.KeyBytes()),
+				Algorithm:  KeyAlgorithm(record.Algorithm()),
+				Encoding:   KeyEncoding(record.Encoding()),
+				Epoch:      record.Epoch(),
+				ReplacedAt: fbTimeOf(record.ReplacedAt()),
+			}
+		}
+	}
+	if n := node.UnmergedLeavesLength(); n > 0 {
+		data.Unmerged = make([]int, n)
+		for i := range data.Unmerged {
+			data.Unmerged[i] = int(node.UnmergedLeaves(i))
+		}
+	}
+	data.PublicKey = c.take(node.PublicKeyBytes())
+	data.KeyAlgorithm = KeyAlgorithm(node.KeyAlgorithm())
+	data.KeyEncoding = KeyEncoding(node.KeyEncoding())
+	data.LeafNode = c.take(node.LeafNodeBytes())
+	data.ParentHash = c.take(node.ParentHashBytes())
+}
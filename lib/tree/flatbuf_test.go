@@ -0,0 +1,171 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlatBufferRoundTrip(t *testing.T) {
+	data := elementData{
+		Name:         "alice",
+		PublicKey:    bytes.Repeat([]byte{0xab}, 32),
+		KeyAlgorithm: KeyAlgorithmX25519,
+		KeyEncoding:  KeyEncodingRaw,
+		LeftCount:    3,
+		RightCount:   2,
+		LeftChild:    "left.json",
+		RightChild:   "right.json",
+		NodeType:     "intermediate",
+		LeafIndex:    7,
+		LastModified: time.Unix(1700000000, 123),
+		History: []KeyRecord{
+			{Key: []byte("newer"), Epoch: 5, ReplacedAt: time.Unix(1650000000, 0)},
+			{Key: []byte("older"), Algorithm: KeyAlgorithmP256, Epoch: 4},
+		},
+	}
+
+	encoded, err := encodeElementData(data, formatFlatBuffers)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, err := decodeElementData(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if decoded.Name != data.Name || !bytes.Equal(decoded.PublicKey, data.PublicKey) ||
+		decoded.KeyAlgorithm != data.KeyAlgorithm || decoded.KeyEncoding != data.KeyEncoding ||
+		decoded.LeftCount != 3 || decoded.RightCount != 2 || decoded.LeftChild != "left.json" ||
+		decoded.RightChild != "right.json" || decoded.NodeType != "intermediate" || decoded.LeafIndex != 7 ||
+		!decoded.LastModified.Equal(data.LastModified) || !decoded.LastChecked.IsZero() {
+		t.Errorf("round trip mismatch: %+v", decoded)
+	}
+	if len(decoded.History) != 2 || string(decoded.History[1].Key) != "older" ||
+		decoded.History[1].Algorithm != KeyAlgorithmP256 || !decoded.History[0].ReplacedAt.Equal(data.History[0].ReplacedAt) {
+		t.Errorf("history mismatch: %+v", decoded.History)
+	}
+
+	// Decoded fields are copies, so reusing the record buffer leaves them intact
+	clear(encoded)
+	if !bytes.Equal(decoded.PublicKey, data.PublicKey) || string(decoded.History[1].Key) != "older" {
+		t.Errorf("decoded fields should not share memory with the encoded record")
+	}
+}
+
+// The layout is pinned byte for byte so a flatc or library upgrade that changes what
+// is written shows up here; readers built from node.fbs read either layout
+func TestFlatBufferGoldenBytes(t *testing.T) {
+	golden, _ := hex.DecodeString("" +
+		"34000000" + "544b4642" + // root table at 52, file_identifier "TKFB"
+		"000000000000" + // padding to align the vtable end
+		"2600" + "1c00" + // vtable at 14: 17 slots, 28-byte table
+		"1800" + "1400" + "1300" + strings.Repeat("0000", 13) + "0400" + // name, public_key, key_algorithm, version
+		"26000000" + // table at 52: vtable 38 bytes back
+		"0300000000000000" + // version 3
+		"00000000000000" + "01" + // padding, key_algorithm X25519
+		"08000000" + // public_key at 72 + 8
+		"0c000000" + // name at 76 + 12
+		"02000000" + "0102" + "0000" + // public_key, padded
+		"02000000" + "616200" + "00") // "ab", NUL terminated, padded
+
+	// Written by the encoder that laid tables out front to back before internal/nodefb
+	legacy, _ := hex.DecodeString("" +
+		"30000000" + "544b4642" + "2600" + "1800" +
+		"0400" + "0800" + "0c00" + strings.Repeat("0000", 13) + "1000" + "0000" +
+		"28000000" + "14000000" + "18000000" + "01000000" + "0300000000000000" +
+		"02000000" + "616200" + "00" + "02000000" + "0102")
+
+	data := elementData{Name: "ab", PublicKey: []byte{1, 2}, KeyAlgorithm: KeyAlgorithmX25519, Version: 3}
+	encoded, err := encodeElementData(data, formatFlatBuffers)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if !bytes.Equal(encoded, golden) {
+		t.Errorf("encoding changed:\n got %x\nwant %x", encoded, golden)
+	}
+
+	for _, encoded := range [][]byte{golden, legacy} {
+		decoded, err := decodeElementData(encoded)
+		if err != nil {
+			t.Fatalf("Failed to decode golden bytes: %v", err)
+		}
+		if decoded.Name != "ab" || !bytes.Equal(decoded.PublicKey, []byte{1, 2}) ||
+			decoded.KeyAlgorithm != KeyAlgorithmX25519 || decoded.Version != 3 || decoded.LeftChild != "" {
+			t.Errorf("golden bytes decoded to %+v", decoded)
+		}
+	}
+}
+
+func TestFlatBufferRejectsCorruption(t *testing.T) {
+	encoded, _ := encodeElementData(elementData{
+		Name:      "bob",
+		PublicKey: []byte("bob_key"),
+		NodeType:  "leaf",
+		History:   []KeyRecord{{Key: []byte("old"), Epoch: 1}},
+	}, formatFlatBuffers)
+
+	// Cutting only the trailing alignment padding leaves every object intact
+	whole, _ := decodeElementData(encoded)
+	for cut := 8; cut < len(encoded); cut++ {
+		if decoded, err := decodeElementData(encoded[:cut]); err == nil && !reflect.DeepEqual(decoded, whole) {
+			t.Fatalf("truncated element at %d bytes should fail to decode", cut)
+		}
+	}
+
+	// Flipping any byte must never panic; it either fails or decodes to something
+	for i := range encoded {
+		for _, mask := range []byte{0x01, 0x80, 0xff} {
+			corrupt := append([]byte(nil), encoded...)
+			corrupt[i] ^= mask
+			decodeElementData(corrupt)
+		}
+	}
+}
+
+func TestFlatBufferTree(t *testing.T) {
+	tempDir := t.TempDir()
+	store, _ := NewFileStore(tempDir)
+	tree, _ := NewTreeWithStore(store, WithFlatBufferEncoding(), WithKeyHistory(2))
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	tree.UpdateIntermediateKeys()
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("rotated_root_key"))
+
+	raw, _ := os.ReadFile(store.Key("user_3"))
+	if !isFlatBuffer(raw) {
+		t.Fatalf("elements should be FlatBuffers encoded")
+	}
+
+	loaded, err := LoadTreeFromStore(store, "", WithFlatBufferEncoding())
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	// The payload stays in the record until it is first read
+	leaf, _ := loaded.Find("user_3")
+	if leaf.record == nil {
+		t.Errorf("loading should leave the payload of %s in its record", leaf.Name())
+	}
+	if !bytes.Equal(leaf.PublicKey().Data, []byte("user_3_key")) || leaf.record != nil {
+		t.Errorf("reading the key should decode the record once")
+	}
+	if !bytes.Equal(loaded.StructureHash(), tree.StructureHash()) {
+		t.Errorf("loaded tree differs from the source")
+	}
+	if got := len(loaded.Head().KeyHistory(0)); got != 1 {
+		t.Errorf("expected 1 history record on the root, got %d", got)
+	}
+
+	// Strings and byte fields are copied out in one allocation each
+	if allocs := testing.AllocsPerRun(100, func() { decodeElementData(raw) }); allocs > 2 {
+		t.Errorf("decoding a leaf should take at most 2 allocations, got %.0f", allocs)
+	}
+}
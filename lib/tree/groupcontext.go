@@ -0,0 +1,225 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// GroupContext is the group state every member agrees on in an epoch (RFC 9420 section 8.1)
+type GroupContext struct {
+	Version                 uint16
+	CipherSuite             Ciphersuite
+	GroupID                 []byte
+	Epoch                   uint64
+	TreeHash                []byte
+	ConfirmedTranscriptHash []byte
+	Extensions              []Extension
+}
+
+// GroupContext returns the group context of the current epoch
+// The tree hash is computed from the tree as it is now
+func (t *Tree) GroupContext() GroupContext {
+	return GroupContext{
+		Version:                 ProtocolVersionMLS10,
+		CipherSuite:             t.ciphersuite,
+		GroupID:                 t.groupID,
+		Epoch:                   t.epoch,
+		TreeHash:                t.TreeHash(),
+		ConfirmedTranscriptHash: t.transcriptHash,
+		Extensions:              slices.Clone(t.groupExtensions),
+	}
+}
+
+// Epoch returns the current epoch
+// It starts at 0 and only AdvanceEpoch moves it on. Any number of inserts, deletes and
+// key changes happen within one epoch, as the proposals of one MLS commit do
+func (t *Tree) Epoch() uint64 {
+	return t.epoch
+}
+
+// AdvanceEpoch moves the tree into the next epoch, as a commit does (RFC 9420 section 12.4)
+// group.ProcessCommit calls it once per commit after applying its changes; a tree
+// maintained without that package calls it for each change the members should see as
+// a new epoch
+func (t *Tree) AdvanceEpoch() error {
+	if err := t.checkWritable("advance epoch"); err != nil {
+		return err
+	}
+	return t.advanceEpoch()
+}
+
+// SetConfirmedTranscriptHash records the confirmed transcript hash of the current epoch
+func (t *Tree) SetConfirmedTranscriptHash(hash []byte) error {
+	if err := t.checkWritable("set transcript hash"); err != nil {
+		return err
+	}
+	previous := t.transcriptHash
+	t.transcriptHash = slices.Clone(hash)
+	if err := t.saveManifest(); err != nil {
+		t.transcriptHash = previous
+		return err
+	}
+	return nil
+}
+
+// InterimTranscriptHash returns the interim transcript hash of the current epoch, the
+// confirmed transcript hash of the next commit builds on it
+func (t *Tree) InterimTranscriptHash() []byte {
+	return t.interimHash
+}
+
+// SetTranscriptHashes records the confirmed and interim transcript hashes of the current
+// epoch together, as a commit yields them
+func (t *Tree) SetTranscriptHashes(confirmed, interim []byte) error {
+	if err := t.checkWritable("set transcript hashes"); err != nil {
+		return err
+	}
+	previousConfirmed, previousInterim := t.transcriptHash, t.interimHash
+	t.transcriptHash, t.interimHash = slices.Clone(confirmed), slices.Clone(interim)
+	if err := t.saveManifest(); err != nil {
+		t.transcriptHash, t.interimHash = previousConfirmed, previousInterim
+		return err
+	}
+	return nil
+}
+
+// SetGroupExtensions replaces the group context extensions of the current epoch
+// Extension types must be unique, known types must decode and, when the extensions
+// carry required_capabilities, every member must meet them
+func (t *Tree) SetGroupExtensions(extensions []Extension) error {
+	if err := t.checkWritable("set group extensions"); err != nil {
+		return err
+	}
+	if err := t.checkGroupExtensions(extensions); err != nil {
+		return fmt.Errorf("failed to set group extensions: %w", err)
+	}
+	previous := t.groupExtensions
+	t.groupExtensions = slices.Clone(extensions)
+	if err := t.saveManifest(); err != nil {
+		t.groupExtensions = previous
+		return err
+	}
+	return nil
+}
+
+// RestoreGroupContext adopts gc as the tree's epoch state, as a joiner does after
+// importing the ratchet tree of a Welcome. The tree must hash to gc's tree hash and
+// match its ciphersuite and, when the tree has one, its group ID
+func (t *Tree) RestoreGroupContext(gc GroupContext) error {
+	if err := t.checkWritable("restore group context"); err != nil {
+		return err
+	}
+	if gc.CipherSuite != t.ciphersuite {
+		return fmt.Errorf("group context uses ciphersuite 0x%04x, tree uses 0x%04x", uint16(gc.CipherSuite), uint16(t.ciphersuite))
+	}
+	if t.groupID != nil && !bytes.Equal(gc.GroupID, t.groupID) {
+		return fmt.Errorf("group context belongs to group %x, not %x", gc.GroupID, t.groupID)
+	}
+	if !bytes.Equal(gc.TreeHash, t.TreeHash()) {
+		return fmt.Errorf("group context tree hash does not match the tree")
+	}
+	groupID, epoch, transcriptHash, extensions, generations := t.groupID, t.epoch, t.transcriptHash, t.groupExtensions, t.generations
+	if gc.Epoch != t.epoch {
+		t.generations = nil
+	}
+	t.groupID = slices.Clone(gc.GroupID)
+	t.epoch = gc.Epoch
+	t.transcriptHash = slices.Clone(gc.ConfirmedTranscriptHash)
+	t.groupExtensions = slices.Clone(gc.Extensions)
+	if err := t.saveManifest(); err != nil {
+		t.groupID, t.epoch, t.transcriptHash, t.groupExtensions, t.generations = groupID, epoch, transcriptHash, extensions, generations
+		return err
+	}
+	return nil
+}
+
+// advanceEpoch moves to the next epoch and persists it with the manifest
+// The message generations received in the previous epoch are dropped with it
+func (t *Tree) advanceEpoch() error {
+	generations := t.generations
+	t.epoch++
+	t.generations = nil
+	if err := t.saveManifest(); err != nil {
+		t.epoch--
+		t.generations = generations
+		return fmt.Errorf("failed to advance epoch: %w", err)
+	}
+	return nil
+}
+
+// MarshalBinary encodes the group context in its RFC 9420 wire format
+func (gc *GroupContext) MarshalBinary() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := gc.encode(w); err != nil {
+		return nil, fmt.Errorf("failed to encode group context: %w", err)
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalBinary decodes a group context written by MarshalBinary
+func (gc *GroupContext) UnmarshalBinary(data []byte) error {
+	decoded, rest, err := ReadGroupContext(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%d trailing bytes after group context", len(rest))
+	}
+	*gc = *decoded
+	return nil
+}
+
+// ReadGroupContext decodes a group context at the start of data and returns the bytes after it
+func ReadGroupContext(data []byte) (*GroupContext, []byte, error) {
+	r := &tls.Reader{Buf: data}
+	gc := &GroupContext{}
+	if err := gc.decode(r); err != nil {
+		return nil, nil, fmt.Errorf("invalid group context: %w", err)
+	}
+	return gc, r.Buf, nil
+}
+
+func (gc *GroupContext) encode(w *tls.Writer) error {
+	w.Uint16(gc.Version)
+	w.Uint16(uint16(gc.CipherSuite))
+	if err := w.Opaque(gc.GroupID); err != nil {
+		return err
+	}
+	w.Uint64(gc.Epoch)
+	if err := w.Opaque(gc.TreeHash); err != nil {
+		return err
+	}
+	if err := w.Opaque(gc.ConfirmedTranscriptHash); err != nil {
+		return err
+	}
+	return encodeExtensions(w, gc.Extensions)
+}
+
+func (gc *GroupContext) decode(r *tls.Reader) error {
+	var err error
+	if gc.Version, err = r.Uint16(); err != nil {
+		return err
+	}
+	cs, err := r.Uint16()
+	if err != nil {
+		return err
+	}
+	gc.CipherSuite = Ciphersuite(cs)
+	if gc.GroupID, err = r.Opaque(); err != nil {
+		return err
+	}
+	if gc.Epoch, err = r.Uint64(); err != nil {
+		return err
+	}
+	if gc.TreeHash, err = r.Opaque(); err != nil {
+		return err
+	}
+	if gc.ConfirmedTranscriptHash, err = r.Opaque(); err != nil {
+		return err
+	}
+	gc.Extensions, err = decodeExtensions(r)
+	return err
+}
@@ -0,0 +1,120 @@
+package tree
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupContextEpochs(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tr, _ := NewTreeWithStore(files, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if tr.Epoch() != 0 {
+		t.Fatalf("inserts should stay in the epoch, got %d", tr.Epoch())
+	}
+	if err := tr.AdvanceEpoch(); err != nil || tr.Epoch() != 1 {
+		t.Fatalf("AdvanceEpoch should move to epoch 1, got %d: %v", tr.Epoch(), err)
+	}
+
+	if _, err := tr.SetPathKeys("alice", testPathKeys(t, 2)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if err := tr.Delete("charlie"); err != nil {
+		t.Fatalf("Failed to delete charlie: %v", err)
+	}
+	path, _ := tr.GetPath("alice")
+	if err := tr.SetIntermediateNodeKey(path[0].Name(), testPathKeys(t, 1)[0]); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if tr.Epoch() != 1 {
+		t.Errorf("the changes of one commit should stay in its epoch, got %d", tr.Epoch())
+	}
+	if err := tr.AdvanceEpoch(); err != nil || tr.Epoch() != 2 {
+		t.Fatalf("AdvanceEpoch should move to epoch 2, got %d: %v", tr.Epoch(), err)
+	}
+
+	extensions := []Extension{{Type: 0xff00, Data: []byte("app")}}
+	if err := tr.SetConfirmedTranscriptHash([]byte("transcript")); err != nil {
+		t.Fatalf("Failed to set transcript hash: %v", err)
+	}
+	if err := tr.SetGroupExtensions(extensions); err != nil {
+		t.Fatalf("Failed to set extensions: %v", err)
+	}
+	gc := tr.GroupContext()
+	if gc.Epoch != 2 || !bytes.Equal(gc.GroupID, []byte("group")) || !bytes.Equal(gc.TreeHash, tr.TreeHash()) ||
+		!bytes.Equal(gc.ConfirmedTranscriptHash, []byte("transcript")) || len(gc.Extensions) != 1 {
+		t.Errorf("group context should reflect the tree: %+v", gc)
+	}
+
+	encoded, err := gc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode group context: %v", err)
+	}
+	var decoded GroupContext
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("Failed to decode group context: %v", err)
+	}
+	if reencoded, _ := decoded.MarshalBinary(); !bytes.Equal(reencoded, encoded) {
+		t.Errorf("group context should round trip")
+	}
+	if err := decoded.UnmarshalBinary(append(encoded, 0)); err == nil {
+		t.Errorf("trailing bytes should be rejected")
+	}
+
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	reloaded := loaded.GroupContext()
+	if again, _ := reloaded.MarshalBinary(); !bytes.Equal(again, encoded) {
+		t.Errorf("group context should persist with the tree")
+	}
+
+	exported := filepath.Join(t.TempDir(), "tree.json")
+	if err := tr.Export(exported); err != nil {
+		t.Fatalf("Failed to export tree: %v", err)
+	}
+	imported, err := ImportFile(exported, nil)
+	if err != nil {
+		t.Fatalf("Failed to import tree: %v", err)
+	}
+	restored := imported.GroupContext()
+	if again, _ := restored.MarshalBinary(); !bytes.Equal(again, encoded) {
+		t.Errorf("group context should survive export and import")
+	}
+}
+
+func TestRestoreGroupContext(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	data, err := tr.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	joined, err := ImportRatchetTree(data, nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+
+	gc := tr.GroupContext()
+	stale := gc
+	stale.TreeHash = []byte("stale")
+	if err := joined.RestoreGroupContext(stale); err == nil {
+		t.Errorf("group context of another tree should be rejected")
+	}
+	if err := joined.RestoreGroupContext(gc); err != nil {
+		t.Fatalf("Failed to restore group context: %v", err)
+	}
+	if joined.Epoch() != tr.Epoch() || !bytes.Equal(joined.GroupID(), []byte("group")) {
+		t.Errorf("joined tree should adopt the epoch and group ID")
+	}
+}
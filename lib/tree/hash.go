@@ -0,0 +1,53 @@
+package tree
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// StructureHash returns a digest of the tree topology, node types, leaf names and public keys
+// Intermediate node names are excluded since they are generated per tree instance,
+// so two trees built by the same operations hash equally regardless of their backend
+func (t *Tree) StructureHash() []byte {
+	return hashSubtree(t.head)
+}
+
+// hashSubtree hashes a node and its children bottom-up
+func hashSubtree(node *Element) []byte {
+	if node == nil {
+		return hashNode(false, "", "", nil, nil, nil)
+	}
+	return hashNode(true, node.nodeType, node.name, node.key(), hashSubtree(node.leftChild), hashSubtree(node.rightChild))
+}
+
+// hashNode hashes one node from its type, name, key and child hashes, or a missing node
+// when present is false. Trees and snapshots hash their nodes through it alike
+func hashNode(present bool, nodeType, name string, key, left, right []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte("TreeKEM-structure-hash"))
+
+	if !present {
+		hasher.Write([]byte{0})
+		return hasher.Sum(nil)
+	}
+
+	hasher.Write([]byte{1})
+	writeLengthPrefixed(hasher, []byte(nodeType))
+	if nodeType == "leaf" {
+		writeLengthPrefixed(hasher, []byte(name))
+	}
+	writeLengthPrefixed(hasher, key)
+	hasher.Write(left)
+	hasher.Write(right)
+
+	return hasher.Sum(nil)
+}
+
+// writeLengthPrefixed writes a 4-byte length prefix followed by data
+func writeLengthPrefixed(w io.Writer, data []byte) {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	w.Write(length)
+	w.Write(data)
+}
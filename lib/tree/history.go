@@ -0,0 +1,76 @@
+package tree
+
+import (
+	"bytes"
+	"time"
+)
+
+// KeyRecord is a public key a node held before it was replaced
+type KeyRecord struct {
+	Key        []byte       `json:"key"`
+	Algorithm  KeyAlgorithm `json:"algorithm,omitempty"`
+	Encoding   KeyEncoding  `json:"encoding,omitempty"`
+	Epoch      uint64       `json:"epoch"`       // last epoch in which the key was current, see Tree.Epoch
+	ReplacedAt time.Time    `json:"replaced_at"` // when the key was replaced
+}
+
+// PublicKey returns the recorded key with its tags
+func (r KeyRecord) PublicKey() PublicKey {
+	return PublicKey{Algorithm: r.Algorithm, Encoding: r.Encoding, Data: r.Key}
+}
+
+// WithKeyHistory keeps up to depth previous public keys per node
+// History is persisted with each element so it survives restarts
+func WithKeyHistory(depth int) Option {
+	return func(t *Tree) {
+		if depth > 0 {
+			t.historyDepth = depth
+		}
+	}
+}
+
+// KeyHistory returns up to limit previous keys of the node, newest first
+// A limit of zero or less returns every retained record
+func (e *Element) KeyHistory(limit int) []KeyRecord {
+	e.unshelve()
+	n := len(e.history)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	return append([]KeyRecord(nil), e.history[:n]...)
+}
+
+// setNodeKey replaces a node's key, recording the previous one when history is enabled
+// Empty placeholder keys are not recorded. A shelved payload that cannot be loaded fails
+// the change, as the stored payload would later replace the new key
+func (t *Tree) setNodeKey(node *Element, key PublicKey) error {
+	if err := node.unshelve(); err != nil {
+		return err
+	}
+	if t.historyDepth > 0 && len(node.publicKey) > 0 && !bytes.Equal(node.publicKey, key.Data) {
+		record := KeyRecord{
+			Key:        node.publicKey,
+			Algorithm:  node.keyAlgorithm,
+			Encoding:   node.keyEncoding,
+			Epoch:      t.epoch,
+			ReplacedAt: time.Now(),
+		}
+		n := min(len(node.history), t.historyDepth-1)
+		node.history = append([]KeyRecord{record}, node.history[:n]...)
+	}
+
+	// A parent hash covers the key it was computed with, and every leaf below a new
+	// key was sent its secret
+	if !bytes.Equal(node.publicKey, key.Data) {
+		node.parentHash = nil
+		node.unmerged = nil
+	}
+	node.publicKey = key.Data
+	node.keyAlgorithm = key.Algorithm
+	node.keyEncoding = key.Encoding
+	// A leaf node vouches for one encryption key, a bare key replacing it drops it
+	if node.leafNode != nil && !bytes.Equal(node.leafNode.EncryptionKey, key.Data) {
+		node.leafNode = nil
+	}
+	return nil
+}
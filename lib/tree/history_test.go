@@ -0,0 +1,65 @@
+package tree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeyHistoryIsBoundedAndPersisted(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tree, err := LoadTreeFromStore(files, "", WithKeyHistory(2))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	tree.Insert("alice", []byte("alice_key"))
+	tree.Insert("bob", []byte("bob_key"))
+
+	root := tree.Head().Name()
+	epochs := make([]uint64, 0, 4)
+	for i := 0; i < 4; i++ {
+		epochs = append(epochs, tree.Epoch())
+		if err := tree.SetIntermediateNodeKey(root, []byte(fmt.Sprintf("root_key_%d", i))); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+		tree.AdvanceEpoch()
+	}
+	if tree.Epoch() == tree.Version() {
+		t.Fatalf("test needs the epoch %d to differ from the version", tree.Epoch())
+	}
+
+	// The placeholder key is not recorded and only the two newest replaced keys are kept
+	history := tree.Head().KeyHistory(0)
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history records, got %d", len(history))
+	}
+	if string(history[0].Key) != "root_key_2" || string(history[1].Key) != "root_key_1" {
+		t.Errorf("unexpected history order: %q, %q", history[0].Key, history[1].Key)
+	}
+	if history[0].Epoch != epochs[3] || history[1].Epoch != epochs[2] {
+		t.Errorf("unexpected epochs %d, %d, want %d, %d", history[0].Epoch, history[1].Epoch, epochs[3], epochs[2])
+	}
+	if got := tree.Head().KeyHistory(1); len(got) != 1 || string(got[0].Key) != "root_key_2" {
+		t.Errorf("KeyHistory(1) should return only the newest record")
+	}
+
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := loaded.Head().KeyHistory(0); len(got) != 2 || string(got[0].Key) != "root_key_2" {
+		t.Errorf("history not restored after reload: %+v", got)
+	}
+}
+
+func TestKeyHistoryDisabledByDefault(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil)
+	tree.Insert("alice", []byte("alice_key"))
+	tree.Insert("bob", []byte("bob_key"))
+	tree.UpdateIntermediateKeys()
+	tree.Insert("charlie", []byte("charlie_key"))
+	tree.UpdateIntermediateKeys()
+
+	if got := tree.Head().KeyHistory(0); len(got) != 0 {
+		t.Errorf("expected no history without WithKeyHistory, got %d records", len(got))
+	}
+}
@@ -0,0 +1,60 @@
+package tree
+
+import "time"
+
+// ChangeEvent describes a mutation applied to the tree
+type ChangeEvent struct {
+	Op   string    // operation name, e.g. "insert", "delete", "set_key" or "apply_update_path"
+	Name string    // node the operation targeted
+	Time time.Time // when the operation completed
+}
+
+// Notifier receives an event after every successful mutation
+// Implementations can forward events to message buses such as NATS
+type Notifier interface {
+	Notify(event ChangeEvent)
+}
+
+// Tracer wraps tree operations in spans
+// Implementations can adapt OpenTelemetry or any other tracing system
+type Tracer interface {
+	// Start begins a span for op and returns a function ending it with the operation result
+	Start(op string, name string) (end func(err error))
+}
+
+// WithNotifier registers a Notifier for mutation events
+func WithNotifier(notifier Notifier) Option {
+	return func(t *Tree) {
+		t.notifier = notifier
+	}
+}
+
+// WithTracer registers a Tracer for tree operations
+func WithTracer(tracer Tracer) Option {
+	return func(t *Tree) {
+		t.tracer = tracer
+	}
+}
+
+// startOp starts tracing op and returns the function to call with its result
+// Successful operations also advance the tree version
+func (t *Tree) startOp(op string, name string) func(err error) {
+	var endSpan func(error)
+	if t.tracer != nil {
+		endSpan = t.tracer.Start(op, name)
+	}
+
+	return func(err error) {
+		if endSpan != nil {
+			endSpan(err)
+		}
+		if err != nil {
+			return
+		}
+		t.version++
+		t.recordRevision()
+		if t.notifier != nil {
+			t.notifier.Notify(ChangeEvent{Op: op, Name: name, Time: time.Now()})
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tree
+
+import (
+	"testing"
+)
+
+type recordingNotifier struct {
+	events []ChangeEvent
+}
+
+func (n *recordingNotifier) Notify(event ChangeEvent) {
+	n.events = append(n.events, event)
+}
+
+type recordingTracer struct {
+	spans  []string
+	failed int
+}
+
+func (r *recordingTracer) Start(op string, name string) func(error) {
+	r.spans = append(r.spans, op+":"+name)
+	return func(err error) {
+		if err != nil {
+			r.failed++
+		}
+	}
+}
+
+func TestNotifierAndTracerHooks(t *testing.T) {
+	notifier := &recordingNotifier{}
+	tracer := &recordingTracer{}
+	tree, _ := NewTreeWithStore(nil, WithNotifier(notifier), WithTracer(tracer))
+
+	tree.Insert("alice", []byte("alice_key"))
+	tree.Insert("bob", []byte("bob_key"))
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("root_key"))
+	tree.Delete("alice")
+	tree.Delete("nobody")
+
+	if len(tracer.spans) != 5 {
+		t.Errorf("expected 5 spans, got %v", tracer.spans)
+	}
+	if tracer.failed != 1 {
+		t.Errorf("expected 1 failed span, got %d", tracer.failed)
+	}
+
+	expected := []string{"insert", "insert", "set_key", "delete"}
+	if len(notifier.events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), notifier.events)
+	}
+	for i, op := range expected {
+		if notifier.events[i].Op != op {
+			t.Errorf("event %d: expected %s, got %s", i, op, notifier.events[i].Op)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every inconsistency found in imported node information
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements error
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("invalid tree (%d problems):\n  %s", len(v.Problems), strings.Join(v.Problems, "\n  "))
+}
+
+// ValidateNodeInfos checks that indices, references and node types are mutually consistent
+// All problems are collected instead of stopping at the first one
+func ValidateNodeInfos(nodes []NodeInfo) error {
+	var problems []string
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	byName := make(map[string]*NodeInfo, len(nodes))
+	byIndex := make(map[int]*NodeInfo, len(nodes))
+	leafIndices := make(map[int]string)
+	for i := range nodes {
+		node := &nodes[i]
+
+		if node.Name == "" {
+			addf("node at position %d has no name", i)
+		} else if reservedName(node.Name) {
+			addf("node name %s is reserved", node.Name)
+		} else if _, dup := byName[node.Name]; dup {
+			addf("duplicate node name %s", node.Name)
+		} else {
+			byName[node.Name] = node
+		}
+
+		if node.NodeIndex < 0 || node.NodeIndex >= len(nodes) {
+			addf("node %s has index %d outside [0, %d)", node.Name, node.NodeIndex, len(nodes))
+		} else if other, dup := byIndex[node.NodeIndex]; dup {
+			addf("nodes %s and %s share index %d", other.Name, node.Name, node.NodeIndex)
+		} else {
+			byIndex[node.NodeIndex] = node
+		}
+
+		switch node.NodeType {
+		case "leaf":
+			if node.LeftChild != "" || node.RightChild != "" {
+				addf("leaf %s has children", node.Name)
+			}
+			if node.LeafIndex < 0 {
+				addf("leaf %s has negative leaf index %d", node.Name, node.LeafIndex)
+			} else if other, dup := leafIndices[node.LeafIndex]; dup {
+				addf("leaves %s and %s share leaf index %d", other, node.Name, node.LeafIndex)
+			} else {
+				leafIndices[node.LeafIndex] = node.Name
+			}
+		case "intermediate":
+			if node.LeftChild == "" && node.RightChild == "" {
+				addf("intermediate node %s has no children", node.Name)
+			}
+		default:
+			addf("node %s has unknown type %q", node.Name, node.NodeType)
+		}
+	}
+
+	// Every child reference must resolve to a node claiming this parent, exactly once
+	parentOf := make(map[string]string)
+	for i := range nodes {
+		node := &nodes[i]
+		for _, childName := range []string{node.LeftChild, node.RightChild} {
+			if childName == "" {
+				continue
+			}
+			child, ok := byName[childName]
+			if !ok {
+				addf("node %s references missing child %s", node.Name, childName)
+				continue
+			}
+			if previous, dup := parentOf[childName]; dup {
+				addf("node %s has two parents: %s and %s", childName, previous, node.Name)
+				continue
+			}
+			parentOf[childName] = node.Name
+			if child.ParentIndex != node.NodeIndex {
+				addf("node %s claims parent index %d but is a child of %s (index %d)", childName, child.ParentIndex, node.Name, node.NodeIndex)
+			}
+		}
+	}
+
+	var roots []string
+	for i := range nodes {
+		if _, hasParent := parentOf[nodes[i].Name]; !hasParent {
+			roots = append(roots, nodes[i].Name)
+			if nodes[i].ParentIndex != -1 {
+				addf("root %s claims parent index %d", nodes[i].Name, nodes[i].ParentIndex)
+			}
+		}
+	}
+	sort.Strings(roots)
+	if len(nodes) > 0 && len(roots) != 1 {
+		addf("expected exactly one root, found %d: %v", len(roots), roots)
+	}
+
+	// Walking from the root must reach every node once, otherwise references form a cycle
+	if len(roots) == 1 {
+		visited := make(map[string]bool)
+		stack := []string{roots[0]}
+		for len(stack) > 0 {
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[name] {
+				addf("cycle detected at node %s", name)
+				continue
+			}
+			visited[name] = true
+			if node := byName[name]; node != nil {
+				for _, child := range []string{node.LeftChild, node.RightChild} {
+					if _, ok := byName[child]; ok {
+						stack = append(stack, child)
+					}
+				}
+			}
+		}
+		for name := range byName {
+			if !visited[name] {
+				addf("node %s is unreachable from the root", name)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ImportNodes validates node information and builds a tree persisted to store
+func ImportNodes(nodes []NodeInfo, store Store, opts ...Option) (*Tree, error) {
+	return importNodes(nodes, store, opts, nil)
+}
+
+// importNodes builds the tree; restore, when set, fills in state NodeInfo does not carry before each element is saved
+func importNodes(nodes []NodeInfo, store Store, opts []Option, restore func(*Tree, *Element)) (*Tree, error) {
+	if err := ValidateNodeInfos(nodes); err != nil {
+		return nil, err
+	}
+
+	t, err := NewTreeWithStore(store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return t, nil
+	}
+
+	elements := make(map[string]*Element, len(nodes))
+	now := time.Now()
+	for _, node := range nodes {
+		// Blank leaves hold no key to check
+		if node.NodeType == "leaf" && len(node.PublicKey) > 0 && t.ciphersuite != 0 {
+			key := PublicKey{Algorithm: node.KeyAlgorithm, Encoding: node.KeyEncoding, Data: node.PublicKey}
+			if key.Algorithm == KeyAlgorithmUnknown {
+				parsed, err := t.checkKey(node.PublicKey)
+				if err != nil {
+					return nil, fmt.Errorf("leaf %s: %w", node.Name, err)
+				}
+				key = parsed
+			} else if err := t.checkTypedKey(key); err != nil {
+				return nil, fmt.Errorf("leaf %s: %w", node.Name, err)
+			}
+			node.KeyAlgorithm, node.KeyEncoding = key.Algorithm, key.Encoding
+		}
+		leaf, err := leafNodeOf(node.LeafNode)
+		if err != nil {
+			return nil, fmt.Errorf("leaf %s: %w", node.Name, err)
+		}
+		if leaf != nil {
+			if err := leaf.Validate(t.ciphersuite); err != nil {
+				return nil, fmt.Errorf("leaf %s: %w", node.Name, err)
+			}
+			if node.NodeType != "leaf" || !bytes.Equal(leaf.EncryptionKey, node.PublicKey) {
+				return nil, fmt.Errorf("leaf node of %s does not match its public key", node.Name)
+			}
+		}
+		elements[node.Name] = &Element{
+			name:         node.Name,
+			publicKey:    node.PublicKey,
+			keyAlgorithm: node.KeyAlgorithm,
+			keyEncoding:  node.KeyEncoding,
+			leafNode:     leaf,
+			parentHash:   node.ParentHash,
+			unmerged:     node.Unmerged,
+			filePath:     t.generateFilePath(node.Name),
+			store:        t.store,
+			format:       t.format,
+			nodeType:     node.NodeType,
+			leafIndex:    node.LeafIndex,
+			nodeIndex:    node.NodeIndex,
+			lastModified: now,
+		}
+	}
+	for _, node := range nodes {
+		element := elements[node.Name]
+		if restore != nil {
+			restore(t, element)
+		}
+		element.leftChild = elements[node.LeftChild]
+		element.rightChild = elements[node.RightChild]
+		element.leftCount = countLeaves(element.leftChild)
+		element.rightCount = countLeaves(element.rightChild)
+		if node.ParentIndex == -1 {
+			t.head = element
+		}
+	}
+
+	// Save children before parents so stored references always resolve
+	var save func(*Element) error
+	save = func(element *Element) error {
+		if element == nil {
+			return nil
+		}
+		if err := save(element.leftChild); err != nil {
+			return err
+		}
+		if err := save(element.rightChild); err != nil {
+			return err
+		}
+		return element.saveToDisk()
+	}
+	if err := save(t.head); err != nil {
+		return nil, fmt.Errorf("failed to persist imported tree: %w", err)
+	}
+
+	t.reassignNodeIndices()
+	if err := t.syncManifestHead(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ImportJSON imports a tree from either a node list or the map returned by GetTreeStructure
+func ImportJSON(data []byte, store Store, opts ...Option) (*Tree, error) {
+	var nodes []NodeInfo
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		var structure map[string]*NodeInfo
+		if mapErr := json.Unmarshal(data, &structure); mapErr != nil {
+			return nil, fmt.Errorf("failed to unmarshal tree: %w", err)
+		}
+		for _, info := range structure {
+			if info != nil {
+				nodes = append(nodes, *info)
+			}
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].NodeIndex < nodes[j].NodeIndex
+		})
+	}
+	return ImportNodes(nodes, store, opts...)
+}
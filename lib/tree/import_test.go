@@ -0,0 +1,56 @@
+package tree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestImportJSONRoundTrip(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, []byte(name+"_key"))
+	}
+	source.Delete("user_2")
+
+	data, err := json.Marshal(source.GetTreeStructure())
+	if err != nil {
+		t.Fatalf("Failed to marshal structure: %v", err)
+	}
+
+	imported, err := ImportJSON(data, nil)
+	if err != nil {
+		t.Fatalf("Failed to import structure: %v", err)
+	}
+	if string(imported.StructureHash()) != string(source.StructureHash()) {
+		t.Errorf("imported tree differs from the source")
+	}
+}
+
+func TestValidateNodeInfosReportsAllProblems(t *testing.T) {
+	nodes := []NodeInfo{
+		{Name: "root", NodeType: "intermediate", NodeIndex: 0, ParentIndex: -1, LeftChild: "a", RightChild: "ghost"},
+		{Name: "a", NodeType: "intermediate", NodeIndex: 1, ParentIndex: 0, LeftChild: "b"},
+		{Name: "b", NodeType: "intermediate", NodeIndex: 2, ParentIndex: 5, LeftChild: "a"},
+		{Name: "c", NodeType: "leaf", NodeIndex: 2, LeafIndex: -1, ParentIndex: 0, LeftChild: "a"},
+		{Name: "d", NodeType: "branch", NodeIndex: 9, ParentIndex: 0},
+	}
+
+	err := ValidateNodeInfos(nodes)
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	for _, problem := range validation.Problems {
+		t.Log(problem)
+	}
+	if len(validation.Problems) < 8 {
+		t.Errorf("expected every problem to be reported, got %d", len(validation.Problems))
+	}
+
+	if _, err := ImportNodes(nodes, nil); err == nil {
+		t.Errorf("import of an invalid tree must fail")
+	}
+}
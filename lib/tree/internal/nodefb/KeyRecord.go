@@ -0,0 +1,149 @@
+// Code generated by the FlatBuffers compiler. DO NOT EDIT.
+
+package nodefb
+
+import (
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+type KeyRecord struct {
+	_tab flatbuffers.Table
+}
+
+func GetRootAsKeyRecord(buf []byte, offset flatbuffers.UOffsetT) *KeyRecord {
+	n := flatbuffers.GetUOffsetT(buf[offset:])
+	x := &KeyRecord{}
+	x.Init(buf, n+offset)
+	return x
+}
+
+func FinishKeyRecordBuffer(builder *flatbuffers.Builder, offset flatbuffers.UOffsetT) {
+	builder.Finish(offset)
+}
+
+func GetSizePrefixedRootAsKeyRecord(buf []byte, offset flatbuffers.UOffsetT) *KeyRecord {
+	n := flatbuffers.GetUOffsetT(buf[offset+flatbuffers.SizeUint32:])
+	x := &KeyRecord{}
+	x.Init(buf, n+offset+flatbuffers.SizeUint32)
+	return x
+}
+
+func FinishSizePrefixedKeyRecordBuffer(builder *flatbuffers.Builder, offset flatbuffers.UOffsetT) {
+	builder.FinishSizePrefixed(offset)
+}
+
+func (rcv *KeyRecord) Init(buf []byte, i flatbuffers.UOffsetT) {
+	rcv._tab.Bytes = buf
+	rcv._tab.Pos = i
+}
+
+func (rcv *KeyRecord) Table() flatbuffers.Table {
+	return rcv._tab
+}
+
+func (rcv *KeyRecord) Key(j int) byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(4))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.GetByte(a + flatbuffers.UOffsetT(j*1))
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) KeyLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(4))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) KeyBytes() []byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(4))
+	if o != 0 {
+		return rcv._tab.ByteVector(o + rcv._tab.Pos)
+	}
+	return nil
+}
+
+func (rcv *KeyRecord) MutateKey(j int, n byte) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(4))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.MutateByte(a+flatbuffers.UOffsetT(j*1), n)
+	}
+	return false
+}
+
+func (rcv *KeyRecord) Algorithm() byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(6))
+	if o != 0 {
+		return rcv._tab.GetByte(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) MutateAlgorithm(n byte) bool {
+	return rcv._tab.MutateByteSlot(6, n)
+}
+
+func (rcv *KeyRecord) Encoding() byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(8))
+	if o != 0 {
+		return rcv._tab.GetByte(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) MutateEncoding(n byte) bool {
+	return rcv._tab.MutateByteSlot(8, n)
+}
+
+func (rcv *KeyRecord) Epoch() uint64 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		return rcv._tab.GetUint64(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) MutateEpoch(n uint64) bool {
+	return rcv._tab.MutateUint64Slot(10, n)
+}
+
+func (rcv *KeyRecord) ReplacedAt() int64 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		return rcv._tab.GetInt64(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *KeyRecord) MutateReplacedAt(n int64) bool {
+	return rcv._tab.MutateInt64Slot(12, n)
+}
+
+func KeyRecordStart(builder *flatbuffers.Builder) {
+	builder.StartObject(5)
+}
+func KeyRecordAddKey(builder *flatbuffers.Builder, key flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(0, flatbuffers.UOffsetT(key), 0)
+}
+func KeyRecordStartKeyVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(1, numElems, 1)
+}
+func KeyRecordAddAlgorithm(builder *flatbuffers.Builder, algorithm byte) {
+	builder.PrependByteSlot(1, algorithm, 0)
+}
+func KeyRecordAddEncoding(builder *flatbuffers.Builder, encoding byte) {
+	builder.PrependByteSlot(2, encoding, 0)
+}
+func KeyRecordAddEpoch(builder *flatbuffers.Builder, epoch uint64) {
+	builder.PrependUint64Slot(3, epoch, 0)
+}
+func KeyRecordAddReplacedAt(builder *flatbuffers.Builder, replacedAt int64) {
+	builder.PrependInt64Slot(4, replacedAt, 0)
+}
+func KeyRecordEnd(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
+	return builder.EndObject()
+}
@@ -0,0 +1,77 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestImportMLSTestVectors(t *testing.T) {
+	source, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	for i := 0; i < 3; i++ {
+		source.Insert(fmt.Sprintf("member_%d", i), bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+	encoded, err := source.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+
+	file := fmt.Sprintf(`[
+		{"cipher_suite": 1, "tree": %q, "tree_hash": "00"},
+		{"cipher_suite": 1, "tree_before": "01", "proposal": "00"},
+		{"cipher_suite": 1, "tree_before": %q, "tree_after": %q},
+		{"cipher_suite": 1, "n_leaves": 4}
+	]`, hex.EncodeToString(encoded), hex.EncodeToString(encoded), hex.EncodeToString(encoded))
+	vectors, err := ParseMLSTestVectors([]byte(file))
+	if err != nil {
+		t.Fatalf("Failed to parse test vectors: %v", err)
+	}
+	if len(vectors) != 3 {
+		t.Fatalf("expected 3 vectors with a tree, got %d", len(vectors))
+	}
+
+	imported, err := vectors[0].Import(nil)
+	if err != nil {
+		t.Fatalf("Failed to import vector: %v", err)
+	}
+	if imported.Ciphersuite() != MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519 {
+		t.Errorf("imported tree should use the vector's cipher suite")
+	}
+	if !bytes.Equal(imported.StructureHash(), source.StructureHash()) {
+		t.Errorf("imported tree differs from the source")
+	}
+	if _, err := vectors[1].Import(nil); err == nil {
+		t.Errorf("expected an error for a malformed tree")
+	}
+
+	single, err := ParseMLSTestVectors([]byte(fmt.Sprintf(`{"cipher_suite": 1, "ratchet_tree": %q}`, hex.EncodeToString(encoded))))
+	if err != nil || len(single) != 1 {
+		t.Fatalf("Failed to parse a single vector: %v", err)
+	}
+}
+
+func TestImportRatchetTreeSanitizesIdentities(t *testing.T) {
+	nodes := []ratchetNode{
+		{present: true, leaf: true, identity: "leaf_1", key: []byte("k0")},
+		{},
+		{present: true, leaf: true, identity: "leaf_1", key: []byte("k1")},
+		{},
+		{present: true, leaf: true, identity: "__manifest__", key: []byte("k2")},
+		{},
+		{present: true, leaf: true, identity: "../escape", key: []byte("k3")},
+	}
+	imported, err := ImportRatchetTree(mustEncodeRatchetNodes(t, nodes), nil)
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+
+	var names []string
+	for _, leaf := range imported.GetLeaves() {
+		names = append(names, leaf.Name())
+	}
+	want := []string{"leaf_1", "leaf_1_1", "leaf_2", "leaf_3"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("expected leaves %v, got %v", want, names)
+	}
+}
@@ -0,0 +1,338 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// journalName is the storage name of the write-ahead intent log
+const journalName = "__journal__"
+
+// journalOp is one element write or removal recorded in the intent log
+type journalOp struct {
+	Key    string `json:"key"`
+	Data   []byte `json:"data,omitempty"`
+	Remove bool   `json:"remove,omitempty"`
+}
+
+// journalRecord is the persisted intent log; the checksum detects a torn journal write
+type journalRecord struct {
+	Ops      []journalOp `json:"ops"`
+	Checksum []byte      `json:"checksum"`
+}
+
+// journalStore groups the writes of one tree operation and applies them through an intent log
+// A crash before the journal is complete leaves the previous state untouched; a crash after
+// it is complete is rolled forward on the next open
+// The mutex lets reads from the caller overlap a batch that write-behind applies from its
+// worker, see beginBatch
+type journalStore struct {
+	inner    Store
+	mu       sync.Mutex
+	batching bool
+	ops      []journalOp
+	overlay  map[string]int // key -> index of newest op in ops
+}
+
+// WithAtomicWrites makes every Insert and Delete persist all-or-nothing
+// Any journal left behind by a crash is recovered when the tree is opened
+func WithAtomicWrites() Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store := &journalStore{inner: t.store}
+		if err := store.recover(); err != nil {
+			t.optionErr = err
+			return
+		}
+		t.store = store
+		t.journal = store
+	}
+}
+
+// checksum hashes the encoded operations
+func journalChecksum(ops []journalOp) ([]byte, error) {
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// recover replays a complete journal and discards a torn one
+func (s *journalStore) recover() error {
+	journalKey := s.inner.Key(journalName)
+	data, err := s.inner.Read(journalKey)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var record journalRecord
+	if err := json.Unmarshal(data, &record); err == nil {
+		if sum, err := journalChecksum(record.Ops); err == nil && bytes.Equal(sum, record.Checksum) {
+			if err := s.apply(record.Ops); err != nil {
+				return fmt.Errorf("failed to roll journal forward: %w", err)
+			}
+		}
+	}
+	return s.inner.Remove(journalKey)
+}
+
+// apply performs journaled operations against the wrapped store
+func (s *journalStore) apply(ops []journalOp) error {
+	for _, op := range ops {
+		var err error
+		if op.Remove {
+			err = s.inner.Remove(op.Key)
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = s.inner.Write(op.Key, op.Data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// begin starts buffering operations
+func (s *journalStore) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batching = true
+	s.ops = nil
+	s.overlay = make(map[string]int)
+}
+
+// commit writes the journal, applies the buffered operations and clears the journal
+// When the operation itself failed the buffered writes are discarded. Reads wait until the
+// writes are applied rather than fall through to the backend halfway
+func (s *journalStore) commit(opErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := s.ops
+	s.batching = false
+	s.ops = nil
+	s.overlay = nil
+
+	if opErr != nil || len(ops) == 0 {
+		return opErr
+	}
+
+	checksum, err := journalChecksum(ops)
+	if err != nil {
+		return fmt.Errorf("failed to checksum journal: %w", err)
+	}
+	data, err := json.Marshal(journalRecord{Ops: ops, Checksum: checksum})
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+
+	journalKey := s.inner.Key(journalName)
+	if err := s.inner.Write(journalKey, data); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := s.apply(ops); err != nil {
+		return fmt.Errorf("failed to apply journaled writes: %w", err)
+	}
+	if err := s.inner.Remove(journalKey); err != nil {
+		return fmt.Errorf("failed to clear journal: %w", err)
+	}
+	return nil
+}
+
+// Key delegates to the wrapped store
+func (s *journalStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write buffers the write while an operation is in progress
+func (s *journalStore) Write(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.batching {
+		return s.inner.Write(key, data)
+	}
+	s.overlay[key] = len(s.ops)
+	s.ops = append(s.ops, journalOp{Key: key, Data: append([]byte(nil), data...)})
+	return nil
+}
+
+// Read serves buffered writes first
+func (s *journalStore) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.batching {
+		if i, ok := s.overlay[key]; ok {
+			if s.ops[i].Remove {
+				return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+			}
+			return append([]byte(nil), s.ops[i].Data...), nil
+		}
+	}
+	return s.inner.Read(key)
+}
+
+// Remove buffers the removal while an operation is in progress
+func (s *journalStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.batching {
+		return s.inner.Remove(key)
+	}
+	s.overlay[key] = len(s.ops)
+	s.ops = append(s.ops, journalOp{Key: key, Remove: true})
+	return nil
+}
+
+// batchLayer is a store layer that groups the writes of one operation
+type batchLayer struct {
+	begin  func()
+	commit func(err error) error
+}
+
+// batchLayers returns the grouping layers owned by the caller, or with debounced by the
+// debounce flush, from the backend outwards, split into those write-behind wraps and
+// those written directly
+// Debounced writes reach the layers below only when they flush, so such a layer must be
+// grouped around the flush rather than the operation; write-behind applies writes from
+// its worker, so the layers below it are opened and committed by that worker, in order
+// with the writes
+func (t *Tree) batchLayers(debounced bool) (queued, direct []batchLayer) {
+	add := func(layer batchLayer, belowWriteBehind, belowDebounce bool) {
+		if belowDebounce != debounced {
+			return
+		}
+		if debounced && !t.debounce.wrapsWriteBehind {
+			belowWriteBehind = false
+		}
+		if belowWriteBehind {
+			queued = append(queued, layer)
+		} else {
+			direct = append(direct, layer)
+		}
+	}
+	if t.batch != nil {
+		add(batchLayer{begin: t.batch.Begin, commit: t.batch.Commit},
+			t.writeBehind != nil, t.debounce != nil)
+	}
+	if t.journal != nil {
+		add(batchLayer{begin: t.journal.begin, commit: t.journal.commit},
+			t.writeBehind != nil && t.writeBehind.wrapsJournal, t.debounce != nil && t.debounce.wrapsJournal)
+	}
+	return queued, direct
+}
+
+// openLayers begins a batch in every layer, the backend first
+func openLayers(layers []batchLayer) {
+	for _, layer := range layers {
+		layer.begin()
+	}
+}
+
+// commitLayers commits every layer, the outermost first since it applies its writes to
+// the layers below
+func commitLayers(layers []batchLayer, err error) error {
+	for i := len(layers) - 1; i >= 0; i-- {
+		err = layers[i].commit(err)
+	}
+	return err
+}
+
+// beginBatch groups store writes into one batch when atomic writes are enabled or the
+// backend batches, see beginAtomic
+func (t *Tree) beginBatch() func(err error) error {
+	return t.groupWrites(t.batchLayers(false))
+}
+
+// groupWrites opens a batch in the given layers and returns its commit
+// Below write-behind the batch is queued: its commit fails asynchronously and surfaces
+// like any other background write error
+func (t *Tree) groupWrites(queued, direct []batchLayer) func(err error) error {
+	finish := func(err error) error { return err }
+	if len(queued) > 0 {
+		beginErr := t.writeBehind.step(func() error {
+			openLayers(queued)
+			return nil
+		})
+		finish = func(err error) error {
+			if err == nil {
+				err = beginErr
+			}
+			opErr := err
+			commitErr := t.writeBehind.step(func() error { return commitLayers(queued, opErr) })
+			if err != nil {
+				return err
+			}
+			return commitErr
+		}
+	}
+	openLayers(direct)
+	backend := finish
+	return func(err error) error { return backend(commitLayers(direct, err)) }
+}
+
+// beginAtomic starts grouping store writes when atomic writes are enabled or the backend batches
+// The returned function must be called with the operation result and returns the final error
+func (t *Tree) beginAtomic() func(err error) error {
+	finish := t.beginBatch()
+	if t.deferred != nil {
+		// Deferred writes of a failed operation never reach the backend
+		saved := t.deferred.savepoint()
+		batch := finish
+		finish = func(err error) error {
+			if err != nil {
+				t.deferred.rollback(saved)
+			}
+			return batch(err)
+		}
+	}
+	return func(err error) error {
+		if err != nil {
+			return finish(err)
+		}
+		if err := finish(nil); err != nil {
+			return t.restore(err)
+		}
+		return nil
+	}
+}
+
+// restore reloads the tree after its writes failed to commit, so the in-memory state
+// matches the store again rather than keep the change the store rejected
+// It applies only while every write reaches the grouping layers synchronously; a journal
+// that was complete before the failure is rolled forward first
+func (t *Tree) restore(commitErr error) error {
+	if t.journal == nil && t.batch == nil {
+		return commitErr
+	}
+	if t.writeBehind != nil || t.deferred != nil || t.debounce != nil {
+		return commitErr
+	}
+	if t.journal != nil {
+		if err := t.journal.recover(); err != nil {
+			return errors.Join(commitErr, err)
+		}
+	}
+	if err := t.Reload(); err != nil {
+		return errors.Join(commitErr, fmt.Errorf("failed to restore tree: %w", err))
+	}
+	return commitErr
+}
@@ -0,0 +1,127 @@
+package tree
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// crashingStore fails every write after the first limit writes, like a process dying mid-operation
+type crashingStore struct {
+	Store
+	limit  int
+	writes int
+}
+
+func (s *crashingStore) Write(key string, data []byte) error {
+	s.writes++
+	if s.limit > 0 && s.writes > s.limit {
+		return fmt.Errorf("simulated crash")
+	}
+	return s.Store.Write(key, data)
+}
+
+func TestAtomicWritesRollForwardAfterCrash(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "journal_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files, _ := NewFileStore(tempDir)
+	tree, err := LoadTreeFromStore(files, "", WithAtomicWrites())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	// Crash right after the journal is written, before the element files are
+	crashing := &crashingStore{Store: files, limit: 1}
+	crashed, err := LoadTreeFromStore(crashing, "", WithAtomicWrites())
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+	crashing.writes = 0
+	if err := crashed.Insert("david", []byte("david_key")); err == nil {
+		t.Fatalf("expected simulated crash")
+	}
+
+	if _, err := os.Stat(files.Key(journalName)); err != nil {
+		t.Fatalf("journal should survive the crash: %v", err)
+	}
+
+	recovered, err := LoadTreeFromStore(files, "", WithAtomicWrites())
+	if err != nil {
+		t.Fatalf("Failed to recover tree: %v", err)
+	}
+	if got := len(recovered.GetLeaves()); got != 4 {
+		t.Errorf("expected journaled insert to be rolled forward, got %d leaves", got)
+	}
+	if _, err := os.Stat(files.Key(journalName)); !os.IsNotExist(err) {
+		t.Errorf("journal should be cleared after recovery")
+	}
+}
+
+func TestAtomicWritesDiscardTornJournal(t *testing.T) {
+	tempDir := t.TempDir()
+	files, _ := NewFileStore(tempDir)
+
+	tree, _ := LoadTreeFromStore(files, "", WithAtomicWrites())
+	tree.Insert("alice", []byte("alice_key"))
+	tree.Insert("bob", []byte("bob_key"))
+
+	// A journal cut off mid-write must not be applied
+	os.WriteFile(files.Key(journalName), []byte(`{"ops":[{"key":"`), 0644)
+
+	recovered, err := LoadTreeFromStore(files, "", WithAtomicWrites())
+	if err != nil {
+		t.Fatalf("Failed to recover tree: %v", err)
+	}
+	if got := len(recovered.GetLeaves()); got != 2 {
+		t.Errorf("expected previous state to be kept, got %d leaves", got)
+	}
+}
+
+func TestAtomicWritesRestoreTreeOnFailedCommit(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	failing := &failingStore{Store: files, fail: map[string]bool{}}
+	tree, err := LoadTreeFromStore(failing, "", WithAtomicWrites())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	before := tree.Snapshot().GetTreeStructure()
+
+	failing.fail[files.Key(journalName)] = true
+	if err := tree.Insert("david", []byte("david_key")); err == nil {
+		t.Fatalf("expected the journal write to fail")
+	}
+	if _, found := tree.Find("david"); found {
+		t.Errorf("failed insert should not stay in the tree")
+	}
+	after := tree.Snapshot().GetTreeStructure()
+	if len(after) != len(before) {
+		t.Fatalf("expected %d nodes after the failed commit, got %d", len(before), len(after))
+	}
+	for name, info := range before {
+		if got, ok := after[name]; !ok || got.NodeIndex != info.NodeIndex || string(got.PublicKey) != string(info.PublicKey) {
+			t.Errorf("node %s changed by the failed commit", name)
+		}
+	}
+
+	delete(failing.fail, files.Key(journalName))
+	if err := tree.Insert("david", []byte("david_key")); err != nil {
+		t.Fatalf("Failed to insert after recovery: %v", err)
+	}
+	if got := len(tree.GetLeaves()); got != 4 {
+		t.Errorf("expected 4 leaves, got %d", got)
+	}
+}
@@ -0,0 +1,47 @@
+package tree
+
+import (
+	"fmt"
+	"time"
+)
+
+// KeyPackage is the view of an MLS KeyPackage the tree needs to admit a member
+// lib/keypackage implements it, so the tree never parses or verifies KeyPackages itself
+type KeyPackage interface {
+	// Validate checks versions, keys, lifetime and signatures against the group ciphersuite
+	Validate(cs Ciphersuite, now time.Time) error
+	// Identity is the credential identity, used as the leaf name
+	Identity() string
+	// EncryptionKey is the HPKE key published in the leaf node
+	EncryptionKey() PublicKey
+	// Leaf is the signed leaf node the member will occupy
+	Leaf() *LeafNode
+}
+
+// InsertFromKeyPackage validates kp and inserts its leaf node under the credential identity,
+// as mapped by the tree's AuthService when it has one
+// A tree without a ciphersuite accepts the KeyPackage's own ciphersuite
+func (t *Tree) InsertFromKeyPackage(kp KeyPackage) error {
+	name, err := t.memberIdentity(kp)
+	if err != nil {
+		return fmt.Errorf("rejected key package for %s: %w", kp.Identity(), err)
+	}
+	if name == "" {
+		return fmt.Errorf("key package has an empty identity")
+	}
+	if err := kp.Validate(t.ciphersuite, time.Now()); err != nil {
+		return fmt.Errorf("rejected key package for %s: %w", name, err)
+	}
+	key := kp.EncryptionKey()
+	if err := t.checkTypedKey(key); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	leaf := kp.Leaf()
+	if leaf.Source != LeafNodeSourceKeyPackage {
+		return fmt.Errorf("failed to insert %s: leaf node source %d in a key package", name, leaf.Source)
+	}
+	if err := t.admitLeaf(name, leaf, 0); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	return t.insert(name, key, leaf)
+}
@@ -0,0 +1,316 @@
+package tree
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// KeyAlgorithm identifies the algorithm a public key belongs to
+type KeyAlgorithm uint8
+
+const (
+	KeyAlgorithmUnknown KeyAlgorithm = iota // opaque bytes, never validated
+	KeyAlgorithmX25519
+	KeyAlgorithmEd25519
+	KeyAlgorithmP256
+)
+
+var keyAlgorithmNames = map[KeyAlgorithm]string{
+	KeyAlgorithmUnknown: "unknown",
+	KeyAlgorithmX25519:  "x25519",
+	KeyAlgorithmEd25519: "ed25519",
+	KeyAlgorithmP256:    "p256",
+}
+
+// String returns the algorithm name
+func (a KeyAlgorithm) String() string {
+	if name, ok := keyAlgorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("algorithm(%d)", uint8(a))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (a KeyAlgorithm) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (a *KeyAlgorithm) UnmarshalText(text []byte) error {
+	for alg, name := range keyAlgorithmNames {
+		if name == string(text) {
+			*a = alg
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key algorithm %q", text)
+}
+
+// KeyEncoding identifies how the key bytes are encoded
+type KeyEncoding uint8
+
+const (
+	KeyEncodingOpaque KeyEncoding = iota // stored as given
+	KeyEncodingRaw                       // raw point or key bytes
+	KeyEncodingSPKI                      // DER SubjectPublicKeyInfo
+)
+
+var keyEncodingNames = map[KeyEncoding]string{
+	KeyEncodingOpaque: "opaque",
+	KeyEncodingRaw:    "raw",
+	KeyEncodingSPKI:   "spki",
+}
+
+// String returns the encoding name
+func (e KeyEncoding) String() string {
+	if name, ok := keyEncodingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("encoding(%d)", uint8(e))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (e KeyEncoding) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (e *KeyEncoding) UnmarshalText(text []byte) error {
+	for enc, name := range keyEncodingNames {
+		if name == string(text) {
+			*e = enc
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key encoding %q", text)
+}
+
+// PublicKey is a public key tagged with its algorithm and encoding
+type PublicKey struct {
+	Algorithm KeyAlgorithm
+	Encoding  KeyEncoding
+	Data      []byte
+}
+
+// MarshalBinary encodes the key as algorithm, encoding and key bytes
+func (k PublicKey) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, 2+len(k.Data))
+	out = append(out, byte(k.Algorithm), byte(k.Encoding))
+	return append(out, k.Data...), nil
+}
+
+// UnmarshalBinary decodes a key written by MarshalBinary and validates it
+func (k *PublicKey) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("tagged public key too short")
+	}
+	key := PublicKey{Algorithm: KeyAlgorithm(data[0]), Encoding: KeyEncoding(data[1]), Data: append([]byte(nil), data[2:]...)}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+// Validate checks that the key bytes match the tagged algorithm and encoding
+func (k PublicKey) Validate() error {
+	if k.Algorithm == KeyAlgorithmUnknown {
+		return nil
+	}
+	parsed, err := ParsePublicKey(k.Algorithm, k.Data)
+	if err != nil {
+		return err
+	}
+	if parsed.Encoding != k.Encoding {
+		return fmt.Errorf("%s key tagged as %s is %s encoded", k.Algorithm, k.Encoding, parsed.Encoding)
+	}
+	return nil
+}
+
+// KeyCodec recognises and validates the encodings accepted for one algorithm
+type KeyCodec interface {
+	// Parse validates data and reports its encoding
+	Parse(data []byte) (KeyEncoding, error)
+}
+
+// KeyCodecFunc adapts a function to KeyCodec
+type KeyCodecFunc func(data []byte) (KeyEncoding, error)
+
+// Parse implements KeyCodec
+func (f KeyCodecFunc) Parse(data []byte) (KeyEncoding, error) {
+	return f(data)
+}
+
+var keyCodecs = map[KeyAlgorithm]KeyCodec{
+	KeyAlgorithmX25519:  KeyCodecFunc(parseX25519),
+	KeyAlgorithmEd25519: KeyCodecFunc(parseEd25519),
+	KeyAlgorithmP256:    KeyCodecFunc(parseP256),
+}
+
+// RegisterKeyCodec installs or replaces the codec for an algorithm
+// It is meant to be called from init functions
+func RegisterKeyCodec(alg KeyAlgorithm, codec KeyCodec) {
+	keyCodecs[alg] = codec
+}
+
+// ErrKeyAlgorithmMismatch is returned when a key does not match the group ciphersuite
+var ErrKeyAlgorithmMismatch = errors.New("public key algorithm does not match ciphersuite")
+
+// ParsePublicKey validates data as a key of the given algorithm and tags its encoding
+func ParsePublicKey(alg KeyAlgorithm, data []byte) (PublicKey, error) {
+	codec, ok := keyCodecs[alg]
+	if !ok {
+		return PublicKey{}, fmt.Errorf("no codec registered for %s keys", alg)
+	}
+	enc, err := codec.Parse(data)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("invalid %s public key: %w", alg, err)
+	}
+	return PublicKey{Algorithm: alg, Encoding: enc, Data: data}, nil
+}
+
+// parseSPKI decodes a SubjectPublicKeyInfo and reports the algorithm it holds
+func parseSPKI(data []byte) (KeyAlgorithm, error) {
+	pub, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return KeyAlgorithmUnknown, err
+	}
+	switch pub := pub.(type) {
+	case *ecdh.PublicKey:
+		if pub.Curve() == ecdh.X25519() {
+			return KeyAlgorithmX25519, nil
+		}
+	case ed25519.PublicKey:
+		return KeyAlgorithmEd25519, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve == elliptic.P256() {
+			return KeyAlgorithmP256, nil
+		}
+	}
+	return KeyAlgorithmUnknown, fmt.Errorf("unsupported SPKI key type %T", pub)
+}
+
+// parseRawOrSPKI accepts rawSize raw bytes checked by raw, or an SPKI holding an alg key
+func parseRawOrSPKI(alg KeyAlgorithm, data []byte, rawSize int, raw func([]byte) error) (KeyEncoding, error) {
+	if len(data) == rawSize {
+		if err := raw(data); err != nil {
+			return KeyEncodingOpaque, err
+		}
+		return KeyEncodingRaw, nil
+	}
+	got, err := parseSPKI(data)
+	if err != nil {
+		return KeyEncodingOpaque, fmt.Errorf("neither %d raw bytes nor SPKI: %w", rawSize, err)
+	}
+	if got != alg {
+		return KeyEncodingOpaque, fmt.Errorf("SPKI holds a %s key: %w", got, ErrKeyAlgorithmMismatch)
+	}
+	return KeyEncodingSPKI, nil
+}
+
+func parseX25519(data []byte) (KeyEncoding, error) {
+	return parseRawOrSPKI(KeyAlgorithmX25519, data, 32, func(b []byte) error {
+		_, err := ecdh.X25519().NewPublicKey(b)
+		return err
+	})
+}
+
+func parseEd25519(data []byte) (KeyEncoding, error) {
+	return parseRawOrSPKI(KeyAlgorithmEd25519, data, ed25519.PublicKeySize, func([]byte) error { return nil })
+}
+
+func parseP256(data []byte) (KeyEncoding, error) {
+	return parseRawOrSPKI(KeyAlgorithmP256, data, 65, func(b []byte) error {
+		_, err := ecdh.P256().NewPublicKey(b)
+		return err
+	})
+}
+
+// Ciphersuite is an MLS ciphersuite identifier (RFC 9420 section 17.1)
+type Ciphersuite uint16
+
+const (
+	MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519        Ciphersuite = 0x0001
+	MLS_128_DHKEMP256_AES128GCM_SHA256_P256             Ciphersuite = 0x0002
+	MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519 Ciphersuite = 0x0003
+)
+
+// KeyAlgorithm returns the HPKE KEM algorithm used for tree node keys
+func (c Ciphersuite) KeyAlgorithm() KeyAlgorithm {
+	switch c {
+	case MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519:
+		return KeyAlgorithmX25519
+	case MLS_128_DHKEMP256_AES128GCM_SHA256_P256:
+		return KeyAlgorithmP256
+	}
+	return KeyAlgorithmUnknown
+}
+
+// SignatureAlgorithm returns the algorithm used for credential signature keys
+func (c Ciphersuite) SignatureAlgorithm() KeyAlgorithm {
+	switch c {
+	case MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519:
+		return KeyAlgorithmEd25519
+	case MLS_128_DHKEMP256_AES128GCM_SHA256_P256:
+		return KeyAlgorithmP256
+	}
+	return KeyAlgorithmUnknown
+}
+
+// WithCiphersuite validates every node key written through Insert and
+// SetIntermediateNodeKey against the ciphersuite's KEM algorithm
+// The ciphersuite is recorded in the manifest and restored by LoadTree
+func WithCiphersuite(cs Ciphersuite) Option {
+	return func(t *Tree) {
+		if cs.KeyAlgorithm() == KeyAlgorithmUnknown {
+			t.optionErr = fmt.Errorf("unsupported ciphersuite 0x%04x", uint16(cs))
+			return
+		}
+		t.ciphersuite = cs
+	}
+}
+
+// Ciphersuite returns the group ciphersuite, zero when keys are not validated
+func (t *Tree) Ciphersuite() Ciphersuite {
+	return t.ciphersuite
+}
+
+// checkKey validates a node key against the group ciphersuite
+// Without a ciphersuite keys stay opaque
+func (t *Tree) checkKey(value []byte) (PublicKey, error) {
+	alg := t.ciphersuite.KeyAlgorithm()
+	if alg == KeyAlgorithmUnknown {
+		return PublicKey{Data: value}, nil
+	}
+	return ParsePublicKey(alg, value)
+}
+
+// checkTypedKey validates an already tagged key against the group ciphersuite
+func (t *Tree) checkTypedKey(key PublicKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	if want := t.ciphersuite.KeyAlgorithm(); want != KeyAlgorithmUnknown && key.Algorithm != want {
+		return fmt.Errorf("%s key in a %s group: %w", key.Algorithm, want, ErrKeyAlgorithmMismatch)
+	}
+	return nil
+}
+
+// InsertKey inserts a leaf whose public key carries an explicit algorithm tag
+func (t *Tree) InsertKey(name string, key PublicKey) error {
+	if err := t.checkTypedKey(key); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	return t.insert(name, key, nil)
+}
+
+// PublicKey returns the element's key with its algorithm and encoding tags
+func (e *Element) PublicKey() PublicKey {
+	e.unshelve()
+	return PublicKey{Algorithm: e.keyAlgorithm, Encoding: e.keyEncoding, Data: e.publicKey}
+}
@@ -0,0 +1,91 @@
+package tree
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func TestCiphersuiteRejectsWrongKeyTypes(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tree, err := LoadTreeFromStore(files, "", WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	x, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if err := tree.Insert("alice", x.PublicKey().Bytes()); err != nil {
+		t.Fatalf("Failed to insert X25519 key: %v", err)
+	}
+	spki, _ := x509.MarshalPKIXPublicKey(x.PublicKey())
+	if err := tree.Insert("bob", spki); err != nil {
+		t.Fatalf("Failed to insert X25519 SPKI key: %v", err)
+	}
+
+	p, _ := ecdh.P256().GenerateKey(rand.Reader)
+	if err := tree.Insert("charlie", p.PublicKey().Bytes()); err == nil {
+		t.Errorf("P-256 key should be rejected in an X25519 group")
+	}
+
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	edSPKI, _ := x509.MarshalPKIXPublicKey(edPub)
+	if err := tree.Insert("david", edSPKI); !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("expected ErrKeyAlgorithmMismatch for Ed25519 SPKI, got %v", err)
+	}
+	// Raw Ed25519 and X25519 keys are both 32 bytes, only an explicit tag tells them apart
+	if err := tree.InsertKey("eve", PublicKey{Algorithm: KeyAlgorithmEd25519, Encoding: KeyEncodingRaw, Data: edPub}); !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("expected ErrKeyAlgorithmMismatch for tagged Ed25519 key, got %v", err)
+	}
+
+	if got := len(tree.GetLeaves()); got != 2 {
+		t.Fatalf("rejected keys must not be inserted, got %d leaves", got)
+	}
+
+	bob, _ := tree.Find("bob")
+	if key := bob.PublicKey(); key.Algorithm != KeyAlgorithmX25519 || key.Encoding != KeyEncodingSPKI {
+		t.Errorf("expected x25519/spki tag, got %s/%s", key.Algorithm, key.Encoding)
+	}
+
+	// Tags and the ciphersuite survive a reload
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if loaded.Ciphersuite() != MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519 {
+		t.Errorf("ciphersuite not restored, got 0x%04x", uint16(loaded.Ciphersuite()))
+	}
+	if alice, _ := loaded.Find("alice"); alice.PublicKey().Encoding != KeyEncodingRaw {
+		t.Errorf("key encoding not restored")
+	}
+	if err := loaded.Insert("frank", p.PublicKey().Bytes()); err == nil {
+		t.Errorf("reloaded tree should keep validating keys")
+	}
+	if _, err := LoadTreeFromStore(files, "", WithCiphersuite(MLS_128_DHKEMP256_AES128GCM_SHA256_P256)); err == nil {
+		t.Errorf("opening with a different ciphersuite should fail")
+	}
+}
+
+func TestTaggedPublicKeyRoundTrip(t *testing.T) {
+	p, _ := ecdh.P256().GenerateKey(rand.Reader)
+	key, err := ParsePublicKey(KeyAlgorithmP256, p.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse P-256 key: %v", err)
+	}
+
+	data, _ := key.MarshalBinary()
+	var decoded PublicKey
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to decode tagged key: %v", err)
+	}
+	if decoded.Algorithm != KeyAlgorithmP256 || decoded.Encoding != KeyEncodingRaw || string(decoded.Data) != string(key.Data) {
+		t.Errorf("round trip mismatch: %+v", decoded)
+	}
+
+	data[1] = byte(KeyEncodingSPKI)
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Errorf("wrong encoding tag should be rejected")
+	}
+}
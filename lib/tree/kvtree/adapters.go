@@ -0,0 +1,156 @@
+package kvtree
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MapKV is a KV kept in a map, safe for concurrent use
+type MapKV struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+var _ KV = (*MapKV)(nil)
+
+// NewMapKV returns an empty map-backed KV
+func NewMapKV() *MapKV {
+	return &MapKV{data: make(map[string][]byte)}
+}
+
+// Get returns a copy of the value
+func (m *MapKV) Get(key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), value...), true, nil
+}
+
+// Set stores a copy of value
+func (m *MapKV) Set(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes key
+func (m *MapKV) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// Scan visits matching keys in sorted order
+func (m *MapKV) Scan(prefix string, fn func(key string, value []byte) error) error {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.data))
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, found, _ := m.Get(key)
+		if !found {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileKV is a KV writing one file per key into a directory
+// Keys are path-escaped, so they may contain slashes
+type FileKV struct {
+	dir string
+}
+
+var _ KV = (*FileKV)(nil)
+
+// NewFileKV creates dir if needed and returns a KV stored in it
+func NewFileKV(dir string) (*FileKV, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return &FileKV{dir: dir}, nil
+}
+
+// path returns the file holding key
+func (f *FileKV) path(key string) string {
+	return filepath.Join(f.dir, url.PathEscape(key))
+}
+
+// Get reads the file of key
+func (f *FileKV) Get(key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set writes the file of key through a temporary file
+func (f *FileKV) Set(key string, value []byte) error {
+	path := f.path(key)
+	if err := os.WriteFile(path+".tmp", value, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Delete removes the file of key; deleting a missing key is not an error
+func (f *FileKV) Delete(key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Scan visits matching keys in sorted order
+func (f *FileKV) Scan(prefix string, fn func(key string, value []byte) error) error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		key, err := url.PathUnescape(entry.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		value, found, err := f.Get(key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
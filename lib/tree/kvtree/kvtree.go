@@ -0,0 +1,117 @@
+// Package kvtree stores TreeKEM trees in any key-value store offering Get, Set, Delete and Scan
+//
+// A new backend only needs to implement KV; MapKV and FileKV are ready-made adapters
+// for an in-process map and a directory with one file per key.
+package kvtree
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// KV is the minimal key-value interface a backend has to provide
+type KV interface {
+	// Get returns found=false when the key does not exist
+	Get(key string) (value []byte, found bool, err error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	// Scan calls fn for every key starting with prefix, stopping at the first error
+	Scan(prefix string, fn func(key string, value []byte) error) error
+}
+
+// Store keeps the elements of one tree below a key prefix
+type Store struct {
+	kv     KV
+	prefix string
+}
+
+var _ tree.Store = (*Store)(nil)
+
+// NewStore creates a store writing keys below prefix, e.g. "groups/<id>/"
+func NewStore(kv KV, prefix string) *Store {
+	return &Store{kv: kv, prefix: prefix}
+}
+
+// NewTree returns an empty tree stored below prefix
+func NewTree(kv KV, prefix string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store := NewStore(kv, prefix)
+	t, err := tree.NewTreeWithStore(store, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// OpenTree loads the tree stored below prefix using the root recorded in its manifest
+func OpenTree(kv KV, prefix string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store := NewStore(kv, prefix)
+	t, err := tree.LoadTreeFromStore(store, "", opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Key maps an element name to its key
+func (s *Store) Key(name string) string {
+	return s.prefix + name
+}
+
+// Write stores an element
+func (s *Store) Write(key string, data []byte) error {
+	if err := s.kv.Set(key, data); err != nil {
+		return fmt.Errorf("failed to store element %s: %w", key, err)
+	}
+	return nil
+}
+
+// Read returns an element
+func (s *Store) Read(key string) ([]byte, error) {
+	data, found, err := s.kv.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read element %s: %w", key, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+// Remove deletes an element
+func (s *Store) Remove(key string) error {
+	if err := s.kv.Delete(key); err != nil {
+		return fmt.Errorf("failed to delete element %s: %w", key, err)
+	}
+	return nil
+}
+
+// Prune deletes stored elements that t no longer references, such as leftovers of a crash
+// Internal records like the manifest are kept; it returns the number of keys removed
+func (s *Store) Prune(t *tree.Tree) (int, error) {
+	live := make(map[string]bool)
+	for _, element := range t.GetAllElements() {
+		live[s.Key(element.Name())] = true
+	}
+
+	var orphans []string
+	err := s.kv.Scan(s.prefix, func(key string, _ []byte) error {
+		name := strings.TrimPrefix(key, s.prefix)
+		if !live[key] && !strings.HasPrefix(name, "__") {
+			orphans = append(orphans, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan elements: %w", err)
+	}
+
+	for i, key := range orphans {
+		if err := s.kv.Delete(key); err != nil {
+			return i, fmt.Errorf("failed to delete orphan %s: %w", key, err)
+		}
+	}
+	return len(orphans), nil
+}
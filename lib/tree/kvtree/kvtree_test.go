@@ -0,0 +1,51 @@
+package kvtree
+
+import (
+	"testing"
+)
+
+func TestKVTreeAdapters(t *testing.T) {
+	fileKV, err := NewFileKV(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file KV: %v", err)
+	}
+
+	for name, kv := range map[string]KV{"map": NewMapKV(), "file": fileKV} {
+		t.Run(name, func(t *testing.T) {
+			tr, _, _ := NewTree(kv, "groups/g1/")
+			for _, user := range []string{"alice", "bob", "charlie", "david"} {
+				if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+					t.Fatalf("Failed to insert %s: %v", user, err)
+				}
+			}
+			if err := tr.Delete("bob"); err != nil {
+				t.Fatalf("Failed to delete bob: %v", err)
+			}
+
+			loaded, store, err := OpenTree(kv, "groups/g1/")
+			if err != nil {
+				t.Fatalf("Failed to open tree: %v", err)
+			}
+			if string(loaded.StructureHash()) != string(tr.StructureHash()) {
+				t.Errorf("reopened tree differs from the original")
+			}
+
+			// A stray element left by a crash is removed, the manifest is kept
+			kv.Set("groups/g1/orphan", []byte("{}"))
+			kv.Set("groups/g2/alice", []byte("{}"))
+			removed, err := store.Prune(loaded)
+			if err != nil {
+				t.Fatalf("Prune failed: %v", err)
+			}
+			if removed != 1 {
+				t.Errorf("expected 1 orphan removed, got %d", removed)
+			}
+			if _, found, _ := kv.Get("groups/g2/alice"); !found {
+				t.Errorf("Prune must not touch other prefixes")
+			}
+			if _, _, err := OpenTree(kv, "groups/g1/"); err != nil {
+				t.Errorf("tree should still open after pruning: %v", err)
+			}
+		})
+	}
+}
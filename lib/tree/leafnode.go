@@ -0,0 +1,476 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// ProtocolVersionMLS10 is the mls10 protocol version
+const ProtocolVersionMLS10 uint16 = 1
+
+// CredentialType identifies the credential format (RFC 9420 section 5.3)
+type CredentialType uint16
+
+const (
+	CredentialBasic CredentialType = 1
+	CredentialX509  CredentialType = 2
+)
+
+// Credential binds a member identity to its signature key
+// Basic credentials carry Identity, X.509 credentials a certificate chain, leaf first
+type Credential struct {
+	Type         CredentialType
+	Identity     []byte
+	Certificates [][]byte
+}
+
+// Capabilities lists what a member supports, advertised in its leaf node
+type Capabilities struct {
+	Versions     []uint16
+	CipherSuites []uint16
+	Extensions   []uint16
+	Proposals    []uint16
+	Credentials  []uint16
+}
+
+// LeafNodeSource records why a leaf node was created
+type LeafNodeSource uint8
+
+const (
+	LeafNodeSourceKeyPackage LeafNodeSource = 1
+	LeafNodeSourceUpdate     LeafNodeSource = 2
+	LeafNodeSourceCommit     LeafNodeSource = 3
+)
+
+// Lifetime bounds the validity of a KeyPackage leaf in Unix seconds
+type Lifetime struct {
+	NotBefore uint64
+	NotAfter  uint64
+}
+
+// Contains reports whether now falls within the lifetime
+func (l Lifetime) Contains(now time.Time) bool {
+	sec := now.Unix()
+	return sec >= 0 && uint64(sec) >= l.NotBefore && uint64(sec) <= l.NotAfter
+}
+
+// Extension is an opaque typed extension
+type Extension struct {
+	Type uint16
+	Data []byte
+}
+
+// LeafNode is a member's entry in the ratchet tree (RFC 9420 section 7.2)
+// Elements created from one keep it alongside the node, and the element's public key
+// is always the leaf node's encryption key
+type LeafNode struct {
+	EncryptionKey []byte
+	SignatureKey  []byte
+	Credential    Credential
+	Capabilities  Capabilities
+	Source        LeafNodeSource
+	Lifetime      Lifetime // set for LeafNodeSourceKeyPackage
+	ParentHash    []byte   // set for LeafNodeSourceCommit
+	Extensions    []Extension
+	Signature     []byte
+}
+
+// MarshalBinary encodes the leaf node in its RFC 9420 wire format
+func (n *LeafNode) MarshalBinary() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := n.encode(w); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalBinary decodes a leaf node written by MarshalBinary
+func (n *LeafNode) UnmarshalBinary(data []byte) error {
+	leaf, rest, err := ReadLeafNode(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%d trailing bytes after leaf node", len(rest))
+	}
+	*n = *leaf
+	return nil
+}
+
+// ReadLeafNode decodes the leaf node at the start of data and returns the bytes after it
+// Structures embedding a LeafNode, such as KeyPackages, decode it this way
+func ReadLeafNode(data []byte) (*LeafNode, []byte, error) {
+	r := &tls.Reader{Buf: data}
+	leaf := &LeafNode{}
+	if err := leaf.decode(r); err != nil {
+		return nil, nil, fmt.Errorf("invalid leaf node: %w", err)
+	}
+	return leaf, r.Buf, nil
+}
+
+// MarshalTBS encodes LeafNodeTBS, the content covered by the leaf signature
+// Leaves from a KeyPackage are signed without group context; update and commit
+// leaves also cover the group ID and their leaf index
+func (n *LeafNode) MarshalTBS(groupID []byte, leafIndex uint32) ([]byte, error) {
+	w := &tls.Writer{}
+	if err := n.encodeContent(w); err != nil {
+		return nil, err
+	}
+	if n.Source == LeafNodeSourceUpdate || n.Source == LeafNodeSourceCommit {
+		if err := w.Opaque(groupID); err != nil {
+			return nil, err
+		}
+		w.Uint32(leafIndex)
+	}
+	return w.Buf, nil
+}
+
+// Validate checks the leaf node is well formed for the ciphersuite
+// Without a ciphersuite the keys are only checked to be present. Signatures are not
+// checked here since that needs the group context of the leaf
+func (n *LeafNode) Validate(cs Ciphersuite) error {
+	if len(n.EncryptionKey) == 0 {
+		return errors.New("leaf node has no encryption key")
+	}
+	if len(n.SignatureKey) == 0 {
+		return errors.New("leaf node has no signature key")
+	}
+	if cs != 0 {
+		if err := checkRawKey(cs.KeyAlgorithm(), n.EncryptionKey); err != nil {
+			return fmt.Errorf("encryption key: %w", err)
+		}
+		if err := checkRawKey(cs.SignatureAlgorithm(), n.SignatureKey); err != nil {
+			return fmt.Errorf("signature key: %w", err)
+		}
+	}
+
+	if err := ValidateCredential(n.Credential, n.SignatureKey); err != nil {
+		return fmt.Errorf("credential: %w", err)
+	}
+
+	caps := n.Capabilities
+	if !slices.Contains(caps.Versions, ProtocolVersionMLS10) {
+		return errors.New("leaf capabilities do not include mls10")
+	}
+	if cs != 0 && !slices.Contains(caps.CipherSuites, uint16(cs)) {
+		return fmt.Errorf("leaf capabilities do not include ciphersuite 0x%04x", uint16(cs))
+	}
+	if !slices.Contains(caps.Credentials, uint16(n.Credential.Type)) {
+		return fmt.Errorf("leaf capabilities do not include its own credential type %d", n.Credential.Type)
+	}
+
+	switch n.Source {
+	case LeafNodeSourceKeyPackage:
+		if n.Lifetime.NotBefore > n.Lifetime.NotAfter {
+			return errors.New("leaf lifetime ends before it starts")
+		}
+	case LeafNodeSourceUpdate, LeafNodeSourceCommit:
+	default:
+		return fmt.Errorf("unknown leaf node source %d", n.Source)
+	}
+
+	seen := make(map[uint16]bool, len(n.Extensions))
+	for _, ext := range n.Extensions {
+		if seen[ext.Type] {
+			return fmt.Errorf("duplicate leaf extension 0x%04x", ext.Type)
+		}
+		seen[ext.Type] = true
+	}
+	return nil
+}
+
+// Identity returns the identity named by the leaf's credential, see Credential.Subject
+func (n *LeafNode) Identity() string {
+	return n.Credential.Subject()
+}
+
+// checkRawKey validates a key of alg in its raw wire encoding
+func checkRawKey(alg KeyAlgorithm, data []byte) error {
+	key, err := ParsePublicKey(alg, data)
+	if err != nil {
+		return err
+	}
+	if key.Encoding != KeyEncodingRaw {
+		return fmt.Errorf("%s key is %s encoded, want raw", alg, key.Encoding)
+	}
+	return nil
+}
+
+func (n *LeafNode) encode(w *tls.Writer) error {
+	if err := n.encodeContent(w); err != nil {
+		return err
+	}
+	return w.Opaque(n.Signature)
+}
+
+// encodeContent writes the leaf node without its signature
+func (n *LeafNode) encodeContent(w *tls.Writer) error {
+	if err := w.Opaque(n.EncryptionKey); err != nil {
+		return err
+	}
+	if err := w.Opaque(n.SignatureKey); err != nil {
+		return err
+	}
+	if err := n.Credential.encode(w); err != nil {
+		return err
+	}
+	for _, list := range [][]uint16{n.Capabilities.Versions, n.Capabilities.CipherSuites,
+		n.Capabilities.Extensions, n.Capabilities.Proposals, n.Capabilities.Credentials} {
+		if err := w.Uint16s(list); err != nil {
+			return err
+		}
+	}
+
+	w.Uint8(uint8(n.Source))
+	switch n.Source {
+	case LeafNodeSourceKeyPackage:
+		w.Uint64(n.Lifetime.NotBefore)
+		w.Uint64(n.Lifetime.NotAfter)
+	case LeafNodeSourceUpdate:
+	case LeafNodeSourceCommit:
+		if err := w.Opaque(n.ParentHash); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown leaf node source %d", n.Source)
+	}
+	return encodeExtensions(w, n.Extensions)
+}
+
+func (n *LeafNode) decode(r *tls.Reader) error {
+	var err error
+	if n.EncryptionKey, err = r.Opaque(); err != nil {
+		return err
+	}
+	if n.SignatureKey, err = r.Opaque(); err != nil {
+		return err
+	}
+	if err := n.Credential.decode(r); err != nil {
+		return err
+	}
+	for _, list := range []*[]uint16{&n.Capabilities.Versions, &n.Capabilities.CipherSuites,
+		&n.Capabilities.Extensions, &n.Capabilities.Proposals, &n.Capabilities.Credentials} {
+		if *list, err = r.Uint16s(); err != nil {
+			return err
+		}
+	}
+
+	source, err := r.Uint8()
+	if err != nil {
+		return err
+	}
+	n.Source = LeafNodeSource(source)
+	switch n.Source {
+	case LeafNodeSourceKeyPackage:
+		if n.Lifetime.NotBefore, err = r.Uint64(); err != nil {
+			return err
+		}
+		if n.Lifetime.NotAfter, err = r.Uint64(); err != nil {
+			return err
+		}
+	case LeafNodeSourceUpdate:
+	case LeafNodeSourceCommit:
+		if n.ParentHash, err = r.Opaque(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown leaf node source %d", source)
+	}
+
+	if n.Extensions, err = decodeExtensions(r); err != nil {
+		return err
+	}
+	n.Signature, err = r.Opaque()
+	return err
+}
+
+func (c *Credential) encode(w *tls.Writer) error {
+	w.Uint16(uint16(c.Type))
+	switch c.Type {
+	case CredentialBasic:
+		return w.Opaque(c.Identity)
+	case CredentialX509:
+		return w.Vector(func(w *tls.Writer) error {
+			for _, cert := range c.Certificates {
+				if err := w.Opaque(cert); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return fmt.Errorf("unsupported credential type %d", c.Type)
+}
+
+func (c *Credential) decode(r *tls.Reader) error {
+	kind, err := r.Uint16()
+	if err != nil {
+		return err
+	}
+	c.Type = CredentialType(kind)
+	switch c.Type {
+	case CredentialBasic:
+		c.Identity, err = r.Opaque()
+		return err
+	case CredentialX509:
+		return r.Vector(func(r *tls.Reader) error {
+			cert, err := r.Opaque()
+			c.Certificates = append(c.Certificates, cert)
+			return err
+		})
+	}
+	return fmt.Errorf("unsupported credential type %d", kind)
+}
+
+func encodeExtensions(w *tls.Writer, extensions []Extension) error {
+	return w.Vector(func(w *tls.Writer) error {
+		for _, ext := range extensions {
+			w.Uint16(ext.Type)
+			if err := w.Opaque(ext.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodeExtensions(r *tls.Reader) ([]Extension, error) {
+	var extensions []Extension
+	err := r.Vector(func(r *tls.Reader) error {
+		kind, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		data, err := r.Opaque()
+		extensions = append(extensions, Extension{Type: kind, Data: data})
+		return err
+	})
+	return extensions, err
+}
+
+// leafNodeOf decodes a leaf node stored with an element, nil when there is none
+func leafNodeOf(encoded []byte) (*LeafNode, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	leaf := &LeafNode{}
+	if err := leaf.UnmarshalBinary(encoded); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// encodeLeafNode encodes a leaf node for storage, nil when there is none
+func encodeLeafNode(leaf *LeafNode) []byte {
+	if leaf == nil {
+		return nil
+	}
+	encoded, err := leaf.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// LeafNode returns the leaf node stored with the element, nil when it has none
+func (e *Element) LeafNode() *LeafNode {
+	e.unshelve()
+	return e.leafNode
+}
+
+// LeafIndex returns the leaf's index, the position its leaf node signatures cover
+func (e *Element) LeafIndex() int {
+	return e.leafIndex
+}
+
+// admitLeaf validates a leaf node entering the tree at leafIndex, verifies its
+// signature and lifetime, checks the group's required capabilities and runs the authentication hook
+func (t *Tree) admitLeaf(name string, leaf *LeafNode, leafIndex int) error {
+	if err := leaf.Validate(t.ciphersuite); err != nil {
+		return err
+	}
+	if err := leaf.VerifySignature(t.ciphersuite, t.groupID, uint32(leafIndex)); err != nil {
+		return fmt.Errorf("leaf node signature: %w", err)
+	}
+	if err := checkLifetime(leaf, time.Now()); err != nil {
+		return err
+	}
+	required, err := t.RequiredCapabilities()
+	if err != nil {
+		return err
+	}
+	if required != nil {
+		if err := required.Check(leaf.Capabilities); err != nil {
+			return err
+		}
+	}
+	return t.authenticate(name, leaf)
+}
+
+// InsertLeafNode inserts a leaf that stores leaf alongside the node
+// The leaf node must come from a KeyPackage and carry a valid signature; the element's
+// public key is its encryption key
+func (t *Tree) InsertLeafNode(name string, leaf *LeafNode) error {
+	if leaf.Source != LeafNodeSourceKeyPackage {
+		return fmt.Errorf("failed to insert %s: leaf node source %d, new members join with a key package leaf", name, leaf.Source)
+	}
+	if err := t.admitLeaf(name, leaf, 0); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	key, err := t.checkKey(leaf.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	return t.insert(name, key, leaf)
+}
+
+// UpdateLeafNode replaces a member's leaf node, and with it the leaf's public key
+// The new leaf node must be an update or commit leaf signed over the tree's group ID
+// and the member's leaf index
+func (t *Tree) UpdateLeafNode(name string, leaf *LeafNode) (err error) {
+	if err := t.checkWritable("update leaf"); err != nil {
+		return err
+	}
+	end := t.startOp("update_leaf", name)
+	defer func() { end(err) }()
+
+	node, found := t.Find(name)
+	if !found {
+		return fmt.Errorf("node not found: %s", name)
+	}
+	if !node.IsLeaf() {
+		return fmt.Errorf("%s is not a leaf", name)
+	}
+	if leaf.Source != LeafNodeSourceUpdate && leaf.Source != LeafNodeSourceCommit {
+		return fmt.Errorf("failed to update %s: leaf node source %d, updates use update or commit leaves", name, leaf.Source)
+	}
+	if err := t.admitLeaf(name, leaf, node.leafIndex); err != nil {
+		return fmt.Errorf("failed to update %s: %w", name, err)
+	}
+	if err := node.unshelve(); err != nil {
+		return err
+	}
+	if leaf.Source == LeafNodeSourceCommit && node.parentHash != nil && !bytes.Equal(leaf.ParentHash, node.parentHash) {
+		return fmt.Errorf("failed to update %s: %w: commit leaf node does not carry the path's parent hash", name, ErrParentHashMismatch)
+	}
+	key, err := t.checkKey(leaf.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", name, err)
+	}
+	if len(key.Data) == 0 {
+		return fmt.Errorf("failed to update %s: %w", name, ErrEmptyKey)
+	}
+
+	if err := t.setNodeKey(node, key); err != nil {
+		return err
+	}
+	node.leafNode = leaf
+	node.parentHash = leaf.ParentHash
+	node.MarkAsModified()
+	return node.saveToDisk()
+}
@@ -0,0 +1,213 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"math"
+	"testing"
+)
+
+// newTestLeafNode returns a signed KeyPackage leaf node and its signature private key
+func newTestLeafNode(t *testing.T, identity string) (*LeafNode, ed25519.PrivateKey) {
+	t.Helper()
+	encryption, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate encryption key: %v", err)
+	}
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate signature key: %v", err)
+	}
+	leaf := &LeafNode{
+		EncryptionKey: encryption.PublicKey().Bytes(),
+		Credential:    Credential{Type: CredentialBasic, Identity: []byte(identity)},
+		Capabilities: Capabilities{
+			Versions:     []uint16{ProtocolVersionMLS10},
+			CipherSuites: []uint16{uint16(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)},
+			Credentials:  []uint16{uint16(CredentialBasic), uint16(CredentialX509)},
+		},
+		Source:     LeafNodeSourceKeyPackage,
+		Lifetime:   Lifetime{NotBefore: 1, NotAfter: math.MaxUint64},
+		Extensions: []Extension{{Type: 0xff01, Data: []byte("ext")}},
+	}
+	if err := leaf.Sign(signer, nil, 0); err != nil {
+		t.Fatalf("Failed to sign leaf node: %v", err)
+	}
+	return leaf, signer
+}
+
+func testLeafNode(t *testing.T, identity string) *LeafNode {
+	t.Helper()
+	leaf, _ := newTestLeafNode(t, identity)
+	return leaf
+}
+
+// testUpdateLeafNode returns an update leaf node for name, signed over tr's group context
+func testUpdateLeafNode(t *testing.T, tr *Tree, name, identity string) *LeafNode {
+	t.Helper()
+	leaf, signer := newTestLeafNode(t, identity)
+	leaf.Source = LeafNodeSourceUpdate
+	leaf.Lifetime = Lifetime{}
+	index := 0
+	if element, found := tr.Find(name); found {
+		index = element.LeafIndex()
+	}
+	if err := leaf.Sign(signer, tr.GroupID(), uint32(index)); err != nil {
+		t.Fatalf("Failed to sign update leaf node: %v", err)
+	}
+	return leaf
+}
+
+func TestLeafNodeRoundTrip(t *testing.T) {
+	leaf := testLeafNode(t, "alice")
+	x509, _ := testX509LeafNode(t, "alice")
+	x509.Source = LeafNodeSourceCommit
+	x509.ParentHash = bytes.Repeat([]byte{7}, 32)
+
+	for _, original := range []*LeafNode{leaf, x509} {
+		encoded, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to encode leaf node: %v", err)
+		}
+		var decoded LeafNode
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("Failed to decode leaf node: %v", err)
+		}
+		reencoded, _ := decoded.MarshalBinary()
+		if !bytes.Equal(encoded, reencoded) {
+			t.Errorf("re-encoding changed the leaf node")
+		}
+		if err := decoded.Validate(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519); err != nil {
+			t.Errorf("decoded leaf node should validate: %v", err)
+		}
+		for cut := 0; cut < len(encoded); cut++ {
+			if err := decoded.UnmarshalBinary(encoded[:cut]); err == nil {
+				t.Fatalf("truncated leaf node at %d bytes should fail to decode", cut)
+			}
+		}
+	}
+
+	// Update and commit leaves sign their group context, KeyPackage leaves do not
+	a, _ := leaf.MarshalTBS([]byte("group"), 3)
+	b, _ := leaf.MarshalTBS([]byte("other"), 4)
+	if !bytes.Equal(a, b) {
+		t.Errorf("key package leaf TBS should not depend on the group context")
+	}
+	leaf.Source = LeafNodeSourceUpdate
+	a, _ = leaf.MarshalTBS([]byte("group"), 3)
+	b, _ = leaf.MarshalTBS([]byte("group"), 4)
+	if bytes.Equal(a, b) {
+		t.Errorf("update leaf TBS should cover the leaf index")
+	}
+}
+
+func TestLeafNodeValidateRejects(t *testing.T) {
+	cs := MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	cases := map[string]func(*LeafNode){
+		"short encryption key":     func(n *LeafNode) { n.EncryptionKey = []byte("short") },
+		"missing signature key":    func(n *LeafNode) { n.SignatureKey = nil },
+		"empty identity":           func(n *LeafNode) { n.Credential.Identity = nil },
+		"no mls10":                 func(n *LeafNode) { n.Capabilities.Versions = []uint16{2} },
+		"missing ciphersuite":      func(n *LeafNode) { n.Capabilities.CipherSuites = nil },
+		"missing credential type":  func(n *LeafNode) { n.Capabilities.Credentials = []uint16{uint16(CredentialX509)} },
+		"inverted lifetime":        func(n *LeafNode) { n.Lifetime = Lifetime{NotBefore: 5, NotAfter: 4} },
+		"unknown source":           func(n *LeafNode) { n.Source = 9 },
+		"duplicate leaf extension": func(n *LeafNode) { n.Extensions = append(n.Extensions, n.Extensions[0]) },
+	}
+	for name, mutate := range cases {
+		leaf := testLeafNode(t, "alice")
+		mutate(leaf)
+		if err := leaf.Validate(cs); err == nil {
+			t.Errorf("%s: should be rejected", name)
+		}
+	}
+}
+
+func TestInsertLeafNodePersists(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"json":        func(*Tree) {},
+		"binary":      WithBinaryEncoding(),
+		"flatbuffers": WithFlatBufferEncoding(),
+	} {
+		tempDir := t.TempDir()
+		files, _ := NewFileStore(tempDir)
+		tr, _ := NewTreeWithStore(files, opt, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+		alice := testLeafNode(t, "alice")
+		if err := tr.InsertLeafNode("alice", alice); err != nil {
+			t.Fatalf("%s: failed to insert leaf node: %v", name, err)
+		}
+		if err := tr.InsertLeafNode("bob", testLeafNode(t, "bob")); err != nil {
+			t.Fatalf("%s: failed to insert leaf node: %v", name, err)
+		}
+		tr.Insert("charlie", testLeafNode(t, "charlie").EncryptionKey)
+
+		loaded, err := LoadTreeFromStore(files, "")
+		if err != nil {
+			t.Fatalf("%s: failed to load tree: %v", name, err)
+		}
+		element, _ := loaded.Find("alice")
+		got := element.LeafNode()
+		if got == nil || !bytes.Equal(got.SignatureKey, alice.SignatureKey) || !bytes.Equal(element.PublicKey().Data, alice.EncryptionKey) {
+			t.Fatalf("%s: leaf node should survive a reload, got %+v", name, got)
+		}
+		if charlie, _ := loaded.Find("charlie"); charlie.LeafNode() != nil {
+			t.Errorf("%s: bare-key leaf should have no leaf node", name)
+		}
+	}
+}
+
+func TestUpdateLeafNode(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	tr.InsertLeafNode("alice", testLeafNode(t, "alice"))
+	tr.InsertLeafNode("bob", testLeafNode(t, "bob"))
+
+	updated := testUpdateLeafNode(t, tr, "alice", "alice")
+	if err := tr.UpdateLeafNode("alice", updated); err != nil {
+		t.Fatalf("Failed to update leaf node: %v", err)
+	}
+	alice, _ := tr.Find("alice")
+	if alice.LeafNode() != updated || !bytes.Equal(alice.PublicKey().Data, updated.EncryptionKey) {
+		t.Errorf("update should replace the leaf node and its key")
+	}
+	if err := tr.UpdateLeafNode(tr.Head().Name(), updated); err == nil {
+		t.Errorf("intermediate nodes cannot hold leaf nodes")
+	}
+	invalid := testUpdateLeafNode(t, tr, "alice", "alice")
+	invalid.Capabilities.Versions = nil
+	if err := tr.UpdateLeafNode("alice", invalid); err == nil {
+		t.Errorf("invalid leaf node should be rejected")
+	}
+
+	// Diff and patches carry leaf nodes
+	other, _ := NewTreeWithStore(nil)
+	blank, _ := NewTreeWithStore(nil)
+	other.ApplyPatch(blank.Diff(tr))
+	if bob, _ := other.Find("bob"); bob == nil || bob.LeafNode() == nil {
+		t.Errorf("patched tree should carry leaf nodes")
+	}
+}
+
+func TestRatchetTreeKeepsLeafNodes(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	alice := testLeafNode(t, "alice")
+	tr.InsertLeafNode("alice", alice)
+	tr.Insert("bob", []byte("bob_key"))
+
+	data, err := tr.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	imported, err := ImportRatchetTree(data, nil)
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+	element, _ := imported.Find("alice")
+	if element == nil || element.LeafNode() == nil || !bytes.Equal(element.LeafNode().Signature, alice.Signature) {
+		t.Errorf("signed leaf node should survive the ratchet tree round trip")
+	}
+	if bob, _ := imported.Find("bob"); bob == nil || bob.LeafNode() != nil {
+		t.Errorf("placeholder leaf nodes should not be kept")
+	}
+}
@@ -0,0 +1,60 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrLeafExpired is returned when a key package leaf is admitted outside its lifetime
+var ErrLeafExpired = errors.New("leaf node is outside its lifetime")
+
+// Expired reports whether the lifetime ended before now
+func (l Lifetime) Expired(now time.Time) bool {
+	sec := now.Unix()
+	return sec > 0 && uint64(sec) > l.NotAfter
+}
+
+// checkLifetime rejects key package leaves not valid at now, see admitLeaf
+// Update and commit leaves carry no lifetime
+func checkLifetime(leaf *LeafNode, now time.Time) error {
+	if leaf.Source != LeafNodeSourceKeyPackage || leaf.Lifetime.Contains(now) {
+		return nil
+	}
+	return fmt.Errorf("%w: valid from %d to %d", ErrLeafExpired, leaf.Lifetime.NotBefore, leaf.Lifetime.NotAfter)
+}
+
+// ExpiredLeaves returns the members whose key package leaf expired before now, in leaf order
+// Their key material should be rotated: the member commits an update, or the group removes
+// and re-adds them. Leaves that have been updated since joining carry no lifetime and never expire
+func (t *Tree) ExpiredLeaves(now time.Time) []*Element {
+	var expired []*Element
+	for _, leaf := range t.GetLeaves() {
+		if node := leaf.LeafNode(); node != nil && node.Source == LeafNodeSourceKeyPackage && node.Lifetime.Expired(now) {
+			expired = append(expired, leaf)
+		}
+	}
+	return expired
+}
+
+// NextExpiry returns when the next member leaf still valid at now expires, false when none will
+// The tree is not safe for concurrent use, so background sweeping is left to the caller: arm a
+// timer for NextExpiry and call ExpiredLeaves when it fires, from the goroutine owning the tree
+func (t *Tree) NextExpiry(now time.Time) (time.Time, bool) {
+	next := uint64(math.MaxUint64)
+	for _, leaf := range t.GetLeaves() {
+		node := leaf.LeafNode()
+		if node == nil || node.Source != LeafNodeSourceKeyPackage || node.Lifetime.Expired(now) {
+			continue
+		}
+		if node.Lifetime.NotAfter < next {
+			next = node.Lifetime.NotAfter
+		}
+	}
+	if next > math.MaxInt64-1 {
+		return time.Time{}, false
+	}
+	// The lifetime includes NotAfter, so the leaf expires a second later
+	return time.Unix(int64(next)+1, 0), true
+}
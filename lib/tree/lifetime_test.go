@@ -0,0 +1,65 @@
+package tree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testLifetimeLeafNode returns a key package leaf node for identity valid over lifetime
+func testLifetimeLeafNode(t *testing.T, identity string, lifetime Lifetime) *LeafNode {
+	t.Helper()
+	leaf, signer := newTestLeafNode(t, identity)
+	leaf.Lifetime = lifetime
+	if err := leaf.Sign(signer, nil, 0); err != nil {
+		t.Fatalf("Failed to sign leaf node: %v", err)
+	}
+	return leaf
+}
+
+func TestLeafLifetime(t *testing.T) {
+	now := time.Now()
+	unix := uint64(now.Unix())
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+
+	if err := tr.InsertLeafNode("stale", testLifetimeLeafNode(t, "stale", Lifetime{NotBefore: 1, NotAfter: 2})); !errors.Is(err, ErrLeafExpired) {
+		t.Errorf("expired leaves should be rejected with ErrLeafExpired, got %v", err)
+	}
+	if err := tr.InsertLeafNode("early", testLifetimeLeafNode(t, "early", Lifetime{NotBefore: unix + 3600, NotAfter: unix + 7200})); !errors.Is(err, ErrLeafExpired) {
+		t.Errorf("not yet valid leaves should be rejected with ErrLeafExpired, got %v", err)
+	}
+	if tr.Head() != nil {
+		t.Fatalf("rejected leaves should not be inserted")
+	}
+
+	lifetimes := map[string]Lifetime{
+		"alice":   {NotBefore: unix - 60, NotAfter: unix + 60},
+		"bob":     {NotBefore: unix - 60, NotAfter: unix + 3600},
+		"charlie": {NotBefore: unix - 60, NotAfter: unix + 30},
+	}
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tr.InsertLeafNode(name, testLifetimeLeafNode(t, name, lifetimes[name])); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	if expired := tr.ExpiredLeaves(now); len(expired) != 0 {
+		t.Errorf("no leaf should have expired yet, got %d", len(expired))
+	}
+	next, ok := tr.NextExpiry(now)
+	if !ok || next.Unix() != int64(unix+31) {
+		t.Errorf("charlie should expire first at %d, got %v %v", unix+31, next.Unix(), ok)
+	}
+
+	later := now.Add(2 * time.Minute)
+	expired := tr.ExpiredLeaves(later)
+	if len(expired) != 2 || expired[0].Name() != "alice" || expired[1].Name() != "charlie" {
+		t.Fatalf("alice and charlie should have expired, got %v", expired)
+	}
+	if next, ok := tr.NextExpiry(later); !ok || next.Unix() != int64(unix+3601) {
+		t.Errorf("bob should expire next, got %v %v", next, ok)
+	}
+	if _, ok := tr.NextExpiry(now.Add(2 * time.Hour)); ok {
+		t.Errorf("no leaf should be left to expire")
+	}
+}
@@ -0,0 +1,7 @@
+// Package lmdb stores TreeKEM trees in a memory-mapped LMDB environment
+//
+// Reads are served straight from the memory map, which keeps Find and
+// GetTreeStructure cheap on large trees. The package is a module of its own, since it
+// depends on github.com/PowerDNS/lmdb-go, a cgo binding that builds the bundled LMDB
+// sources and so needs a C compiler.
+package lmdb
@@ -0,0 +1,12 @@
+module github.com/snowmerak/mls/lib/tree/lmdb
+
+go 1.25.0
+
+require (
+	github.com/PowerDNS/lmdb-go v1.9.3
+	github.com/snowmerak/mls v0.0.0
+)
+
+require github.com/google/flatbuffers v25.2.10+incompatible // indirect
+
+replace github.com/snowmerak/mls => ../../..
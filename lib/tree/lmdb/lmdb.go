@@ -0,0 +1,257 @@
+package lmdb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// defaultMapSize is the maximum size of the memory map
+const defaultMapSize = 1 << 30
+
+// readTxnPoolSize bounds the read-only transactions kept for reuse
+const readTxnPoolSize = 8
+
+// op is a put or delete buffered until the operation commits
+type op struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// Store keeps tree elements in the "nodes" database of an LMDB environment
+// It is a tree.BatchStore: the writes of each tree operation are buffered and applied
+// in one write transaction, since LMDB write transactions are pinned to an OS thread
+// and cannot stay open across the calls of an operation
+type Store struct {
+	env *lmdb.Env
+	dbi lmdb.DBI
+
+	// readTxns holds reset read-only transactions that Read renews instead of
+	// beginning a new one per element
+	readTxns chan *lmdb.Txn
+
+	mu       sync.Mutex
+	batching bool
+	ops      []op
+	overlay  map[string]int // key -> index of newest op in ops
+}
+
+var _ tree.BatchStore = (*Store)(nil)
+
+// Open opens or creates the LMDB environment in dir
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create environment directory: %w", err)
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lmdb environment: %w", err)
+	}
+	if err := env.SetMapSize(defaultMapSize); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("failed to set map size: %w", err)
+	}
+	if err := env.SetMaxDBs(1); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("failed to set max databases: %w", err)
+	}
+	// NoTLS ties read transactions to themselves rather than to an OS thread, which
+	// goroutines do not stay on
+	if err := env.Open(dir, lmdb.NoTLS, 0644); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("failed to open lmdb environment: %w", err)
+	}
+
+	s := &Store{env: env, readTxns: make(chan *lmdb.Txn, readTxnPoolSize)}
+	if err := env.Update(func(txn *lmdb.Txn) error {
+		s.dbi, err = txn.OpenDBI("nodes", lmdb.Create)
+		return err
+	}); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("failed to open nodes database: %w", err)
+	}
+	return s, nil
+}
+
+// NewTree opens the environment in dir and returns an empty tree stored in it
+func NewTree(dir string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store, err := Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.NewTreeWithStore(store, opts...)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// OpenTree loads the tree stored in dir using the root recorded in its manifest
+func OpenTree(dir string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store, err := Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.LoadTreeFromStore(store, "", opts...)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Key uses the element name as the database key
+func (s *Store) Key(name string) string {
+	return name
+}
+
+// Begin starts buffering the writes of one tree operation
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batching = true
+	s.ops = nil
+	s.overlay = make(map[string]int)
+}
+
+// Commit applies the buffered writes in one write transaction, or drops them when opErr is set
+func (s *Store) Commit(opErr error) error {
+	s.mu.Lock()
+	ops := s.ops
+	s.batching = false
+	s.ops = nil
+	s.overlay = nil
+	s.mu.Unlock()
+
+	if opErr != nil || len(ops) == 0 {
+		return opErr
+	}
+	if err := s.env.Update(func(txn *lmdb.Txn) error {
+		for _, o := range ops {
+			if err := s.apply(txn, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// apply runs one put or delete in txn
+func (s *Store) apply(txn *lmdb.Txn, o op) error {
+	if !o.delete {
+		return txn.Put(s.dbi, []byte(o.key), o.value, 0)
+	}
+	err := txn.Del(s.dbi, []byte(o.key), nil)
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// write buffers o in the running operation, or applies it in a transaction of its own
+func (s *Store) write(o op) error {
+	s.mu.Lock()
+	if s.batching {
+		s.overlay[o.key] = len(s.ops)
+		s.ops = append(s.ops, o)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+	return s.env.Update(func(txn *lmdb.Txn) error {
+		return s.apply(txn, o)
+	})
+}
+
+// Write stores an element
+func (s *Store) Write(key string, data []byte) error {
+	// The buffered value outlives the caller's use of data
+	return s.write(op{key: key, value: append([]byte(nil), data...)})
+}
+
+// Read returns an element, including writes buffered by the running operation
+// The value is copied out of the memory map since the tree keeps it after the
+// transaction ends, decoding the flatbuffer record lazily
+func (s *Store) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	if i, ok := s.overlay[key]; ok {
+		o := s.ops[i]
+		s.mu.Unlock()
+		if o.delete {
+			return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+		}
+		return append([]byte(nil), o.value...), nil
+	}
+	s.mu.Unlock()
+
+	txn, err := s.readTxn()
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseReadTxn(txn)
+
+	value, err := txn.Get(s.dbi, []byte(key))
+	if lmdb.IsNotFound(err) {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// readTxn renews a pooled read-only transaction, or begins one when the pool is empty
+func (s *Store) readTxn() (*lmdb.Txn, error) {
+	select {
+	case txn := <-s.readTxns:
+		if err := txn.Renew(); err == nil {
+			return txn, nil
+		}
+		txn.Abort()
+	default:
+	}
+	txn, err := s.env.BeginTxn(nil, lmdb.Readonly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+	}
+	txn.RawRead = true
+	return txn, nil
+}
+
+// releaseReadTxn resets txn and returns it to the pool, aborting it when the pool is full
+func (s *Store) releaseReadTxn(txn *lmdb.Txn) {
+	txn.Reset()
+	select {
+	case s.readTxns <- txn:
+	default:
+		txn.Abort()
+	}
+}
+
+// Remove deletes an element
+func (s *Store) Remove(key string) error {
+	return s.write(op{key: key, delete: true})
+}
+
+// Close aborts the pooled read transactions and closes the environment
+func (s *Store) Close() error {
+	for {
+		select {
+		case txn := <-s.readTxns:
+			txn.Abort()
+		default:
+			return s.env.Close()
+		}
+	}
+}
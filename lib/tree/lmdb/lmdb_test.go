@@ -0,0 +1,91 @@
+package lmdb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestLMDBTreeReopen(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "lmdb_tree_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tr, store, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 64; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	store.Close()
+
+	reopened, store, err := OpenTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+	defer store.Close()
+
+	if got := len(reopened.GetLeaves()); got != 64 {
+		t.Errorf("expected 64 leaves after reopen, got %d", got)
+	}
+	if _, ok := reopened.Find("user_42"); !ok {
+		t.Errorf("user_42 not found after reopen")
+	}
+}
+
+func TestLMDBOperationsAreTransactional(t *testing.T) {
+	tempDir := t.TempDir()
+	tr, store, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	store.Begin()
+	if err := store.Write("charlie", []byte("partial")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if data, err := store.Read("charlie"); err != nil || string(data) != "partial" {
+		t.Errorf("the operation should read its own writes, got %q, %v", data, err)
+	}
+	if err := store.Commit(errors.New("operation failed")); err == nil {
+		t.Fatalf("Commit should return the operation's error")
+	}
+	if _, err := store.Read("charlie"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a dropped write should not be stored, got %v", err)
+	}
+
+	store.Begin()
+	if err := store.Write("charlie", []byte("committed")); err != nil {
+		t.Fatalf("Failed to write in the transaction: %v", err)
+	}
+	if err := store.Commit(nil); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	// The pooled read transaction is renewed and sees the new commit
+	if data, err := store.Read("charlie"); err != nil || string(data) != "committed" {
+		t.Errorf("expected the committed write, got %q, %v", data, err)
+	}
+	store.Close()
+
+	reopened, store, err := OpenTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+	defer store.Close()
+	if got := len(reopened.GetLeaves()); got != 2 {
+		t.Errorf("expected the 2 committed leaves, got %d", got)
+	}
+}
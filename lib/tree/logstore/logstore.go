@@ -0,0 +1,356 @@
+// Package logstore keeps a whole TreeKEM tree in one append-only log file
+//
+// Every element write or removal is appended as a record; opening the file
+// replays the log and periodic compaction rewrites it with live records only.
+// Backups are a single-file copy.
+package logstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Record operations
+const (
+	opPut    byte = 1
+	opRemove byte = 2
+)
+
+// defaultCompactRatio triggers compaction once dead bytes outweigh live bytes this many times
+const defaultCompactRatio = 4
+
+// minCompactSize avoids compacting tiny logs
+const minCompactSize = 64 << 10
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithSync fsyncs the log after every record
+func WithSync() Option {
+	return func(s *Store) {
+		s.sync = true
+	}
+}
+
+// WithCompactRatio sets how many times larger than the live data the log may grow before compaction
+// A ratio of 0 disables automatic compaction
+func WithCompactRatio(ratio int) Option {
+	return func(s *Store) {
+		s.compactRatio = ratio
+	}
+}
+
+// Store is a log-structured tree.Store backed by a single file
+type Store struct {
+	mu           sync.Mutex
+	path         string
+	file         *os.File
+	writer       *bufio.Writer
+	live         map[string][]byte
+	liveBytes    int64
+	logBytes     int64
+	sync         bool
+	compactRatio int
+}
+
+var _ tree.Store = (*Store)(nil)
+
+// Open opens or creates the log at path and replays it
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		path:         path,
+		live:         make(map[string][]byte),
+		compactRatio: defaultCompactRatio,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	return s, nil
+}
+
+// NewTree opens the log at path and returns an empty tree stored in it
+func NewTree(path string, opts ...Option) (*tree.Tree, *Store, error) {
+	store, err := Open(path, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.NewTreeWithStore(store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// OpenTree replays the log at path and loads the tree recorded in its manifest
+func OpenTree(path string, opts ...Option) (*tree.Tree, *Store, error) {
+	store, err := Open(path, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.LoadTreeFromStore(store, "")
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// replay rebuilds the live set, truncating a torn record left by a crash
+func (s *Store) replay() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		op, key, data, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A partial trailing record is the only acceptable corruption
+			if truncErr := os.Truncate(s.path, offset); truncErr != nil {
+				return fmt.Errorf("failed to truncate torn record: %w", truncErr)
+			}
+			break
+		}
+		offset += n
+		s.apply(op, key, data)
+	}
+	s.logBytes = offset
+	return nil
+}
+
+// apply updates the live set for a record
+func (s *Store) apply(op byte, key string, data []byte) {
+	if previous, ok := s.live[key]; ok {
+		s.liveBytes -= int64(len(previous))
+	}
+	switch op {
+	case opPut:
+		s.live[key] = data
+		s.liveBytes += int64(len(data))
+	case opRemove:
+		delete(s.live, key)
+	}
+}
+
+// readRecord reads one record: op, key, data and trailing CRC32
+func readRecord(r *bufio.Reader) (byte, string, []byte, int64, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return 0, "", nil, 0, err
+	}
+	keyLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+	dataLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+	body := make([]byte, keyLen+dataLen+4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := body[:keyLen+dataLen]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(body[keyLen+dataLen:]) {
+		return 0, "", nil, 0, fmt.Errorf("record checksum mismatch")
+	}
+
+	n := int64(1 + uvarintLen(keyLen) + uvarintLen(dataLen) + len(body))
+	return op, string(payload[:keyLen]), payload[keyLen:], n, nil
+}
+
+// appendRecord encodes a record onto dst
+func appendRecord(dst []byte, op byte, key string, data []byte) []byte {
+	dst = append(dst, op)
+	dst = binary.AppendUvarint(dst, uint64(len(key)))
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+	start := len(dst)
+	dst = append(dst, key...)
+	dst = append(dst, data...)
+	return binary.BigEndian.AppendUint32(dst, crc32.ChecksumIEEE(dst[start:]))
+}
+
+// uvarintLen returns the encoded size of v
+func uvarintLen(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
+
+// Key uses the element name as the record key
+func (s *Store) Key(name string) string {
+	return name
+}
+
+// Write appends a put record
+func (s *Store) Write(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(opPut, key, data); err != nil {
+		return err
+	}
+	s.apply(opPut, key, append([]byte(nil), data...))
+	return s.maybeCompact()
+}
+
+// Read returns the latest value of an element
+func (s *Store) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.live[key]
+	if !ok {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Remove appends a removal record
+func (s *Store) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.live[key]; !ok {
+		return nil
+	}
+	if err := s.append(opRemove, key, nil); err != nil {
+		return err
+	}
+	s.apply(opRemove, key, nil)
+	return s.maybeCompact()
+}
+
+// append writes a record and flushes it to the file
+func (s *Store) append(op byte, key string, data []byte) error {
+	record := appendRecord(nil, op, key, data)
+	if _, err := s.writer.Write(record); err != nil {
+		return fmt.Errorf("failed to append record: %w", err)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush log: %w", err)
+	}
+	if s.sync {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync log: %w", err)
+		}
+	}
+	s.logBytes += int64(len(record))
+	return nil
+}
+
+// maybeCompact compacts once the log grew well beyond the live data
+func (s *Store) maybeCompact() error {
+	if s.compactRatio <= 0 || s.logBytes < minCompactSize {
+		return nil
+	}
+	if s.logBytes < s.liveBytes*int64(s.compactRatio) {
+		return nil
+	}
+	return s.compact()
+}
+
+// Compact rewrites the log so it only contains live records
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// compact writes live records to a temporary file and atomically replaces the log
+func (s *Store) compact() error {
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create compaction file: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	var record []byte
+	for key, data := range s.live {
+		record = appendRecord(record[:0], opPut, key, data)
+		if _, err := writer.Write(record); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to write compacted record: %w", err)
+		}
+		size += int64(len(record))
+	}
+	if err := writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to flush compacted log: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace log: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	s.file.Close()
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen log: %w", err)
+	}
+	s.file = file
+	s.writer.Reset(file)
+	s.logBytes = size
+	return nil
+}
+
+// Size returns the current log size in bytes
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logBytes
+}
+
+// Close flushes and closes the log
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,113 @@
+package logstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestLogStoreReplayAndCompaction(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "logstore_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "tree.log")
+	tr, store, err := NewTree(path, WithCompactRatio(0))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 16; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		tr.SetIntermediateNodeKey(tr.Head().Name(), []byte(fmt.Sprintf("root_%d", i)))
+	}
+	tr.Delete("user_3")
+
+	before := store.Size()
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if store.Size() >= before {
+		t.Errorf("compaction did not shrink the log: %d -> %d", before, store.Size())
+	}
+	t.Logf("로그 크기: %d -> %d bytes", before, store.Size())
+	tr.Insert("late", []byte("late_key"))
+	store.Close()
+
+	// Simulate a crash in the middle of appending a record
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{opPut, 5, 200, 'h', 'e'})
+	f.Close()
+
+	reopened, store, err := OpenTree(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+	defer store.Close()
+
+	if got := len(reopened.GetLeaves()); got != 16 {
+		t.Errorf("expected 16 leaves after replay, got %d", got)
+	}
+	if string(reopened.GetGroupPublicKey()) != string(tr.GetGroupPublicKey()) {
+		t.Errorf("root key not restored")
+	}
+	if _, ok := reopened.Find("user_3"); ok {
+		t.Errorf("deleted member reappeared after replay")
+	}
+}
+
+func TestCompressedLog(t *testing.T) {
+	plainPath := filepath.Join(t.TempDir(), "plain.log")
+	compressedPath := filepath.Join(t.TempDir(), "compressed.log")
+	for _, path := range []string{plainPath, compressedPath} {
+		store, err := Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open log: %v", err)
+		}
+		var opts []tree.Option
+		if path == compressedPath {
+			opts = append(opts, tree.WithCompression(gzip.BestCompression))
+		}
+		tr, err := tree.NewTreeWithStore(store, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		for i := 0; i < 32; i++ {
+			name := fmt.Sprintf("user_%d", i)
+			tr.Insert(name, bytes.Repeat([]byte{byte(i)}, 64))
+		}
+		store.Close()
+	}
+
+	// The whole tree sits in one file, and compressing its records shrinks it
+	plain, _ := os.Stat(plainPath)
+	compressed, _ := os.Stat(compressedPath)
+	t.Logf("로그 크기: %d -> %d bytes", plain.Size(), compressed.Size())
+	if compressed.Size() >= plain.Size() {
+		t.Errorf("compressed log is not smaller: %d vs %d bytes", compressed.Size(), plain.Size())
+	}
+
+	store, err := Open(compressedPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
+	defer store.Close()
+	reopened, err := tree.LoadTreeFromStore(store, "", tree.WithCompression(gzip.BestCompression))
+	if err != nil {
+		t.Fatalf("Failed to load compressed tree: %v", err)
+	}
+	if got := len(reopened.GetLeaves()); got != 32 {
+		t.Errorf("expected 32 leaves, got %d", got)
+	}
+}
@@ -0,0 +1,135 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// manifestName is the storage name of the tree manifest
+const manifestName = "__manifest__"
+
+// ErrReservedName is returned for element names starting with "__"
+// The manifest, journal and checkpoints are stored under such names next to the elements,
+// so a member of that name would overwrite them
+var ErrReservedName = errors.New("names starting with __ are reserved")
+
+// reservedName reports whether name is kept for the tree's own records
+func reservedName(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
+
+// manifest holds tree-level metadata persisted next to the elements
+type manifest struct {
+	Head   string   `json:"head,omitempty"`         // name of the root element
+	Pinned []string `json:"pinned_names,omitempty"` // names of the nodes kept resident
+
+	Ciphersuite Ciphersuite `json:"ciphersuite,omitempty"` // validates node keys when set
+	GroupID     []byte      `json:"group_id,omitempty"`    // group context of leaf signatures
+
+	Epoch          uint64      `json:"epoch,omitempty"`                   // current epoch of the group context
+	TranscriptHash []byte      `json:"transcript_hash,omitempty"`         // confirmed transcript hash of the epoch
+	InterimHash    []byte      `json:"interim_transcript_hash,omitempty"` // interim transcript hash of the epoch
+	Extensions     []Extension `json:"extensions,omitempty"`              // group context extensions
+	Successor      []byte      `json:"successor,omitempty"`               // set once the group is retired
+
+	Generations map[string]*replayWindow `json:"generations,omitempty"` // received message generations of the epoch
+}
+
+// saveManifest persists the manifest through the store
+func (t *Tree) saveManifest() error {
+	if t.store == nil {
+		return nil
+	}
+
+	head := ""
+	if t.head != nil {
+		head = t.head.name
+	}
+
+	data, err := json.Marshal(manifest{
+		Head:           head,
+		Pinned:         t.PinnedNames(),
+		Ciphersuite:    t.ciphersuite,
+		GroupID:        t.groupID,
+		Epoch:          t.epoch,
+		TranscriptHash: t.transcriptHash,
+		InterimHash:    t.interimHash,
+		Extensions:     t.groupExtensions,
+		Successor:      t.successor,
+		Generations:    t.generations,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := t.store.Write(t.store.Key(manifestName), data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	t.manifestHead = head
+	return nil
+}
+
+// syncManifestHead rewrites the manifest when the root element changed or a pinned node
+// left the tree
+func (t *Tree) syncManifestHead() error {
+	head := ""
+	if t.head != nil {
+		head = t.head.name
+	}
+	stale := false
+	for name := range t.pinned {
+		if _, ok := t.Find(name); !ok {
+			delete(t.pinned, name)
+			stale = true
+		}
+	}
+	if head == t.manifestHead && !stale {
+		return nil
+	}
+	return t.saveManifest()
+}
+
+// loadManifest restores manifest state, treating a missing manifest as empty
+func (t *Tree) loadManifest() error {
+	if t.store == nil {
+		return nil
+	}
+
+	data, err := t.store.Read(t.store.Key(manifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	if t.ciphersuite != 0 && m.Ciphersuite != 0 && t.ciphersuite != m.Ciphersuite {
+		return fmt.Errorf("tree uses ciphersuite 0x%04x, not 0x%04x", uint16(m.Ciphersuite), uint16(t.ciphersuite))
+	}
+	if m.Ciphersuite != 0 {
+		t.ciphersuite = m.Ciphersuite
+	}
+	if t.groupID != nil && m.GroupID != nil && !bytes.Equal(t.groupID, m.GroupID) {
+		return fmt.Errorf("tree belongs to group %x, not %x", m.GroupID, t.groupID)
+	}
+	if m.GroupID != nil {
+		t.groupID = m.GroupID
+	}
+	t.epoch, t.transcriptHash, t.groupExtensions = m.Epoch, m.TranscriptHash, m.Extensions
+	t.interimHash = m.InterimHash
+	t.successor = m.Successor
+	t.generations = m.Generations
+	t.manifestHead = m.Head
+	t.pinned = make(map[string]struct{}, len(m.Pinned))
+	for _, name := range m.Pinned {
+		t.pinned[name] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package memory provides a TreeKEM tree kept entirely in RAM
+package memory
+
+import "github.com/snowmerak/mls/lib/tree"
+
+// NewTree creates a tree that never touches the filesystem
+// Elements are neither encoded nor written, so Insert/Delete only pay for pointer updates
+func NewTree() *tree.Tree {
+	t, _ := tree.NewTreeWithStore(nil) // without options nothing can fail
+	return t
+}
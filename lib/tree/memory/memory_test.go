@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"testing"
+)
+
+func TestMemoryTreeOperations(t *testing.T) {
+	tr := NewTree()
+
+	users := []string{"alice", "bob", "charlie", "david"}
+	for _, user := range users {
+		if err := tr.Insert(user, []byte(user+"_public_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	if got := len(tr.GetLeaves()); got != len(users) {
+		t.Fatalf("expected %d leaves, got %d", len(users), got)
+	}
+
+	path, err := tr.GetPath("charlie")
+	if err != nil {
+		t.Fatalf("Failed to get path: %v", err)
+	}
+	if path[0] != tr.Head() {
+		t.Errorf("path should start at the root")
+	}
+
+	if err := tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+	if string(tr.GetGroupPublicKey()) != "root_key" {
+		t.Errorf("unexpected group public key: %q", tr.GetGroupPublicKey())
+	}
+
+	if err := tr.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+	if _, ok := tr.Find("bob"); ok {
+		t.Errorf("bob should be gone after deletion")
+	}
+	if got := tr.MemberCount(); got != len(users)-1 {
+		t.Errorf("expected %d members after deletion, got %d", len(users)-1, got)
+	}
+}
@@ -0,0 +1,65 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Merge fuses the groups of a and b into a new tree persisted to store, nil keeping it
+// in memory. The members of a come first, then those of b, each keeping its name, key
+// and leaf node; blank leaves are dropped and leaf indices are assigned afresh. Every
+// intermediate node is blank, so the first commit of the fused group must carry an
+// UpdatePath from which members derive new keys, and members replace their leaf nodes,
+// signed for the old groups, with their next update. The trees must share a ciphersuite,
+// which the new tree takes unless opts say otherwise, and no member may be in both
+func Merge(a, b *Tree, store Store, opts ...Option) (*Tree, error) {
+	if a.ciphersuite != b.ciphersuite {
+		return nil, fmt.Errorf("cannot merge trees of ciphersuites %#04x and %#04x", a.ciphersuite, b.ciphersuite)
+	}
+	var members []*Element
+	seen := make(map[string]bool)
+	for _, leaf := range append(a.GetLeaves(), b.GetLeaves()...) {
+		if key, err := leaf.Key(); err != nil {
+			return nil, fmt.Errorf("cannot merge %s: %w", leaf.name, err)
+		} else if len(key) == 0 {
+			continue
+		}
+		if seen[leaf.name] {
+			return nil, fmt.Errorf("cannot merge trees both holding %s", leaf.name)
+		}
+		seen[leaf.name] = true
+		members = append(members, leaf)
+	}
+
+	return buildMembers(members, a.ciphersuite, store, opts)
+}
+
+// buildMembers builds a new tree holding members in order under blank intermediates,
+// persisted to store
+func buildMembers(members []*Element, cs Ciphersuite, store Store, opts []Option) (*Tree, error) {
+	if cs != 0 {
+		opts = append([]Option{WithCiphersuite(cs)}, opts...)
+	}
+	built, err := LoadTreeFromStore(store, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if built.head != nil {
+		return nil, errors.New("store already holds a tree")
+	}
+	for _, member := range members {
+		key := member.PublicKey()
+		if key.Algorithm == KeyAlgorithmUnknown {
+			key, err = built.checkKey(key.Data)
+		} else if built.ciphersuite != 0 {
+			err = built.checkTypedKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", member.name, err)
+		}
+		if err := built.insert(member.name, key, member.leafNode); err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", member.name, err)
+		}
+	}
+	return built, nil
+}
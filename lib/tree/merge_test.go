@@ -0,0 +1,76 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	build := func(names ...string) *Tree {
+		tr, _ := NewTreeWithStore(nil)
+		for _, name := range names {
+			if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+				t.Fatalf("Failed to insert %s: %v", name, err)
+			}
+		}
+		return tr
+	}
+	a := build("alice", "bob", "charlie")
+	if err := a.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	b := build("dave", "eve", "frank")
+	if err := b.Blank("eve"); err != nil {
+		t.Fatalf("Failed to blank eve: %v", err)
+	}
+
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	merged, err := Merge(a, b, store)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	want := []string{"alice", "bob", "charlie", "dave", "frank"}
+	if got := leafNames(merged); !slices.Equal(got, want) {
+		t.Errorf("merged leaves = %v, want %v", got, want)
+	}
+	for i, leaf := range merged.GetLeaves() {
+		if leaf.LeafIndex() != i {
+			t.Errorf("%s has leaf index %d, want %d", leaf.Name(), leaf.LeafIndex(), i)
+		}
+		if string(leaf.Value()) != leaf.Name()+"_key" {
+			t.Errorf("%s lost its key", leaf.Name())
+		}
+	}
+	for _, element := range merged.GetAllElements() {
+		if !element.IsLeaf() && (len(element.Value()) > 0 || len(element.UnmergedLeaves()) > 0) {
+			t.Errorf("intermediate %s should be blank", element.Name())
+		}
+	}
+	if !merged.CheckBalance().Balanced() {
+		t.Errorf("merged tree should be left-balanced")
+	}
+	checkNodeLinks(t, merged)
+	if len(a.Head().Value()) == 0 || len(leafNames(a)) != 3 {
+		t.Errorf("merging should not change the source trees")
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload merged tree: %v", err)
+	}
+	if !reloaded.Equal(merged) {
+		t.Errorf("reloaded merged tree differs: %v", reloaded.StructuralDiff(merged))
+	}
+
+	if _, err := Merge(a, build("alice"), nil); err == nil {
+		t.Errorf("merging trees sharing a member should fail")
+	}
+	otherSuite, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	if _, err := Merge(a, otherSuite, nil); err == nil {
+		t.Errorf("merging trees of different ciphersuites should fail")
+	}
+	if _, err := Merge(a, b, store); err == nil {
+		t.Errorf("merging into a store holding a tree should fail")
+	}
+}
@@ -0,0 +1,335 @@
+package tree
+
+import (
+	"errors"
+	"testing"
+)
+
+// checkNodeLinks verifies every element is laid out at its node index and linked to its parent
+func checkNodeLinks(t *testing.T, tr *Tree) {
+	t.Helper()
+	elements := tr.GetAllElements()
+	if len(elements) != len(tr.nodes) {
+		t.Fatalf("tree has %d elements but %d node indices", len(elements), len(tr.nodes))
+	}
+	for _, element := range elements {
+		if got := tr.GetNodeByIndex(element.NodeIndex()); got != element {
+			t.Errorf("node %d should be %s", element.NodeIndex(), element.Name())
+		}
+		for _, child := range []*Element{element.LeftChild(), element.RightChild()} {
+			if child != nil && (child.Parent() != element || child.ParentIndex() != element.NodeIndex()) {
+				t.Errorf("%s should have parent %s", child.Name(), element.Name())
+			}
+		}
+	}
+	if head := tr.Head(); head != nil && (head.Parent() != nil || head.ParentIndex() != -1 || head.SiblingIndex() != -1) {
+		t.Errorf("root should have neither parent nor sibling")
+	}
+}
+
+// rfcParent is parent(x, n) of RFC 9420 appendix C, -1 for the root
+func rfcParent(x, n int) int {
+	if x == mlsRoot(n) {
+		return -1
+	}
+	step := func(x int) int {
+		k := mlsLevel(x)
+		b := (x >> (k + 1)) & 1
+		return (x | 1<<k) ^ b<<(k+1)
+	}
+	p := step(x)
+	for p >= mlsNodeWidth(n) {
+		p = step(p)
+	}
+	return p
+}
+
+func TestNodeLayout(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	if tr.GetNodeByIndex(0) != nil {
+		t.Errorf("empty tree should have no node 0")
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		checkNodeLinks(t, tr)
+	}
+	if tr.GetNodeByIndex(-1) != nil || tr.GetNodeByIndex(len(tr.nodes)) != nil {
+		t.Errorf("indices outside the tree should find nothing")
+	}
+
+	// Indices are RFC 9420 array indices even when the leaves do not fill a level
+	leaves := tr.GetLeaves()
+	for i, leaf := range leaves {
+		if leaf.NodeIndex() != 2*i {
+			t.Errorf("leaf %d should be node %d, got %d", i, 2*i, leaf.NodeIndex())
+		}
+	}
+	for _, element := range tr.GetAllElements() {
+		if got, want := element.ParentIndex(), rfcParent(element.NodeIndex(), len(leaves)); got != want {
+			t.Errorf("node %d should have parent %d, got %d", element.NodeIndex(), want, got)
+		}
+	}
+	for _, leaf := range leaves {
+		parent := leaf.Parent()
+		sibling := leaf.Sibling()
+		if sibling == nil || sibling.Parent() != parent || leaf.SiblingIndex() != sibling.NodeIndex() {
+			t.Errorf("%s should have a sibling under the same parent", leaf.Name())
+		}
+		if leaf.IsLeftChild() == leaf.IsRightChild() {
+			t.Errorf("%s should be exactly one of left or right child", leaf.Name())
+		}
+		if leaf.LeftChildIndex() != -1 || leaf.RightChildIndex() != -1 {
+			t.Errorf("leaf %s should have no child indices", leaf.Name())
+		}
+		if parent.LeftChildIndex() != parent.LeftChild().NodeIndex() {
+			t.Errorf("%s should report its left child's index", parent.Name())
+		}
+	}
+
+	path, err := tr.GetPath("eve")
+	if err != nil {
+		t.Fatalf("Failed to get path: %v", err)
+	}
+	if path[0] != tr.Head() || path[len(path)-1].Name() != "eve" {
+		t.Errorf("path should run from the root to eve")
+	}
+	for i := 1; i < len(path); i++ {
+		if path[i].Parent() != path[i-1] {
+			t.Errorf("path should follow parent links")
+		}
+	}
+
+	if err := tr.Delete("eve"); err != nil {
+		t.Fatalf("Failed to delete eve: %v", err)
+	}
+	checkNodeLinks(t, tr)
+	if err := tr.Delete("alice"); err != nil {
+		t.Fatalf("Failed to delete alice: %v", err)
+	}
+	checkNodeLinks(t, tr)
+}
+
+func TestFindIndex(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	if _, found := tr.Find("alice"); found {
+		t.Errorf("empty tree should find nothing")
+	}
+	names := []string{"alice", "bob", "charlie", "dave", "eve"}
+	for _, name := range names {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	checkFind := func(stage string) {
+		t.Helper()
+		for _, element := range tr.GetAllElements() {
+			if got, found := tr.Find(element.Name()); !found || got != element {
+				t.Errorf("%s: %s should be found", stage, element.Name())
+			}
+		}
+	}
+	checkFind("insert")
+
+	bob, _ := tr.Find("bob")
+	if err := tr.Blank("bob"); err != nil {
+		t.Fatalf("Failed to blank bob: %v", err)
+	}
+	if _, found := tr.Find("bob"); found {
+		t.Errorf("blanked names should no longer be found")
+	}
+	checkFind("blank")
+	if err := tr.Insert("frank", []byte("frank_key")); err != nil {
+		t.Fatalf("Failed to insert frank: %v", err)
+	}
+	if frank, _ := tr.Find("frank"); frank != bob {
+		t.Errorf("frank should be found in bob's former slot")
+	}
+	checkFind("fill")
+
+	// Deleting renames intermediates
+	if err := tr.Delete("charlie"); err != nil {
+		t.Fatalf("Failed to delete charlie: %v", err)
+	}
+	if _, found := tr.Find("charlie"); found {
+		t.Errorf("deleted names should no longer be found")
+	}
+	checkFind("delete")
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if dave, found := reloaded.Find("dave"); !found || dave.Name() != "dave" {
+		t.Errorf("loaded trees should index their names")
+	}
+	if err := tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")); err != nil {
+		t.Errorf("intermediates should be found by name: %v", err)
+	}
+}
+
+func TestInsertRejectsExistingName(t *testing.T) {
+	tr, err := NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		tr.Insert(name, []byte(name+"_key"))
+	}
+
+	if err := tr.Insert("a", []byte("other_key")); !errors.Is(err, ErrExists) {
+		t.Errorf("Insert: expected ErrExists, got %v", err)
+	}
+	if err := tr.Insert(tr.Head().Name(), []byte("other_key")); !errors.Is(err, ErrExists) {
+		t.Errorf("Insert: intermediate names should be taken too, got %v", err)
+	}
+	if err := tr.Rename("b", "c"); !errors.Is(err, ErrExists) {
+		t.Errorf("Rename: expected ErrExists, got %v", err)
+	}
+	if leaves := tr.GetLeaves(); len(leaves) != 3 {
+		t.Errorf("expected 3 leaves, got %d", len(leaves))
+	}
+	if a, _ := tr.Find("a"); string(a.Value()) != "a_key" {
+		t.Errorf("a should keep its key, got %q", a.Value())
+	}
+	if report := tr.Validate(); len(report.Of(InvariantUniqueNames)) != 0 {
+		t.Errorf("unexpected name violations: %v", report.Err())
+	}
+
+	c, _ := tr.Find("c")
+	c.name = "a"
+	if report := tr.Validate(); len(report.Of(InvariantUniqueNames)) != 1 {
+		t.Errorf("expected one unique_names violation, got %v", report.Violations)
+	}
+}
+
+func TestIntermediateNamesAreStable(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve", "frank"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	names := make(map[*Element]string)
+	for _, element := range tr.GetAllElements() {
+		if element.nodeType == "intermediate" {
+			names[element] = element.Name()
+		}
+	}
+
+	// Restructuring moves nodes to other indices but never renames them
+	spliceOut(t, tr, "bob")
+	if _, err := tr.Rebalance(); err != nil {
+		t.Fatalf("Failed to rebalance: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, element := range tr.GetAllElements() {
+		if seen[element.Name()] {
+			t.Errorf("name %s is used twice", element.Name())
+		}
+		seen[element.Name()] = true
+		if name, ok := names[element]; ok && element.Name() != name {
+			t.Errorf("intermediate %s was renamed to %s", name, element.Name())
+		}
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if !reloaded.Equal(tr) {
+		t.Errorf("reloaded tree differs: %v", reloaded.StructuralDiff(tr))
+	}
+}
+
+func TestNodeIndicesSurviveAppendAndTruncate(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	indices := make(map[string]int)
+	for i := 0; i < 7; i++ {
+		name := string(rune('a' + i))
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	for _, element := range tr.GetAllElements() {
+		indices[element.Name()] = element.NodeIndex()
+	}
+
+	if err := tr.Insert("h", []byte("h_key")); err != nil {
+		t.Fatalf("Failed to insert h: %v", err)
+	}
+	checkNodeLinks(t, tr)
+	for name, index := range indices {
+		if node, _ := tr.Find(name); node.NodeIndex() != index {
+			t.Errorf("append moved %s from %d to %d", name, index, node.NodeIndex())
+		}
+	}
+	if h, _ := tr.Find("h"); h.NodeIndex() != 14 || h.ParentIndex() != 13 {
+		t.Errorf("h should be node 14 under 13, got %d under %d", h.NodeIndex(), h.ParentIndex())
+	}
+
+	for _, name := range []string{"h", "g"} {
+		if err := tr.Delete(name); err != nil {
+			t.Fatalf("Failed to delete %s: %v", name, err)
+		}
+	}
+	checkNodeLinks(t, tr)
+	if got := len(tr.GetLeaves()); got != 6 {
+		t.Fatalf("expected the blank right edge to be truncated to 6 leaves, got %d", got)
+	}
+	for _, element := range tr.GetAllElements() {
+		if index, ok := indices[element.Name()]; ok && element.NodeIndex() != index {
+			t.Errorf("truncation moved %s from %d to %d", element.Name(), index, element.NodeIndex())
+		}
+		if got, want := element.ParentIndex(), rfcParent(element.NodeIndex(), 6); got != want {
+			t.Errorf("node %d should have parent %d, got %d", element.NodeIndex(), want, got)
+		}
+	}
+}
+
+func TestMemberOperationsDoNotRenumber(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	// A snapshot makes the tree track changes, which a renumbering pass resets
+	tr.Snapshot()
+	renumbered := func(step string) {
+		t.Helper()
+		if tr.dirty == nil {
+			t.Fatalf("%s renumbered the whole tree", step)
+		}
+		checkNodeLinks(t, tr)
+	}
+
+	for i := 0; i < 9; i++ {
+		name := string(rune('a' + i))
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		renumbered("insert " + name)
+	}
+	steps := []struct {
+		name string
+		op   func() error
+	}{
+		{"delete middle", func() error { return tr.Delete("c") }},
+		{"refill", func() error { return tr.Insert("j", []byte("j_key")) }},
+		{"delete last", func() error { return tr.Delete("i") }},
+		{"delete batch", func() error { return tr.DeleteBatch([]string{"e", "h"}) }},
+		{"blank path", func() error { _, err := tr.BlankPath("a"); return err }},
+		{"set key", func() error { return tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")) }},
+	}
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		renumbered(step.name)
+	}
+}
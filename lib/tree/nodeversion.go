@@ -0,0 +1,21 @@
+package tree
+
+import "errors"
+
+// ErrVersionConflict is returned when a node changed since the version the caller read
+var ErrVersionConflict = errors.New("node version conflict")
+
+// Version returns the node version, advanced by every change to the node and persisted
+// with it. Unlike the tree version it only moves when this node changes, so clients
+// can detect concurrent updates to the nodes they computed keys for
+func (e *Element) Version() uint64 {
+	return e.version
+}
+
+// SetIntermediateNodeKeyIfVersion sets the key of an intermediate node like
+// SetIntermediateNodeKey, but only while the node is still at version expected, as read
+// from Element.Version or NodeInfo.Version. Otherwise it fails with ErrVersionConflict
+// and the caller should re-read the node and recompute the key
+func (t *Tree) SetIntermediateNodeKeyIfVersion(nodeName string, publicKey []byte, expected uint64) error {
+	return t.setIntermediateNodeKey(nodeName, publicKey, &expected)
+}
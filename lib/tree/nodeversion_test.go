@@ -0,0 +1,78 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSetIntermediateNodeKeyIfVersion(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	root := tr.Head()
+	read := root.Version()
+	if info := root.Info(); info.Version != read {
+		t.Errorf("NodeInfo version = %d, want %d", info.Version, read)
+	}
+
+	// Two clients read the same version; the first write wins
+	if err := tr.SetIntermediateNodeKeyIfVersion(root.Name(), []byte("first_key"), read); err != nil {
+		t.Fatalf("Failed to set key at the current version: %v", err)
+	}
+	if root.Version() <= read {
+		t.Errorf("version should advance, got %d after %d", root.Version(), read)
+	}
+	err = tr.SetIntermediateNodeKeyIfVersion(root.Name(), []byte("second_key"), read)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale write should conflict, got %v", err)
+	}
+	if !bytes.Equal(root.Value(), []byte("first_key")) {
+		t.Errorf("a conflicting write must not change the key, got %q", root.Value())
+	}
+
+	// Versions only move with their own node
+	alice, _ := tr.Find("alice")
+	before := alice.Version()
+	if err := tr.SetIntermediateNodeKey(root.Name(), []byte("third_key")); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if alice.Version() != before {
+		t.Errorf("alice version changed from %d to %d", before, alice.Version())
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got := reloaded.Head().Version(); got != root.Version() {
+		t.Errorf("reloaded version = %d, want %d", got, root.Version())
+	}
+	if err := reloaded.SetIntermediateNodeKeyIfVersion(root.Name(), []byte("fourth_key"), root.Version()); err != nil {
+		t.Errorf("the persisted version should be accepted: %v", err)
+	}
+}
+
+func TestNodeVersionEncodings(t *testing.T) {
+	for _, format := range []elementFormat{formatJSON, formatBinary, formatFlatBuffers} {
+		data := elementData{Name: "node", NodeType: "intermediate", Version: 42}
+		encoded, err := encodeElementData(data, format)
+		if err != nil {
+			t.Fatalf("format %d: failed to encode: %v", format, err)
+		}
+		decoded, err := decodeElementData(encoded)
+		if err != nil {
+			t.Fatalf("format %d: failed to decode: %v", format, err)
+		}
+		if decoded.Version != 42 {
+			t.Errorf("format %d: version = %d, want 42", format, decoded.Version)
+		}
+	}
+}
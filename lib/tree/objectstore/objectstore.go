@@ -0,0 +1,100 @@
+// Package objectstore persists TreeKEM trees in S3-compatible object storage
+//
+// Every element is stored as its own object and the tree manifest object records
+// the root element, so a serverless deployment can reopen a tree from the bucket alone.
+// The package does not import an SDK; adapt the application's S3 client to Bucket.
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Bucket is the subset of an S3-compatible API the store needs
+type Bucket interface {
+	PutObject(ctx context.Context, key string, data []byte) error
+	// GetObject must return an error satisfying errors.Is(err, fs.ErrNotExist) for missing keys
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// Store keeps the elements of one tree under a key prefix
+type Store struct {
+	bucket  Bucket
+	prefix  string
+	timeout time.Duration
+}
+
+var _ tree.Store = (*Store)(nil)
+
+// NewStore creates a store writing objects below prefix, e.g. "groups/<id>"
+func NewStore(bucket Bucket, prefix string) *Store {
+	return &Store{
+		bucket:  bucket,
+		prefix:  prefix,
+		timeout: 30 * time.Second,
+	}
+}
+
+// NewTree returns an empty tree stored below prefix
+func NewTree(bucket Bucket, prefix string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store := NewStore(bucket, prefix)
+	t, err := tree.NewTreeWithStore(store, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// OpenTree loads the tree stored below prefix using the root recorded in its manifest object
+func OpenTree(bucket Bucket, prefix string, opts ...tree.Option) (*tree.Tree, *Store, error) {
+	store := NewStore(bucket, prefix)
+	t, err := tree.LoadTreeFromStore(store, "", opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Key maps an element name to its object key
+func (s *Store) Key(name string) string {
+	return path.Join(s.prefix, "nodes", name+".json")
+}
+
+// Write uploads an element object
+func (s *Store) Write(key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.bucket.PutObject(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Read downloads an element object
+func (s *Store) Read(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	data, err := s.bucket.GetObject(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Remove deletes an element object
+func (s *Store) Remove(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.bucket.DeleteObject(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
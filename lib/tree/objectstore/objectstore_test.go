@@ -0,0 +1,69 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// memoryBucket is an in-process stand-in for an S3 bucket
+type memoryBucket map[string][]byte
+
+func (b memoryBucket) PutObject(_ context.Context, key string, data []byte) error {
+	b[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b memoryBucket) GetObject(_ context.Context, key string) ([]byte, error) {
+	data, ok := b[key]
+	if !ok {
+		return nil, fmt.Errorf("no such key %s: %w", key, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (b memoryBucket) DeleteObject(_ context.Context, key string) error {
+	delete(b, key)
+	return nil
+}
+
+func TestObjectStoreReopenFromManifest(t *testing.T) {
+	bucket := memoryBucket{}
+	tr, _, _ := NewTree(bucket, "groups/demo")
+
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	if err := tr.Delete("alice"); err != nil {
+		t.Fatalf("Failed to delete alice: %v", err)
+	}
+
+	for key := range bucket {
+		if !strings.HasPrefix(key, "groups/demo/nodes/") {
+			t.Errorf("object written outside the tree prefix: %s", key)
+		}
+	}
+
+	reopened, _, err := OpenTree(bucket, "groups/demo")
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+	if reopened.Head() == nil || reopened.Head().Name() != tr.Head().Name() {
+		t.Fatalf("reopened tree has a different root")
+	}
+	if got := reopened.MemberCount(); got != 3 {
+		t.Errorf("expected 3 members after reopen, got %d", got)
+	}
+
+	empty, _, err := OpenTree(bucket, "groups/missing")
+	if err != nil {
+		t.Fatalf("Failed to open missing tree: %v", err)
+	}
+	if empty.Head() != nil {
+		t.Errorf("expected empty tree for a missing prefix")
+	}
+}
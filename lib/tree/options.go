@@ -0,0 +1,12 @@
+package tree
+
+// Option configures optional Tree behaviour
+type Option func(*Tree)
+
+// applyOptions applies opts to the tree in order and reports the first option error
+func (t *Tree) applyOptions(opts []Option) error {
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t.optionErr
+}
@@ -0,0 +1,219 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// ErrParentHashMismatch is returned when a parent node is not covered by a valid parent hash chain
+var ErrParentHashMismatch = errors.New("parent hash mismatch")
+
+// ParentHash returns the RFC 9420 parent hash recorded for the node
+// Intermediates get theirs from SetPathKeys; a leaf's is the one in its commit leaf node,
+// or the value computed by SetPathKeys for bare-key leaves
+func (e *Element) ParentHash() []byte {
+	e.unshelve()
+	if e.leafNode != nil {
+		return e.leafNode.ParentHash
+	}
+	return e.parentHash
+}
+
+// TreeHash returns the RFC 9420 style tree hash of the whole tree
+// Unlike StructureHash it covers leaf nodes and parent hashes, which is what parent
+// hashes bind to
+func (t *Tree) TreeHash() []byte {
+	return treeHash(t.head, 0)
+}
+
+// treeHash hashes a subtree following the TreeHashInput layout of RFC 9420 section 7.8
+// first is the position of the subtree's leftmost leaf; leaves are numbered left to right
+// as in ExportRatchetTree. Bare-key leaves hash their key in place of a leaf node
+func treeHash(node *Element, first int) []byte {
+	w := &tls.Writer{}
+	switch {
+	case node == nil:
+		w.Uint8(0)
+	case node.IsLeaf():
+		w.Uint8(mlsNodeTypeLeaf)
+		w.Uint32(uint32(first))
+		w.Opaque(node.key())
+		w.Opaque(encodeLeafNode(node.LeafNode()))
+	default:
+		w.Uint8(mlsNodeTypeParent)
+		w.Opaque(node.key())
+		w.Opaque(node.ParentHash())
+		w.Opaque(treeHash(node.leftChild, first))
+		w.Opaque(treeHash(node.rightChild, first+countLeaves(node.leftChild)))
+	}
+	sum := sha256.Sum256(w.Buf)
+	return sum[:]
+}
+
+// hashParentInput hashes a ParentHashInput from RFC 9420 section 7.9
+func hashParentInput(key, parentHash, siblingTreeHash []byte) []byte {
+	w := &tls.Writer{}
+	w.Opaque(key)
+	w.Opaque(parentHash)
+	w.Opaque(siblingTreeHash)
+	sum := sha256.Sum256(w.Buf)
+	return sum[:]
+}
+
+// siblingOf returns the child of parent opposite child and the position of its leftmost
+// leaf, given first for parent
+func siblingOf(parent, child *Element, first int) (*Element, int) {
+	if child == parent.leftChild {
+		return parent.rightChild, first + countLeaves(parent.leftChild)
+	}
+	return parent.leftChild, first
+}
+
+// computeParentHash hashes the ParentHashInput of parent as seen from child
+// first is the position of parent's leftmost leaf
+func computeParentHash(parent, child *Element, first int) []byte {
+	sibling, siblingFirst := siblingOf(parent, child, first)
+	return hashParentInput(parent.key(), parent.ParentHash(), treeHash(sibling, siblingFirst))
+}
+
+// pathParentHashes returns the parent hashes the nodes below the root of path, which
+// runs root to leaf, get when its parents take keys, given nearest the leaf first
+// Entry i belongs to path[i+1], so the last one is the leaf's
+func pathParentHashes(path []*Element, keys [][]byte) [][]byte {
+	parents := path[:len(path)-1]
+	hashes := make([][]byte, len(parents))
+	var above []byte // the root's parent hash is empty
+	first := 0
+	for i, parent := range parents {
+		sibling, siblingFirst := siblingOf(parent, path[i+1], first)
+		if path[i+1] == parent.rightChild {
+			first += countLeaves(parent.leftChild)
+		}
+		above = hashParentInput(keys[len(parents)-1-i], above, treeHash(sibling, siblingFirst))
+		hashes[i] = above
+	}
+	return hashes
+}
+
+// PathParentHash returns the parent hash leaf's commit leaf node must carry once its direct
+// path takes keys, nearest the leaf first, without changing the tree
+// A committer calls it before SetPathKeys to sign its new leaf node
+func (t *Tree) PathParentHash(leafName string, keys [][]byte) ([]byte, error) {
+	path, err := t.GetPath(leafName)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != len(path)-1 {
+		return nil, fmt.Errorf("direct path of %s has %d nodes, got %d keys", leafName, len(path)-1, len(keys))
+	}
+	hashes := pathParentHashes(path, keys)
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	return hashes[len(hashes)-1], nil
+}
+
+// SetPathKeys replaces the keys of every intermediate node on leaf's direct path, nearest
+// the leaf first, and recomputes their parent hashes from the root down
+// It returns the parent hash the member's next commit leaf node must carry. Bare-key
+// leaves take it directly; leaves with a leaf node keep their old one until UpdateLeafNode
+func (t *Tree) SetPathKeys(leafName string, keys [][]byte) (leafParentHash []byte, err error) {
+	if err := t.checkWritable("set path keys"); err != nil {
+		return nil, err
+	}
+	end := t.startOp("set_path_keys", leafName)
+	defer func() { end(err) }()
+
+	path, err := t.GetPath(leafName)
+	if err != nil {
+		return nil, err
+	}
+	leaf := path[len(path)-1]
+	if !leaf.IsLeaf() {
+		return nil, fmt.Errorf("%s is not a leaf", leafName)
+	}
+	parents := path[:len(path)-1]
+	if len(keys) != len(parents) {
+		return nil, fmt.Errorf("direct path of %s has %d nodes, got %d keys", leafName, len(parents), len(keys))
+	}
+	parsed := make([]PublicKey, len(keys))
+	stored := make([][]byte, len(keys))
+	for i, key := range keys {
+		if parsed[i], err = t.checkKey(key); err != nil {
+			return nil, fmt.Errorf("failed to set key of %s: %w", parents[len(parents)-1-i].name, err)
+		}
+		stored[i] = parsed[i].Data
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	// Sibling subtrees are off the path, so the hashes can be taken before the keys change
+	hashes := pathParentHashes(path, stored)
+	for i, key := range parsed {
+		if err := t.setNodeKey(parents[len(parents)-1-i], key); err != nil {
+			return nil, err
+		}
+	}
+	if len(parents) > 0 {
+		parents[0].parentHash = nil
+	}
+	for i, hash := range hashes {
+		path[i+1].parentHash = hash
+	}
+	if len(hashes) > 0 {
+		leafParentHash = hashes[len(hashes)-1]
+	}
+	// A leaf node's own parent hash is signed, so it only changes with UpdateLeafNode,
+	// which checks a commit leaf node carries the recorded value
+
+	for _, node := range path {
+		node.MarkAsModified()
+		if err := node.saveToDisk(); err != nil {
+			return nil, fmt.Errorf("failed to save %s: %w", node.name, err)
+		}
+	}
+	return leafParentHash, nil
+}
+
+// ValidateParentHashes checks every non-blank intermediate node is vouched for by a child
+// RFC 9420 section 7.9.2 requires a parent P to have a descendant D, reached through
+// blank nodes only, whose parent hash is the hash of P seen from D's side. Intermediates
+// without a key are blank. A tree whose parents were all set by SetPathKeys validates;
+// keys set any other way, or a tampered subtree, do not
+func (t *Tree) ValidateParentHashes() error {
+	var check func(node *Element, first int) error
+	check = func(node *Element, first int) error {
+		if node == nil || node.IsLeaf() {
+			return nil
+		}
+		if len(node.key()) > 0 && !t.parentHashCovered(node, first) {
+			return fmt.Errorf("%w: %s", ErrParentHashMismatch, node.name)
+		}
+		if err := check(node.leftChild, first); err != nil {
+			return err
+		}
+		return check(node.rightChild, first+countLeaves(node.leftChild))
+	}
+	return check(t.head, 0)
+}
+
+// parentHashCovered reports whether a descendant of parent carries its parent hash
+func (t *Tree) parentHashCovered(parent *Element, first int) bool {
+	for _, child := range []*Element{parent.leftChild, parent.rightChild} {
+		if child == nil {
+			continue
+		}
+		want := computeParentHash(parent, child, first)
+		for _, candidate := range t.resolution(child) {
+			if bytes.Equal(candidate.ParentHash(), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
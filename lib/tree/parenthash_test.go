@@ -0,0 +1,135 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+// testPathKeys returns fresh X25519 keys for n direct-path nodes
+func testPathKeys(t *testing.T, n int) [][]byte {
+	t.Helper()
+	keys := make([][]byte, n)
+	for i := range keys {
+		private, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate path key: %v", err)
+		}
+		keys[i] = private.PublicKey().Bytes()
+	}
+	return keys
+}
+
+// testCommitLeafNode returns a commit leaf node for name carrying parentHash
+func testCommitLeafNode(t *testing.T, tr *Tree, name string, parentHash []byte) *LeafNode {
+	t.Helper()
+	leaf, signer := newTestLeafNode(t, name)
+	leaf.Source = LeafNodeSourceCommit
+	leaf.Lifetime = Lifetime{}
+	leaf.ParentHash = parentHash
+	element, _ := tr.Find(name)
+	if err := leaf.Sign(signer, tr.GroupID(), uint32(element.LeafIndex())); err != nil {
+		t.Fatalf("Failed to sign commit leaf node: %v", err)
+	}
+	return leaf
+}
+
+func TestParentHashChain(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.ValidateParentHashes(); err != nil {
+		t.Fatalf("tree of blank parents should validate: %v", err)
+	}
+
+	path, _ := tr.GetPath("alice")
+	if _, err := tr.SetPathKeys("alice", testPathKeys(t, len(path))); err == nil {
+		t.Errorf("key count must match the direct path")
+	}
+	parentHash, err := tr.SetPathKeys("alice", testPathKeys(t, len(path)-1))
+	if err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if len(path[0].ParentHash()) != 0 {
+		t.Errorf("root should have an empty parent hash")
+	}
+	if err := tr.ValidateParentHashes(); !errors.Is(err, ErrParentHashMismatch) {
+		t.Errorf("chain should be broken until the committer's leaf carries the parent hash, got %v", err)
+	}
+
+	if err := tr.UpdateLeafNode("alice", testCommitLeafNode(t, tr, "alice", []byte("wrong"))); !errors.Is(err, ErrParentHashMismatch) {
+		t.Errorf("commit leaf with the wrong parent hash should be rejected, got %v", err)
+	}
+	if err := tr.UpdateLeafNode("alice", testCommitLeafNode(t, tr, "alice", parentHash)); err != nil {
+		t.Fatalf("Failed to update committer leaf: %v", err)
+	}
+	if err := tr.ValidateParentHashes(); err != nil {
+		t.Fatalf("path update should validate: %v", err)
+	}
+
+	// Ratchet tree export carries parent hashes
+	data, _ := tr.ExportRatchetTree()
+	imported, err := ImportRatchetTree(data, nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+	if err := imported.ValidateParentHashes(); err != nil {
+		t.Errorf("imported tree should keep a valid chain: %v", err)
+	}
+
+	// Tampering with a sibling subtree or a path key breaks the chain
+	tampered, _ := NewTreeWithStore(nil)
+	blank, _ := NewTreeWithStore(nil)
+	tampered.ApplyPatch(blank.Diff(tr))
+	if err := tampered.ValidateParentHashes(); err != nil {
+		t.Fatalf("patched copy should validate: %v", err)
+	}
+	bob, _ := tampered.Find("bob")
+	tampered.setNodeKey(bob, PublicKey{Data: testPathKeys(t, 1)[0]})
+	if err := tampered.ValidateParentHashes(); !errors.Is(err, ErrParentHashMismatch) {
+		t.Errorf("swapping a key in the sibling subtree should break the chain, got %v", err)
+	}
+	if err := tr.SetIntermediateNodeKey(path[1].Name(), testPathKeys(t, 1)[0]); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := tr.ValidateParentHashes(); !errors.Is(err, ErrParentHashMismatch) {
+		t.Errorf("replaced path key should break the chain, got %v", err)
+	}
+}
+
+func TestParentHashPersists(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"json":        func(*Tree) {},
+		"binary":      WithBinaryEncoding(),
+		"flatbuffers": WithFlatBufferEncoding(),
+	} {
+		files, _ := NewFileStore(t.TempDir())
+		tr, _ := NewTreeWithStore(files, opt)
+		for _, leaf := range []string{"alice", "bob", "charlie"} {
+			tr.Insert(leaf, []byte(leaf+"_key"))
+		}
+		path, _ := tr.GetPath("charlie")
+		if _, err := tr.SetPathKeys("charlie", testPathKeys(t, len(path)-1)); err != nil {
+			t.Fatalf("%s: failed to set path keys: %v", name, err)
+		}
+		if err := tr.ValidateParentHashes(); err != nil {
+			t.Fatalf("%s: bare-key committer should validate directly: %v", name, err)
+		}
+
+		loaded, err := LoadTreeFromStore(files, "")
+		if err != nil {
+			t.Fatalf("%s: failed to load tree: %v", name, err)
+		}
+		if err := loaded.ValidateParentHashes(); err != nil {
+			t.Errorf("%s: parent hashes should survive a reload: %v", name, err)
+		}
+		if !bytes.Equal(loaded.TreeHash(), tr.TreeHash()) {
+			t.Errorf("%s: tree hash should survive a reload", name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pin marks a node as resident so caching layers never evict or unload it
+// Pins follow the node by name, so they stay on it as the tree grows, shrinks or is
+// rebalanced, and move with a renamed leaf. Pins are stored in the manifest and survive
+// restarts; deleting the node drops its pin. PinIndex pins by node index instead
+func (t *Tree) Pin(name string) error {
+	if err := t.checkWritable("pin"); err != nil {
+		return err
+	}
+	if _, ok := t.Find(name); !ok {
+		return fmt.Errorf("node not found: %s", name)
+	}
+	if t.pinned == nil {
+		t.pinned = make(map[string]struct{})
+	}
+	if _, ok := t.pinned[name]; ok {
+		return nil
+	}
+	t.pinned[name] = struct{}{}
+	return t.saveManifest()
+}
+
+// PinIndex pins the node at nodeIndex, its RFC 9420 node index, as Pin does
+// The pin is taken on the node found there now and follows it by name; it does not
+// stay at the index when a restructuring moves the node elsewhere
+func (t *Tree) PinIndex(nodeIndex int) error {
+	node := t.GetNodeByIndex(nodeIndex)
+	if node == nil {
+		return fmt.Errorf("node %d not found", nodeIndex)
+	}
+	return t.Pin(node.name)
+}
+
+// UnpinIndex unpins the node at nodeIndex
+func (t *Tree) UnpinIndex(nodeIndex int) error {
+	node := t.GetNodeByIndex(nodeIndex)
+	if node == nil {
+		return fmt.Errorf("node %d not found", nodeIndex)
+	}
+	return t.Unpin(node.name)
+}
+
+// Unpin allows a node to be evicted again
+func (t *Tree) Unpin(name string) error {
+	if err := t.checkWritable("unpin"); err != nil {
+		return err
+	}
+	if _, ok := t.pinned[name]; !ok {
+		return nil
+	}
+	delete(t.pinned, name)
+	return t.saveManifest()
+}
+
+// IsPinned reports whether a node is pinned
+func (t *Tree) IsPinned(name string) bool {
+	_, ok := t.pinned[name]
+	return ok
+}
+
+// PinnedNames returns the names of all pinned nodes in ascending order
+func (t *Tree) PinnedNames() []string {
+	names := make([]string, 0, len(t.pinned))
+	for name := range t.pinned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,161 @@
+package tree
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestPinsSurviveReload(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pin_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tree, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tree.Pin(name); err != nil {
+			t.Fatalf("Failed to pin %s: %v", name, err)
+		}
+	}
+	if err := tree.Unpin("charlie"); err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	if err := tree.Pin("nobody"); err == nil {
+		t.Errorf("expected an unknown node to be rejected")
+	}
+
+	loaded, err := LoadTree(tempDir, tree.Head().Name())
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	pinned := loaded.PinnedNames()
+	if len(pinned) != 2 || pinned[0] != "alice" || pinned[1] != "bob" {
+		t.Errorf("unexpected pins after reload: %v", pinned)
+	}
+	if loaded.IsPinned("charlie") {
+		t.Errorf("charlie should not be pinned")
+	}
+}
+
+func TestPinsFollowTheirNode(t *testing.T) {
+	tree, err := NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+	david, _ := tree.Find("david")
+	before := david.NodeIndex()
+	tree.Pin("david")
+	tree.Pin("charlie")
+	tree.Pin("bob")
+
+	// Taking alice out of the structure shifts the node indices to the right of that
+	// slot; pins stay put
+	spliceOut(t, tree, "alice")
+	if david.NodeIndex() == before {
+		t.Fatalf("expected david's node index to change from %d", before)
+	}
+	if !tree.IsPinned("david") {
+		t.Errorf("pin should follow david to node %d", david.NodeIndex())
+	}
+
+	if err := tree.Rename("charlie", "carol"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if !tree.IsPinned("carol") || tree.IsPinned("charlie") {
+		t.Errorf("pin should move with the rename, got %v", tree.PinnedNames())
+	}
+
+	// Deleting a node drops its pin, so a later member of that name is not pinned
+	if err := tree.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	tree.Insert("bob", []byte("bob_key"))
+	if tree.IsPinned("bob") {
+		t.Errorf("a new member must not inherit the pin of a deleted one")
+	}
+
+	loaded, _ := LoadTree(tree.rootPath, "")
+	if names := loaded.PinnedNames(); len(names) != 2 || names[0] != "carol" || names[1] != "david" {
+		t.Errorf("unexpected pins after reload: %v", names)
+	}
+}
+
+func TestPinIndexSurvivesRenumbering(t *testing.T) {
+	tree, err := NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+	david, _ := tree.Find("david")
+	before := david.NodeIndex()
+	if err := tree.PinIndex(before); err != nil {
+		t.Fatalf("Failed to pin node %d: %v", before, err)
+	}
+	if err := tree.PinIndex(tree.Head().NodeIndex()); err != nil {
+		t.Fatalf("Failed to pin the root: %v", err)
+	}
+	if err := tree.PinIndex(99); err == nil {
+		t.Errorf("expected an unknown index to be rejected")
+	}
+
+	// Renumbering moves david to another index; the pin goes with it
+	spliceOut(t, tree, "alice")
+	if david.NodeIndex() == before {
+		t.Fatalf("expected david's node index to change from %d", before)
+	}
+	if !tree.IsPinned("david") {
+		t.Errorf("pin should follow david to node %d", david.NodeIndex())
+	}
+	if moved := tree.GetNodeByIndex(before); moved != nil && moved != david && tree.IsPinned(moved.Name()) {
+		t.Errorf("%s took david's old index and must not inherit the pin", moved.Name())
+	}
+
+	if err := tree.UnpinIndex(david.NodeIndex()); err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	loaded, _ := LoadTree(tree.rootPath, "")
+	if names := loaded.PinnedNames(); len(names) != 1 || names[0] != tree.Head().Name() {
+		t.Errorf("unexpected pins after reload: %v", names)
+	}
+}
+
+func TestReservedNamesAreRejected(t *testing.T) {
+	tree, err := NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	tree.Insert("alice", []byte("alice_key"))
+
+	if err := tree.Insert("__manifest__", []byte("key")); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Insert: expected ErrReservedName, got %v", err)
+	}
+	if err := tree.Rename("alice", "__journal__"); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Rename: expected ErrReservedName, got %v", err)
+	}
+	if err := ValidateNodeInfos([]NodeInfo{{Name: "__manifest__", NodeType: "leaf", PublicKey: []byte("k")}}); err == nil {
+		t.Errorf("expected reserved node names to fail validation")
+	}
+
+	// The manifest is intact, so the tree still loads
+	loaded, err := LoadTree(tree.rootPath, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if _, ok := loaded.Find("alice"); !ok {
+		t.Errorf("alice not found after reload")
+	}
+}
@@ -0,0 +1,65 @@
+package tree
+
+import "fmt"
+
+// PlacementStep records one branching decision taken while inserting a leaf
+type PlacementStep struct {
+	NodeName    string // node the decision was made at
+	NodeIndex   int    // node index at decision time
+	LeftLeaves  int    // leaves counted in the left subtree
+	RightLeaves int    // leaves counted in the right subtree
+	Direction   string // "left" or "right"
+	Reason      string // why this direction was taken
+}
+
+// PlacementTrace explains where the last inserted leaf was placed and why
+type PlacementTrace struct {
+	Leaf      string          // name of the inserted leaf
+	Steps     []PlacementStep // decisions from the root down
+	SplitLeaf string          // existing leaf that was split to make room, if any
+	Extended  bool            // the tree was full and grew a new root
+	Result    string          // summary of the final placement
+}
+
+// WithPlacementTrace records a PlacementTrace for every Insert
+func WithPlacementTrace() Option {
+	return func(t *Tree) {
+		t.tracePlacement = true
+	}
+}
+
+// LastPlacementTrace returns the trace of the most recent Insert
+// It returns nil unless the tree was created with WithPlacementTrace
+func (t *Tree) LastPlacementTrace() *PlacementTrace {
+	return t.lastPlacement
+}
+
+// String renders the trace one decision per line
+func (p *PlacementTrace) String() string {
+	s := fmt.Sprintf("placement of %s:", p.Leaf)
+	for _, step := range p.Steps {
+		s += fmt.Sprintf("\n  at %s (index %d): left=%d right=%d -> %s (%s)",
+			step.NodeName, step.NodeIndex, step.LeftLeaves, step.RightLeaves, step.Direction, step.Reason)
+	}
+	return s + "\n  " + p.Result
+}
+
+// recordStep appends a decision to the trace if tracing is enabled
+func (p *PlacementTrace) recordStep(node *Element, leftLeaves, rightLeaves int, direction string) {
+	if p == nil {
+		return
+	}
+
+	reason := "left subtree is full"
+	if direction == "left" {
+		reason = "left slot is empty"
+	}
+	p.Steps = append(p.Steps, PlacementStep{
+		NodeName:    node.name,
+		NodeIndex:   node.nodeIndex,
+		LeftLeaves:  leftLeaves,
+		RightLeaves: rightLeaves,
+		Direction:   direction,
+		Reason:      reason,
+	})
+}
@@ -0,0 +1,46 @@
+package tree
+
+import (
+	"testing"
+)
+
+func TestPlacementTrace(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil, WithPlacementTrace())
+
+	users := []string{"alice", "bob", "charlie", "david", "eve"}
+	for _, user := range users {
+		if err := tree.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+		t.Log(tree.LastPlacementTrace())
+	}
+
+	trace := tree.LastPlacementTrace()
+	if trace == nil || trace.Leaf != "eve" {
+		t.Fatalf("expected trace for eve, got %+v", trace)
+	}
+	if !trace.Extended || trace.SplitLeaf != "" || len(trace.Steps) != 0 {
+		t.Errorf("four leaves fill the tree, eve should extend it with a new root: %+v", trace)
+	}
+
+	if err := tree.Insert("frank", []byte("frank_key")); err != nil {
+		t.Fatalf("Failed to insert frank: %v", err)
+	}
+	trace = tree.LastPlacementTrace()
+	if len(trace.Steps) == 0 {
+		t.Fatalf("expected at least one decision step")
+	}
+	root := trace.Steps[0]
+	if root.LeftLeaves != 4 || root.RightLeaves != 1 || root.Direction != "right" {
+		t.Errorf("unexpected root decision: %+v", root)
+	}
+	if trace.SplitLeaf != "eve" || trace.Extended {
+		t.Errorf("expected frank to split eve, got %+v", trace)
+	}
+
+	untraced, _ := NewTreeWithStore(nil)
+	untraced.Insert("alice", []byte("alice_key"))
+	if untraced.LastPlacementTrace() != nil {
+		t.Errorf("trace should be nil when tracing is disabled")
+	}
+}
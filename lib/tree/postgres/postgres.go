@@ -0,0 +1,323 @@
+// Package postgres stores TreeKEM trees in PostgreSQL so several server replicas can share them
+//
+// Every Insert, Delete and other tree operation is written in one SQL transaction, so a
+// failed operation leaves no partial rows behind. The transaction also advances the
+// tree's row in tree_revisions, guarded by the revision the replica last loaded or
+// wrote, so a replica that fell behind gets ErrConflict instead of overwriting another
+// replica's commit. The failed operation is rolled back and the tree reloaded; retry it.
+// Replicas are not told about each other's commits: a loaded tree keeps serving its
+// in-memory state until Refresh, for example when a LISTEN channel the application
+// notifies after each commit fires.
+//
+// The package only depends on database/sql; register a driver such as pgx or lib/pq in the application.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ErrConflict is returned when another replica committed to the tree since it was last loaded
+var ErrConflict = errors.New("tree was modified by another replica")
+
+// Schema creates the table holding tree elements
+const Schema = `CREATE TABLE IF NOT EXISTS tree_nodes (
+	tree_id    TEXT        NOT NULL,
+	name       TEXT        NOT NULL,
+	data       BYTEA       NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tree_id, name)
+)`
+
+// RevisionSchema creates the table holding the revision of each tree
+const RevisionSchema = `CREATE TABLE IF NOT EXISTS tree_revisions (
+	tree_id  TEXT   PRIMARY KEY,
+	revision BIGINT NOT NULL
+)`
+
+const (
+	upsertQuery = `INSERT INTO tree_nodes (tree_id, name, data) VALUES ($1, $2, $3)
+ON CONFLICT (tree_id, name) DO UPDATE SET data = EXCLUDED.data, updated_at = now()`
+	selectQuery = `SELECT data FROM tree_nodes WHERE tree_id = $1 AND name = $2`
+	deleteQuery = `DELETE FROM tree_nodes WHERE tree_id = $1 AND name = $2`
+
+	// advanceQuery moves the revision from $2 to $2 + 1 and affects no row when it is not at $2
+	advanceQuery = `INSERT INTO tree_revisions (tree_id, revision) VALUES ($1, $2::bigint + 1)
+ON CONFLICT (tree_id) DO UPDATE SET revision = EXCLUDED.revision WHERE tree_revisions.revision = $2::bigint`
+	revisionQuery = `SELECT revision FROM tree_revisions WHERE tree_id = $1`
+)
+
+// Store keeps the elements of one tree, identified by treeID, in the tree_nodes table
+type Store struct {
+	db      *sql.DB
+	treeID  string
+	upsert  *sql.Stmt
+	query   *sql.Stmt
+	remove  *sql.Stmt
+	advance *sql.Stmt
+	current *sql.Stmt
+
+	mu       sync.Mutex
+	tx       *sql.Tx // transaction of the running operation
+	txErr    error   // why the transaction of the running operation could not be started
+	revision int64   // revision this replica last loaded or wrote
+}
+
+var _ tree.BatchStore = (*Store)(nil)
+
+// CreateSchema creates the tree_nodes and tree_revisions tables if they do not exist
+func CreateSchema(ctx context.Context, db *sql.DB) error {
+	for _, schema := range []string{Schema, RevisionSchema} {
+		if _, err := db.ExecContext(ctx, schema); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Open prepares the statements used to persist the tree identified by treeID
+func Open(ctx context.Context, db *sql.DB, treeID string) (*Store, error) {
+	if treeID == "" {
+		return nil, fmt.Errorf("tree id must not be empty")
+	}
+
+	s := &Store{db: db, treeID: treeID}
+	var err error
+	if s.upsert, err = db.PrepareContext(ctx, upsertQuery); err != nil {
+		return nil, fmt.Errorf("failed to prepare upsert statement: %w", err)
+	}
+	if s.query, err = db.PrepareContext(ctx, selectQuery); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to prepare select statement: %w", err)
+	}
+	if s.remove, err = db.PrepareContext(ctx, deleteQuery); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to prepare delete statement: %w", err)
+	}
+	if s.advance, err = db.PrepareContext(ctx, advanceQuery); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to prepare revision statement: %w", err)
+	}
+	if s.current, err = db.PrepareContext(ctx, revisionQuery); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to prepare revision query: %w", err)
+	}
+	return s, nil
+}
+
+// NewTree creates the schema if needed and returns an empty tree stored under treeID
+// The first commit fails with ErrConflict if the tree already exists
+func NewTree(ctx context.Context, db *sql.DB, treeID string) (*tree.Tree, *Store, error) {
+	if err := CreateSchema(ctx, db); err != nil {
+		return nil, nil, err
+	}
+	store, err := Open(ctx, db, treeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tree.NewTreeWithStore(store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// LoadTree loads the tree stored under treeID rooted at headName
+func LoadTree(ctx context.Context, db *sql.DB, treeID string, headName string) (*tree.Tree, *Store, error) {
+	store, err := Open(ctx, db, treeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Read the revision first: rows committed meanwhile only make the next commit conflict
+	if err := store.loadRevision(); err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	t, err := tree.LoadTreeFromStore(store, headName)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Refresh reloads t from the latest committed revision, e.g. after another replica committed
+func Refresh(t *tree.Tree, s *Store) error {
+	if err := s.loadRevision(); err != nil {
+		return err
+	}
+	return t.Reload()
+}
+
+// Revision returns the tree revision this replica last loaded or wrote
+func (s *Store) Revision() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revision
+}
+
+// loadRevision reads the latest committed revision of the tree, 0 before its first commit
+func (s *Store) loadRevision() error {
+	var revision int64
+	err := s.current.QueryRow(s.treeID).Scan(&revision)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read tree revision: %w", err)
+	}
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
+
+// Key uses the element name as the row key
+func (s *Store) Key(name string) string {
+	return name
+}
+
+// Begin starts the transaction holding the writes of one tree operation
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tx, s.txErr = s.db.Begin()
+	if s.txErr != nil {
+		s.txErr = fmt.Errorf("failed to begin transaction: %w", s.txErr)
+	}
+}
+
+// Commit commits the transaction of the operation, or rolls it back when opErr is set
+func (s *Store) Commit(opErr error) error {
+	s.mu.Lock()
+	tx, txErr := s.tx, s.txErr
+	s.tx, s.txErr = nil, nil
+	s.mu.Unlock()
+
+	if tx == nil {
+		if opErr != nil {
+			return opErr
+		}
+		return txErr
+	}
+	if opErr != nil {
+		tx.Rollback()
+		return opErr
+	}
+	return s.commit(tx)
+}
+
+// commit advances the tree revision inside tx and commits it
+// On a conflict tx is rolled back and the latest revision read, so the tree can be
+// reloaded and the operation retried
+func (s *Store) commit(tx *sql.Tx) error {
+	s.mu.Lock()
+	expected := s.revision
+	s.mu.Unlock()
+
+	result, err := tx.Stmt(s.advance).Exec(s.treeID, expected)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to advance tree revision: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err := s.loadRevision(); err != nil {
+			return errors.Join(ErrConflict, err)
+		}
+		return ErrConflict
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.mu.Lock()
+	s.revision = expected + 1
+	s.mu.Unlock()
+	return nil
+}
+
+// stmt returns stmt bound to the running transaction, if any
+func (s *Store) stmt(stmt *sql.Stmt) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.txErr != nil {
+		return nil, s.txErr
+	}
+	if s.tx != nil {
+		return s.tx.Stmt(stmt), nil
+	}
+	return stmt, nil
+}
+
+// exec runs stmt in the running transaction, or outside an operation in a transaction
+// of its own that advances the revision like an operation does
+func (s *Store) exec(stmt *sql.Stmt, args ...any) error {
+	s.mu.Lock()
+	tx, txErr := s.tx, s.txErr
+	s.mu.Unlock()
+	if txErr != nil {
+		return txErr
+	}
+	if tx != nil {
+		_, err := tx.Stmt(stmt).Exec(args...)
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.Stmt(stmt).Exec(args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return s.commit(tx)
+}
+
+// Write upserts an element row
+func (s *Store) Write(key string, data []byte) error {
+	if err := s.exec(s.upsert, s.treeID, key, data); err != nil {
+		return fmt.Errorf("failed to upsert element %s: %w", key, err)
+	}
+	return nil
+}
+
+// Read returns an element row, including writes of the running transaction
+func (s *Store) Read(key string) ([]byte, error) {
+	query, err := s.stmt(s.query)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = query.QueryRow(s.treeID, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select element %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Remove deletes an element row
+func (s *Store) Remove(key string) error {
+	if err := s.exec(s.remove, s.treeID, key); err != nil {
+		return fmt.Errorf("failed to delete element %s: %w", key, err)
+	}
+	return nil
+}
+
+// Close releases the prepared statements
+func (s *Store) Close() error {
+	for _, stmt := range []*sql.Stmt{s.upsert, s.query, s.remove, s.advance, s.current} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return nil
+}
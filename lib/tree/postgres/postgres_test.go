@@ -0,0 +1,340 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// fakeDriver emulates the handful of statements the store issues
+type fakeDriver struct {
+	mu        sync.Mutex
+	rows      map[string][]byte
+	revisions map[string]int64
+	failIn    int // the upsert this many upserts from now fails, 0 for none
+}
+
+// fakeConn buffers the writes of its open transaction, nil values marking deletions
+type fakeConn struct {
+	d         *fakeDriver
+	pending   map[string][]byte
+	revisions map[string]int64
+}
+type fakeTx struct{ c *fakeConn }
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+type fakeRows struct {
+	data []driver.Value
+}
+
+func newFakeDriver() *fakeDriver {
+	return &fakeDriver{rows: make(map[string][]byte), revisions: make(map[string]int64)}
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[string][]byte)
+	c.revisions = make(map[string]int64)
+	return &fakeTx{c}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.c.d.mu.Lock()
+	defer tx.c.d.mu.Unlock()
+	for key, data := range tx.c.pending {
+		if data == nil {
+			delete(tx.c.d.rows, key)
+		} else {
+			tx.c.d.rows[key] = data
+		}
+	}
+	maps.Copy(tx.c.d.revisions, tx.c.revisions)
+	tx.c.pending, tx.c.revisions = nil, nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.c.pending, tx.c.revisions = nil, nil
+	return nil
+}
+
+// revision returns the tree's revision as the connection sees it
+func (c *fakeConn) revision(treeID string) (int64, bool) {
+	if revision, ok := c.revisions[treeID]; ok {
+		return revision, true
+	}
+	revision, ok := c.d.revisions[treeID]
+	return revision, ok
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+// set writes a row, inside the open transaction if there is one
+func (s *fakeStmt) set(key string, data []byte) {
+	if s.c.pending != nil {
+		s.c.pending[key] = data
+	} else if data == nil {
+		delete(s.c.d.rows, key)
+	} else {
+		s.c.d.rows[key] = data
+	}
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "INSERT INTO tree_revisions"):
+		treeID, expected := args[0].(string), args[1].(int64)
+		if current, ok := s.c.revision(treeID); ok != (expected != 0) || current != expected {
+			return driver.RowsAffected(0), nil
+		}
+		if s.c.revisions != nil {
+			s.c.revisions[treeID] = expected + 1
+		} else {
+			s.c.d.revisions[treeID] = expected + 1
+		}
+	case strings.HasPrefix(s.query, "INSERT"):
+		if s.c.d.failIn > 0 {
+			if s.c.d.failIn--; s.c.d.failIn == 0 {
+				return nil, fmt.Errorf("disk full")
+			}
+		}
+		s.set(args[0].(string)+"/"+args[1].(string), append([]byte{}, args[2].([]byte)...))
+	case strings.HasPrefix(s.query, "DELETE"):
+		s.set(args[0].(string)+"/"+args[1].(string), nil)
+	default:
+		return nil, fmt.Errorf("unexpected exec: %s", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	rows := &fakeRows{}
+	if strings.HasPrefix(s.query, "SELECT revision") {
+		if revision, ok := s.c.revision(args[0].(string)); ok {
+			rows.data = append(rows.data, revision)
+		}
+		return rows, nil
+	}
+	key := args[0].(string) + "/" + args[1].(string)
+	data, ok := s.c.d.rows[key]
+	if pending, staged := s.c.pending[key]; staged {
+		data, ok = pending, pending != nil
+	}
+	if ok {
+		rows.data = append(rows.data, data)
+	}
+	return rows, nil
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.data[0]
+	r.data = r.data[1:]
+	return nil
+}
+
+func TestPostgresTreeSharedAcrossReplicas(t *testing.T) {
+	sql.Register("fakepg", newFakeDriver())
+	db, err := sql.Open("fakepg", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tr, store, err := NewTree(ctx, db, "group-1")
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	defer store.Close()
+
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	if err := tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+
+	// A second replica loads the same group from the shared database
+	replica, replicaStore, err := LoadTree(ctx, db, "group-1", tr.Head().Name())
+	if err != nil {
+		t.Fatalf("Failed to load replica: %v", err)
+	}
+	defer replicaStore.Close()
+
+	if string(replica.GetGroupPublicKey()) != "root_key" {
+		t.Errorf("replica has unexpected root key %q", replica.GetGroupPublicKey())
+	}
+	if got := len(replica.GetLeaves()); got != 3 {
+		t.Errorf("expected 3 leaves in replica, got %d", got)
+	}
+
+	other, otherStore, err := LoadTree(ctx, db, "group-2", tr.Head().Name())
+	if err != nil {
+		t.Fatalf("Failed to load other group: %v", err)
+	}
+	defer otherStore.Close()
+	if other.Head() != nil {
+		t.Errorf("trees of different groups must not share rows")
+	}
+}
+
+func TestPostgresOperationsAreTransactional(t *testing.T) {
+	fake := newFakeDriver()
+	sql.Register("fakepg-tx", fake)
+	db, err := sql.Open("fakepg-tx", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	tr, store, err := NewTree(context.Background(), db, "group-1")
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	defer store.Close()
+	for _, user := range []string{"alice", "bob"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+
+	fake.mu.Lock()
+	before := maps.Clone(fake.rows)
+	fake.failIn = 2
+	fake.mu.Unlock()
+
+	// The leaf is written before the failing parent; it must not be committed alone
+	if err := tr.Insert("charlie", []byte("charlie_key")); err == nil {
+		t.Fatalf("expected the insert to fail")
+	}
+	fake.mu.Lock()
+	after := maps.Clone(fake.rows)
+	fake.failIn = 0
+	fake.mu.Unlock()
+	if !maps.EqualFunc(before, after, bytes.Equal) {
+		t.Errorf("failed insert changed the stored rows")
+	}
+
+	if err := tr.Insert("charlie", []byte("charlie_key")); err != nil {
+		t.Fatalf("Failed to insert charlie after the failure: %v", err)
+	}
+	replica, replicaStore, err := LoadTree(context.Background(), db, "group-1", "")
+	if err != nil {
+		t.Fatalf("Failed to load replica: %v", err)
+	}
+	defer replicaStore.Close()
+	if got := len(replica.GetLeaves()); got != 3 {
+		t.Errorf("expected 3 leaves in replica, got %d", got)
+	}
+}
+
+func TestPostgresReplicasDetectConflicts(t *testing.T) {
+	sql.Register("fakepg-conflict", newFakeDriver())
+	db, err := sql.Open("fakepg-conflict", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	first, firstStore, err := NewTree(ctx, db, "group-1")
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	defer firstStore.Close()
+	for _, user := range []string{"alice", "bob"} {
+		if err := first.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	second, secondStore, err := LoadTree(ctx, db, "group-1", "")
+	if err != nil {
+		t.Fatalf("Failed to load second replica: %v", err)
+	}
+	defer secondStore.Close()
+
+	if err := first.Insert("charlie", []byte("charlie_key")); err != nil {
+		t.Fatalf("Failed to insert charlie: %v", err)
+	}
+
+	// The second replica has not seen charlie and must not overwrite the rows
+	if err := second.Insert("dave", []byte("dave_key")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, ok := second.Find("charlie"); !ok {
+		t.Errorf("the conflicting replica should have been reloaded")
+	}
+	if err := second.Insert("dave", []byte("dave_key")); err != nil {
+		t.Fatalf("retrying after the conflict should succeed: %v", err)
+	}
+
+	// Writes outside an operation are guarded too
+	if err := first.AdvanceEpoch(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for the stale manifest, got %v", err)
+	}
+	if err := Refresh(first, firstStore); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if err := first.Insert("eve", []byte("eve_key")); err != nil {
+		t.Fatalf("Failed to insert after refresh: %v", err)
+	}
+
+	// A new tree under an existing id must not replace it
+	fresh, freshStore, err := NewTree(ctx, db, "group-1")
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	defer freshStore.Close()
+	if err := fresh.Insert("mallory", []byte("mallory_key")); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict for a new tree over an existing one, got %v", err)
+	}
+
+	loaded, loadedStore, err := LoadTree(ctx, db, "group-1", "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	defer loadedStore.Close()
+	if got := leafNames(loaded); strings.Join(got, ",") != "alice,bob,charlie,dave,eve" {
+		t.Errorf("unexpected leaves %v", got)
+	}
+	if loadedStore.Revision() != firstStore.Revision() {
+		t.Errorf("expected revision %d, got %d", firstStore.Revision(), loadedStore.Revision())
+	}
+}
+
+// leafNames lists the leaf names of t in order
+func leafNames(t *tree.Tree) []string {
+	var names []string
+	for _, leaf := range t.GetLeaves() {
+		names = append(names, leaf.Name())
+	}
+	return names
+}
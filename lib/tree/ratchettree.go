@@ -0,0 +1,390 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// RFC 9420 wire constants used by the ratchet_tree extension
+const (
+	mlsNodeTypeLeaf   = 1
+	mlsNodeTypeParent = 2
+
+	defaultMLSCiphersuite = MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+)
+
+// Array-tree arithmetic from RFC 9420 appendix C
+
+// mlsLevel returns the level of node x, leaves are level 0
+func mlsLevel(x int) int {
+	return bits.TrailingZeros(^uint(x))
+}
+
+// mlsNodeWidth returns the number of array nodes needed for n leaves
+func mlsNodeWidth(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return 2*(n-1) + 1
+}
+
+// mlsRoot returns the root index of a tree with n leaves
+func mlsRoot(n int) int {
+	w := mlsNodeWidth(n)
+	return (1 << (bits.Len(uint(w)) - 1)) - 1
+}
+
+func mlsLeft(x int) int {
+	k := mlsLevel(x)
+	return x ^ (1 << (k - 1))
+}
+
+func mlsRight(x int) int {
+	k := mlsLevel(x)
+	return x ^ (3 << (k - 1))
+}
+
+// ExportRatchetTree encodes the tree as the value of the RFC 9420 ratchet_tree extension
+// Leaves are numbered left to right. An intermediate node's key is exported when its leaves
+// are exactly those below an MLS parent node; other parent positions are blank.
+// Leaves holding a LeafNode export it unchanged. Other leaves get a placeholder LeafNode
+// with a basic credential naming the member and empty signature and signature key
+func (t *Tree) ExportRatchetTree() ([]byte, error) {
+	suite := t.ciphersuite
+	if suite == 0 {
+		suite = defaultMLSCiphersuite
+	}
+
+	w := &tls.Writer{}
+	err := w.Vector(func(w *tls.Writer) error {
+		for _, node := range t.ratchetNodes() {
+			switch {
+			case !node.present:
+				w.Uint8(0) // blank
+			case node.leaf:
+				w.Uint8(1)
+				w.Uint8(mlsNodeTypeLeaf)
+				leaf := node.leafNode
+				if leaf == nil {
+					leaf = placeholderLeafNode(node.identity, node.key, suite)
+				}
+				if err := leaf.encode(w); err != nil {
+					return err
+				}
+			default:
+				w.Uint8(1)
+				w.Uint8(mlsNodeTypeParent)
+				if err := w.Opaque(node.key); err != nil {
+					return err
+				}
+				if err := w.Opaque(node.parentHash); err != nil {
+					return err
+				}
+				if err := w.Vector(func(w *tls.Writer) error {
+					for _, index := range node.unmerged {
+						w.Uint32(index)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ratchet tree: %w", err)
+	}
+	return w.Buf, nil
+}
+
+// ratchetNodes maps the tree onto the RFC 9420 array layout, leaf i at node 2i
+// Blank leaves, intermediate nodes without a key and nodes covering no MLS parent's
+// leaves are blank
+func (t *Tree) ratchetNodes() []ratchetNode {
+	leaves := t.GetLeaves()
+	n := len(leaves)
+	positions := make(map[int]int, n)
+	for i, leaf := range leaves {
+		positions[leaf.leafIndex] = i
+	}
+
+	// Leaf range covered by every intermediate node, keyed by first and last leaf
+	type leafRange struct{ lo, hi int }
+	parents := make(map[leafRange]*Element)
+	next := 0
+	var walk func(*Element) leafRange
+	walk = func(node *Element) leafRange {
+		if node.IsLeaf() {
+			next++
+			return leafRange{next - 1, next - 1}
+		}
+		var r leafRange
+		switch {
+		case node.leftChild != nil && node.rightChild != nil:
+			r = leafRange{walk(node.leftChild).lo, walk(node.rightChild).hi}
+		case node.leftChild != nil:
+			r = walk(node.leftChild)
+		default:
+			r = walk(node.rightChild)
+		}
+		if _, taken := parents[r]; !taken {
+			parents[r] = node
+		}
+		return r
+	}
+	if t.head != nil {
+		walk(t.head)
+	}
+
+	nodes := make([]ratchetNode, mlsNodeWidth(n))
+	for x := range nodes {
+		if x%2 == 0 {
+			if leaf := leaves[x/2]; !leaf.IsBlank() {
+				nodes[x] = ratchetNode{present: true, leaf: true, key: leaf.key(), identity: leaf.name, leafNode: leaf.LeafNode()}
+			}
+			continue
+		}
+
+		k := mlsLevel(x)
+		span := (1 << k) - 1
+		r := leafRange{(x - span) / 2, min((x+span)/2, n-1)}
+		if node, ok := parents[r]; ok && len(node.key()) > 0 {
+			var unmerged []uint32
+			for _, index := range node.unmerged {
+				if position, ok := positions[index]; ok {
+					unmerged = append(unmerged, uint32(position))
+				}
+			}
+			nodes[x] = ratchetNode{present: true, key: node.key(), parentHash: node.ParentHash(), unmerged: unmerged}
+		}
+	}
+	return nodes
+}
+
+// placeholderLeafNode is the unsigned LeafNode exported for leaves that hold only a key
+func placeholderLeafNode(identity string, encryptionKey []byte, suite Ciphersuite) *LeafNode {
+	return &LeafNode{
+		EncryptionKey: encryptionKey,
+		Credential:    Credential{Type: CredentialBasic, Identity: []byte(identity)},
+		Capabilities: Capabilities{
+			Versions:     []uint16{ProtocolVersionMLS10},
+			CipherSuites: []uint16{uint16(suite)},
+			Credentials:  []uint16{uint16(CredentialBasic)},
+		},
+		Source:   LeafNodeSourceKeyPackage,
+		Lifetime: Lifetime{NotBefore: 0, NotAfter: math.MaxUint64},
+	}
+}
+
+// ratchetNode is a decoded ratchet_tree entry
+type ratchetNode struct {
+	present    bool
+	leaf       bool
+	key        []byte
+	identity   string
+	leafNode   *LeafNode // signed leaf contents, nil for placeholders
+	parentHash []byte    // parent nodes only
+	unmerged   []uint32  // parent nodes only, leaf positions in the array layout
+}
+
+// decodeRatchetTree parses the ratchet_tree extension into array order
+func decodeRatchetTree(data []byte) ([]ratchetNode, error) {
+	r := &tls.Reader{Buf: data}
+	var nodes []ratchetNode
+	err := r.Vector(func(r *tls.Reader) error {
+		present, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		if present == 0 {
+			nodes = append(nodes, ratchetNode{})
+			return nil
+		}
+		if present != 1 {
+			return fmt.Errorf("invalid optional marker %d", present)
+		}
+
+		nodeType, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		switch nodeType {
+		case mlsNodeTypeLeaf:
+			node, err := decodeLeafNode(r)
+			if err != nil {
+				return fmt.Errorf("leaf at node %d: %w", len(nodes), err)
+			}
+			nodes = append(nodes, node)
+		case mlsNodeTypeParent:
+			key, err := r.Opaque()
+			if err != nil {
+				return err
+			}
+			parentHash, err := r.Opaque()
+			if err != nil {
+				return err
+			}
+			var unmerged []uint32
+			err = r.Vector(func(r *tls.Reader) error {
+				index, err := r.Uint32()
+				unmerged = append(unmerged, index)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, ratchetNode{present: true, key: key, parentHash: parentHash, unmerged: unmerged})
+		default:
+			return fmt.Errorf("unknown node type %d", nodeType)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after ratchet tree", len(r.Buf))
+	}
+
+	for x, node := range nodes {
+		if node.present && node.leaf != (x%2 == 0) {
+			return nil, fmt.Errorf("node %d has the wrong type for its position", x)
+		}
+	}
+	if len(nodes) > 0 && (len(nodes)%2 == 0 || !nodes[len(nodes)-1].present) {
+		return nil, fmt.Errorf("ratchet tree must end with a non-blank leaf")
+	}
+	return nodes, nil
+}
+
+// decodeLeafNode reads a LeafNode, keeping it unless it is an unsigned placeholder
+func decodeLeafNode(r *tls.Reader) (ratchetNode, error) {
+	leaf := &LeafNode{}
+	if err := leaf.decode(r); err != nil {
+		return ratchetNode{}, err
+	}
+	node := ratchetNode{present: true, leaf: true, key: leaf.EncryptionKey, identity: leaf.Identity()}
+	if len(leaf.SignatureKey) > 0 {
+		node.leafNode = leaf
+	}
+	return node, nil
+}
+
+// leafName names an imported leaf after its credential identity when that is a usable,
+// unused element name, and leaf_<index> otherwise
+func leafName(identity string, index int, taken map[string]bool) string {
+	name := identity
+	usable := utf8.ValidString(name) && name != "" && !reservedName(name) &&
+		!strings.ContainsFunc(name, func(r rune) bool { return r == '/' || r == '\\' || unicode.IsControl(r) })
+	if !usable || taken[name] {
+		name = fmt.Sprintf("leaf_%d", index)
+		for suffix := 1; taken[name]; suffix++ {
+			name = fmt.Sprintf("leaf_%d_%d", index, suffix)
+		}
+	}
+	taken[name] = true
+	return name
+}
+
+// ImportRatchetTree builds a tree from the RFC 9420 ratchet_tree extension
+// Blank leaves keep their slot as blank elements, see Element.IsBlank, and parents past
+// the end of a truncated tree collapse into their only child. Leaves are named after their basic credential identity, falling back to leaf_<index>
+func ImportRatchetTree(data []byte, store Store, opts ...Option) (*Tree, error) {
+	nodes, err := decodeRatchetTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ratchet tree: %w", err)
+	}
+	return importRatchetNodes(nodes, store, opts)
+}
+
+// importRatchetNodes builds a tree from nodes in the RFC 9420 array layout
+func importRatchetNodes(nodes []ratchetNode, store Store, opts []Option) (*Tree, error) {
+	type built struct {
+		info        NodeInfo
+		left, right *built
+	}
+	names := make(map[string]bool)
+
+	var build func(x int) *built
+	build = func(x int) *built {
+		// Parents past the end may still cover leaves of a truncated tree
+		if x-(1<<mlsLevel(x)-1) >= len(nodes) {
+			return nil
+		}
+		if x%2 == 0 {
+			node := nodes[x]
+			if !node.present {
+				// Blank leaves keep their slot so the other leaves keep their indices
+				info := NodeInfo{Name: blankLeafName(x / 2), NodeType: "leaf", LeafIndex: x / 2}
+				return &built{info: info}
+			}
+			name := leafName(node.identity, x/2, names)
+			info := NodeInfo{Name: name, PublicKey: node.key, NodeType: "leaf", LeafIndex: x / 2, LeafNode: encodeLeafNode(node.leafNode)}
+			return &built{info: info}
+		}
+
+		left, right := build(mlsLeft(x)), build(mlsRight(x))
+		if left == nil || right == nil {
+			if left != nil {
+				return left
+			}
+			return right
+		}
+		var key, parentHash []byte
+		var unmerged []int
+		if x < len(nodes) {
+			key, parentHash = nodes[x].key, nodes[x].parentHash
+			for _, index := range nodes[x].unmerged {
+				unmerged = append(unmerged, int(index))
+			}
+		}
+		name := newIntermediateName()
+		return &built{
+			info:  NodeInfo{Name: name, PublicKey: key, NodeType: "intermediate", LeftChild: left.info.Name, RightChild: right.info.Name, ParentHash: parentHash, Unmerged: unmerged},
+			left:  left,
+			right: right,
+		}
+	}
+
+	n := (len(nodes) + 1) / 2
+	var root *built
+	if n > 0 {
+		root = build(mlsRoot(n))
+	}
+
+	// Node indices are array positions in order, as the tree numbers them
+	var order []*built
+	var number func(b *built)
+	number = func(b *built) {
+		if b == nil {
+			return
+		}
+		number(b.left)
+		b.info.NodeIndex = len(order)
+		order = append(order, b)
+		number(b.right)
+	}
+	number(root)
+	if root != nil {
+		root.info.ParentIndex = -1
+	}
+	for _, b := range order {
+		for _, child := range []*built{b.left, b.right} {
+			if child != nil {
+				child.info.ParentIndex = b.info.NodeIndex
+			}
+		}
+	}
+	infos := make([]NodeInfo, len(order))
+	for i, b := range order {
+		infos[i] = b.info
+	}
+	return ImportNodes(infos, store, opts...)
+}
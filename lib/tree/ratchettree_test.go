@@ -0,0 +1,138 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+func TestRatchetTreeRoundTrip(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, []byte(name+"_key"))
+	}
+	source.UpdateIntermediateKeys()
+
+	data, err := source.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	t.Logf("ratchet_tree 확장 %d바이트", len(data))
+
+	imported, err := ImportRatchetTree(data, nil)
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+	if !bytes.Equal(imported.StructureHash(), source.StructureHash()) {
+		t.Errorf("imported tree differs from the source")
+	}
+}
+
+func TestRatchetTreeBlankLeaves(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, []byte(name+"_key"))
+	}
+
+	data, err := source.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	nodes, err := decodeRatchetTree(data)
+	if err != nil {
+		t.Fatalf("Failed to decode ratchet tree: %v", err)
+	}
+	if len(nodes) != mlsNodeWidth(5) {
+		t.Fatalf("expected %d nodes, got %d", mlsNodeWidth(5), len(nodes))
+	}
+
+	// Blank the middle leaf; the importer keeps its slot so the other leaves keep their indices
+	nodes[4] = ratchetNode{}
+	encoded, err := encodeRatchetNodes(nodes)
+	if err != nil {
+		t.Fatalf("Failed to re-encode ratchet tree: %v", err)
+	}
+	if _, err := decodeRatchetTree(mustEncodeRatchetNodes(t, nodes[:len(nodes)-1])); err == nil {
+		t.Errorf("expected an error for a tree that does not end with a leaf")
+	}
+
+	imported, err := ImportRatchetTree(encoded, nil)
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+	if _, found := imported.Find("user_2"); found {
+		t.Errorf("blank leaf should not be imported")
+	}
+	leaves := imported.GetLeaves()
+	if len(leaves) != 5 {
+		t.Fatalf("expected 5 leaves, got %d", len(leaves))
+	}
+	for i, leaf := range leaves {
+		if i == 2 {
+			if !leaf.IsBlank() {
+				t.Errorf("leaf 2 should be blank, got %s", leaf.Name())
+			}
+			continue
+		}
+		if !bytes.Equal(leaf.Value(), []byte(leaf.Name()+"_key")) {
+			t.Errorf("leaf %s has key %q", leaf.Name(), leaf.Value())
+		}
+	}
+}
+
+func TestRatchetTreeRejectsTruncatedInput(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	source.Insert("alice", []byte("alice_key"))
+	source.Insert("bob", []byte("bob_key"))
+
+	data, err := source.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	if _, err := ImportRatchetTree(data[:len(data)-3], nil); err == nil {
+		t.Errorf("expected an error for truncated input")
+	}
+}
+
+// encodeRatchetNodes re-encodes decoded nodes so tests can tamper with them
+func encodeRatchetNodes(nodes []ratchetNode) ([]byte, error) {
+	w := &tls.Writer{}
+	err := w.Vector(func(w *tls.Writer) error {
+		for _, node := range nodes {
+			if !node.present {
+				w.Uint8(0)
+				continue
+			}
+			w.Uint8(1)
+			if node.leaf {
+				w.Uint8(mlsNodeTypeLeaf)
+				leaf := node.leafNode
+				if leaf == nil {
+					leaf = placeholderLeafNode(node.identity, node.key, defaultMLSCiphersuite)
+				}
+				if err := leaf.encode(w); err != nil {
+					return err
+				}
+				continue
+			}
+			w.Uint8(mlsNodeTypeParent)
+			w.Opaque(node.key)
+			w.Opaque(nil)
+			w.Opaque(nil)
+		}
+		return nil
+	})
+	return w.Buf, err
+}
+
+func mustEncodeRatchetNodes(t *testing.T, nodes []ratchetNode) []byte {
+	encoded, err := encodeRatchetNodes(nodes)
+	if err != nil {
+		t.Fatalf("Failed to encode ratchet tree: %v", err)
+	}
+	return encoded
+}
@@ -0,0 +1,62 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned by mutations on a tree opened with WithReadOnly
+var ErrReadOnly = errors.New("tree is read-only")
+
+// readOnlyStore rejects every write so a follower can never rewrite shared node files
+type readOnlyStore struct {
+	inner Store
+}
+
+// WithReadOnly rejects all mutations with ErrReadOnly and blocks writes at the store
+// Read paths such as GetTreeStructure, GetPath and Reload keep working;
+// MarkAllAsChecked only updates the in-memory timestamps
+func WithReadOnly() Option {
+	return func(t *Tree) {
+		t.readOnly = true
+		if t.store != nil {
+			t.store = readOnlyStore{inner: t.store}
+		}
+	}
+}
+
+// ReadOnly reports whether the tree rejects mutations
+func (t *Tree) ReadOnly() bool {
+	return t.readOnly
+}
+
+// checkWritable fails fast before a mutation touches in-memory state
+func (t *Tree) checkWritable(op string) error {
+	if t.readOnly {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	if t.successor != nil {
+		return fmt.Errorf("%s: %w", op, ErrRetired)
+	}
+	return nil
+}
+
+// Key delegates to the wrapped store
+func (s readOnlyStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Read delegates to the wrapped store
+func (s readOnlyStore) Read(key string) ([]byte, error) {
+	return s.inner.Read(key)
+}
+
+// Write always fails
+func (s readOnlyStore) Write(key string, data []byte) error {
+	return fmt.Errorf("write %s: %w", key, ErrReadOnly)
+}
+
+// Remove always fails
+func (s readOnlyStore) Remove(key string) error {
+	return fmt.Errorf("remove %s: %w", key, ErrReadOnly)
+}
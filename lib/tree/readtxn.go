@@ -0,0 +1,116 @@
+package tree
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultReadTxnTimeout bounds how long a ReadTxn may be held
+const defaultReadTxnTimeout = 30 * time.Second
+
+// ErrReadTxnExpired is returned by a ReadTxn held longer than its timeout
+var ErrReadTxnExpired = errors.New("read transaction expired")
+
+// ReadTxn is a consistent view of the tree pinned at one version
+// Every call observes the same state even while writers keep advancing the tree. The
+// view is a Snapshot, so starting a transaction copies only the nodes changed since the
+// previous snapshot
+type ReadTxn struct {
+	live     *Tree
+	snapshot *Snapshot
+	deadline time.Time
+}
+
+// WithReadTxnTimeout sets how long a ReadTxn stays valid
+func WithReadTxnTimeout(timeout time.Duration) Option {
+	return func(t *Tree) {
+		t.readTxnTimeout = timeout
+	}
+}
+
+// Version returns the number of successful mutations applied to the tree
+func (t *Tree) Version() uint64 {
+	return t.version
+}
+
+// ReadTxn pins the current version of the tree for a sequence of reads
+// Like Snapshot it must not run concurrently with mutations
+func (t *Tree) ReadTxn() (*ReadTxn, error) {
+	timeout := t.readTxnTimeout
+	if timeout <= 0 {
+		timeout = defaultReadTxnTimeout
+	}
+
+	return &ReadTxn{
+		live:     t,
+		snapshot: t.Snapshot(),
+		deadline: time.Now().Add(timeout),
+	}, nil
+}
+
+// Version returns the version the transaction is pinned to
+func (r *ReadTxn) Version() uint64 {
+	return r.snapshot.version
+}
+
+// Stale reports whether writers advanced the tree past the pinned version
+func (r *ReadTxn) Stale() bool {
+	return r.live.version != r.snapshot.version
+}
+
+// Err returns ErrReadTxnExpired once the transaction was held too long
+func (r *ReadTxn) Err() error {
+	if time.Now().After(r.deadline) {
+		return ErrReadTxnExpired
+	}
+	return nil
+}
+
+// GetTreeStructure returns the pinned tree structure
+func (r *ReadTxn) GetTreeStructure() (map[string]*NodeInfo, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return r.snapshot.GetTreeStructure(), nil
+}
+
+// GetPath returns the pinned path from the root to a leaf
+func (r *ReadTxn) GetPath(leafName string) ([]*SnapshotNode, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return r.snapshot.GetPath(leafName)
+}
+
+// Find looks a node up in the pinned tree
+func (r *ReadTxn) Find(name string) (*SnapshotNode, bool, error) {
+	if err := r.Err(); err != nil {
+		return nil, false, err
+	}
+	node, ok := r.snapshot.Find(name)
+	return node, ok, nil
+}
+
+// Resolution returns the pinned resolution of the node at nodeIndex, see Tree.Resolution
+func (r *ReadTxn) Resolution(nodeIndex int) ([]*SnapshotNode, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return r.snapshot.Resolution(nodeIndex)
+}
+
+// GetLeaves returns the pinned leaves
+func (r *ReadTxn) GetLeaves() ([]*SnapshotNode, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return r.snapshot.GetLeaves(), nil
+}
+
+// StructureHash returns the structure hash of the pinned tree
+func (r *ReadTxn) StructureHash() ([]byte, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return r.snapshot.StructureHash(), nil
+}
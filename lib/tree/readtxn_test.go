@@ -0,0 +1,135 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadTxnObservesPinnedVersion(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil)
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+
+	txn, err := tree.ReadTxn()
+	if err != nil {
+		t.Fatalf("Failed to start read transaction: %v", err)
+	}
+	if txn.Version() != 3 {
+		t.Errorf("expected version 3, got %d", txn.Version())
+	}
+
+	// Writers keep advancing the live tree
+	tree.Insert("david", []byte("david_key"))
+	tree.Delete("alice")
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("new_root_key"))
+
+	if !txn.Stale() {
+		t.Errorf("transaction should report the live tree moved on")
+	}
+
+	leaves, err := txn.GetLeaves()
+	if err != nil {
+		t.Fatalf("Failed to read leaves: %v", err)
+	}
+	if len(leaves) != 3 {
+		t.Errorf("expected 3 pinned leaves, got %d", len(leaves))
+	}
+	if _, err := txn.GetPath("alice"); err != nil {
+		t.Errorf("alice should still be visible in the pinned view: %v", err)
+	}
+	if _, ok, _ := txn.Find("david"); ok {
+		t.Errorf("david must not be visible in the pinned view")
+	}
+	structure, _ := txn.GetTreeStructure()
+	if len(structure) != 5 {
+		t.Errorf("expected 5 pinned nodes, got %d", len(structure))
+	}
+}
+
+func TestReadTxnIsolatesNodeState(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil, WithKeyHistory(4))
+	tree.Insert("alice", []byte("alice_key"))
+	tree.Insert("bob", []byte("bob_key"))
+	tree.Insert("charlie", []byte("charlie_key"))
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("root_key"))
+	tree.Insert("david", []byte("david_key")) // unmerged at the keyed root
+
+	root := tree.Head().NodeIndex()
+	names := func(nodes []*SnapshotNode) []string {
+		var out []string
+		for _, node := range nodes {
+			out = append(out, node.Name())
+		}
+		return out
+	}
+	txn, _ := tree.ReadTxn()
+	before, err := txn.Resolution(root)
+	if err != nil {
+		t.Fatalf("Failed to resolve root: %v", err)
+	}
+	if got := names(before); len(got) != 2 || got[0] != tree.Head().Name() || got[1] != "david" {
+		t.Fatalf("unexpected resolution %v", got)
+	}
+
+	// Taking david out of the structure drops it from the root's unmerged leaves in
+	// place, and a new root key moves the old one into the history
+	spliceOut(t, tree, "david")
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("next_root_key"))
+
+	after, _ := txn.Resolution(root)
+	if !slices.Equal(names(after), names(before)) {
+		t.Errorf("pinned resolution changed from %v to %v", names(before), names(after))
+	}
+	pinnedRoot, _, _ := txn.Find(tree.Head().Name())
+	if got := pinnedRoot.UnmergedLeaves(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("pinned unmerged leaves changed to %v", got)
+	}
+	if string(pinnedRoot.PublicKey()) != "root_key" || len(pinnedRoot.KeyHistory(0)) != 0 {
+		t.Errorf("pinned root key changed to %q", pinnedRoot.PublicKey())
+	}
+	if _, err := txn.Resolution(99); err == nil {
+		t.Errorf("expected an error for an unknown node")
+	}
+}
+
+func TestReadTxnExpires(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil, WithReadTxnTimeout(10*time.Millisecond))
+	tree.Insert("alice", []byte("alice_key"))
+
+	txn, _ := tree.ReadTxn()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := txn.GetLeaves(); !errors.Is(err, ErrReadTxnExpired) {
+		t.Errorf("expected ErrReadTxnExpired, got %v", err)
+	}
+}
+
+func TestReadTxnSharesUnchangedNodes(t *testing.T) {
+	tree, _ := NewTreeWithStore(nil)
+	for _, user := range []string{"alice", "bob", "charlie", "david"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+	hash := tree.StructureHash()
+
+	first, _ := tree.ReadTxn()
+	tree.SetIntermediateNodeKey(tree.Head().Name(), []byte("root_key"))
+	second, _ := tree.ReadTxn()
+
+	if got, _ := first.StructureHash(); !bytes.Equal(got, hash) {
+		t.Errorf("pinned structure hash changed")
+	}
+	a, _, _ := first.Find("alice")
+	b, _, _ := second.Find("alice")
+	if a != b {
+		t.Errorf("a node no write touched should be shared between transactions")
+	}
+	rootA, _, _ := first.Find(tree.Head().Name())
+	rootB, _, _ := second.Find(tree.Head().Name())
+	if rootA == rootB || len(rootA.PublicKey()) != 0 {
+		t.Errorf("the rotated root should be copied")
+	}
+}
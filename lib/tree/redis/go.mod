@@ -0,0 +1,9 @@
+module github.com/snowmerak/mls/lib/tree/redis
+
+go 1.25.0
+
+require github.com/snowmerak/mls v0.0.0
+
+require github.com/google/flatbuffers v25.2.10+incompatible // indirect
+
+replace github.com/snowmerak/mls => ../../..
@@ -0,0 +1,150 @@
+// Package redis keeps TreeKEM trees in Redis hashes with optional TTLs and change notifications
+//
+// The package does not import a Redis client; adapt the client already used by the
+// application (go-redis, rueidis, ...) to the Client interface.
+package redis
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/tree/stream"
+)
+
+// Client is the subset of Redis commands the store needs
+type Client interface {
+	HSet(ctx context.Context, key, field string, value []byte) error
+	// HGet returns found=false when the field does not exist
+	HGet(ctx context.Context, key, field string) (value []byte, found bool, err error)
+	HDel(ctx context.Context, key, field string) error
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	Publish(ctx context.Context, channel string, message []byte) error
+}
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithTTL expires the whole tree hash after ttl without writes
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = ttl
+	}
+}
+
+// WithTimeout bounds every Redis round trip
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// Store keeps every element of one tree as a field of a single Redis hash
+type Store struct {
+	client  Client
+	hashKey string
+	channel string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+var _ tree.Store = (*Store)(nil)
+var _ tree.Notifier = (*Store)(nil)
+
+// NewStore creates a store for the tree identified by treeID
+func NewStore(client Client, treeID string, opts ...Option) *Store {
+	s := &Store{
+		client:  client,
+		hashKey: "mls:tree:" + treeID,
+		channel: "mls:tree:" + treeID + ":changes",
+		timeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewTree returns an empty tree stored in Redis that publishes its changes
+func NewTree(client Client, treeID string, opts ...Option) (*tree.Tree, *Store) {
+	store := NewStore(client, treeID, opts...)
+	t, _ := tree.NewTreeWithStore(store, tree.WithNotifier(store)) // WithNotifier cannot fail
+	return t, store
+}
+
+// LoadTree loads the tree stored under treeID rooted at headName
+func LoadTree(client Client, treeID string, headName string, opts ...Option) (*tree.Tree, *Store, error) {
+	store := NewStore(client, treeID, opts...)
+	t, err := tree.LoadTreeFromStore(store, headName, tree.WithNotifier(store))
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, store, nil
+}
+
+// Channel returns the pub/sub channel change events are published to
+func (s *Store) Channel() string {
+	return s.channel
+}
+
+// Key uses the element name as the hash field
+func (s *Store) Key(name string) string {
+	return name
+}
+
+// Write stores an element and refreshes the tree TTL
+func (s *Store) Write(key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.client.HSet(ctx, s.hashKey, key, data); err != nil {
+		return fmt.Errorf("failed to store element %s: %w", key, err)
+	}
+	if s.ttl > 0 {
+		if err := s.client.Expire(ctx, s.hashKey, s.ttl); err != nil {
+			return fmt.Errorf("failed to refresh tree ttl: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read returns an element
+func (s *Store) Read(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	data, found, err := s.client.HGet(ctx, s.hashKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read element %s: %w", key, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+// Remove deletes an element
+func (s *Store) Remove(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.client.HDel(ctx, s.hashKey, key); err != nil {
+		return fmt.Errorf("failed to delete element %s: %w", key, err)
+	}
+	return nil
+}
+
+// Notify publishes a change event encoded with the stream wire format
+// Publishing is best effort; subscribers that miss events can reload the tree
+func (s *Store) Notify(event tree.ChangeEvent) {
+	message, err := stream.AppendEvent(nil, event)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	s.client.Publish(ctx, s.channel, message)
+}
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree/stream"
+)
+
+// fakeClient is an in-process stand-in for a Redis server
+type fakeClient struct {
+	hashes    map[string]map[string][]byte
+	ttls      map[string]time.Duration
+	published map[string][][]byte
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		hashes:    make(map[string]map[string][]byte),
+		ttls:      make(map[string]time.Duration),
+		published: make(map[string][][]byte),
+	}
+}
+
+func (c *fakeClient) HSet(_ context.Context, key, field string, value []byte) error {
+	if c.hashes[key] == nil {
+		c.hashes[key] = make(map[string][]byte)
+	}
+	c.hashes[key][field] = value
+	return nil
+}
+
+func (c *fakeClient) HGet(_ context.Context, key, field string) ([]byte, bool, error) {
+	value, ok := c.hashes[key][field]
+	return value, ok, nil
+}
+
+func (c *fakeClient) HDel(_ context.Context, key, field string) error {
+	delete(c.hashes[key], field)
+	return nil
+}
+
+func (c *fakeClient) Expire(_ context.Context, key string, ttl time.Duration) error {
+	c.ttls[key] = ttl
+	return nil
+}
+
+func (c *fakeClient) Publish(_ context.Context, channel string, message []byte) error {
+	c.published[channel] = append(c.published[channel], message)
+	return nil
+}
+
+func TestRedisTreeWithNotifications(t *testing.T) {
+	client := newFakeClient()
+	tr, store := NewTree(client, "group-1", WithTTL(time.Hour))
+
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		if err := tr.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	if err := tr.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+
+	if client.ttls["mls:tree:group-1"] != time.Hour {
+		t.Errorf("expected tree ttl to be refreshed")
+	}
+
+	messages := client.published[store.Channel()]
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 published events, got %d", len(messages))
+	}
+	last, _, err := stream.DecodeEvent(messages[3])
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if last.Op != "delete" || last.Name != "bob" {
+		t.Errorf("unexpected last event: %+v", last)
+	}
+
+	loaded, _, err := LoadTree(client, "group-1", tr.Head().Name())
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if got := loaded.MemberCount(); got != 2 {
+		t.Errorf("expected 2 members after reload, got %d", got)
+	}
+}
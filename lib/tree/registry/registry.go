@@ -0,0 +1,150 @@
+// Package registry keeps the trees of every group a server hosts and drains them on
+// shutdown
+//
+// Drain refuses new mutations and reads, waits for the ones in progress and flushes every
+// tree, so a rolling deploy never interrupts a half-applied membership change and no
+// group is opened after the registry flushed.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// ErrDraining is returned by Update and View once Drain has been called
+var ErrDraining = errors.New("registry is draining")
+
+// OpenFunc opens or creates the tree of a group on its first use
+type OpenFunc func(id string) (*tree.Tree, error)
+
+// entry serializes access to one group's tree
+type entry struct {
+	once sync.Once // opens the tree, see Registry.acquire
+	err  error     // why the tree could not be opened
+
+	mu   sync.Mutex
+	tree *tree.Tree
+}
+
+// Registry hands out the trees of many groups, one call at a time per group
+// Calls for different groups run in parallel, and so does opening their trees
+type Registry struct {
+	open OpenFunc
+
+	mu       sync.Mutex // guards the fields below
+	groups   map[string]*entry
+	draining bool
+	inflight sync.WaitGroup // running Update and View calls
+}
+
+// New creates a registry opening trees with open
+func New(open OpenFunc) *Registry {
+	return &Registry{open: open, groups: make(map[string]*entry)}
+}
+
+// acquire returns the entry of id with its tree opened, and registers the call with
+// inflight; the caller must call r.inflight.Done once finished with the entry
+// The tree is opened outside r.mu, once per group however many calls wait for it. A
+// group whose tree failed to open is forgotten, so a later call tries again
+func (r *Registry) acquire(id string) (*entry, error) {
+	r.mu.Lock()
+	if r.draining {
+		r.mu.Unlock()
+		return nil, ErrDraining
+	}
+	e, ok := r.groups[id]
+	if !ok {
+		e = &entry{}
+		r.groups[id] = e
+	}
+	r.inflight.Add(1)
+	r.mu.Unlock()
+
+	e.once.Do(func() {
+		e.tree, e.err = r.open(id)
+	})
+	if e.err != nil {
+		r.mu.Lock()
+		if r.groups[id] == e {
+			delete(r.groups, id)
+		}
+		r.mu.Unlock()
+		r.inflight.Done()
+		return nil, fmt.Errorf("failed to open group %s: %w", id, e.err)
+	}
+	return e, nil
+}
+
+// Update runs fn with the tree of group id held exclusively
+// It fails with ErrDraining once Drain has been called, without running fn
+func (r *Registry) Update(id string, fn func(t *tree.Tree) error) error {
+	e, err := r.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer r.inflight.Done()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fn(e.tree)
+}
+
+// View runs fn with the tree of group id held exclusively; fn must not mutate it
+// Like Update it fails with ErrDraining once Drain has been called
+func (r *Registry) View(id string, fn func(t *tree.Tree) error) error {
+	e, err := r.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer r.inflight.Done()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fn(e.tree)
+}
+
+// Draining reports whether Drain has been called
+func (r *Registry) Draining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// Drain stops accepting calls, waits for the running ones and closes every tree in
+// group id order, which flushes writes still held by write-behind, deferred or debounced
+// stores. done, when set, is called for each flushed group, e.g. to emit a final event.
+// Trees that fail to flush are reported together; the others are still flushed
+func (r *Registry) Drain(done func(id string, t *tree.Tree)) error {
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+	r.inflight.Wait()
+
+	// No call is running and none starts, so every remaining entry holds an open tree
+	r.mu.Lock()
+	ids := slices.Sorted(maps.Keys(r.groups))
+	entries := make([]*entry, len(ids))
+	for i, id := range ids {
+		entries[i] = r.groups[id]
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for i, e := range entries {
+		e.mu.Lock()
+		err := e.tree.Close()
+		if err == nil && done != nil {
+			done(ids[i], e.tree)
+		}
+		e.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush group %s: %w", ids[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
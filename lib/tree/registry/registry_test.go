@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestDrainWaitsForUpdatesAndFlushesTrees(t *testing.T) {
+	dir := t.TempDir()
+	opened := map[string]int{}
+	r := New(func(id string) (*tree.Tree, error) {
+		opened[id]++
+		store, err := tree.NewFileStore(filepath.Join(dir, id))
+		if err != nil {
+			return nil, err
+		}
+		// Debounced writes only reach the store on a flush
+		return tree.NewTreeWithStore(store, tree.WithDebouncedWrites(time.Hour))
+	})
+
+	for _, id := range []string{"beta", "alpha"} {
+		for _, name := range []string{"alice", "bob"} {
+			if err := r.Update(id, func(t *tree.Tree) error { return t.Insert(name, []byte(name+"_key")) }); err != nil {
+				t.Fatalf("Failed to insert %s into %s: %v", name, id, err)
+			}
+		}
+	}
+	if opened["alpha"] != 1 || opened["beta"] != 1 {
+		t.Errorf("each group should be opened once, got %v", opened)
+	}
+
+	// An update in progress holds the drain back until it completes
+	started, release := make(chan struct{}), make(chan struct{})
+	updated := make(chan error)
+	go func() {
+		updated <- r.Update("alpha", func(t *tree.Tree) error {
+			close(started)
+			<-release
+			return t.Insert("charlie", []byte("charlie_key"))
+		})
+	}()
+	<-started
+
+	var flushed []string
+	drained := make(chan error)
+	go func() {
+		drained <- r.Drain(func(id string, t *tree.Tree) { flushed = append(flushed, id) })
+	}()
+	for !r.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := r.Update("beta", func(*tree.Tree) error { return nil }); !errors.Is(err, ErrDraining) {
+		t.Errorf("expected ErrDraining while draining, got %v", err)
+	}
+	select {
+	case <-drained:
+		t.Fatalf("drain must wait for the update in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-updated; err != nil {
+		t.Fatalf("update in progress failed: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+	if len(flushed) != 2 || flushed[0] != "alpha" || flushed[1] != "beta" {
+		t.Errorf("expected alpha and beta flushed in order, got %v", flushed)
+	}
+
+	// Every debounced write reached the store, including the one in progress
+	loaded, err := tree.LoadTree(filepath.Join(dir, "alpha"), "")
+	if err != nil {
+		t.Fatalf("Failed to load drained tree: %v", err)
+	}
+	if got := len(loaded.GetLeaves()); got != 3 {
+		t.Errorf("expected 3 members on disk, got %d", got)
+	}
+
+	// Nothing is read or opened after the drain, including groups never opened before
+	for _, id := range []string{"beta", "gamma"} {
+		if err := r.View(id, func(*tree.Tree) error { return nil }); !errors.Is(err, ErrDraining) {
+			t.Errorf("View(%s) after drain: expected ErrDraining, got %v", id, err)
+		}
+	}
+	if opened["gamma"] != 0 {
+		t.Errorf("gamma must not be opened after the drain")
+	}
+}
+
+func TestGroupsOpenOutsideTheRegistryLock(t *testing.T) {
+	var mu sync.Mutex
+	opened := map[string]int{}
+	slow, release := make(chan struct{}), make(chan struct{})
+	fail := true
+	r := New(func(id string) (*tree.Tree, error) {
+		mu.Lock()
+		opened[id]++
+		failing := id == "broken" && fail
+		mu.Unlock()
+		if id == "slow" {
+			close(slow)
+			<-release
+		}
+		if failing {
+			return nil, errors.New("store unavailable")
+		}
+		return tree.NewTreeWithStore(nil)
+	})
+
+	// Two calls wait for the same slow open while other groups stay available
+	results := make(chan error, 2)
+	for range 2 {
+		go func() { results <- r.View("slow", func(*tree.Tree) error { return nil }) }()
+	}
+	<-slow
+	if err := r.Update("fast", func(t *tree.Tree) error { return t.Insert("alice", []byte("alice_key")) }); err != nil {
+		t.Fatalf("a slow open must not block other groups: %v", err)
+	}
+	close(release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Errorf("View of the slow group failed: %v", err)
+		}
+	}
+
+	// A failed open is retried by the next call
+	if err := r.View("broken", func(*tree.Tree) error { return nil }); err == nil {
+		t.Errorf("expected the open to fail")
+	}
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := r.View("broken", func(*tree.Tree) error { return nil }); err != nil {
+		t.Errorf("expected the second open to succeed: %v", err)
+	}
+
+	if err := r.Drain(nil); err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if opened["slow"] != 1 || opened["fast"] != 1 || opened["broken"] != 2 {
+		t.Errorf("unexpected opens %v", opened)
+	}
+}
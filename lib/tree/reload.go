@@ -0,0 +1,142 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// digestOf hashes an element encoding
+func digestOf(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// DetectExternalChanges returns the names of elements whose stored encoding no longer
+// matches what this tree last wrote or read, e.g. after an operator edited node files
+func (t *Tree) DetectExternalChanges() ([]string, error) {
+	if t.store == nil {
+		return nil, nil
+	}
+	t.purgeCache()
+
+	var changed []string
+	for _, element := range t.GetAllElements() {
+		data, err := t.store.Read(element.filePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			changed = append(changed, element.name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", element.name, err)
+		}
+		if !bytes.Equal(digestOf(data), element.digest) {
+			changed = append(changed, element.name)
+		}
+	}
+	return changed, nil
+}
+
+// ReloadNode refreshes a single element from the store
+// Children whose stored reference changed are reloaded with their subtrees
+func (t *Tree) ReloadNode(name string) error {
+	if t.store == nil {
+		return fmt.Errorf("tree has no backing store")
+	}
+	t.purgeCache()
+	node, found := t.Find(name)
+	if !found {
+		return fmt.Errorf("node not found: %s", name)
+	}
+
+	jsonData, err := t.store.Read(node.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	digest := digestOf(jsonData)
+	if bytes.Equal(digest, node.digest) {
+		return nil
+	}
+
+	data, err := decodeElementData(jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal element data: %w", err)
+	}
+	leaf, err := leafNodeOf(data.LeafNode)
+	if err != nil {
+		return fmt.Errorf("failed to decode leaf node of %s: %w", name, err)
+	}
+
+	node.name = data.Name
+	node.publicKey = data.PublicKey
+	node.keyAlgorithm = data.KeyAlgorithm
+	node.keyEncoding = data.KeyEncoding
+	node.history = data.History
+	node.leafNode = leaf
+	node.parentHash = data.ParentHash
+	node.unmerged = data.Unmerged
+	node.shelved = false
+	node.record = nil
+	node.unloaded.Store(false)
+	node.leftCount = data.LeftCount
+	node.rightCount = data.RightCount
+	node.nodeType = data.NodeType
+	node.leafIndex = data.LeafIndex
+	node.lastModified = data.LastModified
+	node.lastChecked = data.LastChecked
+	node.version = data.Version
+	node.digest = digest
+
+	if node.leftChild, err = t.reloadChild(node.leftChild, data.LeftChild); err != nil {
+		return err
+	}
+	if node.rightChild, err = t.reloadChild(node.rightChild, data.RightChild); err != nil {
+		return err
+	}
+
+	t.reassignNodeIndices()
+	t.version++
+	return nil
+}
+
+// reloadChild keeps the current child when the stored reference still points at it
+func (t *Tree) reloadChild(current *Element, key string) (*Element, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if current != nil && current.filePath == key {
+		return current, nil
+	}
+	child, err := loadFromStore(t.store, key, t.format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload child %s: %w", key, err)
+	}
+	return child, nil
+}
+
+// Reload discards the in-memory tree and reads it again from the store
+func (t *Tree) Reload() error {
+	if t.store == nil {
+		return fmt.Errorf("tree has no backing store")
+	}
+	t.purgeCache()
+	if err := t.loadManifest(); err != nil {
+		return err
+	}
+
+	var head *Element
+	if t.manifestHead != "" {
+		var err error
+		head, err = loadFromStore(t.store, t.store.Key(t.manifestHead), t.format)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to reload head element: %w", err)
+		}
+	}
+
+	t.head = head
+	t.reassignNodeIndices()
+	t.version++
+	return nil
+}
@@ -0,0 +1,69 @@
+package tree
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestReloadAfterExternalModification(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "reload_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tree, err := NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tree.Insert(user, []byte(user+"_key"))
+	}
+
+	changed, err := tree.DetectExternalChanges()
+	if err != nil {
+		t.Fatalf("Failed to detect changes: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("expected no external changes, got %v", changed)
+	}
+
+	// Another process rewrites bob's key on disk
+	bob, _ := tree.Find("bob")
+	raw, _ := os.ReadFile(bob.filePath)
+	var data elementData
+	json.Unmarshal(raw, &data)
+	data.PublicKey = []byte("rotated_by_operator")
+	raw, _ = json.Marshal(data)
+	os.WriteFile(bob.filePath, raw, 0644)
+
+	changed, _ = tree.DetectExternalChanges()
+	if len(changed) != 1 || changed[0] != "bob" {
+		t.Fatalf("expected bob to be detected, got %v", changed)
+	}
+
+	if err := tree.ReloadNode("bob"); err != nil {
+		t.Fatalf("Failed to reload bob: %v", err)
+	}
+	if string(bob.Value()) != "rotated_by_operator" {
+		t.Errorf("bob was not refreshed: %q", bob.Value())
+	}
+	if changed, _ := tree.DetectExternalChanges(); len(changed) != 0 {
+		t.Errorf("expected tree to be in sync after reload, got %v", changed)
+	}
+
+	// A full reload picks up structural changes made by another writer
+	other, err := LoadTree(tempDir, "")
+	if err != nil {
+		t.Fatalf("Failed to open second writer: %v", err)
+	}
+	other.Insert("david", []byte("david_key"))
+
+	if err := tree.Reload(); err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if _, ok := tree.Find("david"); !ok {
+		t.Errorf("david not visible after reload")
+	}
+}
@@ -0,0 +1,63 @@
+package tree
+
+import "fmt"
+
+// Rename gives the member leaf oldName the name newName, moving its stored element
+// The leaf keeps its key, leaf node, leaf index and position, so unlike Delete followed
+// by Insert no path needs new keys. With an AuthService the leaf's credential must be
+// valid for newName
+func (t *Tree) Rename(oldName, newName string) (err error) {
+	if err := t.checkWritable("rename"); err != nil {
+		return err
+	}
+	end := t.startOp("rename", oldName)
+	defer func() { end(err) }()
+
+	path, err := t.GetPath(oldName)
+	if err != nil {
+		return err
+	}
+	leaf := path[len(path)-1]
+	if leaf.nodeType != "leaf" || leaf.IsBlank() {
+		return fmt.Errorf("%s is not a member leaf", oldName)
+	}
+	if newName == "" {
+		return fmt.Errorf("failed to rename %s: empty name", oldName)
+	}
+	if reservedName(newName) {
+		return fmt.Errorf("failed to rename %s to %s: %w", oldName, newName, ErrReservedName)
+	}
+	if _, taken := t.Find(newName); taken {
+		return fmt.Errorf("failed to rename %s to %s: %w", oldName, newName, ErrExists)
+	}
+	if ln := leaf.LeafNode(); ln != nil && t.authService != nil {
+		if err := t.authService.ValidateCredential(newName, ln.Credential, ln.SignatureKey); err != nil {
+			return fmt.Errorf("failed to rename %s: %w: %w", oldName, ErrCredentialRejected, err)
+		}
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	previous := leaf.filePath
+	t.renameElement(leaf, newName)
+	leaf.filePath = t.generateFilePath(newName)
+	leaf.MarkAsModified()
+	if err := leaf.saveToDisk(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", newName, err)
+	}
+	t.removeFromStore(previous)
+
+	// The parent refers to its children by stored name
+	if parent := leaf.parent; parent != nil {
+		if err := parent.saveToDisk(); err != nil {
+			return fmt.Errorf("failed to save %s: %w", parent.name, err)
+		}
+	}
+	if _, ok := t.pinned[oldName]; ok {
+		delete(t.pinned, oldName)
+		t.pinned[newName] = struct{}{}
+		return t.saveManifest()
+	}
+	return t.syncManifestHead()
+}
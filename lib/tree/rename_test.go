@@ -0,0 +1,68 @@
+package tree
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	notifier := &recordingNotifier{}
+	tr, err := NewTree(dir, WithNotifier(notifier))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	bob, _ := tr.Find("bob")
+	leafIndex, nodeIndex := bob.LeafIndex(), bob.NodeIndex()
+	rootKey := slices.Clone(tr.Head().Value())
+
+	for _, bad := range [][2]string{{"mallory", "eve"}, {"bob", "alice"}, {"bob", ""}, {tr.Head().Name(), "eve"}} {
+		if err := tr.Rename(bad[0], bad[1]); err == nil {
+			t.Errorf("renaming %q to %q should fail", bad[0], bad[1])
+		}
+	}
+
+	version := tr.Version()
+	if err := tr.Rename("bob", "robert"); err != nil {
+		t.Fatalf("Failed to rename bob: %v", err)
+	}
+	if _, found := tr.Find("bob"); found {
+		t.Errorf("the old name should be gone")
+	}
+	robert, found := tr.Find("robert")
+	if !found || robert != bob {
+		t.Fatalf("the leaf should be found under its new name")
+	}
+	if robert.LeafIndex() != leafIndex || robert.NodeIndex() != nodeIndex || string(robert.Value()) != "bob_key" {
+		t.Errorf("rename should keep the leaf's position and key")
+	}
+	if !bytes.Equal(tr.Head().Value(), rootKey) {
+		t.Errorf("rename should not touch path keys")
+	}
+	if tr.Version() != version+1 || notifier.events[len(notifier.events)-1].Op != "rename" {
+		t.Errorf("rename should be one operation")
+	}
+	if _, err := tr.store.Read(tr.generateFilePath("bob")); err == nil {
+		t.Errorf("the element stored under the old name should be removed")
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if got, want := leafNames(reloaded), []string{"alice", "robert", "charlie"}; !slices.Equal(got, want) {
+		t.Errorf("reloaded leaves = %v, want %v", got, want)
+	}
+	if !reloaded.Equal(tr) {
+		t.Errorf("reloaded tree differs: %v", reloaded.StructuralDiff(tr))
+	}
+}
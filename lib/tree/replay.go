@@ -0,0 +1,103 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReplayWindowSize is how many generations behind the newest one a sender's messages may
+// arrive out of order; older ones are refused with ErrTooOld
+const ReplayWindowSize = 64
+
+var (
+	// ErrReplay is returned for a generation that was already received
+	ErrReplay = errors.New("message generation was already received")
+	// ErrTooOld is returned for a generation behind the replay window
+	ErrTooOld = errors.New("message generation is behind the replay window")
+)
+
+// replayWindow tracks the generations received on one sender's ratchet in an epoch
+type replayWindow struct {
+	Next uint32 `json:"next"`           // one past the newest generation received
+	Seen uint64 `json:"seen,omitempty"` // bit i is set once generation Next-1-i was received
+}
+
+// generationKey names the ratchet of a leaf in the generations map
+func generationKey(leaf uint32, ratchet uint8) string {
+	return fmt.Sprintf("%d/%d", leaf, ratchet)
+}
+
+// NextGeneration returns one past the newest generation recorded for the ratchet of
+// leaf in the current epoch, the generation a sender continues at after a restart
+func (t *Tree) NextGeneration(leaf uint32, ratchet uint8) uint32 {
+	if w, ok := t.generations[generationKey(leaf, ratchet)]; ok {
+		return w.Next
+	}
+	return 0
+}
+
+// CheckGeneration reports whether generation of leaf's ratchet may still be received in
+// the current epoch, failing with ErrReplay or ErrTooOld
+func (t *Tree) CheckGeneration(leaf uint32, ratchet uint8, generation uint32) error {
+	return t.generations[generationKey(leaf, ratchet)].check(generation)
+}
+
+// RecordGeneration marks generation of leaf's ratchet as received and persists it with
+// the manifest. Generations are forgotten when the epoch advances
+func (t *Tree) RecordGeneration(leaf uint32, ratchet uint8, generation uint32) error {
+	if err := t.checkWritable("record generation"); err != nil {
+		return err
+	}
+	key := generationKey(leaf, ratchet)
+	previous, ok := t.generations[key]
+	if err := previous.check(generation); err != nil {
+		return err
+	}
+	if t.generations == nil {
+		t.generations = make(map[string]*replayWindow)
+	}
+	w := &replayWindow{}
+	if ok {
+		*w = *previous
+	}
+	w.record(generation)
+	t.generations[key] = w
+	if err := t.saveManifest(); err != nil {
+		if ok {
+			t.generations[key] = previous
+		} else {
+			delete(t.generations, key)
+		}
+		return fmt.Errorf("failed to record generation: %w", err)
+	}
+	return nil
+}
+
+func (w *replayWindow) check(generation uint32) error {
+	if w == nil || generation >= w.Next {
+		return nil
+	}
+	behind := w.Next - 1 - generation
+	if behind >= ReplayWindowSize {
+		return fmt.Errorf("generation %d: %w", generation, ErrTooOld)
+	}
+	if w.Seen&(1<<behind) != 0 {
+		return fmt.Errorf("generation %d: %w", generation, ErrReplay)
+	}
+	return nil
+}
+
+func (w *replayWindow) record(generation uint32) {
+	if generation < w.Next {
+		w.Seen |= 1 << (w.Next - 1 - generation)
+		return
+	}
+	shift := generation + 1 - w.Next
+	if shift >= ReplayWindowSize {
+		w.Seen = 0
+	} else {
+		w.Seen <<= shift
+	}
+	w.Seen |= 1
+	w.Next = generation + 1
+}
@@ -0,0 +1,57 @@
+package tree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplayWindow(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := NewFileStore(dir)
+	tr, _ := NewTreeWithStore(files, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	if err := tr.InsertLeafNode("alice", testLeafNode(t, "alice")); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+
+	for _, generation := range []uint32{0, 3, 1} {
+		if err := tr.RecordGeneration(0, 1, generation); err != nil {
+			t.Fatalf("Failed to record generation %d: %v", generation, err)
+		}
+	}
+	if err := tr.RecordGeneration(0, 1, 3); !errors.Is(err, ErrReplay) {
+		t.Errorf("a generation should be received once, got %v", err)
+	}
+	if err := tr.CheckGeneration(0, 1, 2); err != nil {
+		t.Errorf("skipped generations should still be accepted: %v", err)
+	}
+	if err := tr.CheckGeneration(0, 0, 3); err != nil {
+		t.Errorf("ratchets should be tracked apart: %v", err)
+	}
+	if err := tr.RecordGeneration(0, 1, 3+ReplayWindowSize); err != nil {
+		t.Fatalf("Failed to record generation: %v", err)
+	}
+	if err := tr.CheckGeneration(0, 1, 2); !errors.Is(err, ErrTooOld) {
+		t.Errorf("generations behind the window should fail with ErrTooOld, got %v", err)
+	}
+	if err := tr.CheckGeneration(0, 1, 4); err != nil {
+		t.Errorf("generations inside the window should be accepted: %v", err)
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if next := reloaded.NextGeneration(0, 1); next != 4+ReplayWindowSize {
+		t.Errorf("generations should be persisted, next is %d", next)
+	}
+	if err := reloaded.RecordGeneration(0, 1, 3+ReplayWindowSize); !errors.Is(err, ErrReplay) {
+		t.Errorf("replays should be caught after a reload, got %v", err)
+	}
+
+	if err := reloaded.AdvanceEpoch(); err != nil {
+		t.Fatalf("Failed to advance epoch: %v", err)
+	}
+	if reloaded.NextGeneration(0, 1) != 0 {
+		t.Errorf("a new epoch should start with fresh generations")
+	}
+}
@@ -0,0 +1,60 @@
+package tree
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Resolution returns the nodes whose keys cover the subtree of the node at nodeIndex, its
+// RFC 9420 node index, following RFC 9420 section 4.1.1. A node with a key resolves to
+// itself followed by the unmerged leaves added below it since that key was set, a blank
+// intermediate to the resolutions of its children and a blank leaf to nothing.
+// Encrypting to every node of the resolution reaches every member below the node once
+func (t *Tree) Resolution(nodeIndex int) ([]*Element, error) {
+	node := t.GetNodeByIndex(nodeIndex)
+	if node == nil {
+		return nil, fmt.Errorf("node %d not found", nodeIndex)
+	}
+	return t.resolution(node), nil
+}
+
+// UnmergedLeaves returns the leaf indices, see LeafIndex, of the leaves added below the
+// node since its key was set. They do not know the node's private key
+func (e *Element) UnmergedLeaves() []int {
+	e.unshelve()
+	return slices.Clone(e.unmerged)
+}
+
+// resolution returns the nodes holding keys that cover node's subtree
+// Unmerged leaves are looked up by leaf index, see leafByIndex
+func (t *Tree) resolution(node *Element) []*Element {
+	if node == nil {
+		return nil
+	}
+	if len(node.key()) == 0 {
+		if node.IsLeaf() {
+			return nil
+		}
+		return append(t.resolution(node.leftChild), t.resolution(node.rightChild)...)
+	}
+	nodes := []*Element{node}
+	for _, index := range node.unmerged {
+		if leaf := t.leafByIndex(index); leaf != nil && len(leaf.key()) > 0 {
+			nodes = append(nodes, leaf)
+		}
+	}
+	return nodes
+}
+
+// addUnmerged records a leaf inserted below the element, when node already has a key
+func (e *Element) addUnmerged(leafIndex int) {
+	if len(e.key()) > 0 && !slices.Contains(e.unmerged, leafIndex) {
+		e.unmerged = append(e.unmerged, leafIndex)
+	}
+}
+
+// dropUnmerged forgets a leaf removed from below the element
+func (e *Element) dropUnmerged(leafIndex int) {
+	e.unshelve()
+	e.unmerged = slices.DeleteFunc(e.unmerged, func(index int) bool { return index == leafIndex })
+}
@@ -0,0 +1,125 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+// resolutionNames returns the names of the resolution of the node at index
+func resolutionNames(t *testing.T, tr *Tree, index int) []string {
+	t.Helper()
+	nodes, err := tr.Resolution(index)
+	if err != nil {
+		t.Fatalf("Failed to resolve node %d: %v", index, err)
+	}
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Name())
+	}
+	return names
+}
+
+func TestResolution(t *testing.T) {
+	for name, opt := range map[string]Option{"json": func(*Tree) {}, "binary": WithBinaryEncoding(), "flatbuffers": WithFlatBufferEncoding()} {
+		dir := t.TempDir()
+		tr, err := NewTree(dir, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")), opt)
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		for _, leaf := range []string{"alice", "bob", "charlie"} {
+			if err := tr.InsertLeafNode(leaf, testLeafNode(t, leaf)); err != nil {
+				t.Fatalf("Failed to insert %s: %v", leaf, err)
+			}
+		}
+
+		// Blank parents resolve to the leaves below them
+		if got := resolutionNames(t, tr, tr.Head().NodeIndex()); len(got) != 3 {
+			t.Errorf("%s: blank root should resolve to its 3 leaves, got %v", name, got)
+		}
+		if _, err := tr.Resolution(99); err == nil {
+			t.Errorf("%s: unknown nodes should not resolve", name)
+		}
+		// RFC 9420 node 1 is the parent of alice and bob, node 4 is charlie
+		if got := resolutionNames(t, tr, 1); !slices.Equal(got, []string{"alice", "bob"}) {
+			t.Errorf("%s: node 1 should resolve to alice and bob, got %v", name, got)
+		}
+		if got := resolutionNames(t, tr, 4); !slices.Equal(got, []string{"charlie"}) {
+			t.Errorf("%s: node 4 should resolve to charlie, got %v", name, got)
+		}
+
+		path, _ := tr.GetPath("alice")
+		if _, err := tr.SetPathKeys("alice", testPathKeys(t, len(path)-1)); err != nil {
+			t.Fatalf("Failed to set path keys: %v", err)
+		}
+		root := tr.Head().Name()
+		if got := resolutionNames(t, tr, tr.Head().NodeIndex()); !slices.Equal(got, []string{root}) {
+			t.Errorf("%s: keyed root should resolve to itself, got %v", name, got)
+		}
+
+		// A leaf added below keyed parents is unmerged at each of them; the tree is not
+		// full, so eve joins below the existing root
+		if err := tr.InsertLeafNode("eve", testLeafNode(t, "eve")); err != nil {
+			t.Fatalf("Failed to insert eve: %v", err)
+		}
+		eve, _ := tr.Find("eve")
+		if got := resolutionNames(t, tr, tr.Head().NodeIndex()); !slices.Equal(got, []string{root, "eve"}) {
+			t.Errorf("%s: root should resolve to itself and eve, got %v", name, got)
+		}
+
+		reloaded, err := LoadTree(dir, "", opt)
+		if err != nil {
+			t.Fatalf("Failed to reload tree: %v", err)
+		}
+		if got := reloaded.Head().UnmergedLeaves(); !slices.Equal(got, []int{eve.LeafIndex()}) {
+			t.Errorf("%s: unmerged leaves should survive a reload, got %v", name, got)
+		}
+
+		// A path update re-keys the root for everyone below it
+		path, _ = tr.GetPath("eve")
+		if _, err := tr.SetPathKeys("eve", testPathKeys(t, len(path)-1)); err != nil {
+			t.Fatalf("Failed to set path keys: %v", err)
+		}
+		if got := tr.Head().UnmergedLeaves(); len(got) != 0 {
+			t.Errorf("%s: a new key should clear the unmerged leaves, got %v", name, got)
+		}
+	}
+}
+
+func TestResolutionAcrossCopies(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, leaf := range []string{"alice", "bob", "dave"} {
+		if err := tr.InsertLeafNode(leaf, testLeafNode(t, leaf)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", leaf, err)
+		}
+	}
+	if _, err := tr.SetPathKeys("alice", testPathKeys(t, 2)); err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if err := tr.InsertLeafNode("charlie", testLeafNode(t, "charlie")); err != nil {
+		t.Fatalf("Failed to insert charlie: %v", err)
+	}
+	want := resolutionNames(t, tr, tr.Head().NodeIndex())
+	if len(want) != 2 || want[1] != "charlie" {
+		t.Fatalf("root should resolve to itself and charlie, got %v", want)
+	}
+
+	data, err := tr.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	imported, err := ImportRatchetTree(data, nil)
+	if err != nil {
+		t.Fatalf("Failed to import ratchet tree: %v", err)
+	}
+	if got := resolutionNames(t, imported, imported.Head().NodeIndex()); len(got) != 2 || got[1] != "charlie" {
+		t.Errorf("ratchet tree should carry unmerged leaves, got %v", got)
+	}
+
+	// Removing an unmerged leaf drops it from the resolution
+	if err := tr.Delete("charlie"); err != nil {
+		t.Fatalf("Failed to delete charlie: %v", err)
+	}
+	if got := tr.Head().UnmergedLeaves(); len(got) != 0 {
+		t.Errorf("removed leaves should not stay unmerged, got %v", got)
+	}
+}
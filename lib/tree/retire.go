@@ -0,0 +1,32 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrRetired is returned by mutations on a tree whose group was reinitialized
+var ErrRetired = errors.New("group has been retired")
+
+// Retire closes the group for good after a ReInit commit, recording the group ID of
+// its successor. The tree stays readable, but every later mutation fails with ErrRetired
+func (t *Tree) Retire(successorGroupID []byte) error {
+	if err := t.checkWritable("retire"); err != nil {
+		return err
+	}
+	if len(successorGroupID) == 0 {
+		return errors.New("retire: successor group ID is empty")
+	}
+	t.successor = slices.Clone(successorGroupID)
+	if err := t.saveManifest(); err != nil {
+		t.successor = nil
+		return fmt.Errorf("retire: %w", err)
+	}
+	return nil
+}
+
+// Successor returns the group ID of the group that replaced this one, nil while it is live
+func (t *Tree) Successor() []byte {
+	return t.successor
+}
@@ -0,0 +1,70 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrRevisionUnavailable is returned for revisions that were never committed or are no
+// longer retained
+var ErrRevisionUnavailable = errors.New("revision is not retained")
+
+// WithRevisionHistory keeps the tree at its last depth revisions for AtRevision
+// A revision is the tree version after a committed mutation, see Version. Every commit
+// records a Snapshot, which copies only the nodes the commit changed
+func WithRevisionHistory(depth int) Option {
+	return func(t *Tree) {
+		if depth > 0 {
+			t.revisionDepth = depth
+		}
+	}
+}
+
+// recordRevision snapshots the tree at its current version, dropping the oldest
+// revision beyond the retained depth
+func (t *Tree) recordRevision() {
+	if t.revisionDepth == 0 {
+		return
+	}
+	t.revisions = append(t.revisions, t.Snapshot())
+	if excess := len(t.revisions) - t.revisionDepth; excess > 0 {
+		t.revisions = append(t.revisions[:0:0], t.revisions[excess:]...)
+	}
+}
+
+// AtRevision returns the tree as it was committed at revision
+// The current version is always available; older ones while WithRevisionHistory
+// retains them. The returned snapshot stays consistent however many writes follow
+func (t *Tree) AtRevision(revision uint64) (*Snapshot, error) {
+	i := sort.Search(len(t.revisions), func(i int) bool { return t.revisions[i].version >= revision })
+	if i < len(t.revisions) && t.revisions[i].version == revision {
+		return t.revisions[i], nil
+	}
+	if revision == t.version {
+		return t.Snapshot(), nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrRevisionUnavailable, revision)
+}
+
+// AtEpoch returns the last retained revision committed in epoch
+func (t *Tree) AtEpoch(epoch uint64) (*Snapshot, error) {
+	if epoch == t.epoch {
+		return t.AtRevision(t.version)
+	}
+	for i := len(t.revisions) - 1; i >= 0; i-- {
+		if t.revisions[i].epoch == epoch {
+			return t.revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no revision of epoch %d", ErrRevisionUnavailable, epoch)
+}
+
+// Revisions returns the retained revisions, oldest first
+func (t *Tree) Revisions() []uint64 {
+	revisions := make([]uint64, len(t.revisions))
+	for i, snapshot := range t.revisions {
+		revisions[i] = snapshot.version
+	}
+	return revisions
+}
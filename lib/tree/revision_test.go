@@ -0,0 +1,68 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAtRevision(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithRevisionHistory(3))
+	structures := make(map[uint64]int)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		structures[tr.Version()] = len(tr.GetTreeStructure())
+	}
+
+	revisions := tr.Revisions()
+	if len(revisions) != 3 || revisions[2] != tr.Version() {
+		t.Fatalf("retained revisions = %v, want the last 3 ending at %d", revisions, tr.Version())
+	}
+	for _, revision := range revisions {
+		snap, err := tr.AtRevision(revision)
+		if err != nil {
+			t.Fatalf("revision %d: %v", revision, err)
+		}
+		if got := len(snap.GetTreeStructure()); got != structures[revision] {
+			t.Errorf("revision %d has %d nodes, want %d", revision, got, structures[revision])
+		}
+	}
+	if _, err := tr.AtRevision(revisions[0] - 1); !errors.Is(err, ErrRevisionUnavailable) {
+		t.Errorf("pruned revision should be unavailable, got %v", err)
+	}
+	if _, err := tr.AtRevision(tr.Version() + 1); !errors.Is(err, ErrRevisionUnavailable) {
+		t.Errorf("future revision should be unavailable, got %v", err)
+	}
+
+	// Earlier revisions stay consistent as writes continue
+	old, _ := tr.AtRevision(revisions[0])
+	if err := tr.Delete("user_0"); err != nil {
+		t.Fatalf("Failed to delete user_0: %v", err)
+	}
+	if _, found := old.Find("user_0"); !found {
+		t.Errorf("revision %d should still hold user_0", revisions[0])
+	}
+	current, err := tr.AtEpoch(tr.Epoch())
+	if err != nil || current.Version() != tr.Version() {
+		t.Errorf("AtEpoch(current) = %v, %v, want revision %d", current, err, tr.Version())
+	}
+	if _, found := current.Find("user_0"); found {
+		t.Errorf("the current revision should not hold user_0")
+	}
+}
+
+func TestAtRevisionWithoutHistory(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	if err := tr.Insert("alice", []byte("alice_key")); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+	if _, err := tr.AtRevision(tr.Version()); err != nil {
+		t.Errorf("the current revision should always be available: %v", err)
+	}
+	if _, err := tr.AtRevision(0); !errors.Is(err, ErrRevisionUnavailable) {
+		t.Errorf("older revisions need WithRevisionHistory, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Package shadow mirrors tree mutations onto a candidate engine for safe migrations
+package shadow
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Divergence describes a mutation after which the candidate no longer matches the primary
+type Divergence struct {
+	Op            string // operation name, e.g. "insert"
+	Target        string // node the operation was applied to
+	PrimaryErr    error  // error returned by the primary tree
+	CandidateErr  error  // error returned by the candidate tree
+	PrimaryHash   []byte // primary structure hash after the operation
+	CandidateHash []byte // candidate structure hash after the operation
+	Detail        string // human readable explanation of the first difference found
+}
+
+// Tree applies every mutation to a primary and a candidate tree and compares them
+// Reads are always served by the primary, so callers observe the current engine only
+type Tree struct {
+	primary      *tree.Tree
+	candidate    *tree.Tree
+	onDivergence func(Divergence)
+	divergences  []Divergence
+}
+
+// Option configures a shadow Tree
+type Option func(*Tree)
+
+// WithDivergenceHandler registers a callback invoked for every detected divergence
+func WithDivergenceHandler(handler func(Divergence)) Option {
+	return func(s *Tree) {
+		s.onDivergence = handler
+	}
+}
+
+// New creates a shadow tree over primary and candidate
+func New(primary, candidate *tree.Tree, opts ...Option) *Tree {
+	s := &Tree{
+		primary:   primary,
+		candidate: candidate,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Primary returns the tree serving reads
+func (s *Tree) Primary() *tree.Tree {
+	return s.primary
+}
+
+// Candidate returns the tree being validated
+func (s *Tree) Candidate() *tree.Tree {
+	return s.candidate
+}
+
+// Divergences returns every divergence detected so far
+func (s *Tree) Divergences() []Divergence {
+	return s.divergences
+}
+
+// Insert inserts into both trees and returns the primary's result
+func (s *Tree) Insert(name string, value []byte) error {
+	err := s.primary.Insert(name, value)
+	s.compare("insert", name, err, s.candidate.Insert(name, value))
+	return err
+}
+
+// Delete deletes from both trees and returns the primary's result
+func (s *Tree) Delete(name string) error {
+	err := s.primary.Delete(name)
+	s.compare("delete", name, err, s.candidate.Delete(name))
+	return err
+}
+
+// SetIntermediateNodeKey sets the key on the intermediate node at the same position in both trees
+// Intermediate names differ per engine, so the candidate node is located by node index
+func (s *Tree) SetIntermediateNodeKey(nodeName string, publicKey []byte) error {
+	node, found := s.primary.Find(nodeName)
+	err := s.primary.SetIntermediateNodeKey(nodeName, publicKey)
+
+	var candidateErr error
+	if !found {
+		candidateErr = fmt.Errorf("node not found: %s", nodeName)
+	} else if peer := s.candidate.GetNodeByIndex(node.NodeIndex()); peer == nil {
+		candidateErr = fmt.Errorf("node not found at index %d", node.NodeIndex())
+	} else {
+		candidateErr = s.candidate.SetIntermediateNodeKey(peer.Name(), publicKey)
+	}
+
+	s.compare("set_intermediate_key", nodeName, err, candidateErr)
+	return err
+}
+
+// Find looks a node up in the primary tree
+func (s *Tree) Find(name string) (*tree.Element, bool) {
+	return s.primary.Find(name)
+}
+
+// compare records a divergence if the outcomes or the resulting trees differ
+func (s *Tree) compare(op, target string, primaryErr, candidateErr error) {
+	primaryHash := s.primary.StructureHash()
+	candidateHash := s.candidate.StructureHash()
+
+	var detail string
+	switch {
+	case (primaryErr == nil) != (candidateErr == nil):
+		detail = fmt.Sprintf("error mismatch: primary=%v candidate=%v", primaryErr, candidateErr)
+	case !bytes.Equal(primaryHash, candidateHash):
+		detail = describeDifference(s.primary, s.candidate)
+	default:
+		return
+	}
+
+	d := Divergence{
+		Op:            op,
+		Target:        target,
+		PrimaryErr:    primaryErr,
+		CandidateErr:  candidateErr,
+		PrimaryHash:   primaryHash,
+		CandidateHash: candidateHash,
+		Detail:        detail,
+	}
+	s.divergences = append(s.divergences, d)
+	if s.onDivergence != nil {
+		s.onDivergence(d)
+	}
+}
+
+// describeDifference finds the first node index where the two trees disagree
+func describeDifference(primary, candidate *tree.Tree) string {
+	primaryLeaves := leafNames(primary)
+	candidateLeaves := leafNames(candidate)
+	if len(primaryLeaves) != len(candidateLeaves) {
+		return fmt.Sprintf("leaf count mismatch: primary=%d candidate=%d", len(primaryLeaves), len(candidateLeaves))
+	}
+	for i := range primaryLeaves {
+		if primaryLeaves[i] != candidateLeaves[i] {
+			return fmt.Sprintf("leaf set mismatch: primary has %s, candidate has %s", primaryLeaves[i], candidateLeaves[i])
+		}
+	}
+
+	for index := 0; ; index++ {
+		p := primary.GetNodeByIndex(index)
+		c := candidate.GetNodeByIndex(index)
+		if p == nil && c == nil {
+			break
+		}
+		if p == nil || c == nil {
+			return fmt.Sprintf("node %d exists in only one tree", index)
+		}
+		if p.IsLeaf() != c.IsLeaf() {
+			return fmt.Sprintf("node %d type mismatch", index)
+		}
+		if p.IsLeaf() && p.Name() != c.Name() {
+			return fmt.Sprintf("node %d holds %s in primary but %s in candidate", index, p.Name(), c.Name())
+		}
+		if !bytes.Equal(p.Value(), c.Value()) {
+			return fmt.Sprintf("node %d public key mismatch", index)
+		}
+	}
+
+	return "structure hash mismatch"
+}
+
+// leafNames returns the sorted leaf names of a tree
+func leafNames(t *tree.Tree) []string {
+	var names []string
+	for _, leaf := range t.GetLeaves() {
+		names = append(names, leaf.Name())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package shadow
+
+import (
+	"os"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/tree/memory"
+)
+
+func TestShadowTreeMatchingEngines(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "shadow_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	primary, err := tree.NewTree(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	var reported []Divergence
+	s := New(primary, memory.NewTree(), WithDivergenceHandler(func(d Divergence) {
+		reported = append(reported, d)
+	}))
+
+	for _, user := range []string{"alice", "bob", "charlie", "david", "eve"} {
+		if err := s.Insert(user, []byte(user+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", user, err)
+		}
+	}
+	if err := s.SetIntermediateNodeKey(primary.Head().Name(), []byte("root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+	if err := s.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+
+	if len(reported) != 0 {
+		t.Fatalf("expected no divergences, got %+v", reported)
+	}
+}
+
+func TestShadowTreeReportsDivergence(t *testing.T) {
+	candidate := memory.NewTree()
+	candidate.Insert("mallory", []byte("mallory_key"))
+
+	s := New(memory.NewTree(), candidate)
+	if err := s.Insert("alice", []byte("alice_key")); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+
+	divergences := s.Divergences()
+	if len(divergences) != 1 {
+		t.Fatalf("expected 1 divergence, got %d", len(divergences))
+	}
+	if divergences[0].Op != "insert" || divergences[0].Target != "alice" {
+		t.Errorf("unexpected divergence: %+v", divergences[0])
+	}
+	t.Logf("divergence detail: %s", divergences[0].Detail)
+}
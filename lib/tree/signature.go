@@ -0,0 +1,140 @@
+package tree
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// ErrInvalidSignature is returned when a signature does not verify under its signature key
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// WithGroupID sets the group ID covered by the signatures of update and commit leaves
+// It is recorded in the manifest and restored by LoadTree
+func WithGroupID(id []byte) Option {
+	return func(t *Tree) {
+		t.groupID = append([]byte(nil), id...)
+	}
+}
+
+// GroupID returns the group ID leaf signatures are verified against
+func (t *Tree) GroupID() []byte {
+	return t.groupID
+}
+
+// signContent builds SignContent from RFC 9420 section 5.1.2
+func signContent(label string, content []byte) ([]byte, error) {
+	w := &tls.Writer{}
+	if err := w.Opaque([]byte("MLS 1.0 " + label)); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(content); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// SignWithLabel implements SignWithLabel from RFC 9420 section 5.1.2
+// signer is an ed25519.PrivateKey or a P-256 *ecdsa.PrivateKey; ECDSA signs the SHA-256 digest
+func SignWithLabel(signer crypto.Signer, label string, content []byte) ([]byte, error) {
+	msg, err := signContent(label, content)
+	if err != nil {
+		return nil, err
+	}
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", pub.Curve.Params().Name)
+		}
+		digest := sha256.Sum256(msg)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return nil, fmt.Errorf("unsupported signer %T", signer.Public())
+}
+
+// VerifyWithLabel implements VerifyWithLabel from RFC 9420 section 5.1.2
+// The signature scheme is the ciphersuite's; without a ciphersuite it follows from the
+// key size, 32 bytes for Ed25519 and 65 for an uncompressed P-256 point
+func VerifyWithLabel(cs Ciphersuite, publicKey []byte, label string, content, signature []byte) error {
+	msg, err := signContent(label, content)
+	if err != nil {
+		return err
+	}
+	switch signatureAlgorithm(cs, publicKey) {
+	case KeyAlgorithmEd25519:
+		if len(publicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("ed25519 signature key has %d bytes", len(publicKey))
+		}
+		if !ed25519.Verify(publicKey, msg, signature) {
+			return ErrInvalidSignature
+		}
+	case KeyAlgorithmP256:
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), publicKey)
+		if err != nil {
+			return fmt.Errorf("invalid p256 signature key: %w", err)
+		}
+		digest := sha256.Sum256(msg)
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("no signature scheme for a %d byte key in ciphersuite 0x%04x", len(publicKey), uint16(cs))
+	}
+	return nil
+}
+
+// signatureAlgorithm picks the signature scheme for a key
+func signatureAlgorithm(cs Ciphersuite, publicKey []byte) KeyAlgorithm {
+	if cs != 0 {
+		return cs.SignatureAlgorithm()
+	}
+	switch len(publicKey) {
+	case ed25519.PublicKeySize:
+		return KeyAlgorithmEd25519
+	case 65:
+		return KeyAlgorithmP256
+	}
+	return KeyAlgorithmUnknown
+}
+
+// SignaturePublicKey returns the MLS wire encoding of signer's public key
+func SignaturePublicKey(signer crypto.Signer) ([]byte, error) {
+	return signatureKeyBytes(signer.Public())
+}
+
+// Sign sets the leaf node's signature key and signs it with signer
+// groupID and leafIndex are the group context covered by update and commit leaves;
+// KeyPackage leaves ignore them
+func (n *LeafNode) Sign(signer crypto.Signer, groupID []byte, leafIndex uint32) error {
+	key, err := SignaturePublicKey(signer)
+	if err != nil {
+		return err
+	}
+	n.SignatureKey = key
+	tbs, err := n.MarshalTBS(groupID, leafIndex)
+	if err != nil {
+		return err
+	}
+	if n.Signature, err = SignWithLabel(signer, "LeafNodeTBS", tbs); err != nil {
+		return fmt.Errorf("failed to sign leaf node: %w", err)
+	}
+	return nil
+}
+
+// VerifySignature checks the leaf node was signed by its own signature key
+func (n *LeafNode) VerifySignature(cs Ciphersuite, groupID []byte, leafIndex uint32) error {
+	tbs, err := n.MarshalTBS(groupID, leafIndex)
+	if err != nil {
+		return err
+	}
+	return VerifyWithLabel(cs, n.SignatureKey, "LeafNodeTBS", tbs, n.Signature)
+}
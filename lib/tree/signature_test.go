@@ -0,0 +1,96 @@
+package tree
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSignWithLabel(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for name, tc := range map[string]struct {
+		signer crypto.Signer
+		cs     Ciphersuite
+	}{
+		"ed25519": {edKey, MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519},
+		"p256":    {p256Key, MLS_128_DHKEMP256_AES128GCM_SHA256_P256},
+	} {
+		sig, err := SignWithLabel(tc.signer, "Test", []byte("content"))
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", name, err)
+		}
+		pub, err := SignaturePublicKey(tc.signer)
+		if err != nil {
+			t.Fatalf("%s: failed to encode public key: %v", name, err)
+		}
+		for _, cs := range []Ciphersuite{tc.cs, 0} {
+			if err := VerifyWithLabel(cs, pub, "Test", []byte("content"), sig); err != nil {
+				t.Errorf("%s: signature should verify under suite 0x%04x: %v", name, uint16(cs), err)
+			}
+		}
+		if err := VerifyWithLabel(tc.cs, pub, "Other", []byte("content"), sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: signature under another label should fail, got %v", name, err)
+		}
+		if err := VerifyWithLabel(tc.cs, pub, "Test", []byte("tampered"), sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: tampered content should fail, got %v", name, err)
+		}
+	}
+}
+
+func TestLeafSignatureEnforced(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+
+	forged := testLeafNode(t, "mallory")
+	forged.Signature[0] ^= 0xff
+	if err := tr.InsertLeafNode("mallory", forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged leaf signature should be rejected, got %v", err)
+	}
+	swapped := testLeafNode(t, "mallory")
+	swapped.SignatureKey = testLeafNode(t, "eve").SignatureKey
+	if err := tr.InsertLeafNode("mallory", swapped); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("leaf signed by another key should be rejected, got %v", err)
+	}
+
+	tr.InsertLeafNode("alice", testLeafNode(t, "alice"))
+	tr.InsertLeafNode("bob", testLeafNode(t, "bob"))
+	if err := tr.UpdateLeafNode("alice", testLeafNode(t, "alice")); err == nil {
+		t.Errorf("key package leaves cannot update a member")
+	}
+	if err := tr.InsertLeafNode("carol", testUpdateLeafNode(t, tr, "carol", "carol")); err == nil {
+		t.Errorf("update leaves cannot join the tree")
+	}
+	// An update signed for bob's position cannot be replayed onto alice
+	if err := tr.UpdateLeafNode("alice", testUpdateLeafNode(t, tr, "bob", "alice")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("update signed for another leaf index should be rejected, got %v", err)
+	}
+	other, _ := NewTreeWithStore(nil, WithGroupID([]byte("other")))
+	other.InsertLeafNode("alice", testLeafNode(t, "alice"))
+	if err := tr.UpdateLeafNode("alice", testUpdateLeafNode(t, other, "alice", "alice")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("update signed for another group should be rejected, got %v", err)
+	}
+	if err := tr.UpdateLeafNode("alice", testUpdateLeafNode(t, tr, "alice", "alice")); err != nil {
+		t.Errorf("properly signed update should be accepted: %v", err)
+	}
+}
+
+func TestGroupIDPersists(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tr, _ := NewTreeWithStore(files, WithGroupID([]byte("group")))
+	tr.InsertLeafNode("alice", testLeafNode(t, "alice"))
+
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if string(loaded.GroupID()) != "group" {
+		t.Errorf("group ID should survive a reload, got %q", loaded.GroupID())
+	}
+	if _, err := LoadTreeFromStore(files, "", WithGroupID([]byte("other"))); err == nil {
+		t.Errorf("loading with another group ID should fail")
+	}
+}
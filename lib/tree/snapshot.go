@@ -0,0 +1,393 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Snapshot is an immutable view of the tree at one version
+// Its nodes are copies that later mutations never touch, so readers may traverse it
+// from other goroutines while writers keep changing the live tree
+type Snapshot struct {
+	root         *SnapshotNode
+	size         int            // number of nodes
+	names        *snapshotNames // node indices by name, see Find
+	unevenLeaves bool           // some leaf i is not node 2i, see leafByIndex
+	version      uint64
+	epoch        uint64
+}
+
+// SnapshotNode is a node of a Snapshot, shared by every snapshot it did not change in
+type SnapshotNode struct {
+	info        NodeInfo
+	left, right *SnapshotNode
+	history     []KeyRecord // previous keys, never edited in place by the tree
+	version     uint64      // element version the copy was taken at
+	leafNode    *LeafNode   // leaf contents the copy was taken from
+}
+
+// snapshotNames maps node names to node indices for every snapshot taken while no node
+// was added, removed, renamed or renumbered. It is built by the first lookup, so taking
+// a snapshot does not pay for it
+type snapshotNames struct {
+	once    sync.Once
+	indices map[string]int
+}
+
+// Snapshot returns the current state of the tree as an immutable view
+// Nodes are copied on write: the tree records the elements changed since the previous
+// snapshot, and only those and their ancestors are copied again while every other node
+// is shared with it, so a snapshot costs work in proportion to what changed. After the
+// tree is renumbered every node is compared with its previous copy instead. Taking a
+// snapshot reads the live tree and must not run concurrently with mutations
+func (t *Tree) Snapshot() *Snapshot {
+	var root *SnapshotNode
+	if t.dirty == nil {
+		root = t.freezeAll()
+	} else {
+		root = t.freezeDirty()
+	}
+	t.dirty = make(map[*Element]struct{})
+	if t.snapshotNames == nil {
+		t.snapshotNames = new(snapshotNames)
+	}
+
+	return &Snapshot{
+		root:         root,
+		size:         len(t.nodes),
+		names:        t.snapshotNames,
+		unevenLeaves: t.unevenLeaves,
+		version:      t.version,
+		epoch:        t.epoch,
+	}
+}
+
+// freezeAll copies the tree, reusing every previous copy that still matches its element
+func (t *Tree) freezeAll() *SnapshotNode {
+	previous := t.snapshotNodes
+	t.snapshotNodes = make(map[*Element]*SnapshotNode, len(t.nodes))
+
+	var freeze func(e *Element) *SnapshotNode
+	freeze = func(e *Element) *SnapshotNode {
+		if e == nil {
+			return nil
+		}
+		left, right := freeze(e.leftChild), freeze(e.rightChild)
+		node := previous[e]
+		if node == nil || !node.current(e, left, right) {
+			node = newSnapshotNode(e, left, right)
+		}
+		t.snapshotNodes[e] = node
+		return node
+	}
+	return freeze(t.head)
+}
+
+// freezeDirty copies the elements changed since the previous snapshot and their
+// ancestors, whose children changed with them, and shares every other copy
+func (t *Tree) freezeDirty() *SnapshotNode {
+	changed := make(map[*Element]bool, len(t.dirty))
+	for e := range t.dirty {
+		for node := e; node != nil && !changed[node]; node = node.parent {
+			changed[node] = true
+		}
+	}
+
+	var freeze func(e *Element) *SnapshotNode
+	freeze = func(e *Element) *SnapshotNode {
+		if e == nil {
+			return nil
+		}
+		if node, ok := t.snapshotNodes[e]; ok && !changed[e] {
+			return node
+		}
+		node := newSnapshotNode(e, freeze(e.leftChild), freeze(e.rightChild))
+		t.snapshotNodes[e] = node
+		return node
+	}
+	return freeze(t.head)
+}
+
+// touch records e as changed for the next Snapshot
+// Nothing is recorded before the first snapshot or after renumbering, when the next
+// snapshot compares every node anyway
+func (e *Element) touch() {
+	if t := e.owner; t != nil && t.dirty != nil {
+		t.dirty[e] = struct{}{}
+	}
+}
+
+// newSnapshotNode copies e, keeping nothing the live element may later write to
+func newSnapshotNode(e *Element, left, right *SnapshotNode) *SnapshotNode {
+	info := e.Info()
+	info.PublicKey = bytes.Clone(info.PublicKey)
+	info.ParentHash = bytes.Clone(info.ParentHash)
+	return &SnapshotNode{
+		info:     info,
+		left:     left,
+		right:    right,
+		history:  e.history,
+		version:  e.version,
+		leafNode: e.leafNode,
+	}
+}
+
+// current reports whether the copy still matches e with the given child copies
+// A shelved element keeps its payload unchanged in the store, so its version suffices
+func (n *SnapshotNode) current(e *Element, left, right *SnapshotNode) bool {
+	info := &n.info
+	if n.left != left || n.right != right || n.version != e.version ||
+		info.Name != e.name || info.NodeType != e.nodeType || info.LeafIndex != e.leafIndex ||
+		info.NodeIndex != e.nodeIndex || info.ParentIndex != e.ParentIndex() {
+		return false
+	}
+	if e.shelved {
+		return true
+	}
+	return n.leafNode == e.leafNode && bytes.Equal(info.PublicKey, e.publicKey) &&
+		info.KeyAlgorithm == e.keyAlgorithm && info.KeyEncoding == e.keyEncoding &&
+		bytes.Equal(info.ParentHash, e.parentHash) && slices.Equal(info.Unmerged, e.unmerged)
+}
+
+// Version returns the tree version the snapshot was taken at, see Tree.Version
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Epoch returns the epoch the snapshot was taken in
+func (s *Snapshot) Epoch() uint64 {
+	return s.epoch
+}
+
+// Root returns the root node, nil for an empty tree
+func (s *Snapshot) Root() *SnapshotNode {
+	return s.root
+}
+
+// Find returns the node named name
+func (s *Snapshot) Find(name string) (*SnapshotNode, bool) {
+	s.names.once.Do(func() {
+		s.names.indices = make(map[string]int, s.size)
+		s.walk(func(node *SnapshotNode) {
+			if _, taken := s.names.indices[node.info.Name]; !taken {
+				s.names.indices[node.info.Name] = node.info.NodeIndex
+			}
+		})
+	})
+	index, ok := s.names.indices[name]
+	if !ok {
+		return nil, false
+	}
+	return s.Node(index)
+}
+
+// Node returns the node at nodeIndex
+// Node indices follow the in-order position of the nodes, so the node is found by
+// descending from the root
+func (s *Snapshot) Node(nodeIndex int) (*SnapshotNode, bool) {
+	node := s.root
+	for node != nil && node.info.NodeIndex != nodeIndex {
+		if nodeIndex < node.info.NodeIndex {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return node, node != nil
+}
+
+// Len returns the number of nodes
+func (s *Snapshot) Len() int {
+	return s.size
+}
+
+// walk calls fn for every node in node index order
+func (s *Snapshot) walk(fn func(*SnapshotNode)) {
+	var visit func(*SnapshotNode)
+	visit = func(node *SnapshotNode) {
+		if node == nil {
+			return
+		}
+		visit(node.left)
+		fn(node)
+		visit(node.right)
+	}
+	visit(s.root)
+}
+
+// GetLeaves returns the leaves from left to right
+func (s *Snapshot) GetLeaves() []*SnapshotNode {
+	var leaves []*SnapshotNode
+	var collect func(*SnapshotNode)
+	collect = func(node *SnapshotNode) {
+		if node == nil {
+			return
+		}
+		if node.IsLeaf() {
+			leaves = append(leaves, node)
+			return
+		}
+		collect(node.left)
+		collect(node.right)
+	}
+	collect(s.root)
+	return leaves
+}
+
+// GetTreeStructure returns the snapshot structure like Tree.GetTreeStructure
+func (s *Snapshot) GetTreeStructure() map[string]*NodeInfo {
+	structure := make(map[string]*NodeInfo, s.size)
+	s.walk(func(node *SnapshotNode) {
+		info := node.Info()
+		structure[info.Name] = &info
+	})
+	return structure
+}
+
+// GetPath returns the path from the root to the leaf named leafName, see Tree.GetPath
+func (s *Snapshot) GetPath(leafName string) ([]*SnapshotNode, error) {
+	if s.root == nil {
+		return nil, fmt.Errorf("tree is empty")
+	}
+	leaf, found := s.Find(leafName)
+	if !found {
+		return nil, fmt.Errorf("leaf node not found: %s", leafName)
+	}
+
+	var path []*SnapshotNode
+	for node := s.root; node != leaf; {
+		path = append(path, node)
+		if leaf.info.NodeIndex < node.info.NodeIndex {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return append(path, leaf), nil
+}
+
+// Resolution returns the resolution of the node at nodeIndex, see Tree.Resolution
+func (s *Snapshot) Resolution(nodeIndex int) ([]*SnapshotNode, error) {
+	node, ok := s.Node(nodeIndex)
+	if !ok {
+		return nil, fmt.Errorf("node %d not found", nodeIndex)
+	}
+	return s.resolution(node), nil
+}
+
+// resolution returns the nodes holding keys that cover node's subtree
+func (s *Snapshot) resolution(node *SnapshotNode) []*SnapshotNode {
+	if node == nil {
+		return nil
+	}
+	if len(node.info.PublicKey) == 0 {
+		if node.IsLeaf() {
+			return nil
+		}
+		return append(s.resolution(node.left), s.resolution(node.right)...)
+	}
+	nodes := []*SnapshotNode{node}
+	for _, index := range node.info.Unmerged {
+		if leaf := s.leafByIndex(index); leaf != nil && len(leaf.info.PublicKey) > 0 {
+			nodes = append(nodes, leaf)
+		}
+	}
+	return nodes
+}
+
+// leafByIndex returns the leaf with the given leaf index, see Tree.leafByIndex
+func (s *Snapshot) leafByIndex(leafIndex int) *SnapshotNode {
+	if leafIndex < 0 {
+		return nil
+	}
+	if !s.unevenLeaves {
+		if node, ok := s.Node(2 * leafIndex); ok && node.info.NodeType == "leaf" {
+			return node
+		}
+		return nil
+	}
+	for _, leaf := range s.GetLeaves() {
+		if leaf.info.NodeType == "leaf" && leaf.info.LeafIndex == leafIndex {
+			return leaf
+		}
+	}
+	return nil
+}
+
+// StructureHash returns the structure hash of the snapshot, see Tree.StructureHash
+func (s *Snapshot) StructureHash() []byte {
+	var hash func(*SnapshotNode) []byte
+	hash = func(node *SnapshotNode) []byte {
+		if node == nil {
+			return hashNode(false, "", "", nil, nil, nil)
+		}
+		return hashNode(true, node.info.NodeType, node.info.Name, node.info.PublicKey, hash(node.left), hash(node.right))
+	}
+	return hash(s.root)
+}
+
+// Info describes the node; its slices are copies the caller may keep
+func (n *SnapshotNode) Info() NodeInfo {
+	info := n.info
+	info.PublicKey = bytes.Clone(info.PublicKey)
+	info.LeafNode = bytes.Clone(info.LeafNode)
+	info.ParentHash = bytes.Clone(info.ParentHash)
+	info.Unmerged = slices.Clone(info.Unmerged)
+	return info
+}
+
+// Name returns the node name
+func (n *SnapshotNode) Name() string {
+	return n.info.Name
+}
+
+// PublicKey returns a copy of the node's public key, empty for blank nodes
+func (n *SnapshotNode) PublicKey() []byte {
+	return bytes.Clone(n.info.PublicKey)
+}
+
+// NodeIndex returns the node's index in the snapshot
+func (n *SnapshotNode) NodeIndex() int {
+	return n.info.NodeIndex
+}
+
+// LeafIndex returns the leaf index of a leaf
+func (n *SnapshotNode) LeafIndex() int {
+	return n.info.LeafIndex
+}
+
+// IsBlank reports whether the node holds no key, see Element.IsBlank
+func (n *SnapshotNode) IsBlank() bool {
+	return len(n.info.PublicKey) == 0
+}
+
+// UnmergedLeaves returns the leaf indices unmerged at the node, see Element.UnmergedLeaves
+func (n *SnapshotNode) UnmergedLeaves() []int {
+	return slices.Clone(n.info.Unmerged)
+}
+
+// KeyHistory returns up to limit previous keys of the node, see Element.KeyHistory
+func (n *SnapshotNode) KeyHistory(limit int) []KeyRecord {
+	count := len(n.history)
+	if limit > 0 && limit < count {
+		count = limit
+	}
+	return append([]KeyRecord(nil), n.history[:count]...)
+}
+
+// Left returns the left child, nil when there is none
+func (n *SnapshotNode) Left() *SnapshotNode {
+	return n.left
+}
+
+// Right returns the right child, nil when there is none
+func (n *SnapshotNode) Right() *SnapshotNode {
+	return n.right
+}
+
+// IsLeaf reports whether the node has no children
+func (n *SnapshotNode) IsLeaf() bool {
+	return n.left == nil && n.right == nil
+}
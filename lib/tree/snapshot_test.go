@@ -0,0 +1,166 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	tr, err := NewTree(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	snap := tr.Snapshot()
+	rootKey := snap.Root().PublicKey()
+
+	if err := tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("rotated_root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+	if err := tr.Delete("bob"); err != nil {
+		t.Fatalf("Failed to delete bob: %v", err)
+	}
+	if err := tr.Insert("eve", []byte("eve_key")); err != nil {
+		t.Fatalf("Failed to insert eve: %v", err)
+	}
+
+	if snap.Version() == tr.Version() {
+		t.Errorf("the snapshot should stay at its version")
+	}
+	if !bytes.Equal(snap.Root().PublicKey(), rootKey) {
+		t.Errorf("snapshot root key changed to %q", snap.Root().PublicKey())
+	}
+	if _, found := snap.Find("eve"); found {
+		t.Errorf("eve joined after the snapshot")
+	}
+	bob, found := snap.Find("bob")
+	if !found || string(bob.PublicKey()) != "bob_key" {
+		t.Errorf("snapshot should still hold bob")
+	}
+	var names []string
+	for _, leaf := range snap.GetLeaves() {
+		names = append(names, leaf.Name())
+	}
+	if fmt.Sprint(names) != "[alice bob charlie dave]" {
+		t.Errorf("snapshot leaves = %v", names)
+	}
+	if got := len(snap.GetTreeStructure()); got != snap.Len() {
+		t.Errorf("structure has %d nodes, want %d", got, snap.Len())
+	}
+}
+
+func TestSnapshotSharesUnchangedNodes(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	first := tr.Snapshot()
+
+	if err := tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")); err != nil {
+		t.Fatalf("Failed to set root key: %v", err)
+	}
+	second := tr.Snapshot()
+
+	if first.Root() == second.Root() {
+		t.Errorf("the changed root should be copied")
+	}
+	if first.Root().Left() != second.Root().Left() || first.Root().Right() != second.Root().Right() {
+		t.Errorf("unchanged subtrees should be shared")
+	}
+	if len(first.Root().PublicKey()) != 0 || string(second.Root().PublicKey()) != "root_key" {
+		t.Errorf("each snapshot should keep its own root key")
+	}
+
+	third := tr.Snapshot()
+	for i := 0; i < third.Len(); i++ {
+		a, _ := second.Node(i)
+		b, _ := third.Node(i)
+		if a != b {
+			t.Errorf("node %d copied although nothing changed", i)
+		}
+	}
+}
+
+func TestSnapshotCopiesOnlyChangedNodes(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithKeyHistory(2))
+	check := func(step string) *Snapshot {
+		t.Helper()
+		snap := tr.Snapshot()
+		if !reflect.DeepEqual(snap.GetTreeStructure(), tr.GetTreeStructure()) {
+			t.Fatalf("%s: snapshot structure differs from the tree", step)
+		}
+		if !bytes.Equal(snap.StructureHash(), tr.StructureHash()) {
+			t.Fatalf("%s: snapshot hash differs from the tree", step)
+		}
+		for _, e := range tr.nodes {
+			node, ok := snap.Node(e.NodeIndex())
+			if !ok || node.Name() != e.Name() || len(node.KeyHistory(0)) != len(e.KeyHistory(0)) {
+				t.Fatalf("%s: node %d does not match %s", step, e.NodeIndex(), e.Name())
+			}
+			if found, ok := snap.Find(e.Name()); !ok || found != node {
+				t.Fatalf("%s: %s is not found by name", step, e.Name())
+			}
+		}
+		return snap
+	}
+
+	for i := 0; i < 16; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		check("insert " + name)
+	}
+	before := check("steady")
+
+	// A key change on one path copies that path and shares everything else
+	path, _ := tr.GetPath("user_5")
+	if err := tr.SetIntermediateNodeKey(path[len(path)-2].Name(), []byte("parent_key")); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	after := check("set key")
+	copied := 0
+	for i := 0; i < after.Len(); i++ {
+		a, _ := before.Node(i)
+		b, _ := after.Node(i)
+		if a != b {
+			copied++
+		}
+	}
+	if copied != len(path)-1 {
+		t.Errorf("copied %d nodes, want the %d nodes above user_5", copied, len(path)-1)
+	}
+
+	steps := []struct {
+		name string
+		op   func() error
+	}{
+		{"blank", func() error { return tr.Blank("user_3") }},
+		{"refill", func() error { return tr.Insert("user_16", []byte("user_16_key")) }},
+		{"delete last", func() error { return tr.Delete("user_15") }},
+		{"rotate root", func() error { return tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key")) }},
+		{"rotate root again", func() error { return tr.SetIntermediateNodeKey(tr.Head().Name(), []byte("root_key_2")) }},
+		{"blank path", func() error { _, err := tr.BlankPath("user_7"); return err }},
+		{"grow", func() error { return tr.Insert("user_17", []byte("user_17_key")) }},
+		{"rebalance", func() error { _, err := tr.Rebalance(); return err }},
+		{"delete middle", func() error { return tr.Delete("user_8") }},
+	}
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		check(step.name)
+	}
+}
@@ -0,0 +1,97 @@
+package tree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store persists encoded elements for a Tree
+// Keys are opaque to the tree; children reference each other by key
+type Store interface {
+	// Key returns the storage key for the element with the given name
+	Key(name string) string
+	// Write stores the encoded element under key, replacing any previous value
+	Write(key string, data []byte) error
+	// Read returns the encoded element stored under key
+	Read(key string) ([]byte, error)
+	// Remove deletes the element stored under key
+	Remove(key string) error
+}
+
+// BatchStore is a Store that can apply all writes of one operation atomically
+// Insert and Delete call Begin before their first write and Commit with the
+// operation's result; Commit discards the buffered writes when opErr is non-nil
+// Batching uses the store passed to the tree constructor, beneath any option wrappers
+type BatchStore interface {
+	Store
+	Begin()
+	Commit(opErr error) error
+}
+
+// fileStore is the default Store writing one JSON file per element
+type fileStore struct {
+	rootPath string
+}
+
+// NewFileStore returns a Store keeping one file per element under rootPath
+func NewFileStore(rootPath string) (Store, error) {
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create root directory: %w", err)
+	}
+	return &fileStore{rootPath: rootPath}, nil
+}
+
+// Key returns the file path for an element
+func (s *fileStore) Key(name string) string {
+	return filepath.Join(s.rootPath, fmt.Sprintf("%s.json", name))
+}
+
+// Write writes the element file through a temporary file so readers never see a torn element
+// The file is synced before the rename and the directory after it, so a written element
+// survives a power loss
+func (s *fileStore) Write(key string, data []byte) error {
+	tmp := key + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, key); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(key))
+}
+
+// Read reads the element file
+func (s *fileStore) Read(key string) ([]byte, error) {
+	return os.ReadFile(key)
+}
+
+// Remove removes the element file and syncs the directory
+func (s *fileStore) Remove(key string) error {
+	if err := os.Remove(key); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(key))
+}
+
+// syncDir makes renames and removals in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
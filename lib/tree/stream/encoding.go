@@ -0,0 +1,205 @@
+// Package stream encodes tree change events for high-frequency streaming to subscribers
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// opNames lists the operations a tree reports, indexed by their wire code
+// Codes are never reused; new operations are appended
+var opNames = [...]string{
+	1:  "insert",
+	2:  "delete",
+	3:  "set_key",
+	4:  "apply_patch",
+	5:  "apply_update_path",
+	6:  "blank",
+	7:  "blank_path",
+	8:  "delete_batch",
+	9:  "prune_subtree",
+	10: "rebalance",
+	11: "rename",
+	12: "set_path_keys",
+	13: "update_leaf",
+}
+
+// opCodes maps an operation to its wire code
+var opCodes = func() map[string]byte {
+	codes := make(map[string]byte, len(opNames))
+	for code, name := range opNames {
+		if name != "" {
+			codes[name] = byte(code)
+		}
+	}
+	return codes
+}()
+
+// batchHeaderSize is the size of the count and payload length prefix of a batch frame
+const batchHeaderSize = 8
+
+// opCode maps an event operation to its wire code
+func opCode(op string) (byte, error) {
+	if code, ok := opCodes[op]; ok {
+		return code, nil
+	}
+	return 0, fmt.Errorf("unknown operation: %s", op)
+}
+
+// opName maps a wire code back to the event operation, reusing constant strings
+func opName(code byte) (string, error) {
+	if int(code) < len(opNames) && opNames[code] != "" {
+		return opNames[code], nil
+	}
+	return "", fmt.Errorf("unknown operation code: %d", code)
+}
+
+// AppendEvent appends the binary encoding of event to dst
+// Layout: op code, unix nanoseconds, uvarint name length, name bytes
+func AppendEvent(dst []byte, event tree.ChangeEvent) ([]byte, error) {
+	code, err := opCode(event.Op)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, code)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(event.Time.UnixNano()))
+	dst = binary.AppendUvarint(dst, uint64(len(event.Name)))
+	dst = append(dst, event.Name...)
+	return dst, nil
+}
+
+// DecodeEvent decodes one event from src and returns the number of bytes consumed
+func DecodeEvent(src []byte) (tree.ChangeEvent, int, error) {
+	if len(src) < 9 {
+		return tree.ChangeEvent{}, 0, fmt.Errorf("event truncated")
+	}
+	op, err := opName(src[0])
+	if err != nil {
+		return tree.ChangeEvent{}, 0, err
+	}
+	nanos := int64(binary.BigEndian.Uint64(src[1:9]))
+
+	nameLen, n := binary.Uvarint(src[9:])
+	if n <= 0 {
+		return tree.ChangeEvent{}, 0, fmt.Errorf("invalid name length")
+	}
+	start := 9 + n
+	end := start + int(nameLen)
+	if nameLen > uint64(len(src)) || end > len(src) {
+		return tree.ChangeEvent{}, 0, fmt.Errorf("event name truncated")
+	}
+
+	return tree.ChangeEvent{
+		Op:   op,
+		Name: string(src[start:end]),
+		Time: time.Unix(0, nanos),
+	}, end, nil
+}
+
+// Buffer is a pooled encoding buffer; call Release once the bytes have been sent
+type Buffer struct {
+	buf   []byte
+	count int
+}
+
+// Bytes returns the encoded frame
+func (b *Buffer) Bytes() []byte {
+	return b.buf
+}
+
+// Encoder hands out pooled buffers so steady-state encoding does not allocate
+type Encoder struct {
+	pool sync.Pool
+}
+
+// NewEncoder creates an encoder whose buffers start with initialSize capacity
+func NewEncoder(initialSize int) *Encoder {
+	e := &Encoder{}
+	e.pool.New = func() any {
+		return &Buffer{buf: make([]byte, 0, initialSize)}
+	}
+	return e
+}
+
+// Event encodes a single event into a pooled buffer
+func (e *Encoder) Event(event tree.ChangeEvent) (*Buffer, error) {
+	b := e.get()
+	var err error
+	if b.buf, err = AppendEvent(b.buf, event); err != nil {
+		e.Release(b)
+		return nil, err
+	}
+	b.count = 1
+	return b, nil
+}
+
+// BeginBatch starts a batch frame; append events with Append and finish with EndBatch
+func (e *Encoder) BeginBatch() *Buffer {
+	b := e.get()
+	b.buf = append(b.buf, make([]byte, batchHeaderSize)...)
+	return b
+}
+
+// Append adds an event to a batch started with BeginBatch
+func (e *Encoder) Append(b *Buffer, event tree.ChangeEvent) error {
+	var err error
+	if b.buf, err = AppendEvent(b.buf, event); err != nil {
+		return err
+	}
+	b.count++
+	return nil
+}
+
+// EndBatch writes the frame header: event count and payload length
+func (e *Encoder) EndBatch(b *Buffer) []byte {
+	binary.BigEndian.PutUint32(b.buf[0:4], uint32(b.count))
+	binary.BigEndian.PutUint32(b.buf[4:8], uint32(len(b.buf)-batchHeaderSize))
+	return b.buf
+}
+
+// Release returns a buffer to the pool
+func (e *Encoder) Release(b *Buffer) {
+	b.buf = b.buf[:0]
+	b.count = 0
+	e.pool.Put(b)
+}
+
+// get takes a reset buffer from the pool
+func (e *Encoder) get() *Buffer {
+	b := e.pool.Get().(*Buffer)
+	b.buf = b.buf[:0]
+	b.count = 0
+	return b
+}
+
+// DecodeBatch decodes a batch frame, calling fn for each event until it returns false
+func DecodeBatch(frame []byte, fn func(tree.ChangeEvent) bool) error {
+	if len(frame) < batchHeaderSize {
+		return fmt.Errorf("batch frame truncated")
+	}
+	count := int(binary.BigEndian.Uint32(frame[0:4]))
+	length := int(binary.BigEndian.Uint32(frame[4:8]))
+	payload := frame[batchHeaderSize:]
+	if length != len(payload) {
+		return fmt.Errorf("batch payload length mismatch: header=%d actual=%d", length, len(payload))
+	}
+
+	for i := 0; i < count; i++ {
+		event, n, err := DecodeEvent(payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode event %d: %w", i, err)
+		}
+		payload = payload[n:]
+		if !fn(event) {
+			return nil
+		}
+	}
+	if len(payload) != 0 {
+		return fmt.Errorf("trailing bytes after %d events", count)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	enc := NewEncoder(256)
+	now := time.Now()
+
+	events := []tree.ChangeEvent{
+		{Op: "insert", Name: "alice", Time: now},
+		{Op: "set_key", Name: "int_0123", Time: now.Add(time.Millisecond)},
+		{Op: "delete", Name: "bob", Time: now.Add(2 * time.Millisecond)},
+	}
+
+	b := enc.BeginBatch()
+	for _, event := range events {
+		if err := enc.Append(b, event); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	frame := enc.EndBatch(b)
+
+	var decoded []tree.ChangeEvent
+	if err := DecodeBatch(frame, func(event tree.ChangeEvent) bool {
+		decoded = append(decoded, event)
+		return true
+	}); err != nil {
+		t.Fatalf("Failed to decode batch: %v", err)
+	}
+	enc.Release(b)
+
+	if len(decoded) != len(events) {
+		t.Fatalf("expected %d events, got %d", len(events), len(decoded))
+	}
+	for i := range events {
+		if decoded[i].Op != events[i].Op || decoded[i].Name != events[i].Name || !decoded[i].Time.Equal(events[i].Time) {
+			t.Errorf("event %d mismatch: %+v != %+v", i, decoded[i], events[i])
+		}
+	}
+
+	if _, err := enc.Event(tree.ChangeEvent{Op: "compact"}); err == nil {
+		t.Errorf("expected unknown operation to be rejected")
+	}
+}
+
+func TestBatchEncodingDoesNotAllocate(t *testing.T) {
+	enc := NewEncoder(4096)
+	event := tree.ChangeEvent{Op: "set_key", Name: "int_0123456789abcdef", Time: time.Now()}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		b := enc.BeginBatch()
+		for i := 0; i < 32; i++ {
+			enc.Append(b, event)
+		}
+		enc.EndBatch(b)
+		enc.Release(b)
+	})
+	if allocs > 0 {
+		t.Errorf("expected zero allocations per batch, got %.1f", allocs)
+	}
+}
+
+// Every operation the tree reports through startOp has a wire code
+func TestEveryTreeOperationEncodes(t *testing.T) {
+	sources, _ := filepath.Glob("../*.go")
+	started := regexp.MustCompile(`startOp\("([a-z_]+)"`)
+	ops := make(map[string]bool)
+	for _, source := range sources {
+		code, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", source, err)
+		}
+		for _, match := range started.FindAllSubmatch(code, -1) {
+			ops[string(match[1])] = true
+		}
+	}
+	if len(ops) < 13 {
+		t.Fatalf("found only %d tree operations", len(ops))
+	}
+
+	now := time.Now()
+	for op := range ops {
+		encoded, err := AppendEvent(nil, tree.ChangeEvent{Op: op, Name: "alice", Time: now})
+		if err != nil {
+			t.Errorf("Failed to encode %s: %v", op, err)
+			continue
+		}
+		decoded, n, err := DecodeEvent(encoded)
+		if err != nil || n != len(encoded) || decoded.Op != op || decoded.Name != "alice" {
+			t.Errorf("%s decoded as %+v, %v", op, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package tree
+
+import "fmt"
+
+// subtreeMembers returns the member leaves below the node at nodeIndex in leaf order
+func (t *Tree) subtreeMembers(nodeIndex int) ([]*Element, error) {
+	node := t.GetNodeByIndex(nodeIndex)
+	if node == nil {
+		return nil, fmt.Errorf("node %d not found", nodeIndex)
+	}
+	var members []*Element
+	var collect func(*Element)
+	collect = func(e *Element) {
+		switch {
+		case e == nil:
+		case e.IsLeaf():
+			if e.nodeType == "leaf" && !e.IsBlank() {
+				members = append(members, e)
+			}
+		default:
+			collect(e.leftChild)
+			collect(e.rightChild)
+		}
+	}
+	collect(node)
+	return members, nil
+}
+
+// ExportSubtree copies the members below the node at nodeIndex into a new tree
+// persisted to store, nil keeping it in memory, so a large group can be split. The
+// members keep their names, keys and leaf nodes in leaf order under blank intermediates,
+// as with Merge; the new tree has the ciphersuite of this one unless opts say otherwise.
+// This tree is not changed, see PruneSubtree
+func (t *Tree) ExportSubtree(nodeIndex int, store Store, opts ...Option) (*Tree, error) {
+	members, err := t.subtreeMembers(nodeIndex)
+	if err != nil {
+		return nil, err
+	}
+	exported, err := buildMembers(members, t.ciphersuite, store, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export subtree %d: %w", nodeIndex, err)
+	}
+	return exported, nil
+}
+
+// PruneSubtree removes the members below the node at nodeIndex as one operation,
+// blanking their slots and paths as Delete does, and returns their names in leaf order
+// Paired with ExportSubtree it moves part of a group into a group of its own
+func (t *Tree) PruneSubtree(nodeIndex int) (pruned []string, err error) {
+	if err := t.checkWritable("prune subtree"); err != nil {
+		return nil, err
+	}
+	members, err := t.subtreeMembers(nodeIndex)
+	if err != nil {
+		return nil, err
+	}
+	end := t.startOp("prune_subtree", t.nodes[nodeIndex].name)
+	defer func() { end(err) }()
+	if len(members) == 0 {
+		return nil, nil
+	}
+	for _, member := range members {
+		pruned = append(pruned, member.name)
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+	if err := t.blankLeaves(members); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
@@ -0,0 +1,91 @@
+package tree
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestExportPruneSubtree(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTree(dir)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve", "frank", "grace", "heidi"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if err := tr.UpdateIntermediateKeys(); err != nil {
+		t.Fatalf("Failed to key intermediates: %v", err)
+	}
+	left, right := tr.Head().LeftChild(), tr.Head().RightChild()
+	leftKey := slices.Clone(left.Value())
+
+	exported, err := tr.ExportSubtree(right.NodeIndex(), nil)
+	if err != nil {
+		t.Fatalf("Failed to export subtree: %v", err)
+	}
+	want := []string{"eve", "frank", "grace", "heidi"}
+	if got := leafNames(exported); !slices.Equal(got, want) {
+		t.Errorf("exported leaves = %v, want %v", got, want)
+	}
+	for i, leaf := range exported.GetLeaves() {
+		if leaf.LeafIndex() != i || string(leaf.Value()) != leaf.Name()+"_key" {
+			t.Errorf("%s should keep its key at leaf index %d, got %d", leaf.Name(), i, leaf.LeafIndex())
+		}
+	}
+	if !exported.Head().IsBlank() || !exported.CheckBalance().Balanced() {
+		t.Errorf("exported tree should be left-balanced under blank intermediates")
+	}
+	if len(leafNames(tr)) != 8 {
+		t.Errorf("exporting should not change the tree")
+	}
+
+	version := tr.Version()
+	pruned, err := tr.PruneSubtree(right.NodeIndex())
+	if err != nil {
+		t.Fatalf("Failed to prune subtree: %v", err)
+	}
+	if !slices.Equal(pruned, want) {
+		t.Errorf("pruned = %v, want %v", pruned, want)
+	}
+	if tr.Version() != version+1 {
+		t.Errorf("pruning should be one operation")
+	}
+
+	// The pruned half sat at the right edge, so the tree shrinks to the untouched left half
+	if got := leafNames(tr); !slices.Equal(got, []string{"alice", "bob", "charlie", "dave"}) {
+		t.Errorf("leaves after prune = %v", got)
+	}
+	if tr.Head() != left || !bytes.Equal(tr.Head().Value(), leftKey) {
+		t.Errorf("the left half should become the root and keep its key")
+	}
+	checkNodeLinks(t, tr)
+
+	// A subtree on the left leaves blank slots behind
+	if pruned, err := tr.PruneSubtree(tr.Head().LeftChild().NodeIndex()); err != nil || !slices.Equal(pruned, []string{"alice", "bob"}) {
+		t.Fatalf("pruned %v, %v", pruned, err)
+	}
+	if got := leafNames(tr); !slices.Equal(got, []string{blankLeafName(0), blankLeafName(1), "charlie", "dave"}) {
+		t.Errorf("leaves after prune = %v", got)
+	}
+	if !tr.Head().IsBlank() {
+		t.Errorf("the root above pruned members should be blank")
+	}
+
+	reloaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload tree: %v", err)
+	}
+	if !reloaded.Equal(tr) {
+		t.Errorf("reloaded tree differs: %v", reloaded.StructuralDiff(tr))
+	}
+	if _, err := tr.ExportSubtree(99, nil); err == nil {
+		t.Errorf("unknown node indices should be rejected")
+	}
+	if _, err := tr.PruneSubtree(99); err == nil {
+		t.Errorf("unknown node indices should be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+package tree
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree/internal/nodefb"
+)
+
+// Tiered storage keeps the tree skeleton (names, links, counts and indices) resident
+// and moves the payload of idle nodes - public keys, key tags and key history - to
+// the backing store. Node indices are positions in the whole tree, so the skeleton
+// cannot be shelved without reloading every node on each Insert and Delete.
+
+// Shelve drops the payload of every node idle for at least idle and returns how many were shelved
+// Idle means neither modified nor loaded within the period; pinned nodes are never shelved
+// Shelved payloads are reloaded from the store the next time they are read
+func (t *Tree) Shelve(idle time.Duration) (int, error) {
+	if t.store == nil {
+		return 0, nil
+	}
+	// Pending asynchronous writes must reach the store before the payload leaves memory
+	if err := t.Barrier(); err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-idle)
+	shelved := 0
+	for _, element := range t.GetAllElements() {
+		if element.shelved || t.IsPinned(element.name) {
+			continue
+		}
+		if element.lastModified.After(cutoff) || element.loadedAt.After(cutoff) {
+			continue
+		}
+		element.publicKey = nil
+		element.keyAlgorithm = KeyAlgorithmUnknown
+		element.keyEncoding = KeyEncodingOpaque
+		element.history = nil
+		element.leafNode = nil
+		element.parentHash = nil
+		element.unmerged = nil
+		element.record = nil
+		element.shelved = true
+		element.unloaded.Store(true)
+		shelved++
+	}
+	return shelved, nil
+}
+
+// ShelvedCount returns the number of nodes whose payload is not resident
+func (t *Tree) ShelvedCount() int {
+	count := 0
+	for _, element := range t.GetAllElements() {
+		if element.IsShelved() {
+			count++
+		}
+	}
+	return count
+}
+
+// IsShelved reports whether the element's payload currently lives only in the store
+func (e *Element) IsShelved() bool {
+	if !e.unloaded.Load() {
+		return false
+	}
+	e.shelf.Lock()
+	defer e.shelf.Unlock()
+	return e.shelved
+}
+
+// unshelve reads a payload not yet in memory, from the FlatBuffers record it was
+// loaded from or, when shelved, from the store
+// Loading is the one write reads make, so readers sharing a tree under a read lock
+// serialize on the element's own lock while they load it; resident payloads, the
+// common case, are read without taking any lock
+func (e *Element) unshelve() error {
+	if !e.unloaded.Load() {
+		return nil
+	}
+	e.shelf.Lock()
+	defer e.shelf.Unlock()
+	if e.record != nil {
+		// The record was verified when the element was loaded
+		var data elementData
+		flatPayload(nodefb.GetRootAsNode(e.record, 0), &data)
+		if err := e.setPayload(data); err != nil {
+			return fmt.Errorf("failed to decode leaf node of %s: %w", e.name, err)
+		}
+		e.record = nil
+		e.unloaded.Store(false)
+		return nil
+	}
+	if !e.shelved {
+		return nil
+	}
+
+	encoded, err := e.store.Read(e.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to load shelved node %s: %w", e.name, err)
+	}
+	data, err := decodeElementData(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal shelved node %s: %w", e.name, err)
+	}
+	if err := e.setPayload(data); err != nil {
+		return fmt.Errorf("failed to decode leaf node of shelved node %s: %w", e.name, err)
+	}
+	e.shelved = false
+	e.unloaded.Store(false)
+	return nil
+}
+
+// setPayload adopts the key material of data as the element's payload
+func (e *Element) setPayload(data elementData) error {
+	leaf, err := leafNodeOf(data.LeafNode)
+	if err != nil {
+		return err
+	}
+	e.publicKey = data.PublicKey
+	e.keyAlgorithm = data.KeyAlgorithm
+	e.keyEncoding = data.KeyEncoding
+	e.history = data.History
+	e.leafNode = leaf
+	e.parentHash = data.ParentHash
+	e.unmerged = data.Unmerged
+	e.loadedAt = time.Now()
+	return nil
+}
+
+// Key returns the public key, loading it when shelved
+// It fails when a shelved payload cannot be loaded, so callers deciding on the key can
+// tell an unknown key from an empty one
+func (e *Element) Key() ([]byte, error) {
+	if err := e.unshelve(); err != nil {
+		return nil, err
+	}
+	return e.publicKey, nil
+}
+
+// key returns the public key for reads that only report or hash it
+// A payload that cannot be loaded reads as an empty key; decisions that would overwrite
+// or drop the node use Key or IsBlank instead
+func (e *Element) key() []byte {
+	key, _ := e.Key()
+	return key
+}
@@ -0,0 +1,119 @@
+package tree
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShelveIdlePayloads(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tree, _ := NewTreeWithStore(files)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	tree.UpdateIntermediateKeys()
+	before := tree.GetTreeStructure()
+	groupKey := string(tree.GetGroupPublicKey())
+
+	// Age every node, then keep user_3 active and pin user_5
+	for _, element := range tree.GetAllElements() {
+		element.lastModified = time.Now().Add(-2 * time.Hour)
+		element.loadedAt = time.Time{}
+	}
+	active, _ := tree.Find("user_3")
+	active.lastModified = time.Now()
+	pinned, _ := tree.Find("user_5")
+	tree.Pin(pinned.Name())
+
+	shelved, err := tree.Shelve(time.Hour)
+	if err != nil {
+		t.Fatalf("Shelve failed: %v", err)
+	}
+	total := len(tree.GetAllElements())
+	if shelved != total-2 || tree.ShelvedCount() != total-2 {
+		t.Fatalf("expected %d shelved nodes, got %d (count %d)", total-2, shelved, tree.ShelvedCount())
+	}
+	if active.IsShelved() || pinned.IsShelved() {
+		t.Errorf("active and pinned nodes must stay resident")
+	}
+	t.Logf("%d/%d 노드 페이로드가 저장소로 이동됨", shelved, total)
+
+	// Reads load shelved payloads transparently
+	if got := string(tree.GetGroupPublicKey()); got != groupKey {
+		t.Errorf("group key changed after shelving")
+	}
+	for name, info := range tree.GetTreeStructure() {
+		if string(info.PublicKey) != string(before[name].PublicKey) {
+			t.Errorf("%s: key %q, want %q", name, info.PublicKey, before[name].PublicKey)
+		}
+	}
+
+	// Structural changes re-save shelved nodes without losing their keys
+	tree.Shelve(0)
+	if err := tree.Delete("user_0"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	for _, leaf := range loaded.GetLeaves() {
+		if leaf.nodeType == "leaf" && leaf.Name() == blankLeafName(0) {
+			continue // user_0's slot
+		}
+		if string(leaf.Value()) != leaf.Name()+"_key" {
+			t.Errorf("%s lost its key: %q", leaf.Name(), leaf.Value())
+		}
+	}
+}
+
+// flakyStore fails reads of every key in down
+type flakyStore struct {
+	Store
+	down map[string]bool
+}
+
+func (s *flakyStore) Read(key string) ([]byte, error) {
+	if s.down[key] {
+		return nil, fmt.Errorf("transient read failure")
+	}
+	return s.Store.Read(key)
+}
+
+func TestShelvedLoadFailureIsNotBlank(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	store := &flakyStore{Store: files, down: make(map[string]bool)}
+	tree, _ := NewTreeWithStore(store)
+	for _, name := range []string{"alice", "bob"} {
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	if _, err := tree.Shelve(0); err != nil {
+		t.Fatalf("Shelve failed: %v", err)
+	}
+	alice, _ := tree.Find("alice")
+	store.down[alice.filePath] = true
+
+	if _, err := alice.Key(); err == nil {
+		t.Errorf("Key should report the failed load")
+	}
+	if alice.IsBlank() {
+		t.Fatalf("a member whose payload failed to load must not read as blank")
+	}
+	if err := tree.Insert("carol", []byte("carol_key")); err != nil {
+		t.Fatalf("Failed to insert carol: %v", err)
+	}
+	if carol, _ := tree.Find("carol"); carol.LeafIndex() != 2 {
+		t.Errorf("carol should be appended, got leaf index %d", carol.LeafIndex())
+	}
+
+	store.down[alice.filePath] = false
+	if found, ok := tree.Find("alice"); !ok || string(found.Value()) != "alice_key" {
+		t.Errorf("alice should survive the failed load")
+	}
+}
@@ -0,0 +1,94 @@
+package tree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// topologyVersion starts every compact topology encoding
+const topologyVersion = 1
+
+// MarshalTopology encodes the tree compactly for structure broadcasts
+// The topology is the RFC 9420 array layout implied by the leaf count; a bitmap marks
+// the non-blank nodes and only those carry data: a key for every node and a name for
+// every leaf. Trees whose intermediate keys are mostly blank shrink to little more
+// than their leaves
+func (t *Tree) MarshalTopology() []byte {
+	nodes := t.ratchetNodes()
+	n := (len(nodes) + 1) / 2
+
+	out := []byte{topologyVersion}
+	out = binary.AppendUvarint(out, uint64(n))
+	bitmap := make([]byte, (len(nodes)+7)/8)
+	for x, node := range nodes {
+		if node.present {
+			bitmap[x/8] |= 1 << (x % 8)
+		}
+	}
+	out = append(out, bitmap...)
+	for _, node := range nodes {
+		if !node.present {
+			continue
+		}
+		out = appendBytes(out, node.key)
+		if node.leaf {
+			out = appendBytes(out, []byte(node.identity))
+		}
+	}
+	return out
+}
+
+// UnmarshalTopology rebuilds a tree encoded by MarshalTopology and persists it to store
+// Leaf indices follow the leaf positions; intermediate names are generated afresh
+func UnmarshalTopology(data []byte, store Store, opts ...Option) (*Tree, error) {
+	nodes, err := decodeTopology(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topology: %w", err)
+	}
+	return importRatchetNodes(nodes, store, opts)
+}
+
+// decodeTopology parses the compact encoding into the array layout
+func decodeTopology(data []byte) ([]ratchetNode, error) {
+	if len(data) == 0 || data[0] != topologyVersion {
+		return nil, errors.New("unsupported topology version")
+	}
+
+	r := &byteReader{buf: data[1:]}
+	n := r.uvarint()
+	if r.err != nil {
+		return nil, r.err
+	}
+	// Every node takes a bitmap bit, so the bitmap bounds the leaf count
+	if n > uint64(len(r.buf))*4+1 {
+		return nil, errors.New("leaf count out of range")
+	}
+	width := mlsNodeWidth(int(n))
+	if (width+7)/8 > len(r.buf) {
+		return nil, errors.New("truncated bitmap")
+	}
+	bitmap := r.buf[:(width+7)/8]
+	r.buf = r.buf[len(bitmap):]
+
+	nodes := make([]ratchetNode, width)
+	for x := range nodes {
+		if bitmap[x/8]&(1<<(x%8)) == 0 {
+			continue
+		}
+		nodes[x] = ratchetNode{present: true, leaf: x%2 == 0, key: r.bytes()}
+		if nodes[x].leaf {
+			nodes[x].identity = string(r.bytes())
+		}
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.buf))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if width > 0 && !nodes[width-1].present {
+		return nil, errors.New("topology must end with a non-blank leaf")
+	}
+	return nodes, nil
+}
@@ -0,0 +1,74 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestTopologyRoundTrip(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for i := 0; i < 64; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		source.Insert(name, bytes.Repeat([]byte{byte(i)}, 32))
+	}
+
+	// Only the root has an intermediate key, every other parent is blank
+	source.SetIntermediateNodeKey(source.Head().Name(), bytes.Repeat([]byte{0xff}, 32))
+
+	compact := source.MarshalTopology()
+	full, _ := json.Marshal(source.GetTreeStructure())
+	t.Logf("토폴로지 %d바이트, 전체 구조 JSON %d바이트", len(compact), len(full))
+	if len(compact)*4 > len(full) {
+		t.Errorf("compact topology should be far smaller than the JSON structure: %d vs %d", len(compact), len(full))
+	}
+
+	imported, err := UnmarshalTopology(compact, nil)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal topology: %v", err)
+	}
+	if !bytes.Equal(imported.StructureHash(), source.StructureHash()) {
+		t.Errorf("imported tree differs from the source")
+	}
+	if !bytes.Equal(imported.MarshalTopology(), compact) {
+		t.Errorf("re-encoding should be stable")
+	}
+}
+
+func TestUnmarshalTopologyRejectsCorruption(t *testing.T) {
+	source, _ := NewTreeWithStore(nil)
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		source.Insert(user, []byte(user+"_key"))
+	}
+	compact := source.MarshalTopology()
+
+	for cut := 0; cut < len(compact); cut++ {
+		if _, err := UnmarshalTopology(compact[:cut], nil); err == nil {
+			t.Fatalf("truncated topology at %d bytes should fail", cut)
+		}
+	}
+	if _, err := UnmarshalTopology(append(compact, 0), nil); err == nil {
+		t.Errorf("expected an error for trailing bytes")
+	}
+	if _, err := UnmarshalTopology([]byte{topologyVersion, 0xff, 0xff, 0xff, 0xff, 0x0f}, nil); err == nil {
+		t.Errorf("expected an error for an oversized leaf count")
+	}
+
+	blank, _ := NewTreeWithStore(nil)
+	empty, err := UnmarshalTopology(blank.MarshalTopology(), nil)
+	if err != nil || empty.Head() != nil {
+		t.Errorf("expected an empty tree, got %v", err)
+	}
+}
+
+func TestUnmarshalTopologyNeverPanics(t *testing.T) {
+	for n := 0; n < 64; n++ {
+		for length := 0; length < 24; length++ {
+			data := binary.AppendUvarint([]byte{topologyVersion}, uint64(n))
+			data = append(data, bytes.Repeat([]byte{0xff}, length)...)
+			UnmarshalTopology(data, nil)
+		}
+	}
+}
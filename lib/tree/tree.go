@@ -1,24 +1,46 @@
 package tree
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrExists is returned when a name is already taken by another element
+var ErrExists = errors.New("name already exists")
+
 // Element represents a tree node with TreeKEM properties
 type Element struct {
-	name       string
-	publicKey  []byte // TreeKEM public key (what goes in value field)
-	leftCount  int
-	rightCount int
-	leftChild  *Element
-	rightChild *Element
-	filePath   string // disk storage path for this element
+	name         string
+	publicKey    []byte       // TreeKEM public key (what goes in value field)
+	keyAlgorithm KeyAlgorithm // algorithm of publicKey, unknown for opaque keys
+	keyEncoding  KeyEncoding  // encoding of publicKey
+	leftCount    int
+	rightCount   int
+	leftChild    *Element
+	rightChild   *Element
+	parent       *Element      // nil for the root, set by reassignNodeIndices
+	owner        *Tree         // tree the element is indexed in, see touch
+	filePath     string        // storage key for this element
+	store        Store         // backing store, nil when the tree is kept in memory only
+	digest       []byte        // hash of the last encoding written or read, detects external edits
+	history      []KeyRecord   // previous public keys, newest first
+	leafNode     *LeafNode     // signed leaf contents, nil for intermediates and bare-key leaves
+	parentHash   []byte        // RFC 9420 parent hash set by the last path update, see SetPathKeys
+	unmerged     []int         // leaf indices added below since the key was set, see Resolution
+	shelved      bool          // payload lives only in the store, see Shelve
+	record       []byte        // FlatBuffers record whose payload is not read yet, see unshelve
+	unloaded     atomic.Bool   // shelved or record set, lets resident reads skip shelf
+	shelf        sync.Mutex    // serializes readers loading the payload, see unshelve
+	loadedAt     time.Time     // when the payload was last loaded from the store
+	format       elementFormat // encoding used when the element is written
 
 	// TreeKEM specific fields
 	nodeType  string // "leaf" or "intermediate"
@@ -28,25 +50,73 @@ type Element struct {
 	// Change tracking
 	lastModified time.Time // 마지막 수정 시점
 	lastChecked  time.Time // 마지막 확인 시점
+	version      uint64    // incremented by every MarkAsModified, see Version
 }
 
 // Tree represents the TreeKEM tree structure
 type Tree struct {
-	rootPath      string   // base directory for storing tree data
-	head          *Element // root element of the tree
-	nextNodeIndex int      // counter for assigning unique node numbers
+	rootPath     string              // base directory for storing tree data
+	store        Store               // persistence backend, nil for in-memory trees
+	head         *Element            // root element of the tree
+	nodes        []*Element          // elements by node index, see reassignNodeIndices
+	unevenLeaves bool                // some leaf i is not node 2i, see leafByIndex
+	byName       map[string]*Element // elements by name, see Find
+
+	tracePlacement bool            // record placement decisions on Insert
+	lastPlacement  *PlacementTrace // trace of the most recent Insert
+
+	notifier Notifier // receives mutation events, optional
+	tracer   Tracer   // wraps operations in spans, optional
+
+	pinned        map[string]struct{}        // names of the nodes that must stay resident
+	manifestHead  string                     // head name last written to the manifest
+	snapshotNodes map[*Element]*SnapshotNode // copies taken by the last Snapshot, shared by the next
+	dirty         map[*Element]struct{}      // elements changed since the last Snapshot, nil after renumbering
+	snapshotNames *snapshotNames             // name index shared by snapshots of the same layout
+
+	version        uint64        // incremented by every successful mutation
+	readTxnTimeout time.Duration // how long a ReadTxn stays valid
+	revisions      []*Snapshot   // committed revisions, oldest first, see WithRevisionHistory
+	revisionDepth  int           // revisions retained, 0 disables revision history
+
+	writeBehind     *writeBehindStore        // asynchronous persistence, nil when writes are synchronous
+	onWriteError    func(error)              // handler passed to the write-behind worker, optional
+	journal         *journalStore            // intent log for atomic operations, nil when disabled
+	deferred        *deferredStore           // writes held until Flush, nil when writes are immediate
+	debounce        *debounceStore           // writes held until their node is quiet, nil when disabled
+	ciphersuite     Ciphersuite              // validates node keys when set
+	authService     AuthService              // vets credentials of inserted leaf nodes, optional
+	groupID         []byte                   // group context of update and commit leaf signatures
+	epoch           uint64                   // advanced once per commit, see AdvanceEpoch
+	transcriptHash  []byte                   // confirmed transcript hash of the current epoch
+	interimHash     []byte                   // interim transcript hash of the current epoch
+	groupExtensions []Extension              // group context extensions of the current epoch
+	successor       []byte                   // group ID that replaced this group, see Retire
+	generations     map[string]*replayWindow // received message generations of the epoch, see RecordGeneration
+	historyDepth    int                      // previous keys kept per node, 0 disables history
+	cache           *cacheStore              // in-memory copy of stored elements, nil when disabled
+	readOnly        bool                     // reject mutations, see WithReadOnly
+	batch           BatchStore               // backend applying each operation atomically, optional
+	format          elementFormat            // encoding for written elements, see WithBinaryEncoding
+	optionErr       error                    // first error raised while applying options
 }
 
 // NodeInfo represents tree node information for TreeKEM coordination
 type NodeInfo struct {
-	Name        string `json:"name"`
-	PublicKey   []byte `json:"public_key"`
-	NodeType    string `json:"node_type"`
-	LeafIndex   int    `json:"leaf_index"`
-	NodeIndex   int    `json:"node_index"`
-	ParentIndex int    `json:"parent_index"`
-	LeftChild   string `json:"left_child,omitempty"`
-	RightChild  string `json:"right_child,omitempty"`
+	Name         string       `json:"name"`
+	PublicKey    []byte       `json:"public_key"`
+	KeyAlgorithm KeyAlgorithm `json:"key_algorithm,omitempty"`
+	KeyEncoding  KeyEncoding  `json:"key_encoding,omitempty"`
+	NodeType     string       `json:"node_type"`
+	LeafIndex    int          `json:"leaf_index"`
+	NodeIndex    int          `json:"node_index"`
+	ParentIndex  int          `json:"parent_index"`
+	LeftChild    string       `json:"left_child,omitempty"`
+	RightChild   string       `json:"right_child,omitempty"`
+	LeafNode     []byte       `json:"leaf_node,omitempty"` // TLS-encoded LeafNode of leaves that carry one
+	ParentHash   []byte       `json:"parent_hash,omitempty"`
+	Unmerged     []int        `json:"unmerged_leaves,omitempty"` // leaf indices, see Element.UnmergedLeaves
+	Version      uint64       `json:"version,omitempty"`         // see Element.Version
 }
 
 // Element Methods
@@ -79,6 +149,7 @@ func (e *Element) RightCount() int {
 // SetLeftChild sets the left child element
 func (e *Element) SetLeftChild(child *Element) {
 	e.leftChild = child
+	e.touch()
 }
 
 // SetLeftCount sets the left subtree count
@@ -89,6 +160,7 @@ func (e *Element) SetLeftCount(count int) {
 // SetRightChild sets the right child element
 func (e *Element) SetRightChild(child *Element) {
 	e.rightChild = child
+	e.touch()
 }
 
 // SetRightCount sets the right subtree count
@@ -97,73 +169,97 @@ func (e *Element) SetRightCount(count int) {
 }
 
 // Value returns the element's public key
+// Shelved keys are loaded from the store first
 func (e *Element) Value() []byte {
-	return e.publicKey
+	return e.key()
 }
 
 // SetValue updates the node's public key value
+// The key is stored untagged; use Tree.SetIntermediateNodeKey for validated keys
 func (e *Element) SetValue(value []byte) {
+	e.unshelve() // keep the stored history when replacing a shelved key
 	e.publicKey = value
+	e.keyAlgorithm = KeyAlgorithmUnknown
+	e.keyEncoding = KeyEncodingOpaque
+	e.touch()
 }
 
-// NodeIndex returns the unique node number
+// NodeIndex returns the node's RFC 9420 array index, see reassignNodeIndices
 func (e *Element) NodeIndex() int {
 	return e.nodeIndex
 }
 
-// SetNodeIndex sets the unique node number
+// SetNodeIndex sets the node's array index
 func (e *Element) SetNodeIndex(index int) {
 	e.nodeIndex = index
+	e.touch()
 }
 
-// ParentIndex calculates parent node index
-// TreeKEM convention: parent(n) = (n-1)/2 for n > 0
+// ParentIndex returns the parent's node index, -1 for the root
 func (e *Element) ParentIndex() int {
-	if e.nodeIndex == 0 {
-		return -1 // root has no parent
+	if e.parent == nil {
+		return -1
 	}
-	return (e.nodeIndex - 1) / 2
+	return e.parent.nodeIndex
 }
 
-// LeftChildIndex calculates left child index
-// TreeKEM convention: left_child(n) = 2*n + 1
+// LeftChildIndex returns the left child's node index, -1 when there is none
 func (e *Element) LeftChildIndex() int {
-	return 2*e.nodeIndex + 1
+	if e.leftChild == nil {
+		return -1
+	}
+	return e.leftChild.nodeIndex
 }
 
-// RightChildIndex calculates right child index
-// TreeKEM convention: right_child(n) = 2*n + 2
+// RightChildIndex returns the right child's node index, -1 when there is none
 func (e *Element) RightChildIndex() int {
-	return 2*e.nodeIndex + 2
+	if e.rightChild == nil {
+		return -1
+	}
+	return e.rightChild.nodeIndex
 }
 
-// SiblingIndex calculates sibling node index
+// SiblingIndex returns the sibling's node index, -1 for the root and only children
 func (e *Element) SiblingIndex() int {
-	if e.nodeIndex == 0 {
-		return -1 // root has no sibling
+	if sibling := e.Sibling(); sibling != nil {
+		return sibling.nodeIndex
 	}
-	if e.nodeIndex%2 == 1 {
-		// left child, sibling is right child
-		return e.nodeIndex + 1
-	} else {
-		// right child, sibling is left child
-		return e.nodeIndex - 1
+	return -1
+}
+
+// Parent returns the parent element, nil for the root
+func (e *Element) Parent() *Element {
+	return e.parent
+}
+
+// Sibling returns the other child of the parent, nil for the root and only children
+func (e *Element) Sibling() *Element {
+	switch {
+	case e.parent == nil:
+		return nil
+	case e.parent.leftChild == e:
+		return e.parent.rightChild
+	default:
+		return e.parent.leftChild
 	}
 }
 
 // IsLeftChild checks if this node is a left child
 func (e *Element) IsLeftChild() bool {
-	return e.nodeIndex > 0 && e.nodeIndex%2 == 1
+	return e.parent != nil && e.parent.leftChild == e
 }
 
 // IsRightChild checks if this node is a right child
 func (e *Element) IsRightChild() bool {
-	return e.nodeIndex > 0 && e.nodeIndex%2 == 0
+	return e.parent != nil && e.parent.rightChild == e
 }
 
-// MarkAsModified updates the lastModified timestamp to current time
+// MarkAsModified updates the lastModified timestamp to current time and advances the
+// node version
 func (e *Element) MarkAsModified() {
 	e.lastModified = time.Now()
+	e.version++
+	e.touch()
 }
 
 // MarkAsChecked updates the lastChecked timestamp to current time
@@ -202,31 +298,76 @@ func (e *Element) IsLeaf() bool {
 }
 
 // NewTree creates a new disk-based tree with the given root path.
-func NewTree(rootPath string) (*Tree, error) {
-	if err := os.MkdirAll(rootPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create root directory: %w", err)
+func NewTree(rootPath string, opts ...Option) (*Tree, error) {
+	store, err := NewFileStore(rootPath)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Tree{
+	tree := &Tree{
 		rootPath: rootPath,
-	}, nil
+		store:    store,
+	}
+	if err := tree.applyOptions(opts); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// NewTreeWithStore creates a new tree persisting its elements to store
+// A nil store keeps the tree purely in memory without any encoding or I/O
+// It fails when an option does, e.g. WithAtomicWrites cannot recover a journal
+func NewTreeWithStore(store Store, opts ...Option) (*Tree, error) {
+	tree := &Tree{
+		store: store,
+	}
+	tree.batch, _ = store.(BatchStore)
+	if err := tree.applyOptions(opts); err != nil {
+		return nil, err
+	}
+	return tree, nil
 }
 
 // LoadTree loads an existing tree from disk
-func LoadTree(rootPath string, headName string) (*Tree, error) {
+func LoadTree(rootPath string, headName string, opts ...Option) (*Tree, error) {
+	tree, err := LoadTreeFromStore(&fileStore{rootPath: rootPath}, headName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tree.rootPath = rootPath
+	return tree, nil
+}
+
+// LoadTreeFromStore loads an existing tree whose head element is stored in store
+// An empty headName uses the head recorded in the manifest
+// A head that does not exist yet yields an empty tree
+func LoadTreeFromStore(store Store, headName string, opts ...Option) (*Tree, error) {
 	tree := &Tree{
-		rootPath: rootPath,
+		store: store,
+	}
+	tree.batch, _ = store.(BatchStore)
+	if err := tree.applyOptions(opts); err != nil {
+		return nil, err
 	}
 
-	if headName != "" {
-		headPath := tree.generateFilePath(headName)
-		if _, err := os.Stat(headPath); err == nil {
-			head, err := loadFromDisk(headPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load head element: %w", err)
+	if err := tree.loadManifest(); err != nil {
+		return nil, err
+	}
+	if headName == "" {
+		headName = tree.manifestHead
+	}
+
+	// Options may wrap the store, so read through the tree's view of it
+	if headName != "" && tree.store != nil {
+		head, err := loadFromStore(tree.store, tree.store.Key(headName), tree.format)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return tree, nil
 			}
-			tree.head = head
+			return nil, fmt.Errorf("failed to load head element: %w", err)
 		}
+		tree.head = head
+		tree.reassignNodeIndices()
 	}
 
 	return tree, nil
@@ -234,33 +375,54 @@ func LoadTree(rootPath string, headName string) (*Tree, error) {
 
 // elementData represents the serializable data for an element
 type elementData struct {
-	Name         string    `json:"name"`
-	PublicKey    []byte    `json:"public_key"`
-	LeftCount    int       `json:"left_count"`
-	RightCount   int       `json:"right_count"`
-	LeftChild    string    `json:"left_child,omitempty"`    // file path to left child
-	RightChild   string    `json:"right_child,omitempty"`   // file path to right child
-	NodeType     string    `json:"node_type"`               // "leaf" or "intermediate"
-	LeafIndex    int       `json:"leaf_index,omitempty"`    // for leaf nodes only
-	LastModified time.Time `json:"last_modified,omitempty"` // 마지막 수정 시점
-	LastChecked  time.Time `json:"last_checked,omitempty"`  // 마지막 확인 시점
+	Name         string       `json:"name"`
+	PublicKey    []byte       `json:"public_key"`
+	KeyAlgorithm KeyAlgorithm `json:"key_algorithm,omitempty"`
+	KeyEncoding  KeyEncoding  `json:"key_encoding,omitempty"`
+	LeftCount    int          `json:"left_count"`
+	RightCount   int          `json:"right_count"`
+	LeftChild    string       `json:"left_child,omitempty"`    // file path to left child
+	RightChild   string       `json:"right_child,omitempty"`   // file path to right child
+	NodeType     string       `json:"node_type"`               // "leaf" or "intermediate"
+	LeafIndex    int          `json:"leaf_index,omitempty"`    // for leaf nodes only
+	LastModified time.Time    `json:"last_modified,omitempty"` // 마지막 수정 시점
+	LastChecked  time.Time    `json:"last_checked,omitempty"`  // 마지막 확인 시점
+	History      []KeyRecord  `json:"history,omitempty"`       // previous public keys, newest first
+	LeafNode     []byte       `json:"leaf_node,omitempty"`     // TLS-encoded LeafNode, see Element.LeafNode
+	ParentHash   []byte       `json:"parent_hash,omitempty"`   // see Element.ParentHash
+	Unmerged     []int        `json:"unmerged,omitempty"`      // see Element.UnmergedLeaves
+	Version      uint64       `json:"version,omitempty"`       // see Element.Version
 }
 
 // saveToDisk saves the element to disk
 func (e *Element) saveToDisk() error {
+	e.touch()
+	if e.store == nil {
+		return nil // in-memory element, nothing to persist
+	}
 	if e.filePath == "" {
 		return fmt.Errorf("element has no file path")
 	}
+	if err := e.unshelve(); err != nil {
+		return err
+	}
 
 	data := elementData{
 		Name:         e.name,
 		PublicKey:    e.publicKey,
+		KeyAlgorithm: e.keyAlgorithm,
+		KeyEncoding:  e.keyEncoding,
 		LeftCount:    e.leftCount,
 		RightCount:   e.rightCount,
 		NodeType:     e.nodeType,
 		LeafIndex:    e.leafIndex,
 		LastModified: e.lastModified,
 		LastChecked:  e.lastChecked,
+		History:      e.history,
+		LeafNode:     encodeLeafNode(e.leafNode),
+		ParentHash:   e.parentHash,
+		Unmerged:     e.unmerged,
+		Version:      e.version,
 	}
 
 	if e.leftChild != nil {
@@ -270,50 +432,77 @@ func (e *Element) saveToDisk() error {
 		data.RightChild = e.rightChild.filePath
 	}
 
-	jsonData, err := json.Marshal(data)
+	encoded, err := encodeElementData(data, e.format)
 	if err != nil {
 		return fmt.Errorf("failed to marshal element data: %w", err)
 	}
 
-	if err := os.WriteFile(e.filePath, jsonData, 0644); err != nil {
+	if err := e.store.Write(e.filePath, encoded); err != nil {
 		return fmt.Errorf("failed to write element to disk: %w", err)
 	}
+	e.digest = digestOf(encoded)
 
 	return nil
 }
 
-// loadFromDisk loads an element from disk
-func loadFromDisk(filePath string) (*Element, error) {
-	jsonData, err := os.ReadFile(filePath)
+// loadFromStore loads an element and its children from store
+// Elements in either encoding are read; format selects how they are written back
+func loadFromStore(store Store, filePath string, format elementFormat) (*Element, error) {
+	encoded, err := store.Read(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read element from disk: %w", err)
 	}
 
 	var data elementData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
+	var record []byte
+	if isFlatBuffer(encoded) {
+		// Only the skeleton is read now; the payload is read from the record on first use
+		node, err := openFlatBuffer(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal element data: %w", err)
+		}
+		data, record = flatSkeleton(&node), encoded
+	} else if data, err = decodeElementData(encoded); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal element data: %w", err)
 	}
+	leaf, err := leafNodeOf(data.LeafNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode leaf node of %s: %w", data.Name, err)
+	}
 
 	element := &Element{
 		name:         data.Name,
 		publicKey:    data.PublicKey,
+		keyAlgorithm: data.KeyAlgorithm,
+		keyEncoding:  data.KeyEncoding,
 		leftCount:    data.LeftCount,
 		rightCount:   data.RightCount,
 		filePath:     filePath,
+		store:        store,
 		nodeType:     data.NodeType,
 		leafIndex:    data.LeafIndex,
 		lastModified: data.LastModified,
 		lastChecked:  data.LastChecked,
+		history:      data.History,
+		leafNode:     leaf,
+		parentHash:   data.ParentHash,
+		unmerged:     data.Unmerged,
+		version:      data.Version,
+		record:       record,
+		loadedAt:     time.Now(),
+		format:       format,
+		digest:       digestOf(encoded),
 	}
+	element.unloaded.Store(record != nil)
 
 	// Load children if they exist
 	if data.LeftChild != "" {
-		if leftChild, err := loadFromDisk(data.LeftChild); err == nil {
+		if leftChild, err := loadFromStore(store, data.LeftChild, format); err == nil {
 			element.leftChild = leftChild
 		}
 	}
 	if data.RightChild != "" {
-		if rightChild, err := loadFromDisk(data.RightChild); err == nil {
+		if rightChild, err := loadFromStore(store, data.RightChild, format); err == nil {
 			element.rightChild = rightChild
 		}
 	}
@@ -323,124 +512,62 @@ func loadFromDisk(filePath string) (*Element, error) {
 
 // generateFilePath generates a unique file path for an element
 func (t *Tree) generateFilePath(name string) string {
-	return filepath.Join(t.rootPath, fmt.Sprintf("%s.json", name))
+	if t.store == nil {
+		return ""
+	}
+	return t.store.Key(name)
 }
 
-// Delete implements tree deletion
-func (t *Tree) Delete(name string) error {
-	if t.head == nil {
-		return fmt.Errorf("tree is empty")
+// removeFromStore removes a persisted element, ignoring in-memory elements
+func (t *Tree) removeFromStore(filePath string) {
+	if t.store == nil || filePath == "" {
+		return
 	}
+	t.store.Remove(filePath)
+}
 
-	// Simple deletion: find the node and remove it, then compact the tree
-	var deleteNode func(*Element, string) (*Element, bool, error)
-	deleteNode = func(node *Element, targetName string) (*Element, bool, error) {
-		if node == nil {
-			return nil, false, nil
-		}
-
-		if node.name == targetName {
-			// Found the node to delete - remove file
-			if node.filePath != "" {
-				os.Remove(node.filePath)
-			}
-
-			// Simple replacement strategy
-			if node.leftChild == nil && node.rightChild == nil {
-				return nil, true, nil
-			}
-			if node.leftChild == nil {
-				return node.rightChild, true, nil
-			}
-			if node.rightChild == nil {
-				return node.leftChild, true, nil
-			}
-
-			// Both children exist - promote left child and attach right as rightmost
-			left := node.leftChild
-
-			// Find rightmost position in left subtree to attach right subtree
-			current := left
-			for current.rightChild != nil {
-				current = current.rightChild
-			}
-			current.rightChild = node.rightChild
-			current.rightCount = node.rightChild.leftCount + node.rightChild.rightCount + 1
-			current.saveToDisk()
-
-			// Update counts
-			left.rightCount = left.rightCount + current.rightCount
-			left.saveToDisk()
-
-			return left, true, nil
-		}
-
-		// Search in children
-		var found bool
-		var err error
-
-		if node.leftChild != nil {
-			node.leftChild, found, err = deleteNode(node.leftChild, targetName)
-			if found {
-				node.leftCount--
-				node.saveToDisk()
-				return node, true, err
-			}
-		}
-
-		if node.rightChild != nil {
-			node.rightChild, found, err = deleteNode(node.rightChild, targetName)
-			if found {
-				node.rightCount--
-				node.saveToDisk()
-				return node, true, err
-			}
-		}
-
-		return node, false, nil
+// Delete removes the member leaf name
+// The leaf is blanked as by Blank, so every other member keeps its leaf index and only an
+// insert reuses the slot; deleting the last member empties the tree. Intermediate nodes
+// cannot be deleted: they follow from the leaves, and removing one would move members
+func (t *Tree) Delete(name string) (err error) {
+	if err := t.checkWritable("delete"); err != nil {
+		return err
 	}
+	end := t.startOp("delete", name)
+	defer func() { end(err) }()
 
-	newHead, found, err := deleteNode(t.head, name)
+	if t.head == nil {
+		return fmt.Errorf("tree is empty")
+	}
+	element, found := t.Find(name)
 	if !found {
 		return fmt.Errorf("element not found: %s", name)
 	}
-	t.head = newHead
-
-	// Reassign node indices and rename intermediate nodes after deletion
-	// to maintain TreeKEM consistency
-	t.renameIntermediateNodes()
-	t.reassignNodeIndices()
-
-	return err
+	if element.nodeType != "leaf" {
+		return fmt.Errorf("failed to delete %s: not a member leaf", name)
+	}
+	return t.blank(name, 0)
 }
 
 // Find finds an element by name
+// Names are indexed whenever the tree's structure changes, so lookups take constant time
 func (t *Tree) Find(name string) (*Element, bool) {
-	// Breadth-first search since we're not using BST ordering
-	if t.head == nil {
-		return nil, false
-	}
-
-	// Use iterative approach to avoid stack overflow
-	queue := []*Element{t.head}
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-
-		if current.name == name {
-			return current, true
-		}
+	element, found := t.byName[name]
+	return element, found
+}
 
-		if current.leftChild != nil {
-			queue = append(queue, current.leftChild)
-		}
-		if current.rightChild != nil {
-			queue = append(queue, current.rightChild)
-		}
+// renameElement gives e a new name and keeps the name index in step
+func (t *Tree) renameElement(e *Element, name string) {
+	if t.byName[e.name] == e {
+		delete(t.byName, e.name)
 	}
-
-	return nil, false
+	e.name = name
+	if _, taken := t.byName[name]; !taken && t.byName != nil {
+		t.byName[name] = e
+	}
+	t.snapshotNames = nil
+	e.touch()
 }
 
 // Head returns the root element
@@ -451,56 +578,104 @@ func (t *Tree) Head() *Element {
 // Insert implements tree insertion
 // In TreeKEM, value is the user's public key
 // This function only manages tree structure - actual key derivation happens client-side
+// With WithCiphersuite the key must be a valid key for the ciphersuite's KEM
 func (t *Tree) Insert(name string, value []byte) error {
+	key, err := t.checkKey(value)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	return t.insert(name, key, nil)
+}
+
+// insert places a new leaf holding key and, when set, the leaf node it came from
+func (t *Tree) insert(name string, key PublicKey, leaf *LeafNode) (err error) {
+	if err := t.checkWritable("insert"); err != nil {
+		return err
+	}
+	end := t.startOp("insert", name)
+	defer func() { end(err) }()
+	// An empty key is how a blank leaf slot is told apart, see Element.IsBlank
+	if len(key.Data) == 0 {
+		return fmt.Errorf("failed to insert %s: %w", name, ErrEmptyKey)
+	}
+	if reservedName(name) {
+		return fmt.Errorf("failed to insert %s: %w", name, ErrReservedName)
+	}
+	if _, taken := t.byName[name]; taken {
+		return fmt.Errorf("failed to insert %s: %w", name, ErrExists)
+	}
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	// Members fill the leftmost blank slot before the tree grows
+	if slot := t.leftmostBlankLeaf(); slot != nil {
+		return t.fillBlank(slot, name, key, leaf)
+	}
+
 	newElement := &Element{
 		name:         name,
-		publicKey:    value, // This is the user's public key
+		publicKey:    key.Data, // This is the user's public key
+		keyAlgorithm: key.Algorithm,
+		keyEncoding:  key.Encoding,
+		leafNode:     leaf,
 		filePath:     t.generateFilePath(name),
+		store:        t.store,
+		format:       t.format,
 		nodeType:     "leaf",
 		leafIndex:    t.getNextLeafIndex(),
-		nodeIndex:    t.nextNodeIndex, // assign unique node number
-		lastModified: time.Now(),      // mark as modified when created
-		lastChecked:  time.Time{},     // not checked yet
+		nodeIndex:    -1,          // numbered once placed, see indexAppended
+		lastModified: time.Now(),  // mark as modified when created
+		lastChecked:  time.Time{}, // not checked yet
 	}
-	t.nextNodeIndex++ // increment for next node
 
 	// Save new element to disk
 	if err := newElement.saveToDisk(); err != nil {
 		return fmt.Errorf("failed to save new element to disk: %w", err)
 	}
 
+	var trace *PlacementTrace
+	if t.tracePlacement {
+		trace = &PlacementTrace{Leaf: name}
+		t.lastPlacement = trace
+	}
+
 	if t.head == nil {
+		if trace != nil {
+			trace.Result = "tree was empty, leaf became the root"
+		}
 		t.head = newElement
-		t.head.SetNodeIndex(0) // root is always node 0
-		t.nextNodeIndex = 1    // next node will be 1
-		return nil
+		t.indexAppended(newElement)
+		return t.syncManifestHead()
 	}
 
-	// TreeKEM insertion: only add to leaf positions
-	// This approach creates a new intermediate parent when adding to a leaf
+	// Left-balanced insertion (RFC 9420 appendix A): a full subtree, one holding a power
+	// of two leaves, is extended by a new parent taking it as the left child and the new
+	// leaf as the right one; any other subtree has a full left child and grows on the right.
+	// At the root this doubles the tree's leaf capacity
 	var insertToLeaf func(**Element, *Element) error
 	insertToLeaf = func(nodePtr **Element, newNode *Element) error {
 		current := *nodePtr
+		leaves := countLeaves(current)
 
-		// Check if current node is a leaf (no children)
-		if current.leftChild == nil && current.rightChild == nil {
-			// This is a leaf - we need to split it
-			// Create an intermediate node placeholder
+		if leaves&(leaves-1) == 0 {
+			// The subtree is full - place a new parent above it
 			// In real TreeKEM, the public key would be provided by clients after DH computation
+			intermediateName := newIntermediateName()
 			intermediateNode := &Element{
-				name:         generateIntermediateNodeName(t.nextNodeIndex, time.Now()),
-				publicKey:    []byte{}, // Will be set by client-side key derivation
-				filePath:     t.generateFilePath(generateIntermediateNodeName(t.nextNodeIndex, time.Now())),
+				name:         intermediateName,
+				publicKey:    []byte{},                             // Will be set by client-side key derivation
+				filePath:     t.generateFilePath(intermediateName), // must match name so LoadTree can find it
+				store:        t.store,
+				format:       t.format,
 				leftChild:    current,
 				rightChild:   newNode,
-				leftCount:    1,
+				leftCount:    leaves,
 				rightCount:   1,
 				nodeType:     "intermediate",
-				nodeIndex:    t.nextNodeIndex, // assign unique node number
-				lastModified: time.Now(),      // mark as modified when created
-				lastChecked:  time.Time{},     // not checked yet
+				nodeIndex:    -1,          // numbered once placed, see indexAppended
+				lastModified: time.Now(),  // mark as modified when created
+				lastChecked:  time.Time{}, // not checked yet
 			}
-			t.nextNodeIndex++ // increment for next node
 
 			// Save intermediate node
 			if err := intermediateNode.saveToDisk(); err != nil {
@@ -509,29 +684,40 @@ func (t *Tree) Insert(name string, value []byte) error {
 
 			// Replace current node's position with intermediate node
 			*nodePtr = intermediateNode
+			if trace != nil {
+				switch {
+				case current.IsLeaf():
+					trace.SplitLeaf = current.name
+					trace.Result = fmt.Sprintf("split leaf %s, new leaf placed as its right sibling", current.name)
+				case nodePtr == &t.head:
+					trace.Extended = true
+					trace.Result = fmt.Sprintf("all %d leaf slots occupied, new root doubles the capacity", leaves)
+				default:
+					trace.Result = fmt.Sprintf("subtree %s is full, new parent placed above it", current.name)
+				}
+			}
 			return nil
 		}
 
-		// Not a leaf - find the subtree with fewer leaves
 		leftLeafCount := countLeaves(current.leftChild)
 		rightLeafCount := countLeaves(current.rightChild)
 
-		if leftLeafCount <= rightLeafCount {
-			// Insert to left subtree
-			if current.leftChild == nil {
-				current.leftChild = newNode
-				current.leftCount = 1
-			} else {
-				if err := insertToLeaf(&current.leftChild, newNode); err != nil {
-					return err
-				}
-				current.leftCount++
+		if current.leftChild == nil {
+			// A parent left with only a right child takes the leaf back on the left
+			trace.recordStep(current, leftLeafCount, rightLeafCount, "left")
+			current.leftChild = newNode
+			current.leftCount = 1
+			if trace != nil {
+				trace.Result = fmt.Sprintf("filled empty left slot of %s", current.name)
 			}
 		} else {
-			// Insert to right subtree
+			trace.recordStep(current, leftLeafCount, rightLeafCount, "right")
 			if current.rightChild == nil {
 				current.rightChild = newNode
 				current.rightCount = 1
+				if trace != nil {
+					trace.Result = fmt.Sprintf("filled empty right slot of %s", current.name)
+				}
 			} else {
 				if err := insertToLeaf(&current.rightChild, newNode); err != nil {
 					return err
@@ -542,6 +728,8 @@ func (t *Tree) Insert(name string, value []byte) error {
 
 		// In real TreeKEM, intermediate keys are set by clients, not automatically derived
 		// We skip automatic key derivation here
+		// A keyed ancestor now covers a leaf that does not know its private key
+		current.addUnmerged(newNode.leafIndex)
 
 		// Save updated current node
 		return current.saveToDisk()
@@ -552,11 +740,14 @@ func (t *Tree) Insert(name string, value []byte) error {
 		return err
 	}
 
-	// Reassign node indices to maintain TreeKEM ordering
-	t.reassignNodeIndices()
+	// A member lands on the right edge, so only the new nodes need numbers; only a tree
+	// out of left-balanced shape places it elsewhere, shifting the nodes after it
+	if !t.indexAppended(newElement) {
+		t.reassignNodeIndices()
+	}
 
 	// In real TreeKEM, keys are set by clients after DH computation
-	return nil
+	return t.syncManifestHead()
 }
 
 // Helper function to count leaf nodes in a subtree
@@ -590,182 +781,135 @@ func (t *Tree) getNextLeafIndex() int {
 	return maxIndex + 1
 }
 
-// reassignNodeIndices assigns proper TreeKEM node indices to all nodes
-// TreeKEM uses level-order (breadth-first) numbering: root=0, level1=[1,2], level2=[3,4,5,6], etc.
+// reassignNodeIndices numbers every node with its RFC 9420 array index (appendix C)
+// The array lists the nodes in order, left subtree before its parent before the right
+// subtree, so in the left-balanced trees MLS builds the leaf at position i is node 2i and
+// parents follow the index arithmetic of ratchettree.go. A tree restructured out of that
+// shape keeps the same order, so indices stay unique even where the arithmetic no longer
+// applies. The same pass links every element to its parent, lays the elements out in
+// t.nodes and indexes their names, so lookups by index or name and moves to the parent or
+// sibling need no search. Member operations never rescan a left-balanced tree: appends
+// and truncations update the array in place, see indexAppended and truncate, and blanking
+// or filling a slot moves nothing. The pass runs only where the whole tree is rebuilt
+// anyway - loading, importing, reloading, applying a patch and Rebalance - and when a
+// member is placed in or removed from a tree out of left-balanced shape, whose in-order
+// positions shift
 func (t *Tree) reassignNodeIndices() {
+	t.nodes = make([]*Element, 0, len(t.nodes))
+	t.byName = make(map[string]*Element, len(t.byName))
+	t.unevenLeaves = false
+	t.dirty = nil // any position may have changed, so the next Snapshot compares every node
 	if t.head == nil {
 		return
 	}
 
-	// Use breadth-first traversal to assign indices
-	queue := []*Element{t.head}
-	index := 0
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-
-		current.SetNodeIndex(index)
-		index++
-
-		if current.leftChild != nil {
-			queue = append(queue, current.leftChild)
+	t.head.parent = nil
+	var place func(e *Element)
+	place = func(e *Element) {
+		if e.leftChild != nil {
+			e.leftChild.parent = e
+			place(e.leftChild)
 		}
-		if current.rightChild != nil {
-			queue = append(queue, current.rightChild)
+		t.indexNode(e)
+		if e.rightChild != nil {
+			e.rightChild.parent = e
+			place(e.rightChild)
 		}
 	}
-
-	t.nextNodeIndex = index
+	place(t.head)
 }
 
-// renameIntermediateNodes updates intermediate node names after deletion
-// to reflect the current leaf nodes in each subtree
-func (t *Tree) renameIntermediateNodes() {
-	if t.head == nil {
-		return
+// indexNode appends e to the node array and the name index
+func (t *Tree) indexNode(e *Element) {
+	e.owner = t
+	e.SetNodeIndex(len(t.nodes))
+	t.nodes = append(t.nodes, e)
+	if t.byName == nil {
+		t.byName = make(map[string]*Element)
 	}
-
-	var updateNames func(*Element)
-	updateNames = func(node *Element) {
-		if node == nil {
-			return
-		}
-
-		// Recursively update children first
-		updateNames(node.leftChild)
-		updateNames(node.rightChild)
-
-		// If this is an intermediate node, update its name
-		if node.nodeType == "intermediate" {
-			var leftLeafNames []string
-			var rightLeafNames []string
-
-			// Collect leaf names from left subtree
-			if node.leftChild != nil {
-				leftLeafNames = collectLeafNames(node.leftChild)
-			}
-
-			// Collect leaf names from right subtree
-			if node.rightChild != nil {
-				rightLeafNames = collectLeafNames(node.rightChild)
-			}
-
-			// Generate new name based on current leaves
-			if len(leftLeafNames) > 0 && len(rightLeafNames) > 0 {
-				oldFilePath := node.filePath
-				newName := generateIntermediateNodeName(node.nodeIndex, time.Now())
-				node.name = newName
-				node.filePath = t.generateFilePath(newName)
-
-				// Remove old file and save with new name
-				if oldFilePath != "" {
-					os.Remove(oldFilePath)
-				}
-				node.saveToDisk()
-			}
-		}
+	if _, taken := t.byName[e.name]; !taken {
+		t.byName[e.name] = e
 	}
-
-	updateNames(t.head)
+	if e.nodeType == "leaf" && e.nodeIndex != 2*e.leafIndex {
+		t.unevenLeaves = true
+	}
+	t.snapshotNames = nil
 }
 
-// collectLeafNames collects all leaf node names in a subtree
-func collectLeafNames(node *Element) []string {
-	if node == nil {
-		return nil
+// indexAppended numbers the nodes an insert added on the right edge of the tree
+// Those nodes come last in the array, so the existing indices stay as they are; it
+// reports false when leaf was placed anywhere else and the tree needs renumbering
+func (t *Tree) indexAppended(leaf *Element) bool {
+	var spine []*Element
+	for node := t.head; node != nil; node = node.rightChild {
+		spine = append(spine, node)
 	}
-
-	if node.nodeType == "leaf" {
-		return []string{node.name}
+	if spine[len(spine)-1] != leaf {
+		return false
 	}
-
-	var names []string
-	names = append(names, collectLeafNames(node.leftChild)...)
-	names = append(names, collectLeafNames(node.rightChild)...)
-	return names
+	for i, node := range spine {
+		if node.nodeIndex >= 0 {
+			continue
+		}
+		if i > 0 {
+			node.parent = spine[i-1]
+		} else {
+			node.parent = nil
+		}
+		if node.leftChild != nil {
+			node.leftChild.parent = node
+			node.leftChild.touch() // its parent index changed
+		}
+		t.indexNode(node)
+	}
+	return true
 }
 
-// GetNodeByIndex finds a node by its index number
+// GetNodeByIndex returns the node with the given index number, nil when there is none
 func (t *Tree) GetNodeByIndex(targetIndex int) *Element {
-	if t.head == nil {
+	if targetIndex < 0 || targetIndex >= len(t.nodes) {
 		return nil
 	}
+	return t.nodes[targetIndex]
+}
 
-	// Use breadth-first search to find the node
-	queue := []*Element{t.head}
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-
-		if current.NodeIndex() == targetIndex {
-			return current
-		}
-
-		if current.leftChild != nil {
-			queue = append(queue, current.leftChild)
-		}
-		if current.rightChild != nil {
-			queue = append(queue, current.rightChild)
-		}
-	}
-
-	return nil
+// newIntermediateName returns a fresh name for an intermediate node
+// The name is 128 random bits rather than anything derived from the node's position or
+// leaves, so it never has to change when the tree is restructured and names created by
+// separate operations, replicas or imports do not collide
+func newIntermediateName() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return fmt.Sprintf("int_%x", id)
 }
 
-// generateIntermediateNodeName creates a hash-based name for intermediate nodes
-// using timestamp and node index to ensure uniqueness
-func generateIntermediateNodeName(nodeIndex int, timestamp time.Time) string {
-	hasher := sha256.New()
-	
-	// Add domain separation
-	hasher.Write([]byte("TreeKEM-intermediate-node"))
-	
-	// Add timestamp (nanoseconds for high precision)
-	timestampBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(timestampBytes, uint64(timestamp.UnixNano()))
-	hasher.Write(timestampBytes)
-	
-	// Add node index
-	indexBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(indexBytes, uint32(nodeIndex))
-	hasher.Write(indexBytes)
-	
-	// Return first 16 bytes (128 bits) as hex string
-	hash := hasher.Sum(nil)
-	return fmt.Sprintf("int_%x", hash[:16])
-}
-
-func DerivePublicKey(leftPubKey, rightPubKey []byte) []byte {
+// placeholderKey hashes the keys of an intermediate node's children into a stand-in
+// key. It is not an HPKE key and nobody holds a private key for it
+func placeholderKey(leftPubKey, rightPubKey []byte) []byte {
 	if len(leftPubKey) == 0 && len(rightPubKey) == 0 {
 		return []byte{}
 	}
 
-	// Simple public key derivation using hash
-	// In real TreeKEM, this would be more complex cryptographic operations
 	hasher := sha256.New()
-
-	// Add domain separation
 	hasher.Write([]byte("TreeKEM-intermediate-pubkey"))
 
-	// Add length prefixes to prevent collision attacks
-	leftLen := make([]byte, 4)
-	rightLen := make([]byte, 4)
-	binary.BigEndian.PutUint32(leftLen, uint32(len(leftPubKey)))
-	binary.BigEndian.PutUint32(rightLen, uint32(len(rightPubKey)))
-
-	hasher.Write(leftLen)
+	// Length prefixes keep different splits of the same bytes apart
+	hasher.Write(binary.BigEndian.AppendUint32(nil, uint32(len(leftPubKey))))
 	hasher.Write(leftPubKey)
-	hasher.Write(rightLen)
+	hasher.Write(binary.BigEndian.AppendUint32(nil, uint32(len(rightPubKey))))
 	hasher.Write(rightPubKey)
 
 	return hasher.Sum(nil)
 }
 
-// UpdateIntermediateKeys updates all intermediate node keys based on their children
-// This should be called after any tree modification
+// UpdateIntermediateKeys gives every intermediate node a placeholder key hashed from its
+// children's keys, enough to make the structure hashable before any member commits
+// The placeholders are not HPKE keys; real node keys come from path secrets, see
+// treekem.ApplyPathSecret and SetPathKeys
 func (t *Tree) UpdateIntermediateKeys() error {
+	if err := t.checkWritable("update keys"); err != nil {
+		return err
+	}
 	if t.head == nil {
 		return nil
 	}
@@ -793,14 +937,15 @@ func (t *Tree) UpdateIntermediateKeys() error {
 			var leftPubKey, rightPubKey []byte
 
 			if node.leftChild != nil {
-				leftPubKey = node.leftChild.publicKey
+				leftPubKey = node.leftChild.key()
 			}
 			if node.rightChild != nil {
-				rightPubKey = node.rightChild.publicKey
+				rightPubKey = node.rightChild.key()
 			}
 
-			// Derive new public key for this intermediate node
-			node.publicKey = DerivePublicKey(leftPubKey, rightPubKey)
+			if err := t.setNodeKey(node, PublicKey{Data: placeholderKey(leftPubKey, rightPubKey)}); err != nil {
+				return err
+			}
 
 			// Save updated node
 			if err := node.saveToDisk(); err != nil {
@@ -819,7 +964,7 @@ func (t *Tree) GetGroupPublicKey() []byte {
 	if t.head == nil {
 		return nil
 	}
-	return t.head.publicKey
+	return t.head.key()
 }
 
 // GetLeaves returns all leaf nodes (actual users) in the tree
@@ -847,6 +992,18 @@ func (t *Tree) GetLeaves() []*Element {
 	return leaves
 }
 
+// MemberCount returns the number of leaves held by members, leaving out the blank
+// slots Delete leaves behind
+func (t *Tree) MemberCount() int {
+	n := 0
+	for _, leaf := range t.GetLeaves() {
+		if !leaf.IsBlank() {
+			n++
+		}
+	}
+	return n
+}
+
 // GetPath returns the path from a leaf node to the root
 // This is important for TreeKEM key derivation
 func (t *Tree) GetPath(leafName string) ([]*Element, error) {
@@ -854,40 +1011,35 @@ func (t *Tree) GetPath(leafName string) ([]*Element, error) {
 		return nil, fmt.Errorf("tree is empty")
 	}
 
-	var path []*Element
-	var findPath func(*Element, string) bool
-	findPath = func(node *Element, targetName string) bool {
-		if node == nil {
-			return false
-		}
-
-		// Add current node to path
-		path = append(path, node)
-
-		if node.name == targetName {
-			return true
-		}
-
-		// Search in children
-		if findPath(node.leftChild, targetName) || findPath(node.rightChild, targetName) {
-			return true
-		}
-
-		// Remove from path if not found in this subtree
-		path = path[:len(path)-1]
-		return false
+	node, found := t.Find(leafName)
+	if !found {
+		return nil, fmt.Errorf("leaf node not found: %s", leafName)
 	}
 
-	if findPath(t.head, leafName) {
-		return path, nil
+	// Walk up to the root, then put the root first
+	var path []*Element
+	for ; node != nil; node = node.parent {
+		path = append(path, node)
 	}
-
-	return nil, fmt.Errorf("leaf node not found: %s", leafName)
+	slices.Reverse(path)
+	return path, nil
 }
 
 // SetIntermediateNodeKey allows clients to set the public key for an intermediate node
 // after they have computed it using Diffie-Hellman key exchange
 func (t *Tree) SetIntermediateNodeKey(nodeName string, publicKey []byte) error {
+	return t.setIntermediateNodeKey(nodeName, publicKey, nil)
+}
+
+// setIntermediateNodeKey implements SetIntermediateNodeKey and
+// SetIntermediateNodeKeyIfVersion; expected, when set, must hold the node's version
+func (t *Tree) setIntermediateNodeKey(nodeName string, publicKey []byte, expected *uint64) (err error) {
+	if err := t.checkWritable("set key"); err != nil {
+		return err
+	}
+	end := t.startOp("set_key", nodeName)
+	defer func() { end(err) }()
+
 	node, found := t.Find(nodeName)
 	if !found {
 		return fmt.Errorf("node not found: %s", nodeName)
@@ -896,48 +1048,60 @@ func (t *Tree) SetIntermediateNodeKey(nodeName string, publicKey []byte) error {
 	if node.nodeType != "intermediate" {
 		return fmt.Errorf("can only set keys for intermediate nodes")
 	}
+	if expected != nil && node.version != *expected {
+		return fmt.Errorf("%w: %s is at version %d, expected %d", ErrVersionConflict, nodeName, node.version, *expected)
+	}
+
+	key, err := t.checkKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to set key for %s: %w", nodeName, err)
+	}
 
-	node.publicKey = publicKey
+	if err := t.setNodeKey(node, key); err != nil {
+		return err
+	}
 	node.MarkAsModified() // mark as modified when key is updated
 	return node.saveToDisk()
 }
 
 // GetTreeStructure returns the current tree structure for client-side key computation
 func (t *Tree) GetTreeStructure() map[string]*NodeInfo {
-	structure := make(map[string]*NodeInfo)
-
-	var traverse func(*Element)
-	traverse = func(node *Element) {
-		if node == nil {
-			return
-		}
-
-		info := &NodeInfo{
-			Name:        node.name,
-			PublicKey:   node.publicKey,
-			NodeType:    node.nodeType,
-			LeafIndex:   node.leafIndex,
-			NodeIndex:   node.nodeIndex,
-			ParentIndex: node.ParentIndex(),
-		}
-
-		if node.leftChild != nil {
-			info.LeftChild = node.leftChild.name
-		}
-		if node.rightChild != nil {
-			info.RightChild = node.rightChild.name
-		}
-
-		structure[node.name] = info
-
-		traverse(node.leftChild)
-		traverse(node.rightChild)
+	structure := make(map[string]*NodeInfo, len(t.nodes))
+	for _, node := range t.nodes {
+		info := node.Info()
+		structure[node.name] = &info
 	}
-
-	traverse(t.head)
 	return structure
 }
 
+// Info describes the element as GetTreeStructure does
+// The parent index comes from the actual parent rather than the arithmetic convention,
+// which only holds for complete trees
+func (e *Element) Info() NodeInfo {
+	e.unshelve()
+	info := NodeInfo{
+		Name:         e.name,
+		PublicKey:    e.key(),
+		KeyAlgorithm: e.keyAlgorithm,
+		KeyEncoding:  e.keyEncoding,
+		NodeType:     e.nodeType,
+		LeafIndex:    e.leafIndex,
+		NodeIndex:    e.nodeIndex,
+		ParentIndex:  e.ParentIndex(),
+		LeafNode:     encodeLeafNode(e.LeafNode()),
+		ParentHash:   e.parentHash,
+		Unmerged:     slices.Clone(e.unmerged),
+		Version:      e.version,
+	}
+	if e.leftChild != nil {
+		info.LeftChild = e.leftChild.name
+	}
+	if e.rightChild != nil {
+		info.RightChild = e.rightChild.name
+	}
+	return info
+}
+
 // GetModifiedNodes returns all nodes that have been modified since the given time
 func (t *Tree) GetModifiedNodes(since time.Time) []*Element {
 	if t.head == nil {
@@ -1035,4 +1199,4 @@ func (t *Tree) GetAllElements() []*Element {
 
 	traverse(t.head)
 	return elements
-}
\ No newline at end of file
+}
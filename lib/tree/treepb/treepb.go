@@ -0,0 +1,301 @@
+// Package treepb converts tree state to and from the protobuf messages in tree.proto
+//
+// The encoder implements the proto3 wire format with the standard library only, so
+// importing it never pulls a protobuf runtime into the core build. Bytes it produces
+// decode with code generated from tree.proto and vice versa; servers built on gRPC
+// can pass them through as raw message payloads.
+package treepb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Snapshot is the decoded form of a TreeSnapshot message
+type Snapshot struct {
+	Version       uint64
+	StructureHash []byte
+	Nodes         []tree.NodeInfo // ordered by node index
+}
+
+// NewSnapshot captures the current state of t
+func NewSnapshot(t *tree.Tree) *Snapshot {
+	structure := t.GetTreeStructure()
+	nodes := make([]tree.NodeInfo, 0, len(structure))
+	for _, info := range structure {
+		nodes = append(nodes, *info)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].NodeIndex < nodes[j].NodeIndex
+	})
+	return &Snapshot{Version: t.Version(), StructureHash: t.StructureHash(), Nodes: nodes}
+}
+
+// Marshal encodes the snapshot as a TreeSnapshot message
+func (s *Snapshot) Marshal() []byte {
+	var out []byte
+	out = appendUint(out, 1, s.Version)
+	out = appendBytes(out, 2, s.StructureHash)
+	for _, node := range s.Nodes {
+		out = appendBytes(out, 3, MarshalNodeInfo(node))
+	}
+	return out
+}
+
+// UnmarshalSnapshot decodes a TreeSnapshot message
+func UnmarshalSnapshot(data []byte) (*Snapshot, error) {
+	s := &Snapshot{}
+	err := decodeFields(data, func(field int, value uint64, raw []byte) error {
+		switch field {
+		case 1:
+			s.Version = value
+		case 2:
+			s.StructureHash = raw
+		case 3:
+			node, err := UnmarshalNodeInfo(raw)
+			if err != nil {
+				return err
+			}
+			s.Nodes = append(s.Nodes, node)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid TreeSnapshot: %w", err)
+	}
+	return s, nil
+}
+
+// MarshalNodeInfo encodes a NodeInfo message
+func MarshalNodeInfo(info tree.NodeInfo) []byte {
+	var out []byte
+	out = appendString(out, 1, info.Name)
+	out = appendBytes(out, 2, info.PublicKey)
+	out = appendString(out, 3, info.NodeType)
+	out = appendInt(out, 4, info.LeafIndex)
+	out = appendInt(out, 5, info.NodeIndex)
+	out = appendInt(out, 6, info.ParentIndex)
+	out = appendString(out, 7, info.LeftChild)
+	out = appendString(out, 8, info.RightChild)
+	out = appendUint(out, 9, uint64(info.KeyAlgorithm))
+	out = appendUint(out, 10, uint64(info.KeyEncoding))
+	out = appendBytes(out, 11, info.LeafNode)
+	out = appendBytes(out, 12, info.ParentHash)
+	out = appendPackedInts(out, 13, info.Unmerged)
+	out = appendUint(out, 14, info.Version)
+	return out
+}
+
+// UnmarshalNodeInfo decodes a NodeInfo message
+func UnmarshalNodeInfo(data []byte) (tree.NodeInfo, error) {
+	var info tree.NodeInfo
+	err := decodeFields(data, func(field int, value uint64, raw []byte) error {
+		switch field {
+		case 1:
+			info.Name = string(raw)
+		case 2:
+			info.PublicKey = raw
+		case 3:
+			info.NodeType = string(raw)
+		case 4:
+			info.LeafIndex = int(int32(value))
+		case 5:
+			info.NodeIndex = int(int32(value))
+		case 6:
+			info.ParentIndex = int(int32(value))
+		case 7:
+			info.LeftChild = string(raw)
+		case 8:
+			info.RightChild = string(raw)
+		case 9:
+			info.KeyAlgorithm = tree.KeyAlgorithm(value)
+		case 10:
+			info.KeyEncoding = tree.KeyEncoding(value)
+		case 11:
+			info.LeafNode = raw
+		case 12:
+			info.ParentHash = raw
+		case 13:
+			// Packed, as proto3 writes it, or one element per field from older encoders
+			if raw == nil {
+				info.Unmerged = append(info.Unmerged, int(int32(value)))
+				return nil
+			}
+			leaves, err := decodePackedInts(raw)
+			if err != nil {
+				return fmt.Errorf("field 13: %w", err)
+			}
+			info.Unmerged = append(info.Unmerged, leaves...)
+		case 14:
+			info.Version = value
+		}
+		return nil
+	})
+	if err != nil {
+		return tree.NodeInfo{}, fmt.Errorf("invalid NodeInfo: %w", err)
+	}
+	return info, nil
+}
+
+// MarshalChanges encodes events as a ChangeList message
+func MarshalChanges(events []tree.ChangeEvent) []byte {
+	var out []byte
+	for _, event := range events {
+		var change []byte
+		change = appendString(change, 1, event.Op)
+		change = appendString(change, 2, event.Name)
+		if !event.Time.IsZero() {
+			change = appendUint(change, 3, uint64(event.Time.UnixNano()))
+		}
+		out = appendBytes(out, 1, change)
+	}
+	return out
+}
+
+// UnmarshalChanges decodes a ChangeList message
+func UnmarshalChanges(data []byte) ([]tree.ChangeEvent, error) {
+	var events []tree.ChangeEvent
+	err := decodeFields(data, func(field int, _ uint64, raw []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var event tree.ChangeEvent
+		err := decodeFields(raw, func(field int, value uint64, raw []byte) error {
+			switch field {
+			case 1:
+				event.Op = string(raw)
+			case 2:
+				event.Name = string(raw)
+			case 3:
+				event.Time = time.Unix(0, int64(value))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ChangeList: %w", err)
+	}
+	return events, nil
+}
+
+// Wire types of the proto3 encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(out []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(out, uint64(field)<<3|uint64(wireType))
+}
+
+// appendUint writes a varint field, omitting the proto3 default
+func appendUint(out []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return out
+	}
+	out = appendTag(out, field, wireVarint)
+	return binary.AppendUvarint(out, v)
+}
+
+// appendInt writes an int32 field; negative values are sign-extended to ten bytes as protobuf does
+func appendInt(out []byte, field int, v int) []byte {
+	return appendUint(out, field, uint64(int64(int32(v))))
+}
+
+func appendBytes(out []byte, field int, b []byte) []byte {
+	if len(b) == 0 {
+		return out
+	}
+	out = appendTag(out, field, wireBytes)
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// appendPackedInts writes a repeated int32 field in the packed encoding proto3 uses by default
+func appendPackedInts(out []byte, field int, vs []int) []byte {
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, uint64(int64(int32(v))))
+	}
+	return appendBytes(out, field, packed)
+}
+
+// decodePackedInts reads the payload of a packed repeated int32 field
+func decodePackedInts(data []byte) ([]int, error) {
+	var vs []int
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("truncated packed varint")
+		}
+		vs = append(vs, int(int32(v)))
+		data = data[n:]
+	}
+	return vs, nil
+}
+
+func appendString(out []byte, field int, s string) []byte {
+	return appendBytes(out, field, []byte(s))
+}
+
+// decodeFields walks the fields of a message, skipping unknown fixed-width ones
+// visit receives varint values in value and length-delimited payloads in raw
+func decodeFields(data []byte, visit func(field int, value uint64, raw []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("truncated tag")
+		}
+		data = data[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		if field == 0 {
+			return errors.New("invalid field number 0")
+		}
+
+		switch wireType {
+		case wireVarint:
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("truncated varint in field %d", field)
+			}
+			data = data[n:]
+			if err := visit(field, value, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return fmt.Errorf("truncated bytes in field %d", field)
+			}
+			raw := append([]byte(nil), data[n:n+int(length)]...)
+			data = data[n+int(length):]
+			if err := visit(field, 0, raw); err != nil {
+				return err
+			}
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wireType == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return fmt.Errorf("truncated fixed field %d", field)
+			}
+			data = data[size:]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", wireType, field)
+		}
+	}
+	return nil
+}
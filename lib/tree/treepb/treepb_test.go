@@ -0,0 +1,113 @@
+package treepb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/tree/memory"
+)
+
+func TestNodeInfoWireFormat(t *testing.T) {
+	// Bytes as produced by protoc-generated code for the same message
+	want := []byte{
+		0x0a, 0x01, 'a', // name
+		0x1a, 0x04, 'l', 'e', 'a', 'f', // node_type
+		0x30, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // parent_index = -1
+	}
+	got := MarshalNodeInfo(tree.NodeInfo{Name: "a", NodeType: "leaf", ParentIndex: -1})
+	if !bytes.Equal(got, want) {
+		t.Fatalf("unexpected encoding\n got %x\nwant %x", got, want)
+	}
+
+	// Unknown fields from newer schemas are skipped
+	extended := append(append([]byte(nil), want...), 0x98, 0x06, 0x01, 0xa1, 0x06, 1, 2, 3, 4, 5, 6, 7, 8)
+	info, err := UnmarshalNodeInfo(extended)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if info.Name != "a" || info.ParentIndex != -1 {
+		t.Errorf("unexpected decode: %+v", info)
+	}
+}
+
+func TestNodeInfoRoundTrip(t *testing.T) {
+	// Every field set, so a field the codec drops shows up as a mismatch
+	info := tree.NodeInfo{
+		Name:         "alice",
+		PublicKey:    []byte("alice_key"),
+		KeyAlgorithm: tree.KeyAlgorithm(2),
+		KeyEncoding:  tree.KeyEncoding(1),
+		NodeType:     "leaf",
+		LeafIndex:    3,
+		NodeIndex:    6,
+		ParentIndex:  5,
+		LeftChild:    "left",
+		RightChild:   "right",
+		LeafNode:     []byte{0x00, 0x20, 0x01},
+		ParentHash:   []byte("parent hash"),
+		Unmerged:     []int{0, 7, 300},
+		Version:      42,
+	}
+	decoded, err := UnmarshalNodeInfo(MarshalNodeInfo(info))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, info) {
+		t.Errorf("round trip mismatch\n got %+v\nwant %+v", decoded, info)
+	}
+
+	// Unpacked repeated elements, as some encoders still write them, decode the same way
+	unpacked := []byte{0x68, 0x00, 0x68, 0x07, 0x68, 0xac, 0x02}
+	decoded, err = UnmarshalNodeInfo(unpacked)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Unmerged, info.Unmerged) {
+		t.Errorf("unexpected unpacked unmerged leaves %v", decoded.Unmerged)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tr := memory.NewTree()
+	for _, user := range []string{"alice", "bob", "charlie"} {
+		tr.Insert(user, []byte(user+"_key"))
+	}
+
+	snapshot, err := UnmarshalSnapshot(NewSnapshot(tr).Marshal())
+	if err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	if snapshot.Version != tr.Version() || !bytes.Equal(snapshot.StructureHash, tr.StructureHash()) {
+		t.Errorf("snapshot header mismatch")
+	}
+
+	rebuilt, err := tree.ImportNodes(snapshot.Nodes, nil)
+	if err != nil {
+		t.Fatalf("Failed to import snapshot: %v", err)
+	}
+	if !bytes.Equal(rebuilt.StructureHash(), tr.StructureHash()) {
+		t.Errorf("imported snapshot differs from the source tree")
+	}
+
+	if _, err := UnmarshalSnapshot(NewSnapshot(tr).Marshal()[:10]); err == nil {
+		t.Errorf("truncated snapshot should fail to decode")
+	}
+}
+
+func TestChangeListRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 42)
+	events := []tree.ChangeEvent{
+		{Op: "insert", Name: "alice", Time: now},
+		{Op: "delete", Name: "bob"},
+	}
+	decoded, err := UnmarshalChanges(MarshalChanges(events))
+	if err != nil {
+		t.Fatalf("Failed to decode changes: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0].Name != "alice" || !decoded[0].Time.Equal(now) || decoded[1].Op != "delete" || !decoded[1].Time.IsZero() {
+		t.Errorf("unexpected changes: %+v", decoded)
+	}
+}
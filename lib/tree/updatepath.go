@@ -0,0 +1,202 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+)
+
+// HPKECiphertext is an HPKE encapsulated key and ciphertext (RFC 9420 section 5.1.3)
+type HPKECiphertext struct {
+	KEMOutput  []byte
+	Ciphertext []byte
+}
+
+// UpdatePathNode is the new key of one direct-path node and its path secret encrypted to
+// every node in the resolution of the copath child (RFC 9420 section 7.6)
+type UpdatePathNode struct {
+	EncryptionKey       []byte
+	EncryptedPathSecret []HPKECiphertext
+}
+
+// UpdatePath is what a committer sends to refresh its leaf and direct path
+// Nodes run from the leaf's parent up to the root; lib/treekem generates it
+type UpdatePath struct {
+	LeafNode *LeafNode
+	Nodes    []UpdatePathNode
+}
+
+// MarshalBinary encodes the update path in its RFC 9420 wire format
+func (p *UpdatePath) MarshalBinary() ([]byte, error) {
+	if p.LeafNode == nil {
+		return nil, errors.New("update path has no leaf node")
+	}
+	w := &tls.Writer{}
+	if err := p.LeafNode.encode(w); err != nil {
+		return nil, err
+	}
+	err := w.Vector(func(w *tls.Writer) error {
+		for _, node := range p.Nodes {
+			if err := w.Opaque(node.EncryptionKey); err != nil {
+				return err
+			}
+			err := w.Vector(func(w *tls.Writer) error {
+				for _, ct := range node.EncryptedPathSecret {
+					if err := w.Opaque(ct.KEMOutput); err != nil {
+						return err
+					}
+					if err := w.Opaque(ct.Ciphertext); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode update path: %w", err)
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalBinary decodes an update path written by MarshalBinary
+func (p *UpdatePath) UnmarshalBinary(data []byte) error {
+	decoded, rest, err := ReadUpdatePath(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%d trailing bytes after update path", len(rest))
+	}
+	*p = *decoded
+	return nil
+}
+
+// ReadUpdatePath decodes the update path at the start of data and returns the bytes
+// after it, for Commits that carry one
+func ReadUpdatePath(data []byte) (*UpdatePath, []byte, error) {
+	leaf, rest, err := ReadLeafNode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	decoded := &UpdatePath{LeafNode: leaf}
+	r := &tls.Reader{Buf: rest}
+	err = r.Vector(func(r *tls.Reader) error {
+		var node UpdatePathNode
+		var err error
+		if node.EncryptionKey, err = r.Opaque(); err != nil {
+			return err
+		}
+		err = r.Vector(func(r *tls.Reader) error {
+			var ct HPKECiphertext
+			var err error
+			if ct.KEMOutput, err = r.Opaque(); err != nil {
+				return err
+			}
+			if ct.Ciphertext, err = r.Opaque(); err != nil {
+				return err
+			}
+			node.EncryptedPathSecret = append(node.EncryptedPathSecret, ct)
+			return nil
+		})
+		decoded.Nodes = append(decoded.Nodes, node)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode update path: %w", err)
+	}
+	return decoded, r.Buf, nil
+}
+
+// ApplyUpdatePath installs a committer's UpdatePath, the server half of a Commit
+// The sender's leaf takes the path's commit leaf node and every parent on its direct path
+// the new key, with parent hashes recomputed. The path must have one node per parent,
+// each with a ciphertext for every node in its copath resolution, and the leaf node must
+// be signed and carry the parent hash of the new path. Nothing changes unless all of it
+// checks out, and the writes are applied as one atomic operation
+func (t *Tree) ApplyUpdatePath(senderLeaf string, path *UpdatePath) (err error) {
+	if err := t.checkWritable("apply update path"); err != nil {
+		return err
+	}
+	end := t.startOp("apply_update_path", senderLeaf)
+	defer func() { end(err) }()
+
+	nodes, err := t.GetPath(senderLeaf)
+	if err != nil {
+		return err
+	}
+	leaf := nodes[len(nodes)-1]
+	if !leaf.IsLeaf() {
+		return fmt.Errorf("%s is not a leaf", senderLeaf)
+	}
+	parents := nodes[:len(nodes)-1]
+	if path.LeafNode == nil || path.LeafNode.Source != LeafNodeSourceCommit {
+		return fmt.Errorf("update path of %s must carry a commit leaf node", senderLeaf)
+	}
+	if len(path.Nodes) != len(parents) {
+		return fmt.Errorf("direct path of %s has %d nodes, update path has %d", senderLeaf, len(parents), len(path.Nodes))
+	}
+
+	keys := make([]PublicKey, len(path.Nodes))
+	stored := make([][]byte, len(path.Nodes))
+	for i, node := range path.Nodes {
+		parent, child := parents[len(parents)-1-i], nodes[len(nodes)-1-i]
+		if keys[i], err = t.checkKey(node.EncryptionKey); err != nil {
+			return fmt.Errorf("failed to set key of %s: %w", parent.name, err)
+		}
+		stored[i] = keys[i].Data
+		copath, _ := siblingOf(parent, child, 0)
+		if want := len(t.resolution(copath)); len(node.EncryptedPathSecret) != want {
+			return fmt.Errorf("update path node %d has %d ciphertexts for a copath resolution of %d", i, len(node.EncryptedPathSecret), want)
+		}
+	}
+	hashes := pathParentHashes(nodes, stored)
+	var leafParentHash []byte
+	if len(hashes) > 0 {
+		leafParentHash = hashes[len(hashes)-1]
+	}
+	if !bytes.Equal(path.LeafNode.ParentHash, leafParentHash) {
+		return fmt.Errorf("%w: commit leaf node of %s does not carry the path's parent hash", ErrParentHashMismatch, senderLeaf)
+	}
+	if err := t.admitLeaf(senderLeaf, path.LeafNode, leaf.leafIndex); err != nil {
+		return fmt.Errorf("failed to update %s: %w", senderLeaf, err)
+	}
+	leafKey, err := t.checkKey(path.LeafNode.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", senderLeaf, err)
+	}
+
+	commit := t.beginAtomic()
+	defer func() { err = commit(err) }()
+
+	for i, key := range keys {
+		if err := t.setNodeKey(parents[len(parents)-1-i], key); err != nil {
+			return err
+		}
+	}
+	if len(parents) > 0 {
+		parents[0].parentHash = nil
+	}
+	for i, hash := range hashes {
+		nodes[i+1].parentHash = hash
+	}
+	if err := t.setNodeKey(leaf, leafKey); err != nil {
+		return err
+	}
+	leaf.leafNode = path.LeafNode
+	leaf.parentHash = leafParentHash
+
+	for _, node := range nodes {
+		node.MarkAsModified()
+		if err := node.saveToDisk(); err != nil {
+			return fmt.Errorf("failed to save %s: %w", node.name, err)
+		}
+	}
+	return nil
+}
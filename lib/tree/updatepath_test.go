@@ -0,0 +1,100 @@
+package tree
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testUpdatePath returns an update path for name with fresh keys and one dummy ciphertext
+// per copath resolution entry; the server only checks their count
+func testUpdatePath(t *testing.T, tr *Tree, name string) *UpdatePath {
+	t.Helper()
+	path, _ := tr.GetPath(name)
+	keys := testPathKeys(t, len(path)-1)
+	update := &UpdatePath{Nodes: make([]UpdatePathNode, len(keys))}
+	for i, key := range keys {
+		copath, _ := siblingOf(path[len(path)-2-i], path[len(path)-1-i], 0)
+		update.Nodes[i].EncryptionKey = key
+		for range tr.resolution(copath) {
+			update.Nodes[i].EncryptedPathSecret = append(update.Nodes[i].EncryptedPathSecret, HPKECiphertext{KEMOutput: []byte("kem"), Ciphertext: []byte("ct")})
+		}
+	}
+	parentHash, err := tr.PathParentHash(name, keys)
+	if err != nil {
+		t.Fatalf("Failed to compute parent hash: %v", err)
+	}
+	update.LeafNode = testCommitLeafNode(t, tr, name, parentHash)
+	return update
+}
+
+func TestApplyUpdatePath(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	tr, _ := NewTreeWithStore(files, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	before := tr.TreeHash()
+	rejects := map[string]func(*UpdatePath){
+		"missing ciphertext":  func(p *UpdatePath) { p.Nodes[0].EncryptedPathSecret = nil },
+		"short path":          func(p *UpdatePath) { p.Nodes = p.Nodes[1:] },
+		"invalid key":         func(p *UpdatePath) { p.Nodes[0].EncryptionKey = []byte("short") },
+		"wrong parent hash":   func(p *UpdatePath) { p.Nodes[len(p.Nodes)-1].EncryptionKey = testPathKeys(t, 1)[0] },
+		"update leaf node":    func(p *UpdatePath) { p.LeafNode.Source = LeafNodeSourceUpdate },
+		"forged leaf node":    func(p *UpdatePath) { p.LeafNode.Signature[0] ^= 0xff },
+		"missing leaf node":   func(p *UpdatePath) { p.LeafNode = nil },
+		"tampered extensions": func(p *UpdatePath) { p.LeafNode.Extensions = nil },
+	}
+	for name, mutate := range rejects {
+		update := testUpdatePath(t, tr, "charlie")
+		mutate(update)
+		if err := tr.ApplyUpdatePath("charlie", update); err == nil {
+			t.Errorf("%s: update path should be rejected", name)
+		}
+		if !bytes.Equal(tr.TreeHash(), before) {
+			t.Fatalf("%s: rejected update path should leave the tree untouched", name)
+		}
+	}
+	if err := tr.ApplyUpdatePath("charlie", testUpdatePath(t, tr, "bob")); err == nil {
+		t.Errorf("another member's update path should be rejected")
+	}
+
+	update := testUpdatePath(t, tr, "charlie")
+	encoded, err := update.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode update path: %v", err)
+	}
+	var decoded UpdatePath
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("Failed to decode update path: %v", err)
+	}
+	if err := decoded.UnmarshalBinary(append(encoded, 0)); err == nil {
+		t.Errorf("trailing bytes should be rejected")
+	}
+	if err := tr.ApplyUpdatePath("charlie", &decoded); err != nil {
+		t.Fatalf("Failed to apply update path: %v", err)
+	}
+	if err := tr.ValidateParentHashes(); err != nil {
+		t.Errorf("applied update path should validate: %v", err)
+	}
+	path, _ := tr.GetPath("charlie")
+	for i, node := range decoded.Nodes {
+		if !bytes.Equal(path[len(path)-2-i].Value(), node.EncryptionKey) {
+			t.Errorf("parent %d should hold the update path key", i)
+		}
+	}
+
+	loaded, err := LoadTreeFromStore(files, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if err := loaded.ValidateParentHashes(); err != nil {
+		t.Errorf("applied update path should be persisted: %v", err)
+	}
+	charlie, _ := loaded.Find("charlie")
+	if charlie.LeafNode() == nil || charlie.LeafNode().Source != LeafNodeSourceCommit {
+		t.Errorf("committer should hold its commit leaf node after a reload")
+	}
+}
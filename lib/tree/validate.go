@@ -0,0 +1,239 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"slices"
+)
+
+// Invariant names a property checked by Validate
+type Invariant string
+
+const (
+	InvariantBalance        Invariant = "left_balanced"
+	InvariantParentHash     Invariant = "parent_hash"
+	InvariantTreeHash       Invariant = "tree_hash"
+	InvariantLeafSignature  Invariant = "leaf_signature"
+	InvariantUnmergedLeaves Invariant = "unmerged_leaves"
+	InvariantUniqueKeys     Invariant = "unique_keys"
+	InvariantUniqueNames    Invariant = "unique_names"
+)
+
+// Violation is one broken invariant, Node is empty for tree-wide problems
+type Violation struct {
+	Invariant Invariant
+	Node      string
+	Detail    string
+}
+
+// String implements fmt.Stringer
+func (v Violation) String() string {
+	if v.Node == "" {
+		return fmt.Sprintf("%s: %s", v.Invariant, v.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Invariant, v.Node, v.Detail)
+}
+
+// ValidationReport lists every violation Validate found, in tree order per invariant
+type ValidationReport struct {
+	Violations []Violation
+}
+
+// OK reports whether the tree satisfied every invariant
+func (r *ValidationReport) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// Of returns the violations of one invariant
+func (r *ValidationReport) Of(invariant Invariant) []Violation {
+	var found []Violation
+	for _, v := range r.Violations {
+		if v.Invariant == invariant {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// Err returns the report as a *ValidationError, nil when the tree is valid
+func (r *ValidationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	problems := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		problems[i] = v.String()
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// Validate checks the RFC 9420 invariants of the tree and reports every violation
+// instead of stopping at the first:
+//   - the shape is left-balanced, as the array layout of section 4.1 requires
+//   - every keyed parent is covered by a parent hash, see ValidateParentHashes
+//   - the tree hash survives the ratchet_tree encoding joiners receive
+//   - leaf nodes are well formed and carry a valid signature for their leaf index;
+//     signatures are only checked when the tree has a ciphersuite
+//   - unmerged leaves are non-blank descendants listed by every keyed node between
+//     them and the parent that lists them
+//   - no encryption key or signature key is used twice
+//   - no name is used twice, as Find and the store key elements by name
+func (t *Tree) Validate() *ValidationReport {
+	report := &ValidationReport{}
+	addf := func(invariant Invariant, node, format string, args ...any) {
+		report.Violations = append(report.Violations, Violation{Invariant: invariant, Node: node, Detail: fmt.Sprintf(format, args...)})
+	}
+	if t.head == nil {
+		return report
+	}
+
+	t.validateBalance(t.head, addf)
+
+	var parentHashes func(node *Element, first int)
+	parentHashes = func(node *Element, first int) {
+		if node == nil || node.IsLeaf() {
+			return
+		}
+		if len(node.key()) > 0 && !t.parentHashCovered(node, first) {
+			addf(InvariantParentHash, node.name, "no descendant carries its parent hash")
+		}
+		parentHashes(node.leftChild, first)
+		parentHashes(node.rightChild, first+countLeaves(node.leftChild))
+	}
+	parentHashes(t.head, 0)
+
+	if len(report.Of(InvariantBalance)) == 0 {
+		t.validateTreeHash(addf)
+	}
+
+	encryptionKeys := make(map[string]string)
+	signatureKeys := make(map[string]string)
+	names := make(map[string]bool)
+	for _, element := range t.GetAllElements() {
+		if names[element.name] {
+			addf(InvariantUniqueNames, element.name, "name is used by another element")
+		}
+		names[element.name] = true
+		if key := element.key(); len(key) > 0 {
+			if other, dup := encryptionKeys[string(key)]; dup {
+				addf(InvariantUniqueKeys, element.name, "shares its encryption key with %s", other)
+			} else {
+				encryptionKeys[string(key)] = element.name
+			}
+		}
+		leaf := element.LeafNode()
+		if leaf == nil {
+			continue
+		}
+		if other, dup := signatureKeys[string(leaf.SignatureKey)]; dup {
+			addf(InvariantUniqueKeys, element.name, "shares its signature key with %s", other)
+		} else if len(leaf.SignatureKey) > 0 {
+			signatureKeys[string(leaf.SignatureKey)] = element.name
+		}
+		if err := leaf.Validate(t.ciphersuite); err != nil {
+			addf(InvariantLeafSignature, element.name, "malformed leaf node: %v", err)
+		} else if t.ciphersuite != 0 {
+			if err := leaf.VerifySignature(t.ciphersuite, t.groupID, uint32(element.leafIndex)); err != nil {
+				addf(InvariantLeafSignature, element.name, "%v", err)
+			}
+		}
+	}
+
+	t.validateUnmerged(t.head, addf)
+	return report
+}
+
+// validateBalance checks every parent splits its leaves the way the array layout does,
+// the left child holding the largest power of two below the parent's leaf count
+func (t *Tree) validateBalance(node *Element, addf func(Invariant, string, string, ...any)) int {
+	if node.IsLeaf() {
+		return 1
+	}
+	if node.leftChild == nil || node.rightChild == nil {
+		addf(InvariantBalance, node.name, "parent has a single child")
+		n := 0
+		for _, child := range []*Element{node.leftChild, node.rightChild} {
+			if child != nil {
+				n += t.validateBalance(child, addf)
+			}
+		}
+		return n
+	}
+	left := t.validateBalance(node.leftChild, addf)
+	right := t.validateBalance(node.rightChild, addf)
+	n := left + right
+	if want := 1 << (bits.Len(uint(n-1)) - 1); left != want {
+		addf(InvariantBalance, node.name, "left subtree holds %d of %d leaves, want %d", left, n, want)
+	}
+	return n
+}
+
+// validateTreeHash checks the tree hash joiners compute from ExportRatchetTree matches
+func (t *Tree) validateTreeHash(addf func(Invariant, string, string, ...any)) {
+	data, err := t.ExportRatchetTree()
+	if err != nil {
+		addf(InvariantTreeHash, "", "ratchet tree does not encode: %v", err)
+		return
+	}
+	var opts []Option
+	if t.ciphersuite != 0 {
+		opts = append(opts, WithCiphersuite(t.ciphersuite))
+	}
+	imported, err := ImportRatchetTree(data, nil, opts...)
+	if err != nil {
+		addf(InvariantTreeHash, "", "ratchet tree does not decode: %v", err)
+		return
+	}
+	if !bytes.Equal(imported.TreeHash(), t.TreeHash()) {
+		addf(InvariantTreeHash, "", "tree hash %x differs from the ratchet tree's %x", t.TreeHash(), imported.TreeHash())
+	}
+}
+
+// validateUnmerged checks the unmerged leaves of node and its descendants
+func (t *Tree) validateUnmerged(node *Element, addf func(Invariant, string, string, ...any)) {
+	if node == nil || node.IsLeaf() {
+		return
+	}
+	if len(node.key()) == 0 && len(node.unmerged) > 0 {
+		addf(InvariantUnmergedLeaves, node.name, "blank node lists unmerged leaves")
+	}
+	for _, index := range node.unmerged {
+		path := unmergedPath(node, index)
+		if path == nil {
+			addf(InvariantUnmergedLeaves, node.name, "unmerged leaf %d is not below it", index)
+			continue
+		}
+		leaf := path[len(path)-1]
+		if leaf.IsBlank() {
+			addf(InvariantUnmergedLeaves, node.name, "unmerged leaf %d is blank", index)
+		}
+		for _, between := range path[1 : len(path)-1] {
+			if len(between.key()) > 0 && !slices.Contains(between.unmerged, index) {
+				addf(InvariantUnmergedLeaves, between.name, "does not list leaf %d, unmerged at %s", index, node.name)
+			}
+		}
+	}
+	t.validateUnmerged(node.leftChild, addf)
+	t.validateUnmerged(node.rightChild, addf)
+}
+
+// unmergedPath returns the nodes from node down to the leaf with leafIndex, nil when
+// the leaf is not below node
+func unmergedPath(node *Element, leafIndex int) []*Element {
+	if node == nil {
+		return nil
+	}
+	if node.IsLeaf() {
+		if node.leafIndex == leafIndex {
+			return []*Element{node}
+		}
+		return nil
+	}
+	for _, child := range []*Element{node.leftChild, node.rightChild} {
+		if path := unmergedPath(child, leafIndex); path != nil {
+			return append([]*Element{node}, path...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil, WithCiphersuite(MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519), WithGroupID([]byte("group")))
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		if err := tr.InsertLeafNode(name, testLeafNode(t, name)); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	path, _ := tr.GetPath("alice")
+	parentHash, err := tr.SetPathKeys("alice", testPathKeys(t, len(path)-1))
+	if err != nil {
+		t.Fatalf("Failed to set path keys: %v", err)
+	}
+	if err := tr.UpdateLeafNode("alice", testCommitLeafNode(t, tr, "alice", parentHash)); err != nil {
+		t.Fatalf("Failed to update committer leaf: %v", err)
+	}
+	if report := tr.Validate(); !report.OK() {
+		t.Fatalf("path-updated tree should validate: %v", report.Err())
+	}
+
+	// A fifth leaf doubles the capacity under a new root, keeping the tree left-balanced
+	if err := tr.InsertLeafNode("eve", testLeafNode(t, "eve")); err != nil {
+		t.Fatalf("Failed to insert eve: %v", err)
+	}
+	report := tr.Validate()
+	if len(report.Of(InvariantBalance)) != 0 || len(report.Of(InvariantUnmergedLeaves)) != 0 {
+		t.Errorf("inserting a leaf should keep the tree valid: %v", report.Err())
+	}
+	if err := tr.Delete("charlie"); err != nil {
+		t.Fatalf("Failed to delete charlie: %v", err)
+	}
+	if report := tr.Validate(); len(report.Of(InvariantBalance)) != 0 {
+		t.Errorf("deleting charlie blanks the slot, which keeps the tree left-balanced: %v", report.Err())
+	}
+	spliceOut(t, tr, "dave")
+	if report := tr.Validate(); len(report.Of(InvariantBalance)) == 0 {
+		t.Errorf("removing dave from the structure leaves charlie's slot an only child, which is not left-balanced")
+	}
+
+	eve, _ := tr.Find("eve")
+	bob, _ := tr.Find("bob")
+	tr.Head().unmerged = append(tr.Head().unmerged, 99)
+	bob.leafNode.Signature[0] ^= 1
+	eve.leafNode.SignatureKey = bob.leafNode.SignatureKey
+	report = tr.Validate()
+	for invariant, nodes := range map[Invariant][]string{
+		InvariantUnmergedLeaves: {tr.Head().Name()},
+		InvariantLeafSignature:  {"bob"},
+		InvariantUniqueKeys:     {"bob", "eve"}, // either one, whichever is seen second
+	} {
+		found := false
+		for _, v := range report.Of(invariant) {
+			found = found || slices.Contains(nodes, v.Node)
+		}
+		if !found {
+			t.Errorf("expected a %s violation at %v, got %v", invariant, nodes, report.Violations)
+		}
+	}
+	if err := report.Err(); err == nil {
+		t.Errorf("a report with violations should convert to an error")
+	}
+	empty, _ := NewTreeWithStore(nil)
+	if report := empty.Validate(); !report.OK() {
+		t.Errorf("empty tree should validate")
+	}
+}
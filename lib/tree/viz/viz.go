@@ -0,0 +1,63 @@
+// Package viz renders TreeKEM trees for debugging
+package viz
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// WriteDOT renders the tree as a Graphviz digraph
+// Leaves are boxes, intermediate nodes ellipses, and nodes without a public key are
+// drawn dashed so blank keys stand out after insert and delete churn
+func WriteDOT(w io.Writer, t *tree.Tree) error {
+	var b strings.Builder
+	b.WriteString("digraph tree {\n")
+	b.WriteString("\tnode [fontname=\"monospace\"];\n")
+
+	var walk func(*tree.Element)
+	walk = func(node *tree.Element) {
+		shape := "ellipse"
+		if node.IsLeaf() {
+			shape = "box"
+		}
+		style := "solid"
+		if len(node.Value()) == 0 {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=%s, style=%s];\n",
+			quote(node.Name()), quote(fmt.Sprintf("%d: %s", node.NodeIndex(), node.Name())), shape, style)
+
+		for _, edge := range []struct {
+			child *tree.Element
+			label string
+		}{{node.LeftChild(), "L"}, {node.RightChild(), "R"}} {
+			if edge.child == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", quote(node.Name()), quote(edge.child.Name()), edge.label)
+			walk(edge.child)
+		}
+	}
+	if head := t.Head(); head != nil {
+		walk(head)
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DOT returns the Graphviz rendering of the tree
+func DOT(t *tree.Tree) string {
+	var b strings.Builder
+	WriteDOT(&b, t)
+	return b.String()
+}
+
+// quote returns s as a DOT string literal
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,39 @@
+package viz
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestDOT(t *testing.T) {
+	tr, _ := tree.NewTreeWithStore(nil)
+	for _, user := range []string{"alice", "bob", `eve "the" spy`} {
+		tr.Insert(user, []byte(user+"_key"))
+	}
+
+	dot := DOT(tr)
+	t.Log(dot)
+	if !strings.HasPrefix(dot, "digraph tree {") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("not a DOT digraph:\n%s", dot)
+	}
+	if got := strings.Count(dot, "->"); got != 4 {
+		t.Errorf("expected 4 edges, got %d", got)
+	}
+	if got := strings.Count(dot, "shape=box"); got != 3 {
+		t.Errorf("expected 3 leaves, got %d", got)
+	}
+	if !strings.Contains(dot, `"eve \"the\" spy"`) {
+		t.Errorf("names should be escaped:\n%s", dot)
+	}
+	// Intermediate nodes have no key until UpdateIntermediateKeys runs
+	if got := strings.Count(dot, "style=dashed"); got != 2 {
+		t.Errorf("expected 2 blank nodes, got %d", got)
+	}
+
+	empty, _ := tree.NewTreeWithStore(nil)
+	if DOT(empty) != "digraph tree {\n\tnode [fontname=\"monospace\"];\n}\n" {
+		t.Errorf("unexpected rendering of an empty tree")
+	}
+}
@@ -0,0 +1,116 @@
+package tree
+
+import "iter"
+
+// WalkOrder is the order Walk visits nodes in
+type WalkOrder int
+
+const (
+	LevelOrder WalkOrder = iota // breadth-first from the root
+	PreOrder                    // a parent before its left then right subtree
+	InOrder                     // the left subtree, the parent, then the right subtree; the node index order
+	PostOrder                   // both subtrees before their parent
+)
+
+// Walk calls visit on every node in order until visit returns false
+// Nothing is collected up front, so stopping early costs only the nodes visited
+func (t *Tree) Walk(order WalkOrder, visit func(*Element) bool) {
+	switch order {
+	case LevelOrder:
+		walkLevelOrder(t.head, visit)
+	case PreOrder:
+		walkPreOrder(t.head, visit)
+	case InOrder:
+		walkInOrder(t.head, visit)
+	case PostOrder:
+		walkPostOrder(t.head, visit)
+	}
+}
+
+// All returns an iterator over the nodes in order, see Walk
+func (t *Tree) All(order WalkOrder) iter.Seq[*Element] {
+	return func(yield func(*Element) bool) {
+		t.Walk(order, yield)
+	}
+}
+
+// walkLevelOrder visits node's subtree level by level, each from left to right
+func walkLevelOrder(node *Element, visit func(*Element) bool) {
+	if node == nil {
+		return
+	}
+	queue := []*Element{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if !visit(current) {
+			return
+		}
+		for _, child := range []*Element{current.leftChild, current.rightChild} {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+}
+
+// walkPreOrder visits node's subtree parent first, with an explicit stack so deep trees
+// cannot exhaust the goroutine stack
+func walkPreOrder(node *Element, visit func(*Element) bool) {
+	if node == nil {
+		return
+	}
+	stack := []*Element{node}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visit(current) {
+			return
+		}
+		if current.rightChild != nil {
+			stack = append(stack, current.rightChild)
+		}
+		if current.leftChild != nil {
+			stack = append(stack, current.leftChild)
+		}
+	}
+}
+
+// walkInOrder visits node's subtree left to right
+func walkInOrder(node *Element, visit func(*Element) bool) {
+	var stack []*Element
+	for current := node; current != nil || len(stack) > 0; {
+		for ; current != nil; current = current.leftChild {
+			stack = append(stack, current)
+		}
+		current = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visit(current) {
+			return
+		}
+		current = current.rightChild
+	}
+}
+
+// walkPostOrder visits node's subtree children first
+func walkPostOrder(node *Element, visit func(*Element) bool) {
+	var stack []*Element
+	var last *Element
+	for current := node; current != nil || len(stack) > 0; {
+		if current != nil {
+			stack = append(stack, current)
+			current = current.leftChild
+			continue
+		}
+		top := stack[len(stack)-1]
+		if top.rightChild != nil && last != top.rightChild {
+			current = top.rightChild
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if !visit(top) {
+			return
+		}
+		last = top
+	}
+}
@@ -0,0 +1,100 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	tr, _ := NewTreeWithStore(nil)
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		if err := tr.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+	collect := func(order WalkOrder) []*Element {
+		var nodes []*Element
+		for node := range tr.All(order) {
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	level := collect(LevelOrder)
+	depth := func(node *Element) int {
+		d := 0
+		for ; node.Parent() != nil; node = node.Parent() {
+			d++
+		}
+		return d
+	}
+	if level[0] != tr.Head() {
+		t.Errorf("level order should start at the root")
+	}
+	for i := 1; i < len(level); i++ {
+		if depth(level[i]) < depth(level[i-1]) {
+			t.Errorf("level order should visit %s before the deeper %s", level[i].Name(), level[i-1].Name())
+		}
+	}
+	if pre := collect(PreOrder); !slices.Equal(pre, tr.GetAllElements()) {
+		t.Errorf("pre order should match GetAllElements")
+	}
+
+	in := collect(InOrder)
+	for i, node := range in {
+		if node.NodeIndex() != i {
+			t.Errorf("in order should follow node indices, got %d at %d", node.NodeIndex(), i)
+		}
+	}
+	var leaves []*Element
+	for _, node := range in {
+		if node.IsLeaf() {
+			leaves = append(leaves, node)
+		}
+	}
+	if !slices.Equal(leaves, tr.GetLeaves()) {
+		t.Errorf("in order should visit leaves in leaf order")
+	}
+	for i, node := range in {
+		if left := slices.Index(in, node.LeftChild()); node.LeftChild() != nil && left > i {
+			t.Errorf("%s visited before its left child", node.Name())
+		}
+		if right := slices.Index(in, node.RightChild()); node.RightChild() != nil && right < i {
+			t.Errorf("%s visited after its right child", node.Name())
+		}
+	}
+
+	post := collect(PostOrder)
+	if post[len(post)-1] != tr.Head() {
+		t.Errorf("post order should visit the root last")
+	}
+	seen := make(map[*Element]bool)
+	for _, node := range post {
+		for _, child := range []*Element{node.LeftChild(), node.RightChild()} {
+			if child != nil && !seen[child] {
+				t.Errorf("%s visited before its child %s", node.Name(), child.Name())
+			}
+		}
+		seen[node] = true
+	}
+
+	for _, order := range []WalkOrder{LevelOrder, PreOrder, InOrder, PostOrder} {
+		if n := len(collect(order)); n != len(level) {
+			t.Errorf("order %d visited %d of %d nodes", order, n, len(level))
+		}
+		visited := 0
+		tr.Walk(order, func(*Element) bool {
+			visited++
+			return visited < 3
+		})
+		if visited != 3 {
+			t.Errorf("order %d should stop when visit returns false, visited %d", order, visited)
+		}
+	}
+
+	empty, _ := NewTreeWithStore(nil)
+	empty.Walk(InOrder, func(*Element) bool {
+		t.Errorf("empty tree has nothing to visit")
+		return true
+	})
+}
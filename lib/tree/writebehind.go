@@ -0,0 +1,275 @@
+package tree
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// pendingOp is a queued write or removal, or a step such as opening a batch that must
+// run in order with them
+type pendingOp struct {
+	seq    uint64
+	key    string
+	data   []byte
+	remove bool
+	step   func() error
+}
+
+// writeBehindStore acknowledges writes immediately and persists them from a background goroutine
+// At most maxUnflushed operations may be outstanding; further writes block until the worker catches up
+type writeBehindStore struct {
+	inner        Store
+	maxUnflushed int
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []pendingOp
+	overlay    map[string]pendingOp // newest unflushed op per key, serves reads
+	inFlight   int
+	seq        uint64
+	flushedSeq uint64
+	err        error
+	onError    func(error) // notified of every failed write, see WithWriteBehindErrorHandler
+	closed     bool
+	done       chan struct{}
+
+	wrapsJournal bool // the atomic-writes journal sits below, see beginBatch
+}
+
+// WithWriteBehind persists elements asynchronously with at most maxUnflushed operations at risk
+// Apply it last so it wraps every other store option; use Barrier to wait for durability
+func WithWriteBehind(maxUnflushed int) Option {
+	return func(t *Tree) {
+		if t.store == nil {
+			return
+		}
+		store := newWriteBehindStore(t.store, maxUnflushed)
+		store.onError = t.onWriteError
+		store.wrapsJournal = t.journal != nil
+		t.store = store
+		t.writeBehind = store
+	}
+}
+
+// WithWriteBehindErrorHandler calls handler from the background worker for every write
+// or removal that fails to reach the backing store, as it happens rather than at the next
+// Barrier. The first failure is still returned by Barrier, Close and later mutations.
+// It covers WithWriteBehind and WithDebouncedWrites; handler must not call back into the tree
+func WithWriteBehindErrorHandler(handler func(error)) Option {
+	return func(t *Tree) {
+		t.onWriteError = handler
+		if t.writeBehind != nil {
+			t.writeBehind.mu.Lock()
+			t.writeBehind.onError = handler
+			t.writeBehind.mu.Unlock()
+		}
+		if t.debounce != nil {
+			t.debounce.mu.Lock()
+			t.debounce.onError = handler
+			t.debounce.mu.Unlock()
+		}
+	}
+}
+
+// newWriteBehindStore starts the background worker
+func newWriteBehindStore(inner Store, maxUnflushed int) *writeBehindStore {
+	if maxUnflushed <= 0 {
+		maxUnflushed = 1
+	}
+	s := &writeBehindStore{
+		inner:        inner,
+		maxUnflushed: maxUnflushed,
+		overlay:      make(map[string]pendingOp),
+		done:         make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// Key delegates to the wrapped store
+func (s *writeBehindStore) Key(name string) string {
+	return s.inner.Key(name)
+}
+
+// Write queues a write
+func (s *writeBehindStore) Write(key string, data []byte) error {
+	return s.enqueue(pendingOp{key: key, data: append([]byte(nil), data...)})
+}
+
+// Remove queues a removal
+func (s *writeBehindStore) Remove(key string) error {
+	return s.enqueue(pendingOp{key: key, remove: true})
+}
+
+// Read serves unflushed operations before falling back to the wrapped store
+func (s *writeBehindStore) Read(key string) ([]byte, error) {
+	s.mu.Lock()
+	op, ok := s.overlay[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return s.inner.Read(key)
+	}
+	if op.remove {
+		return nil, fmt.Errorf("element %s: %w", key, fs.ErrNotExist)
+	}
+	return append([]byte(nil), op.data...), nil
+}
+
+// step queues fn to run on the worker after every operation queued so far
+func (s *writeBehindStore) step(fn func() error) error {
+	return s.enqueue(pendingOp{step: fn})
+}
+
+// enqueue blocks while the loss window is full
+func (s *writeBehindStore) enqueue(op pendingOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue)+s.inFlight >= s.maxUnflushed && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return fmt.Errorf("write-behind store is closed")
+	}
+
+	s.seq++
+	op.seq = s.seq
+	s.queue = append(s.queue, op)
+	if op.step == nil {
+		s.overlay[op.key] = op
+	}
+	s.cond.Broadcast()
+	return s.err
+}
+
+// run drains the queue in batches
+func (s *writeBehindStore) run() {
+	defer close(s.done)
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 && s.closed {
+			s.mu.Unlock()
+			return
+		}
+		batch := s.queue
+		s.queue = nil
+		s.inFlight = len(batch)
+		s.mu.Unlock()
+
+		var failures []error
+		for _, op := range batch {
+			var err error
+			switch {
+			case op.step != nil:
+				if err = op.step(); err != nil {
+					failures = append(failures, fmt.Errorf("write-behind batch failed: %w", err))
+				}
+				continue
+			case op.remove:
+				err = s.inner.Remove(op.key)
+			default:
+				err = s.inner.Write(op.key, op.data)
+			}
+			if err != nil {
+				failures = append(failures, fmt.Errorf("write-behind of %s failed: %w", op.key, err))
+			}
+		}
+
+		s.mu.Lock()
+		onError := s.onError
+		s.mu.Unlock()
+		if onError != nil {
+			for _, err := range failures {
+				onError(err)
+			}
+		}
+		var batchErr error
+		if len(failures) > 0 {
+			batchErr = failures[0]
+		}
+
+		s.mu.Lock()
+		for _, op := range batch {
+			if op.step != nil {
+				continue
+			}
+			if current, ok := s.overlay[op.key]; ok && current.seq == op.seq {
+				delete(s.overlay, op.key)
+			}
+		}
+		if batchErr != nil && s.err == nil {
+			s.err = batchErr
+		}
+		s.inFlight = 0
+		s.flushedSeq = batch[len(batch)-1].seq
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// barrier blocks until every operation queued before the call is persisted
+func (s *writeBehindStore) barrier() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target := s.seq
+	for s.flushedSeq < target {
+		s.cond.Wait()
+	}
+	return s.err
+}
+
+// close flushes outstanding operations and stops the worker
+func (s *writeBehindStore) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return s.err
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+	return s.err
+}
+
+// Barrier blocks until every change made so far is durable in the backing store
+// Debounced writes are written without waiting out their quiet interval. It returns the
+// first background write error, if any; with synchronous writes it returns immediately
+func (t *Tree) Barrier() error {
+	if t.debounce != nil {
+		if err := t.debounce.flush(); err != nil {
+			return err
+		}
+	}
+	if t.writeBehind == nil {
+		return nil
+	}
+	return t.writeBehind.barrier()
+}
+
+// Close flushes pending writes and stops background persistence
+// Deferred and debounced writes are written first, see WithDeferredWrites and
+// WithDebouncedWrites
+func (t *Tree) Close() error {
+	if _, err := t.Flush(); err != nil {
+		return err
+	}
+	if t.debounce != nil {
+		if err := t.debounce.close(); err != nil {
+			return err
+		}
+	}
+	if t.writeBehind == nil {
+		return nil
+	}
+	return t.writeBehind.close()
+}
@@ -0,0 +1,177 @@
+package tree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// slowStore counts writes and can hold them back to simulate a slow disk
+type slowStore struct {
+	Store
+	mu     sync.Mutex
+	writes int
+	gate   chan struct{}
+}
+
+func (s *slowStore) Write(key string, data []byte) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mu.Lock()
+	s.writes++
+	s.mu.Unlock()
+	return s.Store.Write(key, data)
+}
+
+func TestWriteBehindBarrier(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "write_behind_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files, _ := NewFileStore(tempDir)
+	inner := &slowStore{Store: files}
+	tree, _ := NewTreeWithStore(inner, WithWriteBehind(16))
+
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	if err := tree.Barrier(); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+
+	loaded, err := LoadTree(tempDir, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree after barrier: %v", err)
+	}
+	if got := len(loaded.GetLeaves()); got != 100 {
+		t.Errorf("expected 100 durable leaves after barrier, got %d", got)
+	}
+	if err := tree.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestWriteBehindBoundsLossWindow(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	inner := &slowStore{Store: files, gate: make(chan struct{})}
+	store := newWriteBehindStore(inner, 4)
+
+	if err := store.Write(files.Key("k0"), []byte("v")); err != nil {
+		t.Fatalf("Failed to queue write: %v", err)
+	}
+
+	// The worker holds writes at the gate; at most 4 operations may be outstanding
+	blocked := make(chan struct{})
+	go func() {
+		for i := 1; i < 6; i++ {
+			store.Write(files.Key(fmt.Sprintf("k%d", i)), []byte("v"))
+		}
+		close(blocked)
+	}()
+
+	select {
+	case <-blocked:
+		t.Fatalf("writer should block once the loss window is full")
+	default:
+	}
+
+	// Reads observe queued writes before they reach the backing store
+	if data, err := store.Read(files.Key("k0")); err != nil || string(data) != "v" {
+		t.Errorf("expected queued write to be readable, got %q, %v", data, err)
+	}
+
+	close(inner.gate)
+	<-blocked
+	if err := store.barrier(); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	if inner.writes != 6 {
+		t.Errorf("expected 6 writes to reach the backing store, got %d", inner.writes)
+	}
+	store.close()
+}
+
+// failingStore rejects writes to keys in fail
+type failingStore struct {
+	Store
+	fail map[string]bool
+}
+
+func (s *failingStore) Write(key string, data []byte) error {
+	if s.fail[key] {
+		return fmt.Errorf("disk full")
+	}
+	return s.Store.Write(key, data)
+}
+
+func TestWriteBehindErrorHandler(t *testing.T) {
+	files, _ := NewFileStore(t.TempDir())
+	inner := &failingStore{Store: files, fail: map[string]bool{files.Key("bob"): true}}
+
+	var mu sync.Mutex
+	var reported []error
+	handler := func(err error) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	}
+	tree, _ := NewTreeWithStore(inner, WithWriteBehindErrorHandler(handler), WithWriteBehind(8))
+	for _, name := range []string{"alice", "bob"} {
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+	}
+
+	if err := tree.Barrier(); err == nil {
+		t.Errorf("Barrier should report the failed write")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "bob") {
+		t.Errorf("handler got %v, want the failed write of bob", reported)
+	}
+}
+
+func TestWriteBehindQueuesJournalBatches(t *testing.T) {
+	dir := t.TempDir()
+	tree, err := NewTree(dir, WithAtomicWrites(), WithWriteBehind(4))
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("user_%d", i)
+		if err := tree.Insert(name, []byte(name+"_key")); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		if i%5 == 4 {
+			if err := tree.Delete(fmt.Sprintf("user_%d", i-2)); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, journalName+".json")); !os.IsNotExist(err) {
+		t.Errorf("journal left behind after close: %v", err)
+	}
+	loaded, err := LoadTree(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load tree: %v", err)
+	}
+	if !loaded.Equal(tree) {
+		t.Errorf("loaded tree differs from the written one")
+	}
+}
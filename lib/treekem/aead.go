@@ -0,0 +1,39 @@
+package treekem
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// RFC 9180 identifiers of the AEADs used by the supported ciphersuites
+const (
+	hpkeAEADAES128GCM        = 0x0001
+	hpkeAEADChaCha20Poly1305 = 0x0003
+)
+
+// AEADKeySize is Nk, the key size of the suite's AEAD
+func (s *Suite) AEADKeySize() int {
+	if s.aeadID == hpkeAEADChaCha20Poly1305 {
+		return chacha20poly1305.KeySize
+	}
+	return 16
+}
+
+// AEADNonceSize is Nn, the nonce size of the suite's AEAD
+func (s *Suite) AEADNonceSize() int {
+	return 12
+}
+
+// NewAEAD returns the suite's AEAD keyed with key
+func (s *Suite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	if s.aeadID == hpkeAEADChaCha20Poly1305 {
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
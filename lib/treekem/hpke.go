@@ -0,0 +1,130 @@
+package treekem
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// RFC 9180 identifiers of the KDF shared by the supported ciphersuites
+const (
+	hpkeKDFHKDFSHA256  = 0x0001
+	hpkeModeBase       = 0x00
+	hpkeSharedSecretNh = 32
+)
+
+// EncryptWithLabel implements EncryptWithLabel from RFC 9420 section 5.1.3
+// It seals plaintext to publicKey with HPKE base mode
+func (s *Suite) EncryptWithLabel(publicKey []byte, label string, context, plaintext []byte) (tree.HPKECiphertext, error) {
+	ephemeral, err := s.curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return tree.HPKECiphertext{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	info, err := encryptContext(label, context)
+	if err != nil {
+		return tree.HPKECiphertext{}, err
+	}
+	return s.sealBase(ephemeral, publicKey, info, nil, plaintext)
+}
+
+// DecryptWithLabel implements DecryptWithLabel from RFC 9420 section 5.1.3
+func (s *Suite) DecryptWithLabel(privateKey *ecdh.PrivateKey, label string, context []byte, ct tree.HPKECiphertext) ([]byte, error) {
+	info, err := encryptContext(label, context)
+	if err != nil {
+		return nil, err
+	}
+	return s.openBase(privateKey, ct, info, nil)
+}
+
+// encryptContext builds the EncryptContext used as HPKE info
+func encryptContext(label string, context []byte) ([]byte, error) {
+	w := &tls.Writer{}
+	if err := w.Opaque([]byte("MLS 1.0 " + label)); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(context); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// sealBase implements SealBase of RFC 9180 section 6.1 with a given ephemeral key
+func (s *Suite) sealBase(ephemeral *ecdh.PrivateKey, publicKey, info, aad, plaintext []byte) (tree.HPKECiphertext, error) {
+	recipient, err := s.curve.NewPublicKey(publicKey)
+	if err != nil {
+		return tree.HPKECiphertext{}, fmt.Errorf("invalid recipient key: %w", err)
+	}
+	dh, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return tree.HPKECiphertext{}, err
+	}
+	enc := ephemeral.PublicKey().Bytes()
+	aead, nonce, err := s.keySchedule(s.extractAndExpand(dh, enc, publicKey), info)
+	if err != nil {
+		return tree.HPKECiphertext{}, err
+	}
+	return tree.HPKECiphertext{KEMOutput: enc, Ciphertext: aead.Seal(nil, nonce, plaintext, aad)}, nil
+}
+
+// openBase implements OpenBase of RFC 9180 section 6.1
+func (s *Suite) openBase(privateKey *ecdh.PrivateKey, ct tree.HPKECiphertext, info, aad []byte) ([]byte, error) {
+	ephemeral, err := s.curve.NewPublicKey(ct.KEMOutput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KEM output: %w", err)
+	}
+	dh, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, nonce, err := s.keySchedule(s.extractAndExpand(dh, ct.KEMOutput, privateKey.PublicKey().Bytes()), info)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ct.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// extractAndExpand derives the DHKEM shared secret of RFC 9180 section 4.1
+func (s *Suite) extractAndExpand(dh, enc, recipient []byte) []byte {
+	suiteID := binary.BigEndian.AppendUint16([]byte("KEM"), s.kemID)
+	kemContext := append(append([]byte(nil), enc...), recipient...)
+	prk := s.Extract(nil, labeled(suiteID, "eae_prk", dh))
+	shared, _ := s.Expand(prk, labeledInfo(suiteID, "shared_secret", kemContext, hpkeSharedSecretNh), hpkeSharedSecretNh)
+	return shared
+}
+
+// keySchedule derives the base mode AEAD and nonce of RFC 9180 section 5.1
+// Only the first message of a context is ever sealed, so the base nonce is used as is
+func (s *Suite) keySchedule(shared, info []byte) (cipher.AEAD, []byte, error) {
+	suiteID := []byte("HPKE")
+	suiteID = binary.BigEndian.AppendUint16(suiteID, s.kemID)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, hpkeKDFHKDFSHA256)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, s.aeadID)
+
+	context := []byte{hpkeModeBase}
+	context = append(context, s.Extract(nil, labeled(suiteID, "psk_id_hash", nil))...)
+	context = append(context, s.Extract(nil, labeled(suiteID, "info_hash", info))...)
+	secret := s.Extract(shared, labeled(suiteID, "secret", nil))
+
+	key, err := s.Expand(secret, labeledInfo(suiteID, "key", context, s.AEADKeySize()), s.AEADKeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := s.Expand(secret, labeledInfo(suiteID, "base_nonce", context, s.AEADNonceSize()), s.AEADNonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := s.NewAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nonce, nil
+}
@@ -0,0 +1,82 @@
+package treekem
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Base mode vector from RFC 9180 appendix A.1.1, first sequence number
+func TestSealBaseVector(t *testing.T) {
+	suite, _ := NewSuite(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)
+	unhex := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+	ephemeral, _ := suite.DeriveKeyPair(unhex("7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234"))
+	recipient, _ := suite.DeriveKeyPair(unhex("6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037"))
+	info := unhex("4f6465206f6e2061204772656369616e2055726e")
+	aad := unhex("436f756e742d30")
+	plaintext := unhex("4265617574792069732074727574682c20747275746820626561757479")
+
+	ct, err := suite.sealBase(ephemeral, recipient.PublicKey().Bytes(), info, aad, plaintext)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if got := hex.EncodeToString(ct.Ciphertext); got != "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a" {
+		t.Errorf("unexpected ciphertext %s", got)
+	}
+	opened, err := suite.openBase(recipient, ct, info, aad)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Failed to open the vector ciphertext: %v", err)
+	}
+}
+
+// Base mode vector from RFC 9180 appendix A.2.1, first sequence number
+func TestSealBaseChaCha20Poly1305Vector(t *testing.T) {
+	suite, _ := NewSuite(tree.MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519)
+	unhex := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+	ephemeral, _ := suite.DeriveKeyPair(unhex("909a9b35d3dc4713a5e72a4da274b55d3d3821a37e5d099e74a647db583a904b"))
+	recipient, _ := suite.DeriveKeyPair(unhex("1ac01f181fdf9f352797655161c58b75c656a6cc2716dcb66372da835542e1df"))
+	info := unhex("4f6465206f6e2061204772656369616e2055726e")
+	aad := unhex("436f756e742d30")
+	plaintext := unhex("4265617574792069732074727574682c20747275746820626561757479")
+
+	ct, err := suite.sealBase(ephemeral, recipient.PublicKey().Bytes(), info, aad, plaintext)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if got := hex.EncodeToString(ct.Ciphertext); got != "1c5250d8034ec2b784ba2cfd69dbdb8af406cfe3ff938e131f0def8c8b60b4db21993c62ce81883d2dd1b51a28" {
+		t.Errorf("unexpected ciphertext %s", got)
+	}
+	opened, err := suite.openBase(recipient, ct, info, aad)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Failed to open the vector ciphertext: %v", err)
+	}
+}
+
+func TestEncryptWithLabel(t *testing.T) {
+	for _, cs := range []tree.Ciphersuite{tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256, tree.MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519} {
+		suite, _ := NewSuite(cs)
+		recipient, _ := suite.NodeKeyPair([]byte("recipient"))
+		ct, err := suite.EncryptWithLabel(recipient.PublicKey().Bytes(), "UpdatePathNode", []byte("context"), []byte("path secret"))
+		if err != nil {
+			t.Fatalf("0x%04x: failed to encrypt: %v", uint16(cs), err)
+		}
+		plaintext, err := suite.DecryptWithLabel(recipient, "UpdatePathNode", []byte("context"), ct)
+		if err != nil || string(plaintext) != "path secret" {
+			t.Errorf("0x%04x: failed to decrypt: %v", uint16(cs), err)
+		}
+		if _, err := suite.DecryptWithLabel(recipient, "UpdatePathNode", []byte("other"), ct); err == nil {
+			t.Errorf("0x%04x: another context should not decrypt", uint16(cs))
+		}
+		if _, err := suite.EncryptWithLabel([]byte("not a key"), "UpdatePathNode", nil, nil); err == nil {
+			t.Errorf("0x%04x: invalid recipient key should be rejected", uint16(cs))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package treekem
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// pathSecretsVersion starts every encoding of PathSecrets
+const pathSecretsVersion = 1
+
+// PathSecrets is the client half of TreeKEM bookkeeping: the path secrets a member
+// knows, by node index, from which the private keys of those nodes follow. A member
+// records the secrets of its own UpdatePath and those it decrypts from others' with
+// SetPath, derives node keys with KeyPair, and drops secrets of nodes rekeyed by
+// someone else with Prune. A PathSecrets is not safe for concurrent use
+type PathSecrets struct {
+	suite   *Suite
+	secrets map[int][]byte
+}
+
+// NewPathSecrets returns an empty cache for path secrets of ciphersuite cs
+func NewPathSecrets(cs tree.Ciphersuite) (*PathSecrets, error) {
+	suite, err := NewSuite(cs)
+	if err != nil {
+		return nil, err
+	}
+	return &PathSecrets{suite: suite, secrets: make(map[int][]byte)}, nil
+}
+
+// Set records the path secret of the node at nodeIndex
+func (p *PathSecrets) Set(nodeIndex int, pathSecret []byte) error {
+	if len(pathSecret) != p.suite.HashSize() {
+		return fmt.Errorf("path secret of node %d has %d bytes, want %d", nodeIndex, len(pathSecret), p.suite.HashSize())
+	}
+	p.secrets[nodeIndex] = bytes.Clone(pathSecret)
+	return nil
+}
+
+// SetPath records pathSecret for the first node of path and ratchets it up the rest,
+// each node taking the next secret of the chain, as a committer does for its filtered
+// direct path and a receiver for the part of it above the node it decrypted. path holds
+// node indices nearest the leaf first, as Tree.FilteredDirectPath returns them. The
+// secret one step past the last node is returned; past the root it is the commit secret
+func (p *PathSecrets) SetPath(path []int, pathSecret []byte) (next []byte, err error) {
+	next = pathSecret
+	for i, nodeIndex := range path {
+		if i > 0 {
+			if next, err = p.suite.NextPathSecret(next); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.Set(nodeIndex, next); err != nil {
+			return nil, err
+		}
+	}
+	return p.suite.NextPathSecret(next)
+}
+
+// Get returns the path secret of the node at nodeIndex
+func (p *PathSecrets) Get(nodeIndex int) ([]byte, bool) {
+	secret, ok := p.secrets[nodeIndex]
+	return bytes.Clone(secret), ok
+}
+
+// KeyPair derives the HPKE key pair of the node at nodeIndex from its path secret
+func (p *PathSecrets) KeyPair(nodeIndex int) (*ecdh.PrivateKey, error) {
+	secret, ok := p.secrets[nodeIndex]
+	if !ok {
+		return nil, fmt.Errorf("no path secret for node %d", nodeIndex)
+	}
+	return p.suite.NodeKeyPair(secret)
+}
+
+// Forget drops the path secret of the node at nodeIndex
+func (p *PathSecrets) Forget(nodeIndex int) {
+	delete(p.secrets, nodeIndex)
+}
+
+// Indices returns the node indices holding a path secret in ascending order
+func (p *PathSecrets) Indices() []int {
+	indices := make([]int, 0, len(p.secrets))
+	for index := range p.secrets {
+		indices = append(indices, index)
+	}
+	slices.Sort(indices)
+	return indices
+}
+
+// Len returns how many path secrets are held
+func (p *PathSecrets) Len() int {
+	return len(p.secrets)
+}
+
+// Prune forgets every secret whose node no longer carries the public key derived from
+// it: nodes that were blanked, rekeyed by another member's commit or removed from t.
+// It returns the forgotten node indices in ascending order
+func (p *PathSecrets) Prune(t *tree.Tree) ([]int, error) {
+	var forgotten []int
+	for _, index := range p.Indices() {
+		key, err := p.KeyPair(index)
+		if err != nil {
+			return forgotten, err
+		}
+		node := t.GetNodeByIndex(index)
+		if node == nil || !bytes.Equal(node.Value(), key.PublicKey().Bytes()) {
+			p.Forget(index)
+			forgotten = append(forgotten, index)
+		}
+	}
+	return forgotten, nil
+}
+
+// MarshalBinary encodes the ciphersuite and every path secret by node index
+// The encoding holds private key material and must be stored as such
+func (p *PathSecrets) MarshalBinary() ([]byte, error) {
+	w := &tls.Writer{}
+	w.Uint8(pathSecretsVersion)
+	w.Uint16(uint16(p.suite.Ciphersuite()))
+	w.Uint32(uint32(len(p.secrets)))
+	for _, index := range p.Indices() {
+		w.Uint32(uint32(index))
+		if err := w.Opaque(p.secrets[index]); err != nil {
+			return nil, err
+		}
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalBinary replaces p with path secrets encoded by MarshalBinary
+func (p *PathSecrets) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 || data[0] != pathSecretsVersion {
+		return errors.New("unsupported path secrets encoding")
+	}
+	r := &tls.Reader{Buf: data[1:]}
+	suite, _ := r.Uint16()
+	count, _ := r.Uint32()
+	decoded, err := NewPathSecrets(tree.Ciphersuite(suite))
+	if err != nil {
+		return err
+	}
+	for range count {
+		index, err := r.Uint32()
+		if err != nil {
+			return fmt.Errorf("truncated path secrets: %w", err)
+		}
+		secret, err := r.Opaque()
+		if err != nil {
+			return fmt.Errorf("truncated path secrets: %w", err)
+		}
+		if err := decoded.Set(int(index), secret); err != nil {
+			return err
+		}
+	}
+	if len(r.Buf) > 0 {
+		return fmt.Errorf("%d trailing bytes after path secrets", len(r.Buf))
+	}
+	*p = *decoded
+	return nil
+}
@@ -0,0 +1,96 @@
+package treekem
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestPathSecrets(t *testing.T) {
+	suite, _ := NewSuite(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(suite.Ciphersuite()))
+	for i := 0; i < 4; i++ {
+		leaf, _ := suite.NodeKeyPair([]byte(fmt.Sprintf("leaf secret %d", i)))
+		if err := group.Insert(fmt.Sprintf("user_%d", i), leaf.PublicKey().Bytes()); err != nil {
+			t.Fatalf("Failed to insert user_%d: %v", i, err)
+		}
+	}
+	user0, _ := group.Find("user_0")
+	pathSecret := bytes.Repeat([]byte{0x42}, suite.HashSize())
+	if _, err := ApplyPathSecret(group, "user_0", pathSecret); err != nil {
+		t.Fatalf("Failed to apply path secret: %v", err)
+	}
+
+	secrets, err := NewPathSecrets(suite.Ciphersuite())
+	if err != nil {
+		t.Fatalf("Failed to create path secrets: %v", err)
+	}
+	path := group.DirectPath(user0.LeafIndex())
+	commitSecret, err := secrets.SetPath(path, pathSecret)
+	if err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+	rootSecret, _ := suite.NextPathSecret(pathSecret)
+	if want, _ := suite.NextPathSecret(rootSecret); !bytes.Equal(commitSecret, want) {
+		t.Errorf("SetPath should return the secret past the root")
+	}
+	if got, _ := secrets.Get(path[1]); !bytes.Equal(got, rootSecret) {
+		t.Errorf("the root should hold the ratcheted secret")
+	}
+	if !slices.Equal(secrets.Indices(), slices.Sorted(slices.Values(path))) || secrets.Len() != 2 {
+		t.Errorf("indices = %v, want %v", secrets.Indices(), path)
+	}
+	for _, index := range path {
+		key, err := secrets.KeyPair(index)
+		if err != nil {
+			t.Fatalf("Failed to derive key of node %d: %v", index, err)
+		}
+		if !bytes.Equal(key.PublicKey().Bytes(), group.GetNodeByIndex(index).Value()) {
+			t.Errorf("node %d does not hold the key derived from its cached secret", index)
+		}
+	}
+	if forgotten, err := secrets.Prune(group); err != nil || len(forgotten) != 0 {
+		t.Errorf("nothing should be pruned while the path is current, got %v, %v", forgotten, err)
+	}
+
+	encoded, err := secrets.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal path secrets: %v", err)
+	}
+	var decoded PathSecrets
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("Failed to unmarshal path secrets: %v", err)
+	}
+	for _, index := range path {
+		want, _ := secrets.Get(index)
+		if got, ok := decoded.Get(index); !ok || !bytes.Equal(got, want) {
+			t.Errorf("decoded secret of node %d differs", index)
+		}
+	}
+	for _, bad := range [][]byte{nil, encoded[:len(encoded)-1], append(slices.Clone(encoded), 0)} {
+		if err := new(PathSecrets).UnmarshalBinary(bad); err == nil {
+			t.Errorf("malformed encoding of %d bytes should be rejected", len(bad))
+		}
+	}
+
+	// user_2 commits, rekeying the root but not user_0's parent
+	if _, err := ApplyPathSecret(group, "user_2", bytes.Repeat([]byte{0x43}, suite.HashSize())); err != nil {
+		t.Fatalf("Failed to apply path secret: %v", err)
+	}
+	if forgotten, err := secrets.Prune(group); err != nil || !slices.Equal(forgotten, []int{path[1]}) {
+		t.Errorf("pruned %v, %v, want the root %d", forgotten, err, path[1])
+	}
+	if _, ok := secrets.Get(path[0]); !ok {
+		t.Errorf("the secret of user_0's parent should survive")
+	}
+
+	if err := secrets.Set(0, []byte("short")); err == nil {
+		t.Errorf("secrets of the wrong length should be rejected")
+	}
+	if _, err := secrets.KeyPair(99); err == nil {
+		t.Errorf("unknown nodes should have no key pair")
+	}
+}
@@ -0,0 +1,189 @@
+// Package treekem derives real TreeKEM node keys (RFC 9420 section 7.4)
+//
+// The tree package only does structural bookkeeping and fills intermediate nodes
+// with a hash placeholder. This package turns the path secrets a committer shares
+// into the HPKE key pairs of the nodes on its direct path, using X25519 or P-256
+// DHKEM as selected by the group ciphersuite. Committers build the UpdatePath that
+// carries those secrets, HPKE-encrypted to the copath, with GenerateUpdatePath, and
+// members keep the path secrets they know in a PathSecrets.
+package treekem
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Suite holds the primitives of one MLS ciphersuite
+type Suite struct {
+	id     tree.Ciphersuite
+	curve  ecdh.Curve
+	kemID  uint16 // RFC 9180 KEM identifier
+	aeadID uint16 // RFC 9180 AEAD identifier
+}
+
+// NewSuite returns the primitives for a supported ciphersuite
+func NewSuite(cs tree.Ciphersuite) (*Suite, error) {
+	switch cs {
+	case tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519:
+		return &Suite{id: cs, curve: ecdh.X25519(), kemID: 0x0020, aeadID: hpkeAEADAES128GCM}, nil
+	case tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256:
+		return &Suite{id: cs, curve: ecdh.P256(), kemID: 0x0010, aeadID: hpkeAEADAES128GCM}, nil
+	case tree.MLS_128_DHKEMX25519_CHACHA20POLY1305_SHA256_Ed25519:
+		return &Suite{id: cs, curve: ecdh.X25519(), kemID: 0x0020, aeadID: hpkeAEADChaCha20Poly1305}, nil
+	}
+	return nil, fmt.Errorf("unsupported ciphersuite 0x%04x", uint16(cs))
+}
+
+// Ciphersuite returns the suite identifier
+func (s *Suite) Ciphersuite() tree.Ciphersuite {
+	return s.id
+}
+
+// HashSize is Nh, the output size of the suite's KDF
+func (s *Suite) HashSize() int {
+	return sha256.Size
+}
+
+// Hash is the suite's hash function
+func (s *Suite) Hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// MAC is the suite's message authentication code, HMAC with its hash
+func (s *Suite) MAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Extract is the suite's KDF.Extract
+func (s *Suite) Extract(salt, ikm []byte) []byte {
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	return prk
+}
+
+// Expand is the suite's KDF.Expand
+func (s *Suite) Expand(secret, info []byte, length int) ([]byte, error) {
+	return hkdf.Expand(sha256.New, secret, string(info), length)
+}
+
+// ExpandWithLabel implements ExpandWithLabel from RFC 9420 section 8
+func (s *Suite) ExpandWithLabel(secret []byte, label string, context []byte, length int) ([]byte, error) {
+	w := &tls.Writer{}
+	w.Uint16(uint16(length))
+	if err := w.Opaque([]byte("MLS 1.0 " + label)); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(context); err != nil {
+		return nil, err
+	}
+	return s.Expand(secret, w.Buf, length)
+}
+
+// DeriveSecret implements DeriveSecret from RFC 9420 section 8
+func (s *Suite) DeriveSecret(secret []byte, label string) ([]byte, error) {
+	return s.ExpandWithLabel(secret, label, nil, s.HashSize())
+}
+
+// NextPathSecret derives the path secret of the next node up the direct path
+func (s *Suite) NextPathSecret(pathSecret []byte) ([]byte, error) {
+	return s.DeriveSecret(pathSecret, "path")
+}
+
+// NodeKeyPair derives the HPKE key pair of the node holding pathSecret
+func (s *Suite) NodeKeyPair(pathSecret []byte) (*ecdh.PrivateKey, error) {
+	nodeSecret, err := s.DeriveSecret(pathSecret, "node")
+	if err != nil {
+		return nil, err
+	}
+	return s.DeriveKeyPair(nodeSecret)
+}
+
+// DeriveKeyPair implements DeriveKeyPair of RFC 9180 section 7.1.3 for the suite's DHKEM
+func (s *Suite) DeriveKeyPair(ikm []byte) (*ecdh.PrivateKey, error) {
+	suiteID := binary.BigEndian.AppendUint16([]byte("KEM"), s.kemID)
+	prk := s.Extract(nil, labeled(suiteID, "dkp_prk", ikm))
+
+	if s.curve == ecdh.X25519() {
+		sk, err := s.Expand(prk, labeledInfo(suiteID, "sk", nil, 32), 32)
+		if err != nil {
+			return nil, err
+		}
+		return s.curve.NewPrivateKey(sk)
+	}
+
+	// P-256 samples candidates until one is a valid scalar
+	for counter := 0; counter < 256; counter++ {
+		sk, err := s.Expand(prk, labeledInfo(suiteID, "candidate", []byte{byte(counter)}, 32), 32)
+		if err != nil {
+			return nil, err
+		}
+		if key, err := s.curve.NewPrivateKey(sk); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("failed to derive a P-256 key pair")
+}
+
+// labeled builds the LabeledExtract input of RFC 9180 section 4
+func labeled(suiteID []byte, label string, ikm []byte) []byte {
+	out := append([]byte("HPKE-v1"), suiteID...)
+	out = append(out, label...)
+	return append(out, ikm...)
+}
+
+// labeledInfo builds the LabeledExpand info of RFC 9180 section 4
+func labeledInfo(suiteID []byte, label string, info []byte, length int) []byte {
+	out := binary.BigEndian.AppendUint16(nil, uint16(length))
+	return append(out, labeled(suiteID, label, info)...)
+}
+
+// PathKeys derives the public keys of count consecutive direct-path nodes, nearest
+// the leaf first, starting from the path secret of the first parent
+func (s *Suite) PathKeys(pathSecret []byte, count int) ([][]byte, error) {
+	keys := make([][]byte, 0, count)
+	secret := pathSecret
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			var err error
+			if secret, err = s.NextPathSecret(secret); err != nil {
+				return nil, err
+			}
+		}
+		key, err := s.NodeKeyPair(secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.PublicKey().Bytes())
+	}
+	return keys, nil
+}
+
+// ApplyPathSecret sets the keys of every intermediate node on leaf's direct path from
+// the path secret of its first parent, replacing the placeholder keys of UpdateIntermediateKeys
+// It returns the parent hash the leaf's commit leaf node must carry, see tree.SetPathKeys
+func ApplyPathSecret(t *tree.Tree, leaf string, pathSecret []byte) ([]byte, error) {
+	suite, err := NewSuite(t.Ciphersuite())
+	if err != nil {
+		return nil, err
+	}
+	path, err := t.GetPath(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := suite.PathKeys(pathSecret, len(path)-1)
+	if err != nil {
+		return nil, err
+	}
+	return t.SetPathKeys(leaf, keys)
+}
@@ -0,0 +1,98 @@
+package treekem
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// DeriveKeyPair vectors from RFC 9180 appendix A.1.1 and A.3.1
+func TestDeriveKeyPairVectors(t *testing.T) {
+	cases := []struct {
+		suite tree.Ciphersuite
+		ikm   string
+		check func(t *testing.T, suite *Suite, ikm []byte)
+	}{
+		{
+			suite: tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519,
+			ikm:   "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234",
+			check: func(t *testing.T, suite *Suite, ikm []byte) {
+				key, err := suite.DeriveKeyPair(ikm)
+				if err != nil {
+					t.Fatalf("Failed to derive key pair: %v", err)
+				}
+				if got := hex.EncodeToString(key.PublicKey().Bytes()); got != "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431" {
+					t.Errorf("unexpected X25519 public key %s", got)
+				}
+			},
+		},
+		{
+			suite: tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256,
+			ikm:   "4270e54ffd08d79d5928020af4686d8f6b7d35dbe470265f1f5aa22816ce860e",
+			check: func(t *testing.T, suite *Suite, ikm []byte) {
+				key, err := suite.DeriveKeyPair(ikm)
+				if err != nil {
+					t.Fatalf("Failed to derive key pair: %v", err)
+				}
+				if got := hex.EncodeToString(key.Bytes()); got != "4995788ef4b9d6132b249ce59a77281493eb39af373d236a1fe415cb0c2d7beb" {
+					t.Errorf("unexpected P-256 private key %s", got)
+				}
+			},
+		},
+	}
+	for _, c := range cases {
+		suite, err := NewSuite(c.suite)
+		if err != nil {
+			t.Fatalf("Failed to create suite: %v", err)
+		}
+		ikm, _ := hex.DecodeString(c.ikm)
+		c.check(t, suite, ikm)
+	}
+
+	if _, err := NewSuite(0x0007); err == nil {
+		t.Errorf("expected an error for an unsupported ciphersuite")
+	}
+}
+
+func TestApplyPathSecret(t *testing.T) {
+	suite, _ := NewSuite(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(suite.Ciphersuite()))
+	for i := 0; i < 8; i++ {
+		leaf, _ := suite.NodeKeyPair([]byte(fmt.Sprintf("leaf secret %d", i)))
+		if err := group.Insert(fmt.Sprintf("user_%d", i), leaf.PublicKey().Bytes()); err != nil {
+			t.Fatalf("Failed to insert user_%d: %v", i, err)
+		}
+	}
+
+	pathSecret := bytes.Repeat([]byte{0x42}, suite.HashSize())
+	if _, err := ApplyPathSecret(group, "user_5", pathSecret); err != nil {
+		t.Fatalf("Failed to apply path secret: %v", err)
+	}
+	if err := group.ValidateParentHashes(); err != nil {
+		t.Errorf("path update should leave a valid parent hash chain: %v", err)
+	}
+
+	// Any member that learns a path secret derives the matching private key
+	path, _ := group.GetPath("user_5")
+	secret := pathSecret
+	for i := len(path) - 2; i >= 0; i-- {
+		private, err := suite.NodeKeyPair(secret)
+		if err != nil {
+			t.Fatalf("Failed to derive node key: %v", err)
+		}
+		if !bytes.Equal(private.PublicKey().Bytes(), path[i].Value()) {
+			t.Errorf("node %s does not hold the key derived from its path secret", path[i].Name())
+		}
+		secret, _ = suite.NextPathSecret(secret)
+	}
+
+	// Different path secrets give different root keys
+	before := group.Head().Value()
+	ApplyPathSecret(group, "user_5", bytes.Repeat([]byte{0x43}, suite.HashSize()))
+	if bytes.Equal(before, group.Head().Value()) {
+		t.Errorf("a new path secret should rotate the root key")
+	}
+}
@@ -0,0 +1,177 @@
+package treekem
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// UpdatePathSecrets is the private state the committer keeps from GenerateUpdatePath
+type UpdatePathSecrets struct {
+	LeafKey      *ecdh.PrivateKey // private key of the new leaf node
+	PathSecrets  [][]byte         // one per UpdatePath node, nearest the leaf first
+	CommitSecret []byte           // path secret one step past the root
+}
+
+// GenerateUpdatePath builds a fresh UpdatePath for leaf (RFC 9420 section 7.5)
+// The new leaf node copies the current one with a fresh encryption key, commit source and
+// the parent hash its new path gets, signed by signer over the tree's group ID. Each path
+// secret is encrypted under groupContext to the copath resolution as the tree holds it now,
+// so t must be the committer's view of the group before the commit.
+// Nothing in t changes; the server applies the result with Tree.ApplyUpdatePath
+func GenerateUpdatePath(t *tree.Tree, leaf string, signer crypto.Signer, groupContext []byte) (*tree.UpdatePath, *UpdatePathSecrets, error) {
+	return generateUpdatePath(t, leaf, nil, signer, groupContext)
+}
+
+// RotateLeaf is the one-call self-update of a member: it builds the UpdatePath of leaf
+// with leafKey as the new encryption key, a fresh one when nil, and installs it in t
+// with Tree.ApplyUpdatePath, so the leaf and every parent on its direct path take their
+// new keys and are marked modified. The returned path is what goes into the Commit and
+// the secrets are what the member keeps to derive the next epoch
+func RotateLeaf(t *tree.Tree, leaf string, leafKey *ecdh.PrivateKey, signer crypto.Signer, groupContext []byte) (*tree.UpdatePath, *UpdatePathSecrets, error) {
+	update, secrets, err := generateUpdatePath(t, leaf, leafKey, signer, groupContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := t.ApplyUpdatePath(leaf, update); err != nil {
+		return nil, nil, fmt.Errorf("failed to apply update path: %w", err)
+	}
+	return update, secrets, nil
+}
+
+// generateUpdatePath builds the UpdatePath of leaf, generating a leaf key when leafKey is nil
+func generateUpdatePath(t *tree.Tree, leaf string, leafKey *ecdh.PrivateKey, signer crypto.Signer, groupContext []byte) (*tree.UpdatePath, *UpdatePathSecrets, error) {
+	suite, err := NewSuite(t.Ciphersuite())
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := t.GetPath(leaf)
+	if err != nil {
+		return nil, nil, err
+	}
+	element := path[len(path)-1]
+	current := element.LeafNode()
+	if current == nil {
+		return nil, nil, fmt.Errorf("%s has no leaf node to update", leaf)
+	}
+
+	if leafKey == nil {
+		if leafKey, err = suite.curve.GenerateKey(rand.Reader); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate leaf key: %w", err)
+		}
+	} else if leafKey.Curve() != suite.curve {
+		return nil, nil, fmt.Errorf("leaf key does not match ciphersuite 0x%04x", uint16(suite.Ciphersuite()))
+	}
+	pathSecret := make([]byte, suite.HashSize())
+	if _, err := rand.Read(pathSecret); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate path secret: %w", err)
+	}
+
+	parents := len(path) - 1
+	secrets := &UpdatePathSecrets{LeafKey: leafKey, PathSecrets: make([][]byte, parents)}
+	for i := range parents {
+		if i > 0 {
+			if pathSecret, err = suite.NextPathSecret(pathSecret); err != nil {
+				return nil, nil, err
+			}
+		}
+		secrets.PathSecrets[i] = pathSecret
+	}
+	if secrets.CommitSecret, err = suite.NextPathSecret(pathSecret); err != nil {
+		return nil, nil, err
+	}
+	nodes, err := encryptPath(t, suite, path, secrets.PathSecrets, groupContext, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	update := &tree.UpdatePath{Nodes: nodes}
+	keys := make([][]byte, parents)
+	for i, node := range nodes {
+		keys[i] = node.EncryptionKey
+	}
+
+	parentHash, err := t.PathParentHash(leaf, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := *current
+	next.EncryptionKey = leafKey.PublicKey().Bytes()
+	next.Source = tree.LeafNodeSourceCommit
+	next.Lifetime = tree.Lifetime{}
+	next.ParentHash = parentHash
+	if err := next.Sign(signer, t.GroupID(), uint32(element.LeafIndex())); err != nil {
+		return nil, nil, err
+	}
+	update.LeafNode = &next
+	return update, secrets, nil
+}
+
+// EncryptPathSecrets HPKE-encrypts the path secrets of leaf's direct path to the copath
+// (RFC 9420 section 7.6). pathSecret belongs to the leaf's first parent and each parent
+// above takes the next secret of the chain. Every secret is encrypted under groupContext
+// to each node in the resolution of the copath child, skipping the leaves named in
+// exclude, such as members added by the same commit who learn their secret from the
+// Welcome. The result holds one node per parent, nearest the leaf first, with its new
+// public key, ready to be the Nodes of an UpdatePath
+func EncryptPathSecrets(t *tree.Tree, leaf string, pathSecret, groupContext []byte, exclude ...string) ([]tree.UpdatePathNode, error) {
+	suite, err := NewSuite(t.Ciphersuite())
+	if err != nil {
+		return nil, err
+	}
+	path, err := t.GetPath(leaf)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([][]byte, len(path)-1)
+	for i := range secrets {
+		if i > 0 {
+			if pathSecret, err = suite.NextPathSecret(pathSecret); err != nil {
+				return nil, err
+			}
+		}
+		secrets[i] = pathSecret
+	}
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+	return encryptPath(t, suite, path, secrets, groupContext, excluded)
+}
+
+// encryptPath builds the UpdatePath nodes of path, which runs root to leaf, from the
+// path secrets of its parents, nearest the leaf first
+func encryptPath(t *tree.Tree, suite *Suite, path []*tree.Element, secrets [][]byte, groupContext []byte, excluded map[string]bool) ([]tree.UpdatePathNode, error) {
+	nodes := make([]tree.UpdatePathNode, len(secrets))
+	for i, secret := range secrets {
+		key, err := suite.NodeKeyPair(secret)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i].EncryptionKey = key.PublicKey().Bytes()
+
+		// the i-th parent up sits at len(path)-2-i
+		parent, child := path[len(path)-2-i], path[len(path)-1-i]
+		copath := parent.LeftChild()
+		if copath == child {
+			copath = parent.RightChild()
+		}
+		recipients, err := t.Resolution(copath.NodeIndex())
+		if err != nil {
+			return nil, err
+		}
+		for _, recipient := range recipients {
+			if excluded[recipient.Name()] {
+				continue
+			}
+			ct, err := suite.EncryptWithLabel(recipient.Value(), "UpdatePathNode", groupContext, secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt path secret to %s: %w", recipient.Name(), err)
+			}
+			nodes[i].EncryptedPathSecret = append(nodes[i].EncryptedPathSecret, ct)
+		}
+	}
+	return nodes, nil
+}
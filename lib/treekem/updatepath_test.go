@@ -0,0 +1,196 @@
+package treekem
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestGenerateUpdatePath(t *testing.T) {
+	for _, cs := range []tree.Ciphersuite{tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256} {
+		suite, _ := NewSuite(cs)
+		group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+		signers := make(map[string]crypto.Signer)
+		leafKeys := make(map[string]*ecdh.PrivateKey)
+		for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+			signer, _ := keypackage.GenerateSignatureKey(cs)
+			kp, private, err := keypackage.Generate(cs, []byte(name), signer)
+			if err != nil {
+				t.Fatalf("Failed to generate key package: %v", err)
+			}
+			if err := group.InsertFromKeyPackage(kp); err != nil {
+				t.Fatalf("Failed to insert %s: %v", name, err)
+			}
+			signers[name], leafKeys[name] = signer, private.EncryptionKey
+		}
+
+		context := []byte("group context")
+		update, secrets, err := GenerateUpdatePath(group, "alice", signers["alice"], context)
+		if err != nil {
+			t.Fatalf("0x%04x: failed to generate update path: %v", uint16(cs), err)
+		}
+		path, _ := group.GetPath("alice")
+		if len(update.Nodes) != len(path)-1 || len(secrets.PathSecrets) != len(path)-1 {
+			t.Fatalf("0x%04x: update path should cover the %d node direct path", uint16(cs), len(path)-1)
+		}
+
+		// Every other member decrypts the path secret of the lowest parent it shares
+		// with alice and derives the rest of the path from it
+		for name, key := range leafKeys {
+			if name == "alice" {
+				continue
+			}
+			found := false
+			for i := range update.Nodes {
+				parent, child := path[len(path)-2-i], path[len(path)-1-i]
+				copath := parent.LeftChild()
+				if copath == child {
+					copath = parent.RightChild()
+				}
+				recipients, _ := group.Resolution(copath.NodeIndex())
+				for j, recipient := range recipients {
+					if recipient.Name() != name {
+						continue
+					}
+					secret, err := suite.DecryptWithLabel(key, "UpdatePathNode", context, update.Nodes[i].EncryptedPathSecret[j])
+					if err != nil {
+						t.Fatalf("0x%04x: %s failed to decrypt: %v", uint16(cs), name, err)
+					}
+					keys, _ := suite.PathKeys(secret, len(update.Nodes)-i)
+					for k, want := range keys {
+						if !bytes.Equal(update.Nodes[i+k].EncryptionKey, want) {
+							t.Errorf("0x%04x: %s derived the wrong key for node %d", uint16(cs), name, i+k)
+						}
+					}
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("0x%04x: no path secret was encrypted to %s", uint16(cs), name)
+			}
+		}
+
+		// The server applies the update path and ends up with a valid parent hash chain
+		if err := group.ApplyUpdatePath("alice", update); err != nil {
+			t.Fatalf("0x%04x: failed to apply update path: %v", uint16(cs), err)
+		}
+		if err := group.ValidateParentHashes(); err != nil {
+			t.Errorf("0x%04x: applied update path should validate: %v", uint16(cs), err)
+		}
+		alice, _ := group.Find("alice")
+		if !bytes.Equal(alice.Value(), secrets.LeafKey.PublicKey().Bytes()) {
+			t.Errorf("0x%04x: alice should hold the new leaf key", uint16(cs))
+		}
+	}
+
+	bare, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519))
+	key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	bare.Insert("alice", key.PublicKey().Bytes())
+	signer, _ := keypackage.GenerateSignatureKey(tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519)
+	if _, _, err := GenerateUpdatePath(bare, "alice", signer, nil); err == nil {
+		t.Errorf("leaves without a leaf node cannot generate an update path")
+	}
+}
+
+func TestEncryptPathSecrets(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	suite, _ := NewSuite(cs)
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+	leafKeys := make(map[string]*ecdh.PrivateKey)
+	for _, name := range []string{"alice", "bob", "charlie", "dave", "eve"} {
+		signer, _ := keypackage.GenerateSignatureKey(cs)
+		kp, private, _ := keypackage.Generate(cs, []byte(name), signer)
+		if err := group.InsertFromKeyPackage(kp); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		leafKeys[name] = private.EncryptionKey
+	}
+
+	pathSecret := make([]byte, suite.HashSize())
+	rand.Read(pathSecret)
+	context := []byte("group context")
+	nodes, err := EncryptPathSecrets(group, "alice", pathSecret, context, "eve")
+	if err != nil {
+		t.Fatalf("Failed to encrypt path secrets: %v", err)
+	}
+	path, _ := group.GetPath("alice")
+	keys, _ := suite.PathKeys(pathSecret, len(path)-1)
+	if len(nodes) != len(keys) {
+		t.Fatalf("expected a node per parent, got %d", len(nodes))
+	}
+
+	// Every other member opens exactly one secret, the one of the lowest parent it shares with alice
+	for name, key := range leafKeys {
+		opened := 0
+		for i, node := range nodes {
+			if !bytes.Equal(node.EncryptionKey, keys[i]) {
+				t.Fatalf("node %d should carry the key of its path secret", i)
+			}
+			for _, ct := range node.EncryptedPathSecret {
+				secret, err := suite.DecryptWithLabel(key, "UpdatePathNode", context, ct)
+				if err != nil {
+					continue
+				}
+				opened++
+				if derived, _ := suite.NodeKeyPair(secret); !bytes.Equal(derived.PublicKey().Bytes(), keys[i]) {
+					t.Errorf("%s opened a secret that does not match node %d", name, i)
+				}
+			}
+		}
+		want := 1
+		if name == "alice" || name == "eve" {
+			want = 0
+		}
+		if opened != want {
+			t.Errorf("%s should open %d path secrets, opened %d", name, want, opened)
+		}
+	}
+}
+
+func TestRotateLeaf(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+	signers := make(map[string]crypto.Signer)
+	for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+		signer, _ := keypackage.GenerateSignatureKey(cs)
+		kp, _, _ := keypackage.Generate(cs, []byte(name), signer)
+		if err := group.InsertFromKeyPackage(kp); err != nil {
+			t.Fatalf("Failed to insert %s: %v", name, err)
+		}
+		signers[name] = signer
+	}
+
+	wrong, _ := ecdh.P256().GenerateKey(rand.Reader)
+	if _, _, err := RotateLeaf(group, "alice", wrong, signers["alice"], nil); err == nil {
+		t.Errorf("a leaf key of another curve should be rejected")
+	}
+
+	leafKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	before := time.Now()
+	update, secrets, err := RotateLeaf(group, "alice", leafKey, signers["alice"], []byte("group context"))
+	if err != nil {
+		t.Fatalf("Failed to rotate leaf: %v", err)
+	}
+	if secrets.LeafKey != leafKey || !bytes.Equal(update.LeafNode.EncryptionKey, leafKey.PublicKey().Bytes()) {
+		t.Errorf("rotated leaf node should carry the given key")
+	}
+	path, _ := group.GetPath("alice")
+	if !bytes.Equal(path[len(path)-1].Value(), leafKey.PublicKey().Bytes()) {
+		t.Errorf("tree should hold the rotated leaf key")
+	}
+	for i, node := range update.Nodes {
+		parent := path[len(path)-2-i]
+		if !bytes.Equal(parent.Value(), node.EncryptionKey) || !parent.WasModifiedSince(before) {
+			t.Errorf("parent %s should take the new key and be marked modified", parent.Name())
+		}
+	}
+	if err := group.ValidateParentHashes(); err != nil {
+		t.Errorf("rotated path should validate: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package welcome
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExtensionTypeRatchetTreeLocation is the GroupInfo extension naming where the ratchet
+// tree can be fetched when it is not embedded. The type is from the private range of
+// RFC 9420 section 17.3, so only peers of this package understand it
+const ExtensionTypeRatchetTreeLocation uint16 = 0xf001
+
+// ErrNoTreeFetcher is returned when a Welcome points to its ratchet tree but the joiner
+// gave no TreeFetcher to retrieve it
+var ErrNoTreeFetcher = errors.New("ratchet tree is delivered out of band and no fetcher was given")
+
+// TreeFetcher retrieves a ratchet tree published out of band, see WithRatchetTreeLocation
+// The tree need not be trusted: Join checks it against the signed GroupInfo's tree hash
+type TreeFetcher interface {
+	FetchRatchetTree(location string) ([]byte, error)
+}
+
+// TreeFetcherFunc adapts a function to TreeFetcher
+type TreeFetcherFunc func(location string) ([]byte, error)
+
+// FetchRatchetTree implements TreeFetcher
+func (f TreeFetcherFunc) FetchRatchetTree(location string) ([]byte, error) {
+	return f(location)
+}
+
+// WithRatchetTreeLocation leaves the ratchet tree out of the GroupInfo and names where
+// joiners fetch it instead, a URL or any handle their TreeFetcher resolves. Groups whose
+// members sit on constrained links choose this to keep Welcomes small; the caller
+// publishes Tree.ExportRatchetTree at location. An empty location embeds the tree again
+func (b *Builder) WithRatchetTreeLocation(location string) *Builder {
+	b.treeLocation = location
+	return b
+}
+
+// RatchetTreeLocation returns where the ratchet tree is published when the GroupInfo
+// does not embed it
+func (gi *GroupInfo) RatchetTreeLocation() (string, bool) {
+	for _, ext := range gi.Extensions {
+		if ext.Type == ExtensionTypeRatchetTreeLocation {
+			return string(ext.Data), true
+		}
+	}
+	return "", false
+}
+
+// ratchetTreeOf returns the ratchet tree the GroupInfo embeds or points to
+func (gi *GroupInfo) ratchetTreeOf(fetcher TreeFetcher) ([]byte, error) {
+	if ratchetTree := gi.RatchetTree(); ratchetTree != nil {
+		return ratchetTree, nil
+	}
+	location, ok := gi.RatchetTreeLocation()
+	if !ok {
+		return nil, ErrNoRatchetTree
+	}
+	if fetcher == nil {
+		return nil, ErrNoTreeFetcher
+	}
+	ratchetTree, err := fetcher.FetchRatchetTree(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ratchet tree from %s: %w", location, err)
+	}
+	return ratchetTree, nil
+}
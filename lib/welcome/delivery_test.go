@@ -0,0 +1,99 @@
+package welcome
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestRatchetTreeLocation(t *testing.T) {
+	cs := tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519
+	group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+	aliceSigner, _ := keypackage.GenerateSignatureKey(cs)
+	alice, _, err := keypackage.Generate(cs, []byte("alice"), aliceSigner)
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	bobSigner, _ := keypackage.GenerateSignatureKey(cs)
+	bob, bobPrivate, err := keypackage.Generate(cs, []byte("bob"), bobSigner)
+	if err != nil {
+		t.Fatalf("Failed to generate key package: %v", err)
+	}
+	for _, kp := range []*keypackage.KeyPackage{alice, bob} {
+		if err := group.InsertFromKeyPackage(kp); err != nil {
+			t.Fatalf("Failed to insert member: %v", err)
+		}
+	}
+
+	builder, err := NewBuilder(group, []byte("joiner secret"))
+	if err != nil {
+		t.Fatalf("Failed to start welcome: %v", err)
+	}
+	if err := builder.AddMember(bob, nil); err != nil {
+		t.Fatalf("Failed to add bob: %v", err)
+	}
+	embedded, err := builder.Build(aliceSigner, "alice")
+	if err != nil {
+		t.Fatalf("Failed to build welcome: %v", err)
+	}
+	referenced, err := builder.WithRatchetTreeLocation("https://ds.example/trees/group").Build(aliceSigner, "alice")
+	if err != nil {
+		t.Fatalf("Failed to build welcome: %v", err)
+	}
+	if len(referenced.EncryptedGroupInfo) >= len(embedded.EncryptedGroupInfo) {
+		t.Errorf("a welcome without the tree should be smaller, got %d >= %d", len(referenced.EncryptedGroupInfo), len(embedded.EncryptedGroupInfo))
+	}
+
+	if _, _, _, err := referenced.Join(bob, bobPrivate.InitKey, nil); !errors.Is(err, ErrNoTreeFetcher) {
+		t.Errorf("joining without a fetcher should fail with ErrNoTreeFetcher, got %v", err)
+	}
+	failing := TreeFetcherFunc(func(string) ([]byte, error) { return nil, errors.New("offline") })
+	if _, _, _, err := referenced.JoinWithFetcher(bob, bobPrivate.InitKey, failing, nil); err == nil {
+		t.Errorf("fetch errors should fail the join")
+	}
+
+	// A tree that does not match the signed tree hash is rejected
+	other, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+	if err := other.InsertFromKeyPackage(alice); err != nil {
+		t.Fatalf("Failed to insert alice: %v", err)
+	}
+	stale, err := other.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	staleFetcher := TreeFetcherFunc(func(string) ([]byte, error) { return stale, nil })
+	if _, _, _, err := referenced.JoinWithFetcher(bob, bobPrivate.InitKey, staleFetcher, nil); err == nil {
+		t.Errorf("a fetched tree not matching the group info should be rejected")
+	}
+
+	published, err := group.ExportRatchetTree()
+	if err != nil {
+		t.Fatalf("Failed to export ratchet tree: %v", err)
+	}
+	var fetched string
+	fetcher := TreeFetcherFunc(func(location string) ([]byte, error) {
+		fetched = location
+		return published, nil
+	})
+	joined, _, info, err := referenced.JoinWithFetcher(bob, bobPrivate.InitKey, fetcher, nil)
+	if err != nil {
+		t.Fatalf("bob failed to join with the fetched tree: %v", err)
+	}
+	if fetched != "https://ds.example/trees/group" {
+		t.Errorf("fetcher should be asked for the published location, got %q", fetched)
+	}
+	if location, ok := info.RatchetTreeLocation(); !ok || location != fetched || info.RatchetTree() != nil {
+		t.Errorf("group info should carry the location instead of the tree")
+	}
+	if !bytes.Equal(joined.TreeHash(), group.TreeHash()) {
+		t.Errorf("joined tree should hash like the group's tree")
+	}
+
+	// Embedded trees ignore the fetcher
+	if _, _, _, err := embedded.JoinWithFetcher(bob, bobPrivate.InitKey, failing, nil); err != nil {
+		t.Errorf("embedded welcome should not need the fetcher: %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package welcome builds and opens MLS Welcome messages (RFC 9420 section 12.4.3)
+//
+// A Welcome is how members added by a Commit learn the group they joined: the
+// joiner secret and optional path secret are HPKE-encrypted to each new member's
+// KeyPackage init key, and the signed GroupInfo, carrying the ratchet tree as an
+// extension, is encrypted under a key derived from the joiner secret. A server
+// that adds members to a tree with tree.InsertFromKeyPackage uses Builder to
+// produce their Welcome; joiners open it with Welcome.Join.
+package welcome
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+	"github.com/snowmerak/mls/lib/treekem"
+)
+
+// ExtensionTypeRatchetTree is the GroupInfo extension carrying the encoded ratchet tree
+const ExtensionTypeRatchetTree uint16 = 0x0002
+
+var (
+	// ErrNotInvited is returned when a Welcome has no secrets for the joining KeyPackage
+	ErrNotInvited = errors.New("welcome does not include this key package")
+	// ErrNoRatchetTree is returned when the GroupInfo does not carry the ratchet tree
+	ErrNoRatchetTree = errors.New("group info has no ratchet tree extension")
+)
+
+// GroupInfo is the signed description of the group a Welcome admits members to
+type GroupInfo struct {
+	GroupContext    tree.GroupContext
+	Extensions      []tree.Extension
+	ConfirmationTag []byte
+	Signer          uint32 // leaf index of the member that signed, left to right
+	Signature       []byte
+}
+
+// RatchetTree returns the ratchet_tree extension data, or nil when it is absent
+func (gi *GroupInfo) RatchetTree() []byte {
+	for _, ext := range gi.Extensions {
+		if ext.Type == ExtensionTypeRatchetTree {
+			return ext.Data
+		}
+	}
+	return nil
+}
+
+// GroupSecrets are the secrets encrypted to each new member
+// PathSecret is the secret of the lowest node the joiner shares with the committer's
+// UpdatePath, nil when the Commit had none
+type GroupSecrets struct {
+	JoinerSecret []byte
+	PathSecret   []byte
+}
+
+// EncryptedGroupSecrets are GroupSecrets sealed to the init key of one KeyPackage
+type EncryptedGroupSecrets struct {
+	NewMember             []byte // KeyPackageRef of the joiner
+	EncryptedGroupSecrets tree.HPKECiphertext
+}
+
+// Welcome is the message sent to members added by a Commit
+type Welcome struct {
+	CipherSuite        tree.Ciphersuite
+	Secrets            []EncryptedGroupSecrets
+	EncryptedGroupInfo []byte
+}
+
+// Builder collects the new members of one Commit and produces their Welcome
+type Builder struct {
+	tree         *tree.Tree
+	suite        *treekem.Suite
+	joinerSecret []byte
+	extensions   []tree.Extension
+	confirmation []byte
+	treeLocation string // see WithRatchetTreeLocation
+	members      []member
+}
+
+type member struct {
+	kp         *keypackage.KeyPackage
+	pathSecret []byte
+}
+
+// NewBuilder starts a Welcome into the current epoch of t
+// t is the tree after the Commit that added the members, and joinerSecret the epoch's
+// joiner secret from the key schedule
+func NewBuilder(t *tree.Tree, joinerSecret []byte) (*Builder, error) {
+	if t.Ciphersuite() == 0 {
+		return nil, errors.New("tree has no ciphersuite to build a welcome for")
+	}
+	suite, err := treekem.NewSuite(t.Ciphersuite())
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{tree: t, suite: suite, joinerSecret: joinerSecret}, nil
+}
+
+// WithExtensions adds GroupInfo extensions besides the ratchet tree
+func (b *Builder) WithExtensions(extensions ...tree.Extension) *Builder {
+	b.extensions = append(b.extensions, extensions...)
+	return b
+}
+
+// WithConfirmationTag sets the confirmation tag of the Commit that added the members
+// Joiners derive the interim transcript hash of the epoch from it
+func (b *Builder) WithConfirmationTag(tag []byte) *Builder {
+	b.confirmation = tag
+	return b
+}
+
+// AddMember includes the member that joined from kp, with the path secret it shares with
+// the committer or nil. The member must already be in the tree with the KeyPackage's key
+func (b *Builder) AddMember(kp *keypackage.KeyPackage, pathSecret []byte) error {
+	if kp.CipherSuite != b.tree.Ciphersuite() {
+		return fmt.Errorf("key package of %s uses ciphersuite 0x%04x, group uses 0x%04x", kp.Identity(), uint16(kp.CipherSuite), uint16(b.tree.Ciphersuite()))
+	}
+	leaf, ok := b.tree.Find(kp.Identity())
+	if !ok {
+		return fmt.Errorf("%s has not been added to the tree", kp.Identity())
+	}
+	if !bytes.Equal(leaf.Value(), kp.LeafNode.EncryptionKey) {
+		return fmt.Errorf("leaf %s does not hold the key package's encryption key", kp.Identity())
+	}
+	b.members = append(b.members, member{kp: kp, pathSecret: pathSecret})
+	return nil
+}
+
+// Build signs the GroupInfo as signerLeaf and encrypts the group secrets to every member
+func (b *Builder) Build(signer crypto.Signer, signerLeaf string) (*Welcome, error) {
+	if len(b.members) == 0 {
+		return nil, errors.New("welcome has no new members")
+	}
+	index := -1
+	for i, leaf := range b.tree.GetLeaves() {
+		if leaf.Name() == signerLeaf {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("signer %s is not a leaf of the tree", signerLeaf)
+	}
+	delivery := tree.Extension{Type: ExtensionTypeRatchetTreeLocation, Data: []byte(b.treeLocation)}
+	if b.treeLocation == "" {
+		ratchetTree, err := b.tree.ExportRatchetTree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export ratchet tree: %w", err)
+		}
+		delivery = tree.Extension{Type: ExtensionTypeRatchetTree, Data: ratchetTree}
+	}
+
+	info := &GroupInfo{
+		GroupContext:    b.tree.GroupContext(),
+		Extensions:      append(append([]tree.Extension(nil), b.extensions...), delivery),
+		ConfirmationTag: b.confirmation,
+		Signer:          uint32(index),
+	}
+	tbs, err := info.marshalTBS()
+	if err != nil {
+		return nil, err
+	}
+	if info.Signature, err = tree.SignWithLabel(signer, "GroupInfoTBS", tbs); err != nil {
+		return nil, fmt.Errorf("failed to sign group info: %w", err)
+	}
+	encoded, err := info.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, nonce, err := welcomeAEAD(b.suite, b.joinerSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Welcome{CipherSuite: b.tree.Ciphersuite(), EncryptedGroupInfo: aead.Seal(nil, nonce, encoded, nil)}
+	for _, m := range b.members {
+		ref, err := m.kp.Ref()
+		if err != nil {
+			return nil, err
+		}
+		secrets, err := (&GroupSecrets{JoinerSecret: b.joinerSecret, PathSecret: m.pathSecret}).Marshal()
+		if err != nil {
+			return nil, err
+		}
+		ct, err := b.suite.EncryptWithLabel(m.kp.InitKey, "Welcome", w.EncryptedGroupInfo, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt group secrets to %s: %w", m.kp.Identity(), err)
+		}
+		w.Secrets = append(w.Secrets, EncryptedGroupSecrets{NewMember: ref, EncryptedGroupSecrets: ct})
+	}
+	return w, nil
+}
+
+// Join opens the Welcome as the holder of kp and its init key
+// The group secrets and GroupInfo are decrypted, the ratchet tree is imported into store,
+// the GroupInfo signature is checked against the signer's leaf in that tree and the tree
+// takes over the GroupInfo's group context, whose tree hash it must match.
+// Welcomes that deliver the tree out of band need JoinWithFetcher
+func (w *Welcome) Join(kp *keypackage.KeyPackage, initKey *ecdh.PrivateKey, store tree.Store, opts ...tree.Option) (*tree.Tree, *GroupSecrets, *GroupInfo, error) {
+	return w.JoinWithFetcher(kp, initKey, nil, store, opts...)
+}
+
+// JoinWithFetcher is Join for Welcomes built with WithRatchetTreeLocation, using fetcher
+// to retrieve the ratchet tree the GroupInfo points to. Embedded trees need no fetcher
+func (w *Welcome) JoinWithFetcher(kp *keypackage.KeyPackage, initKey *ecdh.PrivateKey, fetcher TreeFetcher, store tree.Store, opts ...tree.Option) (*tree.Tree, *GroupSecrets, *GroupInfo, error) {
+	if kp.CipherSuite != w.CipherSuite {
+		return nil, nil, nil, fmt.Errorf("key package uses ciphersuite 0x%04x, welcome uses 0x%04x", uint16(kp.CipherSuite), uint16(w.CipherSuite))
+	}
+	suite, err := treekem.NewSuite(w.CipherSuite)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ref, err := kp.Ref()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var sealed *EncryptedGroupSecrets
+	for i := range w.Secrets {
+		if bytes.Equal(w.Secrets[i].NewMember, ref) {
+			sealed = &w.Secrets[i]
+		}
+	}
+	if sealed == nil {
+		return nil, nil, nil, ErrNotInvited
+	}
+	plaintext, err := suite.DecryptWithLabel(initKey, "Welcome", w.EncryptedGroupInfo, sealed.EncryptedGroupSecrets)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decrypt group secrets: %w", err)
+	}
+	secrets, err := UnmarshalGroupSecrets(plaintext)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	aead, nonce, err := welcomeAEAD(suite, secrets.JoinerSecret)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encoded, err := aead.Open(nil, nonce, w.EncryptedGroupInfo, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decrypt group info: %w", err)
+	}
+	info, err := UnmarshalGroupInfo(encoded)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ratchetTree, err := info.ratchetTreeOf(fetcher)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	t, err := tree.ImportRatchetTree(ratchetTree, store, append([]tree.Option{tree.WithCiphersuite(w.CipherSuite)}, opts...)...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	leaves := t.GetLeaves()
+	if int(info.Signer) >= len(leaves) || leaves[info.Signer].LeafNode() == nil {
+		return nil, nil, nil, fmt.Errorf("group info signer %d has no leaf node in the ratchet tree", info.Signer)
+	}
+	tbs, err := info.marshalTBS()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := tree.VerifyWithLabel(w.CipherSuite, leaves[info.Signer].LeafNode().SignatureKey, "GroupInfoTBS", tbs, info.Signature); err != nil {
+		return nil, nil, nil, fmt.Errorf("group info: %w", err)
+	}
+	if err := t.RestoreGroupContext(info.GroupContext); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(info.ConfirmationTag) > 0 {
+		interim := &tls.Writer{Buf: append([]byte(nil), info.GroupContext.ConfirmedTranscriptHash...)}
+		if err := interim.Opaque(info.ConfirmationTag); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := t.SetTranscriptHashes(info.GroupContext.ConfirmedTranscriptHash, suite.Hash(interim.Buf)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return t, secrets, info, nil
+}
+
+// welcomeAEAD derives the key and nonce protecting the GroupInfo (RFC 9420 section 8)
+// No PSKs are supported yet, so the member secret is extracted from an all-zero psk_secret
+func welcomeAEAD(suite *treekem.Suite, joinerSecret []byte) (cipher.AEAD, []byte, error) {
+	memberSecret := suite.Extract(joinerSecret, make([]byte, suite.HashSize()))
+	welcomeSecret, err := suite.DeriveSecret(memberSecret, "welcome")
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := suite.ExpandWithLabel(welcomeSecret, "key", nil, suite.AEADKeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := suite.ExpandWithLabel(welcomeSecret, "nonce", nil, suite.AEADNonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := suite.NewAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nonce, nil
+}
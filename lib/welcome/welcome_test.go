@@ -0,0 +1,103 @@
+package welcome
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"errors"
+	"testing"
+
+	"github.com/snowmerak/mls/lib/keypackage"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+func TestWelcomeJoin(t *testing.T) {
+	for _, cs := range []tree.Ciphersuite{tree.MLS_128_DHKEMX25519_AES128GCM_SHA256_Ed25519, tree.MLS_128_DHKEMP256_AES128GCM_SHA256_P256} {
+		group, _ := tree.NewTreeWithStore(nil, tree.WithCiphersuite(cs), tree.WithGroupID([]byte("group")))
+		signers := make(map[string]crypto.Signer)
+		packages := make(map[string]*keypackage.KeyPackage)
+		initKeys := make(map[string]*ecdh.PrivateKey)
+		for _, name := range []string{"alice", "bob", "charlie", "dave"} {
+			signer, _ := keypackage.GenerateSignatureKey(cs)
+			kp, private, err := keypackage.Generate(cs, []byte(name), signer)
+			if err != nil {
+				t.Fatalf("Failed to generate key package: %v", err)
+			}
+			signers[name], packages[name], initKeys[name] = signer, kp, private.InitKey
+		}
+		for _, name := range []string{"alice", "bob", "charlie"} {
+			if err := group.InsertFromKeyPackage(packages[name]); err != nil {
+				t.Fatalf("Failed to insert %s: %v", name, err)
+			}
+		}
+
+		builder, err := NewBuilder(group, []byte("joiner secret"))
+		if err != nil {
+			t.Fatalf("Failed to start welcome: %v", err)
+		}
+		if err := builder.AddMember(packages["dave"], nil); err == nil {
+			t.Errorf("members not in the tree should be rejected")
+		}
+		if err := group.InsertFromKeyPackage(packages["dave"]); err != nil {
+			t.Fatalf("Failed to insert dave: %v", err)
+		}
+		if err := builder.AddMember(packages["dave"], []byte("path secret")); err != nil {
+			t.Fatalf("Failed to add dave: %v", err)
+		}
+		welcome, err := builder.WithConfirmationTag([]byte("tag")).Build(signers["alice"], "alice")
+		if err != nil {
+			t.Fatalf("0x%04x: failed to build welcome: %v", uint16(cs), err)
+		}
+
+		encoded, err := welcome.Marshal()
+		if err != nil {
+			t.Fatalf("Failed to encode welcome: %v", err)
+		}
+		if _, err := Unmarshal(append(encoded, 0)); err == nil {
+			t.Errorf("trailing bytes should be rejected")
+		}
+		decoded, err := Unmarshal(encoded)
+		if err != nil {
+			t.Fatalf("Failed to decode welcome: %v", err)
+		}
+
+		if _, _, _, err := decoded.Join(packages["bob"], initKeys["bob"], nil); !errors.Is(err, ErrNotInvited) {
+			t.Errorf("0x%04x: members not in the welcome should get ErrNotInvited, got %v", uint16(cs), err)
+		}
+		if _, _, _, err := decoded.Join(packages["dave"], initKeys["bob"], nil); err == nil {
+			t.Errorf("0x%04x: the wrong init key should not open the welcome", uint16(cs))
+		}
+
+		joined, secrets, info, err := decoded.Join(packages["dave"], initKeys["dave"], nil)
+		if err != nil {
+			t.Fatalf("0x%04x: dave failed to join: %v", uint16(cs), err)
+		}
+		if !bytes.Equal(secrets.JoinerSecret, []byte("joiner secret")) || !bytes.Equal(secrets.PathSecret, []byte("path secret")) {
+			t.Errorf("0x%04x: dave should recover the group secrets", uint16(cs))
+		}
+		if info.GroupContext.Epoch != group.Epoch() || joined.Epoch() != group.Epoch() || !bytes.Equal(joined.GroupID(), []byte("group")) {
+			t.Errorf("0x%04x: dave should join in the group's epoch", uint16(cs))
+		}
+		if !bytes.Equal(info.ConfirmationTag, []byte("tag")) || len(joined.InterimTranscriptHash()) == 0 {
+			t.Errorf("0x%04x: dave should derive the interim transcript hash from the confirmation tag", uint16(cs))
+		}
+		if !bytes.Equal(joined.TreeHash(), group.TreeHash()) {
+			t.Errorf("0x%04x: joined tree should hash like the group's tree", uint16(cs))
+		}
+		if leaves := joined.GetLeaves(); len(leaves) != 4 {
+			t.Errorf("0x%04x: joined tree should have 4 leaves, got %d", uint16(cs), len(leaves))
+		}
+
+		// A GroupInfo signed by someone other than the claimed signer is rejected
+		forged, _ := builder.Build(signers["bob"], "alice")
+		if _, _, _, err := forged.Join(packages["dave"], initKeys["dave"], nil); !errors.Is(err, tree.ErrInvalidSignature) {
+			t.Errorf("0x%04x: forged group info should fail signature verification, got %v", uint16(cs), err)
+		}
+		tampered := *decoded
+		tampered.EncryptedGroupInfo = append([]byte(nil), decoded.EncryptedGroupInfo...)
+		tampered.EncryptedGroupInfo[0] ^= 0xff
+		if _, _, _, err := tampered.Join(packages["dave"], initKeys["dave"], nil); err == nil {
+			t.Errorf("0x%04x: tampered group info should be rejected", uint16(cs))
+		}
+	}
+}
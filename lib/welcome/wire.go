@@ -0,0 +1,234 @@
+package welcome
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/snowmerak/mls/lib/internal/tls"
+	"github.com/snowmerak/mls/lib/tree"
+)
+
+// Marshal encodes the Welcome in its RFC 9420 wire format
+func (w *Welcome) Marshal() ([]byte, error) {
+	out := &tls.Writer{}
+	out.Uint16(uint16(w.CipherSuite))
+	err := out.Vector(func(out *tls.Writer) error {
+		for _, s := range w.Secrets {
+			if err := out.Opaque(s.NewMember); err != nil {
+				return err
+			}
+			if err := out.Opaque(s.EncryptedGroupSecrets.KEMOutput); err != nil {
+				return err
+			}
+			if err := out.Opaque(s.EncryptedGroupSecrets.Ciphertext); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode welcome: %w", err)
+	}
+	if err := out.Opaque(w.EncryptedGroupInfo); err != nil {
+		return nil, fmt.Errorf("failed to encode welcome: %w", err)
+	}
+	return out.Buf, nil
+}
+
+// Unmarshal decodes a Welcome written by Marshal
+func Unmarshal(data []byte) (*Welcome, error) {
+	r := &tls.Reader{Buf: data}
+	w := &Welcome{}
+	err := func() error {
+		cs, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		w.CipherSuite = tree.Ciphersuite(cs)
+		err = r.Vector(func(r *tls.Reader) error {
+			var s EncryptedGroupSecrets
+			var err error
+			if s.NewMember, err = r.Opaque(); err != nil {
+				return err
+			}
+			if s.EncryptedGroupSecrets.KEMOutput, err = r.Opaque(); err != nil {
+				return err
+			}
+			if s.EncryptedGroupSecrets.Ciphertext, err = r.Opaque(); err != nil {
+				return err
+			}
+			w.Secrets = append(w.Secrets, s)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		w.EncryptedGroupInfo, err = r.Opaque()
+		return err
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode welcome: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after welcome", len(r.Buf))
+	}
+	return w, nil
+}
+
+// Marshal encodes the GroupInfo in its RFC 9420 wire format
+func (gi *GroupInfo) Marshal() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := gi.encodeTBS(w); err != nil {
+		return nil, err
+	}
+	if err := w.Opaque(gi.Signature); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalGroupInfo decodes a GroupInfo written by Marshal
+// The signature is not checked, Welcome.Join verifies it against the ratchet tree
+func UnmarshalGroupInfo(data []byte) (*GroupInfo, error) {
+	r := &tls.Reader{Buf: data}
+	gi := &GroupInfo{}
+	err := func() error {
+		gc, rest, err := tree.ReadGroupContext(r.Buf)
+		if err != nil {
+			return err
+		}
+		gi.GroupContext, r.Buf = *gc, rest
+		if gi.Extensions, err = decodeExtensions(r); err != nil {
+			return err
+		}
+		if gi.ConfirmationTag, err = r.Opaque(); err != nil {
+			return err
+		}
+		if gi.Signer, err = r.Uint32(); err != nil {
+			return err
+		}
+		gi.Signature, err = r.Opaque()
+		return err
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode group info: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after group info", len(r.Buf))
+	}
+	return gi, nil
+}
+
+// marshalTBS encodes GroupInfoTBS, the signed part of the GroupInfo
+func (gi *GroupInfo) marshalTBS() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := gi.encodeTBS(w); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+func (gi *GroupInfo) encodeTBS(w *tls.Writer) error {
+	gc, err := gi.GroupContext.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	w.Buf = append(w.Buf, gc...)
+	if err := encodeExtensions(w, gi.Extensions); err != nil {
+		return err
+	}
+	if err := w.Opaque(gi.ConfirmationTag); err != nil {
+		return err
+	}
+	w.Uint32(gi.Signer)
+	return nil
+}
+
+// Marshal encodes the GroupSecrets in their RFC 9420 wire format with no PSKs
+func (gs *GroupSecrets) Marshal() ([]byte, error) {
+	w := &tls.Writer{}
+	if err := w.Opaque(gs.JoinerSecret); err != nil {
+		return nil, err
+	}
+	if gs.PathSecret == nil {
+		w.Uint8(0)
+	} else {
+		w.Uint8(1)
+		if err := w.Opaque(gs.PathSecret); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Vector(func(*tls.Writer) error { return nil }); err != nil {
+		return nil, err
+	}
+	return w.Buf, nil
+}
+
+// UnmarshalGroupSecrets decodes GroupSecrets written by Marshal
+func UnmarshalGroupSecrets(data []byte) (*GroupSecrets, error) {
+	r := &tls.Reader{Buf: data}
+	gs := &GroupSecrets{}
+	err := func() error {
+		var err error
+		if gs.JoinerSecret, err = r.Opaque(); err != nil {
+			return err
+		}
+		present, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		switch present {
+		case 0:
+		case 1:
+			if gs.PathSecret, err = r.Opaque(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid optional path secret flag %d", present)
+		}
+		return r.Vector(func(*tls.Reader) error {
+			return errors.New("pre-shared keys are not supported")
+		})
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode group secrets: %w", err)
+	}
+	if len(r.Buf) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after group secrets", len(r.Buf))
+	}
+	return gs, nil
+}
+
+func encodeExtensions(w *tls.Writer, extensions []tree.Extension) error {
+	return w.Vector(func(w *tls.Writer) error {
+		for _, ext := range extensions {
+			w.Uint16(ext.Type)
+			if err := w.Opaque(ext.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodeExtensions(r *tls.Reader) ([]tree.Extension, error) {
+	var extensions []tree.Extension
+	seen := make(map[uint16]bool)
+	err := r.Vector(func(r *tls.Reader) error {
+		kind, err := r.Uint16()
+		if err != nil {
+			return err
+		}
+		if seen[kind] {
+			return fmt.Errorf("duplicate extension type 0x%04x", kind)
+		}
+		seen[kind] = true
+		data, err := r.Opaque()
+		if err != nil {
+			return err
+		}
+		extensions = append(extensions, tree.Extension{Type: kind, Data: data})
+		return nil
+	})
+	return extensions, err
+}